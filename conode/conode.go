@@ -16,6 +16,7 @@ import (
 	"bufio"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -27,7 +28,7 @@ import (
 	_ "github.com/dedis/cothority/ftcosi/service"
 	_ "github.com/dedis/cothority/identity"
 	_ "github.com/dedis/cothority/skipchain"
-	_ "github.com/dedis/cothority/status/service"
+	status "github.com/dedis/cothority/status/service"
 	"github.com/dedis/kyber/util/encoding"
 	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet/app"
@@ -104,6 +105,12 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:      "health",
+			Usage:     "Check if the services of the servers in the group definition are healthy",
+			ArgsUsage: "Cothority group definition file",
+			Action:    checkHealth,
+		},
 		{
 			Name:   "convert64",
 			Usage:  "convert a base64 toml file to a hex toml file",
@@ -151,6 +158,44 @@ func checkConfig(c *cli.Context) error {
 	return check.Config(tomlFileName, c.Bool("detail"))
 }
 
+// checkHealth asks all servers whether their services are healthy. It
+// returns an error if one of them is not, so that it can be used as a
+// readiness probe.
+func checkHealth(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("please give the roster file to check")
+	}
+	file, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	group, err := app.ReadGroupDescToml(file)
+	if err != nil {
+		return err
+	}
+	client := status.NewClient()
+	healthy := true
+	for _, si := range group.Roster.List {
+		health, err := client.Health(si)
+		if err != nil {
+			fmt.Printf("[-] %s: %s\n", si.Address, err)
+			healthy = false
+			continue
+		}
+		for name, state := range health.Services {
+			fmt.Printf("%s %s: %s\n", si.Address, name, state)
+		}
+		if !health.Healthy {
+			healthy = false
+		}
+	}
+	if !healthy {
+		return errors.New("not all services are healthy")
+	}
+	return nil
+}
+
 func setup(c *cli.Context) error {
 	if c.String("config") != "" {
 		log.Fatal("[-] Configuration file option cannot be used for the 'setup' command")
@@ -5,4 +5,7 @@ This imports the experimental services that will not be used in the
 stable branch.
 */
 
-import _ "github.com/dedis/cothority/evoting/service"
+import (
+	_ "github.com/dedis/cothority/evoting/service"
+	_ "github.com/dedis/cothority/ocs/darc/service"
+)
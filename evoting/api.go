@@ -6,6 +6,8 @@ import (
 	"github.com/dedis/onet"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/skipchain"
 )
 
 // ServiceName is the identifier of the service (application name).
@@ -39,3 +41,24 @@ func (c *Client) LookupSciper(roster *onet.Roster, sciper string) (reply *Lookup
 	err = c.SendProtobuf(roster.RandomServerIdentity(), &LookupSciper{Sciper: sciper, LookupURL: c.LookupURL}, reply)
 	return
 }
+
+// VerifyReceipt checks the receipt returned when a ballot was cast and makes
+// sure that its block in the election skipchain holds the ballot. Use
+// Receipt.Counted to know if it is the last ballot of the voter, or
+// CountedBallot if the election has a count window.
+func (c *Client) VerifyReceipt(roster *onet.Roster, receipt *lib.Receipt) error {
+	return receipt.Verify(roster)
+}
+
+// CountedBallot returns the hash of the block holding the ballot of the user
+// that is counted in the election, nil if no ballot of the user is counted.
+// It can be compared with the Block of the receipts of the user.
+func (c *Client) CountedBallot(roster *onet.Roster, id skipchain.SkipBlockID,
+	user lib.UserID) (skipchain.SkipBlockID, error) {
+	reply := &GetCountedBallotReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(), &GetCountedBallot{ID: id, UserID: user}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Block, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/evoting"
+	"github.com/dedis/cothority/evoting/lib"
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/kyber"
 	"github.com/dedis/onet"
@@ -27,6 +28,7 @@ var (
 	argUser   = flag.Int("user", 0, "The SCIPER of an existing admin of this chain")
 	argSig    = flag.String("sig", "", "A signature proving that you can login to Tequila with the given SCIPER.")
 	argShow   = flag.Bool("show", false, "Show the current Master config")
+	argVerify = flag.String("verify", "", "ID of an election whose shuffles should be verified")
 )
 
 func main() {
@@ -55,6 +57,22 @@ func main() {
 		return
 	}
 
+	if *argVerify != "" {
+		id, err := hex.DecodeString(*argVerify)
+		if err != nil {
+			log.Fatal("id decode", err)
+		}
+		election, err := lib.FetchElection(roster, id)
+		if err != nil {
+			log.Fatal("get election: ", err)
+		}
+		if err = lib.VerifyMixes(election); err != nil {
+			log.Fatal("verify mixes: ", err)
+		}
+		fmt.Println("All shuffles are valid")
+		return
+	}
+
 	key, err := parseKey(*argKey)
 	if err != nil {
 		log.Fatal("cannot parse key: ", err)
@@ -0,0 +1,405 @@
+// This is a command line interface for the administrators of the evoting
+// service. It creates, lists, closes and exports elections without the web
+// front-end, by signing the requests with the private front-end key of the
+// master skipchain.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/evoting"
+	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/app"
+	"github.com/dedis/onet/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+func main() {
+	appCli := cli.NewApp()
+	appCli.Name = "evoting-admin"
+	appCli.Usage = "Administrates the elections of an evoting master skipchain"
+	appCli.Version = "0.1"
+	appCli.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "roster, r",
+			Usage: "path to the roster toml file",
+		},
+		cli.StringFlag{
+			Name:  "master, m",
+			Usage: "ID of the master skipchain in hex",
+		},
+		cli.StringFlag{
+			Name:  "key, k",
+			Usage: "private front-end key of the master in hex",
+		},
+		cli.IntFlag{
+			Name:  "user, u",
+			Usage: "SCIPER of an admin of the master",
+		},
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+	}
+	appCli.Commands = []cli.Command{
+		{
+			Name:      "create",
+			Aliases:   []string{"c"},
+			Usage:     "creates an election from a JSON description",
+			ArgsUsage: "election.json",
+			Action:    create,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l"},
+			Usage:   "lists the elections of the master skipchain",
+			Action:  list,
+		},
+		{
+			Name:      "shuffle",
+			Aliases:   []string{"s"},
+			Usage:     "shuffles the ballots of an election",
+			ArgsUsage: "electionID",
+			Action:    shuffle,
+		},
+		{
+			Name:      "decrypt",
+			Aliases:   []string{"d"},
+			Usage:     "decrypts the shuffled ballots of an election",
+			ArgsUsage: "electionID",
+			Action:    decrypt,
+		},
+		{
+			Name:      "export",
+			Aliases:   []string{"e"},
+			Usage:     "writes the results, the transcript and the audit log of an election",
+			ArgsUsage: "electionID",
+			Action:    export,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Value: "results",
+					Usage: "prefix of the written files",
+				},
+			},
+		},
+		{
+			Name:      "board",
+			Aliases:   []string{"b"},
+			Usage:     "appends the new blocks of an election to its bulletin board",
+			ArgsUsage: "electionID",
+			Action:    board,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Value: "board.jsonl",
+					Usage: "file of the bulletin board",
+				},
+			},
+		},
+	}
+	appCli.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		return nil
+	}
+	if err := appCli.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// admin holds the roster and the credentials given on the command line.
+type admin struct {
+	roster    *onet.Roster
+	master    skipchain.SkipBlockID
+	user      uint32
+	signature []byte
+	client    *evoting.Client
+}
+
+// newAdmin parses the global flags. The private key is only needed for the
+// requests changing an election.
+func newAdmin(c *cli.Context, needKey bool) (*admin, error) {
+	roster, err := parseRoster(c.GlobalString("roster"))
+	if err != nil {
+		return nil, errors.New("cannot parse roster: " + err.Error())
+	}
+	master, err := hex.DecodeString(c.GlobalString("master"))
+	if err != nil || len(master) == 0 {
+		return nil, errors.New("please give the ID of the master skipchain")
+	}
+	a := &admin{
+		roster: roster,
+		master: master,
+		user:   uint32(c.GlobalInt("user")),
+		client: evoting.NewClient(),
+	}
+	if c.GlobalString("key") == "" {
+		if needKey {
+			return nil, errors.New("please give the private front-end key")
+		}
+		return a, nil
+	}
+	private, err := parseScalar(c.GlobalString("key"))
+	if err != nil {
+		return nil, errors.New("cannot parse key: " + err.Error())
+	}
+	a.signature, err = sign(private, a.master, a.user)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// electionID returns the ID of the election given as first argument.
+func electionID(c *cli.Context) (skipchain.SkipBlockID, error) {
+	if c.NArg() != 1 {
+		return nil, errors.New("please give the ID of the election")
+	}
+	return hex.DecodeString(c.Args().First())
+}
+
+func create(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("please give the description of the election")
+	}
+	a, err := newAdmin(c, true)
+	if err != nil {
+		return err
+	}
+	election, err := readElection(c.Args().First())
+	if err != nil {
+		return err
+	}
+	reply := &evoting.OpenReply{}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.Open{
+		ID:        a.master,
+		Election:  election,
+		User:      a.user,
+		Signature: a.signature,
+	}, reply)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Election ID: %x\n", reply.ID)
+	fmt.Printf("Election key: %s\n", reply.Key)
+	return nil
+}
+
+func list(c *cli.Context) error {
+	a, err := newAdmin(c, true)
+	if err != nil {
+		return err
+	}
+	reply := &evoting.GetElectionsReply{}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.GetElections{
+		Master:    a.master,
+		User:      a.user,
+		Signature: a.signature,
+	}, reply)
+	if err != nil {
+		return err
+	}
+	for _, e := range reply.Elections {
+		fmt.Printf("%x %-9s %s - %s %s\n", e.ID, stageName(e.Stage),
+			time.Unix(e.Start, 0).Format(time.RFC3339),
+			time.Unix(e.End, 0).Format(time.RFC3339), e.Name["en"])
+	}
+	return nil
+}
+
+func shuffle(c *cli.Context) error {
+	a, err := newAdmin(c, true)
+	if err != nil {
+		return err
+	}
+	id, err := electionID(c)
+	if err != nil {
+		return err
+	}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.Shuffle{
+		ID:        id,
+		User:      a.user,
+		Signature: a.signature,
+	}, &evoting.ShuffleReply{})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Election shuffled")
+	return nil
+}
+
+func decrypt(c *cli.Context) error {
+	a, err := newAdmin(c, true)
+	if err != nil {
+		return err
+	}
+	id, err := electionID(c)
+	if err != nil {
+		return err
+	}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.Decrypt{
+		ID:        id,
+		User:      a.user,
+		Signature: a.signature,
+	}, &evoting.DecryptReply{})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Election decrypted")
+	return nil
+}
+
+// export writes the tallies with the verification transcript as JSON, the
+// tallies as CSV, and the audit log of the election.
+func export(c *cli.Context) error {
+	a, err := newAdmin(c, false)
+	if err != nil {
+		return err
+	}
+	id, err := electionID(c)
+	if err != nil {
+		return err
+	}
+	results := &evoting.ResultsReply{}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.Results{ID: id}, results)
+	if err != nil {
+		return err
+	}
+	audit := &evoting.GetAuditLogReply{}
+	err = a.client.SendProtobuf(a.roster.List[0], &evoting.GetAuditLog{ID: id}, audit)
+	if err != nil {
+		return err
+	}
+	auditJSON, err := json.MarshalIndent(audit.Entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	out := c.String("out")
+	names := []string{out + ".json", out + ".csv", out + "-audit.json"}
+	data := [][]byte{results.JSON, results.CSV, auditJSON}
+	for i, name := range names {
+		if err = ioutil.WriteFile(name, data[i], 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", name)
+	}
+	return nil
+}
+
+// board checks the bulletin board of the election, if it exists, and appends
+// the blocks that are missing. Only the roster is needed.
+func board(c *cli.Context) error {
+	roster, err := parseRoster(c.GlobalString("roster"))
+	if err != nil {
+		return errors.New("cannot parse roster: " + err.Error())
+	}
+	id, err := electionID(c)
+	if err != nil {
+		return err
+	}
+	name := c.String("out")
+	entries := 0
+	if f, err := os.Open(name); err == nil {
+		existing, err := lib.VerifyBoard(f, id)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		entries = len(existing)
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	written, err := lib.WriteBoard(f, roster, id, entries)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Appended %d entries to %s\n", written, name)
+	return nil
+}
+
+// readElection reads the description of an election in JSON. The fields
+// set by the service when the election is opened, like its ID and key, are
+// ignored.
+func readElection(path string) (*lib.Election, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	election := &lib.Election{}
+	if err = json.Unmarshal(buf, election); err != nil {
+		return nil, errors.New("cannot parse election: " + err.Error())
+	}
+	if election.End == 0 {
+		return nil, errors.New("election without end date")
+	}
+	return election, nil
+}
+
+// sign returns the signature of user for the given master, as the front-end
+// creates it after a successful login.
+func sign(private kyber.Scalar, master skipchain.SkipBlockID, user uint32) ([]byte, error) {
+	message := append([]byte{}, master...)
+	for _, c := range strconv.Itoa(int(user)) {
+		d, _ := strconv.Atoi(string(c))
+		message = append(message, byte(d))
+	}
+	return schnorr.Sign(cothority.Suite, private, message)
+}
+
+// stageName returns a readable name of the stage of an election.
+func stageName(stage lib.ElectionState) string {
+	switch stage {
+	case lib.Running:
+		return "running"
+	case lib.Shuffled:
+		return "shuffled"
+	case lib.Decrypted:
+		return "decrypted"
+	}
+	return "unknown"
+}
+
+// parseRoster reads a Dedis group toml file a converts it to a cothority roster.
+func parseRoster(path string) (*onet.Roster, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	group, err := app.ReadGroupDescToml(file)
+	if err != nil {
+		return nil, err
+	}
+	return group.Roster, nil
+}
+
+// parseScalar unmarshals a Ed25519 scalar given in hexadecimal form.
+func parseScalar(key string) (kyber.Scalar, error) {
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	scalar := cothority.Suite.Scalar()
+	if err = scalar.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return scalar, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestReadElection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evoting-admin")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "election.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`{
+		"Name": {"en": "Council"},
+		"Candidates": [123456, 234567],
+		"MaxChoices": 1,
+		"End": 2000000000,
+		"BallotType": 1
+	}`), 0644))
+	election, err := readElection(path)
+	require.Nil(t, err)
+	require.Equal(t, "Council", election.Name["en"])
+	require.Equal(t, []uint32{123456, 234567}, election.Candidates)
+	require.Equal(t, int64(2000000000), election.End)
+	require.Equal(t, lib.Approval, election.BallotType)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte(`{"Name": {"en": "Council"}}`), 0644))
+	_, err = readElection(path)
+	require.NotNil(t, err)
+
+	_, err = readElection(filepath.Join(dir, "missing.json"))
+	require.NotNil(t, err)
+}
+
+func TestSign(t *testing.T) {
+	kp := key.NewKeyPair(cothority.Suite)
+	buf, err := kp.Private.MarshalBinary()
+	require.Nil(t, err)
+	private, err := parseScalar(hex.EncodeToString(buf))
+	require.Nil(t, err)
+	require.True(t, private.Equal(kp.Private))
+	_, err = parseScalar("r")
+	require.NotNil(t, err)
+
+	master := []byte{1, 2, 3}
+	sig, err := sign(private, master, 123)
+	require.Nil(t, err)
+	require.Equal(t, []byte{1, 2, 3}, master)
+
+	// This is the digest checked by the service.
+	digest := append([]byte{}, master...)
+	for _, c := range strconv.Itoa(123) {
+		d, _ := strconv.Atoi(string(c))
+		digest = append(digest, byte(d))
+	}
+	require.Nil(t, schnorr.Verify(cothority.Suite, kp.Public, digest, sig))
+}
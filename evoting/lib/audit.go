@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/onet/network"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+func init() {
+	network.RegisterMessage(AuditEntry{})
+}
+
+// Actions recorded in the audit log of an election.
+const (
+	AuditOpen    = "open"
+	AuditShuffle = "shuffle"
+	AuditDecrypt = "decrypt"
+	AuditReshare = "reshare"
+)
+
+// auditDrift is how far the time of an audit entry may be from the time of
+// the conodes verifying it.
+var auditDrift = 5 * time.Minute
+
+// AuditEntry records an administrative action on an election. It is stored
+// in the election skipchain when the action is requested.
+type AuditEntry struct {
+	Action string // Action is one of the Audit constants.
+	User   uint32 // User is the admin requesting the action.
+	Time   int64  // Time is the unix timestamp of the request.
+
+	// UserID identifies the admin instead of User if it is set.
+	UserID UserID
+}
+
+// NewAuditEntry returns an entry for an action requested now.
+func NewAuditEntry(action string, user uint32) *AuditEntry {
+	return &AuditEntry{Action: action, User: user, Time: time.Now().Unix()}
+}
+
+// NewAuditEntryID works like NewAuditEntry for a user given by an opaque
+// identifier.
+func NewAuditEntryID(action string, user UserID) *AuditEntry {
+	return &AuditEntry{Action: action, UserID: user, Time: time.Now().Unix()}
+}
+
+// GetUser returns the identifier of the admin requesting the action.
+func (a *AuditEntry) GetUser() UserID {
+	return ResolveUser(a.User, a.UserID)
+}
+
+// verify checks that the entry was requested by user and that the user was
+// allowed to perform the action.
+func (a *AuditEntry) verify(s *skipchain.Service, election *Election, user UserID) error {
+	if !a.GetUser().Equal(user) {
+		return errors.New("audit error: user differs from transaction user")
+	}
+	drift := time.Now().Unix() - a.Time
+	if drift > int64(auditDrift.Seconds()) || -drift > int64(auditDrift.Seconds()) {
+		return errors.New("audit error: invalid time")
+	}
+	switch a.Action {
+	case AuditOpen:
+		master, err := GetMaster(s, election.Master)
+		if err != nil {
+			return err
+		}
+		if !master.IsAdminID(user) {
+			return errors.New("audit error: user not admin")
+		}
+	case AuditShuffle, AuditDecrypt, AuditReshare:
+		if !election.IsAdminID(user) {
+			return errors.New("audit error: user is not election admin")
+		}
+	default:
+		return errors.New("audit error: unknown action")
+	}
+	return nil
+}
+
+// AuditLog returns the audit entries of the election in the order they were
+// stored.
+func (e *Election) AuditLog(s *skipchain.Service) ([]*AuditEntry, error) {
+	entries := make([]*AuditEntry, 0)
+	chain := skipchain.NewChain(s.GetDB(), e.ID)
+	for block := chain.Next(); block != nil; block = chain.Next() {
+		transaction := UnmarshalTransaction(block.Data)
+		if transaction != nil && transaction.Audit != nil {
+			entries = append(entries, transaction.Audit)
+		}
+	}
+	if err := chain.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,27 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditEntryVerify(t *testing.T) {
+	e := &Election{Creator: 0, Admins: []uint32{1}}
+
+	assert.Nil(t, NewAuditEntry(AuditShuffle, 0).verify(nil, e, SciperID(0)))
+	assert.Nil(t, NewAuditEntry(AuditDecrypt, 1).verify(nil, e, SciperID(1)))
+	assert.NotNil(t, NewAuditEntry(AuditDecrypt, 2).verify(nil, e, SciperID(2)))
+	assert.NotNil(t, NewAuditEntry(AuditDecrypt, 1).verify(nil, e, SciperID(0)))
+	assert.NotNil(t, NewAuditEntry("modify", 0).verify(nil, e, SciperID(0)))
+
+	e.AdminIDs = []UserID{UserID("admin@example.com")}
+	entry := NewAuditEntryID(AuditDecrypt, UserID("admin@example.com"))
+	assert.Nil(t, entry.verify(nil, e, UserID("admin@example.com")))
+	assert.NotNil(t, entry.verify(nil, e, SciperID(1)))
+
+	entry = NewAuditEntry(AuditShuffle, 0)
+	entry.Time -= int64(2 * auditDrift / time.Second)
+	assert.NotNil(t, entry.verify(nil, e, SciperID(0)))
+}
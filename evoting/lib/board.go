@@ -0,0 +1,326 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// BoardEntry is a line of the bulletin board of an election, which mirrors
+// its skipchain as JSON lines, see WriteBoard. An entry holds all the fields
+// of a block covered by its hash, and the forward link of the previous block
+// to it, so observers can check that the board is the skipchain signed by the
+// conodes without talking to them. All binary values are hex encoded.
+type BoardEntry struct {
+	Index         int      `json:"index"`
+	Height        int      `json:"height"`
+	MaximumHeight int      `json:"maximum_height"`
+	BaseHeight    int      `json:"base_height"`
+	BackLinks     []string `json:"back_links"`
+	Verifiers     []string `json:"verifiers"`
+	Parent        string   `json:"parent"`
+	Genesis       string   `json:"genesis"`
+	// Data is the protobuf encoding of the transaction of the block.
+	Data string `json:"data"`
+	// Roster holds the public keys of the conodes of the block.
+	Roster []string `json:"roster"`
+	Hash   string   `json:"hash"`
+
+	// Type is the kind of the transaction, like "ballot", "mix" or
+	// "partial", and User the user who signed it.
+	Type string `json:"type"`
+	User uint32 `json:"user,omitempty"`
+
+	// Link is the forward link from the previous block, and is empty for
+	// the genesis block.
+	Link *BoardLink `json:"link,omitempty"`
+}
+
+// BoardLink is the forward link between two blocks, collectively signed by
+// the roster of the first block.
+type BoardLink struct {
+	// NewRoster is the id of the roster of the second block if the roster
+	// changes.
+	NewRoster string `json:"new_roster,omitempty"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// NewBoardEntry returns the entry of the block, which has to follow the
+// previous block. The previous block is nil for the genesis block.
+func NewBoardEntry(block, previous *skipchain.SkipBlock) (*BoardEntry, error) {
+	e := &BoardEntry{
+		Index:         block.Index,
+		Height:        block.Height,
+		MaximumHeight: block.MaximumHeight,
+		BaseHeight:    block.BaseHeight,
+		Parent:        hex.EncodeToString(block.ParentBlockID),
+		Genesis:       hex.EncodeToString(block.GenesisID),
+		Data:          hex.EncodeToString(block.Data),
+		Hash:          hex.EncodeToString(block.Hash),
+		Type:          "unknown",
+	}
+	for _, bl := range block.BackLinkIDs {
+		e.BackLinks = append(e.BackLinks, hex.EncodeToString(bl))
+	}
+	for _, v := range block.VerifierIDs {
+		e.Verifiers = append(e.Verifiers, hex.EncodeToString(v[:]))
+	}
+	if block.Roster != nil {
+		for _, pub := range block.Roster.Publics() {
+			buf, err := pub.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			e.Roster = append(e.Roster, hex.EncodeToString(buf))
+		}
+	}
+	if t := UnmarshalTransaction(block.Data); t != nil {
+		e.Type = transactionType(t)
+		e.User = t.User
+	}
+	if previous == nil {
+		return e, nil
+	}
+	for _, fl := range previous.ForwardLink {
+		if fl.From.Equal(previous.Hash) && fl.To.Equal(block.Hash) {
+			e.Link = &BoardLink{
+				Message:   hex.EncodeToString(fl.Signature.Msg),
+				Signature: hex.EncodeToString(fl.Signature.Sig),
+			}
+			if fl.NewRoster != nil {
+				e.Link.NewRoster = hex.EncodeToString(fl.NewRoster.ID[:])
+			}
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("missing forward link to block %d", block.Index)
+}
+
+// transactionType returns the name of the kind of the transaction.
+func transactionType(t *Transaction) string {
+	switch {
+	case t.Master != nil:
+		return "master"
+	case t.Link != nil:
+		return "link"
+	case t.Rotation != nil:
+		return "rotation"
+	case t.Election != nil:
+		return "election"
+	case t.Ballot != nil:
+		return "ballot"
+	case t.Mix != nil:
+		return "mix"
+	case t.Partial != nil:
+		return "partial"
+	case t.Snapshot != nil:
+		return "snapshot"
+	case t.Audit != nil:
+		return "audit"
+	case t.Reshare != nil:
+		return "reshare"
+	case t.Redaction != nil:
+		return "redaction"
+	}
+	return "unknown"
+}
+
+// block returns the block of the entry, without its forward links. The
+// roster only holds the public keys of the conodes.
+func (e *BoardEntry) block() (*skipchain.SkipBlock, error) {
+	sb := skipchain.NewSkipBlock()
+	sb.Index = e.Index
+	sb.Height = e.Height
+	sb.MaximumHeight = e.MaximumHeight
+	sb.BaseHeight = e.BaseHeight
+	var err error
+	for _, bl := range e.BackLinks {
+		var id []byte
+		if id, err = hex.DecodeString(bl); err != nil {
+			return nil, err
+		}
+		sb.BackLinkIDs = append(sb.BackLinkIDs, id)
+	}
+	for _, v := range e.Verifiers {
+		var id []byte
+		if id, err = hex.DecodeString(v); err != nil {
+			return nil, err
+		}
+		var verifier skipchain.VerifierID
+		if len(id) != len(verifier) {
+			return nil, errors.New("wrong length of verifier")
+		}
+		copy(verifier[:], id)
+		sb.VerifierIDs = append(sb.VerifierIDs, verifier)
+	}
+	if sb.ParentBlockID, err = hex.DecodeString(e.Parent); err != nil {
+		return nil, err
+	}
+	if sb.GenesisID, err = hex.DecodeString(e.Genesis); err != nil {
+		return nil, err
+	}
+	if sb.Data, err = hex.DecodeString(e.Data); err != nil {
+		return nil, err
+	}
+	if len(e.Roster) > 0 {
+		var list []*network.ServerIdentity
+		for _, p := range e.Roster {
+			var pub kyber.Point
+			if pub, err = decodePoint(p); err != nil {
+				return nil, err
+			}
+			list = append(list, &network.ServerIdentity{Public: pub})
+		}
+		sb.Roster = &onet.Roster{List: list}
+	}
+	if sb.Hash, err = hex.DecodeString(e.Hash); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// link returns the forward link of the entry from the previous block.
+func (e *BoardEntry) link(previous *skipchain.SkipBlock, block *skipchain.SkipBlock) (*skipchain.ForwardLink, error) {
+	if e.Link == nil {
+		return nil, fmt.Errorf("missing forward link to block %d", e.Index)
+	}
+	fl := &skipchain.ForwardLink{From: previous.Hash, To: block.Hash}
+	var err error
+	if e.Link.NewRoster != "" {
+		var id []byte
+		if id, err = hex.DecodeString(e.Link.NewRoster); err != nil {
+			return nil, err
+		}
+		fl.NewRoster = &onet.Roster{}
+		if len(id) != len(fl.NewRoster.ID) {
+			return nil, errors.New("wrong length of roster id")
+		}
+		copy(fl.NewRoster.ID[:], id)
+	}
+	if fl.Signature.Msg, err = hex.DecodeString(e.Link.Message); err != nil {
+		return nil, err
+	}
+	if fl.Signature.Sig, err = hex.DecodeString(e.Link.Signature); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+// samePublics returns true if both rosters hold the same keys in the same
+// order.
+func samePublics(a, b *onet.Roster) bool {
+	if len(a.List) != len(b.List) {
+		return false
+	}
+	for i, si := range a.List {
+		if !si.Public.Equal(b.List[i].Public) {
+			return false
+		}
+	}
+	return true
+}
+
+func decodePoint(s string) (kyber.Point, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	pub := cothority.Suite.Point()
+	return pub, pub.UnmarshalBinary(buf)
+}
+
+// WriteBoard writes the entries of the blocks of the election skipchain id,
+// starting at the index from, as JSON lines to w, and returns how many were
+// written. A board is kept up to date by appending the entries from the
+// number of entries it already holds.
+func WriteBoard(w io.Writer, roster *onet.Roster, id skipchain.SkipBlockID, from int) (int, error) {
+	start := from - 1
+	if start < 0 {
+		start = 0
+	}
+	stream := skipchain.NewClient().StreamBlocks(roster, id, start)
+	defer stream.Close()
+	encoder := json.NewEncoder(w)
+	var previous *skipchain.SkipBlock
+	written := 0
+	for block := range stream.Blocks {
+		if block.Index >= from {
+			entry, err := NewBoardEntry(block, previous)
+			if err != nil {
+				return written, err
+			}
+			if err = encoder.Encode(entry); err != nil {
+				return written, err
+			}
+			written++
+		}
+		previous = block
+	}
+	return written, stream.Err()
+}
+
+// VerifyBoard reads the bulletin board of the election skipchain id from r
+// and checks that it is the skipchain: the entries follow each other from
+// the genesis block, their hashes are correct, and every block is linked to
+// the previous one with a forward link signed by its roster. It returns the
+// entries of the board.
+func VerifyBoard(r io.Reader, id skipchain.SkipBlockID) ([]*BoardEntry, error) {
+	var entries []*BoardEntry
+	var previous *skipchain.SkipBlock
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<26)
+	for scanner.Scan() {
+		entry := &BoardEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("entry %d: %v", len(entries), err)
+		}
+		block, err := entry.block()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", len(entries), err)
+		}
+		if block.Index != len(entries) {
+			return nil, fmt.Errorf("entry %d holds block %d", len(entries), block.Index)
+		}
+		if !block.CalculateHash().Equal(block.Hash) {
+			return nil, fmt.Errorf("wrong hash of block %d", block.Index)
+		}
+		if previous == nil {
+			if !block.Hash.Equal(id) {
+				return nil, errors.New("board doesn't start at the genesis block")
+			}
+		} else {
+			if len(block.BackLinkIDs) == 0 || !block.BackLinkIDs[0].Equal(previous.Hash) {
+				return nil, fmt.Errorf("block %d doesn't follow the previous one", block.Index)
+			}
+			fl, err := entry.link(previous, block)
+			if err != nil {
+				return nil, err
+			}
+			if previous.Roster == nil || block.Roster == nil {
+				return nil, fmt.Errorf("missing roster in block %d", previous.Index)
+			}
+			if fl.NewRoster == nil && !samePublics(previous.Roster, block.Roster) {
+				return nil, fmt.Errorf("roster change to block %d not signed", block.Index)
+			}
+			if err := fl.Verify(cothority.Suite, previous.Roster.Publics()); err != nil {
+				return nil, fmt.Errorf("forward link to block %d: %v", block.Index, err)
+			}
+		}
+		entries = append(entries, entry)
+		previous = block
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
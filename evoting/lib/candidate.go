@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Candidate holds the metadata of a candidate for the front-ends, so that
+// they don't need a separate database of the candidates.
+type Candidate struct {
+	ID        uint32            // ID is the candidate in Candidates or in a question.
+	Name      string            // Name is the display name.
+	Photo     string            // Photo is the URL of a picture of the candidate.
+	Statement map[string]string // Statement of the candidate. lang-code, value pair
+	List      string            // List is the list or party of the candidate.
+}
+
+// Candidate returns the metadata of a candidate, or nil if the election has
+// none for it.
+func (e *Election) Candidate(id uint32) *Candidate {
+	for _, c := range e.CandidateInfo {
+		if c != nil && c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkCandidates returns an error if metadata is given twice, or for a
+// candidate that is not part of the election, or if a photo is not an http
+// or https URL.
+func (e *Election) checkCandidates() error {
+	candidates := make(map[uint32]bool)
+	for q := 0; q < e.NumQuestions(); q++ {
+		for _, c := range e.Question(q).Candidates {
+			candidates[c] = true
+		}
+	}
+	seen := make(map[uint32]bool)
+	for _, c := range e.CandidateInfo {
+		if c == nil {
+			return errors.New("missing candidate metadata")
+		}
+		if !candidates[c.ID] {
+			return fmt.Errorf("metadata of unknown candidate %d", c.ID)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("candidate %d has metadata twice", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Photo != "" {
+			u, err := url.Parse(c.Photo)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("invalid photo of candidate %d", c.ID)
+			}
+		}
+	}
+	return nil
+}
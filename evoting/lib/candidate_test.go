@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElection_CheckCandidates(t *testing.T) {
+	e := &Election{
+		Candidates:    []uint32{1, 2},
+		CandidateInfo: []*Candidate{{ID: 1, Name: "Alice", Photo: "https://example.com/alice.jpg"}},
+	}
+	assert.Nil(t, e.checkCandidates())
+	assert.Equal(t, "Alice", e.Candidate(1).Name)
+	assert.Nil(t, e.Candidate(2))
+
+	e.CandidateInfo = append(e.CandidateInfo, &Candidate{ID: 3})
+	assert.NotNil(t, e.checkCandidates())
+	e.CandidateInfo[1] = &Candidate{ID: 1}
+	assert.NotNil(t, e.checkCandidates())
+	e.CandidateInfo[1] = &Candidate{ID: 2, Photo: "javascript:alert(1)"}
+	assert.NotNil(t, e.checkCandidates())
+
+	// Candidates of the questions replace Candidates.
+	e.CandidateInfo = []*Candidate{{ID: 4}}
+	assert.NotNil(t, e.checkCandidates())
+	e.Questions = []*Question{{Candidates: []uint32{4}}}
+	assert.Nil(t, e.checkCandidates())
+}
@@ -52,6 +52,13 @@ func StoreUsingWebsocket(id skipchain.SkipBlockID, roster *onet.Roster, transact
 // Store appends a new block holding data to an existing skipchain using the
 // skipchain service
 func Store(s *skipchain.Service, ID skipchain.SkipBlockID, transaction *Transaction) (skipchain.SkipBlockID, error) {
+	return StoreRoster(s, ID, nil, transaction)
+}
+
+// StoreRoster works like Store, but the new block, and the blocks following
+// it, are handled by roster. A nil roster keeps the roster of the skipchain.
+func StoreRoster(s *skipchain.Service, ID skipchain.SkipBlockID, roster *onet.Roster,
+	transaction *Transaction) (skipchain.SkipBlockID, error) {
 	db := s.GetDB()
 	latest, err := db.GetLatest(db.GetByID(ID))
 	if err != nil {
@@ -65,6 +72,9 @@ func Store(s *skipchain.Service, ID skipchain.SkipBlockID, transaction *Transact
 
 	block := latest.Copy()
 	block.Data = enc
+	if roster != nil {
+		block.Roster = roster
+	}
 	block.GenesisID = block.SkipChainID()
 	block.Index++
 	// Using an unset LatestID with block.GenesisID set is to ensure concurrent
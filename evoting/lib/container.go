@@ -1,6 +1,9 @@
 package lib
 
 import (
+	"crypto/sha256"
+	"fmt"
+
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/proof"
 	"github.com/dedis/kyber/share/dkg/rabin"
@@ -17,6 +20,68 @@ type Ballot struct {
 	// ElGamal ciphertext pair.
 	Alpha kyber.Point
 	Beta  kyber.Point
+
+	// Answers holds the ciphertexts for the questions after the first one
+	// in a multi-question election, followed by the write-in text if the
+	// election allows it. Alpha and Beta hold the first answer.
+	// As every question is shuffled on its own, the answers of a ballot in
+	// a mix don't belong to the same voter.
+	Answers []*Ciphertext
+
+	// Proofs holds a proof for every question that the ciphertext holds a
+	// valid answer, see Election.EncryptBallot.
+	Proofs [][]byte
+
+	// UserID identifies the user instead of User if it is set.
+	UserID UserID
+
+	// Time is the unix timestamp the ballot was cast at. It is set by the
+	// leader and checked by the conodes if the election has a CountWindow.
+	// It is not part of the Hash, as the voter doesn't sign it.
+	Time int64
+}
+
+// GetUser returns the identifier of the user of the ballot.
+func (b *Ballot) GetUser() UserID {
+	return ResolveUser(b.User, b.UserID)
+}
+
+// Hash returns the sha256 hash of the user and the ciphertexts of the ballot.
+func (b *Ballot) Hash() []byte {
+	h := sha256.New()
+	h.Write(b.GetUser())
+	points := []kyber.Point{b.Alpha, b.Beta}
+	for _, answer := range b.Answers {
+		points = append(points, answer.Alpha, answer.Beta)
+	}
+	for _, p := range points {
+		if p != nil {
+			p.MarshalTo(h)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// WellFormed returns an error if a ciphertext of the ballot is missing or
+// has a null point, which would not hide the answer.
+func (b *Ballot) WellFormed() error {
+	ciphertexts := append([]*Ciphertext{{b.Alpha, b.Beta}}, b.Answers...)
+	null := cothority.Suite.Point().Null()
+	for i, c := range ciphertexts {
+		if c == nil || c.Alpha == nil || c.Beta == nil {
+			return fmt.Errorf("answer %d: missing ciphertext", i)
+		}
+		if c.Alpha.Equal(null) || c.Beta.Equal(null) {
+			return fmt.Errorf("answer %d: invalid ciphertext", i)
+		}
+	}
+	return nil
+}
+
+// Ciphertext is an ElGamal ciphertext pair.
+type Ciphertext struct {
+	Alpha kyber.Point
+	Beta  kyber.Point
 }
 
 // Box is a wrapper around a list of encrypted ballots.
@@ -24,6 +89,26 @@ type Box struct {
 	Ballots []*Ballot
 }
 
+// Equal returns true if both boxes hold the same ballots in the same order.
+func (b *Box) Equal(other *Box) bool {
+	if len(b.Ballots) != len(other.Ballots) {
+		return false
+	}
+	for i, ballot := range b.Ballots {
+		o := other.Ballots[i]
+		if !ballot.GetUser().Equal(o.GetUser()) || len(ballot.Answers) != len(o.Answers) ||
+			!ballot.Alpha.Equal(o.Alpha) || !ballot.Beta.Equal(o.Beta) {
+			return false
+		}
+		for j, answer := range ballot.Answers {
+			if !answer.Alpha.Equal(o.Answers[j].Alpha) || !answer.Beta.Equal(o.Answers[j].Beta) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // genMix generates n mixes with corresponding proofs out of the ballots.
 func (b *Box) genMix(key kyber.Point, n int) []*Mix {
 	mixes := make([]*Mix, n)
@@ -44,6 +129,20 @@ type Mix struct {
 	Proof   []byte    // Proof of the shuffle.
 
 	Node string // Node signifies the creator of the mix.
+
+	Proofs [][]byte // Proofs of the shuffles of the other questions.
+}
+
+// QuestionProof returns the proof of the shuffle of the given question, or
+// nil if there is none.
+func (m *Mix) QuestionProof(question int) []byte {
+	if question == 0 {
+		return m.Proof
+	}
+	if question > len(m.Proofs) {
+		return nil
+	}
+	return m.Proofs[question-1]
 }
 
 // Partial contains the partially decrypted ballots.
@@ -52,6 +151,15 @@ type Partial struct {
 
 	Flag bool   // Flag signals if the mixes could not be verified.
 	Node string // Node signifies the creator of this partial decryption.
+
+	Answers []*Points // Answers are the partial decryptions of the other questions.
+
+	Index int // Index is the index of the DKG share of the creator.
+}
+
+// Points is a list of points for one question.
+type Points struct {
+	Points []kyber.Point
 }
 
 // genPartials generates partial decryptions for a given list of shared secrets.
@@ -64,11 +172,41 @@ func (m *Mix) genPartials(dkgs []*dkg.DistKeyGenerator) []*Partial {
 		for j, ballot := range m.Ballots {
 			points[j] = Decrypt(secret.V, ballot.Alpha, ballot.Beta)
 		}
-		partials[i] = &Partial{Points: points, Node: string(i)}
+		partials[i] = &Partial{Points: points, Node: string(i), Index: secret.Index}
 	}
 	return partials
 }
 
+// SplitQuestion works like Split, but returns the ElGamal pairs of the
+// given question.
+func SplitQuestion(ballots []*Ballot, question int) (alpha, beta []kyber.Point) {
+	if question == 0 {
+		return Split(ballots)
+	}
+	n := len(ballots)
+	alpha, beta = make([]kyber.Point, n), make([]kyber.Point, n)
+	for i := range ballots {
+		answer := ballots[i].Answers[question-1]
+		alpha[i] = answer.Alpha
+		beta[i] = answer.Beta
+	}
+	return
+}
+
+// SetQuestion stores the ElGamal pairs of the given question in the ballots.
+func SetQuestion(ballots []*Ballot, question int, alpha, beta []kyber.Point) {
+	for i := range ballots {
+		if question == 0 {
+			ballots[i].Alpha, ballots[i].Beta = alpha[i], beta[i]
+			continue
+		}
+		for len(ballots[i].Answers) < question {
+			ballots[i].Answers = append(ballots[i].Answers, &Ciphertext{})
+		}
+		ballots[i].Answers[question-1] = &Ciphertext{Alpha: alpha[i], Beta: beta[i]}
+	}
+}
+
 // Split separates the ElGamal pairs of a list of ballots into separate lists.
 func Split(ballots []*Ballot) (alpha, beta []kyber.Point) {
 	n := len(ballots)
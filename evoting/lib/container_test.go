@@ -41,3 +41,21 @@ func TestCombine(t *testing.T) {
 	assert.Equal(t, X2, ballots[0].Beta)
 	assert.Equal(t, X2, ballots[1].Beta)
 }
+
+func TestSplitQuestion(t *testing.T) {
+	_, X1 := RandomKeyPair()
+	_, X2 := RandomKeyPair()
+
+	ballots := []*Ballot{{}, {}}
+	SetQuestion(ballots, 0, []kyber.Point{X1, X1}, []kyber.Point{X2, X2})
+	SetQuestion(ballots, 2, []kyber.Point{X2, X2}, []kyber.Point{X1, X1})
+	assert.Equal(t, X1, ballots[1].Alpha)
+	assert.Equal(t, 2, len(ballots[1].Answers))
+
+	a, b := SplitQuestion(ballots, 0)
+	assert.Equal(t, []kyber.Point{X1, X1}, a)
+	assert.Equal(t, []kyber.Point{X2, X2}, b)
+	a, b = SplitQuestion(ballots, 2)
+	assert.Equal(t, []kyber.Point{X2, X2}, a)
+	assert.Equal(t, []kyber.Point{X1, X1}, b)
+}
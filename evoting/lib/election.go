@@ -3,11 +3,13 @@ package lib
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dedis/kyber"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/network"
 
+	"github.com/dedis/cothority/ocs/darc"
 	"github.com/dedis/cothority/skipchain"
 )
 
@@ -23,6 +25,22 @@ const (
 	Decrypted
 )
 
+// BallotType defines how voters fill in their ballot.
+type BallotType uint32
+
+const (
+	// Plurality ballots hold up to MaxChoices candidates and the candidates
+	// with the most votes win.
+	Plurality BallotType = iota
+	// Approval ballots hold all candidates the voter approves of, and the
+	// candidates with the most approvals win.
+	Approval
+	// Ranked ballots hold up to MaxChoices candidates in order of preference.
+	// They are tallied using single transferable vote, which is the same as
+	// instant-runoff if there is only one seat.
+	Ranked
+)
+
 func init() {
 	network.RegisterMessages(Election{}, Ballot{}, Box{}, Mix{}, Partial{})
 }
@@ -53,6 +71,114 @@ type Election struct {
 	Footer footer // Footer denotes the Election footer
 
 	Voted skipchain.SkipBlockID // Voted denotes if a user has already cast a ballot for this election.
+
+	BallotType BallotType // BallotType defines how the ballots are filled in and tallied.
+	Seats      int        // Seats is the number of candidates to elect, 1 if not set.
+
+	// Questions holds the questions of a multi-question election. If it is
+	// empty, the election has a single question given by Candidates and
+	// MaxChoices.
+	Questions []*Question
+
+	// Darc, if set, gives the right to vote to all users of the darc and its
+	// evolutions, in addition to the scipers in Users. Such voters have to
+	// sign their ballot with a darc signature, see CanVote.
+	Darc *darc.Darc
+
+	// WriteIn is the maximum length in bytes of the write-in text of the
+	// ballots, 0 disables write-ins. It can be at most MaxWriteIn.
+	WriteIn int
+
+	// Threshold is the number of partial decryptions needed to reconstruct
+	// the ballots. It is set by the leader when the election is opened, and
+	// 0 for older elections, which need the partials of all the nodes.
+	Threshold int
+
+	// Admins can shuffle and decrypt the election like its creator, so
+	// that the election can be finished without the creator.
+	Admins []uint32
+
+	// MaxBallots is the number of ballots a user can cast, 0 for no limit.
+	// Only the last ballot of a user is counted.
+	MaxBallots int
+
+	// VoterRoot is the Merkle root of a voter roll, see VoterRoll. It
+	// registers voters without publishing their scipers in Users, and such
+	// voters have to cast their ballot with an inclusion proof.
+	VoterRoot []byte
+	// VoterCount is the number of voters in the voter roll.
+	VoterCount int
+
+	// MoreInfoLang is the url to AE Website per language. lang-code, value
+	// pair. MoreInfo is used for languages missing from it.
+	MoreInfoLang map[string]string
+	// Languages are the lang-codes the election metadata has to be given
+	// in, see CheckLanguages.
+	Languages []string
+
+	// BallotProofs requires every ballot to prove that it holds valid
+	// answers, see EncryptBallot. The write-in is not part of the proofs.
+	BallotProofs bool
+
+	// CreatorID, UserIDs and AdminIDs hold users given by opaque
+	// identifiers, see UserID. They are used in addition to the scipers of
+	// Creator, Users and Admins.
+	CreatorID UserID
+	UserIDs   []UserID
+	AdminIDs  []UserID
+
+	// CountWindow, if set, only counts the ballots cast in the last
+	// CountWindow seconds before End. A voter coerced to vote earlier can
+	// then cast another ballot without the coercer knowing, unless the
+	// coercer watches the voter during the whole window, see Counted.
+	CountWindow int64
+
+	// Homomorphic tallies the election by adding up the ballots instead of
+	// shuffling them, and only the sums are decrypted. It is restricted to
+	// a single question without write-ins or ranking, and the ballots have
+	// to be created by EncryptHomomorphic.
+	Homomorphic bool
+
+	// CandidateInfo holds the names, photos, statements and lists of the
+	// candidates of all questions. A candidate without metadata is only
+	// known by its sciper.
+	CandidateInfo []*Candidate
+
+	// Sections partition the voters, like the faculties of a university,
+	// and the ballots are counted per section as well as overall. Every
+	// voter has to be in a section, see Section.
+	Sections []*Section
+
+	// IsTest marks an election rehearsed on production conodes. The
+	// synthetic users TestUserID(0) to TestUserID(TestVoters-1) can vote in
+	// addition to the registered voters, the scheduler closes it soon after
+	// its end, and it is unlinked from the master skipchain later on, see
+	// Link.Unlink.
+	IsTest bool
+	// TestVoters is the number of synthetic voters of a test election.
+	TestVoters int
+
+	// Retention is the number of seconds after the end during which the
+	// users of the ballots are kept, see Redaction.
+	Retention int64
+	// Redacted is set once the voter data of the election is redacted.
+	Redacted bool
+
+	// Mixers are the public keys of the nodes of the roster that shuffle
+	// the ballots, in order. All the nodes shuffle if it is empty.
+	Mixers []kyber.Point
+}
+
+// MaxWriteIn is the maximum length of a write-in text, which has to be
+// embedded in a single point.
+const MaxWriteIn = 29
+
+// Question is one independent question of an election. Its answers are
+// encrypted, shuffled and decrypted separately from the other questions.
+type Question struct {
+	Title      map[string]string // Title of the question. lang-code, value pair
+	Candidates []uint32          // Candidates is the list of possible answers.
+	MaxChoices int               // MaxChoices is the max answers allowed.
 }
 
 // footer denotes the fields for the election footer
@@ -61,25 +187,19 @@ type footer struct {
 	ContactTitle string // ContactTitle stores the title of the Contact person.
 	ContactPhone string // ContactPhone stores the phone number of the Contact person.
 	ContactEmail string // ContactEmail stores the email address of the Contact person.
+
+	TextLang         map[string]string // TextLang is the footer content. lang-code, value pair
+	ContactTitleLang map[string]string // ContactTitleLang is the title of the Contact person. lang-code, value pair
 }
 
 // GetElection fetches the election structure from its skipchain and sets the stage.
 func GetElection(s *skipchain.Service, id skipchain.SkipBlockID,
-	checkVoted bool, user uint32) (*Election, error) {
+	checkVoted bool, user UserID) (*Election, error) {
 
-	block, err := s.GetSingleBlockByIndex(
-		&skipchain.GetSingleBlockByIndex{Genesis: id, Index: 1},
-	)
+	election, err := loadElection(s, id)
 	if err != nil {
 		return nil, err
 	}
-
-	// transaction := UnmarshalTransaction(reply.Update[1].Data)
-	transaction := UnmarshalTransaction(block.Data)
-	if transaction == nil || transaction.Election == nil {
-		return nil, fmt.Errorf("no election structure in %s", id.Short())
-	}
-	election := transaction.Election
 	err = election.setStage(s)
 	if err != nil {
 		return nil, err
@@ -92,29 +212,40 @@ func GetElection(s *skipchain.Service, id skipchain.SkipBlockID,
 	return election, nil
 }
 
-// setVoted sets the Voted field of the election to the skipblock id
-// of the last ballot cast by the user
-func (e *Election) setVoted(s *skipchain.Service, user uint32) error {
-	db := s.GetDB()
-	block := db.GetByID(e.ID)
-	if block == nil {
-		return errors.New("Election skipchain empty")
+// loadElection reads the election structure from its skipchain, without
+// setting the stage.
+func loadElection(s *skipchain.Service, id skipchain.SkipBlockID) (*Election, error) {
+	block, err := s.GetSingleBlockByIndex(
+		&skipchain.GetSingleBlockByIndex{Genesis: id, Index: 1},
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	for {
+	transaction := UnmarshalTransaction(block.Data)
+	if transaction == nil || transaction.Election == nil {
+		return nil, fmt.Errorf("no election structure in %s", id.Short())
+	}
+	return transaction.Election, nil
+}
+
+// setVoted sets the Voted field of the election to the skipblock id
+// of the last ballot cast by the user
+func (e *Election) setVoted(s *skipchain.Service, user UserID) error {
+	chain := skipchain.NewChain(s.GetDB(), e.ID)
+	for block := chain.Next(); block != nil; block = chain.Next() {
 		transaction := UnmarshalTransaction(block.Data)
-		if transaction.Ballot != nil && transaction.User == user {
+		if transaction == nil {
+			continue
+		}
+		if transaction.Ballot != nil && transaction.GetUser().Equal(user) {
 			e.Voted = block.Hash
 		}
 		if transaction.Mix != nil || transaction.Partial != nil {
 			break
 		}
-		if len(block.ForwardLink) == 0 {
-			break
-		}
-		block = db.GetByID(block.ForwardLink[0].To)
 	}
-	return nil
+	return chain.Err()
 }
 
 func (e *Election) setStage(s *skipchain.Service) error {
@@ -123,7 +254,24 @@ func (e *Election) setStage(s *skipchain.Service) error {
 	if err != nil {
 		return errors.New("error getting latest skipblock")
 	}
+	// The roster of the election changes when the shares are handed over to
+	// a new roster, see Reshare.
+	if genesis := db.GetByID(e.ID); genesis != nil && !latest.Roster.ID.Equal(genesis.Roster.ID) {
+		e.Roster = latest.Roster
+	}
 	transaction := UnmarshalTransaction(latest.Data)
+	// Audit entries, resharings and redactions don't change the stage.
+	for transaction != nil && (transaction.Audit != nil || transaction.Reshare != nil ||
+		transaction.Redaction != nil) && len(latest.BackLinkIDs) > 0 {
+		if transaction.Redaction != nil {
+			e.Redacted = true
+		}
+		latest = db.GetByID(latest.BackLinkIDs[0])
+		transaction = UnmarshalTransaction(latest.Data)
+	}
+	if transaction == nil {
+		return errors.New("cannot decode latest transaction")
+	}
 
 	if transaction.Partial != nil {
 		e.Stage = Decrypted
@@ -137,39 +285,121 @@ func (e *Election) setStage(s *skipchain.Service) error {
 
 // Box accumulates all the ballots while only keeping the last ballot for each user.
 func (e *Election) Box() (*Box, error) {
-	client := skipchain.NewClient()
-
-	block, err := client.GetSingleBlockByIndex(e.Roster, e.ID, 0)
+	blocks, err := skipchain.NewClient().GetBlocksWithPredicate(e.Roster, e.ID, PredicateBallot)
 	if err != nil {
 		return nil, err
 	}
 
 	// Use map to only included a user's last ballot.
 	ballots := make([]*Ballot, 0)
-	for {
-		transaction := UnmarshalTransaction(block.Data)
-		if transaction != nil && transaction.Ballot != nil {
+	for _, block := range blocks {
+		if transaction := UnmarshalTransaction(block.Data); transaction != nil {
 			ballots = append(ballots, transaction.Ballot)
 		}
+	}
 
-		if len(block.ForwardLink) <= 0 {
+	return e.Counted(&Box{Ballots: uniqueBallots(ballots)}), nil
+}
+
+// Counted returns the ballots of the box that are counted. With a
+// CountWindow, the last ballot of a user is dropped if it was cast before
+// the window, as are all the earlier ballots of the user.
+func (e *Election) Counted(box *Box) *Box {
+	if e.CountWindow <= 0 {
+		return box
+	}
+	counted := &Box{Ballots: make([]*Ballot, 0, len(box.Ballots))}
+	for _, ballot := range box.Ballots {
+		if e.counts(ballot) {
+			counted.Ballots = append(counted.Ballots, ballot)
+		}
+	}
+	return counted
+}
+
+// counts returns true if the ballot was cast in the CountWindow, if any.
+func (e *Election) counts(ballot *Ballot) bool {
+	return e.CountWindow <= 0 || ballot.Time >= e.End-e.CountWindow
+}
+
+// CountedBallot returns the block holding the ballot of the user that is
+// counted in the election, or nil if none is. It is the last ballot of the
+// user before the shuffle, if it was cast in the CountWindow. Voters compare
+// it with the blocks of their receipts to know which ballot is tallied.
+func (e *Election) CountedBallot(s *skipchain.Service, user UserID) (
+	skipchain.SkipBlockID, *Ballot, error) {
+
+	var id skipchain.SkipBlockID
+	var last *Ballot
+	chain := skipchain.NewChain(s.GetDB(), e.ID)
+	for block := chain.Next(); block != nil; block = chain.Next() {
+		transaction := UnmarshalTransaction(block.Data)
+		if transaction == nil {
+			continue
+		}
+		if transaction.Mix != nil || transaction.Partial != nil {
 			break
 		}
-		block, _ = client.GetSingleBlock(e.Roster, block.ForwardLink[0].To)
+		if transaction.Ballot != nil && transaction.Ballot.GetUser().Equal(user) {
+			id, last = block.Hash, transaction.Ballot
+		}
+	}
+	if err := chain.Err(); err != nil {
+		return nil, nil, err
+	}
+	if last == nil || !e.counts(last) {
+		return nil, nil, nil
+	}
+	return id, last, nil
+}
+
+// LocalBox works like Box, but reads the blocks from the local skipchain
+// database. It walks back from the latest block until it finds a snapshot
+// of the box, and returns the number of ballots cast after that snapshot.
+func (e *Election) LocalBox(s *skipchain.Service) (*Box, int, error) {
+	db := s.GetDB()
+	block, err := db.GetLatest(db.GetByID(e.ID))
+	if err != nil {
+		return nil, 0, errors.New("error getting latest skipblock")
 	}
 
-	// Reverse ballot list
+	// Ballots are collected from the newest to the oldest.
+	var ballots []*Ballot
+	var snapshot *Box
+	for block != nil {
+		transaction := UnmarshalTransaction(block.Data)
+		if transaction != nil && transaction.Snapshot != nil {
+			snapshot = transaction.Snapshot
+			break
+		}
+		if transaction != nil && transaction.Ballot != nil {
+			ballots = append(ballots, transaction.Ballot)
+		}
+		if block.Index == 0 || len(block.BackLinkIDs) == 0 {
+			break
+		}
+		block = db.GetByID(block.BackLinkIDs[0])
+	}
+	pending := len(ballots)
 	for i, j := 0, len(ballots)-1; i < j; i, j = i+1, j-1 {
 		ballots[i], ballots[j] = ballots[j], ballots[i]
 	}
+	if snapshot != nil {
+		ballots = append(append([]*Ballot{}, snapshot.Ballots...), ballots...)
+	}
+	return &Box{Ballots: uniqueBallots(ballots)}, pending, nil
+}
 
-	// Only keep last casted ballot per user
-	mapping := make(map[uint32]bool)
+// uniqueBallots only keeps the last ballot of every user. The ballots are
+// returned in the order they were cast.
+func uniqueBallots(ballots []*Ballot) []*Ballot {
+	mapping := make(map[string]bool)
 	unique := make([]*Ballot, 0)
-	for _, ballot := range ballots {
-		if _, found := mapping[ballot.User]; !found {
-			unique = append(unique, ballot)
-			mapping[ballot.User] = true
+	for i := len(ballots) - 1; i >= 0; i-- {
+		user := string(ballots[i].GetUser())
+		if _, found := mapping[user]; !found {
+			unique = append(unique, ballots[i])
+			mapping[user] = true
 		}
 	}
 
@@ -177,72 +407,231 @@ func (e *Election) Box() (*Box, error) {
 	for i, j := 0, len(unique)-1; i < j; i, j = i+1, j-1 {
 		unique[i], unique[j] = unique[j], unique[i]
 	}
-	return &Box{Ballots: unique}, nil
+	return unique
 }
 
 // Mixes returns all mixes created by the roster conodes.
 func (e *Election) Mixes() ([]*Mix, error) {
-	client := skipchain.NewClient()
-
-	block, err := client.GetSingleBlockByIndex(e.Roster, e.ID, 0)
+	blocks, err := skipchain.NewClient().GetBlocksWithPredicate(e.Roster, e.ID, PredicateMix)
 	if err != nil {
 		return nil, err
 	}
 
 	mixes := make([]*Mix, 0)
-	for {
-		transaction := UnmarshalTransaction(block.Data)
-		if transaction != nil && transaction.Mix != nil {
+	for _, block := range blocks {
+		if transaction := UnmarshalTransaction(block.Data); transaction != nil {
 			mixes = append(mixes, transaction.Mix)
 		}
-
-		if len(block.ForwardLink) <= 0 {
-			break
-		}
-		block, _ = client.GetSingleBlock(e.Roster, block.ForwardLink[0].To)
 	}
 	return mixes, nil
 }
 
 // Partials returns the partial decryption for each roster conode.
 func (e *Election) Partials() ([]*Partial, error) {
-	client := skipchain.NewClient()
-
-	block, err := client.GetSingleBlockByIndex(e.Roster, e.ID, 0)
+	blocks, err := skipchain.NewClient().GetBlocksWithPredicate(e.Roster, e.ID, PredicatePartial)
 	if err != nil {
 		return nil, err
 	}
 
 	partials := make([]*Partial, 0)
-	for block != nil {
-		transaction := UnmarshalTransaction(block.Data)
-		if transaction != nil && transaction.Partial != nil {
+	for _, block := range blocks {
+		if transaction := UnmarshalTransaction(block.Data); transaction != nil {
 			partials = append(partials, transaction.Partial)
 		}
-
-		if len(block.ForwardLink) <= 0 {
-			break
-		}
-		var err error
-		block, err = client.GetSingleBlock(e.Roster, block.ForwardLink[0].To)
-		if err != nil {
-			break
-		}
 	}
 	return partials, nil
 }
 
+// NumQuestions returns the number of questions in the election.
+func (e *Election) NumQuestions() int {
+	if len(e.Questions) == 0 {
+		return 1
+	}
+	return len(e.Questions)
+}
+
+// NeededPartials returns the number of partial decryptions needed to
+// reconstruct the ballots.
+func (e *Election) NeededPartials() int {
+	if e.Threshold == 0 {
+		return len(e.Roster.List)
+	}
+	return e.Threshold
+}
+
+// NumMixes returns the number of mixes needed to decrypt the ballots: one
+// for every mixer, or the single aggregate of a homomorphic election.
+func (e *Election) NumMixes() int {
+	if e.Homomorphic {
+		return 1
+	}
+	if len(e.Mixers) > 0 {
+		return len(e.Mixers)
+	}
+	return len(e.Roster.List)
+}
+
+// DefaultThreshold is the threshold used when none is given in the
+// election: more than two thirds of the nodes.
+func DefaultThreshold(n int) int {
+	return n - (n-1)/3
+}
+
+// NumCiphertexts returns the number of ciphertexts in a ballot: one for
+// every question and one for the write-in if it is enabled. The write-in is
+// always the last answer of a ballot. A homomorphic ballot holds one
+// ciphertext for every candidate.
+func (e *Election) NumCiphertexts() int {
+	if e.Homomorphic {
+		return len(e.Candidates)
+	}
+	if e.WriteIn > 0 {
+		return e.NumQuestions() + 1
+	}
+	return e.NumQuestions()
+}
+
+// EncryptWriteIn returns the ciphertext of the write-in text of a ballot.
+func (e *Election) EncryptWriteIn(text string) (*Ciphertext, error) {
+	if e.WriteIn <= 0 {
+		return nil, errors.New("write-ins are disabled")
+	}
+	if len(text) > e.WriteIn {
+		return nil, errors.New("write-in too long")
+	}
+	alpha, beta := Encrypt(e.Key, []byte(text))
+	return &Ciphertext{Alpha: alpha, Beta: beta}, nil
+}
+
+// DecodeWriteIn returns the write-in text of a decrypted point. Texts longer
+// than allowed by the election are refused.
+func (e *Election) DecodeWriteIn(point kyber.Point) (string, error) {
+	data, err := point.Data()
+	if err != nil {
+		return "", err
+	}
+	if len(data) > e.WriteIn {
+		return "", errors.New("write-in too long")
+	}
+	return string(data), nil
+}
+
+// Question returns the election restricted to the i-th question, so that
+// its ballots can be tallied.
+func (e *Election) Question(i int) *Election {
+	if len(e.Questions) == 0 {
+		return e
+	}
+	q := *e
+	q.Candidates = e.Questions[i].Candidates
+	q.MaxChoices = e.Questions[i].MaxChoices
+	q.Questions = nil
+	return &q
+}
+
 // IsUser checks if a given user is a registered voter for the election.
 func (e *Election) IsUser(user uint32) bool {
+	return e.IsUserID(SciperID(user))
+}
+
+// IsUserID checks if a given user is a registered voter for the election.
+func (e *Election) IsUserID(user UserID) bool {
 	for _, u := range e.Users {
-		if u == user {
+		if SciperID(u).Equal(user) {
 			return true
 		}
 	}
+	for _, u := range e.UserIDs {
+		if u.Equal(user) {
+			return true
+		}
+	}
+	if i, ok := testVoter(user); ok && e.IsTest {
+		return i < e.TestVoters
+	}
 	return false
 }
 
+// BallotMessage returns the message a voter signs with a darc signature to
+// cast the ballot. It binds the ballot to the election.
+func (e *Election) BallotMessage(ballot *Ballot) []byte {
+	return append(append([]byte{}, e.ID...), ballot.Hash()...)
+}
+
+// DarcContext is the context of the darc signatures of ballots, see
+// darc.NewDarcSignatureContext. Signatures for other services are refused.
+var DarcContext = []byte("evoting")
+
+// CanVote returns nil if the user may cast a ballot, either because the user
+// is in the list of registered voters, or because the ballot is signed by a
+// user of the darc of the election. User still identifies the ballot, so a
+// later ballot of the same user replaces the earlier one.
+func (e *Election) CanVote(ballot *Ballot, sig *darc.Signature) error {
+	if e.IsUserID(ballot.GetUser()) {
+		return nil
+	}
+	if e.Darc == nil || sig == nil {
+		return errors.New("user not part")
+	}
+	if sig.SignaturePath.Role != darc.User {
+		return errors.New("darc signature is not a user signature")
+	}
+	if err := sig.CheckContext(DarcContext); err != nil {
+		return err
+	}
+	return sig.VerifyAt(e.BallotMessage(ballot), e.Darc, time.Now())
+}
+
+// InVoterRoll returns nil if the proof shows that the user is part of the
+// voter roll of the election.
+func (e *Election) InVoterRoll(user uint32, proof *VoterProof) error {
+	return e.InVoterRollID(SciperID(user), proof)
+}
+
+// InVoterRollID works like InVoterRoll for a user given by an opaque
+// identifier.
+func (e *Election) InVoterRollID(user UserID, proof *VoterProof) error {
+	if e.VoterRoot == nil {
+		return errors.New("election has no voter roll")
+	}
+	if proof == nil {
+		return errors.New("missing voter proof")
+	}
+	return proof.VerifyID(e.VoterRoot, user)
+}
+
 // IsCreator checks if a given user is the creator of the election.
 func (e *Election) IsCreator(user uint32) bool {
-	return user == e.Creator
+	return e.IsCreatorID(SciperID(user))
+}
+
+// IsCreatorID checks if a given user is the creator of the election. The
+// creator is given by CreatorID if it is set.
+func (e *Election) IsCreatorID(user UserID) bool {
+	return ResolveUser(e.Creator, e.CreatorID).Equal(user)
+}
+
+// IsAdmin checks if a given user is the creator or one of the admins of
+// the election.
+func (e *Election) IsAdmin(user uint32) bool {
+	return e.IsAdminID(SciperID(user))
+}
+
+// IsAdminID checks if a given user is the creator or one of the admins of
+// the election.
+func (e *Election) IsAdminID(user UserID) bool {
+	if e.IsCreatorID(user) {
+		return true
+	}
+	for _, admin := range e.Admins {
+		if SciperID(admin).Equal(user) {
+			return true
+		}
+	}
+	for _, admin := range e.AdminIDs {
+		if admin.Equal(user) {
+			return true
+		}
+	}
+	return false
 }
@@ -3,7 +3,12 @@ package lib
 import (
 	"testing"
 
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+
 	"github.com/stretchr/testify/assert"
+
+	"github.com/dedis/cothority/ocs/darc"
 )
 
 func TestIsUser(t *testing.T) {
@@ -17,3 +22,110 @@ func TestIsCreator(t *testing.T) {
 	assert.True(t, e.IsCreator(0))
 	assert.False(t, e.IsCreator(1))
 }
+
+func TestIsElectionAdmin(t *testing.T) {
+	e := &Election{Creator: 0, Users: []uint32{0, 1, 2}, Admins: []uint32{1}}
+	assert.True(t, e.IsAdmin(0))
+	assert.True(t, e.IsAdmin(1))
+	assert.False(t, e.IsAdmin(2))
+}
+
+func TestCanVote(t *testing.T) {
+	_, X := RandomKeyPair()
+	voter := darc.NewSignerEd25519(nil, nil)
+	other := darc.NewSignerEd25519(nil, nil)
+	d := darc.NewDarc(nil, &[]*darc.Identity{voter.Identity()}, nil)
+	e := &Election{ID: []byte{1, 2, 3}, Users: []uint32{0}}
+
+	a, b := Encrypt(X, []byte{1})
+	ballot := &Ballot{User: 0, Alpha: a, Beta: b}
+	assert.Nil(t, e.CanVote(ballot, nil))
+	ballot.User = 1
+	assert.NotNil(t, e.CanVote(ballot, nil))
+
+	sign := func(signer *darc.Signer, role darc.Role) *darc.Signature {
+		path := darc.NewSignaturePath([]*darc.Darc{d}, *signer.Identity(), role)
+		sig, err := darc.NewDarcSignatureContext(e.BallotMessage(ballot), path, signer, DarcContext)
+		assert.Nil(t, err)
+		return sig
+	}
+	sig := sign(voter, darc.User)
+	assert.NotNil(t, e.CanVote(ballot, sig))
+	e.Darc = d
+	assert.Nil(t, e.CanVote(ballot, sig))
+	assert.NotNil(t, e.CanVote(ballot, sign(other, darc.User)))
+	assert.NotNil(t, e.CanVote(ballot, sign(voter, darc.Owner)))
+
+	// Signatures bound to another service, or to none, are refused.
+	path := darc.NewSignaturePath([]*darc.Darc{d}, *voter.Identity(), darc.User)
+	ctxSig, err := darc.NewDarcSignatureContext(e.BallotMessage(ballot), path, voter, []byte("OnChainSecrets"))
+	assert.Nil(t, err)
+	assert.NotNil(t, e.CanVote(ballot, ctxSig))
+	ctxSig, err = darc.NewDarcSignature(e.BallotMessage(ballot), path, voter)
+	assert.Nil(t, err)
+	assert.NotNil(t, e.CanVote(ballot, ctxSig))
+
+	// The signature is bound to the ballot.
+	ballot.User = 2
+	assert.NotNil(t, e.CanVote(ballot, sig))
+}
+
+func TestNeededPartials(t *testing.T) {
+	e := &Election{Roster: &onet.Roster{List: make([]*network.ServerIdentity, 7)}}
+	assert.Equal(t, 7, e.NeededPartials())
+	e.Threshold = DefaultThreshold(7)
+	assert.Equal(t, 5, e.NeededPartials())
+	assert.Equal(t, 3, DefaultThreshold(3))
+	assert.Equal(t, 3, DefaultThreshold(4))
+}
+
+func TestQuestion(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2}, MaxChoices: 1}
+	assert.Equal(t, 1, e.NumQuestions())
+	assert.Equal(t, e, e.Question(0))
+
+	e.Questions = []*Question{
+		{Candidates: []uint32{3, 4}, MaxChoices: 1},
+		{Candidates: []uint32{5, 6, 7}, MaxChoices: 2},
+	}
+	assert.Equal(t, 2, e.NumQuestions())
+	q := e.Question(1)
+	assert.Equal(t, []uint32{5, 6, 7}, q.Candidates)
+	assert.Equal(t, 2, q.MaxChoices)
+	assert.Nil(t, q.Questions)
+	assert.Equal(t, []uint32{1, 2}, e.Candidates)
+}
+
+func TestWriteIn(t *testing.T) {
+	x, X := RandomKeyPair()
+	e := &Election{Key: X}
+	assert.Equal(t, 1, e.NumCiphertexts())
+	_, err := e.EncryptWriteIn("alice")
+	assert.NotNil(t, err)
+
+	e.WriteIn = 8
+	assert.Equal(t, 2, e.NumCiphertexts())
+	_, err = e.EncryptWriteIn("alice and bob")
+	assert.NotNil(t, err)
+	c, err := e.EncryptWriteIn("alice")
+	assert.Nil(t, err)
+	text, err := e.DecodeWriteIn(Decrypt(x, c.Alpha, c.Beta))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", text)
+
+	e.WriteIn = 3
+	_, err = e.DecodeWriteIn(Decrypt(x, c.Alpha, c.Beta))
+	assert.NotNil(t, err)
+}
+
+func TestCounted(t *testing.T) {
+	box := &Box{Ballots: []*Ballot{{User: 1, Time: 100}, {User: 2, Time: 250}, {User: 3, Time: 300}}}
+	e := &Election{End: 300}
+	assert.Equal(t, 3, len(e.Counted(box).Ballots))
+
+	e.CountWindow = 100
+	counted := e.Counted(box)
+	assert.Equal(t, 2, len(counted.Ballots))
+	assert.Equal(t, uint32(2), counted.Ballots[0].User)
+	assert.Equal(t, 3, len(box.Ballots))
+}
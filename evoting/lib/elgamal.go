@@ -12,12 +12,18 @@ import (
 // Encrypt performs the ElGamal encryption algorithm.
 func Encrypt(public kyber.Point, message []byte) (K, C kyber.Point) {
 	M := cothority.Suite.Point().Embed(message, random.New())
+	K, C, _ = encryptPoint(public, M)
+	return
+}
 
+// encryptPoint ElGamal-encrypts a point and also returns the ephemeral
+// private key, which is needed to prove what the ciphertext holds.
+func encryptPoint(public, M kyber.Point) (K, C kyber.Point, k kyber.Scalar) {
 	// ElGamal-encrypt the point to produce ciphertext (K,C).
-	k := cothority.Suite.Scalar().Pick(random.New()) // ephemeral private key
-	K = cothority.Suite.Point().Mul(k, nil)          // ephemeral DH public key
-	S := cothority.Suite.Point().Mul(k, public)      // ephemeral DH shared secret
-	C = S.Add(S, M)                                  // message blinded with secret
+	k = cothority.Suite.Scalar().Pick(random.New()) // ephemeral private key
+	K = cothority.Suite.Point().Mul(k, nil)         // ephemeral DH public key
+	S := cothority.Suite.Point().Mul(k, public)     // ephemeral DH shared secret
+	C = S.Add(S, M)                                 // message blinded with secret
 	return
 }
 
@@ -0,0 +1,254 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/proof"
+
+	"github.com/dedis/cothority"
+)
+
+// A homomorphic election is tallied without shuffling the ballots. Every
+// ballot holds an exponential ElGamal ciphertext of 1 or 0 for every
+// candidate, depending on whether the candidate is chosen. The ciphertexts of
+// all ballots are added up into a single aggregate ballot, which is stored
+// instead of the mixes, and only the sums are decrypted. The ballots prove
+// that every ciphertext holds 0 or 1, and that their sum is at most the
+// number of allowed choices, so a voter can't spoil the aggregate.
+
+// EncryptHomomorphic encrypts the choices of the user for a homomorphic
+// election, with the proofs checked by VerifyHomomorphic.
+func (e *Election) EncryptHomomorphic(user uint32, choices []uint32) (*Ballot, error) {
+	return e.encryptHomomorphic(&Ballot{User: user}, choices)
+}
+
+// EncryptHomomorphicID works like EncryptHomomorphic for a user given by an
+// opaque identifier.
+func (e *Election) EncryptHomomorphicID(user UserID, choices []uint32) (*Ballot, error) {
+	return e.encryptHomomorphic(&Ballot{UserID: user}, choices)
+}
+
+// encryptHomomorphic adds the ciphertexts and proofs to the ballot of the
+// user. The proof of the sum comes after the proofs of the candidates.
+func (e *Election) encryptHomomorphic(ballot *Ballot, choices []uint32) (*Ballot, error) {
+	if !e.Homomorphic {
+		return nil, errors.New("election is not homomorphic")
+	}
+	chosen := make(map[uint32]bool)
+	for _, c := range choices {
+		if chosen[c] {
+			return nil, errors.New("invalid answer")
+		}
+		chosen[c] = true
+	}
+	if len(choices) > e.maxVotes() {
+		return nil, errors.New("invalid answer")
+	}
+
+	K, C := cothority.Suite.Point().Null(), cothority.Suite.Point().Null()
+	r := cothority.Suite.Scalar().Zero()
+	for i, candidate := range e.Candidates {
+		vote := 0
+		if chosen[candidate] {
+			vote = 1
+			delete(chosen, candidate)
+		}
+		k, c, ri := encryptPoint(e.Key, votesPoint(vote))
+		p, err := e.proveVotes(ballot, i, k, c, ri, vote, 1)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			ballot.Alpha, ballot.Beta = k, c
+		} else {
+			ballot.Answers = append(ballot.Answers, &Ciphertext{Alpha: k, Beta: c})
+		}
+		ballot.Proofs = append(ballot.Proofs, p)
+		K.Add(K, k)
+		C.Add(C, c)
+		r.Add(r, ri)
+	}
+	if len(chosen) > 0 {
+		return nil, errors.New("invalid answer")
+	}
+	p, err := e.proveVotes(ballot, len(e.Candidates), K, C, r, len(choices), e.maxVotes())
+	if err != nil {
+		return nil, err
+	}
+	ballot.Proofs = append(ballot.Proofs, p)
+	return ballot, nil
+}
+
+// VerifyHomomorphic checks the proofs of a ballot created by
+// EncryptHomomorphic.
+func (e *Election) VerifyHomomorphic(ballot *Ballot) error {
+	n := len(e.Candidates)
+	if len(ballot.Answers) != n-1 || len(ballot.Proofs) != n+1 {
+		return errors.New("wrong number of ballot proofs")
+	}
+	K, C := cothority.Suite.Point().Null(), cothority.Suite.Point().Null()
+	for i := 0; i < n; i++ {
+		k, c := ballot.Alpha, ballot.Beta
+		if i > 0 {
+			k, c = ballot.Answers[i-1].Alpha, ballot.Answers[i-1].Beta
+		}
+		if k == nil || c == nil {
+			return errors.New("missing ciphertext")
+		}
+		if err := e.verifyVotes(ballot, i, k, c, 1); err != nil {
+			return err
+		}
+		K.Add(K, k)
+		C.Add(C, c)
+	}
+	return e.verifyVotes(ballot, n, K, C, e.maxVotes())
+}
+
+// Aggregate returns the sum of the ballots of the box, as a single ballot
+// without user.
+func (e *Election) Aggregate(box *Box) *Ballot {
+	sum := &Ballot{
+		Alpha: cothority.Suite.Point().Null(),
+		Beta:  cothority.Suite.Point().Null(),
+	}
+	for i := 1; i < len(e.Candidates); i++ {
+		sum.Answers = append(sum.Answers, &Ciphertext{
+			Alpha: cothority.Suite.Point().Null(),
+			Beta:  cothority.Suite.Point().Null(),
+		})
+	}
+	for _, ballot := range box.Ballots {
+		sum.Alpha.Add(sum.Alpha, ballot.Alpha)
+		sum.Beta.Add(sum.Beta, ballot.Beta)
+		for i, answer := range ballot.Answers {
+			if i < len(sum.Answers) {
+				sum.Answers[i].Alpha.Add(sum.Answers[i].Alpha, answer.Alpha)
+				sum.Answers[i].Beta.Add(sum.Answers[i].Beta, answer.Beta)
+			}
+		}
+	}
+	return sum
+}
+
+// VerifyAggregate returns nil if the mixes of a homomorphic election are a
+// single mix holding the aggregate of the box.
+func (e *Election) VerifyAggregate(box *Box, mixes []*Mix) error {
+	if len(mixes) != 1 {
+		return fmt.Errorf("%d aggregates instead of 1", len(mixes))
+	}
+	expected := &Box{Ballots: []*Ballot{e.Aggregate(box)}}
+	if !expected.Equal(&Box{Ballots: mixes[0].Ballots}) {
+		return errors.New("wrong aggregate of the ballots")
+	}
+	return nil
+}
+
+// DecodeVotes returns the number of votes from the decrypted sums of a
+// homomorphic election, which are at most max. The sums are found by
+// walking through the multiples of the base point once.
+func DecodeVotes(sums []kyber.Point, max int) ([]int, error) {
+	missing := make(map[string][]int)
+	for i, sum := range sums {
+		key := sum.String()
+		missing[key] = append(missing[key], i)
+	}
+	votes := make([]int, len(sums))
+	P := cothority.Suite.Point().Null()
+	for v := 0; v <= max && len(missing) > 0; v++ {
+		key := P.String()
+		for _, i := range missing[key] {
+			votes[i] = v
+		}
+		delete(missing, key)
+		P.Add(P, cothority.Suite.Point().Base())
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("sum of votes out of range")
+	}
+	return votes, nil
+}
+
+// homomorphicResult tallies the decrypted sums of every candidate.
+func (e *Election) homomorphicResult(sums []kyber.Point, ballots int) (*QuestionResult, error) {
+	votes, err := DecodeVotes(sums, ballots)
+	if err != nil {
+		return nil, err
+	}
+	if len(votes) != len(e.Candidates) {
+		return nil, errors.New("wrong number of sums")
+	}
+	counts := make(map[uint32]float64)
+	all := make(map[uint32]bool)
+	qr := &QuestionResult{}
+	for i, c := range e.Candidates {
+		counts[c] = float64(votes[i])
+		all[c] = true
+		qr.Votes = append(qr.Votes, &CandidateVotes{Candidate: c, Votes: counts[c]})
+	}
+	qr.Rounds = []map[uint32]float64{counts}
+	qr.Winners = e.ranking(func(a, b uint32) bool {
+		return counts[a] > counts[b]
+	}, all)[:e.seats()]
+	return qr, nil
+}
+
+// checkHomomorphic returns an error if the election can't be tallied
+// homomorphically.
+func (e *Election) checkHomomorphic() error {
+	if len(e.Questions) > 0 || e.WriteIn > 0 {
+		return errors.New("homomorphic tally needs a single question without write-ins")
+	}
+	if e.BallotType == Ranked {
+		return errors.New("homomorphic tally can't count ranked ballots")
+	}
+	if len(e.Candidates) == 0 {
+		return errors.New("homomorphic tally needs candidates")
+	}
+	return nil
+}
+
+// maxVotes returns the number of candidates a voter can choose.
+func (e *Election) maxVotes() int {
+	if e.BallotType == Approval || e.MaxChoices <= 0 || e.MaxChoices > len(e.Candidates) {
+		return len(e.Candidates)
+	}
+	return e.MaxChoices
+}
+
+// proveVotes proves that (K, C) encrypts votes, which is at most max. The
+// index is the candidate, or the number of candidates for the sum.
+func (e *Election) proveVotes(ballot *Ballot, index int, K, C kyber.Point, r kyber.Scalar,
+	votes, max int) ([]byte, error) {
+	pred := validityPredicate(max + 1)
+	prover := pred.Prover(cothority.Suite, map[string]kyber.Scalar{"r": r},
+		e.validityPoints(votesPoints(max), K, C), map[proof.Predicate]int{pred: votes})
+	return proof.HashProve(cothority.Suite, e.ballotProtocol(ballot, index), prover)
+}
+
+// verifyVotes checks a proof created by proveVotes.
+func (e *Election) verifyVotes(ballot *Ballot, index int, K, C kyber.Point, max int) error {
+	verifier := validityPredicate(max+1).Verifier(cothority.Suite,
+		e.validityPoints(votesPoints(max), K, C))
+	if index >= len(ballot.Proofs) ||
+		proof.HashVerify(cothority.Suite, e.ballotProtocol(ballot, index), verifier, ballot.Proofs[index]) != nil {
+		return errors.New("invalid ballot proof")
+	}
+	return nil
+}
+
+// votesPoint returns the plaintext of a number of votes.
+func votesPoint(votes int) kyber.Point {
+	s := cothority.Suite.Scalar().SetInt64(int64(votes))
+	return cothority.Suite.Point().Mul(s, nil)
+}
+
+// votesPoints returns the plaintexts of 0 to max votes.
+func votesPoints(max int) []kyber.Point {
+	points := make([]kyber.Point, max+1)
+	for i := range points {
+		points[i] = votesPoint(i)
+	}
+	return points
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/util/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+)
+
+func TestEncryptHomomorphic(t *testing.T) {
+	_, X := RandomKeyPair()
+	e := &Election{
+		ID:          []byte{1, 2, 3},
+		Key:         X,
+		Candidates:  []uint32{1, 2, 3},
+		MaxChoices:  2,
+		Homomorphic: true,
+	}
+
+	ballot, err := e.EncryptHomomorphic(5, []uint32{3, 1})
+	require.Nil(t, err)
+	assert.Equal(t, e.NumCiphertexts()-1, len(ballot.Answers))
+	assert.Nil(t, e.VerifyHomomorphic(ballot))
+
+	_, err = e.EncryptHomomorphic(5, []uint32{1, 2, 3})
+	assert.NotNil(t, err)
+	_, err = e.EncryptHomomorphic(5, []uint32{4})
+	assert.NotNil(t, err)
+	_, err = e.EncryptHomomorphic(5, []uint32{1, 1})
+	assert.NotNil(t, err)
+
+	// A voter can't put more than one vote on a candidate.
+	K, C, _ := encryptPoint(X, votesPoint(2))
+	cheat := *ballot
+	cheat.Alpha, cheat.Beta = K, C
+	assert.NotNil(t, e.VerifyHomomorphic(&cheat))
+
+	// The proofs are bound to the user.
+	ballot.User = 6
+	assert.NotNil(t, e.VerifyHomomorphic(ballot))
+}
+
+func TestHomomorphicTally(t *testing.T) {
+	x, X := RandomKeyPair()
+	e := &Election{
+		ID:          []byte{1, 2, 3},
+		Key:         X,
+		Candidates:  []uint32{1, 2, 3},
+		MaxChoices:  2,
+		Homomorphic: true,
+	}
+	box := &Box{}
+	for i, choices := range [][]uint32{{1}, {1, 2}, {2, 1}, {}, {3}} {
+		ballot, err := e.EncryptHomomorphic(uint32(i), choices)
+		require.Nil(t, err)
+		box.Ballots = append(box.Ballots, ballot)
+	}
+
+	sum := e.Aggregate(box)
+	mixes := []*Mix{{Ballots: []*Ballot{sum}}}
+	require.Nil(t, e.VerifyAggregate(box, mixes))
+	assert.NotNil(t, e.VerifyAggregate(&Box{Ballots: box.Ballots[1:]}, mixes))
+	assert.NotNil(t, e.VerifyAggregate(box, append(mixes, mixes[0])))
+
+	points := []kyber.Point{Decrypt(x, sum.Alpha, sum.Beta)}
+	var answers []*Points
+	for _, answer := range sum.Answers {
+		answers = append(answers, &Points{Points: []kyber.Point{Decrypt(x, answer.Alpha, answer.Beta)}})
+	}
+	results, err := NewResults(e, box, mixes, nil, points, answers)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(results.Questions))
+	qr := results.Questions[0]
+	assert.Equal(t, []uint32{1}, qr.Winners)
+	assert.Equal(t, map[uint32]float64{1: 3, 2: 2, 3: 1}, qr.Rounds[0])
+}
+
+func TestDecodeVotes(t *testing.T) {
+	votes, err := DecodeVotes([]kyber.Point{votesPoint(3), votesPoint(0), votesPoint(3)}, 5)
+	require.Nil(t, err)
+	assert.Equal(t, []int{3, 0, 3}, votes)
+
+	_, err = DecodeVotes([]kyber.Point{votesPoint(6)}, 5)
+	assert.NotNil(t, err)
+	_, err = DecodeVotes([]kyber.Point{cothority.Suite.Point().Pick(random.New())}, 5)
+	assert.NotNil(t, err)
+}
+
+func TestCheckHomomorphic(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2}, Homomorphic: true}
+	assert.Nil(t, e.checkHomomorphic())
+	e.WriteIn = 10
+	assert.NotNil(t, e.checkHomomorphic())
+	e.WriteIn = 0
+	e.BallotType = Ranked
+	assert.NotNil(t, e.checkHomomorphic())
+	e.BallotType = Approval
+	e.Candidates = nil
+	assert.NotNil(t, e.checkHomomorphic())
+}
@@ -0,0 +1,419 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/kyber/util/random"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+)
+
+func init() {
+	network.RegisterMessage(indexState{})
+}
+
+// Index keeps the stage of elections and the last ballot of every user, so
+// that GetElection doesn't have to read the whole election skipchain. An
+// election is read the first time it is needed, and afterwards Append reads
+// the new blocks, following the forward links from the last block it knows.
+// Once an election is redacted, the users are replaced by their salted
+// hashes, see Redaction.
+//
+// A persistent index also stores its entries in a bucket of the database,
+// so that after a restart only the blocks appended since the last block it
+// read are needed.
+type Index struct {
+	sync.Mutex
+	elections map[string]*indexEntry
+	masters   map[string]*masterEntry
+	salt      []byte // salt is hashed with the users of redacted elections.
+	db        *bolt.DB
+	bucket    []byte
+}
+
+type indexEntry struct {
+	election *Election
+	chain    *skipchain.Chain // chain returns the blocks not read yet.
+	stage    ElectionState
+	voted    map[string]skipchain.SkipBlockID
+	closed   bool // closed is set once the first mix or partial is read.
+	redacted bool // redacted is set once the redaction is read.
+	salt     []byte
+	last     int      // last is the index of the last block read.
+	changed  []string // changed holds the users to store in the database.
+	rewrite  bool     // rewrite is set if all the users have to be stored.
+}
+
+// masterEntry holds the elections linked to a master skipchain.
+type masterEntry struct {
+	chain    *skipchain.Chain // chain returns the blocks not read yet.
+	links    []*Link
+	unlinked []*Link
+}
+
+// indexState is the stored part of an entry, next to the last ballots.
+type indexState struct {
+	Last     int
+	Stage    ElectionState
+	Closed   bool
+	Redacted bool
+	Roster   *onet.Roster
+}
+
+// saltKey is the key of the salt in the bucket of a persistent index. The
+// other keys are the IDs of the elections, holding a bucket each.
+var saltKey = []byte("salt")
+
+// stateKey is the key of the indexState in the bucket of an election, and
+// votedKey the key of the bucket of the last ballots of the users.
+var stateKey, votedKey = []byte("state"), []byte("voted")
+
+// NewIndex returns an empty index with a random salt.
+func NewIndex() *Index {
+	salt := make([]byte, 32)
+	random.Bytes(salt, random.New())
+	return &Index{elections: make(map[string]*indexEntry),
+		masters: make(map[string]*masterEntry), salt: salt}
+}
+
+// NewPersistentIndex returns an index stored in the bucket of the database.
+// The salt is created the first time and then read from the bucket, so
+// that the redacted users don't change after a restart.
+func NewPersistentIndex(db *bolt.DB, bucket []byte) (*Index, error) {
+	i := NewIndex()
+	i.db, i.bucket = db, bucket
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		if salt := b.Get(saltKey); salt != nil {
+			i.salt = append([]byte{}, salt...)
+			return nil
+		}
+		return b.Put(saltKey, i.salt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Redact returns the salted hash replacing the user in the election once
+// it is redacted. The hashes of an election only differ between users.
+func (i *Index) Redact(id skipchain.SkipBlockID, user UserID) UserID {
+	return redactUser(i.salt, id, user)
+}
+
+// GetElection works like the GetElection function, but takes the stage and
+// the last ballot of the user from the index.
+func (i *Index) GetElection(s *skipchain.Service, id skipchain.SkipBlockID,
+	checkVoted bool, user UserID) (*Election, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	entry, err := i.update(s, id)
+	if err != nil {
+		return nil, err
+	}
+	election := *entry.election
+	election.Stage = entry.stage
+	election.Redacted = entry.redacted
+	if checkVoted {
+		election.Voted = entry.voted[string(entry.key(user))]
+	}
+	return &election, nil
+}
+
+// Invalidate removes an election from the index, it is read again from the
+// skipchain the next time it is needed.
+func (i *Index) Invalidate(id skipchain.SkipBlockID) {
+	i.Lock()
+	defer i.Unlock()
+	delete(i.elections, string(id))
+	i.remove(id)
+}
+
+// InvalidateAll removes all the elections from the index.
+func (i *Index) InvalidateAll() {
+	i.Lock()
+	defer i.Unlock()
+	i.elections = make(map[string]*indexEntry)
+	i.masters = make(map[string]*masterEntry)
+	i.remove(nil)
+}
+
+// Links works like Master.Links, but only reads the blocks of the master
+// skipchain that were appended since the last call.
+func (i *Index) Links(s *skipchain.Service, master skipchain.SkipBlockID) ([]*Link, error) {
+	i.Lock()
+	defer i.Unlock()
+	m, ok := i.masters[string(master)]
+	if !ok {
+		m = &masterEntry{chain: skipchain.NewChain(s.GetDB(), master), links: []*Link{}}
+	}
+	for block := m.chain.Next(); block != nil; block = m.chain.Next() {
+		m.links, m.unlinked = addLink(m.links, m.unlinked, block)
+	}
+	if err := m.chain.Err(); err != nil {
+		delete(i.masters, string(master))
+		return nil, err
+	}
+	i.masters[string(master)] = m
+	return append([]*Link{}, m.links...), nil
+}
+
+// Count returns the number of elections in the index that are in the given
+// stage.
+func (i *Index) Count(stage ElectionState) int {
+	i.Lock()
+	defer i.Unlock()
+	n := 0
+	for _, entry := range i.elections {
+		if entry.stage == stage {
+			n++
+		}
+	}
+	return n
+}
+
+// Append is called by the skipchain service with every new block, and
+// reads the new blocks of the election of the block if it is in the index.
+func (i *Index) Append(block *skipchain.SkipBlock) {
+	i.Lock()
+	defer i.Unlock()
+	id := block.SkipChainID()
+	if entry, ok := i.elections[string(id)]; ok {
+		if err := entry.follow(); err != nil {
+			delete(i.elections, string(id))
+			i.remove(id)
+			return
+		}
+		i.store(entry)
+	}
+}
+
+// update returns the entry of the election, which is read from the
+// skipchain if it is not in the index yet. It has to be called with the lock
+// held.
+func (i *Index) update(s *skipchain.Service, id skipchain.SkipBlockID) (*indexEntry, error) {
+	if entry, ok := i.elections[string(id)]; ok {
+		return entry, nil
+	}
+	election, err := loadElection(s, id)
+	if err != nil {
+		return nil, err
+	}
+	entry := &indexEntry{election: election, voted: make(map[string]skipchain.SkipBlockID),
+		chain: skipchain.NewChain(s.GetDB(), id), salt: i.salt, last: -1}
+	if err := i.restore(entry); err != nil {
+		log.Error("Couldn't restore index of election", id.Short(), err)
+		i.remove(id)
+		entry.chain = skipchain.NewChain(s.GetDB(), id)
+	}
+	if err := entry.follow(); err != nil {
+		return nil, err
+	}
+	i.store(entry)
+	i.elections[string(id)] = entry
+	return entry, nil
+}
+
+// restore reads the entry of the election from the database, if it is
+// stored, and moves its chain after the last block read. The entry is only
+// changed if it succeeds, except for its chain. It has to be called with
+// the lock held.
+func (i *Index) restore(e *indexEntry) error {
+	if i.db == nil {
+		return nil
+	}
+	var state *indexState
+	voted := make(map[string]skipchain.SkipBlockID)
+	err := i.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(i.bucket).Bucket(e.election.ID)
+		if b == nil {
+			return nil
+		}
+		_, msg, err := network.Unmarshal(b.Get(stateKey), cothority.Suite)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if state, ok = msg.(*indexState); !ok {
+			return errors.New("stored state is not an indexState")
+		}
+		return b.Bucket(votedKey).ForEach(func(user, block []byte) error {
+			voted[string(user)] = append(skipchain.SkipBlockID{}, block...)
+			return nil
+		})
+	})
+	if err != nil || state == nil {
+		return err
+	}
+	if err := e.chain.Seek(state.Last); err != nil {
+		return err
+	}
+	// Seek returns the last block read with the next call to Next.
+	if e.chain.Next() == nil {
+		return e.chain.Err()
+	}
+	e.voted, e.last, e.stage = voted, state.Last, state.Stage
+	e.closed, e.redacted = state.Closed, state.Redacted
+	if state.Roster != nil {
+		e.election.Roster = state.Roster
+	}
+	return nil
+}
+
+// store writes the changes of the entry to the database. It has to be
+// called with the lock held.
+func (i *Index) store(e *indexEntry) {
+	if i.db == nil {
+		return
+	}
+	buf, err := network.Marshal(&indexState{Last: e.last, Stage: e.stage, Closed: e.closed,
+		Redacted: e.redacted, Roster: e.election.Roster})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	err = i.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(i.bucket).CreateBucketIfNotExists(e.election.ID)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(stateKey, buf); err != nil {
+			return err
+		}
+		changed := e.changed
+		if e.rewrite {
+			if b.Bucket(votedKey) != nil {
+				if err := b.DeleteBucket(votedKey); err != nil {
+					return err
+				}
+			}
+			changed = nil
+			for user := range e.voted {
+				changed = append(changed, user)
+			}
+		}
+		voted, err := b.CreateBucketIfNotExists(votedKey)
+		if err != nil {
+			return err
+		}
+		for _, user := range changed {
+			if err := voted.Put([]byte(user), e.voted[user]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Couldn't store index of election", e.election.ID.Short(), err)
+		return
+	}
+	e.changed, e.rewrite = nil, false
+}
+
+// remove deletes the election from the database, or all the elections if
+// id is nil. It has to be called with the lock held.
+func (i *Index) remove(id skipchain.SkipBlockID) {
+	if i.db == nil {
+		return
+	}
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(i.bucket)
+		if id != nil {
+			if b.Bucket(id) == nil {
+				return nil
+			}
+			return b.DeleteBucket(id)
+		}
+		var ids [][]byte
+		b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				ids = append(ids, k)
+			}
+			return nil
+		})
+		for _, id := range ids {
+			if err := b.DeleteBucket(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// follow adds the blocks of the election that were appended since the last
+// call.
+func (e *indexEntry) follow() error {
+	for block := e.chain.Next(); block != nil; block = e.chain.Next() {
+		e.last = block.Index
+		e.add(block)
+	}
+	return e.chain.Err()
+}
+
+// add updates the entry with the transaction of the block. The stage is
+// given by the last transaction like in setStage, and ballots are only
+// counted until the election is shuffled like in setVoted.
+func (e *indexEntry) add(block *skipchain.SkipBlock) {
+	transaction := UnmarshalTransaction(block.Data)
+	if transaction != nil && transaction.Reshare != nil {
+		e.election.Roster = block.Roster
+	}
+	if transaction != nil && transaction.Redaction != nil {
+		e.redact()
+	}
+	if transaction == nil || transaction.Audit != nil || transaction.Reshare != nil ||
+		transaction.Redaction != nil {
+		return
+	}
+	switch {
+	case transaction.Partial != nil:
+		e.stage = Decrypted
+		e.closed = true
+	case transaction.Mix != nil:
+		e.stage = Shuffled
+		e.closed = true
+	default:
+		e.stage = Running
+	}
+	if transaction.Ballot != nil && !e.closed {
+		user := string(e.key(transaction.GetUser()))
+		e.voted[user] = block.Hash
+		e.changed = append(e.changed, user)
+	}
+}
+
+// key returns the user, or its salted hash if the election is redacted.
+func (e *indexEntry) key(user UserID) UserID {
+	if e.redacted {
+		return redactUser(e.salt, e.election.ID, user)
+	}
+	return user
+}
+
+// redact replaces the users of the ballots by their salted hashes.
+func (e *indexEntry) redact() {
+	if e.redacted {
+		return
+	}
+	voted := make(map[string]skipchain.SkipBlockID, len(e.voted))
+	for user, id := range e.voted {
+		voted[string(redactUser(e.salt, e.election.ID, UserID(user)))] = id
+	}
+	e.voted = voted
+	e.redacted = true
+	e.rewrite = true
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+// LocalizedElection is the metadata of an election in a single language,
+// for front-ends that don't want to pick the language of every field.
+type LocalizedElection struct {
+	ID       skipchain.SkipBlockID
+	Name     string
+	Subtitle string
+	MoreInfo string
+	Theme    string
+	Footer   footer
+	Start    int64
+	End      int64
+	Stage    ElectionState
+
+	Questions []string // Questions holds the titles of the questions.
+
+	// Candidates holds the metadata of the candidates with their statement
+	// in the language.
+	Candidates []*LocalizedCandidate
+}
+
+// LocalizedCandidate is the metadata of a candidate in a single language.
+type LocalizedCandidate struct {
+	ID        uint32
+	Name      string
+	Photo     string
+	Statement string
+	List      string
+}
+
+// CheckLanguages returns an error if the name of the election misses one of
+// its languages, or if another localized field is given but misses one.
+func (e *Election) CheckLanguages() error {
+	for _, lang := range e.Languages {
+		if e.Name[lang] == "" {
+			return errors.New("missing name in " + lang)
+		}
+		fields := map[string]map[string]string{
+			"subtitle":      e.Subtitle,
+			"more info":     e.MoreInfoLang,
+			"footer":        e.Footer.TextLang,
+			"contact title": e.Footer.ContactTitleLang,
+		}
+		for name, values := range fields {
+			if len(values) > 0 && values[lang] == "" {
+				return errors.New("missing " + name + " in " + lang)
+			}
+		}
+		for _, q := range e.Questions {
+			if q != nil && len(q.Title) > 0 && q.Title[lang] == "" {
+				return errors.New("missing question title in " + lang)
+			}
+		}
+		for _, c := range e.CandidateInfo {
+			if c != nil && len(c.Statement) > 0 && c.Statement[lang] == "" {
+				return errors.New("missing candidate statement in " + lang)
+			}
+		}
+	}
+	return nil
+}
+
+// Localize returns the metadata of the election in the given language. Fields
+// missing in that language are taken from the first language of the election,
+// or from the plain field if there is one.
+func (e *Election) Localize(lang string) *LocalizedElection {
+	get := func(values map[string]string, plain string) string {
+		if v, ok := values[lang]; ok {
+			return v
+		}
+		if len(e.Languages) > 0 {
+			if v, ok := values[e.Languages[0]]; ok {
+				return v
+			}
+		}
+		return plain
+	}
+	l := &LocalizedElection{
+		ID:       e.ID,
+		Name:     get(e.Name, ""),
+		Subtitle: get(e.Subtitle, ""),
+		MoreInfo: get(e.MoreInfoLang, e.MoreInfo),
+		Theme:    e.Theme,
+		Footer: footer{
+			Text:         get(e.Footer.TextLang, e.Footer.Text),
+			ContactTitle: get(e.Footer.ContactTitleLang, e.Footer.ContactTitle),
+			ContactPhone: e.Footer.ContactPhone,
+			ContactEmail: e.Footer.ContactEmail,
+		},
+		Start: e.Start,
+		End:   e.End,
+		Stage: e.Stage,
+	}
+	for _, q := range e.Questions {
+		l.Questions = append(l.Questions, get(q.Title, ""))
+	}
+	for _, c := range e.CandidateInfo {
+		l.Candidates = append(l.Candidates, &LocalizedCandidate{
+			ID:        c.ID,
+			Name:      c.Name,
+			Photo:     c.Photo,
+			Statement: get(c.Statement, ""),
+			List:      c.List,
+		})
+	}
+	return l
+}
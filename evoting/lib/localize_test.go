@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLanguages(t *testing.T) {
+	e := &Election{
+		Name:      map[string]string{"en": "name", "fr": "nom"},
+		Subtitle:  map[string]string{"en": "subtitle"},
+		Languages: []string{"en"},
+	}
+	assert.Nil(t, e.CheckLanguages())
+
+	e.Languages = []string{"en", "fr"}
+	assert.NotNil(t, e.CheckLanguages())
+	e.Subtitle["fr"] = "sous-titre"
+	assert.Nil(t, e.CheckLanguages())
+
+	e.Footer.TextLang = map[string]string{"fr": "pied"}
+	assert.NotNil(t, e.CheckLanguages())
+	e.Footer.TextLang["en"] = "footer"
+	assert.Nil(t, e.CheckLanguages())
+
+	e.Questions = []*Question{{Title: map[string]string{"en": "question"}}}
+	assert.NotNil(t, e.CheckLanguages())
+	e.Questions = nil
+
+	e.CandidateInfo = []*Candidate{{ID: 1, Statement: map[string]string{"en": "statement"}}}
+	assert.NotNil(t, e.CheckLanguages())
+}
+
+func TestLocalize(t *testing.T) {
+	e := &Election{
+		Name:         map[string]string{"en": "name", "fr": "nom"},
+		MoreInfo:     "https://example.com",
+		MoreInfoLang: map[string]string{"fr": "https://example.com/fr"},
+		Footer:       footer{Text: "footer", ContactPhone: "123"},
+		Questions:    []*Question{{Title: map[string]string{"en": "question"}}},
+		Languages:    []string{"en", "fr"},
+		CandidateInfo: []*Candidate{{ID: 1, Name: "Alice", List: "A",
+			Statement: map[string]string{"en": "statement", "fr": "déclaration"}}},
+	}
+	l := e.Localize("fr")
+	assert.Equal(t, "nom", l.Name)
+	assert.Equal(t, "https://example.com/fr", l.MoreInfo)
+	assert.Equal(t, "footer", l.Footer.Text)
+	assert.Equal(t, "123", l.Footer.ContactPhone)
+	assert.Equal(t, []string{"question"}, l.Questions)
+	assert.Equal(t, &LocalizedCandidate{ID: 1, Name: "Alice", Statement: "déclaration", List: "A"},
+		l.Candidates[0])
+
+	l = e.Localize("de")
+	assert.Equal(t, "name", l.Name)
+	assert.Equal(t, "https://example.com", l.MoreInfo)
+}
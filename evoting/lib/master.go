@@ -1,17 +1,22 @@
 package lib
 
 import (
+	"crypto/sha256"
 	"errors"
 
 	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+
+	"github.com/dedis/cothority"
 
 	"github.com/dedis/cothority/skipchain"
 )
 
 func init() {
-	network.RegisterMessages(Master{}, Link{})
+	network.RegisterMessages(Master{}, Link{}, Rotation{})
 }
 
 // Master is the foundation object of the entire service.
@@ -24,12 +29,85 @@ type Master struct {
 	Admins []uint32 // Admins is the list of administrators.
 
 	Key kyber.Point // Key is the front-end public key.
+
+	// AdminKeys are the keys of the administrators, which can rotate the
+	// master without the front-end key, see Rotation.
+	AdminKeys []kyber.Point
+
+	// AdminIDs are administrators given by opaque identifiers, in addition
+	// to the scipers of Admins.
+	AdminIDs []UserID
 }
 
 // Link is a wrapper around the genesis Skipblock identifier of an
 // election. Every newly created election adds a new link to the master Skipchain.
 type Link struct {
 	ID skipchain.SkipBlockID
+	// Unlink removes the election of an earlier link from the master. Only
+	// test elections can be unlinked.
+	Unlink bool
+}
+
+// Rotation replaces the master with a new one, signed by a majority of the
+// admin keys of the current master. It allows to change the front-end key
+// and the admins even if the front-end private key is lost.
+type Rotation struct {
+	Master *Master // Master is the new master.
+	// Signatures holds the schnorr signatures on Hash, in the order of the
+	// admin keys of the current master, nil for missing signatures.
+	Signatures [][]byte
+}
+
+// Hash returns the hash signed by the admins.
+func (r *Rotation) Hash() ([]byte, error) {
+	buf, err := protobuf.Encode(r.Master)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(buf)
+	return h[:], nil
+}
+
+// Sign adds the signature of the i-th admin key to the rotation.
+func (r *Rotation) Sign(i int, private kyber.Scalar) error {
+	hash, err := r.Hash()
+	if err != nil {
+		return err
+	}
+	for len(r.Signatures) <= i {
+		r.Signatures = append(r.Signatures, nil)
+	}
+	r.Signatures[i], err = schnorr.Sign(cothority.Suite, private, hash)
+	return err
+}
+
+// VerifyRotation checks that the rotation is signed by more than half of
+// the admin keys of the master.
+func (m *Master) VerifyRotation(r *Rotation) error {
+	if len(m.AdminKeys) == 0 {
+		return errors.New("rotation error: master has no admin keys")
+	}
+	if len(r.Signatures) > len(m.AdminKeys) {
+		return errors.New("rotation error: too many signatures")
+	}
+	hash, err := r.Hash()
+	if err != nil {
+		return err
+	}
+	signed := 0
+	for i, sig := range r.Signatures {
+		if sig == nil {
+			continue
+		}
+		if err := schnorr.Verify(cothority.Suite, m.AdminKeys[i], hash, sig); err != nil {
+			return errors.New("rotation error: invalid signature")
+		}
+		signed++
+	}
+	if signed <= len(m.AdminKeys)/2 {
+		return errors.New("rotation error: not enough signatures")
+	}
+	return nil
 }
 
 // GetMaster retrieves the master object from its skipchain.
@@ -54,41 +132,89 @@ func GetMaster(s *skipchain.Service, id skipchain.SkipBlockID) (*Master, error)
 		if transaction.Master != nil {
 			return transaction.Master, nil
 		}
+		if transaction.Rotation != nil {
+			return transaction.Rotation.Master, nil
+		}
 		block = s.GetDB().GetByID(block.BackLinkIDs[0])
 	}
 	return nil, errors.New("could not find master")
 }
 
-// Links returns all the links appended to the master skipchain.
+// Links returns all the links appended to the master skipchain, without
+// the unlinked elections.
 func (m *Master) Links(s *skipchain.Service) ([]*Link, error) {
-	block, err := s.GetSingleBlockByIndex(
-		&skipchain.GetSingleBlockByIndex{Genesis: m.ID, Index: 0},
-	)
-	if err != nil {
-		return nil, err
-	}
+	links, _, err := m.links(s)
+	return links, err
+}
 
+// Unlinked returns the links of the elections that were unlinked from the
+// master skipchain.
+func (m *Master) Unlinked(s *skipchain.Service) ([]*Link, error) {
+	_, unlinked, err := m.links(s)
+	return unlinked, err
+}
+
+func (m *Master) links(s *skipchain.Service) ([]*Link, []*Link, error) {
 	links := make([]*Link, 0)
-	for {
-		transaction := UnmarshalTransaction(block.Data)
-		if transaction != nil && transaction.Link != nil {
-			links = append(links, transaction.Link)
-		}
+	unlinked := make([]*Link, 0)
+	chain := skipchain.NewChain(s.GetDB(), m.ID)
+	for block := chain.Next(); block != nil; block = chain.Next() {
+		links, unlinked = addLink(links, unlinked, block)
+	}
+	if err := chain.Err(); err != nil {
+		return nil, nil, err
+	}
+	return links, unlinked, nil
+}
 
-		if len(block.ForwardLink) <= 0 {
+// addLink applies the link of the block, if any, to the links and unlinked
+// elections of a master skipchain.
+func addLink(links, unlinked []*Link, block *skipchain.SkipBlock) ([]*Link, []*Link) {
+	transaction := UnmarshalTransaction(block.Data)
+	if transaction == nil || transaction.Link == nil {
+		return links, unlinked
+	}
+	if !transaction.Link.Unlink {
+		return append(links, transaction.Link), unlinked
+	}
+	for i, l := range links {
+		if l.ID.Equal(transaction.Link.ID) {
+			links = append(links[:i], links[i+1:]...)
+			unlinked = append(unlinked, l)
 			break
 		}
-		block, _ = s.GetSingleBlock(
-			&skipchain.GetSingleBlock{ID: block.ForwardLink[0].To},
-		)
 	}
-	return links, nil
+	return links, unlinked
+}
+
+// check applies some sanity checks to a master replacing the current one.
+func (m *Master) check() error {
+	if len(m.Admins) == 0 {
+		return errors.New("empty admin list in master update")
+	}
+	if m.Roster == nil || len(m.Roster.List) == 0 {
+		return errors.New("empty roster in master update")
+	}
+	if m.Key == nil || m.Key.Equal(m.Key.Clone().Null()) {
+		return errors.New("null key in master update")
+	}
+	return nil
 }
 
 // IsAdmin checks if a given user is part of the administrator list.
 func (m *Master) IsAdmin(user uint32) bool {
+	return m.IsAdminID(SciperID(user))
+}
+
+// IsAdminID checks if a given user is part of the administrator list.
+func (m *Master) IsAdminID(user UserID) bool {
 	for _, admin := range m.Admins {
-		if admin == user {
+		if SciperID(admin).Equal(user) {
+			return true
+		}
+	}
+	for _, admin := range m.AdminIDs {
+		if admin.Equal(user) {
 			return true
 		}
 	}
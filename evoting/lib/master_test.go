@@ -3,7 +3,12 @@ package lib
 import (
 	"testing"
 
+	"github.com/dedis/kyber/util/key"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
 )
 
 func TestIsAdmin(t *testing.T) {
@@ -11,3 +16,31 @@ func TestIsAdmin(t *testing.T) {
 	assert.True(t, m.IsAdmin(0))
 	assert.False(t, m.IsAdmin(1))
 }
+
+func TestVerifyRotation(t *testing.T) {
+	keys := make([]*key.Pair, 3)
+	m := &Master{}
+	for i := range keys {
+		keys[i] = key.NewKeyPair(cothority.Suite)
+		m.AdminKeys = append(m.AdminKeys, keys[i].Public)
+	}
+	r := &Rotation{Master: &Master{Admins: []uint32{1}, Key: keys[0].Public}}
+
+	assert.NotNil(t, m.VerifyRotation(r))
+	require.Nil(t, r.Sign(2, keys[2].Private))
+	assert.NotNil(t, m.VerifyRotation(r))
+	require.Nil(t, r.Sign(0, keys[0].Private))
+	assert.Nil(t, m.VerifyRotation(r))
+
+	// The signatures are bound to the new master.
+	r.Master.Admins = []uint32{2}
+	assert.NotNil(t, m.VerifyRotation(r))
+
+	// A signature with the wrong key is refused.
+	r.Signatures = nil
+	require.Nil(t, r.Sign(0, keys[0].Private))
+	require.Nil(t, r.Sign(1, keys[2].Private))
+	assert.NotNil(t, m.VerifyRotation(r))
+
+	assert.NotNil(t, (&Master{}).VerifyRotation(r))
+}
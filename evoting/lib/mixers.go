@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/onet/network"
+)
+
+// By default every node of the roster shuffles the ballots one after the
+// other, so the shuffle takes longer the larger the roster. An election can
+// instead give the Mixers, a subset of the roster that shuffles in the given
+// order. The ballots stay anonymous as long as one of the mixers is honest,
+// so the creator trades some of that assurance for a faster shuffle. The
+// leader can only be the first mixer, as it starts the shuffle.
+
+// MixNodes returns the nodes that shuffle the ballots, in the order of the
+// mixes: the Mixers if the election gives them, or the roster otherwise.
+func (e *Election) MixNodes() ([]*network.ServerIdentity, error) {
+	if len(e.Mixers) == 0 {
+		return e.Roster.List, nil
+	}
+	nodes := make([]*network.ServerIdentity, len(e.Mixers))
+	for i, mixer := range e.Mixers {
+		for _, si := range e.Roster.List {
+			if si.Public.Equal(mixer) {
+				nodes[i] = si
+				break
+			}
+		}
+		if nodes[i] == nil {
+			return nil, fmt.Errorf("mixer %d is not in the roster", i)
+		}
+	}
+	return nodes, nil
+}
+
+// IsMixer returns true if the node shuffles the ballots of the election.
+func (e *Election) IsMixer(si *network.ServerIdentity) bool {
+	if len(e.Mixers) == 0 {
+		_, found := e.Roster.Search(si.ID)
+		return found != nil
+	}
+	for _, mixer := range e.Mixers {
+		if mixer.Equal(si.Public) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMixers returns an error if the mixers are not distinct nodes of the
+// roster, or if the leader is a mixer but not the first one.
+func (e *Election) checkMixers() error {
+	if e.Homomorphic {
+		return errors.New("homomorphic elections are not shuffled")
+	}
+	nodes, err := e.MixNodes()
+	if err != nil {
+		return err
+	}
+	for i, si := range nodes {
+		for _, other := range nodes[:i] {
+			if si.Equal(other) {
+				return fmt.Errorf("mixer %d is given twice", i)
+			}
+		}
+		if i > 0 && si.Equal(e.Roster.List[0]) {
+			return errors.New("the leader can only be the first mixer")
+		}
+	}
+	return nil
+}
+
+// nextMixer returns an error if the mix is not the one of the next mixer,
+// once the given mixes are stored.
+func (e *Election) nextMixer(mixes []*Mix, mix *Mix) error {
+	if len(e.Mixers) == 0 || e.Homomorphic {
+		return nil
+	}
+	nodes, err := e.MixNodes()
+	if err != nil {
+		return err
+	}
+	if len(mixes) >= len(nodes) || mix.Node != nodes[len(mixes)].String() {
+		return errors.New("node is not the next mixer")
+	}
+	return nil
+}
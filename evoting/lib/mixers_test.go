@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+)
+
+func TestMixers(t *testing.T) {
+	list := make([]*network.ServerIdentity, 4)
+	for i := range list {
+		kp := key.NewKeyPair(cothority.Suite)
+		list[i] = network.NewServerIdentity(kp.Public,
+			network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 2000+i)))
+	}
+	roster := onet.NewRoster(list)
+	e := &Election{Roster: roster, Threshold: 2}
+	assert.Equal(t, 4, e.NumMixes())
+	assert.True(t, e.IsMixer(roster.List[2]))
+	require.Nil(t, e.nextMixer(nil, &Mix{Node: roster.List[3].String()}))
+
+	e.Mixers = []kyber.Point{roster.List[2].Public, roster.List[0].Public}
+	assert.NotNil(t, e.checkMixers(), "the leader is the second mixer")
+	e.Mixers = []kyber.Point{roster.List[2].Public, roster.List[2].Public}
+	assert.NotNil(t, e.checkMixers(), "node 2 is given twice")
+	e.Mixers = []kyber.Point{roster.List[0].Public, roster.List[3].Public, roster.List[1].Public}
+	require.Nil(t, e.checkMixers())
+	assert.Equal(t, 3, e.NumMixes())
+	assert.False(t, e.IsMixer(roster.List[2]))
+	assert.True(t, e.IsMixer(roster.List[3]))
+	nodes, err := e.MixNodes()
+	require.Nil(t, err)
+	assert.Equal(t, []*network.ServerIdentity{roster.List[0], roster.List[3], roster.List[1]}, nodes)
+
+	mixes := []*Mix{{Node: roster.List[0].String()}}
+	assert.Nil(t, e.nextMixer(mixes, &Mix{Node: roster.List[3].String()}))
+	assert.NotNil(t, e.nextMixer(mixes, &Mix{Node: roster.List[1].String()}))
+	assert.NotNil(t, e.nextMixer(mixes, &Mix{Node: roster.List[2].String()}))
+
+	e.Roster = onet.NewRoster(roster.List[:3])
+	_, err = e.MixNodes()
+	assert.NotNil(t, err, "node 3 left the roster")
+	assert.NotNil(t, e.checkReshare(e.Roster))
+
+	e.Homomorphic = true
+	assert.NotNil(t, e.checkMixers())
+	assert.Equal(t, 1, e.NumMixes())
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// Receipt is returned to a voter when a ballot is cast. It is signed by the
+// leader, so that a voter can prove that the ballot was accepted, and holds
+// everything needed to find the ballot in the election skipchain.
+type Receipt struct {
+	Election skipchain.SkipBlockID // Election is the ID of the election skipchain.
+	Block    skipchain.SkipBlockID // Block is the hash of the block holding the ballot.
+	Ballot   []byte                // Ballot is the hash of the ballot.
+
+	Public    kyber.Point // Public is the key of the conode signing the receipt.
+	Signature []byte      // Signature is a schnorr signature on Hash.
+}
+
+// NewReceipt returns a receipt for the ballot stored in block, signed with
+// the given key pair.
+func NewReceipt(election, block skipchain.SkipBlockID, ballot *Ballot,
+	public kyber.Point, private kyber.Scalar) (*Receipt, error) {
+	r := &Receipt{Election: election, Block: block, Ballot: ballot.Hash(), Public: public}
+	var err error
+	r.Signature, err = schnorr.Sign(cothority.Suite, private, r.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Hash returns the signed hash of the receipt.
+func (r *Receipt) Hash() []byte {
+	h := sha256.New()
+	h.Write(r.Election)
+	h.Write(r.Block)
+	h.Write(r.Ballot)
+	return h.Sum(nil)
+}
+
+// Verify checks the signature of the receipt and that the block it refers
+// to holds the ballot. The block is fetched from the roster, and its hash is
+// recomputed, so the check doesn't rely on the conodes.
+func (r *Receipt) Verify(roster *onet.Roster) error {
+	if r.Public == nil {
+		return errors.New("receipt without public key")
+	}
+	if err := schnorr.Verify(cothority.Suite, r.Public, r.Hash(), r.Signature); err != nil {
+		return err
+	}
+
+	block, err := skipchain.NewClient().GetSingleBlock(roster, r.Block)
+	if err != nil {
+		return err
+	}
+	if !block.CalculateHash().Equal(r.Block) {
+		return errors.New("wrong hash of the block")
+	}
+	if !block.SkipChainID().Equal(r.Election) {
+		return errors.New("block is not part of the election")
+	}
+	transaction := UnmarshalTransaction(block.Data)
+	if transaction == nil || transaction.Ballot == nil {
+		return errors.New("block holds no ballot")
+	}
+	if !bytes.Equal(transaction.Ballot.Hash(), r.Ballot) {
+		return errors.New("block holds a different ballot")
+	}
+	return nil
+}
+
+// Counted returns true if the ballot of the receipt is the last one cast by
+// the user, given an election retrieved with its Voted field set.
+func (r *Receipt) Counted(election *Election) bool {
+	return r.Block.Equal(election.Voted)
+}
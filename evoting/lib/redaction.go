@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/dedis/onet/network"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+func init() {
+	network.RegisterMessage(Redaction{})
+}
+
+/*
+Once the Retention of a decrypted election passed, its admins can redact the
+voter data: the conodes replace the users in their indexes of the ballots by
+salted hashes, and only return ballots with the hashed users. The salt is
+random and never leaves the conode, so the hashes cannot be reversed by
+trying all the users, but the ballots of the same user still share their
+hash. The ciphertexts, mixes and partials are kept, so the tally can still
+be verified.
+
+The blocks of the election skipchain cannot be changed, so the ballots
+stored in them keep their users, and everybody with access to the blocks,
+e.g. through the skipchain service or a bulletin board, can read them.
+*/
+
+// Redaction records on the election skipchain that the conodes redacted the
+// voter data of the election. Like every transaction, it is verified by all
+// the conodes of the roster, which sign the block holding it.
+type Redaction struct {
+	Time   int64 // Time is the unix timestamp of the redaction.
+	Voters int   // Voters is the number of users whose ballots were redacted.
+}
+
+// NewRedaction returns the redaction of the voter data of the election now.
+func (e *Election) NewRedaction(s *skipchain.Service) (*Redaction, error) {
+	voters, err := e.voters(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Redaction{Time: time.Now().Unix(), Voters: voters}, nil
+}
+
+// checkRedaction makes sure the voter data of the election can be redacted
+// now, and that the redaction counts the right number of voters.
+func (e *Election) checkRedaction(s *skipchain.Service, r *Redaction) error {
+	now := time.Now().Unix()
+	if e.Stage != Decrypted {
+		return errors.New("redact error: election not decrypted yet")
+	} else if e.Redacted {
+		return errors.New("redact error: election already redacted")
+	} else if now < e.End+e.Retention {
+		return errors.New("redact error: retention period not over")
+	}
+	drift := now - r.Time
+	if drift > int64(auditDrift.Seconds()) || -drift > int64(auditDrift.Seconds()) {
+		return errors.New("redact error: invalid time")
+	}
+	voters, err := e.voters(s)
+	if err != nil {
+		return err
+	}
+	if r.Voters != voters {
+		return errors.New("redact error: wrong number of voters")
+	}
+	return nil
+}
+
+// voters returns the number of users who cast a ballot before the shuffle.
+func (e *Election) voters(s *skipchain.Service) (int, error) {
+	users := make(map[string]bool)
+	chain := skipchain.NewChain(s.GetDB(), e.ID)
+	for block := chain.Next(); block != nil; block = chain.Next() {
+		transaction := UnmarshalTransaction(block.Data)
+		if transaction == nil {
+			continue
+		}
+		if transaction.Mix != nil || transaction.Partial != nil {
+			break
+		}
+		if transaction.Ballot != nil {
+			users[string(transaction.Ballot.GetUser())] = true
+		}
+	}
+	return len(users), chain.Err()
+}
+
+// redactUser returns the salted hash of the user in the election.
+func redactUser(salt []byte, election skipchain.SkipBlockID, user UserID) UserID {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(election)
+	h.Write(user)
+	return UserID(h.Sum(nil))
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+func TestIndexRedact(t *testing.T) {
+	id := skipchain.SkipBlockID("election")
+	voter := UserID("voter@example.com")
+	block := skipchain.SkipBlockID("ballot")
+
+	i := NewIndex()
+	e := &indexEntry{election: &Election{ID: id}, salt: i.salt,
+		voted: map[string]skipchain.SkipBlockID{string(voter): block}}
+	assert.Equal(t, voter, e.key(voter))
+
+	e.redact()
+	assert.True(t, e.redacted)
+	assert.Nil(t, e.voted[string(voter)])
+	assert.Equal(t, block, e.voted[string(e.key(voter))])
+	assert.Equal(t, i.Redact(id, voter), e.key(voter))
+	assert.NotEqual(t, i.Redact(id, voter), i.Redact(id, UserID("other@example.com")))
+	assert.NotEqual(t, i.Redact(id, voter), i.Redact(skipchain.SkipBlockID("other"), voter))
+	// Every index has its own salt.
+	assert.NotEqual(t, i.Redact(id, voter), NewIndex().Redact(id, voter))
+}
@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+
+	"github.com/dedis/cothority"
+)
+
+/*
+Resharing hands the shares of the election key over to a new roster, e.g. to
+replace a node that died during the election, without changing the key the
+ballots are encrypted to.
+
+Every dealer, a node holding one of Threshold shares s_i of the old roster,
+picks a random polynomial g_i of degree Threshold-1 with g_i(0) = l_i * s_i,
+where l_i is its Lagrange coefficient among the dealers. The new share of
+node j is the sum of g_i(j) over all dealers, and the sum of the constant
+terms is the secret of the election key. The commitments to the g_i let the
+new nodes verify their shares and compute the public commitments of the new
+sharing, whose constant term has to be the election key.
+*/
+
+// Reshare records on the election skipchain that the shares of the election
+// key have been handed over to Roster, which also handles the block holding
+// the transaction and all the following ones.
+type Reshare struct {
+	Roster *onet.Roster
+}
+
+// ReshareDeal is the contribution of a dealer to the new share of one node.
+type ReshareDeal struct {
+	Dealer  int           // Dealer is the index of the old share of the dealer.
+	Commits []kyber.Point // Commits are the commitments to the polynomial.
+	Share   kyber.Scalar  // Share is the evaluation for the receiving node.
+}
+
+// checkReshare makes sure the shares of the election can be handed over to
+// roster: enough nodes of the current roster have to stay to deal the new
+// shares, and the threshold has to be valid for the new roster.
+func (e *Election) checkReshare(roster *onet.Roster) error {
+	if e.Threshold == 0 {
+		return errors.New("reshare error: election without threshold")
+	}
+	if roster == nil || len(roster.List) == 0 {
+		return errors.New("reshare error: missing roster")
+	}
+	n := len(roster.List)
+	if e.Threshold < (n+1)/2 || e.Threshold > n {
+		return errors.New("reshare error: threshold invalid for new roster")
+	}
+	if len(ReshareDealers(e.Roster, roster, e.Threshold)) < e.Threshold {
+		return errors.New("reshare error: not enough nodes of the current roster")
+	}
+	for _, mixer := range e.Mixers {
+		found := false
+		for _, si := range roster.List {
+			found = found || si.Public.Equal(mixer)
+		}
+		if !found {
+			return errors.New("reshare error: a mixer is not in the new roster")
+		}
+	}
+	return nil
+}
+
+// ReshareDealers returns the indexes in the current roster of the first
+// threshold nodes that are also part of the new roster.
+func ReshareDealers(current, roster *onet.Roster, threshold int) []int {
+	dealers := make([]int, 0, threshold)
+	for i, si := range current.List {
+		if len(dealers) == threshold {
+			break
+		}
+		if j, _ := roster.Search(si.ID); j >= 0 {
+			dealers = append(dealers, i)
+		}
+	}
+	return dealers
+}
+
+// ReshareDeals returns the deals of the holder of the secret for the n nodes
+// of the new roster. The secret has to be one of the dealers.
+func (s *SharedSecret) ReshareDeals(dealers []int, threshold, n int) ([]*ReshareDeal, error) {
+	lambda, err := lagrangeBasis(s.Index, dealers)
+	if err != nil {
+		return nil, err
+	}
+	suite := cothority.Suite
+	poly := share.NewPriPoly(suite, threshold,
+		suite.Scalar().Mul(lambda, s.V), suite.RandomStream())
+	_, commits := poly.Commit(nil).Info()
+	deals := make([]*ReshareDeal, n)
+	for j := range deals {
+		deals[j] = &ReshareDeal{
+			Dealer:  s.Index,
+			Commits: commits,
+			Share:   poly.Eval(j).V,
+		}
+	}
+	return deals, nil
+}
+
+// VerifyReshareDeal checks that the deal for the new node with the given
+// index is consistent with the old share of the dealer, given by the public
+// commitments of the current sharing.
+func VerifyReshareDeal(commits []kyber.Point, dealers []int, threshold, index int,
+	deal *ReshareDeal) error {
+	if len(deal.Commits) != threshold {
+		return errors.New("reshare error: wrong number of commitments")
+	}
+	lambda, err := lagrangeBasis(deal.Dealer, dealers)
+	if err != nil {
+		return err
+	}
+	suite := cothority.Suite
+	old := share.NewPubPoly(suite, nil, commits).Eval(deal.Dealer).V
+	if !suite.Point().Mul(lambda, old).Equal(deal.Commits[0]) {
+		return fmt.Errorf("reshare error: deal of %d doesn't match its share", deal.Dealer)
+	}
+	expected := share.NewPubPoly(suite, nil, deal.Commits).Eval(index).V
+	if !suite.Point().Mul(deal.Share, nil).Equal(expected) {
+		return fmt.Errorf("reshare error: invalid share from %d", deal.Dealer)
+	}
+	return nil
+}
+
+// CombineReshare returns the new share of the node with the given index from
+// the verified deals of all dealers. The new sharing has to be of the key X.
+func CombineReshare(X kyber.Point, index int, deals []*ReshareDeal) (*SharedSecret, error) {
+	if len(deals) == 0 {
+		return nil, errors.New("reshare error: no deals")
+	}
+	suite := cothority.Suite
+	secret := &SharedSecret{
+		Index:   index,
+		V:       suite.Scalar().Zero(),
+		X:       X,
+		Commits: make([]kyber.Point, len(deals[0].Commits)),
+	}
+	for k := range secret.Commits {
+		secret.Commits[k] = suite.Point().Null()
+	}
+	for _, deal := range deals {
+		if len(deal.Commits) != len(secret.Commits) {
+			return nil, errors.New("reshare error: wrong number of commitments")
+		}
+		secret.V.Add(secret.V, deal.Share)
+		for k, c := range deal.Commits {
+			secret.Commits[k].Add(secret.Commits[k], c)
+		}
+	}
+	if !secret.Commits[0].Equal(X) {
+		return nil, errors.New("reshare error: new shares are not of the election key")
+	}
+	return secret, nil
+}
+
+// lagrangeBasis returns the Lagrange coefficient of the share i to
+// interpolate the secret from the shares of indexes.
+func lagrangeBasis(i int, indexes []int) (kyber.Scalar, error) {
+	suite := cothority.Suite
+	xi := suite.Scalar().SetInt64(int64(i + 1))
+	num, den := suite.Scalar().One(), suite.Scalar().One()
+	found := false
+	for _, j := range indexes {
+		if j == i {
+			if found {
+				return nil, errors.New("reshare error: dealer given twice")
+			}
+			found = true
+			continue
+		}
+		xj := suite.Scalar().SetInt64(int64(j + 1))
+		num.Mul(num, xj)
+		den.Mul(den, suite.Scalar().Sub(xj, xi))
+	}
+	if !found {
+		return nil, fmt.Errorf("reshare error: %d is not a dealer", i)
+	}
+	return num.Div(num, den), nil
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+)
+
+func TestReshare(t *testing.T) {
+	dkgs, err := DKGSimulate(5, 3)
+	require.Nil(t, err)
+	secrets := make([]*SharedSecret, len(dkgs))
+	for i, dkg := range dkgs {
+		secrets[i], err = NewSharedSecret(dkg)
+		require.Nil(t, err)
+	}
+	X := secrets[0].X
+	K, C := Encrypt(X, []byte("ballot"))
+
+	// Nodes 1 and 3 died, node 0, 2 and 4 deal the shares to themselves and a
+	// replacement.
+	dealers := []int{0, 2, 4}
+	n, threshold := 4, 3
+	deals := make([][]*ReshareDeal, n)
+	for _, i := range dealers {
+		d, err := secrets[i].ReshareDeals(dealers, threshold, n)
+		require.Nil(t, err)
+		for j := range deals {
+			deals[j] = append(deals[j], d[j])
+		}
+	}
+	_, err = secrets[1].ReshareDeals(dealers, threshold, n)
+	require.NotNil(t, err)
+
+	reshared := make([]*SharedSecret, n)
+	for j := range reshared {
+		for _, deal := range deals[j] {
+			require.Nil(t, VerifyReshareDeal(secrets[0].Commits, dealers, threshold, j, deal))
+		}
+		reshared[j], err = CombineReshare(X, j, deals[j])
+		require.Nil(t, err)
+		require.Equal(t, j, reshared[j].Index)
+	}
+
+	// Any threshold of the new shares decrypt the ballot.
+	for _, nodes := range [][]int{{0, 1, 2}, {1, 2, 3}, {0, 3, 1}} {
+		partials := make([]*share.PubShare, n)
+		for _, j := range nodes {
+			partials[j] = &share.PubShare{I: j, V: Decrypt(reshared[j].V, K, C)}
+		}
+		M, err := share.RecoverCommit(cothority.Suite, partials, threshold, n)
+		require.Nil(t, err)
+		data, err := M.Data()
+		require.Nil(t, err)
+		require.Equal(t, []byte("ballot"), data)
+	}
+
+	// A wrong share or a deal of a wrong secret is detected.
+	deal := *deals[0][0]
+	deal.Share = cothority.Suite.Scalar().Add(deal.Share, cothority.Suite.Scalar().One())
+	require.NotNil(t, VerifyReshareDeal(secrets[0].Commits, dealers, threshold, 0, &deal))
+	deal = *deals[0][0]
+	deal.Dealer = 1
+	require.NotNil(t, VerifyReshareDeal(secrets[0].Commits, dealers, threshold, 0, &deal))
+	require.NotNil(t, VerifyReshareDeal(secrets[0].Commits, dealers, threshold, 1, deals[0][0]))
+	_, err = CombineReshare(X, 0, deals[0][1:])
+	require.NotNil(t, err)
+}
+
+func TestReshareDealers(t *testing.T) {
+	list := make([]*network.ServerIdentity, 6)
+	for i := range list {
+		kp := key.NewKeyPair(cothority.Suite)
+		list[i] = network.NewServerIdentity(kp.Public,
+			network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 2000+i)))
+	}
+	current := onet.NewRoster(list[:5])
+	roster := onet.NewRoster([]*network.ServerIdentity{list[0], list[5], list[2], list[4]})
+	require.Equal(t, []int{0, 2, 4}, ReshareDealers(current, roster, 3))
+	require.Equal(t, []int{0, 2}, ReshareDealers(current, roster, 2))
+
+	e := &Election{Roster: current, Threshold: 3}
+	require.Nil(t, e.checkReshare(roster))
+	require.NotNil(t, e.checkReshare(nil))
+	require.NotNil(t, e.checkReshare(onet.NewRoster(list[3:])))
+	e.Threshold = 4
+	require.NotNil(t, e.checkReshare(roster))
+	e.Threshold = 0
+	require.NotNil(t, e.checkReshare(roster))
+}
@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/dedis/kyber"
+)
+
+// Results are the final results of an election together with everything
+// needed to verify them, in a form that can be published.
+type Results struct {
+	Election   string            `json:"election"`
+	Questions  []*QuestionResult `json:"questions"`
+	WriteIns   map[string]int    `json:"writeIns,omitempty"`
+	Transcript *Transcript       `json:"transcript"`
+}
+
+// QuestionResult is the tally of one question of an election.
+type QuestionResult struct {
+	// Votes holds the votes of every candidate in the first counting round.
+	Votes   []*CandidateVotes    `json:"votes"`
+	Winners []uint32             `json:"winners"`
+	Rounds  []map[uint32]float64 `json:"rounds"`
+	// Spoiled is the number of ballots that couldn't be decoded or were
+	// invalid.
+	Spoiled int `json:"spoiled"`
+	// Sections holds the results of every section of the voters, if the
+	// election has sections.
+	Sections []*QuestionResult `json:"sections,omitempty"`
+}
+
+// CandidateVotes holds the votes of one candidate.
+type CandidateVotes struct {
+	Candidate uint32  `json:"candidate"`
+	Votes     float64 `json:"votes"`
+}
+
+// Transcript holds the encrypted ballots, the mixes and the partial
+// decryptions of an election. All points are hex-encoded.
+type Transcript struct {
+	Ballots  [][]string           `json:"ballots"`
+	Mixes    []*MixTranscript     `json:"mixes"`
+	Partials []*PartialTranscript `json:"partials"`
+}
+
+// MixTranscript is a mix with its shuffle proofs, one for every question.
+type MixTranscript struct {
+	Node    string     `json:"node"`
+	Ballots [][]string `json:"ballots"`
+	Proofs  []string   `json:"proofs"`
+}
+
+// PartialTranscript is a partial decryption, with one list of points for
+// every question.
+type PartialTranscript struct {
+	Node   string     `json:"node"`
+	Index  int        `json:"index"`
+	Flag   bool       `json:"flag"`
+	Points [][]string `json:"points"`
+}
+
+// NewResults tallies the reconstructed points of every question, and
+// creates the transcript from the box, the mixes and the partials. answers
+// holds the points of the questions after the first one, followed by the
+// write-ins if the election allows them. For a homomorphic election they
+// hold the sums of the candidates.
+func NewResults(e *Election, box *Box, mixes []*Mix, partials []*Partial,
+	points []kyber.Point, answers []*Points) (*Results, error) {
+	if len(answers) != e.NumCiphertexts()-1 {
+		return nil, errors.New("wrong number of answers")
+	}
+	question := func(q int) []kyber.Point {
+		if q == 0 {
+			return points
+		}
+		return answers[q-1].Points
+	}
+
+	r := &Results{Election: hex.EncodeToString(e.ID)}
+	if e.Homomorphic {
+		// The points are the sums of the single aggregate ballot, one for
+		// every candidate.
+		var sums []kyber.Point
+		for i := 0; i < e.NumCiphertexts(); i++ {
+			if len(question(i)) != 1 {
+				return nil, errors.New("wrong number of sums")
+			}
+			sums = append(sums, question(i)[0])
+		}
+		qr, err := e.homomorphicResult(sums, len(box.Ballots))
+		if err != nil {
+			return nil, err
+		}
+		r.Questions = append(r.Questions, qr)
+	} else {
+		for q := 0; q < e.NumQuestions(); q++ {
+			var ballots [][]uint32
+			sections := make([][][]uint32, len(e.Sections))
+			spoiled := 0
+			for _, p := range question(q) {
+				data, err := p.Data()
+				if err != nil {
+					spoiled++
+					continue
+				}
+				choices, err := DecodeBallot(data)
+				if err != nil {
+					spoiled++
+					continue
+				}
+				if len(e.Sections) > 0 {
+					var section int
+					section, choices, err = e.splitSection(choices)
+					if err != nil {
+						spoiled++
+						continue
+					}
+					sections[section] = append(sections[section], choices)
+				}
+				ballots = append(ballots, choices)
+			}
+			election := e.Question(q)
+			qr, err := election.questionResult(ballots, spoiled)
+			if err != nil {
+				return nil, err
+			}
+			for _, ballots := range sections {
+				sr, err := election.questionResult(ballots, 0)
+				if err != nil {
+					return nil, err
+				}
+				qr.Sections = append(qr.Sections, sr)
+			}
+			r.Questions = append(r.Questions, qr)
+		}
+	}
+
+	if e.WriteIn > 0 {
+		r.WriteIns = make(map[string]int)
+		for _, p := range question(e.NumQuestions()) {
+			text, err := e.DecodeWriteIn(p)
+			if err != nil || text == "" {
+				continue
+			}
+			r.WriteIns[text]++
+		}
+	}
+
+	r.Transcript = &Transcript{}
+	for _, b := range box.Ballots {
+		r.Transcript.Ballots = append(r.Transcript.Ballots, ballotHex(b))
+	}
+	for _, m := range mixes {
+		mt := &MixTranscript{Node: m.Node}
+		for _, b := range m.Ballots {
+			mt.Ballots = append(mt.Ballots, ballotHex(b))
+		}
+		for q := 0; q < e.NumCiphertexts(); q++ {
+			mt.Proofs = append(mt.Proofs, hex.EncodeToString(m.QuestionProof(q)))
+		}
+		r.Transcript.Mixes = append(r.Transcript.Mixes, mt)
+	}
+	for _, p := range partials {
+		pt := &PartialTranscript{Node: p.Node, Index: p.Index, Flag: p.Flag}
+		pt.Points = append(pt.Points, pointsHex(p.Points))
+		for _, a := range p.Answers {
+			pt.Points = append(pt.Points, pointsHex(a.Points))
+		}
+		r.Transcript.Partials = append(r.Transcript.Partials, pt)
+	}
+	return r, nil
+}
+
+// questionResult tallies the decoded ballots of a single question election.
+// spoiled is the number of ballots that couldn't be decoded.
+func (e *Election) questionResult(ballots [][]uint32, spoiled int) (*QuestionResult, error) {
+	tally, err := e.Tally(ballots)
+	if err != nil {
+		return nil, err
+	}
+	qr := &QuestionResult{
+		Winners: tally.Winners,
+		Rounds:  tally.Rounds,
+		Spoiled: tally.Spoiled + spoiled,
+	}
+	for _, c := range e.Candidates {
+		var votes float64
+		if len(tally.Rounds) > 0 {
+			votes = tally.Rounds[0][c]
+		}
+		qr.Votes = append(qr.Votes, &CandidateVotes{Candidate: c, Votes: votes})
+	}
+	return qr, nil
+}
+
+// JSON returns the results with the transcript as JSON.
+func (r *Results) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// CSV returns the votes of every candidate, the spoiled ballots of every
+// question and the write-ins, one per line. The results of the sections
+// follow those of their question, with "<question>/<section>" as question.
+// The transcript is only available as JSON.
+func (r *Results) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"question", "candidate", "votes", "elected"})
+	write := func(question string, qr *QuestionResult) {
+		elected := make(map[uint32]bool)
+		for _, c := range qr.Winners {
+			elected[c] = true
+		}
+		for _, v := range qr.Votes {
+			w.Write([]string{question, strconv.FormatUint(uint64(v.Candidate), 10),
+				strconv.FormatFloat(v.Votes, 'f', -1, 64), strconv.FormatBool(elected[v.Candidate])})
+		}
+		w.Write([]string{question, "spoiled", strconv.Itoa(qr.Spoiled), ""})
+	}
+	for q, qr := range r.Questions {
+		write(strconv.Itoa(q), qr)
+		for s, sr := range qr.Sections {
+			write(strconv.Itoa(q)+"/"+strconv.Itoa(s), sr)
+		}
+	}
+	var texts []string
+	for text := range r.WriteIns {
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+	for _, text := range texts {
+		w.Write([]string{"write-in", text, strconv.Itoa(r.WriteIns[text]), ""})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ballotHex returns the hex-encoded ciphertexts of a ballot.
+func ballotHex(b *Ballot) []string {
+	points := []kyber.Point{b.Alpha, b.Beta}
+	for _, a := range b.Answers {
+		points = append(points, a.Alpha, a.Beta)
+	}
+	return pointsHex(points)
+}
+
+func pointsHex(points []kyber.Point) []string {
+	h := make([]string, len(points))
+	for i, p := range points {
+		if p != nil {
+			h[i] = p.String()
+		}
+	}
+	return h
+}
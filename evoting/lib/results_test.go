@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/util/random"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+)
+
+// embed returns the points holding the given plaintexts.
+func embed(plaintexts ...[]byte) []kyber.Point {
+	points := make([]kyber.Point, len(plaintexts))
+	for i, p := range plaintexts {
+		points[i] = cothority.Suite.Point().Embed(p, random.New())
+	}
+	return points
+}
+
+func TestNewResults(t *testing.T) {
+	_, X := RandomKeyPair()
+	e := &Election{ID: []byte{1, 2}, Candidates: []uint32{1, 2}, MaxChoices: 1, WriteIn: 8}
+	box := genBox(X, 3)
+	mixes := box.genMix(X, 2)
+
+	points := embed([]byte{1, 0, 0}, []byte{1, 0, 0}, []byte{3, 0, 0})
+	writeIns := embed([]byte("carol"), []byte(""), []byte("carol"))
+	_, err := NewResults(e, box, mixes, nil, points, nil)
+	require.NotNil(t, err)
+	r, err := NewResults(e, box, mixes, nil, points, []*Points{{Points: writeIns}})
+	require.Nil(t, err)
+
+	require.Equal(t, 1, len(r.Questions))
+	q := r.Questions[0]
+	require.Equal(t, []uint32{1}, q.Winners)
+	require.Equal(t, 1, q.Spoiled)
+	require.Equal(t, float64(2), q.Votes[0].Votes)
+	require.Equal(t, float64(0), q.Votes[1].Votes)
+	require.Equal(t, map[string]int{"carol": 2}, r.WriteIns)
+	require.Equal(t, 3, len(r.Transcript.Ballots))
+	require.Equal(t, 2, len(r.Transcript.Mixes))
+	require.Equal(t, 2, len(r.Transcript.Mixes[0].Proofs))
+
+	js, err := r.JSON()
+	require.Nil(t, err)
+	decoded := &Results{}
+	require.Nil(t, json.Unmarshal(js, decoded))
+	require.Equal(t, r.Questions[0].Winners, decoded.Questions[0].Winners)
+
+	csv, err := r.CSV()
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"question,candidate,votes,elected",
+		"0,1,2,true",
+		"0,2,0,false",
+		"0,spoiled,1,",
+		"write-in,carol,2,",
+	}, strings.Split(strings.TrimSpace(string(csv)), "\n"))
+}
@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The voters of an election can be partitioned into sections, like the
+// faculties of a university, to count the ballots per section as well as
+// overall. The index of the section of the voter takes the place of the
+// first candidate in the plaintext of the ballot, so it is shuffled
+// together with the choices. The ballot proofs only accept plaintexts with
+// the section of the voter, so sections need BallotProofs, and a single
+// question, as the answers of the other questions are shuffled separately.
+
+// Section is a part of the voters of an election.
+type Section struct {
+	Name    map[string]string // Name of the section. lang-code, value pair
+	Users   []uint32          // Users is the list of voters of the section.
+	UserIDs []UserID          // UserIDs are voters given by opaque identifiers.
+}
+
+// SectionOf returns the index of the section of the user, or -1 if the user
+// isn't in any section.
+func (e *Election) SectionOf(user UserID) int {
+	for i, s := range e.Sections {
+		for _, u := range s.Users {
+			if SciperID(u).Equal(user) {
+				return i
+			}
+		}
+		for _, u := range s.UserIDs {
+			if u.Equal(user) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// checkSections returns an error if the election can't have sections, or
+// if a voter is in more than one section.
+func (e *Election) checkSections() error {
+	if len(e.Questions) > 0 {
+		return errors.New("sections need a single question")
+	}
+	if !e.BallotProofs || e.Homomorphic {
+		return errors.New("sections need ballot proofs")
+	}
+	seen := make(map[string]bool)
+	for i, s := range e.Sections {
+		if s == nil {
+			return fmt.Errorf("missing section %d", i)
+		}
+		ids := append([]UserID{}, s.UserIDs...)
+		for _, u := range s.Users {
+			ids = append(ids, SciperID(u))
+		}
+		for _, id := range ids {
+			if seen[string(id)] {
+				return fmt.Errorf("user %s is in several sections", id)
+			}
+			seen[string(id)] = true
+		}
+	}
+	return nil
+}
+
+// withSection returns the valid answers of the question of the ballot as
+// they are encrypted: prefixed with the section of the voter for the first
+// question of an election with sections.
+func (e *Election) withSection(ballot *Ballot, question int, valid [][]uint32) ([][]uint32, error) {
+	if len(e.Sections) == 0 || question > 0 {
+		return valid, nil
+	}
+	section := e.SectionOf(ballot.GetUser())
+	if section < 0 {
+		return nil, errors.New("user is not in a section")
+	}
+	prefixed := make([][]uint32, len(valid))
+	for i, v := range valid {
+		prefixed[i] = append([]uint32{uint32(section)}, v...)
+	}
+	return prefixed, nil
+}
+
+// splitSection returns the section and the choices of a decrypted ballot of
+// an election with sections.
+func (e *Election) splitSection(choices []uint32) (int, []uint32, error) {
+	if len(choices) == 0 || int(choices[0]) >= len(e.Sections) {
+		return 0, nil, errors.New("invalid section")
+	}
+	return int(choices[0]), choices[1:], nil
+}
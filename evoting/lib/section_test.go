@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElection_Sections(t *testing.T) {
+	x, X := RandomKeyPair()
+	e := &Election{
+		ID:           []byte{1, 2, 3},
+		Key:          X,
+		Candidates:   []uint32{1, 2},
+		MaxChoices:   1,
+		BallotProofs: true,
+		Sections: []*Section{
+			{Users: []uint32{10, 11}},
+			{Users: []uint32{20}, UserIDs: []UserID{UserID("bob")}},
+		},
+	}
+	require.Nil(t, e.checkSections())
+	assert.Equal(t, 0, e.SectionOf(SciperID(11)))
+	assert.Equal(t, 1, e.SectionOf(UserID("bob")))
+	assert.Equal(t, -1, e.SectionOf(SciperID(30)))
+
+	// The section is encrypted with the choices, and the proof only holds
+	// for the section of the voter.
+	ballot, err := e.EncryptBallot(20, []uint32{2})
+	require.Nil(t, err)
+	require.Nil(t, e.VerifyBallot(ballot))
+	data, err := Decrypt(x, ballot.Alpha, ballot.Beta).Data()
+	require.Nil(t, err)
+	choices, err := DecodeBallot(data)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{1, 2}, choices)
+	e.Sections[0].Users = append(e.Sections[0].Users, 20)
+	e.Sections[1].Users = nil
+	assert.NotNil(t, e.VerifyBallot(ballot))
+	_, err = e.EncryptBallot(30, []uint32{2})
+	assert.NotNil(t, err)
+
+	e.Sections[1].Users = []uint32{20}
+	assert.NotNil(t, e.checkSections(), "20 is in both sections")
+	e.Sections[0].Users = []uint32{10, 11}
+	require.Nil(t, e.checkSections())
+	e.BallotProofs = false
+	assert.NotNil(t, e.checkSections())
+	e.BallotProofs = true
+	e.Questions = []*Question{{Candidates: []uint32{1, 2}}}
+	assert.NotNil(t, e.checkSections())
+}
+
+func TestNewResults_Sections(t *testing.T) {
+	_, X := RandomKeyPair()
+	e := &Election{ID: []byte{1, 2}, Candidates: []uint32{1, 2}, MaxChoices: 1,
+		Sections: []*Section{{Users: []uint32{10}}, {Users: []uint32{20}}}}
+	box := genBox(X, 4)
+
+	points := embed(EncodeBallot([]uint32{0, 1}), EncodeBallot([]uint32{1, 2}),
+		EncodeBallot([]uint32{1, 2}), EncodeBallot([]uint32{2, 1}))
+	r, err := NewResults(e, box, nil, nil, points, nil)
+	require.Nil(t, err)
+	q := r.Questions[0]
+	require.Equal(t, []uint32{2}, q.Winners)
+	require.Equal(t, 1, q.Spoiled, "unknown section")
+	require.Equal(t, 2, len(q.Sections))
+	require.Equal(t, []uint32{1}, q.Sections[0].Winners)
+	require.Equal(t, float64(2), q.Sections[1].Votes[1].Votes)
+
+	csv, err := r.CSV()
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"question,candidate,votes,elected",
+		"0,1,1,false",
+		"0,2,2,true",
+		"0,spoiled,1,",
+		"0/0,1,1,true",
+		"0/0,2,0,false",
+		"0/0,spoiled,0,",
+		"0/1,1,0,false",
+		"0/1,2,2,true",
+		"0/1,spoiled,0,",
+	}, strings.Split(strings.TrimSpace(string(csv)), "\n"))
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// TallyResult holds the outcome of an election.
+type TallyResult struct {
+	// Winners are the elected candidates in the order they were elected.
+	Winners []uint32
+	// Rounds holds the votes of every candidate still in the race for each
+	// counting round. Plurality and approval elections have only one round.
+	Rounds []map[uint32]float64
+	// Spoiled is the number of ballots that were not counted.
+	Spoiled int
+}
+
+// DecodeBallot returns the candidates stored in the plaintext of a ballot.
+// Every candidate is stored in 3 bytes, little-endian.
+func DecodeBallot(data []byte) ([]uint32, error) {
+	if len(data)%3 != 0 {
+		return nil, errors.New("ballot length is not a multiple of 3")
+	}
+	choices := make([]uint32, 0, len(data)/3)
+	for i := 0; i < len(data); i += 3 {
+		choices = append(choices,
+			uint32(data[i])|uint32(data[i+1])<<8|uint32(data[i+2])<<16)
+	}
+	return choices, nil
+}
+
+// EncodeBallot returns the plaintext of a ballot holding the given
+// candidates, see DecodeBallot.
+func EncodeBallot(choices []uint32) []byte {
+	data := make([]byte, 0, 3*len(choices))
+	for _, c := range choices {
+		data = append(data, byte(c), byte(c>>8), byte(c>>16))
+	}
+	return data
+}
+
+// Tally counts the decoded ballots according to the BallotType of the
+// election. Ballots with unknown or repeated candidates, or with too many
+// choices, are spoiled. Ties are broken by the order of the candidates in
+// the election.
+func (e *Election) Tally(ballots [][]uint32) (*TallyResult, error) {
+	res := &TallyResult{}
+	var valid [][]uint32
+	for _, b := range ballots {
+		if e.validBallot(b) {
+			valid = append(valid, b)
+		} else {
+			res.Spoiled++
+		}
+	}
+	switch e.BallotType {
+	case Plurality, Approval:
+		counts := make(map[uint32]float64)
+		for _, c := range e.Candidates {
+			counts[c] = 0
+		}
+		for _, b := range valid {
+			for _, c := range b {
+				counts[c]++
+			}
+		}
+		res.Rounds = append(res.Rounds, counts)
+		all := make(map[uint32]bool)
+		for _, c := range e.Candidates {
+			all[c] = true
+		}
+		res.Winners = e.ranking(func(a, b uint32) bool {
+			return counts[a] > counts[b]
+		}, all)[:e.seats()]
+	case Ranked:
+		e.stv(valid, res)
+	default:
+		return nil, errors.New("unknown ballot type")
+	}
+	return res, nil
+}
+
+// stv does a single transferable vote count using the Droop quota. Surplus
+// votes of elected candidates are transferred with a weight of
+// surplus / votes, and the candidate with the fewest votes is eliminated
+// if nobody reaches the quota. Exact fractions are used so that the result
+// doesn't depend on rounding.
+func (e *Election) stv(ballots [][]uint32, res *TallyResult) {
+	seats := e.seats()
+	quota := big.NewRat(int64(len(ballots)/(seats+1)+1), 1)
+	weights := make([]*big.Rat, len(ballots))
+	for i := range weights {
+		weights[i] = big.NewRat(1, 1)
+	}
+	continuing := make(map[uint32]bool)
+	for _, c := range e.Candidates {
+		continuing[c] = true
+	}
+	// top returns the first continuing candidate of a ballot.
+	top := func(b []uint32) (uint32, bool) {
+		for _, c := range b {
+			if continuing[c] {
+				return c, true
+			}
+		}
+		return 0, false
+	}
+
+	for len(res.Winners) < seats && len(continuing) > 0 {
+		counts := make(map[uint32]*big.Rat)
+		for c := range continuing {
+			counts[c] = new(big.Rat)
+		}
+		for i, b := range ballots {
+			if c, ok := top(b); ok {
+				counts[c].Add(counts[c], weights[i])
+			}
+		}
+		round := make(map[uint32]float64)
+		for c, v := range counts {
+			round[c], _ = v.Float64()
+		}
+		res.Rounds = append(res.Rounds, round)
+		ranking := e.ranking(func(a, b uint32) bool {
+			return counts[a].Cmp(counts[b]) > 0
+		}, continuing)
+
+		if len(res.Winners)+len(continuing) <= seats {
+			res.Winners = append(res.Winners, ranking...)
+			return
+		}
+
+		var elected []uint32
+		for _, c := range ranking {
+			if counts[c].Cmp(quota) >= 0 && len(res.Winners)+len(elected) < seats {
+				elected = append(elected, c)
+			}
+		}
+		if len(elected) == 0 {
+			delete(continuing, ranking[len(ranking)-1])
+			continue
+		}
+		for i, b := range ballots {
+			if c, ok := top(b); ok {
+				for _, el := range elected {
+					if c == el {
+						surplus := new(big.Rat).Sub(counts[c], quota)
+						weights[i].Mul(weights[i], surplus.Quo(surplus, counts[c]))
+					}
+				}
+			}
+		}
+		for _, c := range elected {
+			delete(continuing, c)
+		}
+		res.Winners = append(res.Winners, elected...)
+	}
+}
+
+// ranking returns the candidates in the set sorted using more, which
+// returns true if a has more votes than b. Ties are broken by the order of
+// the candidates in the election.
+func (e *Election) ranking(more func(a, b uint32) bool, set map[uint32]bool) []uint32 {
+	var ranking []uint32
+	for _, c := range e.Candidates {
+		if set[c] {
+			ranking = append(ranking, c)
+		}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return more(ranking[i], ranking[j])
+	})
+	return ranking
+}
+
+func (e *Election) validBallot(b []uint32) bool {
+	if e.BallotType != Approval && e.MaxChoices > 0 && len(b) > e.MaxChoices {
+		return false
+	}
+	seen := make(map[uint32]bool)
+	for _, c := range b {
+		if seen[c] || !e.isCandidate(c) {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+func (e *Election) isCandidate(c uint32) bool {
+	for _, candidate := range e.Candidates {
+		if candidate == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Election) seats() int {
+	seats := e.Seats
+	if seats <= 0 {
+		seats = 1
+	}
+	if seats > len(e.Candidates) {
+		return len(e.Candidates)
+	}
+	return seats
+}
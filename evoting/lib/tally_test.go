@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBallot(t *testing.T) {
+	choices, err := DecodeBallot([]byte{1, 0, 0, 0xff, 0xff, 0x0f})
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{1, 0x0fffff}, choices)
+	_, err = DecodeBallot([]byte{1, 2})
+	assert.NotNil(t, err)
+}
+
+func repeat(n int, ballot ...uint32) [][]uint32 {
+	ballots := make([][]uint32, n)
+	for i := range ballots {
+		ballots[i] = ballot
+	}
+	return ballots
+}
+
+func TestTally_Plurality(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2, 3}, MaxChoices: 1}
+	ballots := append(repeat(2, 1), repeat(3, 2)...)
+	ballots = append(ballots, []uint32{1, 2}, []uint32{4}, []uint32{3})
+	res, err := e.Tally(ballots)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{2}, res.Winners)
+	assert.Equal(t, 2, res.Spoiled)
+	assert.Equal(t, 1, len(res.Rounds))
+	assert.Equal(t, 2.0, res.Rounds[0][1])
+
+	e.BallotType = Approval
+	e.Seats = 2
+	res, err = e.Tally(ballots)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{2, 1}, res.Winners)
+	assert.Equal(t, 1, res.Spoiled)
+}
+
+func TestTally_InstantRunoff(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2, 3}, BallotType: Ranked, MaxChoices: 3}
+	ballots := append(repeat(5, 1, 2), repeat(4, 2, 1)...)
+	ballots = append(ballots, repeat(3, 3, 2)...)
+	res, err := e.Tally(ballots)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{2}, res.Winners)
+	assert.Equal(t, 2, len(res.Rounds))
+	assert.Equal(t, 7.0, res.Rounds[1][2])
+}
+
+func TestTally_STV(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2, 3, 4}, BallotType: Ranked, Seats: 2}
+	ballots := append(repeat(6, 1, 2), repeat(2, 3)...)
+	ballots = append(ballots, repeat(3, 4, 3)...)
+	res, err := e.Tally(ballots)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{1, 4}, res.Winners)
+	// The surplus of 2 votes of candidate 1 is transferred to candidate 2.
+	assert.Equal(t, 2.0, res.Rounds[1][2])
+
+	// Duplicate candidates spoil a ballot.
+	res, err = e.Tally([][]uint32{{1, 1}, {2}})
+	require.Nil(t, err)
+	assert.Equal(t, 1, res.Spoiled)
+	assert.Equal(t, 2, len(res.Winners))
+}
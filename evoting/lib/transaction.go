@@ -1,8 +1,8 @@
 package lib
 
 import (
+	"crypto/sha256"
 	"errors"
-	"strconv"
 	"time"
 
 	"github.com/dedis/kyber/sign/schnorr"
@@ -12,6 +12,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/darc"
 	"github.com/dedis/cothority/skipchain"
 )
 
@@ -30,14 +31,62 @@ var TransactionVerifiers = []skipchain.VerifierID{TransactionVerifierID}
 type Transaction struct {
 	Master *Master
 	Link   *Link
+	// Rotation replaces the master, authenticated by the admin keys
+	// instead of the front-end key.
+	Rotation *Rotation
 
 	Election *Election
 	Ballot   *Ballot
 	Mix      *Mix
 	Partial  *Partial
+	// Snapshot holds the box of all the ballots cast so far, so that it can be
+	// retrieved without reading every block of the chain.
+	Snapshot *Box
+	// Audit records an administrative action on the election.
+	Audit *AuditEntry
+	// Reshare records that the shares of the election key have been handed
+	// over to a new roster.
+	Reshare *Reshare
 
 	User      uint32
 	Signature []byte
+
+	// DarcSignature proves the right to vote of a user that is not in the
+	// list of voters of the election, see Election.CanVote.
+	DarcSignature *darc.Signature
+	// VoterProof proves the right to vote of a user that is part of the
+	// voter roll of the election, see Election.InVoterRoll.
+	VoterProof *VoterProof
+
+	// UserID identifies the user instead of User if it is set.
+	UserID UserID
+
+	// Redaction records that the voter data of the election is redacted.
+	Redaction *Redaction
+}
+
+// Names of the predicates selecting the blocks of a type of transaction,
+// which the evoting service registers with skipchain.RegisterPredicate.
+const (
+	PredicateBallot  = "evoting-ballot"
+	PredicateMix     = "evoting-mix"
+	PredicatePartial = "evoting-partial"
+)
+
+// Predicates holds the predicates of the evoting transactions by name.
+var Predicates = map[string]skipchain.BlockPredicate{
+	PredicateBallot: func(sb *skipchain.SkipBlock) bool {
+		t := UnmarshalTransaction(sb.Data)
+		return t != nil && t.Ballot != nil
+	},
+	PredicateMix: func(sb *skipchain.SkipBlock) bool {
+		t := UnmarshalTransaction(sb.Data)
+		return t != nil && t.Mix != nil
+	},
+	PredicatePartial: func(sb *skipchain.SkipBlock) bool {
+		t := UnmarshalTransaction(sb.Data)
+		return t != nil && t.Partial != nil
+	},
 }
 
 // UnmarshalTransaction decodes a data blob to a transaction structure.
@@ -62,6 +111,8 @@ func NewTransaction(data interface{}, user uint32, signature []byte) *Transactio
 		transaction.Master = data.(*Master)
 	case *Link:
 		transaction.Link = data.(*Link)
+	case *Rotation:
+		transaction.Rotation = data.(*Rotation)
 	case *Election:
 		transaction.Election = data.(*Election)
 	case *Ballot:
@@ -70,37 +121,49 @@ func NewTransaction(data interface{}, user uint32, signature []byte) *Transactio
 		transaction.Mix = data.(*Mix)
 	case *Partial:
 		transaction.Partial = data.(*Partial)
+	case *Box:
+		transaction.Snapshot = data.(*Box)
+	case *AuditEntry:
+		transaction.Audit = data.(*AuditEntry)
+	case *Reshare:
+		transaction.Reshare = data.(*Reshare)
+	case *Redaction:
+		transaction.Redaction = data.(*Redaction)
 	default:
 		return nil
 	}
 	return transaction
 }
 
-// Digest appends the digits of sciper to master genesis skipblock ID
+// GetUser returns the identifier of the user of the transaction.
+func (t *Transaction) GetUser() UserID {
+	return ResolveUser(t.User, t.UserID)
+}
+
+// Digest appends the user to master genesis skipblock ID, see UserDigest.
 func (t *Transaction) Digest(s *skipchain.Service, genesis skipchain.SkipBlockID) []byte {
 	var message []byte
 	switch {
 	case t.Master != nil:
 		message = t.Master.ID
+	case t.Rotation != nil:
+		message = t.Rotation.Master.ID
 	case t.Election != nil:
 		message = t.Election.Master
 	default:
-		election, _ := GetElection(s, genesis, false, t.User)
+		election, _ := GetElection(s, genesis, false, nil)
 		if election == nil {
 			return nil
 		}
 		message = election.Master
 	}
-	for _, c := range strconv.Itoa(int(t.User)) {
-		d, _ := strconv.Atoi(string(c))
-		message = append(message, byte(d))
-	}
-	return message
+	return UserDigest(message, t.User, t.UserID)
 }
 
 // Verify checks that the corresponding transaction is valid before storing it.
 func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service) error {
 	digest := t.Digest(s, genesis)
+	user := t.GetUser()
 	if t.Master != nil {
 		// Find the current master in order to compare against it.
 		m, err := GetMaster(s, genesis)
@@ -113,7 +176,7 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		if err != nil {
 			return err
 		}
-		if !m.IsAdmin(t.User) {
+		if !m.IsAdminID(user) {
 			return errors.New("current user was not in previous admin list")
 		}
 
@@ -124,28 +187,40 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 
 		// All the other fields (admin list, roster, and front end key) may change, but
 		// let's apply some sanity checks to them.
-
-		if len(t.Master.Admins) == 0 {
-			return errors.New("empty admin list in master update")
+		return t.Master.check()
+	} else if t.Rotation != nil {
+		if t.Rotation.Master == nil {
+			return errors.New("rotation error: missing master")
 		}
-		if len(t.Master.Roster.List) == 0 {
-			return errors.New("empty roster in master update")
+		m, err := GetMaster(s, genesis)
+		if err != nil {
+			return err
 		}
-		null := t.Master.Key.Clone().Null()
-		if t.Master.Key.Equal(null) {
-			return errors.New("null key in master update")
+		if err := m.VerifyRotation(t.Rotation); err != nil {
+			return err
 		}
-
-		return nil
+		if !t.Rotation.Master.ID.Equal(m.ID) {
+			return errors.New("mismatched ID in master update")
+		}
+		return t.Rotation.Master.check()
 	} else if t.Link != nil {
 		master, err := GetMaster(s, genesis)
 		if err != nil {
 			return err
 		}
 
-		if !master.IsAdmin(t.User) {
+		if !master.IsAdminID(user) {
 			return errors.New("link error: user not admin")
 		}
+		if t.Link.Unlink {
+			election, err := loadElection(s, t.Link.ID)
+			if err != nil {
+				return err
+			}
+			if !election.IsTest || !election.Master.Equal(genesis) {
+				return errors.New("link error: only test elections can be unlinked")
+			}
+		}
 		return nil
 	} else if t.Election != nil {
 		election := t.Election
@@ -156,17 +231,81 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		if election.End < time.Now().Unix() {
 			return errors.New("open error: invalid end date")
 		}
+		if election.BallotType > Ranked {
+			return errors.New("open error: unknown ballot type")
+		}
+		if election.Seats < 0 || len(election.Questions) == 0 && election.Seats > len(election.Candidates) {
+			return errors.New("open error: invalid number of seats")
+		}
+		if election.Roster == nil {
+			return errors.New("open error: missing roster")
+		}
+		if n := len(election.Roster.List); election.Threshold < (n+1)/2 || election.Threshold > n {
+			return errors.New("open error: invalid threshold")
+		}
+		if election.VoterRoot != nil && len(election.VoterRoot) != sha256.Size {
+			return errors.New("open error: invalid voter root")
+		}
+		if election.MaxBallots < 0 {
+			return errors.New("open error: invalid number of ballots per user")
+		}
+		if election.CountWindow < 0 {
+			return errors.New("open error: invalid count window")
+		}
+		if election.Retention < 0 {
+			return errors.New("open error: invalid retention")
+		}
+		if election.Redacted {
+			return errors.New("open error: new election cannot be redacted")
+		}
+		if election.TestVoters < 0 || (election.TestVoters > 0 && !election.IsTest) {
+			return errors.New("open error: invalid number of test voters")
+		}
+		if election.WriteIn < 0 || election.WriteIn > MaxWriteIn {
+			return errors.New("open error: invalid write-in length")
+		}
+		for _, q := range election.Questions {
+			if q == nil || len(q.Candidates) == 0 {
+				return errors.New("open error: question without candidates")
+			}
+		}
+		if err := election.CheckLanguages(); err != nil {
+			return errors.New("open error: " + err.Error())
+		}
+		if err := election.checkCandidates(); err != nil {
+			return errors.New("open error: " + err.Error())
+		}
+		if election.BallotProofs {
+			if err := election.checkBallotProofs(); err != nil {
+				return errors.New("open error: " + err.Error())
+			}
+		}
+		if election.Homomorphic {
+			if err := election.checkHomomorphic(); err != nil {
+				return errors.New("open error: " + err.Error())
+			}
+		}
+		if len(election.Sections) > 0 {
+			if err := election.checkSections(); err != nil {
+				return errors.New("open error: " + err.Error())
+			}
+		}
+		if len(election.Mixers) > 0 {
+			if err := election.checkMixers(); err != nil {
+				return errors.New("open error: " + err.Error())
+			}
+		}
 
 		master, err := GetMaster(s, election.Master)
 		if err != nil {
 			return err
 		}
-		if !master.IsAdmin(t.User) {
+		if !master.IsAdminID(user) {
 			return errors.New("open error: user not admin")
 		}
 		return nil
 	} else if t.Ballot != nil {
-		election, err := GetElection(s, genesis, false, t.User)
+		election, err := GetElection(s, genesis, false, nil)
 		if err != nil {
 			return err
 		}
@@ -175,26 +314,55 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 			return err
 		}
 
-		// t.User is trusted at this point, so make sure that they did not try to sneak
+		// The user is trusted at this point, so make sure that they did not try to sneak
 		// through a different user-id in the ballot.
-		if t.User != t.Ballot.User {
+		if !user.Equal(t.Ballot.GetUser()) {
 			return errors.New("ballot user-id differs from transaction user-id")
 		}
-
-		latest, err := s.GetDB().GetLatest(s.GetDB().GetByID(election.ID))
-		transaction := UnmarshalTransaction(latest.Data)
-		if err != nil {
-			return err
+		if err := t.Ballot.WellFormed(); err != nil {
+			return errors.New("cast error: " + err.Error())
+		}
+		// All the conodes have to accept the block, so the ballot is only
+		// stored if the roster agrees that the election is open.
+		now := time.Now().Unix()
+		if election.Start > 0 && now < election.Start {
+			return errors.New("cast error: election not started yet")
+		}
+		if now > election.End {
+			return errors.New("cast error: election ended")
+		}
+		if election.CountWindow > 0 {
+			// Like for audit entries, the time can't be far from now.
+			drift := now - t.Ballot.Time
+			if drift > int64(auditDrift.Seconds()) || -drift > int64(auditDrift.Seconds()) {
+				return errors.New("cast error: invalid ballot time")
+			}
 		}
-		if transaction.Mix != nil || transaction.Partial != nil {
+		if len(t.Ballot.Answers) != election.NumCiphertexts()-1 {
+			return errors.New("cast error: wrong number of answers")
+		}
+		if election.Homomorphic {
+			if err := election.VerifyHomomorphic(t.Ballot); err != nil {
+				return errors.New("cast error: " + err.Error())
+			}
+		} else if election.BallotProofs {
+			if err := election.VerifyBallot(t.Ballot); err != nil {
+				return errors.New("cast error: " + err.Error())
+			}
+		}
+
+		if election.Stage != Running {
 			return errors.New("cast error: election not in running stage")
-		} else if !election.IsUser(t.User) {
-			return errors.New("cast error: user not part")
+		} else if t.VoterProof != nil {
+			if err := election.InVoterRollID(user, t.VoterProof); err != nil {
+				return errors.New("cast error: " + err.Error())
+			}
+		} else if err := election.CanVote(t.Ballot, t.DarcSignature); err != nil {
+			return errors.New("cast error: " + err.Error())
 		}
 		return nil
 	} else if t.Mix != nil {
-		election, err := GetElection(s, genesis, false, t.User)
-		roster := election.Roster
+		election, err := GetElection(s, genesis, false, nil)
 		if err != nil {
 			return err
 		}
@@ -206,15 +374,34 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		mixes, err := election.Mixes()
 		if err != nil {
 			return err
-		} else if len(mixes) == len(roster.List) {
+		} else if len(mixes) == election.NumMixes() {
 			return errors.New("shuffle error: election already shuffled")
-		} else if !election.IsCreator(t.User) {
-			return errors.New("shuffle error: user is not election creator")
+		} else if !election.IsAdminID(user) {
+			return errors.New("shuffle error: user is not election admin")
+		}
+		for _, mix := range mixes {
+			if mix.Node == t.Mix.Node {
+				return errors.New("shuffle error: node already shuffled")
+			}
+		}
+		if err := election.nextMixer(mixes, t.Mix); err != nil {
+			return errors.New("shuffle error: " + err.Error())
+		}
+		if election.Homomorphic {
+			// Everybody can add up the ballots, so the aggregate is checked
+			// instead of a shuffle proof.
+			box, _, err := election.LocalBox(s)
+			if err != nil {
+				return err
+			}
+			err = election.VerifyAggregate(election.Counted(box), []*Mix{t.Mix})
+			if err != nil {
+				return errors.New("shuffle error: " + err.Error())
+			}
 		}
 		return nil
 	} else if t.Partial != nil {
-		election, err := GetElection(s, genesis, false, t.User)
-		roster := election.Roster
+		election, err := GetElection(s, genesis, false, nil)
 		if err != nil {
 			return err
 		}
@@ -226,19 +413,83 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		mixes, err := election.Mixes()
 		if err != nil {
 			return err
-		} else if len(mixes) != len(roster.List) {
+		} else if len(mixes) != election.NumMixes() {
 			return errors.New("decrypt error, election not shuffled yet")
 		}
 
 		partials, err := election.Partials()
 		if err != nil {
 			return err
-		} else if len(partials) == len(roster.List) {
+		} else if len(partials) == len(election.Roster.List) {
 			return errors.New("decrypt error: election already decrypted")
-		} else if !election.IsCreator(t.User) {
-			return errors.New("decrypt error: user is not election creator")
+		} else if !election.IsAdminID(user) {
+			return errors.New("decrypt error: user is not election admin")
+		}
+		for _, partial := range partials {
+			if partial.Node == t.Partial.Node {
+				return errors.New("decrypt error: node already decrypted")
+			}
+		}
+		return nil
+	} else if t.Snapshot != nil {
+		election, err := GetElection(s, genesis, false, nil)
+		if err != nil {
+			return err
+		}
+
+		if election.Stage != Running {
+			return errors.New("snapshot error: election not in running stage")
+		}
+
+		// The snapshot must match the box everybody can compute from the chain.
+		box, _, err := election.LocalBox(s)
+		if err != nil {
+			return err
+		}
+		if !box.Equal(t.Snapshot) {
+			return errors.New("snapshot error: box mismatch")
 		}
 		return nil
+	} else if t.Audit != nil {
+		election, err := GetElection(s, genesis, false, nil)
+		if err != nil {
+			return err
+		}
+		err = schnorr.Verify(cothority.Suite, election.MasterKey, digest, t.Signature)
+		if err != nil {
+			return err
+		}
+		return t.Audit.verify(s, election, user)
+	} else if t.Reshare != nil {
+		election, err := GetElection(s, genesis, false, nil)
+		if err != nil {
+			return err
+		}
+		err = schnorr.Verify(cothority.Suite, election.MasterKey, digest, t.Signature)
+		if err != nil {
+			return err
+		}
+
+		if !election.IsAdminID(user) {
+			return errors.New("reshare error: user is not election admin")
+		} else if election.Stage != Running {
+			return errors.New("reshare error: election not in running stage")
+		}
+		return election.checkReshare(t.Reshare.Roster)
+	} else if t.Redaction != nil {
+		election, err := GetElection(s, genesis, false, nil)
+		if err != nil {
+			return err
+		}
+		err = schnorr.Verify(cothority.Suite, election.MasterKey, digest, t.Signature)
+		if err != nil {
+			return err
+		}
+
+		if !election.IsAdminID(user) {
+			return errors.New("redact error: user is not election admin")
+		}
+		return election.checkRedaction(s, t.Redaction)
 	}
 	return errors.New("transaction error: empty transaction")
 }
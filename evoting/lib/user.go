@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+)
+
+// UserID identifies a user of the evoting service. It is opaque to the
+// service, so that a deployment can identify its users by emails, student
+// numbers or public keys. The uint32 user fields hold EPFL scipers and are
+// kept for compatibility: a sciper is the same user as its SciperID, and
+// every struct with a sciper has a UserID field that is used instead when
+// it is set.
+type UserID []byte
+
+// SciperID returns the identifier of a sciper, which is its little-endian
+// encoding. Hashes of ballots and voter rolls don't change with it.
+func SciperID(sciper uint32) UserID {
+	id := make(UserID, 4)
+	binary.LittleEndian.PutUint32(id, sciper)
+	return id
+}
+
+// ResolveUser returns id if it is set, else the identifier of the sciper.
+func ResolveUser(sciper uint32, id UserID) UserID {
+	if len(id) > 0 {
+		return id
+	}
+	return SciperID(sciper)
+}
+
+// Equal returns true if both identifiers are the same.
+func (u UserID) Equal(other UserID) bool {
+	return bytes.Equal(u, other)
+}
+
+// String returns the identifier in hex.
+func (u UserID) String() string {
+	return hex.EncodeToString(u)
+}
+
+// UserDigest returns message followed by the user, which is what the
+// front-end signs to authenticate the user. The digits of the sciper are
+// appended if id is not set, as the front-ends for scipers do.
+func UserDigest(message []byte, sciper uint32, id UserID) []byte {
+	message = append([]byte{}, message...)
+	if len(id) > 0 {
+		return append(message, id...)
+	}
+	for _, c := range strconv.Itoa(int(sciper)) {
+		d, _ := strconv.Atoi(string(c))
+		message = append(message, byte(d))
+	}
+	return message
+}
+
+// testPrefix starts the identifiers of the synthetic voters of test
+// elections.
+const testPrefix = "test:"
+
+// TestUserID returns the identifier of the i-th synthetic voter of a test
+// election, see Election.IsTest.
+func TestUserID(i int) UserID {
+	return UserID(testPrefix + strconv.Itoa(i))
+}
+
+// testVoter returns the index of a synthetic voter.
+func testVoter(user UserID) (int, bool) {
+	if !bytes.HasPrefix(user, []byte(testPrefix)) {
+		return 0, false
+	}
+	i, err := strconv.Atoi(string(user[len(testPrefix):]))
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
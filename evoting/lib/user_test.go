@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSciperID(t *testing.T) {
+	assert.Equal(t, SciperID(123456), ResolveUser(123456, nil))
+	assert.Equal(t, UserID("a@b.c"), ResolveUser(123456, UserID("a@b.c")))
+
+	// Ballots of scipers hash the same way with either field.
+	_, X := RandomKeyPair()
+	K, C := Encrypt(X, []byte("ballot"))
+	legacy := &Ballot{User: 123456, Alpha: K, Beta: C}
+	ballot := &Ballot{UserID: SciperID(123456), Alpha: K, Beta: C}
+	assert.Equal(t, legacy.Hash(), ballot.Hash())
+	assert.True(t, legacy.GetUser().Equal(ballot.GetUser()))
+}
+
+func TestUserDigest(t *testing.T) {
+	message := []byte{9}
+	assert.Equal(t, []byte{9, 1, 0, 2}, UserDigest(message, 102, nil))
+	assert.Equal(t, []byte{9, 'a', 'b'}, UserDigest(message, 102, UserID("ab")))
+	assert.Equal(t, []byte{9}, message)
+}
+
+func TestIsUserID(t *testing.T) {
+	e := &Election{
+		Creator:  1,
+		Users:    []uint32{2},
+		UserIDs:  []UserID{UserID("voter")},
+		AdminIDs: []UserID{UserID("admin")},
+	}
+	assert.True(t, e.IsUserID(SciperID(2)))
+	assert.True(t, e.IsUserID(UserID("voter")))
+	assert.False(t, e.IsUserID(UserID("admin")))
+	assert.True(t, e.IsCreatorID(SciperID(1)))
+	assert.True(t, e.IsAdminID(UserID("admin")))
+	assert.False(t, e.IsAdminID(UserID("voter")))
+
+	e.CreatorID = UserID("creator")
+	assert.False(t, e.IsCreator(1))
+	assert.True(t, e.IsAdminID(UserID("creator")))
+
+	m := &Master{Admins: []uint32{1}, AdminIDs: []UserID{UserID("admin")}}
+	assert.True(t, m.IsAdmin(1))
+	assert.True(t, m.IsAdminID(UserID("admin")))
+	assert.False(t, m.IsAdminID(UserID("voter")))
+}
+
+func TestVoterRollID(t *testing.T) {
+	users := []UserID{UserID("a"), UserID("bb@example.com"), SciperID(100000)}
+	roll, err := NewVoterRollID(users)
+	require.Nil(t, err)
+	root := roll.Root()
+	for _, user := range users {
+		proof, err := roll.ProofID(user)
+		require.Nil(t, err)
+		assert.Nil(t, proof.VerifyID(root, user))
+	}
+
+	// The sciper is found with the old API, too.
+	proof, err := roll.Proof(100000)
+	require.Nil(t, err)
+	assert.Nil(t, proof.Verify(root, 100000))
+
+	// Moving bytes between the user and the nonce doesn't give a new voter.
+	proof, _ = roll.ProofID(UserID("a"))
+	forged := *proof
+	forged.Nonce = proof.Nonce[1:]
+	assert.NotNil(t, forged.VerifyID(root, UserID(append([]byte("a"), proof.Nonce[0]))))
+}
+
+func TestEncryptBallotID(t *testing.T) {
+	_, X := RandomKeyPair()
+	e := &Election{
+		ID:         []byte{1, 2, 3},
+		Key:        X,
+		Candidates: []uint32{1, 2, 3},
+		MaxChoices: 2,
+	}
+	ballot, err := e.EncryptBallotID(UserID("voter"), []uint32{1})
+	require.Nil(t, err)
+	assert.Nil(t, e.VerifyBallot(ballot))
+
+	// The proof is bound to the user.
+	ballot.UserID = UserID("other")
+	assert.NotNil(t, e.VerifyBallot(ballot))
+}
@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/proof"
+
+	"github.com/dedis/cothority"
+)
+
+// MaxValidBallots is the maximum number of valid answers of a question in
+// an election with ballot proofs, as the size of a proof grows with it.
+const MaxValidBallots = 256
+
+// maxBallotChoices is the number of candidates that fit in a ballot.
+var maxBallotChoices = cothority.Suite.Point().EmbedLen() / 3
+
+// EncryptBallot encrypts the choices of the user, one list of candidates
+// for every question, and proves for each of them that the ciphertext holds
+// one of the valid answers of the question. The answers are embedded
+// deterministically, so that the conodes can compute all the valid
+// plaintexts, and the proof is an OR of Chaum-Pedersen proofs over them.
+// If the election allows write-ins, the write-in has to be appended to the
+// answers of the ballot, see EncryptWriteIn.
+func (e *Election) EncryptBallot(user uint32, choices ...[]uint32) (*Ballot, error) {
+	return e.encryptBallot(&Ballot{User: user}, choices)
+}
+
+// EncryptBallotID works like EncryptBallot for a user given by an opaque
+// identifier.
+func (e *Election) EncryptBallotID(user UserID, choices ...[]uint32) (*Ballot, error) {
+	return e.encryptBallot(&Ballot{UserID: user}, choices)
+}
+
+// encryptBallot adds the answers and proofs to the ballot of the user.
+func (e *Election) encryptBallot(ballot *Ballot, choices [][]uint32) (*Ballot, error) {
+	if len(choices) != e.NumQuestions() {
+		return nil, errors.New("wrong number of answers")
+	}
+	for q, c := range choices {
+		question := e.Question(q)
+		c = question.canonical(c)
+		if !question.validBallot(c) || len(c) > maxBallotChoices {
+			return nil, errors.New("invalid answer")
+		}
+		valid, err := question.validBallots()
+		if err != nil {
+			return nil, err
+		}
+		index := -1
+		for i, v := range valid {
+			if equalChoices(v, c) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, errors.New("invalid answer")
+		}
+		valid, err = e.withSection(ballot, q, valid)
+		if err != nil {
+			return nil, err
+		}
+
+		K, C, r := encryptPoint(e.Key, validPoint(valid[index]))
+		pred := validityPredicate(len(valid))
+		prover := pred.Prover(cothority.Suite, map[string]kyber.Scalar{"r": r},
+			e.validityPoints(validPoints(valid), K, C), map[proof.Predicate]int{pred: index})
+		p, err := proof.HashProve(cothority.Suite, e.ballotProtocol(ballot, q), prover)
+		if err != nil {
+			return nil, err
+		}
+		if q == 0 {
+			ballot.Alpha, ballot.Beta = K, C
+		} else {
+			ballot.Answers = append(ballot.Answers, &Ciphertext{Alpha: K, Beta: C})
+		}
+		ballot.Proofs = append(ballot.Proofs, p)
+	}
+	return ballot, nil
+}
+
+// VerifyBallot checks the proofs of a ballot created by EncryptBallot.
+func (e *Election) VerifyBallot(ballot *Ballot) error {
+	if len(ballot.Proofs) != e.NumQuestions() || len(ballot.Answers) < e.NumQuestions()-1 {
+		return errors.New("wrong number of ballot proofs")
+	}
+	for q := 0; q < e.NumQuestions(); q++ {
+		valid, err := e.Question(q).validBallots()
+		if err != nil {
+			return err
+		}
+		valid, err = e.withSection(ballot, q, valid)
+		if err != nil {
+			return err
+		}
+		K, C := ballot.Alpha, ballot.Beta
+		if q > 0 {
+			K, C = ballot.Answers[q-1].Alpha, ballot.Answers[q-1].Beta
+		}
+		if K == nil || C == nil {
+			return errors.New("missing ciphertext")
+		}
+		verifier := validityPredicate(len(valid)).Verifier(cothority.Suite,
+			e.validityPoints(validPoints(valid), K, C))
+		err = proof.HashVerify(cothority.Suite, e.ballotProtocol(ballot, q), verifier, ballot.Proofs[q])
+		if err != nil {
+			return errors.New("invalid ballot proof")
+		}
+	}
+	return nil
+}
+
+// checkBallotProofs returns an error if a question of the election has too
+// many valid answers to be proven.
+func (e *Election) checkBallotProofs() error {
+	for q := 0; q < e.NumQuestions(); q++ {
+		if _, err := e.Question(q).validBallots(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validBallots returns all the valid answers of a single question election.
+// Ranked answers are sequences of candidates, the other answers are sets
+// given in the order of the candidates of the election.
+func (e *Election) validBallots() ([][]uint32, error) {
+	max := e.MaxChoices
+	if e.BallotType == Approval || max <= 0 || max > len(e.Candidates) {
+		max = len(e.Candidates)
+	}
+	if max > maxBallotChoices {
+		max = maxBallotChoices
+	}
+	if len(e.Sections) > 0 && max == maxBallotChoices {
+		// The section takes the place of a candidate.
+		max--
+	}
+
+	valid := [][]uint32{}
+	used := make([]bool, len(e.Candidates))
+	var extend func(prefix []uint32, from int) error
+	extend = func(prefix []uint32, from int) error {
+		if len(valid) == MaxValidBallots {
+			return errors.New("too many valid answers for ballot proofs")
+		}
+		valid = append(valid, append([]uint32{}, prefix...))
+		if len(prefix) == max {
+			return nil
+		}
+		for i := from; i < len(e.Candidates); i++ {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			next := i + 1
+			if e.BallotType == Ranked {
+				next = 0
+			}
+			err := extend(append(prefix, e.Candidates[i]), next)
+			used[i] = false
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := extend(nil, 0); err != nil {
+		return nil, err
+	}
+	return valid, nil
+}
+
+// canonical returns the choices as listed by validBallots: in the order of
+// the candidates unless the ballots are ranked.
+func (e *Election) canonical(choices []uint32) []uint32 {
+	if e.BallotType == Ranked {
+		return choices
+	}
+	var sorted []uint32
+	for _, candidate := range e.Candidates {
+		for _, c := range choices {
+			if c == candidate {
+				sorted = append(sorted, c)
+				break
+			}
+		}
+	}
+	if len(sorted) != len(choices) {
+		return choices
+	}
+	return sorted
+}
+
+// ballotProtocol binds a proof to the election, the user and the question,
+// so that a ballot can't be copied by another voter.
+func (e *Election) ballotProtocol(ballot *Ballot, question int) string {
+	if len(ballot.UserID) > 0 {
+		return fmt.Sprintf("evoting-ballot-%x-id-%x-%d", []byte(e.ID), []byte(ballot.UserID), question)
+	}
+	return fmt.Sprintf("evoting-ballot-%x-%d-%d", []byte(e.ID), ballot.User, question)
+}
+
+// validityPoints returns the points of the validity proof of the ciphertext
+// (K, C): D<i> is C minus the i-th valid plaintext.
+func (e *Election) validityPoints(valid []kyber.Point, K, C kyber.Point) map[string]kyber.Point {
+	points := map[string]kyber.Point{
+		"B": cothority.Suite.Point().Base(),
+		"X": e.Key,
+		"K": K,
+	}
+	for i, M := range valid {
+		points["D"+strconv.Itoa(i)] = cothority.Suite.Point().Sub(C, M)
+	}
+	return points
+}
+
+// validPoints returns the plaintexts of the valid answers.
+func validPoints(valid [][]uint32) []kyber.Point {
+	points := make([]kyber.Point, len(valid))
+	for i, choices := range valid {
+		points[i] = validPoint(choices)
+	}
+	return points
+}
+
+// validityPredicate proves that the ciphertext holds one of n valid
+// plaintexts: K = rB and D<i> = rX for one i.
+func validityPredicate(n int) proof.Predicate {
+	branches := make([]proof.Predicate, n)
+	for i := range branches {
+		branches[i] = proof.And(proof.Rep("K", "r", "B"), proof.Rep("D"+strconv.Itoa(i), "r", "X"))
+	}
+	return proof.Or(branches...)
+}
+
+// validPoint embeds the choices with randomness derived from them, so that
+// every valid answer has a single plaintext.
+func validPoint(choices []uint32) kyber.Point {
+	data := EncodeBallot(choices)
+	return cothority.Suite.Point().Embed(data, cothority.Suite.XOF(data))
+}
+
+func equalChoices(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
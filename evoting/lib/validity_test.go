@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidBallots(t *testing.T) {
+	e := &Election{Candidates: []uint32{1, 2, 3}, MaxChoices: 2}
+	valid, err := e.validBallots()
+	require.Nil(t, err)
+	// The blank ballot, 3 single candidates and 3 pairs.
+	assert.Equal(t, 7, len(valid))
+
+	e.BallotType = Ranked
+	valid, err = e.validBallots()
+	require.Nil(t, err)
+	assert.Equal(t, 10, len(valid))
+
+	e.BallotType = Approval
+	valid, err = e.validBallots()
+	require.Nil(t, err)
+	assert.Equal(t, 8, len(valid))
+
+	e.BallotType = Ranked
+	e.Candidates = []uint32{1, 2, 3, 4, 5, 6, 7}
+	e.MaxChoices = 0
+	_, err = e.validBallots()
+	assert.NotNil(t, err)
+}
+
+func TestEncryptBallot(t *testing.T) {
+	x, X := RandomKeyPair()
+	e := &Election{
+		ID:         []byte{1, 2, 3},
+		Key:        X,
+		Candidates: []uint32{1, 2, 3},
+		MaxChoices: 2,
+	}
+
+	ballot, err := e.EncryptBallot(0, []uint32{3, 1})
+	require.Nil(t, err)
+	assert.Nil(t, e.VerifyBallot(ballot))
+	data, err := Decrypt(x, ballot.Alpha, ballot.Beta).Data()
+	require.Nil(t, err)
+	choices, err := DecodeBallot(data)
+	require.Nil(t, err)
+	assert.Equal(t, []uint32{1, 3}, choices)
+
+	_, err = e.EncryptBallot(0, []uint32{1, 2, 3})
+	assert.NotNil(t, err)
+	_, err = e.EncryptBallot(0, []uint32{4})
+	assert.NotNil(t, err)
+
+	// The proof is bound to the user.
+	ballot.User = 1
+	assert.NotNil(t, e.VerifyBallot(ballot))
+
+	// A ciphertext of an invalid answer can't be proven.
+	ballot.User = 0
+	ballot.Alpha, ballot.Beta = Encrypt(X, EncodeBallot([]uint32{1, 2, 3}))
+	assert.NotNil(t, e.VerifyBallot(ballot))
+
+	// Every question gets a proof.
+	e.Questions = []*Question{
+		{Candidates: []uint32{1, 2}, MaxChoices: 1},
+		{Candidates: []uint32{3, 4}, MaxChoices: 1},
+	}
+	ballot, err = e.EncryptBallot(0, []uint32{2}, []uint32{})
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(ballot.Proofs))
+	assert.Nil(t, e.VerifyBallot(ballot))
+}
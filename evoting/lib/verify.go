@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+// FetchElection retrieves an election from its skipchain over the network.
+// Unlike GetElection it doesn't need access to a local skipchain service, so
+// it can be used by clients and auditors.
+func FetchElection(roster *onet.Roster, id skipchain.SkipBlockID) (*Election, error) {
+	block, err := skipchain.NewClient().GetSingleBlockByIndex(roster, id, 1)
+	if err != nil {
+		return nil, err
+	}
+	transaction := UnmarshalTransaction(block.Data)
+	if transaction == nil || transaction.Election == nil {
+		return nil, fmt.Errorf("no election structure in %s", id.Short())
+	}
+	return transaction.Election, nil
+}
+
+// VerifyMixes reads the box and all the mixes of the election from its
+// skipchain and checks the shuffle proofs of every mix, for every question.
+// It allows anybody to verify the shuffle chain without relying on the flags
+// set by the conodes in their partial decryptions. For a homomorphic
+// election the aggregate of the ballots is checked instead.
+func VerifyMixes(election *Election) error {
+	box, err := election.Box()
+	if err != nil {
+		return err
+	}
+	mixes, err := election.Mixes()
+	if err != nil {
+		return err
+	}
+	if len(mixes) == 0 {
+		return errors.New("election not shuffled yet")
+	}
+	for _, ballot := range box.Ballots {
+		if len(ballot.Answers) != election.NumCiphertexts()-1 {
+			return fmt.Errorf("ballot of %d has the wrong number of answers", ballot.User)
+		}
+	}
+	if election.Homomorphic {
+		return election.VerifyAggregate(box, mixes)
+	}
+	return VerifyShuffles(election.Key, box, mixes)
+}
+
+// VerifyShuffles iteratively checks the proof of each mix against the box or
+// the previous mix, for every question of the ballots in the box. The
+// returned error tells which mix is wrong.
+func VerifyShuffles(key kyber.Point, box *Box, mixes []*Mix) error {
+	questions := 1
+	if len(box.Ballots) > 0 {
+		questions += len(box.Ballots[0].Answers)
+	}
+	ballots := box.Ballots
+	for i, mix := range mixes {
+		if len(mix.Ballots) != len(ballots) {
+			return fmt.Errorf("mix %d of %s has %d ballots instead of %d",
+				i, mix.Node, len(mix.Ballots), len(ballots))
+		}
+		for _, b := range mix.Ballots {
+			if len(b.Answers) != questions-1 {
+				return fmt.Errorf("mix %d of %s has the wrong number of answers", i, mix.Node)
+			}
+		}
+		for q := 0; q < questions; q++ {
+			x, y := SplitQuestion(ballots, q)
+			v, w := SplitQuestion(mix.Ballots, q)
+			if err := Verify(mix.QuestionProof(q), key, x, y, v, w); err != nil {
+				return fmt.Errorf("mix %d of %s, question %d: %v", i, mix.Node, q, err)
+			}
+		}
+		ballots = mix.Ballots
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyShuffles(t *testing.T) {
+	_, X := RandomKeyPair()
+	box := genBox(X, 3)
+
+	mixes := box.genMix(X, 3)
+	require.Nil(t, VerifyShuffles(X, box, mixes))
+
+	mixes[2].Proof = mixes[1].Proof
+	require.NotNil(t, VerifyShuffles(X, box, mixes))
+
+	mixes = box.genMix(X, 1)
+	mixes[0].Ballots[0], mixes[0].Ballots[1] = mixes[0].Ballots[1], mixes[0].Ballots[0]
+	require.NotNil(t, VerifyShuffles(X, box, mixes))
+
+	mixes = box.genMix(X, 1)
+	mixes[0].Ballots = mixes[0].Ballots[1:]
+	require.NotNil(t, VerifyShuffles(X, box, mixes))
+}
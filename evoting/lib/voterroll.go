@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// VoterRoll is the list of registered voters of an election, kept by the
+// election organizer. Only its Merkle root is stored in the election, so the
+// skipchain does not reveal who is allowed to vote. Every voter gets a secret
+// nonce, which keeps the users from being found by hashing all of them.
+type VoterRoll struct {
+	Users  []UserID
+	Nonces [][]byte
+}
+
+// voterNonceSize is the length of the nonces. As user identifiers have
+// different lengths, the leaves are only unambiguous for fixed nonces.
+const voterNonceSize = 32
+
+// VoterProof proves that a user is part of a voter roll. It is sent by the
+// voter with the ballot.
+type VoterProof struct {
+	Nonce []byte   // Nonce is the secret nonce of the voter.
+	Index int      // Index is the position of the voter in the roll.
+	Path  [][]byte // Path holds the sibling hashes from the leaf to the root.
+}
+
+// NewVoterRoll returns a voter roll with a random nonce for every sciper.
+func NewVoterRoll(users []uint32) (*VoterRoll, error) {
+	ids := make([]UserID, len(users))
+	for i, user := range users {
+		ids[i] = SciperID(user)
+	}
+	return NewVoterRollID(ids)
+}
+
+// NewVoterRollID returns a voter roll with a random nonce for every user.
+func NewVoterRollID(users []UserID) (*VoterRoll, error) {
+	r := &VoterRoll{Users: users, Nonces: make([][]byte, len(users))}
+	for i := range users {
+		r.Nonces[i] = make([]byte, voterNonceSize)
+		if _, err := rand.Read(r.Nonces[i]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Root returns the Merkle root of the voter roll, to be stored in
+// Election.VoterRoot.
+func (r *VoterRoll) Root() []byte {
+	levels := r.levels()
+	if levels == nil {
+		return nil
+	}
+	return levels[len(levels)-1][0]
+}
+
+// Proof returns the inclusion proof of a sciper.
+func (r *VoterRoll) Proof(user uint32) (*VoterProof, error) {
+	return r.ProofID(SciperID(user))
+}
+
+// ProofID returns the inclusion proof of a user.
+func (r *VoterRoll) ProofID(user UserID) (*VoterProof, error) {
+	index := -1
+	for i, u := range r.Users {
+		if u.Equal(user) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("user not in voter roll")
+	}
+
+	proof := &VoterProof{Nonce: r.Nonces[index], Index: index}
+	levels := r.levels()
+	for _, level := range levels[:len(levels)-1] {
+		proof.Path = append(proof.Path, level[index^1])
+		index /= 2
+	}
+	return proof, nil
+}
+
+// levels returns the levels of the Merkle tree, from the leaves to the root.
+// Levels with an odd number of nodes get a copy of their last node.
+func (r *VoterRoll) levels() [][][]byte {
+	if len(r.Users) == 0 {
+		return nil
+	}
+	level := make([][]byte, len(r.Users))
+	for i, user := range r.Users {
+		level[i] = voterLeaf(user, r.Nonces[i])
+	}
+	var levels [][][]byte
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		levels = append(levels, level)
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			next[i] = voterNode(level[2*i], level[2*i+1])
+		}
+		level = next
+	}
+	return append(levels, level)
+}
+
+// Verify returns nil if the proof shows that the sciper is part of the
+// voter roll with the given root.
+func (p *VoterProof) Verify(root []byte, user uint32) error {
+	return p.VerifyID(root, SciperID(user))
+}
+
+// VerifyID returns nil if the proof shows that the user is part of the
+// voter roll with the given root.
+func (p *VoterProof) VerifyID(root []byte, user UserID) error {
+	if p.Index < 0 {
+		return errors.New("invalid voter proof index")
+	}
+	if len(p.Nonce) != voterNonceSize {
+		return errors.New("invalid voter proof nonce")
+	}
+	h := voterLeaf(user, p.Nonce)
+	index := p.Index
+	for _, sibling := range p.Path {
+		if index%2 == 0 {
+			h = voterNode(h, sibling)
+		} else {
+			h = voterNode(sibling, h)
+		}
+		index /= 2
+	}
+	if index != 0 || !bytes.Equal(h, root) {
+		return errors.New("user not in voter roll")
+	}
+	return nil
+}
+
+// voterLeaf hashes a voter. The prefixes keep leaves and inner nodes from
+// being mistaken for one another.
+func voterLeaf(user UserID, nonce []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(user)
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+func voterNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
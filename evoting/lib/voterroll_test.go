@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoterRoll(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		users := make([]uint32, n)
+		for i := range users {
+			users[i] = uint32(100000 + i)
+		}
+		roll, err := NewVoterRoll(users)
+		require.Nil(t, err)
+		root := roll.Root()
+
+		for _, user := range users {
+			proof, err := roll.Proof(user)
+			require.Nil(t, err)
+			assert.Nil(t, proof.Verify(root, user))
+			assert.NotNil(t, proof.Verify(root, user+uint32(n)))
+
+			// A proof doesn't hold without the secret nonce of the voter.
+			nonce := proof.Nonce
+			proof.Nonce = make([]byte, len(nonce))
+			assert.NotNil(t, proof.Verify(root, user))
+			proof.Nonce = nonce
+		}
+		_, err = roll.Proof(0)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInVoterRoll(t *testing.T) {
+	roll, _ := NewVoterRoll([]uint32{1, 2, 3})
+	proof, _ := roll.Proof(2)
+
+	e := &Election{}
+	assert.NotNil(t, e.InVoterRoll(2, proof))
+	e.VoterRoot = roll.Root()
+	assert.Nil(t, e.InVoterRoll(2, proof))
+	assert.NotNil(t, e.InVoterRoll(3, proof))
+	assert.NotNil(t, e.InVoterRoll(2, nil))
+}
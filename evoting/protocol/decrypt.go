@@ -1,8 +1,12 @@
 package protocol
 
 import (
+	"errors"
+	"time"
+
 	"github.com/dedis/kyber"
 	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 
 	"github.com/dedis/cothority/evoting/lib"
@@ -12,16 +16,21 @@ import (
 Each participating node begins with verifying the integrity of each mix. If
 If all mixes are correct a partial decryption of the last mix is performed using
 the node's shared secret from the DKG. The result is the appended to the election
-skipchain before prompting the next node. A node sets a flag in its partial if it
-cannot verify all the mixes. The leaf node notifies the root upon completing its turn, which
-terminates the protocol.
+skipchain. A node sets a flag in its partial if it cannot verify all the mixes.
+
+The root decrypts first and then prompts the other nodes one after the other,
+waiting for each node to terminate its turn before prompting the next one. A
+node that is offline or doesn't answer within NodeTimeout is skipped, so that
+the ballots can be reconstructed as long as enough nodes, as given by the
+threshold of the DKG, stored their partial.
 
 Schema:
 
-        [Prompt]            [Prompt]            [Prompt]         [Terminate]
-  Root ------------> Node1 ------------> Node2 --> ... --> Leaf ------------> Root
+        [Prompt]            [Terminate]         [Prompt]            [Terminate]
+  Root ------------> Node1 ------------> Root ------------> Node2 ------------> Root ...
 
-The protocol can only be started by the election's creator and is non-repeatable.
+The protocol can only be started by the election's creator or admins and is
+non-repeatable.
 */
 
 // NameDecrypt is the protocol identifier string.
@@ -32,12 +41,17 @@ type Decrypt struct {
 	*onet.TreeNodeInstance
 
 	User      uint32
+	UserID    lib.UserID // UserID identifies the user instead of User if set.
 	Signature []byte
 
 	Secret   *lib.SharedSecret // Secret is the private key share from the DKG.
 	Election *lib.Election     // Election to be decrypted.
 
-	Finished chan bool // Flag to signal protocol termination.
+	// NodeTimeout is how long the root waits for a node to finish its turn.
+	NodeTimeout time.Duration
+
+	Finished   chan bool // Flag to signal protocol termination.
+	terminated chan bool // terminated signals the end of a node's turn to the root.
 }
 
 func init() {
@@ -47,23 +61,60 @@ func init() {
 
 // NewDecrypt initializes the protocol object and registers all the handlers.
 func NewDecrypt(node *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-	decrypt := &Decrypt{TreeNodeInstance: node, Finished: make(chan bool, 1)}
+	decrypt := &Decrypt{
+		TreeNodeInstance: node,
+		NodeTimeout:      20 * time.Second,
+		Finished:         make(chan bool, 1),
+		terminated:       make(chan bool, len(node.List())),
+	}
 	decrypt.RegisterHandlers(decrypt.HandlePrompt, decrypt.HandleTerminate)
 	return decrypt, nil
 }
 
-// Start is called on the root node prompting it to send itself a Prompt message.
+// Start is called on the root node. It performs its own partial decryption
+// and then prompts the other nodes.
 func (d *Decrypt) Start() error {
-	return d.HandlePrompt(MessagePromptDecrypt{d.TreeNode(), PromptDecrypt{}})
+	if err := d.decrypt(); err != nil {
+		return err
+	}
+	go d.promptAll()
+	return nil
+}
+
+// promptAll prompts the other nodes one after the other, skipping the ones
+// that don't answer.
+func (d *Decrypt) promptAll() {
+	defer d.finish()
+	for _, node := range d.List() {
+		if node.ID.Equal(d.TreeNode().ID) {
+			continue
+		}
+		if err := d.SendTo(node, &PromptDecrypt{}); err != nil {
+			log.Lvl2("skipping", node.ServerIdentity, "in decryption:", err)
+			continue
+		}
+		select {
+		case <-d.terminated:
+		case <-time.After(d.NodeTimeout):
+			log.Lvl2("skipping", node.ServerIdentity, "in decryption: timeout")
+		}
+	}
 }
 
-// HandlePrompt retrieves the mixes, verifies them and performs a partial decryption
-// on the last mix before appending it to the election skipchain.
+// HandlePrompt performs the partial decryption of the node and tells the root
+// that its turn is over, even if it failed.
 func (d *Decrypt) HandlePrompt(prompt MessagePromptDecrypt) error {
-	if !d.IsRoot() {
-		defer d.finish()
+	defer d.finish()
+	err := d.decrypt()
+	if errSend := d.SendTo(d.Root(), &TerminateDecrypt{}); errSend != nil && err == nil {
+		err = errSend
 	}
+	return err
+}
 
+// decrypt retrieves the mixes, verifies them and performs a partial
+// decryption on the last mix before appending it to the election skipchain.
+func (d *Decrypt) decrypt() error {
 	box, err := d.Election.Box()
 	if err != nil {
 		return err
@@ -72,24 +123,45 @@ func (d *Decrypt) HandlePrompt(prompt MessagePromptDecrypt) error {
 	if err != nil {
 		return err
 	}
-
-	last := mixes[len(mixes)-1].Ballots
-	points := make([]kyber.Point, len(box.Ballots))
-	for i := range points {
-		points[i] = lib.Decrypt(d.Secret.V, last[i].Alpha, last[i].Beta)
+	if len(mixes) == 0 {
+		return errors.New("no mixes to decrypt")
 	}
-
-	flag := Verify(d.Election.Key, box, mixes)
-	partial := &lib.Partial{Points: points, Flag: flag, Node: d.Name()}
-	transaction := lib.NewTransaction(partial, d.User, d.Signature)
-	if err = lib.StoreUsingWebsocket(d.Election.ID, d.Election.Roster, transaction); err != nil {
+	// The partial is already stored if the decryption is resumed.
+	partials, err := d.Election.Partials()
+	if err != nil {
 		return err
 	}
+	for _, p := range partials {
+		if p.Node == d.Name() {
+			return nil
+		}
+	}
 
-	if d.IsLeaf() {
-		return d.SendTo(d.Root(), &TerminateDecrypt{})
+	last := mixes[len(mixes)-1].Ballots
+	partial := &lib.Partial{
+		Flag:  Verify(d.Election.Key, box, mixes),
+		Node:  d.Name(),
+		Index: d.Secret.Index,
 	}
-	return d.SendToChildren(&PromptDecrypt{})
+	if d.Election.Homomorphic {
+		// Only the aggregate of the ballots is decrypted.
+		partial.Flag = d.Election.VerifyAggregate(box, mixes) == nil
+	}
+	for q := 0; q < d.Election.NumCiphertexts(); q++ {
+		alpha, beta := lib.SplitQuestion(last, q)
+		points := make([]kyber.Point, len(alpha))
+		for i := range points {
+			points[i] = lib.Decrypt(d.Secret.V, alpha[i], beta[i])
+		}
+		if q == 0 {
+			partial.Points = points
+		} else {
+			partial.Answers = append(partial.Answers, &lib.Points{Points: points})
+		}
+	}
+	transaction := lib.NewTransaction(partial, d.User, d.Signature)
+	transaction.UserID = d.UserID
+	return lib.StoreUsingWebsocket(d.Election.ID, d.Election.Roster, transaction)
 }
 
 // finish terminates the protocol within onet.
@@ -98,26 +170,14 @@ func (d *Decrypt) finish() {
 	d.Finished <- true
 }
 
-// HandleTerminate concludes to the protocol.
+// HandleTerminate tells the root that a node finished its turn.
 func (d *Decrypt) HandleTerminate(terminate MessageTerminateDecrypt) error {
-	d.finish()
+	d.terminated <- true
 	return nil
 }
 
-// Verify iteratively checks the integrity of each mix.
+// Verify iteratively checks the integrity of each mix, for every question
+// of the ballots in the box.
 func Verify(key kyber.Point, box *lib.Box, mixes []*lib.Mix) bool {
-	x, y := lib.Split(box.Ballots)
-	v, w := lib.Split(mixes[0].Ballots)
-	if lib.Verify(mixes[0].Proof, key, x, y, v, w) != nil {
-		return false
-	}
-
-	for i := 0; i < len(mixes)-1; i++ {
-		x, y = lib.Split(mixes[i].Ballots)
-		v, w = lib.Split(mixes[i+1].Ballots)
-		if lib.Verify(mixes[i+1].Proof, key, x, y, v, w) != nil {
-			return false
-		}
-	}
-	return true
+	return lib.VerifyShuffles(key, box, mixes) == nil
 }
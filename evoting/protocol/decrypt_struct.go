@@ -4,8 +4,8 @@ import (
 	"github.com/dedis/onet"
 )
 
-// PromptDecrypt is sent from node to node prompting the receiver to perform
-// their respective partial decryption of the last mix.
+// PromptDecrypt is sent from the root to a node prompting the receiver to
+// perform its partial decryption of the last mix.
 type PromptDecrypt struct{}
 
 // MessagePromptDecrypt is a wrapper around PromptDecrypt.
@@ -14,8 +14,8 @@ type MessagePromptDecrypt struct {
 	PromptDecrypt
 }
 
-// TerminateDecrypt is sent by the leaf node to the root node upon completion of
-// the last partial decryption, which terminates the protocol.
+// TerminateDecrypt is sent by a node to the root node upon completion of its
+// partial decryption, so that the root can prompt the next node.
 type TerminateDecrypt struct{}
 
 // MessageTerminateDecrypt is a wrapper around TerminateDecrypt.
@@ -33,6 +33,10 @@ type decryptService struct {
 
 func init() {
 	new := func(ctx *onet.Context) (onet.Service, error) {
+		// Box, Mixes and Partials ask for blocks with the evoting predicates.
+		for name, predicate := range lib.Predicates {
+			skipchain.RegisterPredicate(ctx, name, predicate)
+		}
 		return &decryptService{
 			ServiceProcessor: onet.NewServiceProcessor(ctx),
 			skipchain:        ctx.Service(skipchain.ServiceName).(*skipchain.Service),
@@ -123,9 +127,13 @@ func runDecrypt(t *testing.T, n int) {
 	select {
 	case <-decrypt.Finished:
 		partials, _ := election.Partials()
+		require.Equal(t, n, len(partials))
+		indexes := make(map[int]bool)
 		for _, partial := range partials {
 			require.True(t, partial.Flag)
+			indexes[partial.Index] = true
 		}
+		require.Equal(t, n, len(indexes))
 	case <-time.After(60 * time.Second):
 		assert.True(t, false)
 	}
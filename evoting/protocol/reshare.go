@@ -0,0 +1,246 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/evoting/lib"
+)
+
+/*
+The reshare protocol hands the shares of the election key over to a new
+roster, without changing the key. It runs on a tree holding the nodes of the
+new roster, with the leader as root. Threshold nodes of the current roster
+that are part of the new roster act as dealers, see lib.ReshareDeals.
+
+The root sends the public parameters of the current sharing to all nodes.
+Every dealer then sends a deal to every node, which verifies the deals and
+combines them into its new share before reporting to the root.
+
+Schema:
+
+        [StartReshare]              [DealReshare]              [ReplyReshare]
+  Root ---------------> Nodes   Dealers ----------> Nodes   Nodes ----------> Root
+
+The new shares are only used once the resharing has been recorded in the
+election skipchain.
+*/
+
+// NameReshare is the protocol identifier string.
+const NameReshare = "reshare"
+
+// Reshare is the core structure of the protocol.
+type Reshare struct {
+	*onet.TreeNodeInstance
+
+	Secret    *lib.SharedSecret // Secret is the current share of the node, if any.
+	Dealers   []int             // Dealers are the indexes of the dealing shares.
+	Threshold int
+
+	// NewSecret is the share of the node in the new roster.
+	NewSecret *lib.SharedSecret
+
+	// Finished is true on the root if all nodes got their new share, and on
+	// the other nodes if the node got its new share.
+	Finished chan bool
+
+	mutex   sync.Mutex
+	start   *StartReshare
+	deals   []*lib.ReshareDeal
+	replied bool
+	replies chan string
+}
+
+func init() {
+	network.RegisterMessages(StartReshare{}, DealReshare{}, ReplyReshare{})
+	onet.GlobalProtocolRegister(NameReshare, NewReshare)
+}
+
+// NewReshare initializes the protocol object and registers all the handlers.
+func NewReshare(node *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	reshare := &Reshare{
+		TreeNodeInstance: node,
+		Finished:         make(chan bool, 1),
+		replies:          make(chan string, len(node.List())),
+	}
+	err := reshare.RegisterHandlers(reshare.HandleStart, reshare.HandleDeal,
+		reshare.HandleReply)
+	if err != nil {
+		return nil, err
+	}
+	return reshare, nil
+}
+
+// Start is called on the root node, which has to hold a share. It sends the
+// parameters of the sharing to the other nodes and deals its share.
+func (r *Reshare) Start() error {
+	if r.Secret == nil {
+		return errors.New("reshare error: root without share")
+	}
+	start := &StartReshare{
+		Dealers:   r.Dealers,
+		Threshold: r.Threshold,
+		Commits:   r.Secret.Commits,
+		X:         r.Secret.X,
+	}
+	if errs := r.SendToChildrenInParallel(start); len(errs) > 0 {
+		return fmt.Errorf("reshare error: %v", errs)
+	}
+	go r.wait()
+	return r.begin(start)
+}
+
+// wait collects the replies of all nodes, including the root itself.
+func (r *Reshare) wait() {
+	defer r.Done()
+	ok := true
+	for range r.List() {
+		if reply := <-r.replies; reply != "" {
+			log.Lvl2("reshare failed:", reply)
+			ok = false
+		}
+	}
+	r.Finished <- ok
+}
+
+// HandleStart stores the parameters of the sharing and deals the share of
+// the node if it is a dealer.
+func (r *Reshare) HandleStart(msg MessageStartReshare) error {
+	if r.Secret != nil && !r.Secret.X.Equal(msg.X) {
+		return r.reply(errors.New("reshare error: not the key of the election"))
+	}
+	return r.begin(&msg.StartReshare)
+}
+
+// HandleDeal unblinds and stores the deal for this node.
+func (r *Reshare) HandleDeal(msg MessageDealReshare) error {
+	dh := cothority.Suite.Point().Mul(r.Private(), msg.Ephemeral)
+	deal := &lib.ReshareDeal{
+		Dealer:  msg.Dealer,
+		Commits: msg.Commits,
+		Share:   cothority.Suite.Scalar().Sub(msg.Share, mask(dh)),
+	}
+	return r.add(deal)
+}
+
+// HandleReply forwards the outcome of a node to the root.
+func (r *Reshare) HandleReply(msg MessageReplyReshare) error {
+	r.replies <- msg.Error
+	return nil
+}
+
+// begin stores the parameters and deals the share of a dealer.
+func (r *Reshare) begin(start *StartReshare) error {
+	r.mutex.Lock()
+	r.start = start
+	r.mutex.Unlock()
+
+	if r.Secret != nil {
+		for _, dealer := range start.Dealers {
+			if dealer == r.Secret.Index {
+				if err := r.deal(); err != nil {
+					return r.reply(err)
+				}
+				break
+			}
+		}
+	}
+	return r.add(nil)
+}
+
+// deal sends a deal to every node, blinding the share with the public key of
+// the receiver. The own deal is stored last, as it can terminate the node.
+func (r *Reshare) deal() error {
+	deals, err := r.Secret.ReshareDeals(r.start.Dealers, r.start.Threshold, len(r.Roster().List))
+	if err != nil {
+		return err
+	}
+	for _, node := range r.List() {
+		deal := deals[node.RosterIndex]
+		if node.ID.Equal(r.TreeNode().ID) {
+			continue
+		}
+		ephemeral := cothority.Suite.Scalar().Pick(cothority.Suite.RandomStream())
+		dh := cothority.Suite.Point().Mul(ephemeral, node.ServerIdentity.Public)
+		msg := &DealReshare{
+			Dealer:    deal.Dealer,
+			Commits:   deal.Commits,
+			Share:     cothority.Suite.Scalar().Add(deal.Share, mask(dh)),
+			Ephemeral: cothority.Suite.Point().Mul(ephemeral, nil),
+		}
+		if err := r.SendTo(node, msg); err != nil {
+			return err
+		}
+	}
+	return r.add(deals[r.TreeNode().RosterIndex])
+}
+
+// add stores a deal, which can arrive before the parameters, and combines
+// the new share once all deals are there. A nil deal only checks whether
+// the share can be combined.
+func (r *Reshare) add(deal *lib.ReshareDeal) error {
+	r.mutex.Lock()
+	if deal != nil {
+		r.deals = append(r.deals, deal)
+	}
+	if r.start == nil || r.replied || r.NewSecret != nil || len(r.deals) < len(r.start.Dealers) {
+		r.mutex.Unlock()
+		return nil
+	}
+	secret, err := r.combine()
+	r.NewSecret = secret
+	r.mutex.Unlock()
+	return r.reply(err)
+}
+
+// combine verifies the deals and returns the new share of the node.
+func (r *Reshare) combine() (*lib.SharedSecret, error) {
+	index := r.TreeNode().RosterIndex
+	for _, deal := range r.deals {
+		err := lib.VerifyReshareDeal(r.start.Commits, r.start.Dealers, r.start.Threshold,
+			index, deal)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lib.CombineReshare(r.start.X, index, r.deals)
+}
+
+// reply tells the root whether the node got its new share, and terminates
+// the protocol on the other nodes. Only the first outcome is reported.
+func (r *Reshare) reply(err error) error {
+	r.mutex.Lock()
+	replied := r.replied
+	r.replied = true
+	r.mutex.Unlock()
+	if replied {
+		return err
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if r.IsRoot() {
+		r.replies <- msg
+		return err
+	}
+	defer r.Done()
+	if errSend := r.SendTo(r.Root(), &ReplyReshare{Error: msg}); errSend != nil && err == nil {
+		err = errSend
+	}
+	r.Finished <- err == nil
+	return err
+}
+
+// mask derives the scalar blinding a share from a Diffie-Hellman key.
+func mask(dh kyber.Point) kyber.Scalar {
+	buf, _ := dh.MarshalBinary()
+	return cothority.Suite.Scalar().Pick(cothority.Suite.XOF(buf))
+}
@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+)
+
+// StartReshare is sent from the root to all nodes of the new roster with the
+// public parameters of the current sharing of the election key.
+type StartReshare struct {
+	Dealers   []int
+	Threshold int
+	Commits   []kyber.Point
+	X         kyber.Point
+}
+
+// MessageStartReshare is a wrapper around StartReshare.
+type MessageStartReshare struct {
+	*onet.TreeNode
+	StartReshare
+}
+
+// DealReshare is sent from a dealer to every node of the new roster. The
+// share is blinded with a key derived from the ephemeral Diffie-Hellman key
+// and the public key of the receiver.
+type DealReshare struct {
+	Dealer    int
+	Commits   []kyber.Point
+	Share     kyber.Scalar
+	Ephemeral kyber.Point
+}
+
+// MessageDealReshare is a wrapper around DealReshare.
+type MessageDealReshare struct {
+	*onet.TreeNode
+	DealReshare
+}
+
+// ReplyReshare is sent by a node to the root once it combined its new share,
+// with an error if it failed.
+type ReplyReshare struct {
+	Error string
+}
+
+// MessageReplyReshare is a wrapper around ReplyReshare.
+type MessageReplyReshare struct {
+	*onet.TreeNode
+	ReplyReshare
+}
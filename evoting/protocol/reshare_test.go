@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/evoting/lib"
+)
+
+var reshareServiceID onet.ServiceID
+
+type reshareService struct {
+	*onet.ServiceProcessor
+
+	secret  *lib.SharedSecret
+	reshare *Reshare
+}
+
+func init() {
+	new := func(ctx *onet.Context) (onet.Service, error) {
+		return &reshareService{ServiceProcessor: onet.NewServiceProcessor(ctx)}, nil
+	}
+	reshareServiceID, _ = onet.RegisterNewService(NameReshare, new)
+}
+
+func (s *reshareService) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericConfig) (
+	onet.ProtocolInstance, error) {
+
+	switch node.ProtocolName() {
+	case NameReshare:
+		instance, _ := NewReshare(node)
+		s.reshare = instance.(*Reshare)
+		s.reshare.Secret = s.secret
+		return s.reshare, nil
+	default:
+		return nil, errors.New("Unknown protocol")
+	}
+}
+
+func TestReshareProtocol(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodes, roster, _ := local.GenBigTree(5, 5, 1, true)
+	services := local.GetServices(nodes, reshareServiceID)
+
+	// The election runs on the first four nodes, the third one is replaced
+	// by the fifth.
+	current := onet.NewRoster(roster.List[:4])
+	dkgs, _ := lib.DKGSimulate(4, 3)
+	for i := range dkgs {
+		services[i].(*reshareService).secret, _ = lib.NewSharedSecret(dkgs[i])
+	}
+	X := services[0].(*reshareService).secret.X
+	K, C := lib.Encrypt(X, []byte("ballot"))
+
+	list := []*network.ServerIdentity{roster.List[0], roster.List[1], roster.List[3], roster.List[4]}
+	next := onet.NewRoster(list)
+	dealers := lib.ReshareDealers(current, next, 3)
+	require.Equal(t, []int{0, 1, 3}, dealers)
+
+	tree := next.GenerateNaryTree(len(next.List))
+	instance, _ := services[0].(*reshareService).CreateProtocol(NameReshare, tree)
+	reshare := instance.(*Reshare)
+	reshare.Secret = services[0].(*reshareService).secret
+	reshare.Dealers = dealers
+	reshare.Threshold = 3
+	require.Nil(t, reshare.Start())
+
+	select {
+	case ok := <-reshare.Finished:
+		require.True(t, ok)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "reshare timeout")
+	}
+
+	// The new shares, indexed by the new roster, decrypt the ballot.
+	partials := make([]*share.PubShare, len(list))
+	for j, i := range map[int]int{0: 0, 1: 1, 4: 3} {
+		secret := services[j].(*reshareService).reshare.NewSecret
+		require.NotNil(t, secret)
+		require.Equal(t, i, secret.Index)
+		partials[i] = &share.PubShare{I: i, V: lib.Decrypt(secret.V, K, C)}
+	}
+	M, err := share.RecoverCommit(cothority.Suite, partials, 3, len(list))
+	require.Nil(t, err)
+	data, err := M.Data()
+	require.Nil(t, err)
+	require.Equal(t, []byte("ballot"), data)
+}
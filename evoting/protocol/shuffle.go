@@ -27,7 +27,12 @@ Schema:
         [Prompt]            [Prompt]            [Prompt]         [Terminate]
   Root ------------> Node1 ------------> Node2 --> ... --> Leaf ------------> Root
 
-The protocol can only be started by the election's creator and is non-repeatable.
+If the election gives its mixers, the tree only holds the leader followed by
+the mixers in order, and the leader only shuffles if it is a mixer.
+
+The protocol can only be started by the election's creator or admins and is
+non-repeatable. A node whose mix is already stored only prompts the next node,
+so that a shuffle interrupted by a restart can be run again to complete it.
 */
 
 // NameShuffle is the protocol identifier string.
@@ -38,6 +43,7 @@ type Shuffle struct {
 	*onet.TreeNodeInstance
 
 	User      uint32
+	UserID    lib.UserID // UserID identifies the user instead of User if set.
 	Signature []byte
 	Election  *lib.Election // Election to be shuffled.
 
@@ -63,20 +69,41 @@ func (s *Shuffle) Start() error {
 
 // HandlePrompt retrieves, shuffles and stores the mix back on the skipchain.
 func (s *Shuffle) HandlePrompt(prompt MessagePrompt) error {
+	if !s.IsRoot() {
+		defer s.finish()
+	}
+	mixes, err := s.Election.Mixes()
+	if err != nil {
+		return err
+	}
+	stored := false
+	for _, mix := range mixes {
+		stored = stored || mix.Node == s.Name()
+	}
+	if !stored && s.Election.IsMixer(s.ServerIdentity()) {
+		if err := s.shuffle(mixes); err != nil {
+			return err
+		}
+	}
+
+	if s.IsLeaf() {
+		return s.SendTo(s.Root(), &TerminateShuffle{})
+	}
+	return s.SendToChildren(&PromptShuffle{})
+}
+
+// shuffle creates the mix of the node from the last mix, or from the box if
+// there is none yet, and stores it.
+func (s *Shuffle) shuffle(mixes []*lib.Mix) error {
 	var ballots []*lib.Ballot
-	if s.IsRoot() {
+	if len(mixes) == 0 {
 		box, err := s.Election.Box()
 		if err != nil {
 			return err
 		}
 		ballots = box.Ballots
 	} else {
-		mixes, err := s.Election.Mixes()
-		if err != nil {
-			return err
-		}
 		ballots = mixes[len(mixes)-1].Ballots
-		defer s.finish()
 	}
 
 	if len(ballots) < 2 {
@@ -84,22 +111,29 @@ func (s *Shuffle) HandlePrompt(prompt MessagePrompt) error {
 
 	}
 
-	a, b := lib.Split(ballots)
-	g, d, prov := shuffle.Shuffle(cothority.Suite, nil, s.Election.Key, a, b, random.New())
-	proof, err := proof.HashProve(cothority.Suite, "", prov)
-	if err != nil {
-		return err
+	// Every question is shuffled on its own, so that the answers of a voter
+	// cannot be linked together.
+	mix := &lib.Mix{Ballots: make([]*lib.Ballot, len(ballots)), Node: s.Name()}
+	for i := range mix.Ballots {
+		mix.Ballots[i] = &lib.Ballot{}
 	}
-	mix := &lib.Mix{Ballots: lib.Combine(g, d), Proof: proof, Node: s.Name()}
-	transaction := lib.NewTransaction(mix, s.User, s.Signature)
-	if err := lib.StoreUsingWebsocket(s.Election.ID, s.Election.Roster, transaction); err != nil {
-		return err
-	}
-
-	if s.IsLeaf() {
-		return s.SendTo(s.Root(), &TerminateShuffle{})
+	for q := 0; q < s.Election.NumCiphertexts(); q++ {
+		a, b := lib.SplitQuestion(ballots, q)
+		g, d, prov := shuffle.Shuffle(cothority.Suite, nil, s.Election.Key, a, b, random.New())
+		proof, err := proof.HashProve(cothority.Suite, "", prov)
+		if err != nil {
+			return err
+		}
+		lib.SetQuestion(mix.Ballots, q, g, d)
+		if q == 0 {
+			mix.Proof = proof
+		} else {
+			mix.Proofs = append(mix.Proofs, proof)
+		}
 	}
-	return s.SendToChildren(&PromptShuffle{})
+	transaction := lib.NewTransaction(mix, s.User, s.Signature)
+	transaction.UserID = s.UserID
+	return lib.StoreUsingWebsocket(s.Election.ID, s.Election.Roster, transaction)
 }
 
 // finish terminates the protocol within onet.
@@ -26,6 +26,10 @@ type shuffleService struct {
 
 func init() {
 	new := func(ctx *onet.Context) (onet.Service, error) {
+		// Box, Mixes and Partials ask for blocks with the evoting predicates.
+		for name, predicate := range lib.Predicates {
+			skipchain.RegisterPredicate(ctx, name, predicate)
+		}
 		return &shuffleService{
 			ServiceProcessor: onet.NewServiceProcessor(ctx),
 			skipchain:        ctx.Service(skipchain.ServiceName).(*skipchain.Service),
@@ -52,11 +56,21 @@ func (s *shuffleService) NewProtocol(n *onet.TreeNodeInstance, c *onet.GenericCo
 
 func TestShuffleProtocol(t *testing.T) {
 	for _, nodes := range []int{3, 5} {
-		runShuffle(t, nodes)
+		runShuffle(t, nodes, 1, 1)
 	}
 }
 
-func runShuffle(t *testing.T, n int) {
+func TestShuffleProtocol_Questions(t *testing.T) {
+	runShuffle(t, 3, 3, 1)
+}
+
+// TestShuffleProtocol_Resume runs the shuffle again once it is done, as after
+// a restart of the leader, which must not store any more mixes.
+func TestShuffleProtocol_Resume(t *testing.T) {
+	runShuffle(t, 3, 1, 2)
+}
+
+func runShuffle(t *testing.T, n, questions, runs int) {
 	local := onet.NewLocalTest(cothority.Suite)
 	defer local.CloseAll()
 
@@ -75,6 +89,12 @@ func runShuffle(t *testing.T, n int) {
 		Creator: 0,
 		Users:   []uint32{0, 1, 2},
 	}
+	if questions > 1 {
+		for q := 0; q < questions; q++ {
+			election.Questions = append(election.Questions,
+				&lib.Question{Candidates: []uint32{0, 1, 2}, MaxChoices: 1})
+		}
+	}
 	for i := range services {
 		services[i].(*shuffleService).election = election
 		services[i].(*shuffleService).user = 0
@@ -87,28 +107,46 @@ func runShuffle(t *testing.T, n int) {
 	for i := 0; i < 3; i++ {
 		a, b := lib.Encrypt(key, []byte{byte(i)})
 		ballot := &lib.Ballot{User: uint32(i), Alpha: a, Beta: b}
+		for q := 1; q < questions; q++ {
+			a, b = lib.Encrypt(key, []byte{byte(i), byte(q)})
+			ballot.Answers = append(ballot.Answers, &lib.Ciphertext{Alpha: a, Beta: b})
+		}
 		tx = lib.NewTransaction(ballot, election.Creator, []byte{})
 		lib.StoreUsingWebsocket(election.ID, election.Roster, tx)
 	}
 
-	instance, _ := services[0].(*shuffleService).CreateProtocol(NameShuffle, tree)
-	shuffle := instance.(*Shuffle)
-	shuffle.User = 0
-	shuffle.Signature = []byte{}
-	shuffle.Election = election
-	shuffle.Start()
+	var shuffle *Shuffle
+	for r := 0; r < runs; r++ {
+		if shuffle != nil {
+			select {
+			case <-shuffle.Finished:
+			case <-time.After(60 * time.Second):
+				t.Fatal("Protocol timeout")
+			}
+		}
+		instance, _ := services[0].(*shuffleService).CreateProtocol(NameShuffle, tree)
+		shuffle = instance.(*Shuffle)
+		shuffle.User = 0
+		shuffle.Signature = []byte{}
+		shuffle.Election = election
+		shuffle.Start()
+	}
 
 	select {
 	case <-shuffle.Finished:
 		box, _ := election.Box()
 		mixes, _ := election.Mixes()
 
-		in1, in2 := lib.Split(box.Ballots)
-		for i := range mixes {
-			out1, out2 := lib.Split(mixes[i].Ballots)
-			require.Nil(t, lib.Verify(mixes[i].Proof, election.Key, in1, in2, out1, out2))
-			in1, in2 = out1, out2
+		require.Equal(t, n, len(mixes))
+		for q := 0; q < questions; q++ {
+			in1, in2 := lib.SplitQuestion(box.Ballots, q)
+			for i := range mixes {
+				out1, out2 := lib.SplitQuestion(mixes[i].Ballots, q)
+				require.Nil(t, lib.Verify(mixes[i].QuestionProof(q), election.Key, in1, in2, out1, out2))
+				in1, in2 = out1, out2
+			}
 		}
+		require.True(t, Verify(election.Key, box, mixes))
 	case <-time.After(60 * time.Second):
 		t.Fatal("Protocol timeout")
 	}
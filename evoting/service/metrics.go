@@ -0,0 +1,97 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet"
+
+	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// metrics counts the activity of the service since the node started. They
+// are shown in the status report of the conode, so that the operators can
+// follow the health of the elections.
+type metrics struct {
+	sync.Mutex
+	ballots        map[string]int // ballots holds the ballots cast per election.
+	shuffle        time.Duration  // shuffle is the duration of the last shuffle.
+	decrypt        time.Duration  // decrypt is the duration of the last decryption.
+	appendFailures int            // appendFailures counts the refused blocks.
+	// progress holds the step of the elections being closed by the
+	// scheduler.
+	progress map[string]string
+}
+
+func newMetrics() *metrics {
+	return &metrics{ballots: make(map[string]int), progress: make(map[string]string)}
+}
+
+func (m *metrics) cast(id skipchain.SkipBlockID) {
+	m.Lock()
+	defer m.Unlock()
+	m.ballots[id.Short()]++
+}
+
+func (m *metrics) shuffled(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.shuffle = d
+}
+
+func (m *metrics) decrypted(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.decrypt = d
+}
+
+func (m *metrics) closing(id skipchain.SkipBlockID, step string) {
+	m.Lock()
+	defer m.Unlock()
+	m.progress[id.Short()] = step
+}
+
+func (m *metrics) closed(id skipchain.SkipBlockID) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.progress, id.Short())
+}
+
+func (m *metrics) appendFailed() {
+	m.Lock()
+	defer m.Unlock()
+	m.appendFailures++
+}
+
+// GetStatus returns the metrics of the service and the number of running
+// elections known to the node. The elections being closed by the scheduler
+// are shown with their current step.
+func (s *Service) GetStatus() *onet.Status {
+	s.metrics.Lock()
+	defer s.metrics.Unlock()
+	out := map[string]string{
+		"ActiveElections": strconv.Itoa(s.index.Count(lib.Running)),
+		"AppendFailures":  strconv.Itoa(s.metrics.appendFailures),
+		"LastShuffle":     s.metrics.shuffle.String(),
+		"LastDecrypt":     s.metrics.decrypt.String(),
+	}
+	for id, n := range s.metrics.ballots {
+		out["Ballots "+id] = strconv.Itoa(n)
+	}
+	for id, step := range s.metrics.progress {
+		out["Closing "+id] = step
+	}
+	return &onet.Status{Field: out}
+}
+
+// store appends the transaction to the skipchain, counting the failures.
+func (s *Service) store(id skipchain.SkipBlockID, transaction *lib.Transaction) (
+	skipchain.SkipBlockID, error) {
+	block, err := lib.Store(s.skipchain, id, transaction)
+	if err != nil {
+		s.metrics.appendFailed()
+	}
+	return block, err
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+
+	"github.com/dedis/cothority/evoting"
+	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// scheduleInterval is the time between two checks for ended elections.
+var scheduleInterval = time.Minute
+
+// testScheduleInterval is the time between two checks for ended test
+// elections, so that rehearsals don't wait for the next minute.
+var testScheduleInterval = 10 * time.Second
+
+// testRetention is how long a test election stays linked to the master
+// skipchain after its end.
+var testRetention = time.Hour
+
+// closeWorkers is the number of elections that are shuffled and decrypted
+// at the same time.
+var closeWorkers = 4
+
+// closing is a shuffle or decryption started by the leader. It is stored
+// until the handler returns, so that it can be resumed if the node stops in
+// between.
+type closing struct {
+	ID        skipchain.SkipBlockID
+	User      uint32
+	UserID    lib.UserID
+	Signature []byte
+	Decrypt   bool // Decrypt is false for a shuffle.
+}
+
+// schedule periodically resumes the interrupted shuffles and decryptions,
+// and closes the elections whose end date passed. Test elections are closed
+// and cleaned up more often. It waits for the first tick, so that the other
+// nodes had time to start after a restart.
+func (s *Service) schedule() {
+	all := time.Tick(scheduleInterval)
+	tests := time.Tick(testScheduleInterval)
+	for {
+		select {
+		case <-all:
+			s.resume()
+			s.closeElections(time.Now(), false)
+		case <-tests:
+			s.closeElections(time.Now(), true)
+			s.cleanTests(time.Now())
+		}
+	}
+}
+
+// begin stores a shuffle or decryption before it starts.
+func (s *Service) begin(c *closing) {
+	s.mutex.Lock()
+	s.storage.Closing[c.ID.Short()] = c
+	s.mutex.Unlock()
+	s.save()
+}
+
+// end removes a shuffle or decryption that returned from the storage.
+func (s *Service) end(id skipchain.SkipBlockID) {
+	s.mutex.Lock()
+	delete(s.storage.Closing, id.Short())
+	s.mutex.Unlock()
+	s.save()
+}
+
+// resume runs again the shuffles and decryptions that didn't return before
+// the node stopped, with the user and signature of their request. The
+// protocols skip the nodes whose mix or partial is already stored, so the
+// ones that were done are not repeated.
+func (s *Service) resume() {
+	s.mutex.Lock()
+	interrupted := s.interrupted
+	s.interrupted = nil
+	s.mutex.Unlock()
+
+	for _, c := range interrupted {
+		var err error
+		if c.Decrypt {
+			_, err = s.Decrypt(&evoting.Decrypt{ID: c.ID, User: c.User, UserID: c.UserID,
+				Signature: c.Signature})
+		} else {
+			_, err = s.Shuffle(&evoting.Shuffle{ID: c.ID, User: c.User, UserID: c.UserID,
+				Signature: c.Signature})
+		}
+		if err != nil {
+			log.Errorf("couldn't resume election %s: %v", c.ID.Short(), err)
+		}
+	}
+}
+
+// closeElections shuffles and decrypts all the elections of the master
+// skipchain that ended before now, or only the test elections if tests is
+// set. It only runs on the leader. The protocols are started with the user
+// and signature of the transaction that opened the election, which
+// authenticate its creator. An election that couldn't be closed, e.g.
+// because it has too few ballots, is not tried again. Up to closeWorkers
+// elections are closed in parallel, and it returns once all of them are
+// done.
+func (s *Service) closeElections(now time.Time, tests bool) {
+	if !s.leader() {
+		return
+	}
+	s.mutex.Lock()
+	id := s.storage.Master
+	s.mutex.Unlock()
+
+	master, err := lib.GetMaster(s.skipchain, id)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	links, err := master.Links(s.skipchain)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, closeWorkers)
+	for _, link := range links {
+		election, err := s.index.GetElection(s.skipchain, link.ID, false, nil)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		s.mutex.Lock()
+		failed := s.failed[link.ID.Short()]
+		s.mutex.Unlock()
+		if election.End > now.Unix() || election.Stage == lib.Decrypted || failed ||
+			(tests && !election.IsTest) {
+			continue
+		}
+		s.metrics.closing(election.ID, "waiting")
+		wg.Add(1)
+		go func(election *lib.Election) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			err := s.closeElection(election)
+			s.metrics.closed(election.ID)
+			if err != nil {
+				log.Errorf("couldn't close election %s: %v", election.ID.Short(), err)
+				s.mutex.Lock()
+				s.failed[election.ID.Short()] = true
+				s.mutex.Unlock()
+			}
+		}(election)
+	}
+	wg.Wait()
+}
+
+// closeElection runs the shuffle, if it hasn't been done yet, and the
+// decryption of the election.
+func (s *Service) closeElection(election *lib.Election) error {
+	transaction, err := s.opening(election.ID)
+	if err != nil {
+		return err
+	}
+	if election.Stage == lib.Running {
+		s.metrics.closing(election.ID, "shuffling")
+		_, err = s.Shuffle(&evoting.Shuffle{
+			ID:        election.ID,
+			User:      transaction.User,
+			Signature: transaction.Signature,
+			UserID:    transaction.UserID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	s.metrics.closing(election.ID, "decrypting")
+	_, err = s.Decrypt(&evoting.Decrypt{
+		ID:        election.ID,
+		User:      transaction.User,
+		Signature: transaction.Signature,
+		UserID:    transaction.UserID,
+	})
+	return err
+}
+
+// opening returns the transaction that opened the election, whose user and
+// signature authenticate the creator of the election.
+func (s *Service) opening(id skipchain.SkipBlockID) (*lib.Transaction, error) {
+	block, err := s.skipchain.GetSingleBlockByIndex(
+		&skipchain.GetSingleBlockByIndex{Genesis: id, Index: 1},
+	)
+	if err != nil {
+		return nil, err
+	}
+	transaction := lib.UnmarshalTransaction(block.Data)
+	if transaction == nil || transaction.Election == nil {
+		return nil, fmt.Errorf("no election structure in %s", id.Short())
+	}
+	return transaction, nil
+}
+
+// cleanTests unlinks the test elections that ended more than testRetention
+// ago from the master skipchain, with the user and signature of the
+// transaction that opened them, which only the leader does. All nodes then
+// forget the secrets of the unlinked elections.
+func (s *Service) cleanTests(now time.Time) {
+	s.mutex.Lock()
+	id := s.storage.Master
+	s.mutex.Unlock()
+	if id == nil {
+		return
+	}
+	master, err := lib.GetMaster(s.skipchain, id)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if s.leader() {
+		links, err := master.Links(s.skipchain)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		for _, link := range links {
+			election, err := s.index.GetElection(s.skipchain, link.ID, false, nil)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if !election.IsTest || election.End+int64(testRetention.Seconds()) > now.Unix() {
+				continue
+			}
+			transaction, err := s.opening(election.ID)
+			if err == nil {
+				err = s.unlink(master.ID, election.ID, transaction.User, transaction.UserID,
+					transaction.Signature)
+			}
+			if err != nil {
+				log.Errorf("couldn't unlink test election %s: %v", election.ID.Short(), err)
+			}
+		}
+	}
+	unlinked, err := master.Unlinked(s.skipchain)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, link := range unlinked {
+		s.forget(link.ID)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/share"
 	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
@@ -32,13 +33,21 @@ import (
 var errOnlyLeader = errors.New("operation only allowed on the leader node")
 
 func init() {
-	network.RegisterMessages(synchronizer{}, storage{})
+	network.RegisterMessages(synchronizer{}, storage{}, closing{})
 	serviceID, _ = onet.RegisterNewService(evoting.ServiceName, new)
 }
 
 // timeout for protocol termination.
 const timeout = 60 * time.Second
 
+// castRate is the number of ballots per second that can be cast in an
+// election, and castBurst the number of ballots that can be cast at once.
+var castRate, castBurst = 50.0, 200.0
+
+// snapshotInterval is the number of ballots after which the box is stored
+// in the election skipchain.
+var snapshotInterval = 100
+
 // serviceID is the onet identifier.
 var serviceID onet.ServiceID
 
@@ -55,6 +64,29 @@ type Service struct {
 	storage *storage
 
 	pin string // pin is the current service number.
+
+	failed map[string]bool // failed holds the elections the scheduler couldn't close.
+
+	// interrupted holds the shuffles and decryptions that were running when
+	// the node stopped, until the scheduler resumes them.
+	interrupted []*closing
+
+	index *lib.Index // index holds the stage and the voters of the elections.
+
+	castMutex sync.Mutex
+	casts     map[string]*casts // casts caches the ballots cast in each election.
+
+	metrics *metrics // metrics are shown in the status of the node.
+}
+
+// casts holds the number of ballots of every user in an election up to a
+// block, and the state of the rate limiting of the election.
+type casts struct {
+	ballots map[string]int
+	chain   *skipchain.Chain // chain returns the blocks not counted yet.
+
+	tokens float64   // tokens is the number of casts allowed right now.
+	refill time.Time // refill is the time tokens was updated.
 }
 
 // Storage saves the shared secrets and stages for each election on disk.
@@ -62,6 +94,21 @@ type storage struct {
 	Roster  *onet.Roster
 	Master  skipchain.SkipBlockID
 	Secrets map[string]*lib.SharedSecret
+	// Reshared holds the shares received in a resharing until the election
+	// skipchain moved to the new roster.
+	Reshared map[string]*reshared
+	// Closing holds the shuffles and decryptions started by the leader that
+	// didn't return yet.
+	Closing map[string]*closing
+
+	// ReceiptKey signs the receipts of the cast ballots.
+	ReceiptKey *key.Pair
+}
+
+// reshared is a share of the election key for a new roster.
+type reshared struct {
+	Secret *lib.SharedSecret
+	Roster *onet.Roster
 }
 
 // synchronizer is broadcasted to all roster nodes before every protocol.
@@ -69,6 +116,7 @@ type synchronizer struct {
 	ID        skipchain.SkipBlockID
 	User      uint32
 	Signature []byte
+	UserID    lib.UserID
 }
 
 // Ping message handler.
@@ -93,10 +141,12 @@ func (s *Service) Link(req *evoting.Link) (*evoting.LinkReply, error) {
 		if genesis == nil {
 			return nil, errors.New("cannot find master chain to update")
 		}
-		if req.User == nil || req.Signature == nil {
+		if (req.User == nil && req.UserID == nil) || req.Signature == nil {
 			return nil, errors.New("missing user or sig")
 		}
-		user = *req.User
+		if req.User != nil {
+			user = *req.User
+		}
 		sig = *req.Signature
 	} else {
 		var err error
@@ -107,14 +157,16 @@ func (s *Service) Link(req *evoting.Link) (*evoting.LinkReply, error) {
 	}
 
 	master := &lib.Master{
-		ID:     genesis.Hash,
-		Roster: req.Roster,
-		Admins: req.Admins,
-		Key:    req.Key,
+		ID:        genesis.Hash,
+		Roster:    req.Roster,
+		Admins:    req.Admins,
+		Key:       req.Key,
+		AdminKeys: req.AdminKeys,
+		AdminIDs:  req.AdminIDs,
 	}
-	transaction := lib.NewTransaction(master, user, sig)
+	transaction := newTransaction(master, user, req.UserID, sig)
 
-	if _, err := lib.Store(s.skipchain, master.ID, transaction); err != nil {
+	if _, err := s.store(master.ID, transaction); err != nil {
 		return nil, err
 	}
 
@@ -127,6 +179,31 @@ func (s *Service) Link(req *evoting.Link) (*evoting.LinkReply, error) {
 	return &evoting.LinkReply{ID: genesis.Hash}, nil
 }
 
+// Rotate message handler. Replace the master with one signed by the admin
+// keys of the current master.
+func (s *Service) Rotate(req *evoting.Rotate) (*evoting.RotateReply, error) {
+	if req.Rotation == nil || req.Rotation.Master == nil {
+		return nil, errors.New("rotate error: missing master")
+	}
+	if s.db().GetByID(req.ID) == nil {
+		return nil, errors.New("cannot find master chain to update")
+	}
+
+	transaction := lib.NewTransaction(req.Rotation, 0, []byte{})
+	if _, err := s.store(req.ID, transaction); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	if s.storage.Master.Equal(req.ID) {
+		s.storage.Roster = req.Rotation.Master.Roster
+	}
+	s.mutex.Unlock()
+	s.save()
+
+	return &evoting.RotateReply{}, nil
+}
+
 // Open message hander. Create a new election with accompanying skipchain.
 func (s *Service) Open(req *evoting.Open) (*evoting.OpenReply, error) {
 	master, err := lib.GetMaster(s.skipchain, req.ID)
@@ -149,12 +226,23 @@ func (s *Service) Open(req *evoting.Open) (*evoting.OpenReply, error) {
 		return nil, errors.New("error while creating the tree")
 	}
 
+	n := len(master.Roster.List)
+	threshold := req.Election.Threshold
+	if threshold == 0 {
+		threshold = lib.DefaultThreshold(n)
+	}
+	if threshold < (n+1)/2 || threshold > n {
+		return nil, errors.New("open error: invalid threshold")
+	}
+
 	instance, _ := s.CreateProtocol(protocol.NameDKG, tree)
 	protocol := instance.(*protocol.SetupDKG)
+	protocol.Threshold = uint32(threshold)
 	config, _ := network.Marshal(&synchronizer{
 		ID:        genesis.Hash,
 		User:      req.User,
 		Signature: req.Signature,
+		UserID:    req.UserID,
 	})
 	protocol.SetConfig(&onet.GenericConfig{Data: config})
 
@@ -169,19 +257,24 @@ func (s *Service) Open(req *evoting.Open) (*evoting.OpenReply, error) {
 		req.Election.Roster = master.Roster
 		req.Election.Key = secret.X
 		req.Election.MasterKey = master.Key
+		req.Election.Threshold = threshold
 		// req.User is untrusted in this moment, but lib.Store below will refuse to write
 		// req.Election into the skipchain if req.User+req.Signature is not valid,
 		// so IF it is written, then it is trusted.
 		req.Election.Creator = req.User
+		req.Election.CreatorID = req.UserID
 
-		transaction := lib.NewTransaction(req.Election, req.User, req.Signature)
-		if _, err := lib.Store(s.skipchain, req.Election.ID, transaction); err != nil {
+		transaction := newTransaction(req.Election, req.User, req.UserID, req.Signature)
+		if _, err := s.store(req.Election.ID, transaction); err != nil {
+			return nil, err
+		}
+		if err := s.audit(req.Election.ID, lib.AuditOpen, req.User, req.UserID, req.Signature); err != nil {
 			return nil, err
 		}
 
 		link := &lib.Link{ID: genesis.Hash}
-		transaction = lib.NewTransaction(link, req.User, req.Signature)
-		if _, err := lib.Store(s.skipchain, master.ID, transaction); err != nil {
+		transaction = newTransaction(link, req.User, req.UserID, req.Signature)
+		if _, err := s.store(master.ID, transaction); err != nil {
 			return nil, err
 		}
 
@@ -263,23 +356,118 @@ func (s *Service) Cast(req *evoting.Cast) (*evoting.CastReply, error) {
 	if !s.leader() {
 		return nil, errOnlyLeader
 	}
-	transaction := lib.NewTransaction(req.Ballot, req.User, req.Signature)
-	skipblockID, err := lib.Store(s.skipchain, req.ID, transaction)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.allowCast(election, lib.ResolveUser(req.User, req.UserID), true); err != nil {
+		return nil, err
+	}
+	if req.Ballot != nil {
+		req.Ballot.Time = time.Now().Unix()
+	}
+	transaction := newTransaction(req.Ballot, req.User, req.UserID, req.Signature)
+	transaction.DarcSignature = req.DarcSignature
+	transaction.VoterProof = req.VoterProof
+	skipblockID, err := s.store(req.ID, transaction)
 	if err != nil {
 		return nil, err
 	}
-	return &evoting.CastReply{ID: skipblockID}, nil
+	s.metrics.cast(req.ID)
+	s.snapshot(req.ID)
+
+	kp := s.receiptKey()
+	receipt, err := lib.NewReceipt(req.ID, skipblockID, req.Ballot, kp.Public, kp.Private)
+	if err != nil {
+		return nil, err
+	}
+	return &evoting.CastReply{ID: skipblockID, Receipt: receipt}, nil
+}
+
+// PreflightCast message handler. Check a ballot like Cast, including the
+// eligibility of the user, the stage and dates of the election and the
+// ciphertexts, without storing it. Frontends can so tell the voter what is
+// wrong before the ballot goes through the consensus of the roster. The check
+// doesn't count for the rate of casts of the election.
+func (s *Service) PreflightCast(req *evoting.PreflightCast) (*evoting.PreflightCastReply, error) {
+	if !s.leader() {
+		return nil, errOnlyLeader
+	}
+	if req.Ballot == nil {
+		return nil, errors.New("cast error: missing ballot")
+	}
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.allowCast(election, lib.ResolveUser(req.User, req.UserID), false); err != nil {
+		return nil, err
+	}
+	ballot := *req.Ballot
+	ballot.Time = time.Now().Unix()
+	transaction := newTransaction(&ballot, req.User, req.UserID, req.Signature)
+	transaction.DarcSignature = req.DarcSignature
+	transaction.VoterProof = req.VoterProof
+	if err := transaction.Verify(req.ID, s.skipchain); err != nil {
+		return nil, err
+	}
+	return &evoting.PreflightCastReply{}, nil
+}
+
+// receiptKey returns the key pair signing the receipts, creating it the
+// first time.
+func (s *Service) receiptKey() *key.Pair {
+	s.mutex.Lock()
+	kp := s.storage.ReceiptKey
+	created := kp == nil
+	if created {
+		kp = key.NewKeyPair(cothority.Suite)
+		s.storage.ReceiptKey = kp
+	}
+	s.mutex.Unlock()
+	if created {
+		s.save()
+	}
+	return kp
+}
+
+// snapshot stores the current box in the election skipchain if enough
+// ballots were cast since the last snapshot. Failing to do so is not fatal,
+// as the box can always be computed from the ballots.
+func (s *Service) snapshot(id skipchain.SkipBlockID) {
+	election, err := s.index.GetElection(s.skipchain, id, false, nil)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	box, pending, err := election.LocalBox(s.skipchain)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if pending < snapshotInterval {
+		return
+	}
+	if _, err = s.store(id, lib.NewTransaction(box, 0, nil)); err != nil {
+		log.Error("couldn't store snapshot:", err)
+	}
 }
 
 // GetElections message handler. Return all elections in which the given user participates.
 // If signature does not match the username, then only the Master structure is returned.
+// The elections are filtered by stage, Running for the open elections, Shuffled for the
+// closed and Decrypted for the finished ones, and then paginated. Both the links and the
+// elections are taken from the index.
 func (s *Service) GetElections(req *evoting.GetElections) (*evoting.GetElectionsReply, error) {
+	if req.Offset < 0 || req.Count < 0 {
+		return nil, errors.New("invalid offset or count")
+	}
 	master, err := lib.GetMaster(s.skipchain, req.Master)
 	if err != nil {
 		return nil, err
 	}
 
-	links, err := master.Links(s.skipchain)
+	links, err := s.index.Links(s.skipchain, master.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -290,11 +478,8 @@ func (s *Service) GetElections(req *evoting.GetElections) (*evoting.GetElections
 	// (->skipchain.StoreSkipblock->verifier) to check the userID
 	// signature for us, but since GetElections is a read-only method,
 	// there is no call to lib.Store to check req.User for us.
-	digest := master.ID
-	for _, c := range strconv.Itoa(int(req.User)) {
-		d, _ := strconv.Atoi(string(c))
-		digest = append(digest, byte(d))
-	}
+	digest := lib.UserDigest(master.ID, req.User, req.UserID)
+	user := lib.ResolveUser(req.User, req.UserID)
 	userValid := true
 	err = schnorr.Verify(cothority.Suite, master.Key, digest, req.Signature)
 	if err != nil {
@@ -304,12 +489,13 @@ func (s *Service) GetElections(req *evoting.GetElections) (*evoting.GetElections
 	elections := make([]*lib.Election, 0)
 	if userValid {
 		for _, l := range links {
-			election, err := lib.GetElection(s.skipchain, l.ID, req.CheckVoted, req.User)
+			election, err := s.index.GetElection(s.skipchain, l.ID, req.CheckVoted, user)
 			if err != nil {
 				return nil, err
 			}
-			// Check if user is a voter or election creator.
-			if election.IsUser(req.User) || election.IsCreator(req.User) {
+			// Check if user is a voter or election admin.
+			if election.IsUserID(user) || election.IsAdminID(user) ||
+				election.Darc != nil || election.VoterRoot != nil {
 				// Filter the election by Stage. 0 denotes no filtering.
 				if req.Stage == 0 || req.Stage == election.Stage {
 					elections = append(elections, election)
@@ -317,30 +503,251 @@ func (s *Service) GetElections(req *evoting.GetElections) (*evoting.GetElections
 			}
 		}
 	}
-	out := &evoting.GetElectionsReply{Elections: elections, Master: *master}
+	total := len(elections)
+	if req.Offset > total {
+		return nil, errors.New("invalid offset or count")
+	}
+	end := total
+	if req.Count > 0 && req.Offset+req.Count < total {
+		end = req.Offset + req.Count
+	}
+	out := &evoting.GetElectionsReply{Elections: elections[req.Offset:end], Master: *master,
+		Total: total}
 	if userValid {
-		out.IsAdmin = master.IsAdmin(req.User)
+		out.IsAdmin = master.IsAdminID(user)
 	}
 	return out, nil
 }
 
+// PurgeTests message handler. Unlink all the test elections from the master
+// skipchain, so that they don't show up anymore.
+func (s *Service) PurgeTests(req *evoting.PurgeTests) (*evoting.PurgeTestsReply, error) {
+	if !s.leader() {
+		return nil, errOnlyLeader
+	}
+	master, err := lib.GetMaster(s.skipchain, req.Master)
+	if err != nil {
+		return nil, err
+	}
+	digest := lib.UserDigest(master.ID, req.User, req.UserID)
+	if err := schnorr.Verify(cothority.Suite, master.Key, digest, req.Signature); err != nil {
+		return nil, errors.New("purge error: invalid signature")
+	}
+	if !master.IsAdminID(lib.ResolveUser(req.User, req.UserID)) {
+		return nil, errors.New("purge error: user not admin")
+	}
+	links, err := master.Links(s.skipchain)
+	if err != nil {
+		return nil, err
+	}
+	reply := &evoting.PurgeTestsReply{}
+	for _, link := range links {
+		election, err := s.index.GetElection(s.skipchain, link.ID, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !election.IsTest {
+			continue
+		}
+		if err := s.unlink(master.ID, link.ID, req.User, req.UserID, req.Signature); err != nil {
+			return nil, err
+		}
+		reply.Purged = append(reply.Purged, link.ID)
+	}
+	return reply, nil
+}
+
+// unlink removes the test election from the master skipchain and forgets
+// its secret.
+func (s *Service) unlink(master, id skipchain.SkipBlockID, user uint32, userID lib.UserID,
+	signature []byte) error {
+	link := &lib.Link{ID: id, Unlink: true}
+	if _, err := s.store(master, newTransaction(link, user, userID, signature)); err != nil {
+		return err
+	}
+	s.forget(id)
+	return nil
+}
+
+// forget removes all the state kept about an unlinked election.
+func (s *Service) forget(id skipchain.SkipBlockID) {
+	s.index.Invalidate(id)
+	s.castMutex.Lock()
+	delete(s.casts, id.Short())
+	s.castMutex.Unlock()
+	s.mutex.Lock()
+	_, found := s.storage.Secrets[id.Short()]
+	delete(s.storage.Secrets, id.Short())
+	delete(s.failed, id.Short())
+	s.mutex.Unlock()
+	if found {
+		s.save()
+	}
+}
+
+// Redact message handler. Record on the election skipchain that the voter
+// data is redacted, after which every node only keeps the salted hashes of
+// the users in its indexes.
+func (s *Service) Redact(req *evoting.Redact) (*evoting.RedactReply, error) {
+	if !s.leader() {
+		return nil, errOnlyLeader
+	}
+
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if election.Stage != lib.Decrypted {
+		return nil, errors.New("redact error: election not decrypted yet")
+	} else if election.Redacted {
+		return nil, errors.New("redact error: election already redacted")
+	} else if time.Now().Unix() < election.End+election.Retention {
+		return nil, errors.New("redact error: retention period not over")
+	}
+	redaction, err := election.NewRedaction(s.skipchain)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.store(req.ID, newTransaction(redaction, req.User, req.UserID, req.Signature))
+	if err != nil {
+		return nil, err
+	}
+	return &evoting.RedactReply{Block: block, Redaction: redaction}, nil
+}
+
 // GetBox message handler to retrieve the casted ballot in an election.
 func (s *Service) GetBox(req *evoting.GetBox) (*evoting.GetBoxReply, error) {
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	box, _, err := election.LocalBox(s.skipchain)
+	if err != nil {
+		return nil, err
+	}
+	total := len(box.Ballots)
+	if req.Offset < 0 || req.Count < 0 || req.Offset > total {
+		return nil, errors.New("invalid offset or count")
+	}
+	end := total
+	if req.Count > 0 && req.Offset+req.Count < total {
+		end = req.Offset + req.Count
+	}
+	box.Ballots = box.Ballots[req.Offset:end]
+	if election.Redacted {
+		// Ballots of the same user keep sharing their user, so that the
+		// box can still be counted and checked against the mixes.
+		for i, ballot := range box.Ballots {
+			redacted := *ballot
+			redacted.User = 0
+			redacted.UserID = s.index.Redact(election.ID, ballot.GetUser())
+			box.Ballots[i] = &redacted
+		}
+	}
+	return &evoting.GetBoxReply{Box: box, Total: total}, nil
+}
+
+// GetTurnout message handler. Return the number of users who voted, without
+// revealing anything about the ballots. Only the blocks appended since the
+// last request are read.
+func (s *Service) GetTurnout(req *evoting.GetTurnout) (*evoting.GetTurnoutReply, error) {
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	box, err := election.Box()
+	s.castMutex.Lock()
+	defer s.castMutex.Unlock()
+	c := s.countCasts(req.ID)
+	users := len(election.Users) + len(election.UserIDs) + election.VoterCount
+	return &evoting.GetTurnoutReply{Voters: len(c.ballots), Users: users}, nil
+}
+
+// GetCountedBallot message handler. Return the ballot of a user that is
+// counted in the election, so that the voter can find it among the receipts.
+func (s *Service) GetCountedBallot(req *evoting.GetCountedBallot) (*evoting.GetCountedBallotReply, error) {
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if election.Redacted {
+		return nil, errors.New("voter data of the election is redacted")
+	}
+	block, ballot, err := election.CountedBallot(s.skipchain, lib.ResolveUser(req.User, req.UserID))
 	if err != nil {
 		return nil, err
 	}
-	return &evoting.GetBoxReply{Box: box}, nil
+	return &evoting.GetCountedBallotReply{Block: block, Ballot: ballot}, nil
+}
+
+// countCasts returns the casts of the election, after counting the ballots
+// in the blocks appended since the last call. castMutex must be held.
+func (s *Service) countCasts(id skipchain.SkipBlockID) *casts {
+	c, ok := s.casts[id.Short()]
+	if !ok {
+		c = &casts{ballots: make(map[string]int), tokens: castBurst, refill: time.Now()}
+		s.casts[id.Short()] = c
+	}
+
+	if c.chain == nil {
+		c.chain = skipchain.NewChain(s.db(), id)
+	}
+	for block := c.chain.Next(); block != nil; block = c.chain.Next() {
+		transaction := lib.UnmarshalTransaction(block.Data)
+		if transaction != nil && transaction.Ballot != nil {
+			c.ballots[string(transaction.Ballot.GetUser())]++
+		}
+		if transaction != nil && transaction.Redaction != nil {
+			ballots := make(map[string]int, len(c.ballots))
+			for user, n := range c.ballots {
+				ballots[string(s.index.Redact(id, lib.UserID(user)))] = n
+			}
+			c.ballots = ballots
+		}
+	}
+	if err := c.chain.Err(); err != nil {
+		// Count all the ballots again at the next call.
+		log.Error("counting casts:", err)
+		c.ballots = make(map[string]int)
+		c.chain = nil
+	}
+	return c
+}
+
+// allowCast returns an error if the election got too many casts lately, or
+// if the user cast all the allowed ballots. Only a cast that is consumed
+// counts for the rate of the election.
+func (s *Service) allowCast(election *lib.Election, user lib.UserID, consume bool) error {
+	s.castMutex.Lock()
+	defer s.castMutex.Unlock()
+	c := s.countCasts(election.ID)
+	if !consume {
+		if election.MaxBallots > 0 && c.ballots[string(user)] >= election.MaxBallots {
+			return errors.New("cast error: user cast too many ballots")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	c.tokens += now.Sub(c.refill).Seconds() * castRate
+	if c.tokens > castBurst {
+		c.tokens = castBurst
+	}
+	c.refill = now
+	if c.tokens < 1 {
+		return errors.New("cast error: too many ballots, try again later")
+	}
+	if election.MaxBallots > 0 && c.ballots[string(user)] >= election.MaxBallots {
+		return errors.New("cast error: user cast too many ballots")
+	}
+	c.tokens--
+	return nil
 }
 
 // GetMixes message handler. Vet all created mixes.
 func (s *Service) GetMixes(req *evoting.GetMixes) (*evoting.GetMixesReply, error) {
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -354,7 +761,7 @@ func (s *Service) GetMixes(req *evoting.GetMixes) (*evoting.GetMixesReply, error
 
 // GetPartials message handler. Vet all created partial decryptions.
 func (s *Service) GetPartials(req *evoting.GetPartials) (*evoting.GetPartialsReply, error) {
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -372,12 +779,52 @@ func (s *Service) Shuffle(req *evoting.Shuffle) (*evoting.ShuffleReply, error) {
 		return nil, errOnlyLeader
 	}
 
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.audit(req.ID, lib.AuditShuffle, req.User, req.UserID, req.Signature); err != nil {
+		return nil, err
+	}
+	s.begin(&closing{ID: req.ID, User: req.User, UserID: req.UserID, Signature: req.Signature})
+	defer s.end(req.ID)
+
+	if election.Homomorphic {
+		// The ballots are added up instead of shuffled, which every node
+		// checks when storing the aggregate.
+		start := time.Now()
+		box, _, err := election.LocalBox(s.skipchain)
+		if err != nil {
+			return nil, err
+		}
+		mix := &lib.Mix{
+			Ballots: []*lib.Ballot{election.Aggregate(election.Counted(box))},
+			Node:    s.ServerIdentity().String(),
+		}
+		if _, err := s.store(req.ID, newTransaction(mix, req.User, req.UserID, req.Signature)); err != nil {
+			return nil, err
+		}
+		s.metrics.shuffled(time.Since(start))
+		return &evoting.ShuffleReply{}, nil
+	}
+
 	rooted := election.Roster.NewRosterWithRoot(s.ServerIdentity())
+	if len(election.Mixers) > 0 {
+		// The leader starts the protocol, but only shuffles if it is the
+		// first mixer.
+		mixers, err := election.MixNodes()
+		if err != nil {
+			return nil, err
+		}
+		list := []*network.ServerIdentity{s.ServerIdentity()}
+		for _, si := range mixers {
+			if !si.Equal(s.ServerIdentity()) {
+				list = append(list, si)
+			}
+		}
+		rooted = onet.NewRoster(list)
+	}
 	tree := rooted.GenerateNaryTree(1)
 	if tree == nil {
 		return nil, errors.New("failed to generate tree")
@@ -386,6 +833,7 @@ func (s *Service) Shuffle(req *evoting.Shuffle) (*evoting.ShuffleReply, error) {
 	instance, _ := s.CreateProtocol(protocol.NameShuffle, tree)
 	protocol := instance.(*protocol.Shuffle)
 	protocol.User = req.User
+	protocol.UserID = req.UserID
 	protocol.Signature = req.Signature
 	protocol.Election = election
 
@@ -393,13 +841,16 @@ func (s *Service) Shuffle(req *evoting.Shuffle) (*evoting.ShuffleReply, error) {
 		ID:        req.ID,
 		User:      req.User,
 		Signature: req.Signature,
+		UserID:    req.UserID,
 	})
 	protocol.SetConfig(&onet.GenericConfig{Data: config})
+	start := time.Now()
 	if err = protocol.Start(); err != nil {
 		return nil, err
 	}
 	select {
 	case <-protocol.Finished:
+		s.metrics.shuffled(time.Since(start))
 		return &evoting.ShuffleReply{}, nil
 	case <-time.After(timeout):
 		return nil, errors.New("shuffle error, protocol timeout")
@@ -412,11 +863,18 @@ func (s *Service) Decrypt(req *evoting.Decrypt) (*evoting.DecryptReply, error) {
 		return nil, errOnlyLeader
 	}
 
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.audit(req.ID, lib.AuditDecrypt, req.User, req.UserID, req.Signature); err != nil {
+		return nil, err
+	}
+	s.begin(&closing{ID: req.ID, User: req.User, UserID: req.UserID, Signature: req.Signature,
+		Decrypt: true})
+	defer s.end(req.ID)
+
 	rooted := election.Roster.NewRosterWithRoot(s.ServerIdentity())
 	tree := rooted.GenerateNaryTree(1)
 	if tree == nil {
@@ -425,6 +883,7 @@ func (s *Service) Decrypt(req *evoting.Decrypt) (*evoting.DecryptReply, error) {
 	instance, _ := s.CreateProtocol(protocol.NameDecrypt, tree)
 	protocol := instance.(*protocol.Decrypt)
 	protocol.User = req.User
+	protocol.UserID = req.UserID
 	protocol.Signature = req.Signature
 	protocol.Secret = s.secret(election.ID)
 	protocol.Election = election
@@ -433,26 +892,144 @@ func (s *Service) Decrypt(req *evoting.Decrypt) (*evoting.DecryptReply, error) {
 		ID:        req.ID,
 		User:      req.User,
 		Signature: req.Signature,
+		UserID:    req.UserID,
 	})
 	protocol.SetConfig(&onet.GenericConfig{Data: config})
+	start := time.Now()
 	if err = protocol.Start(); err != nil {
 		return nil, err
 	}
 	select {
 	case <-protocol.Finished:
+		s.metrics.decrypted(time.Since(start))
 		return &evoting.DecryptReply{}, nil
 	case <-time.After(timeout):
 		return nil, errors.New("decrypt error, protocol timeout")
 	}
 }
 
+// Reshare message handler. Initiate the reshare protocol to hand the shares of
+// the election key over to a new roster, e.g. to replace a node that went
+// offline, and record the new roster in the election skipchain.
+func (s *Service) Reshare(req *evoting.Reshare) (*evoting.ReshareReply, error) {
+	if !s.leader() {
+		return nil, errOnlyLeader
+	}
+
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if election.Stage != lib.Running {
+		return nil, errors.New("reshare error: election not in running stage")
+	}
+	if req.Roster == nil || len(req.Roster.List) == 0 ||
+		!s.ServerIdentity().Equal(req.Roster.List[0]) {
+		return nil, errors.New("reshare error: leader has to be first in the roster")
+	}
+	// The new nodes need the master skipchain to verify the blocks.
+	master, err := lib.GetMaster(s.skipchain, election.Master)
+	if err != nil {
+		return nil, err
+	}
+	for _, si := range req.Roster.List {
+		if i, _ := master.Roster.Search(si.ID); i < 0 {
+			return nil, errors.New("reshare error: " + si.String() + " is not in the master roster")
+		}
+	}
+	secret := s.secret(election.ID)
+	if secret == nil {
+		return nil, errors.New("reshare error: missing share of the election")
+	}
+	dealers := lib.ReshareDealers(election.Roster, req.Roster, election.Threshold)
+	if len(dealers) < election.Threshold {
+		return nil, errors.New("reshare error: not enough nodes of the current roster")
+	}
+
+	if err := s.audit(req.ID, lib.AuditReshare, req.User, req.UserID, req.Signature); err != nil {
+		return nil, err
+	}
+
+	tree := req.Roster.GenerateNaryTree(len(req.Roster.List))
+	if tree == nil {
+		return nil, errors.New("error while generating tree")
+	}
+	instance, _ := s.CreateProtocol(protocol.NameReshare, tree)
+	protocol := instance.(*protocol.Reshare)
+	protocol.Secret = secret
+	protocol.Dealers = dealers
+	protocol.Threshold = election.Threshold
+
+	config, _ := network.Marshal(&synchronizer{
+		ID:        req.ID,
+		User:      req.User,
+		Signature: req.Signature,
+		UserID:    req.UserID,
+	})
+	protocol.SetConfig(&onet.GenericConfig{Data: config})
+	if err = protocol.Start(); err != nil {
+		return nil, err
+	}
+	select {
+	case ok := <-protocol.Finished:
+		if !ok {
+			return nil, errors.New("reshare error: not all nodes got their share")
+		}
+	case <-time.After(timeout):
+		return nil, errors.New("reshare error, protocol timeout")
+	}
+
+	transaction := newTransaction(&lib.Reshare{Roster: req.Roster}, req.User, req.UserID, req.Signature)
+	if _, err := lib.StoreRoster(s.skipchain, req.ID, req.Roster, transaction); err != nil {
+		s.metrics.appendFailed()
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.storage.Secrets[election.ID.Short()] = protocol.NewSecret
+	s.mutex.Unlock()
+	s.save()
+	return &evoting.ReshareReply{}, nil
+}
+
+// GetAuditLog message handler. Return the administrative actions recorded
+// on an election.
+func (s *Service) GetAuditLog(req *evoting.GetAuditLog) (*evoting.GetAuditLogReply, error) {
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := election.AuditLog(s.skipchain)
+	if err != nil {
+		return nil, err
+	}
+	return &evoting.GetAuditLogReply{Entries: entries}, nil
+}
+
+// audit records an administrative action in the election skipchain. The
+// conodes refuse the entry if the user may not perform the action.
+func (s *Service) audit(id skipchain.SkipBlockID, action string, user uint32, userID lib.UserID,
+	sig []byte) error {
+	entry := lib.NewAuditEntry(action, user)
+	entry.UserID = userID
+	_, err := s.store(id, newTransaction(entry, user, userID, sig))
+	return err
+}
+
+// newTransaction returns the transaction of a user given by a sciper, or by
+// id if it is set.
+func newTransaction(data interface{}, user uint32, id lib.UserID, sig []byte) *lib.Transaction {
+	transaction := lib.NewTransaction(data, user, sig)
+	transaction.UserID = id
+	return transaction
+}
+
 // Reconstruct message handler. Fully decrypt partials using Lagrange interpolation.
 func (s *Service) Reconstruct(req *evoting.Reconstruct) (*evoting.ReconstructReply, error) {
 	if !s.leader() {
 		return nil, errOnlyLeader
 	}
 
-	election, err := lib.GetElection(s.skipchain, req.ID, false, 0)
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -460,24 +1037,102 @@ func (s *Service) Reconstruct(req *evoting.Reconstruct) (*evoting.ReconstructRep
 	partials, err := election.Partials()
 	if err != nil {
 		return nil, err
-	} else if len(partials) != len(s.roster().List) {
+	} else if len(partials) < election.NeededPartials() {
 		return nil, errors.New("reconstruct error, election not closed yet")
 	}
 
-	points := make([]kyber.Point, 0)
+	// Older elections don't store the index of the share in the partials,
+	// but need all of them in the order of the roster.
+	n, t := len(election.Roster.List), election.NeededPartials()
+	index := func(j int, partial *lib.Partial) int {
+		if election.Threshold == 0 {
+			return j
+		}
+		return partial.Index
+	}
+	reconstruct := func(question func(*lib.Partial) []kyber.Point) ([]kyber.Point, error) {
+		points := make([]kyber.Point, 0)
+		for i := 0; i < len(question(partials[0])); i++ {
+			shares := make([]*share.PubShare, n)
+			for j, partial := range partials {
+				qp := question(partial)
+				if i >= len(qp) {
+					return nil, errors.New("reconstruct error, partials of different length")
+				}
+				k := index(j, partial)
+				if k < 0 || k >= n {
+					return nil, errors.New("reconstruct error, invalid share index")
+				}
+				shares[k] = &share.PubShare{I: k, V: qp[i]}
+			}
+
+			message, err := share.RecoverCommit(cothority.Suite, shares, t, n)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, message)
+		}
+		return points, nil
+	}
 
-	n := len(election.Roster.List)
-	for i := 0; i < len(partials[0].Points); i++ {
-		shares := make([]*share.PubShare, n)
-		for j, partial := range partials {
-			shares[j] = &share.PubShare{I: j, V: partial.Points[i]}
+	points, err := reconstruct(func(p *lib.Partial) []kyber.Point { return p.Points })
+	if err != nil {
+		return nil, err
+	}
+	reply := &evoting.ReconstructReply{Points: points}
+	for q := 1; q < election.NumCiphertexts(); q++ {
+		answers, err := reconstruct(func(p *lib.Partial) []kyber.Point {
+			if q > len(p.Answers) {
+				return nil
+			}
+			return p.Answers[q-1].Points
+		})
+		if err != nil {
+			return nil, err
 		}
+		reply.Answers = append(reply.Answers, &lib.Points{Points: answers})
+	}
+	return reply, nil
+}
 
-		message, _ := share.RecoverCommit(cothority.Suite, shares, n, n)
-		points = append(points, message)
+// Results message handler. Tally the reconstructed ballots and return them
+// as JSON, with the verification transcript, and as CSV.
+func (s *Service) Results(req *evoting.Results) (*evoting.ResultsReply, error) {
+	reconstructed, err := s.Reconstruct(&evoting.Reconstruct{ID: req.ID})
+	if err != nil {
+		return nil, err
+	}
+	election, err := s.index.GetElection(s.skipchain, req.ID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	box, _, err := election.LocalBox(s.skipchain)
+	if err != nil {
+		return nil, err
+	}
+	box = election.Counted(box)
+	mixes, err := election.Mixes()
+	if err != nil {
+		return nil, err
+	}
+	partials, err := election.Partials()
+	if err != nil {
+		return nil, err
 	}
 
-	return &evoting.ReconstructReply{Points: points}, nil
+	results, err := lib.NewResults(election, box, mixes, partials,
+		reconstructed.Points, reconstructed.Answers)
+	if err != nil {
+		return nil, err
+	}
+	reply := &evoting.ResultsReply{}
+	if reply.JSON, err = results.JSON(); err != nil {
+		return nil, err
+	}
+	if reply.CSV, err = results.CSV(); err != nil {
+		return nil, err
+	}
+	return reply, nil
 }
 
 // NewProtocol hooks non-root nodes into created protocols.
@@ -501,7 +1156,7 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 		}()
 		return protocol, nil
 	case protocol.NameShuffle:
-		election, err := lib.GetElection(s.skipchain, sync.ID, false, 0)
+		election, err := s.index.GetElection(s.skipchain, sync.ID, false, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -509,6 +1164,7 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 		instance, _ := protocol.NewShuffle(node)
 		protocol := instance.(*protocol.Shuffle)
 		protocol.User = sync.User
+		protocol.UserID = sync.UserID
 		protocol.Signature = sync.Signature
 		protocol.Election = election
 
@@ -516,12 +1172,13 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			ID:        sync.ID,
 			User:      sync.User,
 			Signature: sync.Signature,
+			UserID:    sync.UserID,
 		})
 		protocol.SetConfig(&onet.GenericConfig{Data: config})
 
 		return protocol, nil
 	case protocol.NameDecrypt:
-		election, err := lib.GetElection(s.skipchain, sync.ID, false, 0)
+		election, err := s.index.GetElection(s.skipchain, sync.ID, false, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -530,6 +1187,7 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 		protocol := instance.(*protocol.Decrypt)
 		protocol.Secret = s.secret(sync.ID)
 		protocol.User = sync.User
+		protocol.UserID = sync.UserID
 		protocol.Signature = sync.Signature
 		protocol.Election = election
 
@@ -537,9 +1195,27 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			ID:        sync.ID,
 			User:      sync.User,
 			Signature: sync.Signature,
+			UserID:    sync.UserID,
 		})
 		protocol.SetConfig(&onet.GenericConfig{Data: config})
 		return protocol, nil
+	case protocol.NameReshare:
+		instance, _ := protocol.NewReshare(node)
+		protocol := instance.(*protocol.Reshare)
+		protocol.Secret = s.secret(sync.ID)
+		go func() {
+			if !<-protocol.Finished {
+				return
+			}
+			s.mutex.Lock()
+			s.storage.Reshared[sync.ID.Short()] = &reshared{
+				Secret: protocol.NewSecret,
+				Roster: node.Roster(),
+			}
+			s.mutex.Unlock()
+			s.save()
+		}()
+		return protocol, nil
 	default:
 		return nil, errors.New("protocol error, unknown protocol")
 	}
@@ -579,14 +1255,52 @@ func (s *Service) leader() bool {
 	return s.ServerIdentity().Equal(s.storage.Roster.List[0])
 }
 
-// secret returns the shared secret for a given election.
+// secret returns the shared secret for a given election. A share received in
+// a resharing replaces it once the election skipchain moved to the new
+// roster.
 func (s *Service) secret(id skipchain.SkipBlockID) *lib.SharedSecret {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if pending, ok := s.storage.Reshared[id.Short()]; ok {
+		latest, err := s.db().GetLatest(s.db().GetByID(id))
+		if err == nil && latest.Roster.ID.Equal(pending.Roster.ID) {
+			s.storage.Secrets[id.Short()] = pending.Secret
+			delete(s.storage.Reshared, id.Short())
+		}
+	}
 	secret, _ := s.storage.Secrets[id.Short()]
 	return secret
 }
 
+// SetStorageQuota limits the size of the blocks of the master and election
+// skipchains on this conode, see skipchain.Service.SetQuota. A size of 0
+// removes the limit.
+func (s *Service) SetStorageQuota(maxBytes int64) {
+	s.skipchain.SetQuota(&skipchain.Quota{
+		Service:   evoting.ServiceName,
+		MaxBytes:  maxBytes,
+		Verifiers: []skipchain.VerifierID{lib.TransactionVerifierID},
+	})
+}
+
+// Health returns an error if the master skipchain cannot be read or if the
+// share of the key of an election is missing.
+func (s *Service) Health() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.storage.Master != nil {
+		if _, err := lib.GetMaster(s.skipchain, s.storage.Master); err != nil {
+			return errors.New("master skipchain not reachable: " + err.Error())
+		}
+	}
+	for id, secret := range s.storage.Secrets {
+		if secret == nil || secret.V == nil || secret.X == nil {
+			return errors.New("missing share of election " + id)
+		}
+	}
+	return nil
+}
+
 // save saves the storage onto the disk.
 func (s *Service) save() {
 	s.mutex.Lock()
@@ -620,6 +1334,15 @@ func (s *Service) load() error {
 	if s.storage.Secrets == nil {
 		s.storage.Secrets = make(map[string]*lib.SharedSecret)
 	}
+	if s.storage.Reshared == nil {
+		s.storage.Reshared = make(map[string]*reshared)
+	}
+	if s.storage.Closing == nil {
+		s.storage.Closing = make(map[string]*closing)
+	}
+	for _, c := range s.storage.Closing {
+		s.interrupted = append(s.interrupted, c)
+	}
 	return nil
 }
 
@@ -632,26 +1355,52 @@ func new(context *onet.Context) (onet.Service, error) {
 	service := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(context),
 		storage: &storage{
-			Secrets: make(map[string]*lib.SharedSecret),
+			Secrets:  make(map[string]*lib.SharedSecret),
+			Reshared: make(map[string]*reshared),
+			Closing:  make(map[string]*closing),
 		},
 		skipchain: context.Service(skipchain.ServiceName).(*skipchain.Service),
+		failed:    make(map[string]bool),
+		casts:     make(map[string]*casts),
+		metrics:   newMetrics(),
 	}
 
 	service.RegisterHandlers(
 		service.Ping,
 		service.Link,
+		service.Rotate,
 		service.Open,
 		service.Cast,
+		service.PreflightCast,
 		service.GetElections,
 		service.GetBox,
+		service.GetTurnout,
+		service.GetCountedBallot,
+		service.PurgeTests,
+		service.GetAuditLog,
 		service.GetMixes,
 		service.Shuffle,
 		service.GetPartials,
 		service.Decrypt,
+		service.Reshare,
+		service.Redact,
 		service.Reconstruct,
+		service.Results,
 		service.LookupSciper,
 	)
+	db, bucket := context.GetAdditionalBucket([]byte("index"))
+	index, err := lib.NewPersistentIndex(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+	service.index = index
+
 	skipchain.RegisterVerification(context, lib.TransactionVerifierID, service.verify)
+	skipchain.RegisterBlockHandler(context, service.index.Append)
+	for name, predicate := range lib.Predicates {
+		skipchain.RegisterPredicate(context, name, predicate)
+	}
+	service.RegisterStatusReporter("Evoting", service)
 
 	pin := make([]byte, 16)
 	random.Bytes(pin, random.New())
@@ -661,6 +1410,8 @@ func new(context *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 
+	go service.schedule()
+
 	log.Lvl1("Pin:", service.pin)
 	return service, nil
 }
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"bytes"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,11 +13,13 @@ import (
 	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/dedis/cothority/evoting"
 	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/skipchain"
 )
 
 func TestMain(m *testing.M) {
@@ -90,6 +94,7 @@ func TestService(t *testing.T) {
 			Users:   []uint32{idUser1, idUser2, idUser3, idAdmin},
 			Roster:  roster,
 			End:     time.Now().Unix() + 86400,
+			Admins:  []uint32{idAdmin2},
 		},
 		User:      idAdmin,
 		Signature: idAdminSig,
@@ -146,10 +151,88 @@ func TestService(t *testing.T) {
 		return cast
 	}
 
-	// User votes
+	// The index must agree with the election read from the skipchain.
+	requireStage := func(stage lib.ElectionState) {
+		indexed, err := s0.index.GetElection(s0.skipchain, replyOpen.ID, true, lib.SciperID(idUser1))
+		require.Nil(t, err)
+		election, err := lib.GetElection(s0.skipchain, replyOpen.ID, true, lib.SciperID(idUser1))
+		require.Nil(t, err)
+		require.Equal(t, stage, indexed.Stage)
+		require.Equal(t, election.Stage, indexed.Stage)
+		require.Equal(t, election.Voted, indexed.Voted)
+		// So must the index stored in the database, as read after a restart.
+		db, bucket := s0.GetAdditionalBucket([]byte("index"))
+		restarted, err := lib.NewPersistentIndex(db, bucket)
+		require.Nil(t, err)
+		stored, err := restarted.GetElection(s0.skipchain, replyOpen.ID, true, lib.SciperID(idUser1))
+		require.Nil(t, err)
+		require.Equal(t, indexed.Stage, stored.Stage)
+		require.Equal(t, indexed.Voted, stored.Voted)
+	}
+	requireStage(lib.Running)
+	require.Equal(t, "1", s0.GetStatus().Field["ActiveElections"])
+
+	// A ballot can be checked before it is cast, without storing it.
+	preflight := func(s *Service, user uint32, ballot *lib.Ballot) error {
+		_, err := s.PreflightCast(&evoting.PreflightCast{
+			ID:        replyOpen.ID,
+			Ballot:    ballot,
+			User:      user,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, user),
+		})
+		return err
+	}
+	k, c = lib.Encrypt(replyOpen.Key, bufCand1)
+	require.Equal(t, errOnlyLeader, preflight(s1, idUser1, &lib.Ballot{User: idUser1, Alpha: k, Beta: c}))
+	require.Nil(t, preflight(s0, idUser1, &lib.Ballot{User: idUser1, Alpha: k, Beta: c}))
+	require.NotNil(t, preflight(s0, idUser1, &lib.Ballot{User: idUser2, Alpha: k, Beta: c}))
+	require.NotNil(t, preflight(s0, idUser1, nil))
+	err = preflight(s0, idUser1, &lib.Ballot{User: idUser1, Alpha: k})
+	require.Contains(t, err.Error(), "missing ciphertext")
+	err = preflight(s0, idUser1, &lib.Ballot{User: idUser1, Alpha: k,
+		Beta: cothority.Suite.Point().Null()})
+	require.Contains(t, err.Error(), "invalid ciphertext")
+	turnout, err := s0.GetTurnout(&evoting.GetTurnout{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 0, turnout.Voters)
+
+	// User votes, with a snapshot of the box after the second ballot.
+	defer func(interval int) { snapshotInterval = interval }(snapshotInterval)
+	snapshotInterval = 2
+	vote(idUser1, bufCand2)
 	vote(idUser1, bufCand1)
+	turnout, err = s0.GetTurnout(&evoting.GetTurnout{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 1, turnout.Voters)
+	require.Equal(t, 4, turnout.Users)
 	vote(idUser2, bufCand1)
-	vote(idUser3, bufCand2)
+	receipt := vote(idUser3, bufCand2).Receipt
+	turnout, err = s0.GetTurnout(&evoting.GetTurnout{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 3, turnout.Voters)
+	require.Nil(t, receipt.Verify(roster))
+	elections, err := s0.GetElections(&evoting.GetElections{
+		User:       idUser3,
+		Master:     replyLink.ID,
+		Signature:  generateSignature(nodeKP.Private, replyLink.ID, idUser3),
+		CheckVoted: true,
+	})
+	require.Nil(t, err)
+	require.True(t, receipt.Counted(elections.Elections[0]))
+	receipt.Ballot = receipt.Block
+	require.NotNil(t, receipt.Verify(roster))
+
+	box, err := s0.GetBox(&evoting.GetBox{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 3, box.Total)
+	require.Equal(t, 3, len(box.Box.Ballots))
+	box, err = s0.GetBox(&evoting.GetBox{ID: replyOpen.ID, Offset: 1, Count: 1})
+	require.Nil(t, err)
+	require.Equal(t, 3, box.Total)
+	require.Equal(t, 1, len(box.Box.Ballots))
+	require.Equal(t, idUser2, box.Box.Ballots[0].User)
+	_, err = s0.GetBox(&evoting.GetBox{ID: replyOpen.ID, Offset: 4})
+	require.NotNil(t, err)
 
 	// Shuffle on non-leader
 	_, err = s1.Shuffle(&evoting.Shuffle{
@@ -159,6 +242,8 @@ func TestService(t *testing.T) {
 	})
 	require.Equal(t, err, errOnlyLeader)
 
+	requireStage(lib.Running)
+
 	// Shuffle all votes
 	_, err = s0.Shuffle(&evoting.Shuffle{
 		ID:        replyOpen.ID,
@@ -166,6 +251,8 @@ func TestService(t *testing.T) {
 		Signature: idAdminSig,
 	})
 	require.Nil(t, err)
+	requireStage(lib.Shuffled)
+	require.Equal(t, "0", s0.GetStatus().Field["ActiveElections"])
 
 	// Decrypt on non-leader
 	_, err = s1.Decrypt(&evoting.Decrypt{
@@ -175,13 +262,28 @@ func TestService(t *testing.T) {
 	})
 	require.Equal(t, err, errOnlyLeader)
 
-	// Decrypt all votes
+	// Decrypt all votes, done by the co-administrator.
 	_, err = s0.Decrypt(&evoting.Decrypt{
 		ID:        replyOpen.ID,
-		User:      idAdmin,
-		Signature: idAdminSig,
+		User:      idAdmin2,
+		Signature: generateSignature(nodeKP.Private, replyLink.ID, idAdmin2),
 	})
 	require.Nil(t, err)
+	requireStage(lib.Decrypted)
+
+	audit, err := s0.GetAuditLog(&evoting.GetAuditLog{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(audit.Entries))
+	require.Equal(t, lib.AuditOpen, audit.Entries[0].Action)
+	require.Equal(t, idAdmin, audit.Entries[0].User)
+	require.Equal(t, lib.AuditShuffle, audit.Entries[1].Action)
+	require.Equal(t, lib.AuditDecrypt, audit.Entries[2].Action)
+	require.Equal(t, idAdmin2, audit.Entries[2].User)
+
+	status := s0.GetStatus().Field
+	require.Equal(t, "4", status["Ballots "+replyOpen.ID.Short()])
+	require.NotEqual(t, "0s", status["LastShuffle"])
+	require.NotEqual(t, "0s", status["LastDecrypt"])
 
 	// Reconstruct on non-leader
 	reconstructReply, err := s1.Reconstruct(&evoting.Reconstruct{
@@ -198,6 +300,206 @@ func TestService(t *testing.T) {
 	for _, p := range reconstructReply.Points {
 		log.Lvl2("Point is:", p.String())
 	}
+
+	// The election has no candidates, so all the ballots are spoiled.
+	results, err := s0.Results(&evoting.Results{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Contains(t, string(results.CSV), "0,spoiled,3,")
+	require.Contains(t, string(results.JSON), "transcript")
+
+	// The bulletin board holds the whole election, and appending to it
+	// gives the same entries.
+	board := &bytes.Buffer{}
+	written, err := lib.WriteBoard(board, roster, replyOpen.ID, 0)
+	require.Nil(t, err)
+	full := board.String()
+	entries, err := lib.VerifyBoard(strings.NewReader(full), replyOpen.ID)
+	require.Nil(t, err)
+	require.Equal(t, written, len(entries))
+	require.Equal(t, "election", entries[1].Type)
+	ballots := 0
+	for _, e := range entries {
+		if e.Type == "ballot" {
+			ballots++
+		}
+	}
+	require.Equal(t, 4, ballots)
+	lines := strings.SplitAfter(full, "\n")
+	board.Reset()
+	board.WriteString(strings.Join(lines[:3], ""))
+	_, err = lib.WriteBoard(board, roster, replyOpen.ID, 3)
+	require.Nil(t, err)
+	require.Equal(t, full, board.String())
+	lines[2] = strings.Replace(lines[2], entries[2].Data, entries[3].Data, 1)
+	_, err = lib.VerifyBoard(strings.NewReader(strings.Join(lines, "")), replyOpen.ID)
+	require.NotNil(t, err)
+}
+
+func TestSchedule(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	idAdminSig := generateSignature(nodeKP.Private, replyLink.ID, idAdmin)
+
+	open := func(start, end int64) *evoting.OpenReply {
+		reply, err := s0.Open(&evoting.Open{
+			ID: replyLink.ID,
+			Election: &lib.Election{
+				Creator: idAdmin,
+				Users:   []uint32{idUser1, idUser2, idUser3, idAdmin},
+				Start:   start,
+				End:     end,
+			},
+			User:      idAdmin,
+			Signature: idAdminSig,
+		})
+		require.Nil(t, err)
+		return reply
+	}
+	cast := func(election *evoting.OpenReply, user uint32) error {
+		k, c := lib.Encrypt(election.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        election.ID,
+			Ballot:    &lib.Ballot{User: user, Alpha: k, Beta: c},
+			User:      user,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, user),
+		})
+		return err
+	}
+
+	// Ballots are refused before the start of the election.
+	now := time.Now().Unix()
+	future := open(now+3600, now+7200)
+	require.NotNil(t, cast(future, idUser1))
+
+	running := open(now-3600, now+3600)
+	require.Nil(t, cast(running, idUser1))
+	require.Nil(t, cast(running, idUser2))
+
+	// Nothing ended yet.
+	s0.closeElections(time.Now(), false)
+	election, err := lib.GetElection(s0.skipchain, running.ID, false, nil)
+	require.Nil(t, err)
+	require.Equal(t, lib.Running, election.Stage)
+
+	// Closing the elections after their end shuffles and decrypts them. The
+	// future election has no ballots, so it can't be closed.
+	s0.closeElections(time.Unix(now+7201, 0), false)
+	election, err = lib.GetElection(s0.skipchain, running.ID, false, nil)
+	require.Nil(t, err)
+	require.Equal(t, lib.Decrypted, election.Stage)
+	require.True(t, s0.failed[future.ID.Short()])
+	require.NotContains(t, s0.GetStatus().Field, "Closing "+running.ID.Short())
+}
+
+func TestCastLimits(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	defer func(rate, burst float64) { castRate, castBurst = rate, burst }(castRate, castBurst)
+	castRate, castBurst = 0, 3
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	replyOpen, err := s0.Open(&evoting.Open{
+		ID: replyLink.ID,
+		Election: &lib.Election{
+			Creator:    idAdmin,
+			Users:      []uint32{idUser1, idUser2, idUser3, idAdmin},
+			End:        time.Now().Unix() + 86400,
+			MaxBallots: 2,
+		},
+		User:      idAdmin,
+		Signature: generateSignature(nodeKP.Private, replyLink.ID, idAdmin),
+	})
+	require.Nil(t, err)
+
+	cast := func(user uint32) error {
+		k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    &lib.Ballot{User: user, Alpha: k, Beta: c},
+			User:      user,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, user),
+		})
+		return err
+	}
+	require.Nil(t, cast(idUser1))
+	require.Nil(t, cast(idUser1))
+	// The user already cast two ballots.
+	require.NotNil(t, cast(idUser1))
+	require.Nil(t, cast(idUser2))
+	// The election got more than castBurst ballots.
+	require.NotNil(t, cast(idUser3))
+}
+
+func TestRotate(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	adminKPs := []*key.Pair{key.NewKeyPair(cothority.Suite), key.NewKeyPair(cothority.Suite)}
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	rl, err := s0.Link(&evoting.Link{
+		Pin:       s0.pin,
+		Roster:    roster,
+		Key:       nodeKP.Public,
+		Admins:    []uint32{idAdmin},
+		AdminKeys: []kyber.Point{adminKPs[0].Public, adminKPs[1].Public},
+	})
+	require.Nil(t, err)
+
+	// The front-end key is lost, so the admins rotate it.
+	nodeKP = key.NewKeyPair(cothority.Suite)
+	rotation := &lib.Rotation{Master: &lib.Master{
+		ID:        rl.ID,
+		Roster:    roster,
+		Admins:    []uint32{idAdmin2},
+		Key:       nodeKP.Public,
+		AdminKeys: []kyber.Point{adminKPs[1].Public},
+	}}
+	require.Nil(t, rotation.Sign(0, adminKPs[0].Private))
+	_, err = s0.Rotate(&evoting.Rotate{ID: rl.ID, Rotation: rotation})
+	require.NotNil(t, err)
+	require.Nil(t, rotation.Sign(1, adminKPs[1].Private))
+	_, err = s0.Rotate(&evoting.Rotate{ID: rl.ID, Rotation: rotation})
+	require.Nil(t, err)
+
+	master, err := lib.GetMaster(s0.skipchain, rl.ID)
+	require.Nil(t, err)
+	require.True(t, master.Key.Equal(nodeKP.Public))
+	require.True(t, master.IsAdmin(idAdmin2))
+
+	// Only the remaining admin key can rotate the master now.
+	rotation.Master.Admins = []uint32{idAdmin}
+	rotation.Signatures = nil
+	require.Nil(t, rotation.Sign(0, adminKPs[0].Private))
+	_, err = s0.Rotate(&evoting.Rotate{ID: rl.ID, Rotation: rotation})
+	require.NotNil(t, err)
+
+	runAnElection(t, s0, rl, nodeKP, idAdmin2)
 }
 
 func runAnElection(t *testing.T, s *Service, replyLink *evoting.LinkReply, nodeKP *key.Pair, admin uint32) {
@@ -317,3 +619,603 @@ func TestEvolveRoster(t *testing.T) {
 	// There was a test here before to try to replace the leader.
 	// It didn't work. For the time being, that is not supported.
 }
+
+func TestReshare(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(5, 5, 1, true)
+	services := local.GetServices(nodes, serviceID)
+	s0 := services[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	idAdminSig := generateSignature(nodeKP.Private, replyLink.ID, idAdmin)
+
+	// The election runs on the first four nodes.
+	replyOpen, err := s0.Open(&evoting.Open{
+		ID: replyLink.ID,
+		Election: &lib.Election{
+			Creator: idAdmin,
+			Users:   []uint32{idUser1, idUser2, idAdmin},
+			Roster:  onet.NewRoster(roster.List[:4]),
+			End:     time.Now().Unix() + 86400,
+		},
+		User:      idAdmin,
+		Signature: idAdminSig,
+	})
+	require.Nil(t, err)
+
+	k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+	_, err = s0.Cast(&evoting.Cast{
+		ID:        replyOpen.ID,
+		Ballot:    &lib.Ballot{User: idUser1, Alpha: k, Beta: c},
+		User:      idUser1,
+		Signature: generateSignature(nodeKP.Private, replyLink.ID, idUser1),
+	})
+	require.Nil(t, err)
+
+	// The fourth node is replaced by the fifth one.
+	next := onet.NewRoster([]*network.ServerIdentity{roster.List[0], roster.List[1],
+		roster.List[2], roster.List[4]})
+	reshare := &evoting.Reshare{
+		ID:        replyOpen.ID,
+		Roster:    next,
+		User:      idAdmin,
+		Signature: idAdminSig,
+	}
+	_, err = services[1].(*Service).Reshare(reshare)
+	require.Equal(t, errOnlyLeader, err)
+	reshare.Roster = onet.NewRoster(next.List[1:])
+	_, err = s0.Reshare(reshare)
+	require.NotNil(t, err)
+	reshare.Roster = onet.NewRoster([]*network.ServerIdentity{roster.List[0], roster.List[4]})
+	_, err = s0.Reshare(reshare)
+	require.NotNil(t, err)
+
+	reshare.Roster = next
+	_, err = s0.Reshare(reshare)
+	require.Nil(t, err)
+
+	election, err := s0.index.GetElection(s0.skipchain, replyOpen.ID, false, nil)
+	require.Nil(t, err)
+	require.True(t, election.Roster.ID.Equal(next.ID))
+	require.Equal(t, lib.Running, election.Stage)
+	require.True(t, replyOpen.Key.Equal(s0.secret(replyOpen.ID).X))
+	audit, err := s0.GetAuditLog(&evoting.GetAuditLog{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, lib.AuditReshare, audit.Entries[len(audit.Entries)-1].Action)
+}
+
+func TestUserIDs(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	admin := lib.UserID("admin@example.com")
+	voter := lib.UserID("voter@example.com")
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:      s0.pin,
+		Roster:   roster,
+		Key:      nodeKP.Public,
+		AdminIDs: []lib.UserID{admin},
+	})
+	require.Nil(t, err)
+	sign := func(user lib.UserID) []byte {
+		sig, err := schnorr.Sign(cothority.Suite, nodeKP.Private, lib.UserDigest(replyLink.ID, 0, user))
+		require.Nil(t, err)
+		return sig
+	}
+	adminSig := sign(admin)
+
+	replyOpen, err := s0.Open(&evoting.Open{
+		ID: replyLink.ID,
+		Election: &lib.Election{
+			Users:   []uint32{idUser1},
+			UserIDs: []lib.UserID{voter},
+			End:     time.Now().Unix() + 86400,
+		},
+		UserID:    admin,
+		Signature: adminSig,
+	})
+	require.Nil(t, err)
+
+	cast := func(user lib.UserID) error {
+		k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    &lib.Ballot{UserID: user, Alpha: k, Beta: c},
+			UserID:    user,
+			Signature: sign(user),
+		})
+		return err
+	}
+	require.Nil(t, cast(voter))
+	require.NotNil(t, cast(lib.UserID("other@example.com")))
+	// A sciper is the same user as its identifier.
+	require.Nil(t, cast(lib.SciperID(idUser1)))
+
+	elections, err := s0.GetElections(&evoting.GetElections{
+		Master:     replyLink.ID,
+		UserID:     voter,
+		Signature:  sign(voter),
+		CheckVoted: true,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(elections.Elections))
+	require.NotNil(t, elections.Elections[0].Voted)
+	require.True(t, elections.Elections[0].IsCreatorID(admin))
+	turnout, err := s0.GetTurnout(&evoting.GetTurnout{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 2, turnout.Users)
+
+	_, err = s0.Shuffle(&evoting.Shuffle{ID: replyOpen.ID, UserID: admin, Signature: adminSig})
+	require.Nil(t, err)
+	_, err = s0.Decrypt(&evoting.Decrypt{ID: replyOpen.ID, UserID: admin, Signature: adminSig})
+	require.Nil(t, err)
+	audit, err := s0.GetAuditLog(&evoting.GetAuditLog{ID: replyOpen.ID})
+	require.Nil(t, err)
+	for _, entry := range audit.Entries {
+		require.Equal(t, admin, entry.GetUser())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	admin := lib.UserID("admin@example.com")
+	voter := lib.UserID("voter@example.com")
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:      s0.pin,
+		Roster:   roster,
+		Key:      nodeKP.Public,
+		AdminIDs: []lib.UserID{admin},
+	})
+	require.Nil(t, err)
+	sign := func(user lib.UserID) []byte {
+		sig, err := schnorr.Sign(cothority.Suite, nodeKP.Private, lib.UserDigest(replyLink.ID, 0, user))
+		require.Nil(t, err)
+		return sig
+	}
+	adminSig := sign(admin)
+
+	_, err = s0.Open(&evoting.Open{
+		ID: replyLink.ID,
+		Election: &lib.Election{
+			UserIDs:   []lib.UserID{voter},
+			End:       time.Now().Unix() + 86400,
+			Retention: -1,
+		},
+		UserID:    admin,
+		Signature: adminSig,
+	})
+	require.NotNil(t, err)
+	end := time.Now().Unix() + 2
+	replyOpen, err := s0.Open(&evoting.Open{
+		ID: replyLink.ID,
+		Election: &lib.Election{
+			Users:   []uint32{idUser1},
+			UserIDs: []lib.UserID{voter},
+			End:     end,
+		},
+		UserID:    admin,
+		Signature: adminSig,
+	})
+	require.Nil(t, err)
+
+	for _, user := range []lib.UserID{voter, voter, lib.SciperID(idUser1)} {
+		k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    &lib.Ballot{UserID: user, Alpha: k, Beta: c},
+			UserID:    user,
+			Signature: sign(user),
+		})
+		require.Nil(t, err)
+	}
+	redact := func() (*evoting.RedactReply, error) {
+		return s0.Redact(&evoting.Redact{ID: replyOpen.ID, UserID: admin, Signature: adminSig})
+	}
+	_, err = redact()
+	require.NotNil(t, err)
+
+	_, err = s0.Shuffle(&evoting.Shuffle{ID: replyOpen.ID, UserID: admin, Signature: adminSig})
+	require.Nil(t, err)
+	_, err = s0.Decrypt(&evoting.Decrypt{ID: replyOpen.ID, UserID: admin, Signature: adminSig})
+	require.Nil(t, err)
+	results, err := s0.Results(&evoting.Results{ID: replyOpen.ID})
+	require.Nil(t, err)
+
+	// The retention period of the election is over once it ended.
+	time.Sleep(time.Until(time.Unix(end+1, 0)))
+	_, err = s0.Redact(&evoting.Redact{ID: replyOpen.ID, UserID: voter, Signature: sign(voter)})
+	require.NotNil(t, err)
+	reply, err := redact()
+	require.Nil(t, err)
+	require.Equal(t, 2, reply.Redaction.Voters)
+	_, err = redact()
+	require.NotNil(t, err)
+
+	// The ballots are only returned with the hashes of their users.
+	box, err := s0.GetBox(&evoting.GetBox{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(box.Box.Ballots))
+	require.Equal(t, box.Box.Ballots[0].GetUser(), box.Box.Ballots[1].GetUser())
+	require.NotEqual(t, box.Box.Ballots[0].GetUser(), box.Box.Ballots[2].GetUser())
+	for _, ballot := range box.Box.Ballots {
+		require.Equal(t, uint32(0), ballot.User)
+		require.False(t, ballot.GetUser().Equal(voter))
+	}
+	_, err = s0.GetCountedBallot(&evoting.GetCountedBallot{ID: replyOpen.ID, UserID: voter})
+	require.NotNil(t, err)
+
+	// The indexes still answer for the hashed users, and the tally doesn't
+	// change.
+	elections, err := s0.GetElections(&evoting.GetElections{
+		Master:     replyLink.ID,
+		UserID:     voter,
+		Signature:  sign(voter),
+		CheckVoted: true,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(elections.Elections))
+	require.True(t, elections.Elections[0].Redacted)
+	require.NotNil(t, elections.Elections[0].Voted)
+	db, bucket := s0.GetAdditionalBucket([]byte("index"))
+	restarted, err := lib.NewPersistentIndex(db, bucket)
+	require.Nil(t, err)
+	require.Equal(t, s0.index.Redact(replyOpen.ID, voter), restarted.Redact(replyOpen.ID, voter))
+	stored, err := restarted.GetElection(s0.skipchain, replyOpen.ID, true, voter)
+	require.Nil(t, err)
+	require.True(t, stored.Redacted)
+	require.Equal(t, elections.Elections[0].Voted, stored.Voted)
+	turnout, err := s0.GetTurnout(&evoting.GetTurnout{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 2, turnout.Voters)
+	redacted, err := s0.Results(&evoting.Results{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, results.CSV, redacted.CSV)
+}
+
+func TestCountWindow(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+
+	open := func(window int64) *evoting.OpenReply {
+		replyOpen, err := s0.Open(&evoting.Open{
+			ID: replyLink.ID,
+			Election: &lib.Election{
+				Creator:     idAdmin,
+				Users:       []uint32{idUser1},
+				End:         time.Now().Unix() + 86400,
+				CountWindow: window,
+			},
+			User:      idAdmin,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, idAdmin),
+		})
+		require.Nil(t, err)
+		return replyOpen
+	}
+	cast := func(replyOpen *evoting.OpenReply) *evoting.CastReply {
+		k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+		reply, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    &lib.Ballot{User: idUser1, Alpha: k, Beta: c},
+			User:      idUser1,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, idUser1),
+		})
+		require.Nil(t, err)
+		return reply
+	}
+
+	// The window only starts an hour before the end.
+	early := open(3600)
+	cast(early)
+	counted, err := s0.GetCountedBallot(&evoting.GetCountedBallot{ID: early.ID, User: idUser1})
+	require.Nil(t, err)
+	require.Nil(t, counted.Block)
+
+	// The window covers the whole election, only the last ballot counts.
+	running := open(2 * 86400)
+	first := cast(running)
+	last := cast(running)
+	counted, err = s0.GetCountedBallot(&evoting.GetCountedBallot{ID: running.ID, User: idUser1})
+	require.Nil(t, err)
+	require.Equal(t, last.Receipt.Block, counted.Block)
+	require.NotEqual(t, first.Receipt.Block, counted.Block)
+	require.Equal(t, last.Receipt.Ballot, counted.Ballot.Hash())
+}
+
+func TestHomomorphic(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	idAdminSig := generateSignature(nodeKP.Private, replyLink.ID, idAdmin)
+
+	election := &lib.Election{
+		Creator:     idAdmin,
+		Users:       []uint32{idUser1, idUser2, idUser3},
+		Candidates:  []uint32{idCand1, idCand2},
+		MaxChoices:  1,
+		End:         time.Now().Unix() + 86400,
+		Homomorphic: true,
+	}
+	replyOpen, err := s0.Open(&evoting.Open{
+		ID:        replyLink.ID,
+		Election:  election,
+		User:      idAdmin,
+		Signature: idAdminSig,
+	})
+	require.Nil(t, err)
+	election.ID, election.Key = replyOpen.ID, replyOpen.Key
+
+	vote := func(user uint32, ballot *lib.Ballot) error {
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    ballot,
+			User:      user,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, user),
+		})
+		return err
+	}
+	for user, candidate := range map[uint32]uint32{idUser1: idCand1, idUser2: idCand2, idUser3: idCand2} {
+		ballot, err := election.EncryptHomomorphic(user, []uint32{candidate})
+		require.Nil(t, err)
+		require.Nil(t, vote(user, ballot))
+	}
+
+	// Ballots without the proofs are refused.
+	k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+	require.NotNil(t, vote(idUser1, &lib.Ballot{User: idUser1, Alpha: k, Beta: c,
+		Answers: []*lib.Ciphertext{{Alpha: k, Beta: c}}}))
+
+	_, err = s0.Shuffle(&evoting.Shuffle{ID: replyOpen.ID, User: idAdmin, Signature: idAdminSig})
+	require.Nil(t, err)
+	_, err = s0.Shuffle(&evoting.Shuffle{ID: replyOpen.ID, User: idAdmin, Signature: idAdminSig})
+	require.NotNil(t, err)
+	_, err = s0.Decrypt(&evoting.Decrypt{ID: replyOpen.ID, User: idAdmin, Signature: idAdminSig})
+	require.Nil(t, err)
+
+	partials, err := s0.GetPartials(&evoting.GetPartials{ID: replyOpen.ID})
+	require.Nil(t, err)
+	for _, partial := range partials.Partials {
+		require.True(t, partial.Flag)
+		require.Equal(t, 1, len(partial.Points))
+	}
+
+	results, err := s0.Results(&evoting.Results{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Contains(t, string(results.CSV), "0,123456,1,false")
+	require.Contains(t, string(results.CSV), "0,123457,2,true")
+}
+
+func TestMixers(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(5, 5, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	idAdminSig := generateSignature(nodeKP.Private, replyLink.ID, idAdmin)
+
+	open := func(mixers ...int) (*evoting.OpenReply, error) {
+		election := &lib.Election{
+			Creator:    idAdmin,
+			Users:      []uint32{idUser1, idUser2},
+			Candidates: []uint32{idCand1, idCand2},
+			MaxChoices: 1,
+			End:        time.Now().Unix() + 86400,
+		}
+		for _, i := range mixers {
+			election.Mixers = append(election.Mixers, roster.List[i].Public)
+		}
+		return s0.Open(&evoting.Open{
+			ID:        replyLink.ID,
+			Election:  election,
+			User:      idAdmin,
+			Signature: idAdminSig,
+		})
+	}
+	// The leader can only shuffle first, and every node only once.
+	_, err = open(3, 0)
+	require.NotNil(t, err)
+	_, err = open(3, 1, 3)
+	require.NotNil(t, err)
+	replyOpen, err := open(3, 1)
+	require.Nil(t, err)
+
+	for _, user := range []uint32{idUser1, idUser2} {
+		k, c := lib.Encrypt(replyOpen.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        replyOpen.ID,
+			Ballot:    &lib.Ballot{User: user, Alpha: k, Beta: c},
+			User:      user,
+			Signature: generateSignature(nodeKP.Private, replyLink.ID, user),
+		})
+		require.Nil(t, err)
+	}
+
+	_, err = s0.Shuffle(&evoting.Shuffle{ID: replyOpen.ID, User: idAdmin, Signature: idAdminSig})
+	require.Nil(t, err)
+	mixes, err := s0.GetMixes(&evoting.GetMixes{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(mixes.Mixes))
+	require.Equal(t, roster.List[3].String(), mixes.Mixes[0].Node)
+	require.Equal(t, roster.List[1].String(), mixes.Mixes[1].Node)
+
+	_, err = s0.Decrypt(&evoting.Decrypt{ID: replyOpen.ID, User: idAdmin, Signature: idAdminSig})
+	require.Nil(t, err)
+	partials, err := s0.GetPartials(&evoting.GetPartials{ID: replyOpen.ID})
+	require.Nil(t, err)
+	for _, partial := range partials.Partials {
+		require.True(t, partial.Flag)
+	}
+	results, err := s0.Results(&evoting.Results{ID: replyOpen.ID})
+	require.Nil(t, err)
+	require.Contains(t, string(results.CSV), "0,123456,2,true")
+}
+
+func TestTestElections(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+
+	nodeKP := key.NewKeyPair(cothority.Suite)
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	s0 := local.GetServices(nodes, serviceID)[0].(*Service)
+
+	replyLink, err := s0.Link(&evoting.Link{
+		Pin:    s0.pin,
+		Roster: roster,
+		Key:    nodeKP.Public,
+		Admins: []uint32{idAdmin},
+	})
+	require.Nil(t, err)
+	idAdminSig := generateSignature(nodeKP.Private, replyLink.ID, idAdmin)
+	sign := func(user lib.UserID) []byte {
+		sig, err := schnorr.Sign(cothority.Suite, nodeKP.Private, lib.UserDigest(replyLink.ID, 0, user))
+		require.Nil(t, err)
+		return sig
+	}
+
+	open := func(isTest bool, testVoters int) (*evoting.OpenReply, error) {
+		return s0.Open(&evoting.Open{
+			ID: replyLink.ID,
+			Election: &lib.Election{
+				Creator:    idAdmin,
+				Users:      []uint32{idUser1},
+				End:        time.Now().Unix() + 86400,
+				IsTest:     isTest,
+				TestVoters: testVoters,
+			},
+			User:      idAdmin,
+			Signature: idAdminSig,
+		})
+	}
+	_, err = open(false, 2)
+	require.NotNil(t, err)
+	actual, err := open(false, 0)
+	require.Nil(t, err)
+	test, err := open(true, 2)
+	require.Nil(t, err)
+
+	// The synthetic voters can only vote in the test election.
+	cast := func(election *evoting.OpenReply, user lib.UserID) error {
+		k, c := lib.Encrypt(election.Key, bufCand1)
+		_, err := s0.Cast(&evoting.Cast{
+			ID:        election.ID,
+			Ballot:    &lib.Ballot{UserID: user, Alpha: k, Beta: c},
+			UserID:    user,
+			Signature: sign(user),
+		})
+		return err
+	}
+	require.Nil(t, cast(test, lib.TestUserID(0)))
+	require.Nil(t, cast(test, lib.TestUserID(1)))
+	require.NotNil(t, cast(test, lib.TestUserID(2)))
+	require.NotNil(t, cast(actual, lib.TestUserID(0)))
+
+	elections := func() int {
+		reply, err := s0.GetElections(&evoting.GetElections{
+			Master:    replyLink.ID,
+			User:      idAdmin,
+			Signature: idAdminSig,
+		})
+		require.Nil(t, err)
+		return len(reply.Elections)
+	}
+	require.Equal(t, 2, elections())
+
+	// The elections can be filtered and paginated.
+	page := func(stage lib.ElectionState, offset, count int) (*evoting.GetElectionsReply, error) {
+		return s0.GetElections(&evoting.GetElections{Master: replyLink.ID, User: idAdmin,
+			Signature: idAdminSig, Stage: stage, Offset: offset, Count: count})
+	}
+	reply, err := page(lib.Running, 1, 1)
+	require.Nil(t, err)
+	require.Equal(t, 2, reply.Total)
+	require.Equal(t, 1, len(reply.Elections))
+	require.True(t, reply.Elections[0].ID.Equal(test.ID))
+	reply, err = page(lib.Running, 0, 5)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(reply.Elections))
+	reply, err = page(lib.Decrypted, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, reply.Total)
+	_, err = page(0, 3, 0)
+	require.NotNil(t, err)
+	_, err = page(0, 0, -1)
+	require.NotNil(t, err)
+
+	// Test elections are unlinked by the scheduler after their retention.
+	s0.cleanTests(time.Now())
+	require.Equal(t, 2, elections())
+	s0.cleanTests(time.Now().Add(24*time.Hour + testRetention))
+	require.Equal(t, 1, elections())
+	require.Nil(t, s0.secret(test.ID))
+	require.NotNil(t, s0.secret(actual.ID))
+
+	// Or by an admin of the master, which doesn't touch the real elections.
+	test, err = open(true, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, elections())
+	_, err = s0.PurgeTests(&evoting.PurgeTests{Master: replyLink.ID, User: idAdmin,
+		Signature: generateSignature(nodeKP.Private, replyLink.ID, idUser1)})
+	require.NotNil(t, err)
+	purged, err := s0.PurgeTests(&evoting.PurgeTests{Master: replyLink.ID, User: idAdmin,
+		Signature: idAdminSig})
+	require.Nil(t, err)
+	require.Equal(t, []skipchain.SkipBlockID{test.ID}, purged.Purged)
+	require.Equal(t, 1, elections())
+
+	// Real elections cannot be unlinked.
+	_, err = s0.store(replyLink.ID, lib.NewTransaction(&lib.Link{ID: actual.ID, Unlink: true},
+		idAdmin, idAdminSig))
+	require.NotNil(t, err)
+}
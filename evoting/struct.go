@@ -6,22 +6,32 @@ import (
 	"github.com/dedis/onet/network"
 
 	"github.com/dedis/cothority/evoting/lib"
+	"github.com/dedis/cothority/ocs/darc"
 	"github.com/dedis/cothority/skipchain"
 )
 
 func init() {
 	network.RegisterMessage(Ping{})
 	network.RegisterMessages(Link{}, LinkReply{})
+	network.RegisterMessages(Rotate{}, RotateReply{})
 	network.RegisterMessages(LookupSciper{}, LookupSciperReply{})
 	network.RegisterMessages(Open{}, OpenReply{})
 	network.RegisterMessages(Cast{}, CastReply{})
+	network.RegisterMessages(PreflightCast{}, PreflightCastReply{})
 	network.RegisterMessages(Shuffle{}, ShuffleReply{})
 	network.RegisterMessages(Decrypt{}, DecryptReply{})
+	network.RegisterMessages(Reshare{}, ReshareReply{})
+	network.RegisterMessages(Redact{}, RedactReply{})
 	network.RegisterMessages(GetElections{}, GetElectionsReply{})
 	network.RegisterMessages(GetBox{}, GetBoxReply{})
+	network.RegisterMessages(GetTurnout{}, GetTurnoutReply{})
+	network.RegisterMessages(GetCountedBallot{}, GetCountedBallotReply{})
+	network.RegisterMessages(PurgeTests{}, PurgeTestsReply{})
+	network.RegisterMessages(GetAuditLog{}, GetAuditLogReply{})
 	network.RegisterMessages(GetMixes{}, GetMixesReply{})
 	network.RegisterMessages(GetPartials{}, GetPartialsReply{})
 	network.RegisterMessages(Reconstruct{}, ReconstructReply{})
+	network.RegisterMessages(Results{}, ResultsReply{})
 }
 
 // LookupSciper takes a sciper number and returns elements of the user.
@@ -49,6 +59,14 @@ type Link struct {
 	ID        *skipchain.SkipBlockID // ID of the master skipchain to update; optional.
 	User      *uint32                // User identifier; optional (required with ID).
 	Signature *[]byte                // Signature authenticating the message; optional (required with ID).
+
+	// AdminKeys are the keys allowed to rotate the master, see Rotate.
+	AdminKeys []kyber.Point
+
+	// AdminIDs are administrators given by opaque identifiers, see
+	// lib.UserID, and UserID identifies the user instead of User.
+	AdminIDs []lib.UserID
+	UserID   lib.UserID
 }
 
 // LinkReply message.
@@ -56,6 +74,16 @@ type LinkReply struct {
 	ID skipchain.SkipBlockID // ID of the master skipchain.
 }
 
+// Rotate message. It replaces the master without the front-end key, if
+// it is signed by a majority of the admin keys of the current master.
+type Rotate struct {
+	ID       skipchain.SkipBlockID // ID of the master skipchain.
+	Rotation *lib.Rotation         // Rotation holds the new master and the signatures.
+}
+
+// RotateReply message.
+type RotateReply struct{}
+
 // Open message.
 type Open struct {
 	ID       skipchain.SkipBlockID // ID of the master skipchain.
@@ -63,6 +91,8 @@ type Open struct {
 
 	User      uint32 // User identifier.
 	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
 }
 
 // OpenReply message.
@@ -78,19 +108,53 @@ type Cast struct {
 
 	User      uint32 // User identifier.
 	Signature []byte // Signature authenticating the message.
+
+	// DarcSignature signs the ballot for voters given by the darc of the
+	// election, see lib.Election.CanVote.
+	DarcSignature *darc.Signature
+	// VoterProof proves that the user is part of the voter roll of the
+	// election, see lib.Election.InVoterRoll.
+	VoterProof *lib.VoterProof
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
 }
 
 // CastReply message.
 type CastReply struct {
-	ID skipchain.SkipBlockID // Hash of the block storing the transaction
+	ID      skipchain.SkipBlockID // Hash of the block storing the transaction
+	Receipt *lib.Receipt          // Receipt proving that the ballot was stored.
+}
+
+// PreflightCast message. It holds the same fields as Cast, and the ballot is
+// checked without being stored.
+type PreflightCast struct {
+	ID     skipchain.SkipBlockID // ID of the election skipchain.
+	Ballot *lib.Ballot           // Ballot to be checked.
+
+	User      uint32 // User identifier.
+	Signature []byte // Signature authenticating the message.
+
+	// DarcSignature signs the ballot for voters given by the darc of the
+	// election, see lib.Election.CanVote.
+	DarcSignature *darc.Signature
+	// VoterProof proves that the user is part of the voter roll of the
+	// election, see lib.Election.InVoterRoll.
+	VoterProof *lib.VoterProof
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
 }
 
+// PreflightCastReply message. It is only returned if the ballot can be cast.
+type PreflightCastReply struct{}
+
 // Shuffle message.
 type Shuffle struct {
 	ID skipchain.SkipBlockID // ID of the election skipchain.
 
 	User      uint32 // User identifier.
 	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
 }
 
 // ShuffleReply message.
@@ -102,11 +166,45 @@ type Decrypt struct {
 
 	User      uint32 // User identifier.
 	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
 }
 
 // DecryptReply message.
 type DecryptReply struct{}
 
+// Reshare message. It hands the shares of the election key over to Roster,
+// which has to keep the leader as its first node.
+type Reshare struct {
+	ID     skipchain.SkipBlockID // ID of the election skipchain.
+	Roster *onet.Roster          // Roster taking over the election.
+
+	User      uint32 // User identifier.
+	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
+}
+
+// ReshareReply message.
+type ReshareReply struct{}
+
+// Redact message. It replaces the users of the ballots of a decrypted
+// election by salted hashes once its retention period is over.
+type Redact struct {
+	ID skipchain.SkipBlockID // ID of the election skipchain.
+
+	User      uint32 // User identifier.
+	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
+}
+
+// RedactReply message.
+type RedactReply struct {
+	Block     skipchain.SkipBlockID // Block holds the redaction record.
+	Redaction *lib.Redaction        // Redaction is the stored record.
+}
+
 // GetElections message.
 type GetElections struct {
 	User       uint32                // User identifier.
@@ -114,6 +212,12 @@ type GetElections struct {
 	Stage      lib.ElectionState     // Election Stage filter. 0 for all elections.
 	Signature  []byte                // Signature authenticating the message.
 	CheckVoted bool                  // Check if user has voted in the elections.
+	UserID     lib.UserID            // UserID identifies the user instead of User if set.
+	// Offset and Count select a page of the elections, in the order they
+	// were linked, a Count of 0 returns all the elections starting at
+	// Offset.
+	Offset int
+	Count  int
 }
 
 // GetElectionsReply message.
@@ -121,16 +225,74 @@ type GetElectionsReply struct {
 	Elections []*lib.Election // Elections is the retrieved list of elections.
 	IsAdmin   bool            // Is the user in the list of admins in the master?
 	Master    lib.Master
+	Total     int // Total number of elections matching the filter.
 }
 
 // GetBox message.
 type GetBox struct {
 	ID skipchain.SkipBlockID // ID of the election skipchain.
+	// Offset and Count select a page of the box, a Count of 0 returns all
+	// the ballots starting at Offset.
+	Offset int
+	Count  int
 }
 
 // GetBoxReply message.
 type GetBoxReply struct {
-	Box *lib.Box // Box of encrypted ballots.
+	Box   *lib.Box // Box of encrypted ballots.
+	Total int      // Total number of ballots in the box.
+}
+
+// GetTurnout message.
+type GetTurnout struct {
+	ID skipchain.SkipBlockID // ID of the election skipchain.
+}
+
+// GetTurnoutReply message.
+type GetTurnoutReply struct {
+	Voters int // Voters is the number of users who cast a ballot.
+	Users  int // Users is the number of registered voters.
+}
+
+// GetCountedBallot message.
+type GetCountedBallot struct {
+	ID skipchain.SkipBlockID // ID of the election skipchain.
+
+	User   uint32     // User identifier.
+	UserID lib.UserID // UserID identifies the user instead of User if set.
+}
+
+// GetCountedBallotReply message. Block and Ballot are nil if no ballot of the
+// user is counted, see lib.Election.CountedBallot.
+type GetCountedBallotReply struct {
+	Block  skipchain.SkipBlockID // Block is the hash of the block holding the ballot.
+	Ballot *lib.Ballot           // Ballot is the counted ballot.
+}
+
+// PurgeTests message. It unlinks all the test elections from the master
+// skipchain, see lib.Election.IsTest.
+type PurgeTests struct {
+	Master skipchain.SkipBlockID // Master skipchain ID.
+
+	User      uint32 // User identifier.
+	Signature []byte // Signature authenticating the message.
+
+	UserID lib.UserID // UserID identifies the user instead of User if set.
+}
+
+// PurgeTestsReply message.
+type PurgeTestsReply struct {
+	Purged []skipchain.SkipBlockID // Purged are the IDs of the unlinked elections.
+}
+
+// GetAuditLog message.
+type GetAuditLog struct {
+	ID skipchain.SkipBlockID // ID of the election skipchain.
+}
+
+// GetAuditLogReply message.
+type GetAuditLogReply struct {
+	Entries []*lib.AuditEntry // Entries are the recorded actions, oldest first.
 }
 
 // GetMixes message.
@@ -160,7 +322,19 @@ type Reconstruct struct {
 
 // ReconstructReply message.
 type ReconstructReply struct {
-	Points []kyber.Point // Points are the decrypted plaintexts.
+	Points  []kyber.Point // Points are the decrypted plaintexts.
+	Answers []*lib.Points // Answers are the plaintexts of the other questions and the write-ins.
+}
+
+// Results message.
+type Results struct {
+	ID skipchain.SkipBlockID // ID of the election skipchain.
+}
+
+// ResultsReply message.
+type ResultsReply struct {
+	JSON []byte // JSON holds the tallies and the verification transcript.
+	CSV  []byte // CSV holds the tallies.
 }
 
 // Ping message.
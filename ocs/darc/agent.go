@@ -0,0 +1,192 @@
+package darc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// An agent holds private keys in its own process and signs messages for
+// the clients connecting to its UNIX socket, like ssh-agent, so that a
+// long-running service only needs the path of the socket and the identity
+// to sign with. Every request and reply is a protobuf message prefixed by
+// its length as a 4-byte big-endian integer.
+
+// maxAgentMessage is the maximum size of a request or reply of an agent.
+const maxAgentMessage = 1 << 20
+
+// agentRequest asks the agent to sign the message with the key of the
+// identity.
+type agentRequest struct {
+	Identity Identity
+	Message  []byte
+}
+
+// agentReply holds the signature, or the reason why the agent refused to
+// sign.
+type agentReply struct {
+	Signature []byte
+	Error     string
+}
+
+// Agent signs messages with its keys for the clients connecting to its
+// socket.
+type Agent struct {
+	sync.Mutex
+	signers  map[string]*Signer
+	listener net.Listener
+}
+
+// NewAgent returns an agent without keys.
+func NewAgent() *Agent {
+	return &Agent{signers: make(map[string]*Signer)}
+}
+
+// Add gives the key of the signer to the agent. Only Ed25519 and X509EC
+// signers hold a key the agent can use.
+func (a *Agent) Add(s *Signer) error {
+	if s.External != nil || (s.Type() != 1 && s.Type() != 2) {
+		return errors.New("agent only holds ed25519 and x509ec keys")
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.signers[agentKey(s.Identity())] = s
+	return nil
+}
+
+// Listen creates the UNIX socket at socketPath, which only the user running
+// the agent can access, and serves the clients in the background until
+// Close is called.
+func (a *Agent) Listen(socketPath string) error {
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	a.Lock()
+	a.listener = l
+	a.Unlock()
+	go a.serve(l)
+	return nil
+}
+
+// Close stops the agent and removes its socket.
+func (a *Agent) Close() error {
+	a.Lock()
+	defer a.Unlock()
+	if a.listener == nil {
+		return errors.New("agent is not listening")
+	}
+	err := a.listener.Close()
+	a.listener = nil
+	return err
+}
+
+func (a *Agent) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go a.handle(conn)
+	}
+}
+
+// handle answers the requests of a client until it closes the connection.
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req := &agentRequest{}
+		if err := readAgentMessage(conn, req); err != nil {
+			if err != io.EOF {
+				log.Error("agent couldn't read request:", err)
+			}
+			return
+		}
+		reply := &agentReply{}
+		a.Lock()
+		s := a.signers[agentKey(&req.Identity)]
+		a.Unlock()
+		if s == nil {
+			reply.Error = "no key for " + req.Identity.PolicyString()
+		} else if sig, err := s.Sign(req.Message); err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply.Signature = sig
+		}
+		if err := writeAgentMessage(conn, reply); err != nil {
+			log.Error("agent couldn't write reply:", err)
+			return
+		}
+	}
+}
+
+// NewSignerAgent returns a signer for the identity that asks the agent
+// listening at socketPath for the signatures.
+func NewSignerAgent(socketPath string, identity *Identity) *Signer {
+	return NewSignerExternal(identity, func(msg []byte) ([]byte, error) {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if err := writeAgentMessage(conn, &agentRequest{Identity: *identity, Message: msg}); err != nil {
+			return nil, err
+		}
+		reply := &agentReply{}
+		if err := readAgentMessage(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply.Error != "" {
+			return nil, errors.New("agent: " + reply.Error)
+		}
+		return reply.Signature, nil
+	})
+}
+
+// agentKey returns the key of the identity, without its validity.
+func agentKey(id *Identity) string {
+	key := *id
+	key.Validity = nil
+	return key.PolicyString()
+}
+
+func writeAgentMessage(w io.Writer, msg interface{}) error {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxAgentMessage {
+		return errors.New("agent message is too big")
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(buf)))
+	_, err = w.Write(append(size[:], buf...))
+	return err
+}
+
+func readAgentMessage(r io.Reader, msg interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(size[:]) > maxAgentMessage {
+		return errors.New("agent message is too big")
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return protobuf.DecodeWithConstructors(buf, msg, network.DefaultConstructors(cothority.Suite))
+}
@@ -0,0 +1,43 @@
+package darc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+
+	td := createDarc("agent")
+	agent := NewAgent()
+	require.Nil(t, agent.Add(td.users[0]))
+	require.NotNil(t, agent.Add(NewSignerDID("did:example:1", td.users[1])))
+	require.Nil(t, agent.Listen(socket))
+	info, err := os.Stat(socket)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A request signed by the agent verifies like one signed with the key.
+	signer := NewSignerAgent(socket, td.usersI[0])
+	path := NewSignaturePath([]*Darc{td.darc}, *td.usersI[0], User)
+	msg := []byte("request")
+	sig, err := NewDarcSignature(msg, path, signer)
+	require.Nil(t, err)
+	require.Nil(t, sig.Verify(msg, td.darc))
+
+	// The agent doesn't hold the key of the second user.
+	_, err = NewSignerAgent(socket, td.usersI[1]).Sign(msg)
+	require.NotNil(t, err)
+
+	require.Nil(t, agent.Close())
+	_, err = signer.Sign(msg)
+	require.NotNil(t, err)
+	require.NotNil(t, agent.Close())
+}
@@ -0,0 +1,203 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements aliases, or petnames, like "alias:alice", that can be
+// used in the rules of darcs instead of a concrete identity. The aliases are
+// bound to identities by a mapping darc, whose description holds one
+// "<name> = <identity>" line per alias. The mapping darc is evolved like
+// any other darc, signed by its owners, and every darc using an alias
+// follows the latest version of the mapping without being evolved itself.
+// The registry returning the latest mapping darc is set with
+// SetAliasRegistry.
+
+// AliasRegistry returns the latest version of the mapping darc with the
+// given base-id.
+type AliasRegistry func(base ID) (*Darc, error)
+
+var aliasRegistry = struct {
+	sync.Mutex
+	base   ID
+	latest AliasRegistry
+}{}
+
+// SetAliasRegistry uses the mapping darc with the given base-id to resolve
+// aliases, replacing the registry set before. A nil registry disables
+// aliases.
+func SetAliasRegistry(base ID, latest AliasRegistry) {
+	aliasRegistry.Lock()
+	defer aliasRegistry.Unlock()
+	aliasRegistry.base = base
+	aliasRegistry.latest = latest
+}
+
+// NewIdentityAlias returns an identity for the given alias.
+func NewIdentityAlias(name string) *Identity {
+	return &Identity{
+		Alias: &IdentityAlias{
+			Name: name,
+		},
+	}
+}
+
+// Equal returns true if both IdentityAlias hold the same name.
+func (ida *IdentityAlias) Equal(ida2 *IdentityAlias) bool {
+	return ida.Name == ida2.Name
+}
+
+// Verify resolves the alias and returns nil if the identity it is bound to
+// is valid and verifies the signature.
+func (ida *IdentityAlias) Verify(msg, sig []byte) error {
+	id, err := ida.Resolve()
+	if err != nil {
+		return err
+	}
+	if !id.Validity.Contains(time.Now()) {
+		return ErrNotValid
+	}
+	return id.Verify(msg, sig)
+}
+
+// Resolve returns the identity the alias is bound to in the latest version
+// of the mapping darc.
+func (ida *IdentityAlias) Resolve() (*Identity, error) {
+	aliasRegistry.Lock()
+	base, latest := aliasRegistry.base, aliasRegistry.latest
+	aliasRegistry.Unlock()
+	if latest == nil {
+		return nil, errors.New("no alias registry")
+	}
+	mapping, err := latest(base)
+	if err != nil {
+		return nil, errors.New("couldn't get alias mapping: " + err.Error())
+	}
+	if !mapping.GetBaseID().Equal(base) {
+		return nil, errors.New("alias mapping of wrong darc")
+	}
+	if err := mapping.Verify(); err != nil {
+		return nil, errors.New("invalid alias mapping: " + err.Error())
+	}
+	aliases, err := mapping.Aliases()
+	if err != nil {
+		return nil, err
+	}
+	id, ok := aliases[ida.Name]
+	if !ok {
+		return nil, errors.New("unknown alias " + ida.Name)
+	}
+	return id, nil
+}
+
+// NewSignerAlias returns a signer for the alias, signing with key. The key
+// has to be the one the alias is bound to, else signing fails, as the
+// signatures of external signers are checked against their identity.
+func NewSignerAlias(name string, key *Signer) *Signer {
+	return NewSignerExternal(NewIdentityAlias(name), key.Sign)
+}
+
+// NewAliasDarc returns a mapping darc binding the aliases to the given
+// identities, which can be evolved by the owners.
+func NewAliasDarc(owners []*Identity, aliases map[string]*Identity) (*Darc, error) {
+	desc, err := aliasDescription(aliases)
+	if err != nil {
+		return nil, err
+	}
+	return NewDarc(&owners, nil, desc), nil
+}
+
+// SetAliases replaces the aliases of a mapping darc. The darc has to be
+// evolved afterwards.
+func (d *Darc) SetAliases(aliases map[string]*Identity) error {
+	desc, err := aliasDescription(aliases)
+	if err != nil {
+		return err
+	}
+	d.Description = &desc
+	return nil
+}
+
+// Aliases returns the aliases bound by a mapping darc.
+func (d *Darc) Aliases() (map[string]*Identity, error) {
+	aliases := make(map[string]*Identity)
+	for i, line := range strings.Split(string(description(d)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing '=' in alias line %d", i+1)
+		}
+		name := strings.TrimSpace(parts[0])
+		if err := checkAliasName(name); err != nil {
+			return nil, err
+		}
+		if _, ok := aliases[name]; ok {
+			return nil, errors.New("alias " + name + " bound twice")
+		}
+		id, err := ParseIdentity(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity in alias line %d: %s", i+1, err)
+		}
+		if err := checkAliasTarget(id); err != nil {
+			return nil, err
+		}
+		aliases[name] = id
+	}
+	return aliases, nil
+}
+
+// aliasDescription returns the description of a mapping darc, with the
+// aliases sorted so the same mapping always gives the same darc.
+func aliasDescription(aliases map[string]*Identity) ([]byte, error) {
+	var names []string
+	for name, id := range aliases {
+		if err := checkAliasName(name); err != nil {
+			return nil, err
+		}
+		if err := checkAliasTarget(id); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, name+" = "+aliases[name].PolicyString())
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// checkAliasName makes sure the name can be written in a policy.
+func checkAliasName(name string) error {
+	if name == "" {
+		return errors.New("empty alias")
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			c != '.' && c != '_' && c != '-' {
+			return errors.New("invalid character in alias " + name)
+		}
+	}
+	return nil
+}
+
+// checkAliasTarget makes sure an alias is bound to an identity that can
+// verify a signature itself, so no alias can point to another alias.
+func checkAliasTarget(id *Identity) error {
+	if id == nil {
+		return errors.New("alias bound to empty identity")
+	}
+	switch id.Type() {
+	case 1, 2, 3, 4, 5, 6, 9:
+		return id.validate()
+	}
+	return errors.New("alias must be bound to a key")
+}
@@ -0,0 +1,147 @@
+package darc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityAlias(t *testing.T) {
+	msg := []byte("document")
+	admin := NewSignerEd25519(nil, nil)
+	key1 := NewSignerEd25519(nil, nil)
+	key2 := NewSignerEd25519(nil, nil)
+
+	mapping, err := NewAliasDarc([]*Identity{admin.Identity()},
+		map[string]*Identity{"alice": key1.Identity()})
+	require.Nil(t, err)
+	latest := mapping
+	SetAliasRegistry(mapping.GetBaseID(), func(base ID) (*Darc, error) {
+		return latest, nil
+	})
+	defer SetAliasRegistry(nil, nil)
+
+	alice := NewIdentityAlias("alice")
+	require.Nil(t, alice.validate())
+	require.Equal(t, 7, alice.Type())
+	require.True(t, alice.Equal(NewIdentityAlias("alice")))
+	require.False(t, alice.Equal(NewIdentityAlias("bob")))
+
+	d := NewDarc(nil, &[]*Identity{alice}, nil)
+	path := NewSignaturePath([]*Darc{d}, *alice, User)
+	ds, err := NewDarcSignature(msg, path, NewSignerAlias("alice", key1))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+	// A key the alias is not bound to can't sign.
+	_, err = NewDarcSignature(msg, path, NewSignerAlias("alice", key2))
+	require.NotNil(t, err)
+
+	// Evolving the mapping rebinds the alias without touching the darc.
+	evolved := mapping.Copy()
+	require.Nil(t, evolved.SetAliases(map[string]*Identity{"alice": key2.Identity()}))
+	require.Nil(t, evolved.SetEvolution(mapping, nil, admin))
+	latest = evolved
+	require.NotNil(t, ds.Verify(msg, d))
+	ds, err = NewDarcSignature(msg, path, NewSignerAlias("alice", key2))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+	_, err = NewDarcSignature(msg, path, NewSignerAlias("alice", key1))
+	require.NotNil(t, err)
+
+	// An evolution not signed by an owner of the mapping is refused.
+	forged := mapping.Copy()
+	require.Nil(t, forged.SetAliases(map[string]*Identity{"alice": key1.Identity()}))
+	require.Nil(t, forged.SetEvolution(mapping, nil, key1))
+	latest = forged
+	_, err = alice.Alias.Resolve()
+	require.NotNil(t, err)
+
+	// A mapping of another darc is refused.
+	other, err := NewAliasDarc([]*Identity{key1.Identity()},
+		map[string]*Identity{"alice": key1.Identity()})
+	require.Nil(t, err)
+	latest = other
+	_, err = alice.Alias.Resolve()
+	require.NotNil(t, err)
+
+	latest = evolved
+	_, err = NewIdentityAlias("bob").Alias.Resolve()
+	require.NotNil(t, err)
+
+	SetAliasRegistry(mapping.GetBaseID(), func(base ID) (*Darc, error) {
+		return nil, errors.New("not found")
+	})
+	_, err = alice.Alias.Resolve()
+	require.NotNil(t, err)
+	SetAliasRegistry(nil, nil)
+	_, err = alice.Alias.Resolve()
+	require.NotNil(t, err)
+}
+
+func TestIdentityAlias_Validity(t *testing.T) {
+	msg := []byte("document")
+	key := NewSignerEd25519(nil, nil)
+	expired := key.Identity()
+	expired.SetValidity(time.Time{}, time.Now().Add(-time.Hour))
+	mapping, err := NewAliasDarc(nil, map[string]*Identity{"alice": expired})
+	require.Nil(t, err)
+	SetAliasRegistry(mapping.GetBaseID(), func(base ID) (*Darc, error) {
+		return mapping, nil
+	})
+	defer SetAliasRegistry(nil, nil)
+
+	sig, err := key.Sign(msg)
+	require.Nil(t, err)
+	require.Equal(t, ErrNotValid, NewIdentityAlias("alice").Verify(msg, sig))
+}
+
+func TestDarc_Aliases(t *testing.T) {
+	key := NewSignerEd25519(nil, nil)
+	aliases := map[string]*Identity{
+		"alice":   key.Identity(),
+		"bob.2":   NewIdentityDID("did:test:bob"),
+		"carol_c": NewIdentityOIDC("https://login.example.com", "carol"),
+	}
+	mapping, err := NewAliasDarc(nil, aliases)
+	require.Nil(t, err)
+	parsed, err := mapping.Aliases()
+	require.Nil(t, err)
+	require.Equal(t, len(aliases), len(parsed))
+	for name, id := range aliases {
+		require.True(t, id.Equal(parsed[name]), name)
+	}
+
+	for _, a := range []map[string]*Identity{
+		{"": key.Identity()},
+		{"al ice": key.Identity()},
+		{"alice": NewIdentityAlias("bob")},
+		{"alice": NewIdentityDarc(mapping.GetID())},
+		{"alice": nil},
+	} {
+		_, err := NewAliasDarc(nil, a)
+		require.NotNil(t, err)
+	}
+	for _, desc := range []string{
+		"alice",
+		"alice = alias:bob",
+		"alice = ed25519:zz",
+		"alice = " + key.Identity().PolicyString() + "\nalice = did:test:bob",
+	} {
+		d := NewDarc(nil, nil, []byte(desc))
+		_, err := d.Aliases()
+		require.NotNil(t, err, desc)
+	}
+}
+
+func TestParseIdentity_Alias(t *testing.T) {
+	id, err := ParseIdentity("alias:alice")
+	require.Nil(t, err)
+	require.True(t, id.Equal(NewIdentityAlias("alice")))
+	require.Equal(t, "alias:alice", id.PolicyString())
+	_, err = ParseIdentity("alias:")
+	require.NotNil(t, err)
+	_, err = ParseIdentity("alias:a:b")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+package darc
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strconv"
+)
+
+// pemType is the type of the armored block holding a darc.
+const pemType = "DARC"
+
+// MarshalText returns the darc, including its signature, as an armored
+// block that can be pasted into emails or configuration files:
+//
+//	-----BEGIN DARC-----
+//	ID: <hex of the ID>
+//	Version: <version>
+//	Base-ID: <hex of the base ID>
+//
+//	<base64 of the darc as returned by Marshal>
+//	-----END DARC-----
+//
+// The headers are comments for the reader: UnmarshalText only checks that
+// the ID matches the darc.
+func (d *Darc) MarshalText() ([]byte, error) {
+	buf, err := d.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemType,
+		Headers: map[string]string{
+			"ID":      hex.EncodeToString(d.GetID()),
+			"Version": strconv.Itoa(d.Version),
+			"Base-ID": hex.EncodeToString(d.GetBaseID()),
+		},
+		Bytes: buf,
+	}), nil
+}
+
+// UnmarshalText reads a darc written by MarshalText. Text before and after
+// the armored block is ignored. The darc has to be valid, and its ID has to
+// match the ID header if there is one.
+func (d *Darc) UnmarshalText(text []byte) error {
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return errors.New("no armored darc found")
+	}
+	if block.Type != pemType {
+		return errors.New("armored block is not a darc: " + block.Type)
+	}
+	darc, err := NewDarcFromProto(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if id, ok := block.Headers["ID"]; ok && id != hex.EncodeToString(darc.GetID()) {
+		return errors.New("ID of the armored darc doesn't match")
+	}
+	*d = *darc
+	return nil
+}
@@ -0,0 +1,36 @@
+package darc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_MarshalText(t *testing.T) {
+	d := createDarc("testdarc").darc
+	owner := NewSignerEd25519(nil, nil)
+	d.AddOwner(owner.Identity())
+	dNew := d.Copy()
+	dNew.IncrementVersion()
+	require.Nil(t, dNew.SetEvolution(d, NewSignaturePath([]*Darc{d}, *owner.Identity(), User), owner))
+
+	text, err := dNew.MarshalText()
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(text), "-----BEGIN DARC-----\n"))
+	require.Contains(t, string(text), "Version: 1\n")
+
+	// The darc can be read back from a longer text, with its signature.
+	d2 := &Darc{}
+	require.Nil(t, d2.UnmarshalText(append([]byte("Please add:\n\n"), text...)))
+	require.Equal(t, dNew.GetID(), d2.GetID())
+	require.Equal(t, dNew.GetBaseID(), d2.GetBaseID())
+	require.Nil(t, d2.Verify())
+
+	require.NotNil(t, d2.UnmarshalText([]byte("no darc here")))
+	other := strings.Replace(string(text), "BEGIN DARC", "BEGIN KEY", 1)
+	other = strings.Replace(other, "END DARC", "END KEY", 1)
+	require.NotNil(t, d2.UnmarshalText([]byte(other)))
+	wrongID := strings.Replace(string(text), "\nID: ", "\nID: 00", 1)
+	require.NotNil(t, d2.UnmarshalText([]byte(wrongID)))
+}
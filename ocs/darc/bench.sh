@@ -0,0 +1,21 @@
+#!/usr/bin/env bash
+# Compares the output of 'go test -bench' in $2 with the baseline in $1 and
+# fails if a benchmark is more than MAX_REGRESSION percent slower.
+
+MAX_REGRESSION=${MAX_REGRESSION:-20}
+
+if [ ! -f "$1" ]; then
+	echo "No baseline in $1, record it with 'make bench_darc_baseline'"
+	exit 1
+fi
+
+awk -v max="$MAX_REGRESSION" '
+	FNR == NR && /^Benchmark/ { base[$1] = $3; next }
+	/^Benchmark/ && ($1 in base) {
+		change = ($3 - base[$1]) * 100 / base[$1]
+		printf "%-50s %12d ns/op %+7.1f%%\n", $1, $3, change
+		if (change > max) { failed = 1 }
+	}
+	END {
+		if (failed) { print "Regression of more than " max "%"; exit 1 }
+	}' "$1" "$2"
@@ -0,0 +1,93 @@
+package darc
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The benchmarks cover the verifications done for every read of the OCS.
+// `make bench_darc` compares them with a baseline recorded by
+// `make bench_darc_baseline`.
+
+// BenchmarkSignature_Verify verifies a signature of the last user of a darc
+// with a growing number of users.
+func BenchmarkSignature_Verify(b *testing.B) {
+	msg := []byte("document")
+	for _, n := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			var users []*Identity
+			for i := 0; i < n-1; i++ {
+				users = append(users, createIdentity())
+			}
+			signer, id := createSignerIdentity()
+			users = append(users, id)
+			d := NewDarc(nil, &users, nil)
+			ds, err := NewDarcSignature(msg, NewSignaturePath([]*Darc{d}, *id, User), signer)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := ds.Verify(msg, d); err != nil {
+					b.Fatal(err)
+				}
+				if err := ds.SignaturePath.Verify(User); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSignaturePath_Verify verifies paths of darcs where every darc has
+// the next one as user.
+func BenchmarkSignaturePath_Verify(b *testing.B) {
+	for _, n := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("length=%d", n), func(b *testing.B) {
+			darcs, id := delegation(n)
+			path := NewSignaturePath(darcs, *id, User)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := path.Verify(User); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDarc_Explain resolves the signers of a darc delegating to other
+// darcs 10 levels deep.
+func BenchmarkDarc_Explain(b *testing.B) {
+	darcs, _ := delegation(11)
+	byID := make(map[string]*Darc)
+	for _, d := range darcs {
+		byID[string(d.GetID())] = d
+	}
+	store := func(id ID) (*Darc, error) {
+		if d, ok := byID[string(id)]; ok {
+			return d, nil
+		}
+		return nil, fmt.Errorf("unknown darc %x", id)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sets, err := darcs[0].Explain(User, store)
+		if err != nil || len(sets) != 1 {
+			b.Fatal(err)
+		}
+	}
+}
+
+// delegation returns n darcs where every darc has the next one as its user,
+// and the last one the returned identity.
+func delegation(n int) ([]*Darc, *Identity) {
+	id := createIdentity()
+	darcs := make([]*Darc, n)
+	users := []*Identity{id}
+	for i := n - 1; i >= 0; i-- {
+		darcs[i] = NewDarc(nil, &users, []byte(fmt.Sprintf("level %d", i)))
+		users = []*Identity{NewIdentityDarc(darcs[i].GetID())}
+	}
+	return darcs, id
+}
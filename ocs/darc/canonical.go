@@ -0,0 +1,60 @@
+package darc
+
+import "bytes"
+
+// The ID of a darc is the hash of its protobuf encoding, which only depends
+// on the order of the fields of the structures and the order of the
+// identities, as darcs hold no maps. But some darcs with the same meaning
+// have different encodings, like a missing and an empty description, and
+// so different IDs. Canonical removes these differences. The encodings and
+// IDs of some canonical darcs, for other implementations to check against,
+// are written to testdata/ids.json by running TestDarc_IDVectors with
+// -update.
+
+// Canonical returns a copy of the darc, without signature, in which:
+//   - missing lists of owners and users, and a missing description, are
+//     replaced by empty ones
+//   - validities without bounds are removed
+//   - an empty list of resources, limits or quorums is removed
+//   - empty metadata is removed, and the tags and entries of the metadata
+//     are sorted
+//   - the base-id of the first version is removed
+//
+// The order of the identities is kept, as it is chosen by the owners.
+func (d *Darc) Canonical() *Darc {
+	c := d.Copy()
+	for _, list := range []**[]*Identity{&c.Owners, &c.Users} {
+		ids := []*Identity{}
+		for _, id := range identities(*list) {
+			cid := *id
+			if v := cid.Validity; v != nil && v.NotBefore == 0 && v.NotAfter == 0 {
+				cid.Validity = nil
+			}
+			ids = append(ids, &cid)
+		}
+		*list = &ids
+	}
+	if c.Description == nil {
+		c.Description = &[]byte{}
+	}
+	if len(c.Resources) == 0 {
+		c.Resources = nil
+	}
+	if len(c.Limits) == 0 {
+		c.Limits = nil
+	}
+	if len(c.Quorums) == 0 {
+		c.Quorums = nil
+	}
+	c.SetMetadata(c.Metadata)
+	if c.Version == 0 {
+		c.BaseID = nil
+	}
+	return c
+}
+
+// IsCanonical returns true if the darc has the same ID as its canonical
+// form.
+func (d *Darc) IsCanonical() bool {
+	return bytes.Equal(d.GetID(), d.Canonical().GetID())
+}
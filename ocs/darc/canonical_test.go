@@ -0,0 +1,120 @@
+package darc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+)
+
+var updateVectors = flag.Bool("update", false, "write testdata/ids.json")
+
+func TestDarc_Canonical(t *testing.T) {
+	td := createDarc("canonical")
+	require.True(t, td.darc.IsCanonical())
+	require.True(t, NewDarc(nil, nil, nil).IsCanonical())
+
+	// A missing description is the same as an empty one.
+	empty := td.darc.Copy()
+	empty.Description = &[]byte{}
+	d := td.darc.Copy()
+	d.Description = nil
+	require.False(t, d.IsCanonical())
+	require.Equal(t, empty.GetID(), d.Canonical().GetID())
+
+	d = td.darc.Copy()
+	id := *td.usersI[0]
+	id.Validity = &Validity{}
+	d.Users = &[]*Identity{&id, td.usersI[1]}
+	require.False(t, d.IsCanonical())
+	require.Equal(t, td.darc.GetID(), d.Canonical().GetID())
+	require.NotNil(t, id.Validity, "the darc is not changed")
+
+	d = td.darc.Copy()
+	d.BaseID = &ID{1}
+	d.Resources = [][]byte{}
+	require.Equal(t, td.darc.GetID(), d.Canonical().GetID())
+}
+
+// idVector is a darc given as policy, with its encoding and ID.
+type idVector struct {
+	Policy  string
+	Version int
+	BaseID  string
+	Proto   string
+	ID      string
+}
+
+// vectorKey returns the ed25519 identity of the fixed secret i.
+func vectorKey(i int64) string {
+	point := cothority.Suite.Point().Mul(cothority.Suite.Scalar().SetInt64(i), nil)
+	return NewIdentityEd25519(point).PolicyString()
+}
+
+func vectorDarcs() []*idVector {
+	return []*idVector{
+		{Policy: `description: ""`},
+		{Policy: `description: "owner and user"
+allow evolve: ` + vectorKey(1) + `
+allow sign: ` + vectorKey(2)},
+		{Policy: `description: "validity"
+allow sign: ` + vectorKey(2) + `[1500000000,0] | ` + vectorKey(3)},
+		{Policy: `description: "types"
+allow sign: darc:` + hex.EncodeToString(make([]byte, 32)) + ` | x509ec:0102 | secp256k1:0x` +
+			hex.EncodeToString(make([]byte, 20)) + ` | did:example:1234
+resource: 0102`},
+		{Policy: `description: "evolved"
+allow evolve: ` + vectorKey(1),
+			Version: 1, BaseID: hex.EncodeToString(make([]byte, 32))},
+	}
+}
+
+// TestDarc_IDVectors checks the encodings and IDs of testdata/ids.json.
+// Run it with -update to write the file after a deliberate change of the
+// encoding.
+func TestDarc_IDVectors(t *testing.T) {
+	file := filepath.Join("testdata", "ids.json")
+	vectors := vectorDarcs()
+	if !*updateVectors {
+		buf, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			t.Skip("no test vectors, create them with -update")
+		}
+		require.Nil(t, err)
+		vectors = nil
+		require.Nil(t, json.Unmarshal(buf, &vectors))
+	}
+	for _, v := range vectors {
+		d, err := ParsePolicy(v.Policy)
+		require.Nil(t, err)
+		d.Version = v.Version
+		if v.BaseID != "" {
+			base, err := hex.DecodeString(v.BaseID)
+			require.Nil(t, err)
+			id := ID(base)
+			d.BaseID = &id
+		}
+		require.True(t, d.IsCanonical(), v.Policy)
+		proto, err := d.ToProto()
+		require.Nil(t, err)
+		if *updateVectors {
+			v.Proto, v.ID = hex.EncodeToString(proto), hex.EncodeToString(d.GetID())
+			continue
+		}
+		require.Equal(t, v.Proto, hex.EncodeToString(proto), v.Policy)
+		require.Equal(t, v.ID, hex.EncodeToString(d.GetID()), v.Policy)
+	}
+	if *updateVectors {
+		buf, err := json.MarshalIndent(vectors, "", "  ")
+		require.Nil(t, err)
+		require.Nil(t, os.MkdirAll("testdata", 0755))
+		require.Nil(t, ioutil.WriteFile(file, append(buf, '\n'), 0644))
+	}
+}
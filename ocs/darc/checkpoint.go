@@ -0,0 +1,66 @@
+package darc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+)
+
+// CheckpointLifetime is the longest time before its expiration that a
+// checkpoint is accepted. A roster only signs the checkpoint of the latest
+// version of a darc, so once a new version is stored, the checkpoints of the
+// older versions can only be used for this long to link to the darc by its
+// base-id.
+var CheckpointLifetime = time.Hour
+
+// CheckpointMessage returns the message a roster signs for the checkpoint of
+// the darc with the given ID.
+func CheckpointMessage(id ID, expiration int64) []byte {
+	h := sha256.New()
+	h.Write([]byte("checkpoint:"))
+	h.Write(id)
+	binary.Write(h, binary.LittleEndian, expiration)
+	return h.Sum(nil)
+}
+
+// SetCheckpoint replaces the evolution signature of the darc with a
+// collective signature of a roster on CheckpointMessage. The previous darcs
+// are then not needed anymore to verify it, which keeps signature paths
+// going through this darc short. The roster must only sign the latest
+// version of a darc, after verifying its evolution.
+func (d *Darc) SetCheckpoint(sig []byte, expiration int64) {
+	d.Signature = nil
+	d.Checkpoint = &Checkpoint{Signature: sig, Expiration: expiration}
+}
+
+// VerifyCheckpoint returns nil if the checkpoint of the darc is valid at
+// when and signed by at least CheckpointThreshold of the given publics.
+func (d *Darc) VerifyCheckpoint(publics []kyber.Point, when time.Time) error {
+	if d.Checkpoint == nil {
+		return errors.New("darc has no checkpoint")
+	}
+	if d.BaseID == nil {
+		return errors.New("checkpoint without base-id")
+	}
+	if when.Unix() > d.Checkpoint.Expiration {
+		return errors.New("checkpoint expired")
+	}
+	if d.Checkpoint.Expiration > when.Add(CheckpointLifetime).Unix() {
+		return errors.New("checkpoint expires too late")
+	}
+	msg := CheckpointMessage(d.GetID(), d.Checkpoint.Expiration)
+	return cosi.Verify(cothority.Suite, publics, msg, d.Checkpoint.Signature,
+		cosi.NewThresholdPolicy(CheckpointThreshold(len(publics))))
+}
+
+// CheckpointThreshold returns how many of n nodes need to sign a
+// checkpoint. It is the same threshold as the one used for the forward-links
+// of skipchains.
+func CheckpointThreshold(n int) int {
+	return n - (n-1)/3
+}
@@ -0,0 +1,97 @@
+package darc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignaturePath_VerifyCheckpoints(t *testing.T) {
+	base := createDarc("base")
+	sub := createDarc("sub")
+	base.darc.AddUser(NewIdentityDarc(sub.darc.GetID()))
+
+	// Evolve the sub-darc twice.
+	path := []*Darc{base.darc, sub.darc}
+	latest := sub.darc
+	for i := 0; i < 2; i++ {
+		evolved := latest.Copy()
+		require.Nil(t, evolved.SetEvolution(latest, nil, sub.owners[0]))
+		path = append(path, evolved)
+		latest = evolved
+	}
+	sp := NewSignaturePath(path, *sub.usersI[0], User)
+	require.Nil(t, sp.Verify(User))
+
+	var kps []*key.Pair
+	for i := 0; i < 4; i++ {
+		kps = append(kps, key.NewKeyPair(cothority.Suite))
+	}
+	now := time.Now()
+	exp := now.Add(CheckpointLifetime).Unix()
+	checkpoint := latest.Copy()
+	publics, sig := cosign(t, CheckpointMessage(checkpoint.GetID(), exp), kps, 3)
+	checkpoint.SetCheckpoint(sig, exp)
+	require.Nil(t, checkpoint.VerifyCheckpoint(publics, now))
+
+	sp = NewSignaturePath([]*Darc{base.darc, checkpoint}, *sub.usersI[0], User)
+	require.Nil(t, sp.VerifyCheckpoints(User, now, publics))
+	require.NotNil(t, sp.Verify(User))
+
+	// The checkpoint of an older version only links to the darc until it
+	// expires.
+	require.NotNil(t, sp.VerifyCheckpoints(User, now.Add(2*CheckpointLifetime), publics))
+	// The expiration is signed.
+	checkpoint.SetCheckpoint(sig, exp-1)
+	require.NotNil(t, sp.VerifyCheckpoints(User, now, publics))
+
+	// Checkpoints expiring too late are refused.
+	exp = now.Add(2 * CheckpointLifetime).Unix()
+	_, sig = cosign(t, CheckpointMessage(checkpoint.GetID(), exp), kps, 3)
+	checkpoint.SetCheckpoint(sig, exp)
+	require.NotNil(t, sp.VerifyCheckpoints(User, now, publics))
+
+	// Not enough signers.
+	exp = now.Add(CheckpointLifetime).Unix()
+	_, sig = cosign(t, CheckpointMessage(checkpoint.GetID(), exp), kps, 2)
+	checkpoint.SetCheckpoint(sig, exp)
+	require.NotNil(t, sp.VerifyCheckpoints(User, now, publics))
+}
+
+// cosign returns the public keys and a collective signature on msg from the
+// first n key pairs.
+func cosign(t *testing.T, msg []byte, kps []*key.Pair, n int) ([]kyber.Point, []byte) {
+	suite := cothority.Suite
+	var publics []kyber.Point
+	for _, kp := range kps {
+		publics = append(publics, kp.Public)
+	}
+	mask, err := cosi.NewMask(suite, publics, nil)
+	require.Nil(t, err)
+	var secrets []kyber.Scalar
+	commitment := suite.Point().Null()
+	for i := 0; i < n; i++ {
+		s, c := cosi.Commit(suite)
+		secrets = append(secrets, s)
+		commitment.Add(commitment, c)
+		require.Nil(t, mask.SetBit(i, true))
+	}
+	challenge, err := cosi.Challenge(suite, commitment, mask.AggregatePublic, msg)
+	require.Nil(t, err)
+	var responses []kyber.Scalar
+	for i := 0; i < n; i++ {
+		r, err := cosi.Response(suite, kps[i].Private, secrets[i], challenge)
+		require.Nil(t, err)
+		responses = append(responses, r)
+	}
+	response, err := cosi.AggregateResponses(suite, responses)
+	require.Nil(t, err)
+	sig, err := cosi.Sign(suite, commitment, response, mask)
+	require.Nil(t, err)
+	return publics, sig
+}
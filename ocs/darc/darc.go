@@ -15,15 +15,19 @@ import (
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/dedis/cothority"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/dedis/protobuf"
 )
 
@@ -66,6 +70,18 @@ func (d *Darc) Copy() *Darc {
 		desc := *(d.Description)
 		dCopy.Description = &desc
 	}
+	if d.Resources != nil {
+		dCopy.Resources = append([][]byte{}, d.Resources...)
+	}
+	if d.Limits != nil {
+		dCopy.Limits = append([]*Limit{}, d.Limits...)
+	}
+	if d.Quorums != nil {
+		dCopy.Quorums = append([]*Quorum{}, d.Quorums...)
+	}
+	if d.Metadata != nil {
+		dCopy.Metadata = d.Metadata.Copy()
+	}
 	return dCopy
 }
 
@@ -86,12 +102,153 @@ func (d *Darc) ToProto() ([]byte, error) {
 	return b, nil
 }
 
-// NewDarcFromProto interprets a protobuf-representation of the darc and
-// returns a created Darc.
-func NewDarcFromProto(protoDarc []byte) *Darc {
+// NewDarcFromProto interprets a protobuf-representation of the darc, with
+// or without the format byte written by Marshal, and returns a created
+// Darc. Darcs of older formats are migrated to the current one. An error is
+// returned if the data cannot be decoded or if the resulting darc is not
+// valid.
+func NewDarcFromProto(protoDarc []byte) (*Darc, error) {
+	d, _, err := decodeDarc(protoDarc)
+	return d, err
+}
+
+// NewDarcFromProtoStrict works like NewDarcFromProto, but also makes sure
+// that encoding the darc again gives the same data. This rejects unknown
+// fields and non-canonical encodings.
+func NewDarcFromProtoStrict(protoDarc []byte) (*Darc, error) {
+	d, payload, err := decodeDarc(protoDarc)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := protobuf.Encode(d)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf, payload) {
+		return nil, errors.New("darc is not canonically encoded")
+	}
+	return d, nil
+}
+
+// decodeDarc returns the valid darc in the data and its protobuf
+// representation in the current format.
+func decodeDarc(buf []byte) (*Darc, []byte, error) {
+	payload, err := migrate(buf)
+	if err != nil {
+		return nil, nil, err
+	}
 	d := &Darc{}
-	protobuf.Decode(protoDarc, d)
-	return d
+	err = protobuf.DecodeWithConstructors(payload, d, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, errors.New("couldn't decode darc: " + err.Error())
+	}
+	if err := d.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return d, payload, nil
+}
+
+// Validate does a structural check of the darc. It doesn't verify any
+// signature.
+func (d *Darc) Validate() error {
+	if d.Version < 0 {
+		return errors.New("negative version")
+	}
+	if d.Version > 0 && (d.BaseID == nil || len(*d.BaseID) != sha256.Size) {
+		return errors.New("evolved darc needs a valid base-id")
+	}
+	for role, list := range map[string]*[]*Identity{"owner": d.Owners, "user": d.Users} {
+		for i, id := range identities(list) {
+			if err := id.validate(); err != nil {
+				return fmt.Errorf("%s %d: %s", role, i, err)
+			}
+		}
+	}
+	for i, r := range d.Resources {
+		if len(r) == 0 {
+			return fmt.Errorf("resource %d: empty id", i)
+		}
+	}
+	actions := make(map[string]bool)
+	for i, l := range d.Limits {
+		if l == nil || l.Action == "" || l.MaxPerHour <= 0 {
+			return fmt.Errorf("limit %d: needs an action and a positive maximum", i)
+		}
+		if actions[l.Action] {
+			return fmt.Errorf("limit %d: action '%s' is already limited", i, l.Action)
+		}
+		actions[l.Action] = true
+	}
+	quorums := make(map[string]bool)
+	for i, q := range d.Quorums {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("quorum %d: %s", i, err)
+		}
+		if quorums[q.Action] {
+			return fmt.Errorf("quorum %d: action '%s' already has a quorum", i, q.Action)
+		}
+		quorums[q.Action] = true
+	}
+	if d.Metadata != nil {
+		if err := d.Metadata.validate(); err != nil {
+			return fmt.Errorf("metadata: %s", err)
+		}
+	}
+	return nil
+}
+
+// validate makes sure that exactly one type of identity is set and that it
+// holds a key.
+func (id *Identity) validate() error {
+	if id == nil {
+		return errors.New("empty identity")
+	}
+	set := 0
+	for _, isSet := range []bool{id.Darc != nil, id.Ed25519 != nil, id.X509EC != nil,
+		id.Secp256k1 != nil, id.DID != nil, id.OIDC != nil, id.WebAuthn != nil,
+		id.Alias != nil, id.Pattern != nil, id.X509CA != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("identity needs exactly one type")
+	}
+	switch {
+	case id.Darc != nil && len(id.Darc.ID) != sha256.Size:
+		return errors.New("wrong length of darc-id")
+	case id.Ed25519 != nil && id.Ed25519.Point == nil:
+		return errors.New("missing ed25519 point")
+	case id.X509EC != nil && len(id.X509EC.Public) == 0:
+		return errors.New("missing x509ec public key")
+	case id.Secp256k1 != nil && len(id.Secp256k1.Address) != addressLength:
+		return errors.New("wrong length of secp256k1 address")
+	case id.DID != nil:
+		if _, err := didMethod(id.DID.DID); err != nil {
+			return err
+		}
+	case id.OIDC != nil && (id.OIDC.Issuer == "" || id.OIDC.Subject == ""):
+		return errors.New("missing oidc issuer or subject")
+	case id.WebAuthn != nil && (id.WebAuthn.RPID == "" || len(id.WebAuthn.PublicKey) == 0):
+		return errors.New("missing webauthn relying party or key")
+	case id.Alias != nil:
+		if err := checkAliasName(id.Alias.Name); err != nil {
+			return err
+		}
+	case id.Pattern != nil:
+		if err := checkPattern(id.Pattern.Pattern); err != nil {
+			return err
+		}
+	case id.X509CA != nil:
+		if _, err := x509.ParseCertificate(id.X509CA.Root); err != nil {
+			return errors.New("invalid x509ca certificate: " + err.Error())
+		}
+	}
+	if v := id.Validity; v != nil && v.NotBefore != 0 && v.NotAfter != 0 &&
+		v.NotAfter < v.NotBefore {
+		return errors.New("validity ends before it starts")
+	}
+	return nil
 }
 
 // GetID returns the hash of the protobuf-representation of the Darc as its Id.
@@ -123,12 +280,10 @@ func (d *Darc) GetBaseID() ID {
 
 // AddUser adds a given user to the list of Users in the Darc
 // Use as 'Darc.AddUser(user)'
+// Like all changes of the identities, it replaces the list instead of
+// modifying it, so that darcs sharing the list are not affected.
 func (d *Darc) AddUser(user *Identity) []*Identity {
-	var users []*Identity
-	if d.Users != nil {
-		users = *d.Users
-	}
-	users = append(users, user)
+	users := withIdentity(d.Users, user)
 	d.Users = &users
 	return *d.Users
 }
@@ -136,15 +291,21 @@ func (d *Darc) AddUser(user *Identity) []*Identity {
 // AddOwner adds a given user to the list of Users in the Darc
 // Use as 'Darc.AddUser(user)'
 func (d *Darc) AddOwner(owner *Identity) []*Identity {
-	var owners []*Identity
-	if d.Owners != nil {
-		owners = *d.Owners
-	}
-	owners = append(owners, owner)
+	owners := withIdentity(d.Owners, owner)
 	d.Owners = &owners
 	return owners
 }
 
+// withIdentity returns a new list holding the identities and id.
+func withIdentity(ids *[]*Identity, id *Identity) []*Identity {
+	var list []*Identity
+	if ids != nil {
+		list = make([]*Identity, 0, len(*ids)+1)
+		list = append(list, *ids...)
+	}
+	return append(list, id)
+}
+
 // RemoveUser removes s a given user from the list of Users in the Darc
 // Use as 'Darc.RemoveUser(user)'
 func (d *Darc) RemoveUser(user *Identity) ([]*Identity, error) {
@@ -162,8 +323,8 @@ func (d *Darc) RemoveUser(user *Identity) ([]*Identity, error) {
 	if userIndex == -1 { // If initial index has not changed
 		return nil, errors.New("user cannot be removed because it is not in the darc")
 	}
-	// Actually removing the userIndexth element
-	users = append(users[:userIndex], users[userIndex+1:]...)
+	// Actually removing the userIndexth element, in a new list
+	users = append(append([]*Identity{}, users[:userIndex]...), users[userIndex+1:]...)
 	d.Users = &users
 	return *d.Users, nil
 }
@@ -228,17 +389,29 @@ func (d *Darc) IncrementVersion() {
 // Verify returns nil if the verification is OK, or an error
 // if something is wrong.
 func (d Darc) Verify() error {
+	return d.verify(time.Now(), nil)
+}
+
+// verify checks the evolution of the darc. If publics is given, a darc
+// with a checkpoint instead of a signature is verified against it.
+func (d Darc) verify(when time.Time, publics []kyber.Point) error {
 	if d.Version == 0 {
 		return nil
 	}
+	if d.Signature == nil && d.Checkpoint != nil {
+		if publics == nil {
+			return errors.New("need a roster to verify a checkpoint")
+		}
+		return d.VerifyCheckpoint(publics, when)
+	}
 	if d.Signature == nil || len(d.Signature.Signature) == 0 {
-		return errors.New("No signature available")
+		return ErrMissingSignature
 	}
 	latest, err := d.GetLatest()
 	if err != nil {
 		return err
 	}
-	if err := d.Signature.SignaturePath.Verify(Owner); err != nil {
+	if err := d.Signature.SignaturePath.verify(Owner, when, publics); err != nil {
 		return err
 	}
 	return d.Signature.Verify(d.GetID(), latest)
@@ -255,7 +428,7 @@ func (d Darc) GetLatest() (*Darc, error) {
 	}
 	prev := (*d.Signature.SignaturePath.Darcs)[0]
 	if prev.Version+1 != d.Version {
-		return nil, errors.New("not clean evolution - version mismatch")
+		return nil, ErrVersionMismatch
 	}
 	return prev, nil
 }
@@ -307,19 +480,150 @@ func (ds *Signature) Verify(msg []byte, base *Darc) error {
 		return errors.New("Base-darc is missing")
 	}
 	if ds.SignaturePath.Darcs == nil || len(*ds.SignaturePath.Darcs) == 0 {
-		return errors.New("No path stored in signaturepath")
+		return ErrMissingPath
 	}
 	sigBase := (*ds.SignaturePath.Darcs)[0].GetID()
 	if !sigBase.Equal(base.GetID()) {
 		return errors.New("Base-darc is not at root of path")
 	}
-	hash, err := ds.SignaturePath.SigHash(msg)
+	hash, err := ds.Hash(msg)
 	if err != nil {
 		return err
 	}
 	return ds.SignaturePath.Signer.Verify(hash, ds.Signature)
 }
 
+// NewDarcSignatureNonce creates a darc signature like NewDarcSignature, but
+// adds a random nonce and an expiration time to the signed hash. Such a
+// signature can be checked against replays using VerifyReplay, which only
+// has to remember the nonce until the signature expires.
+func NewDarcSignatureNonce(msg []byte, sigpath *SignaturePath, signer *Signer,
+	expiration time.Time) (*Signature, error) {
+	if sigpath == nil || signer == nil {
+		return nil, errors.New("signature path or signer are missing")
+	}
+	if expiration.IsZero() {
+		return nil, errors.New("signature with nonce needs an expiration")
+	}
+	ds := &Signature{SignaturePath: *sigpath, Nonce: make([]byte, 32),
+		Expiration: expiration.Unix()}
+	random.Bytes(ds.Nonce, random.New())
+	hash, err := ds.Hash(msg)
+	if err != nil {
+		return nil, err
+	}
+	ds.Signature, err = signer.Sign(hash)
+	if err != nil {
+		return nil, errors.New("failed to sign a hash")
+	}
+	return ds, nil
+}
+
+// Hash returns the hash that is signed. Without a nonce, an expiration and
+// a context it is the same as SignaturePath.SigHash, else they are appended
+// to the hash. Missing and empty fields are the same, as the protobuf
+// decoding returns empty slices.
+func (ds *Signature) Hash(msg []byte) ([]byte, error) {
+	if len(ds.Nonce) == 0 && ds.Expiration == 0 && len(ds.Context) == 0 {
+		return ds.SignaturePath.SigHash(msg)
+	}
+	h := sha256.New()
+	for _, b := range [][]byte{ds.SignaturePath.GetPathMsg(), msg, ds.Nonce} {
+		if _, err := h.Write(b); err != nil {
+			return nil, err
+		}
+	}
+	if err := binary.Write(h, binary.LittleEndian, ds.Expiration); err != nil {
+		return nil, err
+	}
+	if len(ds.Context) > 0 {
+		// The length is prepended, so that no context is the prefix of
+		// another one in the hash.
+		if err := binary.Write(h, binary.LittleEndian, int64(len(ds.Context))); err != nil {
+			return nil, err
+		}
+		if _, err := h.Write(ds.Context); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// NewDarcSignatureContext creates a darc signature like NewDarcSignature,
+// but binds it to the given context, which is usually the name of the
+// service the signature is meant for. The service checks the context with
+// CheckContext.
+func NewDarcSignatureContext(msg []byte, sigpath *SignaturePath, signer *Signer,
+	context []byte) (*Signature, error) {
+	if sigpath == nil || signer == nil {
+		return nil, errors.New("signature path or signer are missing")
+	}
+	if len(context) == 0 {
+		return nil, errors.New("empty context")
+	}
+	ds := &Signature{SignaturePath: *sigpath, Context: context}
+	hash, err := ds.Hash(msg)
+	if err != nil {
+		return nil, err
+	}
+	ds.Signature, err = signer.Sign(hash)
+	if err != nil {
+		return nil, errors.New("failed to sign a hash")
+	}
+	return ds, nil
+}
+
+// CheckContext returns an error if the signature is not bound to the given
+// context. Signatures without a context are refused too, else they could
+// be replayed to any service.
+func (ds *Signature) CheckContext(context []byte) error {
+	if len(ds.Context) == 0 {
+		return errors.New("signature is not bound to a context")
+	}
+	if !bytes.Equal(ds.Context, context) {
+		return errors.New("signature is for another context")
+	}
+	return nil
+}
+
+// MaxNonceLifetime is the longest time before its expiration that a
+// signature is accepted by VerifyReplay, so that the caches don't have to
+// keep the nonces for longer.
+var MaxNonceLifetime = 24 * time.Hour
+
+// VerifyReplay checks the signature like VerifyAt, makes sure it didn't
+// expire, and asks the cache whether the nonce has already been seen. A
+// signature without a nonce or an expiration, or that expires more than
+// MaxNonceLifetime after when, is refused.
+func (ds *Signature) VerifyReplay(msg []byte, base *Darc, when time.Time, cache ReplayCache) error {
+	if len(ds.Nonce) == 0 {
+		return errors.New("signature has no nonce")
+	}
+	if ds.Expiration == 0 {
+		return errors.New("signature has no expiration")
+	}
+	if when.Unix() > ds.Expiration {
+		return errors.New("signature expired")
+	}
+	if ds.Expiration > when.Add(MaxNonceLifetime).Unix() {
+		return errors.New("signature expires too late")
+	}
+	if err := ds.VerifyAt(msg, base, when); err != nil {
+		return err
+	}
+	return cache.Add(ds.Nonce, ds.Expiration)
+}
+
+// VerifyAt checks the signature like Verify, and additionally verifies the
+// signature path for the role stored in it, evaluating the Validity of all
+// identities at the given time.
+func (ds *Signature) VerifyAt(msg []byte, base *Darc, when time.Time) error {
+	if err := ds.Verify(msg, base); err != nil {
+		return err
+	}
+	return ds.SignaturePath.VerifyAt(ds.SignaturePath.Role, when)
+}
+
 // NewSignaturePath returns an initialized SignaturePath structure.
 func NewSignaturePath(darcs []*Darc, signer Identity, role Role) *SignaturePath {
 	return &SignaturePath{
@@ -350,7 +654,12 @@ func (sigpath *SignaturePath) GetPathMsg() []byte {
 		return []byte{}
 	}
 	var path []byte
-	if sigpath.Darcs == nil {
+	if sigpath.Darcs == nil && sigpath.IDs != nil {
+		// A compacted path gives the same message as the expanded one.
+		for _, id := range sigpath.IDs {
+			path = append(path, id...)
+		}
+	} else if sigpath.Darcs == nil {
 		path = []byte("online")
 	} else {
 		for _, darc := range *sigpath.Darcs {
@@ -362,10 +671,81 @@ func (sigpath *SignaturePath) GetPathMsg() []byte {
 
 // Verify makes sure that the path is a correctly evolving one (each next
 // darc should be referenced by the previous one) and that the signer
-// is present in the last darc.
+// is present in the last darc. Identities with a Validity are checked
+// against the current time.
 func (sigpath *SignaturePath) Verify(role Role) error {
-	if len(*sigpath.Darcs) == 0 {
-		return errors.New("no path stored")
+	return sigpath.VerifyAt(role, time.Now())
+}
+
+// VerifyAt works like Verify, but checks the Validity of the identities
+// in the path against the given time instead of the current time.
+func (sigpath *SignaturePath) VerifyAt(role Role, when time.Time) error {
+	return sigpath.verify(role, when, nil)
+}
+
+// VerifyCheckpoints works like VerifyAt, but also accepts darcs in the path
+// that hold a checkpoint signed by the given roster instead of their
+// evolution. A darc-link to such a darc can point to its base-id, as long as
+// the checkpoint didn't expire.
+func (sigpath *SignaturePath) VerifyCheckpoints(role Role, when time.Time, publics []kyber.Point) error {
+	if len(publics) == 0 {
+		return errors.New("no roster given")
+	}
+	return sigpath.verify(role, when, publics)
+}
+
+// ErrNotValid is returned by the verification of a signature path if the
+// signer, or a darc-link in the path, is outside of its Validity.
+var ErrNotValid = errors.New("signer in path is not valid at this time")
+
+// Errors returned by the verification of darcs and signature paths.
+// ErrSignerNotFound and ErrMissingLink deny a well-formed request, while the
+// other errors point to a malformed darc or path.
+var (
+	// ErrSignerNotFound is returned if the signer is not an identity of the
+	// last darc of the path with the role of the signature.
+	ErrSignerNotFound = errors.New("didn't find signer in last darc of path")
+	// ErrVersionMismatch is returned if a darc doesn't follow the previous
+	// version of its evolution.
+	ErrVersionMismatch = errors.New("not clean evolution - version mismatch")
+	// ErrMissingSignature is returned for an evolved darc without signature.
+	ErrMissingSignature = errors.New("No signature available")
+	// ErrMissingPath is returned for a signature without darcs in its path.
+	ErrMissingPath = errors.New("no path stored")
+)
+
+// ErrMissingLink is returned if a darc of a signature path doesn't link to
+// the next darc of the path.
+type ErrMissingLink struct {
+	// Position of the darc that isn't linked in the path
+	Position int
+}
+
+func (e ErrMissingLink) Error() string {
+	return fmt.Sprintf("didn't find valid darc-link in chain at position %d", e.Position)
+}
+
+// verify checks the path and passes the result to the hook set with
+// SetVerifyHook.
+func (sigpath *SignaturePath) verify(role Role, when time.Time, publics []kyber.Point) error {
+	start := time.Now()
+	err := sigpath.verifyPath(role, when, publics)
+	ev := &VerifyEvent{
+		Role:       role,
+		SignerType: sigpath.Signer.Type(),
+		Duration:   time.Since(start),
+		Err:        err,
+	}
+	if sigpath.Darcs != nil {
+		ev.PathLength = len(*sigpath.Darcs)
+	}
+	notifyVerify(ev)
+	return err
+}
+
+func (sigpath *SignaturePath) verifyPath(role Role, when time.Time, publics []kyber.Point) error {
+	if sigpath.Darcs == nil || len(*sigpath.Darcs) == 0 {
+		return ErrMissingPath
 	}
 	var previous *Darc
 	for n, d := range *sigpath.Darcs {
@@ -378,22 +758,37 @@ func (sigpath *SignaturePath) Verify(role Role) error {
 			if err != nil {
 				return errors.New("found incorrect darc in chain")
 			}
-			if latest != nil {
+			if latest != nil || d.Checkpoint != nil {
 				log.Lvlf2("Verifying evolution from %x", d.GetID())
-				if err := d.Verify(); err != nil {
+				if err := d.verify(when, publics); err != nil {
 					return errors.New("not correct evolution of darcs in path: " + err.Error())
 				}
 			}
+			// A darc with a checkpoint can also be linked by its base-id.
+			isLink := func(id *Identity) bool {
+				links := func(target ID) bool {
+					return (id.Darc != nil && id.Darc.ID.Equal(target)) ||
+						id.Pattern.Match(NewIdentityDarc(target))
+				}
+				if links(d.GetID()) {
+					return true
+				}
+				return d.Signature == nil && d.Checkpoint != nil &&
+					links(d.GetBaseID())
+			}
 			if latest == nil || bytes.Compare(latest.GetID(), previous.GetID()) != 0 {
 				// The darc link can only come from an owner of the first darc. Afterwards
 				// darc links have to be user-links.
-				found := false
+				found, expired := false, false
 				if role == Owner && n == 1 {
 					if previous.Owners != nil {
 						for _, id := range *previous.Owners {
-							if id.Darc != nil && id.Darc.ID.Equal(d.GetID()) {
-								found = true
-								break
+							if isLink(id) {
+								if id.Validity.Contains(when) {
+									found = true
+									break
+								}
+								expired = true
 							}
 						}
 					} else {
@@ -402,36 +797,48 @@ func (sigpath *SignaturePath) Verify(role Role) error {
 				} else {
 					if previous.Users != nil {
 						for _, id := range *previous.Users {
-							if id.Darc != nil && id.Darc.ID.Equal(d.GetID()) {
-								found = true
-								break
+							if isLink(id) {
+								if id.Validity.Contains(when) {
+									found = true
+									break
+								}
+								expired = true
 							}
 						}
 					} else {
 						return errors.New("no users defined for user signature")
 					}
 				}
+				if !found && expired {
+					return ErrNotValid
+				}
 				if !found {
-					return fmt.Errorf("didn't find valid darc-link in chain at position %d", n)
+					return ErrMissingLink{Position: n}
 				}
 			}
 		}
 		previous = d
 	}
-	if role == User {
-		for _, id := range *previous.Users {
-			if sigpath.Signer.Equal(id) {
-				return nil
-			}
-		}
-	} else {
-		for _, id := range *previous.Owners {
-			if sigpath.Signer.Equal(id) {
+	ids := previous.Users
+	if role == Owner {
+		ids = previous.Owners
+	}
+	if ids == nil || sigpath.Signer.Pattern != nil {
+		return ErrSignerNotFound
+	}
+	expired := false
+	for _, id := range *ids {
+		if sigpath.Signer.Equal(id) || id.Pattern.Match(&sigpath.Signer) {
+			if id.Validity.Contains(when) {
 				return nil
 			}
+			expired = true
 		}
 	}
-	return errors.New("didn't find signer in last darc of path")
+	if expired {
+		return ErrNotValid
+	}
+	return ErrSignerNotFound
 }
 
 // Type returns an integer representing the type of key held in the signer.
@@ -442,6 +849,8 @@ func (s *Signer) Type() int {
 		return 1
 	case s.X509EC != nil:
 		return 2
+	case s.External != nil && s.External.Public != nil:
+		return s.External.Public.Type()
 	default:
 		return -1
 	}
@@ -450,6 +859,9 @@ func (s *Signer) Type() int {
 // Identity returns an identity struct with the pre initialised fields
 // for the appropriate signer.
 func (s *Signer) Identity() *Identity {
+	if s.External != nil {
+		return s.External.Public
+	}
 	switch s.Type() {
 	case 1:
 		return &Identity{Ed25519: &IdentityEd25519{Point: s.Ed25519.Point}}
@@ -465,6 +877,9 @@ func (s *Signer) Sign(msg []byte) ([]byte, error) {
 	if msg == nil {
 		return nil, errors.New("nothing to sign, message is empty")
 	}
+	if s.External != nil {
+		return s.External.Sign(msg)
+	}
 	switch s.Type() {
 	case 0:
 		return nil, errors.New("cannot sign with a darc")
@@ -479,6 +894,9 @@ func (s *Signer) Sign(msg []byte) ([]byte, error) {
 
 // GetPrivate returns the private key, if one exists.
 func (s *Signer) GetPrivate() (kyber.Scalar, error) {
+	if s.External != nil {
+		return nil, errors.New("signer lacks a private key")
+	}
 	switch s.Type() {
 	case 1:
 		return s.Ed25519.Secret, nil
@@ -502,10 +920,64 @@ func (id *Identity) Equal(id2 *Identity) bool {
 		return id.Ed25519.Equal(id2.Ed25519)
 	case 2:
 		return id.X509EC.Equal(id2.X509EC)
+	case 3:
+		return id.Secp256k1.Equal(id2.Secp256k1)
+	case 4:
+		return id.DID.Equal(id2.DID)
+	case 5:
+		return id.OIDC.Equal(id2.OIDC)
+	case 6:
+		return id.WebAuthn.Equal(id2.WebAuthn)
+	case 7:
+		return id.Alias.Equal(id2.Alias)
+	case 8:
+		return id.Pattern.Equal(id2.Pattern)
+	case 9:
+		return id.X509CA.Equal(id2.X509CA)
 	}
 	return false
 }
 
+// SetValidity restricts the identity to the given time window. A zero
+// time.Time leaves that side of the window open.
+func (id *Identity) SetValidity(notBefore, notAfter time.Time) {
+	v := &Validity{}
+	if !notBefore.IsZero() {
+		v.NotBefore = notBefore.Unix()
+	}
+	if !notAfter.IsZero() {
+		v.NotAfter = notAfter.Unix()
+	}
+	id.Validity = v
+}
+
+// Contains returns true if the given time is inside the validity window.
+// A nil Validity contains all times.
+func (v *Validity) Contains(when time.Time) bool {
+	if v == nil {
+		return true
+	}
+	unix := when.Unix()
+	if v.NotBefore != 0 && unix < v.NotBefore {
+		return false
+	}
+	if v.NotAfter != 0 && unix > v.NotAfter {
+		return false
+	}
+	return true
+}
+
+// String returns the validity window in a human readable form.
+func (v *Validity) String() string {
+	bound := func(t int64) string {
+		if t == 0 {
+			return "-"
+		}
+		return time.Unix(t, 0).UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("[%s, %s]", bound(v.NotBefore), bound(v.NotAfter))
+}
+
 // Type returns an int indicating what type of identity this is. If all
 // identities are nil, it returns -1.
 func (id *Identity) Type() int {
@@ -516,12 +988,33 @@ func (id *Identity) Type() int {
 		return 1
 	case id.X509EC != nil:
 		return 2
+	case id.Secp256k1 != nil:
+		return 3
+	case id.DID != nil:
+		return 4
+	case id.OIDC != nil:
+		return 5
+	case id.WebAuthn != nil:
+		return 6
+	case id.Alias != nil:
+		return 7
+	case id.Pattern != nil:
+		return 8
+	case id.X509CA != nil:
+		return 9
 	}
 	return -1
 }
 
 // String returns the string representation of the identity
 func (id *Identity) String() string {
+	if id.Validity != nil {
+		return id.typeString() + " valid " + id.Validity.String()
+	}
+	return id.typeString()
+}
+
+func (id *Identity) typeString() string {
 	switch id.Type() {
 	case 0:
 		return fmt.Sprintf("Darc: %x", id.Darc.ID)
@@ -529,6 +1022,20 @@ func (id *Identity) String() string {
 		return fmt.Sprintf("Ed25519: %s", id.Ed25519.Point.String())
 	case 2:
 		return fmt.Sprintf("X509EC: %x", id.X509EC.Public)
+	case 3:
+		return fmt.Sprintf("Secp256k1: 0x%x", id.Secp256k1.Address)
+	case 4:
+		return fmt.Sprintf("DID: %s", id.DID.DID)
+	case 5:
+		return fmt.Sprintf("OIDC: %s %s", id.OIDC.Issuer, id.OIDC.Subject)
+	case 6:
+		return fmt.Sprintf("WebAuthn: %s %x", id.WebAuthn.RPID, id.WebAuthn.PublicKey)
+	case 7:
+		return fmt.Sprintf("Alias: %s", id.Alias.Name)
+	case 8:
+		return fmt.Sprintf("Pattern: %s", id.Pattern.Pattern)
+	case 9:
+		return fmt.Sprintf("X509CA: %x %s", id.X509CA.Root, id.X509CA.Subject)
 	default:
 		return fmt.Sprintf("No identity")
 	}
@@ -544,6 +1051,20 @@ func (id *Identity) Verify(msg, sig []byte) error {
 		return id.Ed25519.Verify(msg, sig)
 	case 2:
 		return id.X509EC.Verify(msg, sig)
+	case 3:
+		return id.Secp256k1.Verify(msg, sig)
+	case 4:
+		return id.DID.Verify(msg, sig)
+	case 5:
+		return id.OIDC.Verify(msg, sig)
+	case 6:
+		return id.WebAuthn.Verify(msg, sig)
+	case 7:
+		return id.Alias.Verify(msg, sig)
+	case 8:
+		return errors.New("cannot verify a pattern-signature")
+	case 9:
+		return id.X509CA.Verify(msg, sig)
 	default:
 		return errors.New("unknown identity")
 	}
@@ -580,6 +1101,9 @@ func (ide *IdentityEd25519) Equal(ide2 *IdentityEd25519) bool {
 // Verify returns nil if the signature is correct, or an error if something
 // fails.
 func (ide *IdentityEd25519) Verify(msg, sig []byte) error {
+	if isSSHSignature(sig) {
+		return ide.verifySSH(msg, sig)
+	}
 	return schnorr.Verify(cothority.Suite, ide.Point, msg, sig)
 }
 
@@ -649,3 +1173,40 @@ func NewSignerX509EC() *Signer {
 func (kcs *SignerX509EC) Sign(msg []byte) ([]byte, error) {
 	return nil, errors.New("not yet implemented")
 }
+
+// SignFunc returns the signature of msg. It is used by SignerExternal to
+// sign outside of this process.
+type SignFunc func(msg []byte) ([]byte, error)
+
+// SignerExternal delegates the signing to an HSM, a cloud KMS or a remote
+// agent, so that the private key doesn't have to be in memory. As it holds
+// a function, it is not part of the protobuf definition.
+type SignerExternal struct {
+	// Public is the identity corresponding to the private key used by
+	// SignFunc.
+	Public *Identity
+	// SignFunc is called for every signature.
+	SignFunc SignFunc
+}
+
+// NewSignerExternal returns a signer that calls signFunc to sign messages.
+// The signatures must verify under the given public identity.
+func NewSignerExternal(public *Identity, signFunc SignFunc) *Signer {
+	return &Signer{External: &SignerExternal{Public: public, SignFunc: signFunc}}
+}
+
+// Sign calls the external signing function and makes sure the signature
+// verifies, so that a misconfigured signer is detected early.
+func (es *SignerExternal) Sign(msg []byte) ([]byte, error) {
+	if es.SignFunc == nil || es.Public == nil {
+		return nil, errors.New("external signer is not initialised")
+	}
+	sig, err := es.SignFunc(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := es.Public.Verify(msg, sig); err != nil {
+		return nil, errors.New("external signature doesn't verify: " + err.Error())
+	}
+	return sig, nil
+}
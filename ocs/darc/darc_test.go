@@ -2,8 +2,12 @@ package darc
 
 import (
 	"testing"
+	"time"
 
+	"github.com/dedis/cothority"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,6 +49,52 @@ func TestDarc_Copy(t *testing.T) {
 	require.Equal(t, d1.GetID(), d2.GetID())
 }
 
+func TestNewDarcFromProto(t *testing.T) {
+	td := createDarc("testdarc")
+	buf, err := td.darc.ToProto()
+	require.Nil(t, err)
+	d, err := NewDarcFromProto(buf)
+	require.Nil(t, err)
+	require.Equal(t, td.darc.GetID(), d.GetID())
+	d, err = NewDarcFromProtoStrict(buf)
+	require.Nil(t, err)
+	require.Equal(t, td.darc.GetID(), d.GetID())
+
+	_, err = NewDarcFromProto([]byte{0xff, 0xff})
+	require.NotNil(t, err)
+	// An unknown field is accepted, except in strict mode. Field 15 is not
+	// used by the darc.
+	_, err = NewDarcFromProto(append(buf, 0x78, 0x01))
+	require.Nil(t, err)
+	_, err = NewDarcFromProtoStrict(append(buf, 0x78, 0x01))
+	require.NotNil(t, err)
+
+	// Evolved darcs need a base-id.
+	td.darc.Version = 1
+	buf, err = td.darc.ToProto()
+	require.Nil(t, err)
+	_, err = NewDarcFromProto(buf)
+	require.NotNil(t, err)
+}
+
+func TestDarc_Validate(t *testing.T) {
+	td := createDarc("testdarc")
+	require.Nil(t, td.darc.Validate())
+	td.darc.AddUser(&Identity{})
+	require.NotNil(t, td.darc.Validate())
+	(*td.darc.Users)[2] = NewIdentityDarc([]byte{1, 2, 3})
+	require.NotNil(t, td.darc.Validate())
+	id := *td.usersI[0]
+	id.X509EC = &IdentityX509EC{Public: []byte{1}}
+	(*td.darc.Users)[2] = &id
+	require.NotNil(t, td.darc.Validate())
+	(*td.darc.Users)[2] = createIdentity()
+	(*td.darc.Users)[2].Validity = &Validity{NotBefore: 10, NotAfter: 5}
+	require.NotNil(t, td.darc.Validate())
+	(*td.darc.Users)[2].Validity.NotAfter = 0
+	require.Nil(t, td.darc.Validate())
+}
+
 func TestDarc_AddUser(t *testing.T) {
 	d := createDarc("testdarc").darc
 	id := createIdentity()
@@ -62,6 +112,19 @@ func TestDarc_RemoveUser(t *testing.T) {
 	require.Equal(t, len(*d1.Users), len(*d2.Users))
 }
 
+func TestDarc_SharedIdentities(t *testing.T) {
+	td := createDarc("testdarc")
+	// The darc and its shallow copy share the list of users given to NewDarc.
+	shallow := *td.darc
+	first := td.usersI[0]
+	_, err := td.darc.RemoveUser(first)
+	require.Nil(t, err)
+	td.darc.AddUser(createIdentity())
+	require.Equal(t, 2, len(*shallow.Users))
+	require.Equal(t, first, (*shallow.Users)[0])
+	require.Equal(t, first, td.usersI[0])
+}
+
 func TestDarc_IncrementVersion(t *testing.T) {
 	d := createDarc("testdarc").darc
 	previousVersion := d.Version
@@ -125,6 +188,25 @@ func TestSignaturePath(t *testing.T) {
 	require.Nil(t, path.Verify(User))
 }
 
+func TestSignaturePath_Errors(t *testing.T) {
+	td1 := createDarc("testdarc")
+	td2 := createDarc("testdarc2")
+	path := NewSignaturePath([]*Darc{td1.darc, td2.darc}, *td2.usersI[0], User)
+	require.Equal(t, ErrMissingLink{Position: 1}, path.Verify(User))
+
+	path = NewSignaturePath([]*Darc{td1.darc}, *td2.usersI[0], User)
+	require.Equal(t, ErrSignerNotFound, path.Verify(User))
+	path = NewSignaturePath([]*Darc{}, *td1.usersI[0], User)
+	require.Equal(t, ErrMissingPath, path.Verify(User))
+
+	d := td1.darc.Copy()
+	d.IncrementVersion()
+	require.Equal(t, ErrMissingSignature, d.Verify())
+	require.Nil(t, d.SetEvolution(td1.darc, nil, td1.owners[0]))
+	d.Version++
+	require.Equal(t, ErrVersionMismatch, d.Verify())
+}
+
 func TestDarcSignature_Verify(t *testing.T) {
 	msg := []byte("document")
 	d := createDarc("testdarc").darc
@@ -139,6 +221,136 @@ func TestDarcSignature_Verify(t *testing.T) {
 	require.Nil(t, ds.Verify(msg, d))
 }
 
+func TestSignaturePath_Validity(t *testing.T) {
+	msg := []byte("document")
+	td := createDarc("testdarc")
+	now := time.Now()
+	(*td.darc.Users)[0].SetValidity(now.Add(-time.Hour), now.Add(time.Hour))
+	path := NewSignaturePath([]*Darc{td.darc}, *td.usersI[0], User)
+	ds, err := NewDarcSignature(msg, path, td.users[0])
+	require.Nil(t, err)
+
+	require.Nil(t, ds.VerifyAt(msg, td.darc, now))
+	require.NotNil(t, ds.VerifyAt(msg, td.darc, now.Add(-2*time.Hour)))
+	require.Equal(t, ErrNotValid, ds.VerifyAt(msg, td.darc, now.Add(2*time.Hour)))
+
+	// Only the lower bound is set.
+	(*td.darc.Users)[0].SetValidity(now, time.Time{})
+	require.NotNil(t, path.VerifyAt(User, now.Add(-time.Minute)))
+	require.Nil(t, path.VerifyAt(User, now.Add(24*365*time.Hour)))
+
+	// Identities without validity are always accepted.
+	path = NewSignaturePath([]*Darc{td.darc}, *td.usersI[1], User)
+	require.Nil(t, path.VerifyAt(User, time.Unix(0, 0)))
+}
+
+func TestSignature_VerifyReplay(t *testing.T) {
+	msg := []byte("document")
+	td := createDarc("testdarc")
+	path := NewSignaturePath([]*Darc{td.darc}, *td.usersI[0], User)
+	now := time.Now()
+	cache := NewMemoryReplayCache()
+
+	ds, err := NewDarcSignatureNonce(msg, path, td.users[0], now.Add(time.Minute))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, td.darc))
+	require.NotNil(t, ds.VerifyReplay(msg, td.darc, now.Add(2*time.Minute), cache))
+	require.Nil(t, ds.VerifyReplay(msg, td.darc, now, cache))
+	require.NotNil(t, ds.VerifyReplay(msg, td.darc, now, cache))
+
+	// Nonce and expiration are covered by the signature.
+	ds.Expiration++
+	require.NotNil(t, ds.Verify(msg, td.darc))
+	ds.Expiration--
+	ds.Nonce[0]++
+	require.NotNil(t, ds.Verify(msg, td.darc))
+
+	// Signatures without a nonce cannot be checked for replays.
+	ds, err = NewDarcSignature(msg, path, td.users[0])
+	require.Nil(t, err)
+	require.NotNil(t, ds.VerifyReplay(msg, td.darc, now, cache))
+
+	// Nonces are only kept until the signatures expire, so signatures need
+	// an expiration that is not too far away.
+	_, err = NewDarcSignatureNonce(msg, path, td.users[0], time.Time{})
+	require.NotNil(t, err)
+	ds, err = NewDarcSignatureNonce(msg, path, td.users[0], now.Add(2*MaxNonceLifetime))
+	require.Nil(t, err)
+	require.NotNil(t, ds.VerifyReplay(msg, td.darc, now, cache))
+	require.NotNil(t, cache.Add([]byte("nonce"), 0))
+}
+
+func TestSignature_Decoded(t *testing.T) {
+	msg := []byte("document")
+	td := createDarc("testdarc")
+	path := NewSignaturePath([]*Darc{td.darc}, *td.usersI[0], User)
+	plain, err := NewDarcSignature(msg, path, td.users[0])
+	require.Nil(t, err)
+	nonce, err := NewDarcSignatureNonce(msg, path, td.users[0], time.Now().Add(time.Minute))
+	require.Nil(t, err)
+
+	// The decoding returns empty slices for the missing nonce and context,
+	// which must give the same hash.
+	for _, ds := range []*Signature{plain, nonce} {
+		buf, err := protobuf.Encode(ds)
+		require.Nil(t, err)
+		decoded := &Signature{}
+		require.Nil(t, protobuf.DecodeWithConstructors(buf, decoded,
+			network.DefaultConstructors(cothority.Suite)))
+		require.Nil(t, decoded.Verify(msg, td.darc))
+	}
+}
+
+func TestSignature_Context(t *testing.T) {
+	msg := []byte("document")
+	td := createDarc("testdarc")
+	path := NewSignaturePath([]*Darc{td.darc}, *td.usersI[0], User)
+	ds, err := NewDarcSignatureContext(msg, path, td.users[0], []byte("ocs"))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, td.darc))
+	require.Nil(t, ds.CheckContext([]byte("ocs")))
+	require.NotNil(t, ds.CheckContext([]byte("evoting")))
+
+	// Changing the context breaks the signature.
+	ds.Context = []byte("evoting")
+	require.NotNil(t, ds.Verify(msg, td.darc))
+	ds.Context = nil
+	require.NotNil(t, ds.Verify(msg, td.darc))
+
+	// Signatures without context are refused in all contexts, also after
+	// being decoded with an empty context.
+	ds, err = NewDarcSignature(msg, path, td.users[0])
+	require.Nil(t, err)
+	require.NotNil(t, ds.CheckContext([]byte("ocs")))
+	ds.Context = []byte{}
+	require.Nil(t, ds.Verify(msg, td.darc))
+	require.NotNil(t, ds.CheckContext([]byte("ocs")))
+
+	_, err = NewDarcSignatureContext(msg, path, td.users[0], nil)
+	require.NotNil(t, err)
+}
+
+func TestSignerExternal(t *testing.T) {
+	msg := []byte("document")
+	td := createDarc("testdarc")
+	hsm := td.users[0]
+	ext := NewSignerExternal(hsm.Identity(), hsm.Ed25519.Sign)
+	require.Equal(t, 1, ext.Type())
+	require.True(t, ext.Identity().Equal(td.usersI[0]))
+	_, err := ext.GetPrivate()
+	require.NotNil(t, err)
+
+	path := NewSignaturePath([]*Darc{td.darc}, *ext.Identity(), User)
+	ds, err := NewDarcSignature(msg, path, ext)
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, td.darc))
+
+	// A signature from the wrong key is refused.
+	ext = NewSignerExternal(hsm.Identity(), td.users[1].Ed25519.Sign)
+	_, err = NewDarcSignature(msg, path, ext)
+	require.NotNil(t, err)
+}
+
 func TestSignature(t *testing.T) {
 	// msg := []byte("darc-policy")
 	// sigEd := NewSignerEd25519(nil, nil)
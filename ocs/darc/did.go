@@ -0,0 +1,121 @@
+package darc
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// This file implements identities given by a W3C decentralized identifier,
+// like "did:example:123456789abcdefghi". The DID is resolved to the keys of
+// its DID document every time a signature is verified, so a darc holding a
+// DID doesn't need to be evolved when the key is rotated in the DID layer.
+// The resolvers are registered per DID method with RegisterDIDResolver.
+
+// DIDResolver returns the verification keys of the DID document of a DID.
+// The keys are identities that can verify a signature themselves, so
+// neither darc- nor DID-identities.
+type DIDResolver interface {
+	Resolve(did string) ([]*Identity, error)
+}
+
+// DIDResolverFunc is an adapter to use a function as DIDResolver.
+type DIDResolverFunc func(did string) ([]*Identity, error)
+
+// Resolve implements DIDResolver.
+func (f DIDResolverFunc) Resolve(did string) ([]*Identity, error) {
+	return f(did)
+}
+
+var didResolvers = struct {
+	sync.Mutex
+	methods map[string]DIDResolver
+}{methods: make(map[string]DIDResolver)}
+
+// RegisterDIDResolver sets the resolver for all DIDs of the given method,
+// replacing a resolver registered before. A nil resolver removes it.
+func RegisterDIDResolver(method string, resolver DIDResolver) {
+	didResolvers.Lock()
+	defer didResolvers.Unlock()
+	if resolver == nil {
+		delete(didResolvers.methods, method)
+		return
+	}
+	didResolvers.methods[method] = resolver
+}
+
+// NewIdentityDID returns an identity for the given DID.
+func NewIdentityDID(did string) *Identity {
+	return &Identity{
+		DID: &IdentityDID{
+			DID: did,
+		},
+	}
+}
+
+// Equal returns true if both IdentityDID hold the same DID.
+func (idd *IdentityDID) Equal(idd2 *IdentityDID) bool {
+	return idd.DID == idd2.DID
+}
+
+// Verify resolves the DID and returns nil if one of the keys of its DID
+// document verifies the signature.
+func (idd *IdentityDID) Verify(msg, sig []byte) error {
+	keys, err := idd.Resolve()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		switch key.Type() {
+		case 1, 2, 3:
+			if key.Verify(msg, sig) == nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("Wrong signature")
+}
+
+// Resolve returns the current verification keys of the DID, using the
+// resolver registered for its method.
+func (idd *IdentityDID) Resolve() ([]*Identity, error) {
+	method, err := didMethod(idd.DID)
+	if err != nil {
+		return nil, err
+	}
+	didResolvers.Lock()
+	resolver := didResolvers.methods[method]
+	didResolvers.Unlock()
+	if resolver == nil {
+		return nil, errors.New("no resolver for did method " + method)
+	}
+	keys, err := resolver.Resolve(idd.DID)
+	if err != nil {
+		return nil, errors.New("couldn't resolve " + idd.DID + ": " + err.Error())
+	}
+	return keys, nil
+}
+
+// NewSignerDID returns a signer for the DID, signing with key. The key has
+// to be one of the keys of the DID document for the signatures to verify.
+func NewSignerDID(did string, key *Signer) *Signer {
+	return NewSignerExternal(NewIdentityDID(did), key.Sign)
+}
+
+// didMethod returns the method of a DID of the form
+// "did:<method>:<method-specific-id>".
+func didMethod(did string) (string, error) {
+	parts := strings.SplitN(did, ":", 3)
+	if len(parts) != 3 || parts[0] != "did" || parts[2] == "" {
+		return "", errors.New("invalid did " + did)
+	}
+	if parts[1] == "" {
+		return "", errors.New("missing method in did " + did)
+	}
+	for _, c := range parts[1] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "", errors.New("invalid method in did " + did)
+		}
+	}
+	return parts[1], nil
+}
@@ -0,0 +1,60 @@
+package darc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityDID(t *testing.T) {
+	msg := []byte("document")
+	key1 := NewSignerEd25519(nil, nil)
+	key2 := NewSignerEd25519(nil, nil)
+	documents := map[string][]*Identity{
+		"did:test:alice": {key1.Identity()},
+	}
+	RegisterDIDResolver("test", DIDResolverFunc(func(did string) ([]*Identity, error) {
+		keys, ok := documents[did]
+		if !ok {
+			return nil, errors.New("unknown did")
+		}
+		return keys, nil
+	}))
+	defer RegisterDIDResolver("test", nil)
+
+	alice := NewIdentityDID("did:test:alice")
+	require.Nil(t, alice.validate())
+	require.Equal(t, 4, alice.Type())
+	require.True(t, alice.Equal(NewIdentityDID("did:test:alice")))
+	require.False(t, alice.Equal(NewIdentityDID("did:test:bob")))
+
+	d := NewDarc(nil, &[]*Identity{alice}, nil)
+	path := NewSignaturePath([]*Darc{d}, *alice, User)
+	ds, err := NewDarcSignature(msg, path, NewSignerDID("did:test:alice", key1))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+	require.Nil(t, path.Verify(User))
+
+	// After rotating the key in the DID document, the darc doesn't need to
+	// change, but only the new key can sign.
+	documents["did:test:alice"] = []*Identity{key2.Identity()}
+	require.NotNil(t, ds.Verify(msg, d))
+	ds, err = NewDarcSignature(msg, path, NewSignerDID("did:test:alice", key2))
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+
+	// DIDs without a resolver or a document cannot sign.
+	require.NotNil(t, NewIdentityDID("did:test:bob").Verify(msg, ds.Signature))
+	require.NotNil(t, NewIdentityDID("did:other:alice").Verify(msg, ds.Signature))
+
+	for _, did := range []string{"did:test", "did::alice", "id:test:alice", "did:Test:alice"} {
+		require.NotNil(t, NewIdentityDID(did).validate(), did)
+	}
+
+	id, err := ParseIdentity(alice.PolicyString())
+	require.Nil(t, err)
+	require.True(t, id.Equal(alice))
+	_, err = ParseIdentity("did:test")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,375 @@
+package darc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Diff holds the changes needed to go from one darc to another one.
+// Identities are compared including their Validity, so a change of
+// the validity shows up as a removal and an addition.
+type Diff struct {
+	OwnersAdded   []*Identity
+	OwnersRemoved []*Identity
+	UsersAdded    []*Identity
+	UsersRemoved  []*Identity
+	// DescriptionChanged is true if the descriptions differ.
+	DescriptionChanged bool
+	// MetadataChanged is true if the metadata differ.
+	MetadataChanged  bool
+	ResourcesAdded   [][]byte
+	ResourcesRemoved [][]byte
+	// LimitsChanged are the actions whose limit is added, changed or
+	// removed.
+	LimitsChanged []string
+	// QuorumsChanged are the actions whose quorum is added, changed or
+	// removed.
+	QuorumsChanged []string
+}
+
+// Diff returns the changes going from d to other.
+func (d *Darc) Diff(other *Darc) *Diff {
+	df := &Diff{}
+	df.OwnersAdded, df.OwnersRemoved = diffIdentities(d.Owners, other.Owners)
+	df.UsersAdded, df.UsersRemoved = diffIdentities(d.Users, other.Users)
+	df.DescriptionChanged = !bytes.Equal(description(d), description(other))
+	df.MetadataChanged = !equalMetadata(d, other)
+	df.ResourcesAdded, df.ResourcesRemoved = diffResources(d.Resources, other.Resources)
+	df.LimitsChanged = diffActions(limitEntries(d.Limits), limitEntries(other.Limits))
+	df.QuorumsChanged = diffActions(quorumEntries(d.Quorums), quorumEntries(other.Quorums))
+	return df
+}
+
+// IsEmpty returns true if the diff doesn't hold any change.
+func (df *Diff) IsEmpty() bool {
+	return len(df.OwnersAdded) == 0 && len(df.OwnersRemoved) == 0 &&
+		len(df.UsersAdded) == 0 && len(df.UsersRemoved) == 0 &&
+		!df.DescriptionChanged && !df.MetadataChanged &&
+		len(df.ResourcesAdded) == 0 && len(df.ResourcesRemoved) == 0 &&
+		len(df.LimitsChanged) == 0 && len(df.QuorumsChanged) == 0
+}
+
+// String returns a list of all changes, one per line.
+func (df *Diff) String() string {
+	var ret string
+	for _, c := range []struct {
+		sign string
+		role string
+		ids  []*Identity
+	}{
+		{"+", "owner", df.OwnersAdded},
+		{"-", "owner", df.OwnersRemoved},
+		{"+", "user", df.UsersAdded},
+		{"-", "user", df.UsersRemoved},
+	} {
+		for _, id := range c.ids {
+			ret += fmt.Sprintf("%s%s: %s\n", c.sign, c.role, id.String())
+		}
+	}
+	if df.DescriptionChanged {
+		ret += "~description\n"
+	}
+	if df.MetadataChanged {
+		ret += "~metadata\n"
+	}
+	for _, r := range df.ResourcesAdded {
+		ret += fmt.Sprintf("+resource: %x\n", r)
+	}
+	for _, r := range df.ResourcesRemoved {
+		ret += fmt.Sprintf("-resource: %x\n", r)
+	}
+	for _, action := range df.LimitsChanged {
+		ret += fmt.Sprintf("~limit %s\n", action)
+	}
+	for _, action := range df.QuorumsChanged {
+		ret += fmt.Sprintf("~quorum %s\n", action)
+	}
+	return ret
+}
+
+// ErrMergeConflict is returned by Merge if the two darcs cannot be merged
+// automatically.
+var ErrMergeConflict = errors.New("conflicting changes to darc")
+
+// Merge does a three-way merge of two darcs a and b that both evolved from
+// base. Identities and resources added in either darc are added,
+// identities and resources removed in either darc are removed. Limits and
+// quorums are merged by action. If the same identity ends up with two
+// different validities, or if both darcs change the description, the
+// metadata, or the limit or quorum of an action in a different way,
+// ErrMergeConflict is returned.
+//
+// The returned darc has the version and base-id of base and no signature, so
+// it has to be evolved from the latest darc before it can be used.
+func Merge(base, a, b *Darc) (*Darc, error) {
+	owners, err := mergeIdentities(base.Owners, a.Owners, b.Owners)
+	if err != nil {
+		return nil, fmt.Errorf("owners: %s", err)
+	}
+	users, err := mergeIdentities(base.Users, a.Users, b.Users)
+	if err != nil {
+		return nil, fmt.Errorf("users: %s", err)
+	}
+	desc := description(base)
+	descA, descB := description(a), description(b)
+	switch {
+	case bytes.Equal(descA, descB):
+		desc = descA
+	case bytes.Equal(desc, descA):
+		desc = descB
+	case bytes.Equal(desc, descB):
+		desc = descA
+	default:
+		return nil, fmt.Errorf("description: %s", ErrMergeConflict)
+	}
+	merged := base.Copy()
+	merged.Owners = &owners
+	merged.Users = &users
+	merged.Description = &desc
+	merged.Resources = mergeResources(base.Resources, a.Resources, b.Resources)
+	limits, err := mergeActions(limitEntries(base.Limits), limitEntries(a.Limits),
+		limitEntries(b.Limits))
+	if err != nil {
+		return nil, fmt.Errorf("limits: %s", err)
+	}
+	merged.Limits = nil
+	for _, l := range limits {
+		merged.Limits = append(merged.Limits, l.(*Limit))
+	}
+	quorums, err := mergeActions(quorumEntries(base.Quorums), quorumEntries(a.Quorums),
+		quorumEntries(b.Quorums))
+	if err != nil {
+		return nil, fmt.Errorf("quorums: %s", err)
+	}
+	merged.Quorums = nil
+	for _, q := range quorums {
+		merged.Quorums = append(merged.Quorums, q.(*Quorum))
+	}
+	switch {
+	case equalMetadata(a, b), equalMetadata(base, b):
+		merged.SetMetadata(a.Metadata)
+	case equalMetadata(base, a):
+		merged.SetMetadata(b.Metadata)
+	default:
+		return nil, fmt.Errorf("metadata: %s", ErrMergeConflict)
+	}
+	return merged, nil
+}
+
+// equalMetadata returns true if both darcs have the same metadata, once
+// normalized.
+func equalMetadata(a, b *Darc) bool {
+	return reflect.DeepEqual(metadata(a), metadata(b))
+}
+
+// diffIdentities returns the identities present in to but not in from, and
+// the identities present in from but not in to.
+func diffIdentities(from, to *[]*Identity) (added, removed []*Identity) {
+	for _, id := range identities(to) {
+		if !containsIdentity(identities(from), id) {
+			added = append(added, id)
+		}
+	}
+	for _, id := range identities(from) {
+		if !containsIdentity(identities(to), id) {
+			removed = append(removed, id)
+		}
+	}
+	return
+}
+
+func mergeIdentities(base, a, b *[]*Identity) ([]*Identity, error) {
+	addedA, removedA := diffIdentities(base, a)
+	addedB, removedB := diffIdentities(base, b)
+	var merged []*Identity
+	for _, id := range identities(base) {
+		if containsIdentity(removedA, id) || containsIdentity(removedB, id) {
+			continue
+		}
+		merged = append(merged, id)
+	}
+	for _, id := range append(addedA, addedB...) {
+		if containsIdentity(merged, id) {
+			continue
+		}
+		for _, m := range merged {
+			if m.Equal(id) {
+				return nil, ErrMergeConflict
+			}
+		}
+		merged = append(merged, id)
+	}
+	return merged, nil
+}
+
+// diffResources returns the resources present in to but not in from, and
+// the resources present in from but not in to.
+func diffResources(from, to [][]byte) (added, removed [][]byte) {
+	for _, r := range to {
+		if !containsResource(from, r) {
+			added = append(added, r)
+		}
+	}
+	for _, r := range from {
+		if !containsResource(to, r) {
+			removed = append(removed, r)
+		}
+	}
+	return
+}
+
+// mergeResources merges the resources as sets, so both darcs can bind and
+// unbind resources without conflict.
+func mergeResources(base, a, b [][]byte) [][]byte {
+	addedA, removedA := diffResources(base, a)
+	addedB, removedB := diffResources(base, b)
+	var merged [][]byte
+	for _, r := range base {
+		if !containsResource(removedA, r) && !containsResource(removedB, r) {
+			merged = append(merged, r)
+		}
+	}
+	for _, r := range append(addedA, addedB...) {
+		if !containsResource(merged, r) {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+func containsResource(list [][]byte, id []byte) bool {
+	for _, r := range list {
+		if bytes.Equal(r, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// actionEntry is an entry of a darc that is identified by its action, like
+// a limit or a quorum. Line is its policy statement, which is compared to
+// find the changes.
+type actionEntry struct {
+	action string
+	line   string
+	value  interface{}
+}
+
+func limitEntries(limits []*Limit) []actionEntry {
+	var entries []actionEntry
+	for _, l := range limits {
+		entries = append(entries, actionEntry{l.Action,
+			fmt.Sprintf("maxPerHour=%d", l.MaxPerHour), l})
+	}
+	return entries
+}
+
+func quorumEntries(quorums []*Quorum) []actionEntry {
+	var entries []actionEntry
+	for _, q := range quorums {
+		entries = append(entries, actionEntry{q.Action, q.policyString(), q})
+	}
+	return entries
+}
+
+// findAction returns the entry of the action, or an empty entry.
+func findAction(entries []actionEntry, action string) actionEntry {
+	for _, e := range entries {
+		if e.action == action {
+			return e
+		}
+	}
+	return actionEntry{}
+}
+
+// diffActions returns the actions whose entry is added, changed or removed
+// going from from to to.
+func diffActions(from, to []actionEntry) []string {
+	var changed []string
+	for _, e := range from {
+		if findAction(to, e.action).line != e.line {
+			changed = append(changed, e.action)
+		}
+	}
+	for _, e := range to {
+		if findAction(from, e.action).line == "" {
+			changed = append(changed, e.action)
+		}
+	}
+	return changed
+}
+
+// mergeActions does a three-way merge of the entries by action and returns
+// the values of the merged entries. If a and b change the entry of an
+// action in a different way, ErrMergeConflict is returned.
+func mergeActions(base, a, b []actionEntry) ([]interface{}, error) {
+	var actions []string
+	seen := make(map[string]bool)
+	for _, list := range [][]actionEntry{base, a, b} {
+		for _, e := range list {
+			if !seen[e.action] {
+				seen[e.action] = true
+				actions = append(actions, e.action)
+			}
+		}
+	}
+	var merged []interface{}
+	for _, action := range actions {
+		eBase, eA, eB := findAction(base, action), findAction(a, action), findAction(b, action)
+		e := eA
+		switch {
+		case eA.line == eB.line, eBase.line == eB.line:
+		case eBase.line == eA.line:
+			e = eB
+		default:
+			return nil, fmt.Errorf("action %s: %s", action, ErrMergeConflict)
+		}
+		if e.value != nil {
+			merged = append(merged, e.value)
+		}
+	}
+	return merged, nil
+}
+
+// containsIdentity returns true if an identity with the same key and the same
+// validity is in the list.
+func containsIdentity(list []*Identity, id *Identity) bool {
+	for _, l := range list {
+		if l.Equal(id) && validityEqual(l.Validity, id.Validity) {
+			return true
+		}
+	}
+	return false
+}
+
+func validityEqual(v1, v2 *Validity) bool {
+	if v1 == nil || v2 == nil {
+		return v1 == v2
+	}
+	return *v1 == *v2
+}
+
+func identities(list *[]*Identity) []*Identity {
+	if list == nil {
+		return nil
+	}
+	return *list
+}
+
+func description(d *Darc) []byte {
+	if d.Description == nil {
+		return []byte{}
+	}
+	return *d.Description
+}
+
+// metadata returns the normalized metadata of the darc, or nil if it is
+// empty.
+func metadata(d *Darc) *Metadata {
+	if d.Metadata == nil || d.Metadata.isEmpty() {
+		return nil
+	}
+	return d.Metadata.normalized()
+}
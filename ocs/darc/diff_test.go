@@ -0,0 +1,143 @@
+package darc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Diff(t *testing.T) {
+	td := createDarc("testdarc")
+	require.True(t, td.darc.Diff(td.darc.Copy()).IsEmpty())
+
+	d2 := td.darc.Copy()
+	newUser := createIdentity()
+	d2.AddUser(newUser)
+	d2.RemoveUser(td.usersI[0])
+	desc := []byte("changed")
+	d2.Description = &desc
+	df := td.darc.Diff(d2)
+	require.False(t, df.IsEmpty())
+	require.Equal(t, []*Identity{newUser}, df.UsersAdded)
+	require.Equal(t, []*Identity{td.usersI[0]}, df.UsersRemoved)
+	require.Empty(t, df.OwnersAdded)
+	require.Empty(t, df.OwnersRemoved)
+	require.True(t, df.DescriptionChanged)
+
+	d2 = td.darc.Copy()
+	d2.AddResource([]byte{1})
+	df = td.darc.Diff(d2)
+	require.False(t, df.IsEmpty())
+	require.Equal(t, [][]byte{{1}}, df.ResourcesAdded)
+	require.Equal(t, "+resource: 01\n", df.String())
+	require.Equal(t, [][]byte{{1}}, d2.Diff(td.darc).ResourcesRemoved)
+
+	d2 = td.darc.Copy()
+	d2.SetLimit("read", 3)
+	df = td.darc.Diff(d2)
+	require.Equal(t, []string{"read"}, df.LimitsChanged)
+	require.Equal(t, "~limit read\n", df.String())
+	d3 := d2.Copy()
+	d3.SetLimit("read", 4)
+	require.Equal(t, []string{"read"}, d2.Diff(d3).LimitsChanged)
+	require.Equal(t, []string{"read"}, d2.Diff(td.darc).LimitsChanged)
+	require.True(t, d2.Diff(d2.Copy()).IsEmpty())
+
+	d2 = td.darc.Copy()
+	d2.SetQuorum("sign", 2, []*Weight{{td.usersI[0], 1}, {td.usersI[1], 1}})
+	df = td.darc.Diff(d2)
+	require.Equal(t, []string{"sign"}, df.QuorumsChanged)
+	require.Equal(t, "~quorum sign\n", df.String())
+	d3 = d2.Copy()
+	d3.SetQuorum("sign", 1, d2.GetQuorum("sign").Weights)
+	require.Equal(t, []string{"sign"}, d2.Diff(d3).QuorumsChanged)
+}
+
+func TestMerge(t *testing.T) {
+	td := createDarc("testdarc")
+	a := td.darc.Copy()
+	b := td.darc.Copy()
+	userA := createIdentity()
+	a.AddUser(userA)
+	ownerB := createIdentity()
+	b.AddOwner(ownerB)
+	b.RemoveUser(td.usersI[1])
+	desc := []byte("new description")
+	b.Description = &desc
+
+	merged, err := Merge(td.darc, a, b)
+	require.Nil(t, err)
+	require.Equal(t, []*Identity{td.usersI[0], userA}, *merged.Users)
+	require.Equal(t, []*Identity{td.ownersI[0], td.ownersI[1], ownerB}, *merged.Owners)
+	require.Equal(t, desc, *merged.Description)
+	require.Equal(t, td.darc.Version, merged.Version)
+
+	// Same change on both sides is not a conflict.
+	a.Description = &desc
+	_, err = Merge(td.darc, a, b)
+	require.Nil(t, err)
+
+	// Different descriptions conflict.
+	descA := []byte("other description")
+	a.Description = &descA
+	_, err = Merge(td.darc, a, b)
+	require.NotNil(t, err)
+
+	// Adding the same identity with different validities conflicts.
+	a = td.darc.Copy()
+	b = td.darc.Copy()
+	now := time.Now()
+	idA := *userA
+	idA.SetValidity(now, time.Time{})
+	idB := *userA
+	idB.SetValidity(time.Time{}, now)
+	a.AddUser(&idA)
+	b.AddUser(&idB)
+	_, err = Merge(td.darc, a, b)
+	require.NotNil(t, err)
+
+	// Resources are merged as sets.
+	base := td.darc.Copy()
+	base.AddResource([]byte{1})
+	a = base.Copy()
+	b = base.Copy()
+	a.AddResource([]byte{2})
+	b.Resources = [][]byte{{3}}
+	merged, err = Merge(base, a, b)
+	require.Nil(t, err)
+	require.Equal(t, [][]byte{{2}, {3}}, merged.Resources)
+
+	// Limits are merged by action, and conflict if both darcs change the
+	// limit of the same action differently.
+	base = td.darc.Copy()
+	base.SetLimit("read", 3)
+	base.SetLimit("write", 1)
+	a = base.Copy()
+	b = base.Copy()
+	a.SetLimit("read", 5)
+	b.Limits = []*Limit{{Action: "read", MaxPerHour: 3}, {Action: "recover", MaxPerHour: 2}}
+	merged, err = Merge(base, a, b)
+	require.Nil(t, err)
+	require.Equal(t, []*Limit{{Action: "read", MaxPerHour: 5}, {Action: "recover", MaxPerHour: 2}},
+		merged.Limits)
+	b.SetLimit("read", 4)
+	_, err = Merge(base, a, b)
+	require.NotNil(t, err)
+
+	// So are quorums.
+	weights := []*Weight{{td.usersI[0], 1}, {td.usersI[1], 1}}
+	base = td.darc.Copy()
+	base.SetQuorum("sign", 1, weights)
+	a = base.Copy()
+	b = base.Copy()
+	a.SetQuorum("sign", 2, weights)
+	b.SetQuorum("evolve", 2, weights)
+	merged, err = Merge(base, a, b)
+	require.Nil(t, err)
+	require.Equal(t, 2, merged.GetQuorum("sign").Threshold)
+	require.Equal(t, 2, merged.GetQuorum("evolve").Threshold)
+	b.SetQuorum("sign", 0, nil)
+	_, err = Merge(base, a, b)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,36 @@
+package darc
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrDelegated is returned by Excludes if the darc delegates the role to
+// other darcs, which might list the identity.
+var ErrDelegated = errors.New("darc delegates to other darcs")
+
+// Excludes returns nil if a signature path for the role with the identity as
+// signer cannot be verified for the darc at the given time: the identity
+// is not listed and doesn't match a pattern, or it is only listed with a
+// validity not containing when. As the other darcs cannot be checked,
+// ErrDelegated is returned if the darc links to any darc for the role.
+func (d *Darc) Excludes(id *Identity, role Role, when time.Time) error {
+	ids := d.Users
+	if role == Owner {
+		ids = d.Owners
+	}
+	for _, listed := range identities(ids) {
+		if !listed.Validity.Contains(when) {
+			continue
+		}
+		if listed.Darc != nil || (listed.Pattern != nil &&
+			strings.HasPrefix(listed.Pattern.Pattern, "darc:")) {
+			return ErrDelegated
+		}
+		if id.Equal(listed) || listed.Pattern.Match(id) {
+			return errors.New("identity is allowed to sign")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package darc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Excludes(t *testing.T) {
+	td := createDarc("revocation")
+	now := time.Now()
+	user, owner := td.usersI[0], td.ownersI[0]
+	require.NotNil(t, td.darc.Excludes(user, User, now))
+	require.Nil(t, td.darc.Excludes(user, Owner, now))
+	require.NotNil(t, td.darc.Excludes(owner, Owner, now))
+
+	// Removing the user excludes it.
+	d := td.darc.Copy()
+	d.RemoveUser(user)
+	require.Nil(t, d.Excludes(user, User, now))
+
+	// An expired identity is excluded.
+	expired := *user
+	expired.SetValidity(time.Time{}, now.Add(-time.Hour))
+	d = td.darc.Copy()
+	d.Users = &[]*Identity{&expired}
+	require.Nil(t, d.Excludes(user, User, now))
+	require.NotNil(t, d.Excludes(user, User, now.Add(-2*time.Hour)))
+
+	// Patterns matching the identity include it, links to darcs cannot be
+	// excluded.
+	d.Users = &[]*Identity{NewIdentityPattern("ed25519:*")}
+	require.NotNil(t, d.Excludes(user, User, now))
+	d.Users = &[]*Identity{NewIdentityPattern("x509ec:*")}
+	require.Nil(t, d.Excludes(user, User, now))
+	d.Users = &[]*Identity{NewIdentityDarc(td.darc.GetID())}
+	require.Equal(t, ErrDelegated, d.Excludes(user, User, now))
+	d.Users = &[]*Identity{NewIdentityPattern("darc:*")}
+	require.Equal(t, ErrDelegated, d.Excludes(user, User, now))
+}
@@ -0,0 +1,101 @@
+package darc
+
+import (
+	"errors"
+)
+
+// Store returns the darc to use for the given darc-identity, usually the
+// latest version of the darc with that ID.
+type Store func(id ID) (*Darc, error)
+
+// IdentitySet is a set of identities that can sign together for a role of
+// a darc. As a darc accepts any single signer, the sets found by Explain
+// hold one identity each.
+type IdentitySet struct {
+	// Identities that have to sign
+	Identities []*Identity
+	// Path holds the IDs of the darcs from the explained darc to the darc
+	// holding the identities, to be used in the signature path.
+	Path []ID
+}
+
+// MaxIdentitySets is the maximum number of sets returned by Explain.
+const MaxIdentitySets = 1000
+
+// ErrTooManySets is returned by Explain if there are more than
+// MaxIdentitySets ways to sign.
+var ErrTooManySets = errors.New("too many identity sets")
+
+// Explain returns the sets of identities that can sign for the role of the
+// darc, so that administrators can audit who has which right. Darc-identities
+// are resolved using the store, and followed like the verification of a
+// signature path does: an owner can be delegated to the users of another
+// darc, and users to the users of other darcs. The identities are returned
+// as they are stored, without checking their Validity or resolving aliases
+// and DIDs. If there are too many sets, the first MaxIdentitySets are
+// returned with ErrTooManySets.
+func (d *Darc) Explain(role Role, store Store) ([]IdentitySet, error) {
+	ids := d.Users
+	if role == Owner {
+		ids = d.Owners
+	}
+	e := &explanation{store: store}
+	err := e.walk(ids, []ID{d.GetID()})
+	return e.sets, err
+}
+
+// explanation collects the identity sets of Explain.
+type explanation struct {
+	store Store
+	sets  []IdentitySet
+}
+
+// walk adds the identities, following darc-identities to their users. Darcs
+// already in the path are skipped, so cycles of darcs end.
+func (e *explanation) walk(ids *[]*Identity, path []ID) error {
+	if ids == nil {
+		return nil
+	}
+	for _, id := range *ids {
+		if id == nil {
+			continue
+		}
+		if id.Darc == nil {
+			if len(e.sets) == MaxIdentitySets {
+				return ErrTooManySets
+			}
+			e.sets = append(e.sets, IdentitySet{
+				Identities: []*Identity{id},
+				Path:       append([]ID{}, path...),
+			})
+			continue
+		}
+		if inPath(path, id.Darc.ID) {
+			continue
+		}
+		if e.store == nil {
+			return errors.New("no store to resolve darc identities")
+		}
+		next, err := e.store(id.Darc.ID)
+		if err != nil {
+			return errors.New("couldn't resolve darc: " + err.Error())
+		}
+		nextID := next.GetID()
+		if inPath(path, nextID) {
+			continue
+		}
+		if err := e.walk(next.Users, append(append([]ID{}, path...), nextID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inPath(path []ID, id ID) bool {
+	for _, p := range path {
+		if p.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
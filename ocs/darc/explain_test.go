@@ -0,0 +1,42 @@
+package darc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Explain(t *testing.T) {
+	a1, b1, c1, u1 := createIdentity(), createIdentity(), createIdentity(), createIdentity()
+	// The store resolves "a" to the first darc, which closes a cycle that
+	// is ignored.
+	c := NewDarc(&[]*Identity{}, &[]*Identity{c1, NewIdentityDarc(ID("a"))}, []byte("c"))
+	b := NewDarc(&[]*Identity{}, &[]*Identity{b1, NewIdentityDarc(c.GetID())}, []byte("b"))
+	a := NewDarc(&[]*Identity{a1, NewIdentityDarc(b.GetID())}, &[]*Identity{u1}, []byte("a"))
+	darcs := map[string]*Darc{"a": a, string(b.GetID()): b, string(c.GetID()): c}
+	store := func(id ID) (*Darc, error) {
+		if d, ok := darcs[string(id)]; ok {
+			return d, nil
+		}
+		return nil, errors.New("unknown darc")
+	}
+
+	sets, err := a.Explain(Owner, store)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(sets))
+	require.Equal(t, []*Identity{a1}, sets[0].Identities)
+	require.Equal(t, []ID{a.GetID()}, sets[0].Path)
+	require.Equal(t, []*Identity{b1}, sets[1].Identities)
+	require.Equal(t, []ID{a.GetID(), b.GetID()}, sets[1].Path)
+	require.Equal(t, []*Identity{c1}, sets[2].Identities)
+	require.Equal(t, []ID{a.GetID(), b.GetID(), c.GetID()}, sets[2].Path)
+
+	sets, err = a.Explain(User, nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(sets))
+	require.Equal(t, []*Identity{u1}, sets[0].Identities)
+
+	_, err = a.Explain(Owner, nil)
+	require.NotNil(t, err)
+}
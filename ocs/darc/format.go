@@ -0,0 +1,92 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dedis/protobuf"
+)
+
+// Darcs are stored on skipchains for as long as the skipchains live, so a
+// change to the rules of the darcs, like thresholds or attributes, must not
+// prevent reading the darcs written before. Marshal writes a byte with the
+// format of the darc before its protobuf representation, and
+// NewDarcFromProto converts darcs of older formats with the migrations
+// registered by RegisterMigration. Data without a format byte, as written
+// before the formats were introduced, is of format 0.
+//
+// The format byte is below 8, where no protobuf message starts, as the field
+// numbers start at 1. A migration must keep the ID of the darc, by
+// encoding the fields of the old format the same way, so that the
+// signatures of the darc and of its evolutions still verify.
+
+// FormatVersion is the format of the darcs written by Marshal.
+const FormatVersion = 1
+
+// maxFormat is the highest format that fits in the format byte.
+const maxFormat = 7
+
+// Migration converts the protobuf representation of a darc of one format
+// into the representation of the next format.
+type Migration func(payload []byte) ([]byte, error)
+
+var migrations = map[int]Migration{
+	// The first format only added the format byte.
+	0: func(payload []byte) ([]byte, error) { return payload, nil },
+}
+var migrationsMutex sync.Mutex
+
+// RegisterMigration sets the migration of the darcs of format from to the
+// format from+1, replacing any previous migration. It is to be called in
+// the init function of the package introducing the new format.
+func RegisterMigration(from int, m Migration) {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	migrations[from] = m
+}
+
+// Marshal returns the format byte followed by the protobuf representation
+// of the darc, including its signature.
+func (d *Darc) Marshal() ([]byte, error) {
+	buf, err := protobuf.Encode(d)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{FormatVersion}, buf...), nil
+}
+
+// Format returns the format of the data written by Marshal, or 0 for a
+// protobuf representation without format byte.
+func Format(buf []byte) int {
+	if len(buf) > 0 && buf[0] <= maxFormat {
+		return int(buf[0])
+	}
+	return 0
+}
+
+// migrate returns the protobuf representation in the data, converted to the
+// current format.
+func migrate(buf []byte) ([]byte, error) {
+	format := Format(buf)
+	if len(buf) > 0 && buf[0] <= maxFormat {
+		buf = buf[1:]
+	}
+	if format > FormatVersion {
+		return nil, fmt.Errorf("darc format %d is newer than the supported format %d",
+			format, FormatVersion)
+	}
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	for ; format < FormatVersion; format++ {
+		m, ok := migrations[format]
+		if !ok {
+			return nil, fmt.Errorf("no migration from darc format %d", format)
+		}
+		var err error
+		if buf, err = m(buf); err != nil {
+			return nil, errors.New("couldn't migrate darc: " + err.Error())
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,75 @@
+package darc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Marshal(t *testing.T) {
+	d := createDarc("testdarc").darc
+	owner := NewSignerEd25519(nil, nil)
+	d.AddOwner(owner.Identity())
+	dNew := d.Copy()
+	dNew.IncrementVersion()
+	require.Nil(t, dNew.SetEvolution(d, NewSignaturePath([]*Darc{d}, *owner.Identity(), User), owner))
+
+	buf, err := dNew.Marshal()
+	require.Nil(t, err)
+	require.Equal(t, FormatVersion, Format(buf))
+	d2, err := NewDarcFromProtoStrict(buf)
+	require.Nil(t, err)
+	require.Equal(t, dNew.GetID(), d2.GetID())
+	require.Nil(t, d2.Verify())
+
+	// Darcs written before the format byte are still read, with the same
+	// ID and signature.
+	legacy, err := protobuf.Encode(dNew)
+	require.Nil(t, err)
+	require.Equal(t, 0, Format(legacy))
+	d2, err = NewDarcFromProtoStrict(legacy)
+	require.Nil(t, err)
+	require.Equal(t, dNew.GetID(), d2.GetID())
+	require.Nil(t, d2.Verify())
+
+	buf[0] = FormatVersion + 1
+	_, err = NewDarcFromProto(buf)
+	require.NotNil(t, err)
+}
+
+func TestRegisterMigration(t *testing.T) {
+	defer RegisterMigration(0, migrations[0])
+	d := createDarc("testdarc").darc
+	legacy, err := d.ToProto()
+	require.Nil(t, err)
+
+	RegisterMigration(0, func(payload []byte) ([]byte, error) {
+		old := &Darc{}
+		err := protobuf.DecodeWithConstructors(payload, old,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, err
+		}
+		old.SetMetadata(&Metadata{Name: "migrated"})
+		return protobuf.Encode(old)
+	})
+	d2, err := NewDarcFromProto(legacy)
+	require.Nil(t, err)
+	require.Equal(t, "migrated", d2.GetMetadata().Name)
+	// Darcs of the current format are not migrated.
+	buf, err := d.Marshal()
+	require.Nil(t, err)
+	d2, err = NewDarcFromProto(buf)
+	require.Nil(t, err)
+	require.Equal(t, d.GetID(), d2.GetID())
+
+	RegisterMigration(0, func([]byte) ([]byte, error) {
+		return nil, errors.New("unsupported rule")
+	})
+	_, err = NewDarcFromProto(legacy)
+	require.NotNil(t, err)
+}
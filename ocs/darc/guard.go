@@ -0,0 +1,104 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Request is a message of a service that can be protected by a Guard.
+type Request interface {
+	// DarcSignature returns the signature of the request, or nil if it is
+	// not signed.
+	DarcSignature() *Signature
+	// SignedMessage returns the bytes covered by the signature, usually the
+	// encoding of the request without its signature.
+	SignedMessage() ([]byte, error)
+}
+
+var requestType = reflect.TypeOf((*Request)(nil)).Elem()
+
+// Guard restricts the API calls of a service to the identities of an
+// administrative darc. The requests have to be signed with a nonce by an
+// owner or a user of the darc, and signatures bound to another context than
+// the name of the service are refused. The darc can be evolved, so the
+// admins can change without restarting the conode.
+type Guard struct {
+	sync.Mutex
+	service string
+	admin   *Darc
+	cache   ReplayCache
+}
+
+// NewGuard returns a guard for the service that accepts the requests signed
+// for the admin darc.
+func NewGuard(service string, admin *Darc) *Guard {
+	return &Guard{
+		service: service,
+		admin:   admin,
+		cache:   NewMemoryReplayCache(),
+	}
+}
+
+// Admin returns the current administrative darc.
+func (g *Guard) Admin() *Darc {
+	g.Lock()
+	defer g.Unlock()
+	return g.admin
+}
+
+// Evolve replaces the administrative darc with its next version, which has
+// to be signed by an owner of the current one.
+func (g *Guard) Evolve(d *Darc) error {
+	g.Lock()
+	defer g.Unlock()
+	latest, err := d.GetLatest()
+	if err != nil {
+		return err
+	}
+	if latest == nil || !latest.GetID().Equal(g.admin.GetID()) {
+		return errors.New("darc is not an evolution of the admin darc")
+	}
+	if err := d.Verify(); err != nil {
+		return err
+	}
+	g.admin = d
+	return nil
+}
+
+// Check returns nil if the request is signed for the administrative darc.
+func (g *Guard) Check(req Request) error {
+	sig := req.DarcSignature()
+	if sig == nil {
+		return errors.New("request needs an admin signature")
+	}
+	if err := sig.CheckContext([]byte(g.service)); err != nil {
+		return err
+	}
+	msg, err := req.SignedMessage()
+	if err != nil {
+		return err
+	}
+	return sig.VerifyReplay(msg, g.Admin(), time.Now(), g.cache)
+}
+
+// Wrap returns a handler that checks the request with Check before calling
+// handler, to be given to RegisterHandlers in place of handler. The handler
+// has the signature func(*Msg) (*Reply, error), and *Msg has to implement
+// Request. Wrap panics if it doesn't, as this is a programming error.
+func (g *Guard) Wrap(handler interface{}) interface{} {
+	f := reflect.ValueOf(handler)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 2 ||
+		!t.In(0).Implements(requestType) {
+		panic(fmt.Sprintf("cannot guard handler of type %s", t))
+	}
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		if err := g.Check(args[0].Interface().(Request)); err != nil {
+			return []reflect.Value{reflect.Zero(t.Out(0)), reflect.ValueOf(&err).Elem()}
+		}
+		return f.Call(args)
+	}).Interface()
+}
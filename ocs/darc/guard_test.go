@@ -0,0 +1,82 @@
+package darc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type adminRequest struct {
+	Data      []byte
+	Signature *Signature
+}
+
+func (r *adminRequest) DarcSignature() *Signature {
+	return r.Signature
+}
+
+func (r *adminRequest) SignedMessage() ([]byte, error) {
+	return r.Data, nil
+}
+
+type adminReply struct {
+	Data []byte
+}
+
+func TestGuard(t *testing.T) {
+	td := createDarc("admin")
+	guard := NewGuard("evoting", td.darc)
+	handler := guard.Wrap(func(req *adminRequest) (*adminReply, error) {
+		return &adminReply{Data: req.Data}, nil
+	}).(func(*adminRequest) (*adminReply, error))
+
+	sign := func(signer *Signer, id *Identity, d *Darc, context string) *adminRequest {
+		req := &adminRequest{Data: []byte("open")}
+		path := NewSignaturePath([]*Darc{d}, *id, User)
+		ds, err := NewDarcSignatureNonce(req.Data, path, signer, time.Now().Add(time.Minute))
+		require.Nil(t, err)
+		ds.Context = []byte(context)
+		hash, err := ds.Hash(req.Data)
+		require.Nil(t, err)
+		ds.Signature, err = signer.Sign(hash)
+		require.Nil(t, err)
+		req.Signature = ds
+		return req
+	}
+
+	_, err := handler(&adminRequest{Data: []byte("open")})
+	require.NotNil(t, err)
+
+	req := sign(td.users[0], td.usersI[0], td.darc, "evoting")
+	reply, err := handler(req)
+	require.Nil(t, err)
+	require.Equal(t, []byte("open"), reply.Data)
+	_, err = handler(req)
+	require.NotNil(t, err, "replayed request")
+
+	_, err = handler(sign(td.users[0], td.usersI[0], td.darc, "skipchain"))
+	require.NotNil(t, err, "request for another service")
+	other, otherI := createSignerIdentity()
+	_, err = handler(sign(other, otherI, td.darc, "evoting"))
+	require.NotNil(t, err, "request of a non-admin")
+
+	// Only the next version of the darc is accepted, and the removed admin
+	// can't call the handler anymore.
+	require.NotNil(t, guard.Evolve(td.darc.Copy()))
+	next := td.darc.Copy()
+	_, err = next.RemoveUser(td.usersI[0])
+	require.Nil(t, err)
+	require.Nil(t, next.SetEvolution(td.darc, nil, td.owners[0]))
+	require.Nil(t, guard.Evolve(next))
+	require.True(t, guard.Admin().Equal(next))
+	_, err = handler(sign(td.users[0], td.usersI[0], next, "evoting"))
+	require.NotNil(t, err)
+	_, err = handler(sign(td.users[1], td.usersI[1], next, "evoting"))
+	require.Nil(t, err)
+
+	require.Panics(t, func() {
+		guard.Wrap(func(req *adminReply) (*adminReply, error) { return nil, errors.New("") })
+	})
+}
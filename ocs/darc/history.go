@@ -0,0 +1,157 @@
+package darc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The history of a darc tells, for an audit, who evolved the darc to every
+// version and what changed. The versions come from a HistoryStore, like the
+// registry of the darc service, which also knows when they were stored.
+
+// StoredVersion is a version of a darc as kept by a store.
+type StoredVersion struct {
+	Darc *Darc
+	// Timestamp is the unix time at which the version was stored, or 0 if
+	// it is not known
+	Timestamp int64
+	// Signatures of the owners that approved the version next to the
+	// signature of the darc, like for a quorum
+	Signatures []*Signature
+}
+
+// HistoryStore returns all versions of the darc with the given base ID,
+// starting at version 0.
+type HistoryStore func(baseID ID) ([]*StoredVersion, error)
+
+// Event is a version in the history of a darc. It can be marshalled to JSON
+// for audit reports.
+type Event struct {
+	Version int `json:"version"`
+	// ID is the hex encoded ID of the version
+	ID string `json:"id"`
+	// Timestamp is the unix time at which the version was stored, if known
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Signers are the identities that evolved the darc to this version
+	Signers []string `json:"signers,omitempty"`
+	// Checkpoint is true if the version has a checkpoint instead of a
+	// signature, so its signers are not known
+	Checkpoint bool `json:"checkpoint,omitempty"`
+	// Changes are the changes from the previous version, like the lines of
+	// Diff.String
+	Changes []string `json:"changes,omitempty"`
+}
+
+// NewHistoryStore returns a store holding the given versions of a darc,
+// without timestamps, like the ones returned by the GetEvolution of the
+// darc service.
+func NewHistoryStore(darcs []*Darc) HistoryStore {
+	return func(baseID ID) ([]*StoredVersion, error) {
+		if len(darcs) == 0 || !darcs[0].GetID().Equal(baseID) {
+			return nil, errors.New("unknown darc")
+		}
+		versions := make([]*StoredVersion, len(darcs))
+		for i, d := range darcs {
+			versions[i] = &StoredVersion{Darc: d}
+		}
+		return versions, nil
+	}
+}
+
+// History returns the events of all versions of the darc found in the
+// store, starting at version 0. Every signed version has to be signed by an
+// owner of the previous one, else an error is returned. Versions with a
+// checkpoint are returned without their signers, as the roster to verify
+// them is not known here.
+func (d *Darc) History(store HistoryStore) ([]*Event, error) {
+	baseID := d.GetBaseID()
+	versions, err := store(baseID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) <= d.Version {
+		return nil, errors.New("store misses versions of the darc")
+	}
+	var events []*Event
+	for i, v := range versions {
+		if v == nil || v.Darc == nil || v.Darc.Version != i {
+			return nil, fmt.Errorf("version %d: missing", i)
+		}
+		if !v.Darc.GetBaseID().Equal(baseID) {
+			return nil, fmt.Errorf("version %d: darc of another evolution", i)
+		}
+		e := &Event{
+			Version:   i,
+			ID:        hex.EncodeToString(v.Darc.GetID()),
+			Timestamp: v.Timestamp,
+		}
+		if i > 0 {
+			prev := versions[i-1].Darc
+			if e.Signers, err = historySigners(prev, v); err != nil {
+				return nil, fmt.Errorf("version %d: %s", i, err)
+			}
+			e.Checkpoint = v.Darc.Signature == nil
+			e.Changes = historyChanges(prev, v.Darc)
+		}
+		events = append(events, e)
+	}
+	if !versions[d.Version].Darc.GetID().Equal(d.GetID()) {
+		return nil, errors.New("darc is not in its history")
+	}
+	return events, nil
+}
+
+// historySigners returns the identities that signed the version, after
+// checking that it evolves from prev.
+func historySigners(prev *Darc, v *StoredVersion) ([]string, error) {
+	if v.Darc.Signature == nil {
+		if v.Darc.Checkpoint == nil {
+			return nil, ErrMissingSignature
+		}
+		return nil, nil
+	}
+	// The validity of the identities is checked at the time the version was
+	// stored, as they might have expired since.
+	when := time.Now()
+	if v.Timestamp != 0 {
+		when = time.Unix(v.Timestamp, 0)
+	}
+	if err := v.Darc.verify(when, nil); err != nil {
+		return nil, err
+	}
+	latest, err := v.Darc.GetLatest()
+	if err != nil {
+		return nil, err
+	}
+	if !latest.GetID().Equal(prev.GetID()) {
+		return nil, errors.New("not signed for the previous version")
+	}
+	signers := []string{v.Darc.Signature.SignaturePath.Signer.String()}
+	for _, sig := range v.Signatures {
+		if sig == nil {
+			continue
+		}
+		s := sig.SignaturePath.Signer.String()
+		found := false
+		for _, other := range signers {
+			found = found || other == s
+		}
+		if !found {
+			signers = append(signers, s)
+		}
+	}
+	return signers, nil
+}
+
+// historyChanges returns the changes from prev to d, as the lines of
+// Diff.String.
+func historyChanges(prev, d *Darc) []string {
+	changes := strings.Split(strings.TrimSuffix(prev.Diff(d).String(), "\n"), "\n")
+	if changes[0] == "" {
+		return nil
+	}
+	return changes
+}
@@ -0,0 +1,56 @@
+package darc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_History(t *testing.T) {
+	owner, ownerI := createSignerIdentity()
+	d0 := NewDarc(&[]*Identity{ownerI}, nil, []byte("audited"))
+	d1 := d0.Copy()
+	user := createIdentity()
+	d1.AddUser(user)
+	d1.Limits = []*Limit{{Action: "read", MaxPerHour: 3}}
+	require.Nil(t, d1.SetEvolution(d0, nil, owner))
+	d2 := d1.Copy()
+	d2.SetMetadata(&Metadata{Name: "audited"})
+	require.Nil(t, d2.SetEvolution(d1, nil, owner))
+
+	events, err := d1.History(func(baseID ID) ([]*StoredVersion, error) {
+		require.Equal(t, d0.GetID(), baseID)
+		return []*StoredVersion{{Darc: d0, Timestamp: 1}, {Darc: d1, Timestamp: 2},
+			{Darc: d2, Timestamp: 3}}, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(events))
+	require.Equal(t, hex.EncodeToString(d2.GetID()), events[2].ID)
+	require.Equal(t, int64(2), events[1].Timestamp)
+	require.Nil(t, events[0].Signers)
+	require.Equal(t, []string{ownerI.String()}, events[1].Signers)
+	require.Equal(t, []string{"+user: " + user.String(), "~limit read"}, events[1].Changes)
+	require.Equal(t, []string{"~metadata"}, events[2].Changes)
+	buf, err := json.Marshal(events)
+	require.Nil(t, err)
+	require.Contains(t, string(buf), `"changes":["~metadata"]`)
+
+	events, err = d0.History(NewHistoryStore([]*Darc{d0, d1}))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, int64(0), events[1].Timestamp)
+
+	// The versions have to be complete and signed.
+	_, err = d2.History(NewHistoryStore([]*Darc{d0, d1}))
+	require.NotNil(t, err)
+	_, err = d0.History(NewHistoryStore([]*Darc{d0, d2}))
+	require.NotNil(t, err)
+	unsigned := d1.Copy()
+	unsigned.Signature = nil
+	_, err = d0.History(NewHistoryStore([]*Darc{d0, unsigned}))
+	require.NotNil(t, err)
+	_, err = d0.History(NewHistoryStore([]*Darc{d1}))
+	require.NotNil(t, err)
+}
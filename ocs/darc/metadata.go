@@ -0,0 +1,153 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The Description of a darc is opaque, so every application stores
+// something else in it. Metadata gives darcs a name, a purpose, a contact,
+// tags and application specific values. Like all fields of a darc, it is
+// hashed into the ID, so changing it needs an evolution.
+
+// SetMetadata sets the metadata of the darc, with its tags and entries
+// sorted. Empty metadata removes it.
+func (d *Darc) SetMetadata(m *Metadata) {
+	if m == nil || m.isEmpty() {
+		d.Metadata = nil
+		return
+	}
+	d.Metadata = m.normalized()
+}
+
+// GetMetadata returns a copy of the metadata of the darc, which is empty if
+// the darc has none.
+func (d *Darc) GetMetadata() *Metadata {
+	if d.Metadata == nil {
+		return &Metadata{}
+	}
+	return d.Metadata.Copy()
+}
+
+// Copy returns a deep copy of the metadata.
+func (m *Metadata) Copy() *Metadata {
+	c := &Metadata{
+		Name:    m.Name,
+		Purpose: m.Purpose,
+		Contact: m.Contact,
+	}
+	if m.Tags != nil {
+		c.Tags = append([]string{}, m.Tags...)
+	}
+	for _, e := range m.Application {
+		c.Application = append(c.Application, &MetadataEntry{e.Key, e.Value})
+	}
+	return c
+}
+
+// Get returns the value of the application key, or "" if it is not set.
+func (m *Metadata) Get(key string) string {
+	for _, e := range m.Application {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+// Set sets the value of the application key, keeping the entries sorted.
+// An empty value removes the key.
+func (m *Metadata) Set(key, value string) {
+	for i, e := range m.Application {
+		if e.Key == key {
+			if value == "" {
+				m.Application = append(m.Application[:i], m.Application[i+1:]...)
+			} else {
+				e.Value = value
+			}
+			return
+		}
+	}
+	if value == "" {
+		return
+	}
+	m.Application = append(m.Application, &MetadataEntry{key, value})
+	sort.Slice(m.Application, func(i, j int) bool {
+		return m.Application[i].Key < m.Application[j].Key
+	})
+}
+
+// HasTag returns true if the metadata holds the tag.
+func (m *Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag adds the tag if it is not present yet, keeping the tags sorted.
+func (m *Metadata) AddTag(tag string) {
+	if m.HasTag(tag) {
+		return
+	}
+	m.Tags = append(m.Tags, tag)
+	sort.Strings(m.Tags)
+}
+
+func (m *Metadata) isEmpty() bool {
+	return m.Name == "" && m.Purpose == "" && m.Contact == "" &&
+		len(m.Tags) == 0 && len(m.Application) == 0
+}
+
+// normalized returns a copy of the metadata with sorted tags and entries,
+// without duplicate tags and without empty lists.
+func (m *Metadata) normalized() *Metadata {
+	c := m.Copy()
+	c.Tags = nil
+	for _, t := range m.Tags {
+		c.AddTag(t)
+	}
+	sort.SliceStable(c.Application, func(i, j int) bool {
+		return c.Application[i].Key < c.Application[j].Key
+	})
+	if len(c.Application) == 0 {
+		c.Application = nil
+	}
+	return c
+}
+
+// validate makes sure the metadata is not empty, that the tags and the keys
+// are sorted, unique and can be written in a policy, and that no value is
+// empty.
+func (m *Metadata) validate() error {
+	if m.isEmpty() {
+		return errors.New("empty metadata must be removed")
+	}
+	for i, t := range m.Tags {
+		if t == "" {
+			return fmt.Errorf("tag %d: empty tag", i)
+		}
+		if i > 0 && m.Tags[i-1] >= t {
+			return fmt.Errorf("tag %d: tags must be sorted and unique", i)
+		}
+	}
+	for i, e := range m.Application {
+		if e == nil || !validMetadataKey(e.Key) || e.Value == "" {
+			return fmt.Errorf("entry %d: needs a key without spaces or ':' and a value", i)
+		}
+		if i > 0 && m.Application[i-1].Key >= e.Key {
+			return fmt.Errorf("entry %d: keys must be sorted and unique", i)
+		}
+	}
+	return nil
+}
+
+// validMetadataKey returns true if the key can be used in a 'meta'
+// statement of a policy.
+func validMetadataKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, ": \t\r\n;#\"")
+}
@@ -0,0 +1,88 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Metadata(t *testing.T) {
+	td := createDarc("testdarc")
+	d := td.darc.Copy()
+	require.Equal(t, &Metadata{}, d.GetMetadata())
+	id := d.GetID()
+
+	m := &Metadata{Name: "accounting", Tags: []string{"prod", "finance", "prod"}}
+	m.Set("app.retention", "10y")
+	m.Set("app.owner", "bob")
+	d.SetMetadata(m)
+	require.Equal(t, []string{"finance", "prod"}, d.Metadata.Tags)
+	require.Equal(t, "app.owner", d.Metadata.Application[0].Key)
+	require.Nil(t, d.Validate())
+	require.NotEqual(t, id, d.GetID())
+	require.True(t, d.IsCanonical())
+
+	// The returned metadata is a copy.
+	got := d.GetMetadata()
+	require.True(t, got.HasTag("finance"))
+	require.Equal(t, "10y", got.Get("app.retention"))
+	got.Set("app.retention", "")
+	require.Equal(t, "", got.Get("app.retention"))
+	require.Equal(t, "10y", d.GetMetadata().Get("app.retention"))
+	require.Equal(t, d.GetID(), d.Copy().GetID())
+
+	df := td.darc.Diff(d)
+	require.True(t, df.MetadataChanged)
+	require.Contains(t, df.String(), "~metadata")
+
+	parsed, err := ParsePolicy(d.Policy())
+	require.Nil(t, err)
+	require.Equal(t, d.Metadata, parsed.Metadata)
+
+	d.SetMetadata(&Metadata{})
+	require.Nil(t, d.Metadata)
+	require.Equal(t, id, d.GetID())
+
+	for _, m := range []*Metadata{
+		{},
+		{Tags: []string{""}},
+		{Tags: []string{"b", "a"}},
+		{Application: []*MetadataEntry{{"a b", "c"}}},
+		{Application: []*MetadataEntry{{"a", ""}}},
+		{Application: []*MetadataEntry{{"a", "1"}, {"a", "2"}}},
+	} {
+		d.Metadata = m
+		require.NotNil(t, d.Validate())
+	}
+}
+
+func TestParsePolicy_Metadata(t *testing.T) {
+	d, err := ParsePolicy(`name: "vault"; purpose: "Keys; secrets"
+tag: "b"; tag: "a"; meta x.y: "1"`)
+	require.Nil(t, err)
+	require.Equal(t, &Metadata{Name: "vault", Purpose: "Keys; secrets",
+		Tags: []string{"a", "b"}, Application: []*MetadataEntry{{"x.y", "1"}}}, d.Metadata)
+
+	for _, p := range []string{
+		"name: vault",
+		`tag: ""`,
+		`meta x: ""`,
+		`meta x: "1"; meta x: "2"`,
+	} {
+		_, err := ParsePolicy(p)
+		require.NotNil(t, err, p)
+	}
+}
+
+func TestMerge_Metadata(t *testing.T) {
+	td := createDarc("testdarc")
+	a := td.darc.Copy()
+	a.SetMetadata(&Metadata{Name: "a"})
+	merged, err := Merge(td.darc, a, td.darc.Copy())
+	require.Nil(t, err)
+	require.Equal(t, "a", merged.GetMetadata().Name)
+	b := td.darc.Copy()
+	b.SetMetadata(&Metadata{Name: "b"})
+	_, err = Merge(td.darc, a, b)
+	require.NotNil(t, err)
+}
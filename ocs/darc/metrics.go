@@ -0,0 +1,129 @@
+package darc
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// VerifyEvent describes one verification of a signature path. It is passed
+// to the hook set with SetVerifyHook, so that operators can see how long
+// the access-control checks take and why they fail.
+type VerifyEvent struct {
+	// Role the path has been verified for
+	Role Role
+	// PathLength is the number of darcs in the path
+	PathLength int
+	// SignerType is the type of the identity of the signer, as returned by
+	// Identity.Type
+	SignerType int
+	// Duration of the verification
+	Duration time.Duration
+	// Err is nil if the path has been accepted
+	Err error
+}
+
+// VerifyHook is called after each verification of a signature path. It must
+// not block, as it is called from the verification itself.
+type VerifyHook func(ev *VerifyEvent)
+
+var verifyHook = struct {
+	sync.Mutex
+	hook VerifyHook
+}{}
+
+// SetVerifyHook calls hook after every verification of a signature path,
+// including the paths of the evolution of darcs in a path. A nil hook
+// removes it.
+func SetVerifyHook(hook VerifyHook) {
+	verifyHook.Lock()
+	defer verifyHook.Unlock()
+	verifyHook.hook = hook
+}
+
+func notifyVerify(ev *VerifyEvent) {
+	verifyHook.Lock()
+	hook := verifyHook.hook
+	verifyHook.Unlock()
+	if hook != nil {
+		hook(ev)
+	}
+}
+
+// maxPathBucket is the last bucket of the path lengths in VerifyStats, which
+// also counts all longer paths.
+const maxPathBucket = 5
+
+// VerifyStats sums up verification events. Its Add method can be used as a
+// VerifyHook.
+type VerifyStats struct {
+	sync.Mutex
+	// Verifications and Failures are counted per role
+	Verifications map[Role]int
+	Failures      map[Role]int
+	// Paths counts the path lengths from 1 to maxPathBucket
+	Paths    [maxPathBucket + 1]int
+	Total    time.Duration
+	Slowest  time.Duration
+	LastFail string
+}
+
+// NewVerifyStats returns empty statistics.
+func NewVerifyStats() *VerifyStats {
+	return &VerifyStats{
+		Verifications: make(map[Role]int),
+		Failures:      make(map[Role]int),
+	}
+}
+
+// Add counts the event.
+func (vs *VerifyStats) Add(ev *VerifyEvent) {
+	vs.Lock()
+	defer vs.Unlock()
+	vs.Verifications[ev.Role]++
+	if ev.Err != nil {
+		vs.Failures[ev.Role]++
+		vs.LastFail = ev.Err.Error()
+	}
+	length := ev.PathLength
+	if length > maxPathBucket {
+		length = maxPathBucket
+	}
+	vs.Paths[length]++
+	vs.Total += ev.Duration
+	if ev.Duration > vs.Slowest {
+		vs.Slowest = ev.Duration
+	}
+}
+
+// Status returns the statistics as fields of a status report.
+func (vs *VerifyStats) Status() map[string]string {
+	vs.Lock()
+	defer vs.Unlock()
+	out := make(map[string]string)
+	count := 0
+	for role, name := range map[Role]string{Owner: "Owner", User: "User"} {
+		out["Verify"+name] = strconv.Itoa(vs.Verifications[role])
+		out["Fail"+name] = strconv.Itoa(vs.Failures[role])
+		count += vs.Verifications[role]
+	}
+	if count > 0 {
+		out["VerifyAverage"] = (vs.Total / time.Duration(count)).String()
+	}
+	out["VerifySlowest"] = vs.Slowest.String()
+	for length, n := range vs.Paths {
+		if length == 0 {
+			continue
+		}
+		key := fmt.Sprintf("PathLength%d", length)
+		if length == maxPathBucket {
+			key += "+"
+		}
+		out[key] = strconv.Itoa(n)
+	}
+	if vs.LastFail != "" {
+		out["LastFailure"] = vs.LastFail
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetVerifyHook(t *testing.T) {
+	stats := NewVerifyStats()
+	SetVerifyHook(stats.Add)
+	defer SetVerifyHook(nil)
+
+	td := createDarc("testdarc")
+	user := NewSignerEd25519(nil, nil)
+	td.darc.AddUser(user.Identity())
+	path := NewSignaturePath([]*Darc{td.darc}, *user.Identity(), User)
+	require.Nil(t, path.Verify(User))
+	require.NotNil(t, path.Verify(Owner))
+
+	require.Equal(t, 1, stats.Verifications[User])
+	require.Equal(t, 0, stats.Failures[User])
+	require.Equal(t, 1, stats.Verifications[Owner])
+	require.Equal(t, 1, stats.Failures[Owner])
+	require.Equal(t, 2, stats.Paths[1])
+
+	status := stats.Status()
+	require.Equal(t, "1", status["VerifyUser"])
+	require.Equal(t, "1", status["FailOwner"])
+	require.Equal(t, "2", status["PathLength1"])
+	require.Equal(t, "0", status["PathLength5+"])
+	require.Equal(t, "didn't find signer in last darc of path", status["LastFailure"])
+
+	var events []*VerifyEvent
+	SetVerifyHook(func(ev *VerifyEvent) { events = append(events, ev) })
+	require.Nil(t, path.Verify(User))
+	require.Equal(t, 1, len(events))
+	require.Equal(t, 1, events[0].SignerType)
+	require.Equal(t, User, events[0].Role)
+	require.Nil(t, events[0].Err)
+}
@@ -0,0 +1,243 @@
+package darc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements identities of users authenticated by an OpenID
+// Connect provider, like the single sign-on of a university. The signature
+// of such an identity is an ID token, a JWT signed by the provider, that
+// holds the hex-encoded message as its nonce claim. The client asks the
+// provider for a token with this nonce when it wants to sign, so the token
+// cannot be used for another message. Only the RS256 and ES256 algorithms
+// are accepted.
+
+// OIDCIssuer holds the configuration of a provider whose tokens are accepted.
+type OIDCIssuer struct {
+	// Audience is the client-id the tokens have to be issued for.
+	Audience string
+	// Keys returns the public key of the provider with the given key-id,
+	// usually taken from its JWKS document. The key has to be a
+	// *rsa.PublicKey or a *ecdsa.PublicKey.
+	Keys func(kid string) (crypto.PublicKey, error)
+}
+
+var oidcIssuers = struct {
+	sync.Mutex
+	issuers map[string]*OIDCIssuer
+}{issuers: make(map[string]*OIDCIssuer)}
+
+// oidcLeeway is the allowed clock skew when checking the validity of a
+// token.
+var oidcLeeway = time.Minute
+
+// RegisterOIDCIssuer accepts the tokens of the given issuer, replacing the
+// configuration registered before. A nil configuration removes the issuer.
+func RegisterOIDCIssuer(issuer string, config *OIDCIssuer) {
+	oidcIssuers.Lock()
+	defer oidcIssuers.Unlock()
+	if config == nil {
+		delete(oidcIssuers.issuers, issuer)
+		return
+	}
+	oidcIssuers.issuers[issuer] = config
+}
+
+// NewIdentityOIDC returns an identity for the subject as given by the
+// issuer.
+func NewIdentityOIDC(issuer, subject string) *Identity {
+	return &Identity{
+		OIDC: &IdentityOIDC{
+			Issuer:  issuer,
+			Subject: subject,
+		},
+	}
+}
+
+// Equal returns true if both IdentityOIDC hold the same issuer and subject.
+func (ido *IdentityOIDC) Equal(ido2 *IdentityOIDC) bool {
+	return ido.Issuer == ido2.Issuer && ido.Subject == ido2.Subject
+}
+
+// Verify returns nil if sig is a valid token of the issuer for the subject
+// with msg as nonce.
+func (ido *IdentityOIDC) Verify(msg, sig []byte) error {
+	return ido.verifyAt(msg, sig, time.Now())
+}
+
+// jwtHeader holds the fields of the header of a JWT used here.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims holds the claims of an ID token used here.
+type jwtClaims struct {
+	Iss   string          `json:"iss"`
+	Sub   string          `json:"sub"`
+	Aud   json.RawMessage `json:"aud"`
+	Exp   int64           `json:"exp"`
+	Nbf   int64           `json:"nbf"`
+	Nonce string          `json:"nonce"`
+}
+
+func (ido *IdentityOIDC) verifyAt(msg, sig []byte, when time.Time) error {
+	oidcIssuers.Lock()
+	issuer := oidcIssuers.issuers[ido.Issuer]
+	oidcIssuers.Unlock()
+	if issuer == nil {
+		return errors.New("unknown oidc issuer " + ido.Issuer)
+	}
+
+	parts := strings.Split(string(sig), ".")
+	if len(parts) != 3 {
+		return errors.New("token is not a jwt")
+	}
+	header := &jwtHeader{}
+	if err := jwtDecode(parts[0], header); err != nil {
+		return err
+	}
+	claims := &jwtClaims{}
+	if err := jwtDecode(parts[1], claims); err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("invalid jwt signature encoding: " + err.Error())
+	}
+	if issuer.Keys == nil {
+		return errors.New("no keys for oidc issuer " + ido.Issuer)
+	}
+	key, err := issuer.Keys(header.Kid)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := jwtVerify(header.Alg, key, hash[:], signature); err != nil {
+		return err
+	}
+
+	switch {
+	case claims.Iss != ido.Issuer:
+		return errors.New("token of wrong issuer")
+	case claims.Sub != ido.Subject:
+		return errors.New("token of wrong subject")
+	case !audienceContains(claims.Aud, issuer.Audience):
+		return errors.New("token for wrong audience")
+	case claims.Nonce != hex.EncodeToString(msg):
+		return errors.New("token for another message")
+	case claims.Exp == 0 || when.Add(-oidcLeeway).Unix() > claims.Exp:
+		return errors.New("token expired")
+	case claims.Nbf != 0 && when.Add(oidcLeeway).Unix() < claims.Nbf:
+		return errors.New("token not valid yet")
+	}
+	return nil
+}
+
+// NewSignerOIDC returns a signer for the subject of the issuer. The token
+// function has to return an ID token with the given nonce, usually by
+// asking the provider after the user logged in.
+func NewSignerOIDC(issuer, subject string, token func(nonce string) (string, error)) *Signer {
+	return NewSignerExternal(NewIdentityOIDC(issuer, subject), func(msg []byte) ([]byte, error) {
+		t, err := token(hex.EncodeToString(msg))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(t), nil
+	})
+}
+
+// policyString returns the identity as "oidc:<issuer>:<subject>", with
+// both parts escaped so they can be used in a policy.
+func (ido *IdentityOIDC) policyString() string {
+	return "oidc:" + url.QueryEscape(ido.Issuer) + ":" + url.QueryEscape(ido.Subject)
+}
+
+// parseOIDC reads an identity as returned by IdentityOIDC.policyString.
+func parseOIDC(s string) (*Identity, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "oidc:"), ":")
+	if len(parts) != 2 {
+		return nil, errors.New("oidc identity needs issuer and subject")
+	}
+	issuer, err := url.QueryUnescape(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	subject, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return NewIdentityOIDC(issuer, subject), nil
+}
+
+func jwtDecode(part string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("invalid jwt encoding: " + err.Error())
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return errors.New("invalid jwt: " + err.Error())
+	}
+	return nil
+}
+
+func jwtVerify(alg string, key crypto.PublicKey, hash, signature []byte) error {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 needs a rsa key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash, signature); err != nil {
+			return errors.New("Wrong signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return errors.New("ES256 needs a P-256 ecdsa key")
+		}
+		if len(signature) != 64 {
+			return errors.New("ES256 signature must be 64 bytes")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, hash, r, s) {
+			return errors.New("Wrong signature")
+		}
+	default:
+		return errors.New("unsupported jwt algorithm " + alg)
+	}
+	return nil
+}
+
+// audienceContains returns true if the aud claim, which is either a string
+// or a list of strings, holds the audience.
+func audienceContains(aud json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(aud, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(aud, &list) != nil {
+		return false
+	}
+	for _, a := range list {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
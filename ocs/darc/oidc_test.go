@@ -0,0 +1,119 @@
+package darc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://sso.example.org"
+
+// testToken returns a JWT with the given claims, signed by key.
+func testToken(t *testing.T, alg string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": alg})
+	require.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	require.Nil(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		require.Nil(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		require.Nil(t, err)
+		sig = append(padBytes(r), padBytes(s)...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestIdentityOIDC(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	RegisterOIDCIssuer(testIssuer, &OIDCIssuer{
+		Audience: "cothority",
+		Keys: func(kid string) (crypto.PublicKey, error) {
+			switch kid {
+			case "RS256":
+				return rsaKey.Public(), nil
+			case "ES256":
+				return ecKey.Public(), nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	})
+	defer RegisterOIDCIssuer(testIssuer, nil)
+
+	alice := NewIdentityOIDC(testIssuer, "alice")
+	require.Nil(t, alice.validate())
+	require.Equal(t, 5, alice.Type())
+	require.NotNil(t, NewIdentityOIDC(testIssuer, "").validate())
+
+	claims := func(nonce string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   testIssuer,
+			"sub":   "alice",
+			"aud":   []string{"other", "cothority"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": nonce,
+		}
+	}
+	msg := []byte("document")
+	d := NewDarc(nil, &[]*Identity{alice}, nil)
+	path := NewSignaturePath([]*Darc{d}, *alice, User)
+	for _, alg := range []string{"RS256", "ES256"} {
+		var key crypto.Signer = rsaKey
+		if alg == "ES256" {
+			key = ecKey
+		}
+		signer := NewSignerOIDC(testIssuer, "alice", func(nonce string) (string, error) {
+			return testToken(t, alg, key, claims(nonce)), nil
+		})
+		ds, err := NewDarcSignature(msg, path, signer)
+		require.Nil(t, err)
+		require.Nil(t, ds.Verify(msg, d))
+		// The token is bound to the message.
+		require.NotNil(t, ds.Verify([]byte("other"), d))
+	}
+
+	hash, err := path.SigHash(msg)
+	require.Nil(t, err)
+	verify := func(c map[string]interface{}) error {
+		return alice.Verify(hash, []byte(testToken(t, "ES256", ecKey, c)))
+	}
+	require.Nil(t, verify(claims(hex.EncodeToString(hash))))
+	for claim, value := range map[string]interface{}{
+		"iss": "https://evil.example.org",
+		"sub": "bob",
+		"aud": "other",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+		"nbf": time.Now().Add(time.Hour).Unix(),
+	} {
+		c := claims(hex.EncodeToString(hash))
+		c[claim] = value
+		require.NotNil(t, verify(c), claim)
+	}
+	require.NotNil(t, alice.Verify(hash, []byte("not.a.jwt")))
+	token := testToken(t, "ES256", ecKey, claims(hex.EncodeToString(hash)))
+	require.NotNil(t, NewIdentityOIDC("https://unknown.org", "alice").Verify(hash, []byte(token)))
+
+	id, err := ParseIdentity(alice.PolicyString())
+	require.Nil(t, err)
+	require.True(t, id.Equal(alice))
+}
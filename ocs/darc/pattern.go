@@ -0,0 +1,55 @@
+package darc
+
+import (
+	"errors"
+	"strings"
+)
+
+// A pattern identity matches the identities whose policy string, without
+// validity, starts with a given prefix, like "x509ec:*" for all X509EC keys
+// or "darc:ab12*" for all darcs whose ID starts with ab12. A pattern only
+// matches when it is listed as an identity of a darc, so a darc without
+// patterns still only accepts the identities it enumerates. A pattern can't
+// sign itself, it only lets the signer or the darc-link through.
+
+// NewIdentityPattern returns an identity matching the given pattern.
+func NewIdentityPattern(pattern string) *Identity {
+	return &Identity{
+		Pattern: &IdentityPattern{
+			Pattern: pattern,
+		},
+	}
+}
+
+// Equal returns true if both IdentityPattern hold the same pattern.
+func (idp *IdentityPattern) Equal(idp2 *IdentityPattern) bool {
+	return idp.Pattern == idp2.Pattern
+}
+
+// Match returns true if the identity matches the pattern. Patterns never
+// match other patterns, and a nil IdentityPattern matches nothing.
+func (idp *IdentityPattern) Match(id *Identity) bool {
+	if idp == nil || id == nil || id.Pattern != nil || id.Type() < 0 {
+		return false
+	}
+	plain := *id
+	plain.Validity = nil
+	s := plain.PolicyString()
+	if strings.HasSuffix(idp.Pattern, "*") {
+		return strings.HasPrefix(s, strings.TrimSuffix(idp.Pattern, "*"))
+	}
+	return s == idp.Pattern
+}
+
+// checkPattern makes sure that the pattern starts with the type of the
+// identities it matches and only has a '*' at the end.
+func checkPattern(pattern string) error {
+	sep := strings.Index(pattern, ":")
+	if sep <= 0 || strings.Contains(pattern[:sep], "*") {
+		return errors.New("pattern needs a type")
+	}
+	if i := strings.Index(pattern, "*"); i >= 0 && i != len(pattern)-1 {
+		return errors.New("pattern can only end with '*'")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package darc
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityPattern_Match(t *testing.T) {
+	x509 := NewIdentityX509EC([]byte{0xab, 0x12, 0x34})
+	ed := createIdentity()
+
+	all := NewIdentityPattern("x509ec:*").Pattern
+	require.True(t, all.Match(x509))
+	require.False(t, all.Match(ed))
+	prefix := NewIdentityPattern("x509ec:ab12*").Pattern
+	require.True(t, prefix.Match(x509))
+	require.False(t, prefix.Match(NewIdentityX509EC([]byte{0xab, 0x13})))
+	require.True(t, NewIdentityPattern("x509ec:ab1234").Pattern.Match(x509))
+
+	// The validity of the matched identity is ignored, and patterns never
+	// match each other.
+	x509.SetValidity(time.Unix(1, 0), time.Time{})
+	require.True(t, all.Match(x509))
+	require.False(t, all.Match(NewIdentityPattern("x509ec:*")))
+	var none *IdentityPattern
+	require.False(t, none.Match(x509))
+
+	require.Nil(t, NewIdentityPattern("darc:ab*").validate())
+	require.NotNil(t, NewIdentityPattern("*").validate())
+	require.NotNil(t, NewIdentityPattern("ed25519:*ab").validate())
+	require.NotNil(t, NewIdentityPattern("x509ec*:ab").validate())
+}
+
+func TestIdentityPattern_Path(t *testing.T) {
+	msg := []byte("document")
+	signer, signerI := createSignerIdentity()
+	users := []*Identity{NewIdentityPattern("ed25519:*")}
+	d := NewDarc(nil, &users, nil)
+
+	ds, err := NewDarcSignature(msg, NewSignaturePath([]*Darc{d}, *signerI, User), signer)
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+	require.Nil(t, ds.SignaturePath.Verify(User))
+
+	// A darc matched by a pattern is a link in the path.
+	td := createDarc("users")
+	link := NewIdentityPattern("darc:" + hex.EncodeToString(td.darc.GetID())[:8] + "*")
+	base := NewDarc(nil, &[]*Identity{link}, nil)
+	path := NewSignaturePath([]*Darc{base, td.darc}, *td.usersI[0], User)
+	require.Nil(t, path.Verify(User))
+	path = NewSignaturePath([]*Darc{base, createDarc("other").darc}, *td.usersI[0], User)
+	require.NotNil(t, path.Verify(User))
+
+	// Patterns can't sign.
+	path = NewSignaturePath([]*Darc{d}, *users[0], User)
+	require.NotNil(t, path.Verify(User))
+}
+
+func TestParseIdentity_Pattern(t *testing.T) {
+	id, err := ParseIdentity("x509ec:*[10,20]")
+	require.Nil(t, err)
+	require.Equal(t, "x509ec:*", id.Pattern.Pattern)
+	require.Equal(t, "x509ec:*[10,20]", id.PolicyString())
+	_, err = ParseIdentity("x509ec:*ab")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,419 @@
+package darc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/cothority"
+)
+
+// The policy of a darc can be written in a text format that is easy to
+// review and to keep in version control. Every statement is on its own line
+// or separated by a ';'. Lines starting with '#' are ignored:
+//
+//   description: "my darc"
+//   name: "accounting"
+//   purpose: "Signs the invoices"
+//   contact: "it@example.org"
+//   tag: "finance"
+//   meta app.retention: "10y"
+//   allow evolve: ed25519:<hex> | darc:<hex>
+//   allow sign: x509ec:<hex> | ed25519:<hex>[1500000000,0] | did:example:1234
+//   allow sign: oidc:https%3A%2F%2Fsso.example.org:alice
+//   allow sign: x509ec:* | darc:ab12*
+//   resource: <hex>
+//   limit recover: maxPerHour=3
+//   quorum grant: weighted(3: ed25519:<hex>=2, ed25519:<hex>=1, x509ec:<hex>=1)
+//
+// 'allow evolve' lists the owners, 'allow sign' the users of the darc.
+// Identities are separated by '|', and an optional validity window is
+// given as unix timestamps in brackets, where 0 means no bound. An
+// identity ending with '*' is a pattern, matching all identities starting
+// with the part before it. Every 'resource' statement binds the darc to the
+// resource with the given hex-encoded ID, and every 'limit' statement limits
+// how often a signer can do the action following 'limit'. A 'quorum'
+// statement gives the identities that sign together for the action following
+// 'quorum', with the weight of every identity after '=', and the sum of the
+// weights needed first. The 'name', 'purpose', 'contact', 'tag' and 'meta'
+// statements set the metadata of the darc, where every 'tag' statement adds
+// a tag and every 'meta' statement the value of the key following 'meta'.
+
+// Policy returns the text representation of the darc. It can be read back
+// using ParsePolicy.
+func (d *Darc) Policy() string {
+	ret := fmt.Sprintf("description: %s\n", strconv.Quote(string(description(d))))
+	if m := metadata(d); m != nil {
+		for _, f := range []struct{ key, value string }{
+			{"name", m.Name}, {"purpose", m.Purpose}, {"contact", m.Contact},
+		} {
+			if f.value != "" {
+				ret += fmt.Sprintf("%s: %s\n", f.key, strconv.Quote(f.value))
+			}
+		}
+		for _, t := range m.Tags {
+			ret += fmt.Sprintf("tag: %s\n", strconv.Quote(t))
+		}
+		for _, e := range m.Application {
+			ret += fmt.Sprintf("meta %s: %s\n", e.Key, strconv.Quote(e.Value))
+		}
+	}
+	for _, s := range []struct {
+		action string
+		ids    []*Identity
+	}{
+		{"evolve", identities(d.Owners)},
+		{"sign", identities(d.Users)},
+	} {
+		if len(s.ids) == 0 {
+			continue
+		}
+		var strs []string
+		for _, id := range s.ids {
+			strs = append(strs, id.PolicyString())
+		}
+		ret += fmt.Sprintf("allow %s: %s\n", s.action, strings.Join(strs, " | "))
+	}
+	for _, r := range d.Resources {
+		ret += fmt.Sprintf("resource: %x\n", r)
+	}
+	for _, l := range d.Limits {
+		ret += fmt.Sprintf("limit %s: maxPerHour=%d\n", l.Action, l.MaxPerHour)
+	}
+	for _, q := range d.Quorums {
+		ret += fmt.Sprintf("quorum %s: %s\n", q.Action, q.policyString())
+	}
+	return ret
+}
+
+// MaxPolicyLength is the maximum length in bytes of a policy accepted by
+// ParsePolicy. Together with MaxPolicyIdentities it bounds the work done for
+// policies coming from untrusted sources.
+var MaxPolicyLength = 64 * 1024
+
+// MaxPolicyIdentities is the maximum number of identities in a policy
+// accepted by ParsePolicy.
+var MaxPolicyIdentities = 1000
+
+// ParseError is returned by ParsePolicy for an invalid policy. Pos is the
+// offset in bytes in the policy where the error has been found.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+// Error implements the error interface.
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d", pe.Msg, pe.Pos)
+}
+
+// ParsePolicy returns a new darc with the owners, users, description,
+// metadata, resources, limits and quorums given in the policy. The darc has
+// to be valid, like the darcs read by NewDarcFromProto. All errors are of
+// type *ParseError, with position 0 if the darc is not valid.
+func ParsePolicy(policy string) (*Darc, error) {
+	if len(policy) > MaxPolicyLength {
+		return nil, &ParseError{MaxPolicyLength, "policy is too long"}
+	}
+	var owners, users []*Identity
+	var desc []byte
+	var resources [][]byte
+	var limits []*Limit
+	var quorums []*Quorum
+	meta := &Metadata{}
+	for _, stmt := range splitStatements(policy) {
+		text := strings.TrimSpace(stmt.text)
+		pos := stmt.pos + strings.Index(stmt.text, text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sep := strings.Index(text, ":")
+		if sep < 0 {
+			return nil, &ParseError{pos, fmt.Sprintf("missing ':' in '%s'", text)}
+		}
+		key := strings.Join(strings.Fields(text[:sep]), " ")
+		value := strings.TrimSpace(text[sep+1:])
+		valuePos := pos + sep + 1 + strings.Index(text[sep+1:], value)
+		switch key {
+		case "description":
+			d, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, &ParseError{valuePos, "description must be quoted: " + err.Error()}
+			}
+			desc = []byte(d)
+		case "name", "purpose", "contact", "tag":
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, &ParseError{valuePos, key + " must be quoted: " + err.Error()}
+			}
+			switch key {
+			case "name":
+				meta.Name = v
+			case "purpose":
+				meta.Purpose = v
+			case "contact":
+				meta.Contact = v
+			default:
+				if v == "" {
+					return nil, &ParseError{valuePos, "empty tag"}
+				}
+				meta.AddTag(v)
+			}
+		case "allow evolve", "allow sign":
+			ids, err := parseIdentities(value, valuePos,
+				MaxPolicyIdentities-len(owners)-len(users))
+			if err != nil {
+				return nil, err
+			}
+			if key == "allow evolve" {
+				owners = append(owners, ids...)
+			} else {
+				users = append(users, ids...)
+			}
+		case "resource":
+			r, err := hex.DecodeString(value)
+			if err != nil || len(r) == 0 {
+				return nil, &ParseError{valuePos, fmt.Sprintf("invalid resource '%s'", value)}
+			}
+			resources = append(resources, r)
+		default:
+			fields := strings.Fields(key)
+			if len(fields) != 2 || (fields[0] != "limit" && fields[0] != "quorum" && fields[0] != "meta") {
+				return nil, &ParseError{pos, fmt.Sprintf("unknown statement '%s'", key)}
+			}
+			if fields[0] == "meta" {
+				v, err := strconv.Unquote(value)
+				if err != nil || v == "" || !validMetadataKey(fields[1]) {
+					return nil, &ParseError{valuePos, fmt.Sprintf("invalid value '%s' for '%s'", value, fields[1])}
+				}
+				if meta.Get(fields[1]) != "" {
+					return nil, &ParseError{pos, fmt.Sprintf("key '%s' is already set", fields[1])}
+				}
+				meta.Set(fields[1], v)
+				continue
+			}
+			if fields[0] == "quorum" {
+				q, err := parseQuorum(fields[1], value, valuePos,
+					MaxPolicyIdentities-len(owners)-len(users))
+				if err != nil {
+					return nil, err
+				}
+				for _, other := range quorums {
+					if other.Action == q.Action {
+						return nil, &ParseError{pos, fmt.Sprintf("action '%s' already has a quorum", q.Action)}
+					}
+				}
+				quorums = append(quorums, q)
+				continue
+			}
+			max, err := strconv.Atoi(strings.TrimPrefix(value, "maxPerHour="))
+			if err != nil || !strings.HasPrefix(value, "maxPerHour=") || max <= 0 {
+				return nil, &ParseError{valuePos, fmt.Sprintf("invalid limit '%s'", value)}
+			}
+			for _, l := range limits {
+				if l.Action == fields[1] {
+					return nil, &ParseError{pos, fmt.Sprintf("action '%s' is already limited", l.Action)}
+				}
+			}
+			limits = append(limits, &Limit{Action: fields[1], MaxPerHour: max})
+		}
+	}
+	d := NewDarc(&owners, &users, desc)
+	d.Resources = resources
+	d.Limits = limits
+	d.Quorums = quorums
+	d.SetMetadata(meta)
+	if err := d.Validate(); err != nil {
+		return nil, &ParseError{0, err.Error()}
+	}
+	return d, nil
+}
+
+// statement is a statement of a policy and its offset in the policy.
+type statement struct {
+	pos  int
+	text string
+}
+
+// splitStatements splits the policy at newlines and ';', except inside of
+// a quoted string.
+func splitStatements(policy string) []statement {
+	var stmts []statement
+	var quoted, escaped bool
+	start := 0
+	for i, c := range policy {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == '\n' || c == ';'):
+			stmts = append(stmts, statement{start, policy[start:i]})
+			start = i + 1
+		}
+	}
+	return append(stmts, statement{start, policy[start:]})
+}
+
+// parseIdentities parses the list of identities found at pos in the
+// policy. At most max identities are accepted.
+func parseIdentities(list string, pos, max int) ([]*Identity, error) {
+	if i := strings.IndexAny(list, "&()"); i >= 0 {
+		return nil, &ParseError{pos + i, "only '|' is supported between identities"}
+	}
+	var ids []*Identity
+	for _, s := range strings.Split(list, "|") {
+		idPos := pos + len(s) - len(strings.TrimLeft(s, " \t"))
+		pos += len(s) + 1
+		if len(ids) == max {
+			return nil, &ParseError{idPos, "too many identities"}
+		}
+		id, err := ParseIdentity(strings.TrimSpace(s))
+		if err != nil {
+			return nil, &ParseError{idPos, err.Error()}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// PolicyString returns the identity as used in the policy format, which is
+// the type, followed by a ':' and the hex-encoded key, followed by the
+// optional validity window.
+func (id *Identity) PolicyString() string {
+	var ret string
+	switch id.Type() {
+	case 0:
+		ret = "darc:" + hex.EncodeToString(id.Darc.ID)
+	case 1:
+		buf, err := id.Ed25519.Point.MarshalBinary()
+		if err != nil {
+			return "invalid"
+		}
+		ret = "ed25519:" + hex.EncodeToString(buf)
+	case 2:
+		ret = "x509ec:" + hex.EncodeToString(id.X509EC.Public)
+	case 3:
+		ret = "secp256k1:0x" + hex.EncodeToString(id.Secp256k1.Address)
+	case 4:
+		ret = id.DID.DID
+	case 5:
+		ret = id.OIDC.policyString()
+	case 6:
+		ret = id.WebAuthn.policyString()
+	case 7:
+		ret = "alias:" + id.Alias.Name
+	case 8:
+		ret = id.Pattern.Pattern
+	case 9:
+		ret = id.X509CA.policyString()
+	default:
+		return "invalid"
+	}
+	if id.Validity != nil {
+		ret += fmt.Sprintf("[%d,%d]", id.Validity.NotBefore, id.Validity.NotAfter)
+	}
+	return ret
+}
+
+// ParseIdentity reads an identity as returned by PolicyString.
+func ParseIdentity(s string) (*Identity, error) {
+	var validity *Validity
+	if i := strings.Index(s, "["); i >= 0 {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("missing ']' in '%s'", s)
+		}
+		bounds := strings.Split(s[i+1:len(s)-1], ",")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("validity needs two bounds in '%s'", s)
+		}
+		validity = &Validity{}
+		var err error
+		validity.NotBefore, err = strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		validity.NotAfter, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		s = s[:i]
+	}
+	if strings.Contains(s, "*") {
+		id := NewIdentityPattern(s)
+		if err := checkPattern(s); err != nil {
+			return nil, err
+		}
+		id.Validity = validity
+		return id, nil
+	}
+	if strings.HasPrefix(s, "did:") {
+		id := NewIdentityDID(s)
+		if _, err := didMethod(s); err != nil {
+			return nil, err
+		}
+		id.Validity = validity
+		return id, nil
+	}
+	if strings.HasPrefix(s, "ssh-") {
+		id, err := NewIdentitySSH(s)
+		if err != nil {
+			return nil, err
+		}
+		id.Validity = validity
+		return id, nil
+	}
+	if strings.HasPrefix(s, "alias:") {
+		id := NewIdentityAlias(strings.TrimPrefix(s, "alias:"))
+		if err := checkAliasName(id.Alias.Name); err != nil {
+			return nil, err
+		}
+		id.Validity = validity
+		return id, nil
+	}
+	if strings.HasPrefix(s, "oidc:") || strings.HasPrefix(s, "webauthn:") ||
+		strings.HasPrefix(s, "x509ca:") {
+		parse := parseOIDC
+		if strings.HasPrefix(s, "webauthn:") {
+			parse = parseWebAuthn
+		} else if strings.HasPrefix(s, "x509ca:") {
+			parse = parseX509CA
+		}
+		id, err := parse(s)
+		if err != nil {
+			return nil, err
+		}
+		id.Validity = validity
+		return id, nil
+	}
+	sep := strings.Index(s, ":")
+	if sep < 0 {
+		return nil, fmt.Errorf("missing type in identity '%s'", s)
+	}
+	buf, err := hex.DecodeString(strings.TrimPrefix(s[sep+1:], "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex in identity '%s': %s", s, err)
+	}
+	var id *Identity
+	switch s[:sep] {
+	case "darc":
+		id = NewIdentityDarc(buf)
+	case "ed25519":
+		point := cothority.Suite.Point()
+		if err := point.UnmarshalBinary(buf); err != nil {
+			return nil, err
+		}
+		id = NewIdentityEd25519(point)
+	case "x509ec":
+		id = NewIdentityX509EC(buf)
+	case "secp256k1":
+		id = NewIdentitySecp256k1(buf)
+	default:
+		return nil, fmt.Errorf("unknown identity type '%s'", s[:sep])
+	}
+	id.Validity = validity
+	return id, nil
+}
@@ -0,0 +1,95 @@
+package darc
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	td := createDarc("my \"test\" darc; with separator")
+	td.darc.AddOwner(NewIdentityDarc(make([]byte, 32)))
+	td.darc.AddUser(NewIdentityX509EC([]byte{4, 5, 6}))
+	(*td.darc.Users)[0].SetValidity(time.Unix(1500000000, 0), time.Time{})
+
+	policy := td.darc.Policy()
+	d, err := ParsePolicy(policy)
+	require.Nil(t, err)
+	require.Equal(t, td.darc.GetID(), d.GetID())
+	require.Equal(t, policy, d.Policy())
+
+	d, err = ParsePolicy("# comment\nallow sign: " + td.usersI[1].PolicyString() +
+		"; allow evolve: " + td.ownersI[0].PolicyString())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*d.Owners))
+	require.True(t, (*d.Owners)[0].Equal(td.ownersI[0]))
+	require.Equal(t, 1, len(*d.Users))
+	require.Equal(t, []byte{}, *d.Description)
+
+	for _, p := range []string{
+		"allow read: " + td.usersI[0].PolicyString(),
+		"allow sign: " + td.usersI[0].PolicyString() + " & " + td.usersI[1].PolicyString(),
+		"allow sign: ed25519:zz",
+		"allow sign: rsa:0102",
+		"description: unquoted",
+		"allow sign",
+	} {
+		_, err = ParsePolicy(p)
+		require.NotNil(t, err, p)
+	}
+
+	// The parsed darc has to be valid.
+	_, err = ParsePolicy("allow sign: darc:0102")
+	require.Equal(t, &ParseError{0, "user 0: wrong length of darc-id"}, err)
+}
+
+func TestParsePolicy_Errors(t *testing.T) {
+	for policy, pos := range map[string]int{
+		"allow sign: ed25519:zz":           12,
+		"allow sign: darc:0102 | rsa:0102": 24,
+		"# comment\n  unknown: statement":  12,
+		"description: unquoted":            13,
+		"allow sign: darc:01 & darc:02":    20,
+	} {
+		_, err := ParsePolicy(policy)
+		pe, ok := err.(*ParseError)
+		require.True(t, ok, policy)
+		require.Equal(t, pos, pe.Pos, policy)
+	}
+
+	defer func(length, ids int) {
+		MaxPolicyLength, MaxPolicyIdentities = length, ids
+	}(MaxPolicyLength, MaxPolicyIdentities)
+	MaxPolicyLength, MaxPolicyIdentities = 100, 2
+	_, err := ParsePolicy("allow sign: x509ec:01 | x509ec:02")
+	require.Nil(t, err)
+	_, err = ParsePolicy("allow sign: x509ec:01; allow evolve: x509ec:02 | x509ec:03")
+	require.Equal(t, &ParseError{49, "too many identities"}, err)
+	_, err = ParsePolicy("# " + strings.Repeat("x", 100))
+	require.Equal(t, &ParseError{100, "policy is too long"}, err)
+}
+
+func TestParsePolicy_Random(t *testing.T) {
+	// Random policies made of the tokens of the format must not make the
+	// parser panic.
+	tokens := []string{"allow", " sign", " evolve", ":", "description", "\"",
+		"\\", ";", "\n", "|", "&", "[", "]", ",", "darc:", "ed25519:", "did:",
+		"oidc:", "webauthn:", "0x", "01", "zz", "%", " "}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var policy string
+		for j := rnd.Intn(20); j > 0; j-- {
+			policy += tokens[rnd.Intn(len(tokens))]
+		}
+		d, err := ParsePolicy(policy)
+		if err != nil {
+			_, ok := err.(*ParseError)
+			require.True(t, ok, policy)
+		} else {
+			require.NotNil(t, d)
+		}
+	}
+}
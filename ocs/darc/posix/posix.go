@@ -0,0 +1,141 @@
+/*
+Package posix maps UNIX-style permissions onto darcs, to ease porting
+applications whose access control is a file mode.
+
+Darcs have no rules, only owners, who can evolve a darc, and users, who can
+sign for it. So every permission gets its own darc: the users of the "read"
+darc are the owner and the group if they may read, and so on. The owner of
+the file owns all darcs. A darc can't list everyone, so modes granting
+permissions to others are refused.
+*/
+package posix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dedis/cothority/ocs/darc"
+)
+
+// Permission is one of the permissions of a file mode, with the value of
+// its bit for others.
+type Permission uint32
+
+const (
+	// Read is the permission to read.
+	Read Permission = 4
+	// Write is the permission to write.
+	Write Permission = 2
+	// Execute is the permission to execute.
+	Execute Permission = 1
+)
+
+// permissions lists all permissions in the order of a file mode.
+var permissions = []Permission{Read, Write, Execute}
+
+// String returns the name of the permission, which is the description of
+// its darc.
+func (p Permission) String() string {
+	switch p {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Execute:
+		return "execute"
+	}
+	return fmt.Sprintf("Permission(%d)", uint32(p))
+}
+
+// ErrOther is returned for a mode that gives permissions to others.
+var ErrOther = errors.New("darcs can't give permissions to others")
+
+// Permissions are the owner, the group and the mode of a file.
+type Permissions struct {
+	Owner *darc.Identity
+	Group []*darc.Identity
+	Mode  os.FileMode
+}
+
+// Darcs returns a darc for every permission.
+func (p *Permissions) Darcs() (map[Permission]*darc.Darc, error) {
+	if p.Owner == nil {
+		return nil, errors.New("missing owner")
+	}
+	if p.Mode&^os.ModePerm != 0 {
+		return nil, errors.New("mode has bits other than permissions")
+	}
+	if p.Mode&0007 != 0 {
+		return nil, ErrOther
+	}
+	darcs := make(map[Permission]*darc.Darc)
+	for _, perm := range permissions {
+		var users []*darc.Identity
+		if p.has(perm, 6) {
+			users = append(users, p.Owner)
+		}
+		if p.has(perm, 3) {
+			users = append(users, p.Group...)
+		}
+		owners := []*darc.Identity{p.Owner}
+		darcs[perm] = darc.NewDarc(&owners, &users, []byte(perm.String()))
+	}
+	return darcs, nil
+}
+
+// has returns true if the permission is set at the shift of the owner (6)
+// or the group (3).
+func (p *Permissions) has(perm Permission, shift uint) bool {
+	return p.Mode&os.FileMode(perm<<shift) != 0
+}
+
+// FromDarcs returns the permissions of the owner and the group in the darcs
+// returned by Darcs. A missing darc means the permission isn't given. It
+// returns an error if a darc has users that are neither the owner nor in the
+// group, or only a part of the group.
+func FromDarcs(owner *darc.Identity, group []*darc.Identity,
+	darcs map[Permission]*darc.Darc) (*Permissions, error) {
+	if owner == nil {
+		return nil, errors.New("missing owner")
+	}
+	p := &Permissions{Owner: owner, Group: group}
+	for _, perm := range permissions {
+		d, ok := darcs[perm]
+		if !ok {
+			continue
+		}
+		var users []*darc.Identity
+		if d.Users != nil {
+			users = *d.Users
+		}
+		inGroup := 0
+		for _, u := range users {
+			switch {
+			case u.Equal(owner):
+				p.Mode |= os.FileMode(perm << 6)
+			case contains(group, u):
+				inGroup++
+			default:
+				return nil, fmt.Errorf("%s darc has a user outside of owner and group", perm)
+			}
+		}
+		if inGroup > 0 && inGroup < len(group) {
+			return nil, fmt.Errorf("%s darc has only a part of the group", perm)
+		}
+		if inGroup > 0 {
+			p.Mode |= os.FileMode(perm << 3)
+		}
+	}
+	return p, nil
+}
+
+// contains returns true if id is in ids.
+func contains(ids []*darc.Identity, id *darc.Identity) bool {
+	for _, i := range ids {
+		if i.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package posix
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority/ocs/darc"
+)
+
+func identity() *darc.Identity {
+	return darc.NewSignerEd25519(nil, nil).Identity()
+}
+
+func TestPermissions_Darcs(t *testing.T) {
+	owner := identity()
+	group := []*darc.Identity{identity(), identity()}
+	for _, mode := range []os.FileMode{0750, 0640, 0700, 0070, 0} {
+		p := &Permissions{Owner: owner, Group: group, Mode: mode}
+		darcs, err := p.Darcs()
+		require.Nil(t, err)
+		require.Equal(t, 3, len(darcs))
+		require.Equal(t, "read", string(*darcs[Read].Description))
+		require.True(t, (*darcs[Write].Owners)[0].Equal(owner))
+
+		back, err := FromDarcs(owner, group, darcs)
+		require.Nil(t, err)
+		require.Equal(t, mode, back.Mode, mode.String())
+	}
+
+	p := &Permissions{Owner: owner, Group: group, Mode: 0644}
+	_, err := p.Darcs()
+	require.Equal(t, ErrOther, err)
+	p.Mode = os.ModeDir | 0700
+	_, err = p.Darcs()
+	require.NotNil(t, err)
+	p.Owner = nil
+	p.Mode = 0700
+	_, err = p.Darcs()
+	require.NotNil(t, err)
+}
+
+func TestFromDarcs(t *testing.T) {
+	owner := identity()
+	group := []*darc.Identity{identity(), identity()}
+	owners := []*darc.Identity{owner}
+
+	p, err := FromDarcs(owner, group, map[Permission]*darc.Darc{
+		Read: darc.NewDarc(&owners, &[]*darc.Identity{owner, group[0], group[1]}, nil),
+	})
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0440), p.Mode)
+
+	_, err = FromDarcs(owner, group, map[Permission]*darc.Darc{
+		Read: darc.NewDarc(&owners, &[]*darc.Identity{group[0]}, nil),
+	})
+	require.NotNil(t, err)
+	_, err = FromDarcs(owner, group, map[Permission]*darc.Darc{
+		Write: darc.NewDarc(&owners, &[]*darc.Identity{owner, identity()}, nil),
+	})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EvolveQuorum is the action of the quorum of a darc that the owners
+// signing a Proposal for its next version have to reach. Without such a
+// quorum, one owner is enough, like for Darc.SetEvolution.
+const EvolveQuorum = "evolve"
+
+// Proposal is a next version of a darc that is not signed yet. The owners
+// of the previous version add their signatures on the ID of the next
+// version over time, and once they satisfy the darc, the proposal is
+// finalized into the evolution.
+type Proposal struct {
+	// Darc is the next version, without signature
+	Darc *Darc
+	// Signatures of owners of the previous version on the ID of Darc
+	Signatures []*Signature
+}
+
+// NewProposal returns a proposal to evolve prev into next. The version and
+// base-id of next are set, and its signature is removed.
+func NewProposal(prev, next *Darc) *Proposal {
+	d := next.Copy()
+	d.Version = prev.Version + 1
+	id := prev.GetBaseID()
+	d.BaseID = &id
+	return &Proposal{Darc: d}
+}
+
+// ID returns the ID of the proposed darc, which doesn't change while
+// signatures are added.
+func (p *Proposal) ID() ID {
+	return p.Darc.GetID()
+}
+
+// Sign adds the signature of an owner of prev to the proposal.
+func (p *Proposal) Sign(prev *Darc, owner *Signer) error {
+	path := NewSignaturePath([]*Darc{prev}, *owner.Identity(), Owner)
+	sig, err := NewDarcSignature(p.ID(), path, owner)
+	if err != nil {
+		return err
+	}
+	return p.AddSignature(prev, sig)
+}
+
+// AddSignature adds the signature to the proposal if it is the signature
+// of an owner of prev who didn't sign yet.
+func (p *Proposal) AddSignature(prev *Darc, sig *Signature) error {
+	if err := p.verifySignature(prev, sig); err != nil {
+		return err
+	}
+	for _, s := range p.Signatures {
+		if s.SignaturePath.Signer.Equal(&sig.SignaturePath.Signer) {
+			return errors.New("owner already signed the proposal")
+		}
+	}
+	p.Signatures = append(p.Signatures, sig)
+	return nil
+}
+
+// Verify returns an error if the proposal is not the next version of prev,
+// or if one of its signatures is not from an owner of prev.
+func (p *Proposal) Verify(prev *Darc) error {
+	if p.Darc == nil {
+		return errors.New("missing darc in proposal")
+	}
+	if err := p.Darc.Validate(); err != nil {
+		return err
+	}
+	if p.Darc.Version != prev.Version+1 || p.Darc.BaseID == nil ||
+		!p.Darc.GetBaseID().Equal(prev.GetBaseID()) {
+		return errors.New("proposal is not the next version")
+	}
+	for i, sig := range p.Signatures {
+		if err := p.verifySignature(prev, sig); err != nil {
+			return fmt.Errorf("signature %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// Satisfied returns nil if the signatures reach the quorum of prev for
+// EvolveQuorum, or, without such a quorum, if an owner signed.
+func (p *Proposal) Satisfied(prev *Darc) error {
+	if err := p.Verify(prev); err != nil {
+		return err
+	}
+	return CheckEvolution(prev, p.ID(), p.Signatures)
+}
+
+// Finalize returns the proposed darc, signed with the first signature, if
+// the proposal is satisfied.
+func (p *Proposal) Finalize(prev *Darc) (*Darc, error) {
+	if err := p.Satisfied(prev); err != nil {
+		return nil, err
+	}
+	d := p.Darc.Copy()
+	d.Signature = p.Signatures[0]
+	return d, nil
+}
+
+// CheckEvolution returns nil if the signatures on the ID of the next version
+// of prev reach its quorum for EvolveQuorum. Without such a quorum, one
+// signature is needed. The signatures have to be verified beforehand.
+func CheckEvolution(prev *Darc, id ID, sigs []*Signature) error {
+	if prev.GetQuorum(EvolveQuorum) != nil {
+		return prev.CheckQuorum(EvolveQuorum, id, sigs)
+	}
+	if len(sigs) == 0 {
+		return errors.New("proposal is not signed")
+	}
+	return nil
+}
+
+// verifySignature makes sure that the signature is from an owner of prev
+// on the ID of the proposal.
+func (p *Proposal) verifySignature(prev *Darc, sig *Signature) error {
+	if sig == nil {
+		return errors.New("missing signature")
+	}
+	if sig.SignaturePath.Role != Owner {
+		return errors.New("signature is not from an owner")
+	}
+	if err := sig.Verify(p.ID(), prev); err != nil {
+		return err
+	}
+	return sig.SignaturePath.Verify(Owner)
+}
@@ -0,0 +1,39 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProposal(t *testing.T) {
+	td := createDarc("proposal")
+	next := td.darc.Copy()
+	next.AddUser(td.ownersI[0])
+	p := NewProposal(td.darc, next)
+	require.Nil(t, p.Verify(td.darc))
+	require.NotNil(t, p.Satisfied(td.darc))
+	_, err := p.Finalize(td.darc)
+	require.NotNil(t, err)
+
+	// Users cannot sign a proposal, and owners only once.
+	require.NotNil(t, p.Sign(td.darc, td.users[0]))
+	require.Nil(t, p.Sign(td.darc, td.owners[0]))
+	require.NotNil(t, p.Sign(td.darc, td.owners[0]))
+	d, err := p.Finalize(td.darc)
+	require.Nil(t, err)
+	require.Nil(t, d.Verify())
+	require.Equal(t, p.ID(), d.GetID())
+
+	// With a quorum for the evolution, both owners have to sign.
+	prev := td.darc.Copy()
+	prev.SetQuorum(EvolveQuorum, 2, []*Weight{{td.ownersI[0], 1}, {td.ownersI[1], 1}})
+	p = NewProposal(prev, next)
+	require.Nil(t, p.Sign(prev, td.owners[0]))
+	require.Equal(t, ErrQuorumNotReached, p.Satisfied(prev))
+	require.Nil(t, p.Sign(prev, td.owners[1]))
+	require.Nil(t, p.Satisfied(prev))
+
+	p.Darc.Version++
+	require.NotNil(t, p.Verify(prev))
+}
@@ -0,0 +1,185 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQuorumNotReached is returned if the signers of a request don't carry
+// enough weight for the quorum of its action.
+var ErrQuorumNotReached = errors.New("weight of the signers is below the quorum")
+
+// SetQuorum requires the weights of the signers of an action to add up to
+// at least threshold. This models boards where some members, like the
+// chairs, carry more voting power than others. A threshold of 0 removes the
+// quorum. Like the identities, the list is replaced instead of modified.
+func (d *Darc) SetQuorum(action string, threshold int, weights []*Weight) []*Quorum {
+	quorums := []*Quorum{}
+	for _, q := range d.Quorums {
+		if q.Action != action {
+			quorums = append(quorums, q)
+		}
+	}
+	if threshold > 0 {
+		quorums = append(quorums, &Quorum{Action: action, Threshold: threshold,
+			Weights: weights})
+	}
+	d.Quorums = quorums
+	return d.Quorums
+}
+
+// GetQuorum returns the quorum of the action, or nil if it has none.
+func (d *Darc) GetQuorum(action string) *Quorum {
+	for _, q := range d.Quorums {
+		if q.Action == action {
+			return q
+		}
+	}
+	return nil
+}
+
+// CheckQuorum returns nil if the signatures on msg are from identities of
+// the quorum of the action whose weights add up to its threshold. Every
+// signature has to be rooted at the darc, and every signer and every
+// identity of the quorum is only counted once. Signatures from identities
+// outside of the quorum, or outside of their Validity, are ignored.
+func (d *Darc) CheckQuorum(action string, msg []byte, sigs []*Signature) error {
+	q := d.GetQuorum(action)
+	if q == nil {
+		return fmt.Errorf("no quorum for action '%s'", action)
+	}
+	now := time.Now()
+	signers := make(map[string]bool)
+	counted := make(map[int]bool)
+	sum := 0
+	for _, sig := range sigs {
+		if sig == nil || sig.Verify(msg, d) != nil {
+			continue
+		}
+		signer := sig.SignaturePath.Signer
+		key := signer.PolicyString()
+		if signer.Pattern != nil || signers[key] {
+			continue
+		}
+		for i, w := range q.Weights {
+			if counted[i] || !(signer.Equal(w.Identity) || w.Identity.Pattern.Match(&signer)) ||
+				!w.Identity.Validity.Contains(now) {
+				continue
+			}
+			signers[key] = true
+			counted[i] = true
+			sum += w.Weight
+			break
+		}
+	}
+	if sum < q.Threshold {
+		return ErrQuorumNotReached
+	}
+	return nil
+}
+
+// validate makes sure the quorum has an action, valid and distinct
+// identities with positive weights, and a positive threshold the weights
+// can reach.
+func (q *Quorum) validate() error {
+	if q == nil || q.Action == "" || q.Threshold <= 0 {
+		return errors.New("needs an action and a positive threshold")
+	}
+	sum := 0
+	for i, w := range q.Weights {
+		if w == nil || w.Weight <= 0 {
+			return fmt.Errorf("weight %d: needs a positive weight", i)
+		}
+		if err := w.Identity.validate(); err != nil {
+			return fmt.Errorf("weight %d: %s", i, err)
+		}
+		for _, other := range q.Weights[:i] {
+			if w.Identity.Equal(other.Identity) {
+				return fmt.Errorf("weight %d: identity is given twice", i)
+			}
+		}
+		sum += w.Weight
+	}
+	if sum < q.Threshold {
+		return errors.New("threshold cannot be reached")
+	}
+	return nil
+}
+
+// policyString returns the quorum as used in the policy format:
+// 'weighted(<threshold>: <identity>=<weight>, ...)'.
+func (q *Quorum) policyString() string {
+	var strs []string
+	for _, w := range q.Weights {
+		strs = append(strs, fmt.Sprintf("%s=%d", w.Identity.PolicyString(), w.Weight))
+	}
+	return fmt.Sprintf("weighted(%d: %s)", q.Threshold, strings.Join(strs, ", "))
+}
+
+// parseQuorum parses the weighted expression of the action found at pos in
+// the policy. At most max identities are accepted.
+func parseQuorum(action, expr string, pos, max int) (*Quorum, error) {
+	if !strings.HasPrefix(expr, "weighted(") || !strings.HasSuffix(expr, ")") {
+		return nil, &ParseError{pos, "quorum must be 'weighted(<threshold>: <identity>=<weight>, ...)'"}
+	}
+	start := pos
+	pos += len("weighted(")
+	expr = expr[len("weighted(") : len(expr)-1]
+	sep := strings.Index(expr, ":")
+	if sep < 0 {
+		return nil, &ParseError{pos, "missing ':' after the threshold"}
+	}
+	threshold, err := strconv.Atoi(strings.TrimSpace(expr[:sep]))
+	if err != nil || threshold <= 0 {
+		return nil, &ParseError{pos, fmt.Sprintf("invalid threshold '%s'", expr[:sep])}
+	}
+	q := &Quorum{Action: action, Threshold: threshold}
+	pos += sep + 1
+	for _, s := range splitWeights(expr[sep+1:]) {
+		wPos := pos + len(s) - len(strings.TrimLeft(s, " \t"))
+		pos += len(s) + 1
+		if len(q.Weights) == max {
+			return nil, &ParseError{wPos, "too many identities"}
+		}
+		s = strings.TrimSpace(s)
+		eq := strings.LastIndex(s, "=")
+		if eq < 0 {
+			return nil, &ParseError{wPos, fmt.Sprintf("missing weight in '%s'", s)}
+		}
+		weight, err := strconv.Atoi(s[eq+1:])
+		if err != nil || weight <= 0 {
+			return nil, &ParseError{wPos, fmt.Sprintf("invalid weight in '%s'", s)}
+		}
+		id, err := ParseIdentity(s[:eq])
+		if err != nil {
+			return nil, &ParseError{wPos, err.Error()}
+		}
+		q.Weights = append(q.Weights, &Weight{Identity: id, Weight: weight})
+	}
+	if err := q.validate(); err != nil {
+		return nil, &ParseError{start, err.Error()}
+	}
+	return q, nil
+}
+
+// splitWeights splits the list of weights at ',', except inside of the
+// validity window of an identity.
+func splitWeights(list string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range list {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, list[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, list[start:])
+}
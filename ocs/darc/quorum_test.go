@@ -0,0 +1,79 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Quorums(t *testing.T) {
+	td := createDarc("board")
+	id := td.darc.GetID()
+	require.Nil(t, td.darc.GetQuorum("grant"))
+
+	d := td.darc.Copy()
+	d.SetQuorum("grant", 3, []*Weight{{td.usersI[0], 2}, {td.usersI[1], 1}})
+	require.False(t, d.GetID().Equal(id), "quorums are part of the id")
+	require.Equal(t, 3, d.GetQuorum("grant").Threshold)
+	require.Nil(t, d.Validate())
+	d.SetQuorum("grant", 0, nil)
+	require.Nil(t, d.GetQuorum("grant"))
+	require.True(t, d.Canonical().GetID().Equal(td.darc.Canonical().GetID()))
+	for _, q := range []*Quorum{
+		{"grant", 4, []*Weight{{td.usersI[0], 2}, {td.usersI[1], 1}}},
+		{"grant", 1, []*Weight{{td.usersI[0], 0}}},
+		{"grant", 2, []*Weight{{td.usersI[0], 1}, {td.usersI[0], 1}}},
+		{"", 1, []*Weight{{td.usersI[0], 1}}},
+	} {
+		d.Quorums = []*Quorum{q}
+		require.NotNil(t, d.Validate())
+	}
+
+	// Quorums survive the policy format.
+	d = td.darc.Copy()
+	d.SetQuorum("grant", 3, []*Weight{{td.usersI[0], 2}, {td.usersI[1], 1}})
+	p, err := ParsePolicy(d.Policy())
+	require.Nil(t, err)
+	require.True(t, p.GetID().Equal(d.GetID()))
+	for _, policy := range []string{"quorum grant: 3", "quorum grant: weighted(3)",
+		"quorum grant: weighted(0: x509ec:00=1)", "quorum grant: weighted(2: x509ec:00=1)",
+		"quorum grant: weighted(1: x509ec:00)", "quorum grant: weighted(1: x509ec:00=-1)",
+		"quorum grant: weighted(1: x509ec:00=1); quorum grant: weighted(1: x509ec:01=1)"} {
+		_, err = ParsePolicy(policy)
+		require.NotNil(t, err, policy)
+	}
+	p, err = ParsePolicy("quorum grant: weighted(2: x509ec:00[1,0]=1, x509ec:01=1)")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(p.GetQuorum("grant").Weights))
+}
+
+func TestDarc_CheckQuorum(t *testing.T) {
+	td := createDarc("board")
+	d := td.darc.Copy()
+	chair, chairI := createSignerIdentity()
+	d.SetQuorum("grant", 3, []*Weight{{chairI, 2}, {td.usersI[0], 1}, {td.usersI[1], 1}})
+	msg := []byte("grant")
+	sign := func(s *Signer, id *Identity) *Signature {
+		sig, err := NewDarcSignature(msg, NewSignaturePath([]*Darc{d}, *id, User), s)
+		require.Nil(t, err)
+		return sig
+	}
+	chairSig := sign(chair, chairI)
+	user0 := sign(td.users[0], td.usersI[0])
+	user1 := sign(td.users[1], td.usersI[1])
+
+	require.Nil(t, d.CheckQuorum("grant", msg, []*Signature{chairSig, user0}))
+	require.Nil(t, d.CheckQuorum("grant", msg, []*Signature{chairSig, user1}))
+	require.Equal(t, ErrQuorumNotReached,
+		d.CheckQuorum("grant", msg, []*Signature{user0, user1}))
+	// Every signer only counts once.
+	require.Equal(t, ErrQuorumNotReached,
+		d.CheckQuorum("grant", msg, []*Signature{chairSig, chairSig}))
+	// Wrong signatures and identities outside of the quorum don't count.
+	owner := sign(td.owners[0], td.ownersI[0])
+	require.Equal(t, ErrQuorumNotReached,
+		d.CheckQuorum("grant", []byte("other"), []*Signature{chairSig, user0}))
+	require.Equal(t, ErrQuorumNotReached,
+		d.CheckQuorum("grant", msg, []*Signature{chairSig, owner}))
+	require.NotNil(t, d.CheckQuorum("revoke", msg, []*Signature{chairSig, user0}))
+}
@@ -0,0 +1,121 @@
+package darc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned for a request that exceeds the limit of its
+// action.
+var ErrRateLimited = errors.New("rate limit of the action exceeded")
+
+// SetLimit limits how often a signer can do the action under the darc. A
+// maximum of 0 removes the limit. Like the identities, the list is replaced
+// instead of modified.
+func (d *Darc) SetLimit(action string, maxPerHour int) []*Limit {
+	limits := []*Limit{}
+	for _, l := range d.Limits {
+		if l.Action != action {
+			limits = append(limits, l)
+		}
+	}
+	if maxPerHour > 0 {
+		limits = append(limits, &Limit{Action: action, MaxPerHour: maxPerHour})
+	}
+	d.Limits = limits
+	return d.Limits
+}
+
+// GetLimit returns the limit of the action, or nil if it is not limited.
+func (d *Darc) GetLimit(action string) *Limit {
+	for _, l := range d.Limits {
+		if l.Action == action {
+			return l
+		}
+	}
+	return nil
+}
+
+// RateCounter stores the requests done under a limit, so that the conodes
+// can share the counts, or keep them across restarts.
+type RateCounter interface {
+	// Add stores a request for the key at the unix time now, unless max
+	// requests have been stored for the key since the unix time since, in
+	// which case it returns ErrRateLimited.
+	Add(key []byte, now, since int64, max int) error
+}
+
+// MemoryRateCounter is a RateCounter that keeps the requests in memory.
+// Requests older than an hour are removed whenever a new request is added.
+type MemoryRateCounter struct {
+	sync.Mutex
+	requests map[string][]int64
+}
+
+// NewMemoryRateCounter returns an empty counter.
+func NewMemoryRateCounter() *MemoryRateCounter {
+	return &MemoryRateCounter{requests: make(map[string][]int64)}
+}
+
+// Add implements RateCounter.
+func (mrc *MemoryRateCounter) Add(key []byte, now, since int64, max int) error {
+	mrc.Lock()
+	defer mrc.Unlock()
+	for k, times := range mrc.requests {
+		if len(times) == 0 || times[len(times)-1] < now-3600 {
+			delete(mrc.requests, k)
+		}
+	}
+	var times []int64
+	for _, t := range mrc.requests[string(key)] {
+		if t >= since {
+			times = append(times, t)
+		}
+	}
+	if len(times) >= max {
+		mrc.requests[string(key)] = times
+		return ErrRateLimited
+	}
+	mrc.requests[string(key)] = append(times, now)
+	return nil
+}
+
+// RateLimitedChecker checks the requests like CheckRequestForResource, and
+// then enforces the limit that the darc sets on the action of the request.
+// The requests of every signer are counted separately for every darc
+// series.
+type RateLimitedChecker struct {
+	counter RateCounter
+}
+
+// NewRateLimitedChecker returns a checker storing the requests in counter,
+// or in memory if counter is nil.
+func NewRateLimitedChecker(counter RateCounter) *RateLimitedChecker {
+	if counter == nil {
+		counter = NewMemoryRateCounter()
+	}
+	return &RateLimitedChecker{counter: counter}
+}
+
+// CheckRequest returns nil if the request is signed for the base darc, the
+// base darc governs the resource, and the signer didn't exceed the limit of
+// the action. Only accepted requests are counted.
+func (rlc *RateLimitedChecker) CheckRequest(r Request, base *Darc, id []byte,
+	action string) error {
+	if err := CheckRequestForResource(r, base, id); err != nil {
+		return err
+	}
+	limit := base.GetLimit(action)
+	if limit == nil {
+		return nil
+	}
+	var key bytes.Buffer
+	key.Write(base.GetBaseID())
+	key.WriteString(action)
+	key.WriteByte(0)
+	key.WriteString(r.DarcSignature().SignaturePath.Signer.PolicyString())
+	now := time.Now().Unix()
+	return rlc.counter.Add(key.Bytes(), now, now-3600, limit.MaxPerHour)
+}
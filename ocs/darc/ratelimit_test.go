@@ -0,0 +1,83 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Limits(t *testing.T) {
+	td := createDarc("recovery")
+	id := td.darc.GetID()
+	require.Nil(t, td.darc.GetLimit("recover"))
+
+	d := td.darc.Copy()
+	d.SetLimit("recover", 3)
+	require.False(t, d.GetID().Equal(id), "limits are part of the id")
+	require.Equal(t, 3, d.GetLimit("recover").MaxPerHour)
+	require.Nil(t, d.Validate())
+	d.SetLimit("recover", 0)
+	require.Nil(t, d.GetLimit("recover"))
+	require.True(t, d.GetID().Equal(d.Canonical().GetID()))
+	require.True(t, d.Canonical().GetID().Equal(td.darc.Canonical().GetID()))
+	d.Limits = []*Limit{{"recover", 1}, {"recover", 2}}
+	require.NotNil(t, d.Validate())
+	d.Limits = []*Limit{{"recover", -1}}
+	require.NotNil(t, d.Validate())
+
+	// Limits survive the policy format.
+	d = td.darc.Copy()
+	d.SetLimit("recover", 3)
+	d.SetLimit("read", 100)
+	p, err := ParsePolicy(d.Policy())
+	require.Nil(t, err)
+	require.Equal(t, d.Limits, p.Limits)
+	for _, policy := range []string{"limit recover: 3", "limit recover: maxPerHour=0",
+		"limit: maxPerHour=1", "limit a b: maxPerHour=1",
+		"limit a: maxPerHour=1; limit a: maxPerHour=2"} {
+		_, err = ParsePolicy(policy)
+		require.NotNil(t, err, policy)
+	}
+}
+
+func TestRateLimitedChecker(t *testing.T) {
+	td := createDarc("recovery")
+	d := td.darc.Copy()
+	d.SetLimit("recover", 2)
+	sign := func(i int) *adminRequest {
+		req := &adminRequest{Data: []byte("recover")}
+		path := NewSignaturePath([]*Darc{d}, *td.usersI[i], User)
+		var err error
+		req.Signature, err = NewDarcSignature(req.Data, path, td.users[i])
+		require.Nil(t, err)
+		return req
+	}
+
+	rlc := NewRateLimitedChecker(nil)
+	require.Nil(t, rlc.CheckRequest(sign(0), d, nil, "recover"))
+	require.Nil(t, rlc.CheckRequest(sign(0), d, nil, "recover"))
+	require.Equal(t, ErrRateLimited, rlc.CheckRequest(sign(0), d, nil, "recover"))
+	// Other signers and actions are counted separately.
+	require.Nil(t, rlc.CheckRequest(sign(1), d, nil, "recover"))
+	for i := 0; i < 5; i++ {
+		require.Nil(t, rlc.CheckRequest(sign(0), d, nil, "read"))
+	}
+	// Refused requests are not counted.
+	require.NotNil(t, rlc.CheckRequest(&adminRequest{}, d, nil, "recover"))
+	require.Nil(t, rlc.CheckRequest(sign(1), d, nil, "recover"))
+	require.Equal(t, ErrRateLimited, rlc.CheckRequest(sign(1), d, nil, "recover"))
+}
+
+func TestMemoryRateCounter(t *testing.T) {
+	mrc := NewMemoryRateCounter()
+	key := []byte("key")
+	require.Nil(t, mrc.Add(key, 100, 0, 2))
+	require.Nil(t, mrc.Add(key, 200, 0, 2))
+	require.Equal(t, ErrRateLimited, mrc.Add(key, 300, 0, 2))
+	// The first request is out of the window.
+	require.Nil(t, mrc.Add(key, 300, 150, 2))
+	require.Equal(t, ErrRateLimited, mrc.Add(key, 300, 150, 2))
+	// Old keys are removed.
+	require.Nil(t, mrc.Add([]byte("other"), 10000, 0, 1))
+	require.Equal(t, 1, len(mrc.requests))
+}
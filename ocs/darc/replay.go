@@ -0,0 +1,47 @@
+package darc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplayCache keeps track of the nonces of signatures that have already been
+// verified, so that a signature cannot be used twice.
+type ReplayCache interface {
+	// Add returns an error if the nonce has already been added, else it
+	// stores the nonce until the unix time expiration.
+	Add(nonce []byte, expiration int64) error
+}
+
+// MemoryReplayCache is a ReplayCache that keeps all nonces in memory. Expired
+// nonces are removed whenever a new nonce is added.
+type MemoryReplayCache struct {
+	sync.Mutex
+	nonces map[string]int64
+}
+
+// NewMemoryReplayCache returns an empty cache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{nonces: make(map[string]int64)}
+}
+
+// Add implements ReplayCache.
+func (mrc *MemoryReplayCache) Add(nonce []byte, expiration int64) error {
+	mrc.Lock()
+	defer mrc.Unlock()
+	now := time.Now().Unix()
+	if expiration == 0 {
+		return errors.New("nonce needs an expiration")
+	}
+	for n, exp := range mrc.nonces {
+		if exp < now {
+			delete(mrc.nonces, n)
+		}
+	}
+	if _, ok := mrc.nonces[string(nonce)]; ok {
+		return errors.New("signature has already been used")
+	}
+	mrc.nonces[string(nonce)] = expiration
+	return nil
+}
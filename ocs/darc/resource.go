@@ -0,0 +1,50 @@
+package darc
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// ErrWrongResource is returned for a request on a resource that the darc
+// doesn't govern.
+var ErrWrongResource = errors.New("darc doesn't govern this resource")
+
+// AddResource binds the darc to the resource with the given ID. Like the
+// identities, the list is replaced instead of modified.
+func (d *Darc) AddResource(id []byte) [][]byte {
+	d.Resources = append(append([][]byte{}, d.Resources...), id)
+	return d.Resources
+}
+
+// Governs returns true if the darc is bound to the resource, or if it isn't
+// bound to any resource.
+func (d *Darc) Governs(id []byte) bool {
+	if len(d.Resources) == 0 {
+		return true
+	}
+	for _, r := range d.Resources {
+		if bytes.Equal(r, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRequestForResource returns nil if the request is signed for the base
+// darc and the base darc governs the resource. This keeps a darc that was
+// bound to a document from being used for another one.
+func CheckRequestForResource(r Request, base *Darc, id []byte) error {
+	if !base.Governs(id) {
+		return ErrWrongResource
+	}
+	sig := r.DarcSignature()
+	if sig == nil {
+		return errors.New("request is not signed")
+	}
+	msg, err := r.SignedMessage()
+	if err != nil {
+		return err
+	}
+	return sig.VerifyAt(msg, base, time.Now())
+}
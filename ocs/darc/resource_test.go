@@ -0,0 +1,48 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarc_Resources(t *testing.T) {
+	td := createDarc("doc")
+	id := td.darc.GetID()
+	require.True(t, td.darc.Governs([]byte("any")))
+
+	d := td.darc.Copy()
+	d.AddResource([]byte("doc1"))
+	require.False(t, d.GetID().Equal(id), "resources are part of the id")
+	require.Equal(t, d.GetID(), d.Copy().GetID())
+	require.True(t, d.Governs([]byte("doc1")))
+	require.False(t, d.Governs([]byte("doc2")))
+	require.Nil(t, d.Validate())
+	d.AddResource(nil)
+	require.NotNil(t, d.Validate())
+
+	// Resources survive the policy format.
+	d = td.darc.Copy()
+	d.AddResource([]byte{0xab, 0xcd})
+	p, err := ParsePolicy(d.Policy())
+	require.Nil(t, err)
+	require.Equal(t, [][]byte{{0xab, 0xcd}}, p.Resources)
+	_, err = ParsePolicy("resource: xyz")
+	require.NotNil(t, err)
+}
+
+func TestCheckRequestForResource(t *testing.T) {
+	td := createDarc("doc")
+	d := td.darc.Copy()
+	d.AddResource([]byte("doc1"))
+	req := &adminRequest{Data: []byte("read")}
+	path := NewSignaturePath([]*Darc{d}, *td.usersI[0], User)
+	var err error
+	req.Signature, err = NewDarcSignature(req.Data, path, td.users[0])
+	require.Nil(t, err)
+
+	require.Nil(t, CheckRequestForResource(req, d, []byte("doc1")))
+	require.Equal(t, ErrWrongResource, CheckRequestForResource(req, d, []byte("doc2")))
+	require.NotNil(t, CheckRequestForResource(req, td.darc, []byte("doc1")))
+	require.NotNil(t, CheckRequestForResource(&adminRequest{}, d, []byte("doc1")))
+}
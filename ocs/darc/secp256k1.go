@@ -0,0 +1,245 @@
+package darc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strconv"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// This file implements Ethereum compatible identities. Signatures are
+// recoverable ECDSA signatures on the secp256k1 curve as created by
+// 'personal_sign': the message is prefixed with
+// "\x19Ethereum Signed Message:\n" and its length, and then hashed with
+// Keccak-256. A signature is r || s || v with v being 0, 1, 27 or 28.
+
+// addressLength is the length of an Ethereum address.
+const addressLength = 20
+
+// secp256k1 holds the parameters of the curve y² = x³ + 7.
+var secp256k1 = struct {
+	P, N, Gx, Gy *big.Int
+}{
+	P:  hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+	N:  hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	Gx: hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+	Gy: hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+}
+
+// NewIdentitySecp256k1 returns an identity for the given Ethereum address.
+func NewIdentitySecp256k1(address []byte) *Identity {
+	return &Identity{
+		Secp256k1: &IdentitySecp256k1{
+			Address: address,
+		},
+	}
+}
+
+// Equal returns true if both IdentitySecp256k1 hold the same address.
+func (ids *IdentitySecp256k1) Equal(ids2 *IdentitySecp256k1) bool {
+	return bytes.Equal(ids.Address, ids2.Address)
+}
+
+// Verify recovers the public key from the signature and returns nil if it
+// corresponds to the address of the identity.
+func (ids *IdentitySecp256k1) Verify(msg, sig []byte) error {
+	x, y, err := secp256k1Recover(ethereumHash(msg), sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(ethereumAddress(x, y), ids.Address) {
+		return errors.New("Wrong signature")
+	}
+	return nil
+}
+
+// NewSignerSecp256k1 returns a signer for the given private key, creating a
+// new one if it is nil. It is for tests only: the curve arithmetic of this
+// file is not constant time, so signing leaks timing information about the
+// key. Real keys stay in the Ethereum wallet, which can be used with
+// NewSignerExternal, and only the verification is done here.
+func NewSignerSecp256k1(private *big.Int) (*Signer, error) {
+	if private == nil {
+		var err error
+		private, err = rand.Int(rand.Reader, new(big.Int).Sub(secp256k1.N, big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+		private.Add(private, big.NewInt(1))
+	}
+	if private.Sign() <= 0 || private.Cmp(secp256k1.N) >= 0 {
+		return nil, errors.New("private key out of range")
+	}
+	x, y := secp256k1Mul(secp256k1.Gx, secp256k1.Gy, private)
+	public := NewIdentitySecp256k1(ethereumAddress(x, y))
+	return NewSignerExternal(public, func(msg []byte) ([]byte, error) {
+		return secp256k1Sign(ethereumHash(msg), private)
+	}), nil
+}
+
+// ethereumHash returns the hash signed by 'personal_sign'.
+func ethereumHash(msg []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte("\x19Ethereum Signed Message:\n" + strconv.Itoa(len(msg))))
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// ethereumAddress returns the last 20 bytes of the Keccak-256 hash of the
+// uncompressed public key.
+func ethereumAddress(x, y *big.Int) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(padBytes(x))
+	h.Write(padBytes(y))
+	return h.Sum(nil)[32-addressLength:]
+}
+
+// secp256k1Sign returns a recoverable signature on hash. Like
+// NewSignerSecp256k1, it is not constant time and only meant for tests.
+func secp256k1Sign(hash []byte, private *big.Int) ([]byte, error) {
+	n := secp256k1.N
+	e := new(big.Int).SetBytes(hash)
+	for {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		if k.Sign() == 0 {
+			continue
+		}
+		rx, ry := secp256k1Mul(secp256k1.Gx, secp256k1.Gy, k)
+		if rx.Cmp(n) >= 0 {
+			// The recovery id cannot express this case.
+			continue
+		}
+		r := new(big.Int).Set(rx)
+		s := new(big.Int).Mul(r, private)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		v := byte(ry.Bit(0))
+		// Only use the lower half of s, as Ethereum does.
+		if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+			s.Sub(n, s)
+			v ^= 1
+		}
+		return append(append(padBytes(r), padBytes(s)...), 27+v), nil
+	}
+}
+
+// secp256k1Recover returns the public key that created the signature on
+// hash.
+func secp256k1Recover(hash, sig []byte) (*big.Int, *big.Int, error) {
+	if len(sig) != 65 {
+		return nil, nil, errors.New("secp256k1 signature must be 65 bytes")
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return nil, nil, errors.New("invalid recovery id")
+	}
+	p, n := secp256k1.P, secp256k1.N
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(n) >= 0 {
+		return nil, nil, errors.New("signature out of range")
+	}
+	// y² = x³ + 7, and as p = 3 mod 4, y = (y²)^((p+1)/4)
+	ySquare := new(big.Int).Exp(r, big.NewInt(3), p)
+	ySquare.Add(ySquare, big.NewInt(7))
+	ySquare.Mod(ySquare, p)
+	ry := new(big.Int).Exp(ySquare, new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2), p)
+	if new(big.Int).Exp(ry, big.NewInt(2), p).Cmp(ySquare) != 0 {
+		return nil, nil, errors.New("r is not on the curve")
+	}
+	if ry.Bit(0) != uint(v) {
+		ry.Sub(p, ry)
+	}
+	// Q = r⁻¹ (sR - eG)
+	rInv := new(big.Int).ModInverse(r, n)
+	e := new(big.Int).SetBytes(hash)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, n)
+	x1, y1 := secp256k1Mul(secp256k1.Gx, secp256k1.Gy, u1)
+	x2, y2 := secp256k1Mul(r, ry, u2)
+	qx, qy := secp256k1Add(x1, y1, x2, y2)
+	if qx == nil {
+		return nil, nil, errors.New("recovered point at infinity")
+	}
+	return qx, qy, nil
+}
+
+// secp256k1Add adds two points in affine coordinates. The point at infinity
+// is represented by nil coordinates.
+func secp256k1Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	if x1 == nil {
+		return x2, y2
+	}
+	if x2 == nil {
+		return x1, y1
+	}
+	p := secp256k1.P
+	var lambda *big.Int
+	if x1.Cmp(x2) == 0 {
+		if y1.Cmp(y2) != 0 || y1.Sign() == 0 {
+			return nil, nil
+		}
+		// lambda = 3x² / 2y
+		lambda = new(big.Int).Mul(x1, x1)
+		lambda.Mul(lambda, big.NewInt(3))
+		lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Lsh(y1, 1), p))
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		lambda = new(big.Int).Sub(y2, y1)
+		dx := new(big.Int).Sub(x2, x1)
+		dx.Mod(dx, p)
+		lambda.Mul(lambda, new(big.Int).ModInverse(dx, p))
+	}
+	lambda.Mod(lambda, p)
+	x3 := new(big.Int).Mul(lambda, lambda)
+	x3.Sub(x3, x1)
+	x3.Sub(x3, x2)
+	x3.Mod(x3, p)
+	y3 := new(big.Int).Sub(x1, x3)
+	y3.Mul(y3, lambda)
+	y3.Sub(y3, y1)
+	y3.Mod(y3, p)
+	return x3, y3
+}
+
+// secp256k1Mul returns k * (x, y) using double-and-add.
+func secp256k1Mul(x, y, k *big.Int) (*big.Int, *big.Int) {
+	var rx, ry *big.Int
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		rx, ry = secp256k1Add(rx, ry, rx, ry)
+		if k.Bit(i) == 1 {
+			rx, ry = secp256k1Add(rx, ry, x, y)
+		}
+	}
+	return rx, ry
+}
+
+// padBytes returns the 32 bytes big-endian representation of i.
+func padBytes(i *big.Int) []byte {
+	buf := i.Bytes()
+	return append(make([]byte, 32-len(buf)), buf...)
+}
+
+func hexInt(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid constant " + s)
+	}
+	return i
+}
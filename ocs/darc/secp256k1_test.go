@@ -0,0 +1,46 @@
+package darc
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentitySecp256k1_Verify(t *testing.T) {
+	// Test vector from the web3.js documentation of 'personal_sign'.
+	address, err := hex.DecodeString("2c7536e3605d9c16a7a3d7b1898e529396a65c23")
+	require.Nil(t, err)
+	sig, err := hex.DecodeString("b91467e570a6466aa9e9876cbcd013baba02900b8979d43fe208a4a4f339f5fd" +
+		"6007e74cd82e037b800186422fc2da167c747ef045e5d18a5f5d4300f8e1a0291c")
+	require.Nil(t, err)
+	id := NewIdentitySecp256k1(address)
+	require.Nil(t, id.Verify([]byte("Some data"), sig))
+	require.NotNil(t, id.Verify([]byte("Other data"), sig))
+	sig[64] ^= 1
+	require.NotNil(t, id.Verify([]byte("Some data"), sig))
+
+	private, ok := new(big.Int).SetString("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318", 16)
+	require.True(t, ok)
+	signer, err := NewSignerSecp256k1(private)
+	require.Nil(t, err)
+	require.True(t, signer.Identity().Equal(id))
+}
+
+func TestSignerSecp256k1(t *testing.T) {
+	msg := []byte("document")
+	signer, err := NewSignerSecp256k1(nil)
+	require.Nil(t, err)
+	td := createDarc("testdarc")
+	td.darc.AddUser(signer.Identity())
+	path := NewSignaturePath([]*Darc{td.darc}, *signer.Identity(), User)
+	ds, err := NewDarcSignature(msg, path, signer)
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, td.darc))
+	require.Nil(t, path.Verify(User))
+
+	id, err := ParseIdentity(signer.Identity().PolicyString())
+	require.Nil(t, err)
+	require.True(t, id.Equal(signer.Identity()))
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/onet"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// Client is a structure to communicate with the darc service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient instantiates a new darc service client.
+func NewClient() *Client {
+	return &Client{Client: onet.NewClient(cothority.Suite, ServiceName)}
+}
+
+// CreateRegistry creates a new registry of darcs held by the roster and
+// returns its genesis block.
+func (c *Client) CreateRegistry(roster *onet.Roster) (*skipchain.SkipBlock, error) {
+	if roster == nil || len(roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	reply := &CreateRegistryReply{}
+	err := c.SendProtobuf(roster.List[0], &CreateRegistry{Roster: roster}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Registry, nil
+}
+
+// StoreDarc adds the darc to the registry. A new version of a darc has to be
+// created with Darc.SetEvolution from the latest version in the registry.
+func (c *Client) StoreDarc(registry *skipchain.SkipBlock, d *darc.Darc) (*skipchain.SkipBlock, error) {
+	reply := &StoreDarcReply{}
+	err := c.SendProtobuf(registry.Roster.List[0], &StoreDarc{
+		Registry: registry.SkipChainID(),
+		Darc:     d,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Block, nil
+}
+
+// GetEvolution returns all versions of the darc with the given base ID,
+// after checking them with VerifyEvolution.
+func (c *Client) GetEvolution(registry *skipchain.SkipBlock, baseID darc.ID) ([]*darc.Darc, error) {
+	reply := &GetEvolutionReply{}
+	err := c.SendProtobuf(registry.Roster.RandomServerIdentity(), &GetEvolution{
+		Registry: registry.SkipChainID(),
+		BaseID:   baseID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyEvolution(baseID, reply.Darcs); err != nil {
+		return nil, err
+	}
+	return reply.Darcs, nil
+}
+
+// GetHistory returns the events of all versions of the darc with the given
+// base ID, including the time they were stored at, after checking the
+// evolution with VerifyEvolution. The timestamps and the signatures of a
+// quorum are only checked by the nodes of the registry.
+func (c *Client) GetHistory(registry *skipchain.SkipBlock, baseID darc.ID) ([]*darc.Event, error) {
+	reply := &GetHistoryReply{}
+	err := c.SendProtobuf(registry.Roster.RandomServerIdentity(), &GetHistory{
+		Registry: registry.SkipChainID(),
+		BaseID:   baseID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	var darcs []*darc.Darc
+	for _, v := range reply.Versions {
+		if v == nil {
+			return nil, errors.New("missing version in history")
+		}
+		darcs = append(darcs, v.Darc)
+	}
+	if err := VerifyEvolution(baseID, darcs); err != nil {
+		return nil, err
+	}
+	return darcs[0].History(func(darc.ID) ([]*darc.StoredVersion, error) {
+		return reply.Versions, nil
+	})
+}
+
+// GetLatestDarc returns the latest version of the darc with the given base
+// ID. The conode has to prove the evolution from the base darc, so it
+// cannot return an outdated or forged version, but it can still omit the
+// newest versions.
+func (c *Client) GetLatestDarc(registry *skipchain.SkipBlock, baseID darc.ID) (*darc.Darc, error) {
+	darcs, err := c.GetEvolution(registry, baseID)
+	if err != nil {
+		return nil, err
+	}
+	return darcs[len(darcs)-1], nil
+}
+
+// GetRevocationProof returns the proof that the identity cannot sign for the
+// role in the latest version of the darc with the given base ID, after
+// checking it with RevocationProof.Verify at the current time.
+func (c *Client) GetRevocationProof(registry *skipchain.SkipBlock, baseID darc.ID,
+	id *darc.Identity, role darc.Role) (*RevocationProof, error) {
+	reply := &GetRevocationProofReply{}
+	err := c.SendProtobuf(registry.Roster.RandomServerIdentity(), &GetRevocationProof{
+		Registry: registry.SkipChainID(),
+		BaseID:   baseID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Proof == nil {
+		return nil, errors.New("missing proof")
+	}
+	if err := reply.Proof.Verify(registry.SkipChainID(), baseID, id, role, time.Now()); err != nil {
+		return nil, err
+	}
+	return reply.Proof, nil
+}
+
+// VerifyEvolution checks that darcs holds all versions of the darc with the
+// given base ID, in order, and that every version is signed by an owner of
+// the previous one.
+func VerifyEvolution(baseID darc.ID, darcs []*darc.Darc) error {
+	if len(darcs) == 0 {
+		return errors.New("empty evolution")
+	}
+	for i, d := range darcs {
+		if d == nil || d.Version != i {
+			return errors.New("missing version in evolution")
+		}
+		if i == 0 {
+			if !d.GetID().Equal(baseID) {
+				return errors.New("evolution doesn't start at the base darc")
+			}
+			continue
+		}
+		if d.BaseID == nil || !d.GetBaseID().Equal(baseID) {
+			return errors.New("darc of another evolution")
+		}
+		if err := verifyEvolution(darcs[i-1], d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyEvolution checks that d is the next version of prev, signed by one
+// of its owners.
+func verifyEvolution(prev, d *darc.Darc) error {
+	if err := d.Verify(); err != nil {
+		return errors.New("invalid evolution: " + err.Error())
+	}
+	latest, err := d.GetLatest()
+	if err != nil {
+		return err
+	}
+	if latest == nil || !latest.GetID().Equal(prev.GetID()) {
+		return errors.New("evolution is not signed for the previous version")
+	}
+	return nil
+}
+
+// ProposeDarc stores the proposal for the next version of a darc in the
+// registry, so that the owners of the latest version can sign it with
+// SignProposal. It returns the block holding the darc if the signatures of
+// the proposal already satisfy the latest version, or nil.
+func (c *Client) ProposeDarc(registry *skipchain.SkipBlock, p *darc.Proposal) (*skipchain.SkipBlock, error) {
+	reply := &ProposeDarcReply{}
+	err := c.SendProtobuf(registry.Roster.List[0], &ProposeDarc{
+		Registry: registry.SkipChainID(),
+		Proposal: p,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Block, nil
+}
+
+// SignProposal signs the pending proposal with the given ID as an owner of
+// the latest version prev. It returns the block holding the darc once the
+// proposal is finalized, or nil.
+func (c *Client) SignProposal(registry *skipchain.SkipBlock, prev *darc.Darc, id darc.ID,
+	owner *darc.Signer) (*skipchain.SkipBlock, error) {
+	path := darc.NewSignaturePath([]*darc.Darc{prev}, *owner.Identity(), darc.Owner)
+	sig, err := darc.NewDarcSignature(id, path, owner)
+	if err != nil {
+		return nil, err
+	}
+	reply := &SignProposalReply{}
+	err = c.SendProtobuf(registry.Roster.List[0], &SignProposal{
+		Registry:  registry.SkipChainID(),
+		ID:        id,
+		Signature: sig,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Block, nil
+}
+
+// GetProposals returns the pending proposals for the next version of the
+// darc with the given base ID.
+func (c *Client) GetProposals(registry *skipchain.SkipBlock, baseID darc.ID) ([]*darc.Proposal, error) {
+	reply := &GetProposalsReply{}
+	err := c.SendProtobuf(registry.Roster.List[0], &GetProposals{
+		Registry: registry.SkipChainID(),
+		BaseID:   baseID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Proposals, nil
+}
+
+// WithdrawProposal removes the pending proposal with the given ID, signed
+// by an owner of the latest version prev.
+func (c *Client) WithdrawProposal(registry *skipchain.SkipBlock, prev *darc.Darc, id darc.ID,
+	owner *darc.Signer) error {
+	path := darc.NewSignaturePath([]*darc.Darc{prev}, *owner.Identity(), darc.Owner)
+	sig, err := darc.NewDarcSignature(WithdrawMessage(id), path, owner)
+	if err != nil {
+		return err
+	}
+	return c.SendProtobuf(registry.Roster.List[0], &WithdrawProposal{
+		Registry:  registry.SkipChainID(),
+		ID:        id,
+		Signature: sig,
+	}, &WithdrawProposalReply{})
+}
+
+// CheckpointDarc returns the latest version of the darc with the given base
+// ID, with a checkpoint of the roster of the registry instead of its
+// evolution signature, after checking the checkpoint. A darc-link to the
+// base ID can then be verified with darc.SignaturePath.VerifyCheckpoints
+// and the public keys of the roster, until the checkpoint expires.
+func (c *Client) CheckpointDarc(registry *skipchain.SkipBlock, baseID darc.ID) (*darc.Darc, error) {
+	reply := &CheckpointDarcReply{}
+	err := c.SendProtobuf(registry.Roster.List[0], &CheckpointDarc{
+		Registry: registry.SkipChainID(),
+		BaseID:   baseID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Darc == nil || reply.Darc.BaseID == nil || !reply.Darc.GetBaseID().Equal(baseID) {
+		return nil, errors.New("checkpoint of another darc")
+	}
+	if err := reply.Darc.VerifyCheckpoint(registry.Roster.Publics(), time.Now()); err != nil {
+		return nil, err
+	}
+	return reply.Darc, nil
+}
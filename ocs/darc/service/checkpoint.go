@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ftcosi/protocol"
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// Names of the ftcosi protocol signing the checkpoints and of its
+// sub-protocol.
+const (
+	checkpointProtocol    = "DarcCheckpoint"
+	checkpointSubProtocol = "DarcCheckpointSub"
+)
+
+// checkpointData is sent along the checkpoint message, so that every node
+// can check that it signs the latest version of the darc.
+type checkpointData struct {
+	Registry   skipchain.SkipBlockID
+	BaseID     darc.ID
+	Expiration int64
+}
+
+// CheckpointDarc has the roster of the registry co-sign the latest version
+// of a darc, see darc.Darc.SetCheckpoint. Only the leader of the registry
+// starts the signature, so that the collective signature verifies against
+// the roster in its order.
+func (s *Service) CheckpointDarc(req *CheckpointDarc) (*CheckpointDarcReply, error) {
+	latest, err := s.latest(req.Registry, req.BaseID)
+	if err != nil {
+		return nil, err
+	}
+	roster := s.skipchain.GetDB().GetByID(req.Registry).Roster
+	if !roster.List[0].Equal(s.ServerIdentity()) {
+		return nil, errors.New("only the leader of the registry signs checkpoints")
+	}
+	tree := roster.GenerateNaryTree(len(roster.List))
+	if tree == nil {
+		return nil, errors.New("failed to generate tree")
+	}
+	pi, err := s.CreateProtocol(checkpointProtocol, tree)
+	if err != nil {
+		return nil, err
+	}
+	exp := time.Now().Add(darc.CheckpointLifetime).Unix()
+	p := pi.(*protocol.FtCosi)
+	p.CreateProtocol = s.CreateProtocol
+	p.Msg = darc.CheckpointMessage(latest.GetID(), exp)
+	p.Data, err = protobuf.Encode(&checkpointData{Registry: req.Registry,
+		BaseID: req.BaseID, Expiration: exp})
+	if err != nil {
+		return nil, err
+	}
+	p.NSubtrees = int(math.Pow(float64(len(roster.List)), 1.0/3.0))
+	if p.NSubtrees < 1 {
+		p.NSubtrees = 1
+	}
+	p.Timeout = 5 * time.Second
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+
+	var sig []byte
+	select {
+	case sig = <-p.FinalSignature:
+	case <-time.After(p.Timeout + time.Second):
+		return nil, errors.New("protocol timed out")
+	}
+	if len(sig) == 0 {
+		return nil, errors.New("roster refused to sign the checkpoint")
+	}
+	d := latest.Copy()
+	d.SetCheckpoint(sig, exp)
+	return &CheckpointDarcReply{Darc: d}, nil
+}
+
+// verifyCheckpoint is called by every node of the roster before it signs a
+// checkpoint. It refuses to sign a version that is not its latest version
+// of the darc, or a checkpoint that expires too late.
+func (s *Service) verifyCheckpoint(msg, data []byte) bool {
+	cd := &checkpointData{}
+	if err := protobuf.Decode(data, cd); err != nil {
+		log.Lvl2("couldn't decode checkpoint:", err)
+		return false
+	}
+	if cd.Expiration > time.Now().Add(darc.CheckpointLifetime).Unix()+timestampRange {
+		log.Lvl2("checkpoint expires too late:", cd.Expiration)
+		return false
+	}
+	latest, err := s.latest(cd.Registry, cd.BaseID)
+	if err != nil {
+		log.Lvl2("refusing checkpoint:", err)
+		return false
+	}
+	if !bytes.Equal(msg, darc.CheckpointMessage(latest.GetID(), cd.Expiration)) {
+		log.Lvl2("checkpoint is not for the latest version")
+		return false
+	}
+	return true
+}
+
+// registerCheckpoint registers the protocols signing the checkpoints.
+func (s *Service) registerCheckpoint(c *onet.Context) error {
+	_, err := c.ProtocolRegister(checkpointProtocol, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		return protocol.NewFtCosi(n, s.verifyCheckpoint, checkpointSubProtocol, cothority.Suite)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.ProtocolRegister(checkpointSubProtocol, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		return protocol.NewSubFtCosi(n, s.verifyCheckpoint, cothority.Suite)
+	})
+	return err
+}
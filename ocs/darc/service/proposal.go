@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+func init() {
+	network.RegisterMessages(storage{}, pending{})
+}
+
+// storageKey identifies the on-disk storage of the pending proposals.
+var storageKey = []byte("proposals")
+
+// storage holds the proposals that are not satisfied yet. They are only
+// kept by the node that received them, which is the leader of the registry
+// for the Client.
+type storage struct {
+	Proposals map[string]*pending
+}
+
+// pending is a proposal for a darc of a registry.
+type pending struct {
+	Registry skipchain.SkipBlockID
+	Proposal *darc.Proposal
+}
+
+// WithdrawMessage returns the message an owner signs to withdraw the
+// proposal with the given ID.
+func WithdrawMessage(id darc.ID) []byte {
+	return append([]byte("withdraw:"), id...)
+}
+
+// ProposeDarc stores the proposal if it is the next version of a darc of the
+// registry, or finalizes it if its signatures already satisfy the latest
+// version.
+func (s *Service) ProposeDarc(req *ProposeDarc) (*ProposeDarcReply, error) {
+	p := req.Proposal
+	if p == nil || p.Darc == nil || p.Darc.Version == 0 {
+		return nil, errors.New("missing proposal for a new version")
+	}
+	s.store.Lock()
+	defer s.store.Unlock()
+	prev, err := s.latest(req.Registry, p.Darc.GetBaseID())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Verify(prev); err != nil {
+		return nil, err
+	}
+	id := p.ID()
+	if s.storage.Proposals[string(id)] != nil {
+		return nil, errors.New("proposal already exists")
+	}
+	block, err := s.finalize(req.Registry, prev, p)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		s.storage.Proposals[string(id)] = &pending{Registry: req.Registry, Proposal: p}
+		s.save()
+	}
+	return &ProposeDarcReply{ID: id, Block: block}, nil
+}
+
+// SignProposal adds the signature to the pending proposal, and finalizes it
+// once the signatures satisfy the latest version.
+func (s *Service) SignProposal(req *SignProposal) (*SignProposalReply, error) {
+	s.store.Lock()
+	defer s.store.Unlock()
+	pp, prev, err := s.getPending(req.Registry, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	p := &darc.Proposal{Darc: pp.Proposal.Darc,
+		Signatures: append([]*darc.Signature{}, pp.Proposal.Signatures...)}
+	if err := p.AddSignature(prev, req.Signature); err != nil {
+		return nil, err
+	}
+	block, err := s.finalize(req.Registry, prev, p)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		delete(s.storage.Proposals, string(req.ID))
+	} else {
+		pp.Proposal = p
+	}
+	s.save()
+	return &SignProposalReply{Proposal: p, Block: block}, nil
+}
+
+// GetProposals returns the pending proposals for the next version of the
+// darc. Proposals for an older version are removed.
+func (s *Service) GetProposals(req *GetProposals) (*GetProposalsReply, error) {
+	s.store.Lock()
+	defer s.store.Unlock()
+	prev, err := s.latest(req.Registry, req.BaseID)
+	if err != nil {
+		return nil, err
+	}
+	reply := &GetProposalsReply{}
+	for id, pp := range s.storage.Proposals {
+		if !pp.Registry.Equal(req.Registry) || !pp.Proposal.Darc.GetBaseID().Equal(req.BaseID) {
+			continue
+		}
+		if pp.Proposal.Darc.Version != prev.Version+1 {
+			delete(s.storage.Proposals, id)
+			continue
+		}
+		reply.Proposals = append(reply.Proposals, pp.Proposal)
+	}
+	s.save()
+	return reply, nil
+}
+
+// WithdrawProposal removes the pending proposal if the request is signed by
+// an owner of the latest version.
+func (s *Service) WithdrawProposal(req *WithdrawProposal) (*WithdrawProposalReply, error) {
+	s.store.Lock()
+	defer s.store.Unlock()
+	_, prev, err := s.getPending(req.Registry, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	sig := req.Signature
+	if sig == nil || sig.SignaturePath.Role != darc.Owner {
+		return nil, errors.New("withdrawal is not signed by an owner")
+	}
+	if err := sig.Verify(WithdrawMessage(req.ID), prev); err != nil {
+		return nil, err
+	}
+	if err := sig.SignaturePath.Verify(darc.Owner); err != nil {
+		return nil, err
+	}
+	delete(s.storage.Proposals, string(req.ID))
+	s.save()
+	log.Lvlf2("Withdrew proposal %x", req.ID)
+	return &WithdrawProposalReply{}, nil
+}
+
+// getPending returns the pending proposal with the given ID and the latest
+// version of its darc. An outdated proposal is removed. It has to be called
+// with store held.
+func (s *Service) getPending(registry skipchain.SkipBlockID, id darc.ID) (*pending, *darc.Darc, error) {
+	pp := s.storage.Proposals[string(id)]
+	if pp == nil || !pp.Registry.Equal(registry) {
+		return nil, nil, errors.New("unknown proposal")
+	}
+	prev, err := s.latest(registry, pp.Proposal.Darc.GetBaseID())
+	if err != nil {
+		return nil, nil, err
+	}
+	if pp.Proposal.Darc.Version != prev.Version+1 {
+		delete(s.storage.Proposals, string(id))
+		s.save()
+		return nil, nil, errors.New("proposal is outdated")
+	}
+	return pp, prev, nil
+}
+
+// finalize appends the darc of the proposal to the registry if its
+// signatures satisfy prev, and returns the new block. It returns a nil block
+// if the proposal is not satisfied yet. It has to be called with store
+// held.
+func (s *Service) finalize(registry skipchain.SkipBlockID, prev *darc.Darc,
+	p *darc.Proposal) (*skipchain.SkipBlock, error) {
+	if p.Satisfied(prev) != nil {
+		return nil, nil
+	}
+	d, err := p.Finalize(prev)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.append(registry, &Transaction{Darc: d, Signatures: p.Signatures})
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("Finalized proposal %x", p.ID())
+	return block, nil
+}
+
+// latest returns the latest version of the darc in the registry.
+func (s *Service) latest(registry skipchain.SkipBlockID, baseID darc.ID) (*darc.Darc, error) {
+	darcs, err := s.evolution(registry, baseID)
+	if err != nil {
+		return nil, err
+	}
+	return darcs[len(darcs)-1], nil
+}
+
+// save stores the pending proposals. It has to be called with store held.
+func (s *Service) save() {
+	if err := s.Save(storageKey, s.storage); err != nil {
+		log.Error(err)
+	}
+}
+
+// load reads the pending proposals from the disk.
+func (s *Service) load() error {
+	s.storage = &storage{Proposals: make(map[string]*pending)}
+	blob, err := s.Load(storageKey)
+	if err != nil || blob == nil {
+		return err
+	}
+	stored, ok := blob.(*storage)
+	if !ok {
+		return errors.New("couldn't unmarshal proposals")
+	}
+	if stored.Proposals != nil {
+		s.storage = stored
+	}
+	return nil
+}
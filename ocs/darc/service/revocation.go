@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// RevocationProof proves that an identity cannot sign for the latest
+// version of a darc of a registry, for example to show that revoking it
+// took effect. It holds the evolution of the darc, the inclusion proof of
+// the block holding the latest version, and the blocks following it, which
+// don't hold a newer version. As all blocks are linked by forward links
+// signed by the roster, the proof can be checked without contacting a
+// conode. It only covers the blocks up to the last one of Following, so the
+// client has to make sure it is recent enough.
+type RevocationProof struct {
+	Darcs     []*darc.Darc
+	Inclusion *skipchain.InclusionProof
+	// Following starts with the block holding the latest version, and every
+	// block holds the forward link to the next one.
+	Following []*skipchain.SkipBlock
+}
+
+// Latest returns the last block covered by the proof.
+func (rp *RevocationProof) Latest() *skipchain.SkipBlock {
+	if len(rp.Following) == 0 {
+		return nil
+	}
+	return rp.Following[len(rp.Following)-1]
+}
+
+// Verify checks that the proof holds the latest version of the darc with the
+// given base ID in the registry, and that this version excludes the
+// identity for the role at the given time, see darc.Darc.Excludes.
+func (rp *RevocationProof) Verify(registry skipchain.SkipBlockID, baseID darc.ID,
+	id *darc.Identity, role darc.Role, when time.Time) error {
+	if err := VerifyEvolution(baseID, rp.Darcs); err != nil {
+		return err
+	}
+	latest := rp.Darcs[len(rp.Darcs)-1]
+	if len(rp.Following) == 0 || rp.Following[0] == nil {
+		return errors.New("missing block of the latest version")
+	}
+	block := rp.Following[0]
+	if err := skipchain.VerifyInclusionProof(registry, block.Hash, rp.Inclusion); err != nil {
+		return err
+	}
+	if !block.CalculateHash().Equal(block.Hash) {
+		return errors.New("wrong hash of block " + strconv.Itoa(block.Index))
+	}
+	if tx := decode(block.Data); tx == nil || tx.Darc == nil ||
+		!tx.Darc.GetID().Equal(latest.GetID()) {
+		return errors.New("block doesn't hold the latest version")
+	}
+	for i, sb := range rp.Following[1:] {
+		prev := rp.Following[i]
+		if sb == nil || sb.SkipBlockFix == nil || len(prev.ForwardLink) == 0 {
+			return errors.New("missing block in revocation proof")
+		}
+		if sb.Index != prev.Index+1 {
+			return errors.New("revocation proof skips blocks")
+		}
+		if err := prev.ForwardLink[0].VerifyTransition(prev, sb); err != nil {
+			return err
+		}
+		if tx := decode(sb.Data); tx != nil && tx.Darc != nil &&
+			tx.Darc.GetBaseID().Equal(baseID) {
+			return errors.New("block " + strconv.Itoa(sb.Index) + " holds a newer version")
+		}
+	}
+	return latest.Excludes(id, role, when)
+}
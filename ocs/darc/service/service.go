@@ -0,0 +1,368 @@
+// Package service offers a registry of darcs: every registry is a skipchain
+// holding darcs and their evolutions, which are verified by all nodes of the
+// roster before they are stored. Other services can use it to look up the
+// latest version of a darc instead of keeping their own copies.
+//
+// Please see
+// https://github.com/dedis/cothority/blob/master/ocs/darc/service/README.md
+// for more information.
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// serviceID is the onet identifier.
+var serviceID onet.ServiceID
+
+// timestampRange is the maximal difference in seconds between the timestamp
+// of a new darc and the time of the nodes verifying it.
+const timestampRange = 60
+
+func init() {
+	serviceID, _ = onet.RegisterNewService(ServiceName, newService)
+}
+
+// Service holds the index of the registries known to this node. The darcs
+// themselves are stored in the skipchains.
+type Service struct {
+	*onet.ServiceProcessor
+
+	skipchain *skipchain.Service
+
+	// store makes sure that only one darc is appended at a time. It also
+	// protects the pending proposals.
+	store   sync.Mutex
+	storage *storage
+
+	mutex      sync.Mutex
+	registries map[string]*registry
+}
+
+// registry indexes the darcs of a registry skipchain up to the block last.
+type registry struct {
+	last  skipchain.SkipBlockID
+	darcs map[string][]*darc.Darc // darcs holds all versions per base ID.
+	// history holds all versions per base ID as they were stored.
+	history map[string][]*darc.StoredVersion
+	// blocks holds the block of the latest version per base ID.
+	blocks map[string]skipchain.SkipBlockID
+}
+
+// CreateRegistry creates a new skipchain to store darcs.
+func (s *Service) CreateRegistry(req *CreateRegistry) (*CreateRegistryReply, error) {
+	if req.Roster == nil || len(req.Roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	block := skipchain.NewSkipBlock()
+	block.Roster = req.Roster
+	block.BaseHeight = 4
+	block.MaximumHeight = 4
+	block.VerifierIDs = verifiers
+	block.Data = []byte{}
+	reply, err := s.skipchain.StoreSkipBlock(&skipchain.StoreSkipBlock{NewBlock: block})
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("Created darc registry %x", reply.Latest.Hash)
+	return &CreateRegistryReply{Registry: reply.Latest}, nil
+}
+
+// StoreDarc appends the darc to the registry if it is a new darc or the
+// next version of a darc of the registry.
+func (s *Service) StoreDarc(req *StoreDarc) (*StoreDarcReply, error) {
+	if req.Darc == nil {
+		return nil, errors.New("missing darc")
+	}
+	s.store.Lock()
+	defer s.store.Unlock()
+	block, err := s.append(req.Registry, &Transaction{Darc: req.Darc,
+		Signatures: req.Signatures})
+	if err != nil {
+		return nil, err
+	}
+	return &StoreDarcReply{Block: block}, nil
+}
+
+// append checks the transaction and appends it to the registry. It has to be
+// called with store held.
+func (s *Service) append(id skipchain.SkipBlockID, tx *Transaction) (*skipchain.SkipBlock, error) {
+	if err := s.check(id, tx.Darc, tx.Signatures); err != nil {
+		return nil, err
+	}
+
+	db := s.skipchain.GetDB()
+	latest, err := db.GetLatest(db.GetByID(id))
+	if err != nil {
+		return nil, errors.New("couldn't find latest block: " + err.Error())
+	}
+	tx.Timestamp = time.Now().Unix()
+	data, err := protobuf.Encode(tx)
+	if err != nil {
+		return nil, err
+	}
+	block := latest.Copy()
+	block.Data = data
+	block.GenesisID = block.SkipChainID()
+	block.Index++
+	reply, err := s.skipchain.StoreSkipBlock(&skipchain.StoreSkipBlock{
+		NewBlock:          block,
+		TargetSkipChainID: latest.SkipChainID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("Stored darc %x version %d", tx.Darc.GetBaseID(), tx.Darc.Version)
+	return reply.Latest, nil
+}
+
+// GetLatestDarc returns the latest version of a darc.
+func (s *Service) GetLatestDarc(req *GetLatestDarc) (*GetLatestDarcReply, error) {
+	darcs, err := s.evolution(req.Registry, req.BaseID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetLatestDarcReply{Darc: darcs[len(darcs)-1]}, nil
+}
+
+// GetEvolution returns all versions of a darc.
+func (s *Service) GetEvolution(req *GetEvolution) (*GetEvolutionReply, error) {
+	darcs, err := s.evolution(req.Registry, req.BaseID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetEvolutionReply{Darcs: darcs}, nil
+}
+
+// GetHistory returns all versions of a darc as they were stored.
+func (s *Service) GetHistory(req *GetHistory) (*GetHistoryReply, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, err := s.update(req.Registry)
+	if err != nil {
+		return nil, err
+	}
+	versions := r.history[string(req.BaseID)]
+	if len(versions) == 0 {
+		return nil, errors.New("unknown darc")
+	}
+	return &GetHistoryReply{Versions: append([]*darc.StoredVersion{}, versions...)}, nil
+}
+
+// GetRevocationProof returns the proof that the latest version of a darc is
+// the latest one in the registry.
+func (s *Service) GetRevocationProof(req *GetRevocationProof) (*GetRevocationProofReply, error) {
+	s.mutex.Lock()
+	r, err := s.update(req.Registry)
+	if err != nil {
+		s.mutex.Unlock()
+		return nil, err
+	}
+	darcs := append([]*darc.Darc{}, r.darcs[string(req.BaseID)]...)
+	id := r.blocks[string(req.BaseID)]
+	s.mutex.Unlock()
+	if len(darcs) == 0 {
+		return nil, errors.New("unknown darc")
+	}
+
+	inclusion, err := s.skipchain.GetInclusionProof(&skipchain.GetInclusionProof{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	proof := &RevocationProof{Darcs: darcs, Inclusion: inclusion.Proof}
+	db := s.skipchain.GetDB()
+	for block := db.GetByID(id); block != nil; {
+		following := &skipchain.SkipBlock{
+			SkipBlockFix: block.SkipBlockFix,
+			Hash:         block.Hash,
+		}
+		proof.Following = append(proof.Following, following)
+		if len(block.ForwardLink) == 0 {
+			break
+		}
+		following.ForwardLink = block.ForwardLink[:1]
+		block = db.GetByID(block.ForwardLink[0].To)
+	}
+	return &GetRevocationProofReply{Proof: proof}, nil
+}
+
+// evolution returns a copy of all versions of a darc.
+func (s *Service) evolution(id skipchain.SkipBlockID, baseID darc.ID) ([]*darc.Darc, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, err := s.update(id)
+	if err != nil {
+		return nil, err
+	}
+	darcs := r.darcs[string(baseID)]
+	if len(darcs) == 0 {
+		return nil, errors.New("unknown darc")
+	}
+	return append([]*darc.Darc{}, darcs...), nil
+}
+
+// check returns an error if the darc cannot be appended to the registry. If
+// the latest version has a quorum for darc.EvolveQuorum, the signatures of
+// the owners have to reach it.
+func (s *Service) check(id skipchain.SkipBlockID, d *darc.Darc, sigs []*darc.Signature) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, err := s.update(id)
+	if err != nil {
+		return err
+	}
+	darcs := r.darcs[string(d.GetBaseID())]
+	if d.Version != len(darcs) {
+		return errors.New("darc is not the next version")
+	}
+	if d.Version == 0 {
+		return nil
+	}
+	prev := darcs[len(darcs)-1]
+	if err := verifyEvolution(prev, d); err != nil {
+		return err
+	}
+	if prev.GetQuorum(darc.EvolveQuorum) == nil {
+		return nil
+	}
+	return (&darc.Proposal{Darc: d, Signatures: sigs}).Satisfied(prev)
+}
+
+// update returns the index of the registry. The first time, the index is
+// created from the blocks of the registry, afterwards it is kept up to date
+// by appended. It has to be called with the mutex held.
+func (s *Service) update(id skipchain.SkipBlockID) (*registry, error) {
+	db := s.skipchain.GetDB()
+	r := s.registries[string(id)]
+	if r != nil {
+		return r, nil
+	}
+	genesis := db.GetByID(id)
+	if genesis == nil || genesis.Index != 0 || !isRegistry(genesis) {
+		return nil, errors.New("unknown registry")
+	}
+	r = &registry{last: genesis.Hash, darcs: make(map[string][]*darc.Darc),
+		history: make(map[string][]*darc.StoredVersion),
+		blocks:  make(map[string]skipchain.SkipBlockID)}
+	r.follow(db)
+	s.registries[string(id)] = r
+	return r, nil
+}
+
+// appended is called by the skipchain service with every new block, and
+// adds the blocks of the known registries to their index.
+func (s *Service) appended(sb *skipchain.SkipBlock) {
+	if !isRegistry(sb) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if r := s.registries[string(sb.SkipChainID())]; r != nil {
+		r.follow(s.skipchain.GetDB())
+	}
+}
+
+// follow adds the blocks following the last indexed block to the index.
+func (r *registry) follow(db *skipchain.SkipBlockDB) {
+	block := db.GetByID(r.last)
+	for block != nil && len(block.ForwardLink) > 0 {
+		block = db.GetByID(block.ForwardLink[0].To)
+		if block == nil {
+			break
+		}
+		if tx := decode(block.Data); tx != nil && tx.Darc != nil {
+			key := string(tx.Darc.GetBaseID())
+			r.darcs[key] = append(r.darcs[key], tx.Darc)
+			r.history[key] = append(r.history[key], &darc.StoredVersion{
+				Darc:       tx.Darc,
+				Timestamp:  tx.Timestamp,
+				Signatures: tx.Signatures,
+			})
+			r.blocks[key] = block.Hash
+		}
+		r.last = block.Hash
+	}
+}
+
+// verify is the skipchain verification of the blocks of a registry.
+func (s *Service) verify(newID []byte, sb *skipchain.SkipBlock) bool {
+	if sb.Index == 0 {
+		return true
+	}
+	tx := decode(sb.Data)
+	if tx == nil || tx.Darc == nil {
+		log.Lvl2("block without darc")
+		return false
+	}
+	diff := time.Now().Unix() - tx.Timestamp
+	if diff > timestampRange || diff < -timestampRange {
+		log.Lvl2("timestamp of the darc is too far from now:", tx.Timestamp)
+		return false
+	}
+	if err := s.check(sb.SkipChainID(), tx.Darc, tx.Signatures); err != nil {
+		log.Lvl2("refusing darc:", err)
+		return false
+	}
+	return true
+}
+
+// isRegistry returns true if the skipchain of the block verifies darcs.
+func isRegistry(sb *skipchain.SkipBlock) bool {
+	for _, v := range sb.VerifierIDs {
+		if v == VerifyDarc {
+			return true
+		}
+	}
+	return false
+}
+
+// decode returns the transaction of a block, or nil.
+func decode(data []byte) *Transaction {
+	tx := &Transaction{}
+	err := protobuf.DecodeWithConstructors(data, tx, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil
+	}
+	return tx
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		skipchain:        c.Service(skipchain.ServiceName).(*skipchain.Service),
+		registries:       make(map[string]*registry),
+	}
+	if err := s.RegisterHandlers(s.CreateRegistry, s.StoreDarc,
+		s.GetLatestDarc, s.GetEvolution, s.GetHistory, s.GetRevocationProof,
+		s.ProposeDarc, s.SignProposal, s.GetProposals, s.WithdrawProposal,
+		s.CheckpointDarc); err != nil {
+		return nil, err
+	}
+	if err := s.registerCheckpoint(c); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	skipchain.RegisterVerification(c, VerifyDarc, s.verify)
+	skipchain.RegisterBlockHandler(c, s.appended)
+	skipchain.RegisterPredicate(c, PredicateDarc, func(sb *skipchain.SkipBlock) bool {
+		tx := decode(sb.Data)
+		return tx != nil && tx.Darc != nil
+	})
+	return s, nil
+}
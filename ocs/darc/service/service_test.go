@@ -0,0 +1,238 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/darc"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestService_Registry(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+	c := NewClient()
+
+	_, err := c.CreateRegistry(nil)
+	require.NotNil(t, err)
+	registry, err := c.CreateRegistry(roster)
+	require.Nil(t, err)
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	d0 := darc.NewDarc(&[]*darc.Identity{owner.Identity()}, nil, []byte("registry"))
+	_, err = c.StoreDarc(registry, d0)
+	require.Nil(t, err)
+	_, err = c.StoreDarc(registry, d0)
+	require.NotNil(t, err)
+
+	// Only an owner of the latest version can evolve the darc.
+	other := darc.NewSignerEd25519(nil, nil)
+	d1 := d0.Copy()
+	d1.AddUser(other.Identity())
+	require.Nil(t, d1.SetEvolution(d0, nil, other))
+	_, err = c.StoreDarc(registry, d1)
+	require.NotNil(t, err)
+	require.Nil(t, d1.SetEvolution(d0, nil, owner))
+	_, err = c.StoreDarc(registry, d1)
+	require.Nil(t, err)
+
+	// A version has to follow the latest one.
+	d2 := d1.Copy()
+	require.Nil(t, d2.SetEvolution(d0, nil, owner))
+	_, err = c.StoreDarc(registry, d2)
+	require.NotNil(t, err)
+
+	baseID := d0.GetID()
+	darcs, err := c.GetEvolution(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(darcs))
+	latest, err := c.GetLatestDarc(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, d1.GetID(), latest.GetID())
+	_, err = c.GetLatestDarc(registry, d1.GetID())
+	require.NotNil(t, err)
+
+	events, err := c.GetHistory(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, []string{owner.Identity().String()}, events[1].Signers)
+	require.Equal(t, []string{"+user: " + other.Identity().String()}, events[1].Changes)
+	require.InDelta(t, time.Now().Unix(), events[1].Timestamp, 60)
+	_, err = c.GetHistory(registry, d1.GetID())
+	require.NotNil(t, err)
+
+	require.NotNil(t, VerifyEvolution(d1.GetID(), darcs))
+	require.NotNil(t, VerifyEvolution(baseID, darcs[1:]))
+	require.NotNil(t, VerifyEvolution(baseID, []*darc.Darc{d0, d1.Copy()}))
+}
+
+func TestService_RevocationProof(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+	c := NewClient()
+	registry, err := c.CreateRegistry(roster)
+	require.Nil(t, err)
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	user := darc.NewSignerEd25519(nil, nil)
+	d0 := darc.NewDarc(&[]*darc.Identity{owner.Identity()},
+		&[]*darc.Identity{user.Identity()}, []byte("revocation"))
+	_, err = c.StoreDarc(registry, d0)
+	require.Nil(t, err)
+	baseID := d0.GetID()
+	_, err = c.GetRevocationProof(registry, baseID, user.Identity(), darc.User)
+	require.NotNil(t, err)
+
+	d1 := d0.Copy()
+	_, err = d1.RemoveUser(user.Identity())
+	require.Nil(t, err)
+	require.Nil(t, d1.SetEvolution(d0, nil, owner))
+	_, err = c.StoreDarc(registry, d1)
+	require.Nil(t, err)
+	// Another darc follows the latest version.
+	_, err = c.StoreDarc(registry, darc.NewDarc(nil, nil, []byte("other")))
+	require.Nil(t, err)
+
+	proof, err := c.GetRevocationProof(registry, baseID, user.Identity(), darc.User)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(proof.Following))
+	require.Equal(t, 3, proof.Latest().Index)
+	now := time.Now()
+	id := registry.SkipChainID()
+	require.NotNil(t, proof.Verify(id, baseID, owner.Identity(), darc.Owner, now))
+
+	// An outdated version or a truncated chain is refused.
+	outdated := *proof
+	outdated.Darcs = proof.Darcs[:1]
+	require.NotNil(t, outdated.Verify(id, baseID, user.Identity(), darc.User, now))
+	truncated := *proof
+	truncated.Following = proof.Following[1:]
+	require.NotNil(t, truncated.Verify(id, baseID, user.Identity(), darc.User, now))
+}
+
+func TestService_Proposals(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+	c := NewClient()
+	registry, err := c.CreateRegistry(roster)
+	require.Nil(t, err)
+
+	chair := darc.NewSignerEd25519(nil, nil)
+	member1 := darc.NewSignerEd25519(nil, nil)
+	member2 := darc.NewSignerEd25519(nil, nil)
+	d0 := darc.NewDarc(&[]*darc.Identity{chair.Identity(), member1.Identity(),
+		member2.Identity()}, nil, []byte("board"))
+	d0.SetQuorum(darc.EvolveQuorum, 3, []*darc.Weight{{chair.Identity(), 2},
+		{member1.Identity(), 1}, {member2.Identity(), 1}})
+	_, err = c.StoreDarc(registry, d0)
+	require.Nil(t, err)
+	baseID := d0.GetID()
+
+	// One owner alone cannot evolve the darc anymore.
+	d1 := d0.Copy()
+	d1.AddUser(darc.NewSignerEd25519(nil, nil).Identity())
+	require.Nil(t, d1.SetEvolution(d0, nil, chair))
+	_, err = c.StoreDarc(registry, d1)
+	require.NotNil(t, err)
+
+	p := darc.NewProposal(d0, d1)
+	block, err := c.ProposeDarc(registry, p)
+	require.Nil(t, err)
+	require.Nil(t, block)
+	proposals, err := c.GetProposals(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(proposals))
+
+	block, err = c.SignProposal(registry, d0, p.ID(), member1)
+	require.Nil(t, err)
+	require.Nil(t, block)
+	_, err = c.SignProposal(registry, d0, p.ID(), member1)
+	require.NotNil(t, err)
+	block, err = c.SignProposal(registry, d0, p.ID(), chair)
+	require.Nil(t, err)
+	require.NotNil(t, block)
+	latest, err := c.GetLatestDarc(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, p.ID(), latest.GetID())
+	proposals, err = c.GetProposals(registry, baseID)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(proposals))
+
+	// A pending proposal can be withdrawn by an owner.
+	p = darc.NewProposal(latest, darc.NewDarc(&[]*darc.Identity{chair.Identity()},
+		nil, []byte("coup")))
+	_, err = c.ProposeDarc(registry, p)
+	require.Nil(t, err)
+	outsider := darc.NewSignerEd25519(nil, nil)
+	require.NotNil(t, c.WithdrawProposal(registry, latest, p.ID(), outsider))
+	require.Nil(t, c.WithdrawProposal(registry, latest, p.ID(), member2))
+	_, err = c.SignProposal(registry, latest, p.ID(), chair)
+	require.NotNil(t, err)
+}
+
+func TestService_Checkpoint(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, true)
+	c := NewClient()
+	registry, err := c.CreateRegistry(roster)
+	require.Nil(t, err)
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	user := darc.NewSignerEd25519(nil, nil)
+	sub0 := darc.NewDarc(&[]*darc.Identity{owner.Identity()},
+		&[]*darc.Identity{user.Identity()}, []byte("sub"))
+	_, err = c.StoreDarc(registry, sub0)
+	require.Nil(t, err)
+	subID := sub0.GetID()
+	base := darc.NewDarc(nil, &[]*darc.Identity{darc.NewIdentityDarc(subID)}, []byte("base"))
+	_, err = c.CheckpointDarc(registry, base.GetID())
+	require.NotNil(t, err)
+
+	sub1 := sub0.Copy()
+	sub1.AddUser(darc.NewSignerEd25519(nil, nil).Identity())
+	require.Nil(t, sub1.SetEvolution(sub0, nil, owner))
+	_, err = c.StoreDarc(registry, sub1)
+	require.Nil(t, err)
+
+	cp1, err := c.CheckpointDarc(registry, subID)
+	require.Nil(t, err)
+	require.Equal(t, sub1.GetID(), cp1.GetID())
+	sp := darc.NewSignaturePath([]*darc.Darc{base, cp1}, *user.Identity(), darc.User)
+	require.Nil(t, sp.VerifyCheckpoints(darc.User, time.Now(), roster.Publics()))
+
+	// The nodes only sign the checkpoint of the latest version.
+	sub2 := sub1.Copy()
+	_, err = sub2.RemoveUser(user.Identity())
+	require.Nil(t, err)
+	require.Nil(t, sub2.SetEvolution(sub1, nil, owner))
+	_, err = c.StoreDarc(registry, sub2)
+	require.Nil(t, err)
+	s := local.GetServices(servers, serviceID)[1].(*Service)
+	exp := time.Now().Add(darc.CheckpointLifetime).Unix()
+	data, err := protobuf.Encode(&checkpointData{Registry: registry.SkipChainID(),
+		BaseID: subID, Expiration: exp})
+	require.Nil(t, err)
+	require.False(t, s.verifyCheckpoint(darc.CheckpointMessage(sub1.GetID(), exp), data))
+	require.True(t, s.verifyCheckpoint(darc.CheckpointMessage(sub2.GetID(), exp), data))
+
+	// The checkpoint of the older version expires.
+	require.NotNil(t, sp.VerifyCheckpoints(darc.User,
+		time.Now().Add(2*darc.CheckpointLifetime), roster.Publics()))
+	cp2, err := c.CheckpointDarc(registry, subID)
+	require.Nil(t, err)
+	sp = darc.NewSignaturePath([]*darc.Darc{base, cp2}, *user.Identity(), darc.User)
+	require.NotNil(t, sp.VerifyCheckpoints(darc.User, time.Now(), roster.Publics()))
+}
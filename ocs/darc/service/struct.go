@@ -0,0 +1,193 @@
+package service
+
+import (
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"gopkg.in/satori/go.uuid.v1"
+
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// ServiceName is the name to refer to the darc service.
+const ServiceName = "Darc"
+
+// VerifyDarc makes sure that a block of a registry holds a valid darc
+// following the latest version stored in the registry.
+var VerifyDarc = skipchain.VerifierID(uuid.NewV5(uuid.NamespaceURL, "Darc"))
+
+// PredicateDarc selects the blocks of a registry holding a darc, see
+// skipchain.Client.GetBlocksWithPredicate.
+const PredicateDarc = "darc"
+
+// verifiers are used for all the blocks of a registry.
+var verifiers = []skipchain.VerifierID{skipchain.VerifyBase, VerifyDarc}
+
+func init() {
+	network.RegisterMessages(
+		CreateRegistry{}, CreateRegistryReply{},
+		StoreDarc{}, StoreDarcReply{},
+		GetLatestDarc{}, GetLatestDarcReply{},
+		GetEvolution{}, GetEvolutionReply{},
+		GetHistory{}, GetHistoryReply{},
+		GetRevocationProof{}, GetRevocationProofReply{},
+		ProposeDarc{}, ProposeDarcReply{},
+		SignProposal{}, SignProposalReply{},
+		GetProposals{}, GetProposalsReply{},
+		WithdrawProposal{}, WithdrawProposalReply{},
+		CheckpointDarc{}, CheckpointDarcReply{},
+		Transaction{},
+	)
+}
+
+// Transaction is stored in every block of a registry but the genesis block.
+type Transaction struct {
+	Darc *darc.Darc
+	// Signatures of the owners of the previous version, if it has a quorum
+	// for darc.EvolveQuorum.
+	Signatures []*darc.Signature
+	// Timestamp is the unix time at which the darc was stored. The nodes
+	// refuse timestamps that are too far from their time.
+	Timestamp int64
+}
+
+// CreateRegistry asks for a new skipchain to store darcs.
+type CreateRegistry struct {
+	Roster *onet.Roster
+}
+
+// CreateRegistryReply returns the genesis block of the new registry.
+type CreateRegistryReply struct {
+	Registry *skipchain.SkipBlock
+}
+
+// StoreDarc adds a new darc, with version 0, or a new version of a darc to
+// the registry. A new version has to be signed by an owner of the latest
+// version, and its signature path has to hold the latest version.
+type StoreDarc struct {
+	Registry skipchain.SkipBlockID
+	Darc     *darc.Darc
+	// Signatures reaching the quorum for darc.EvolveQuorum of the latest
+	// version, if it has one.
+	Signatures []*darc.Signature
+}
+
+// StoreDarcReply returns the block holding the darc.
+type StoreDarcReply struct {
+	Block *skipchain.SkipBlock
+}
+
+// GetLatestDarc asks for the latest version of a darc.
+type GetLatestDarc struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// GetLatestDarcReply returns the latest version of the darc.
+type GetLatestDarcReply struct {
+	Darc *darc.Darc
+}
+
+// GetEvolution asks for all the versions of a darc.
+type GetEvolution struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// GetEvolutionReply returns all versions of the darc, starting at version
+// 0. They prove the evolution to the latest version, see VerifyEvolution.
+type GetEvolutionReply struct {
+	Darcs []*darc.Darc
+}
+
+// GetHistory asks for all the versions of a darc, with the time they were
+// stored at and the signatures stored with them.
+type GetHistory struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// GetHistoryReply returns all versions of the darc, starting at version 0.
+type GetHistoryReply struct {
+	Versions []*darc.StoredVersion
+}
+
+// GetRevocationProof asks for the proof that the latest version of a darc is
+// the latest one in the registry.
+type GetRevocationProof struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// GetRevocationProofReply returns the proof, see RevocationProof.Verify.
+type GetRevocationProofReply struct {
+	Proof *RevocationProof
+}
+
+// ProposeDarc stores a proposal for the next version of a darc of the
+// registry, so that its owners can sign it over time. If the proposal is
+// already satisfied, it is stored in the registry right away.
+type ProposeDarc struct {
+	Registry skipchain.SkipBlockID
+	Proposal *darc.Proposal
+}
+
+// ProposeDarcReply returns the ID of the proposal, and the block holding the
+// darc if the proposal has been finalized.
+type ProposeDarcReply struct {
+	ID    darc.ID
+	Block *skipchain.SkipBlock
+}
+
+// SignProposal adds the signature of an owner of the latest version to a
+// pending proposal. Once the signatures satisfy the latest version, the
+// proposal is finalized and the darc stored in the registry.
+type SignProposal struct {
+	Registry  skipchain.SkipBlockID
+	ID        darc.ID
+	Signature *darc.Signature
+}
+
+// SignProposalReply returns the proposal with the new signature, and the
+// block holding the darc if the proposal has been finalized.
+type SignProposalReply struct {
+	Proposal *darc.Proposal
+	Block    *skipchain.SkipBlock
+}
+
+// GetProposals asks for the pending proposals for the next version of a
+// darc.
+type GetProposals struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// GetProposalsReply returns the pending proposals.
+type GetProposalsReply struct {
+	Proposals []*darc.Proposal
+}
+
+// WithdrawProposal removes a pending proposal. It has to be signed by an
+// owner of the latest version on WithdrawMessage.
+type WithdrawProposal struct {
+	Registry  skipchain.SkipBlockID
+	ID        darc.ID
+	Signature *darc.Signature
+}
+
+// WithdrawProposalReply is returned once the proposal is removed.
+type WithdrawProposalReply struct{}
+
+// CheckpointDarc asks the roster of the registry to co-sign the latest
+// version of a darc, so that it can be verified without its previous
+// versions.
+type CheckpointDarc struct {
+	Registry skipchain.SkipBlockID
+	BaseID   darc.ID
+}
+
+// CheckpointDarcReply returns the latest version of the darc with the
+// checkpoint instead of its evolution signature.
+type CheckpointDarcReply struct {
+	Darc *darc.Darc
+}
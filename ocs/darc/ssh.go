@@ -0,0 +1,170 @@
+package darc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+
+	"github.com/dedis/cothority"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// This file lets developers use their OpenSSH ed25519 keys with darcs. An
+// 'ssh-ed25519' public key is the same point as the one of an Ed25519
+// identity, so it is imported as such, and Ed25519 identities accept, next
+// to their Schnorr signatures, SSH signatures as created by
+// 'ssh-keygen -Y sign -n darc' on the message to sign. In a policy, the
+// public key can be given as in the .pub file, without its comment.
+
+// SSHNamespace is the namespace of the SSH signatures accepted by Ed25519
+// identities, so that signatures for other applications can't be used.
+const SSHNamespace = "darc"
+
+// sshSigMagic starts the SSH signature blob and the data it signs.
+const sshSigMagic = "SSHSIG"
+
+// sshSigPEM is the type of the armored SSH signatures.
+const sshSigPEM = "SSH SIGNATURE"
+
+// sshSignature is the blob of an SSH signature, as defined in PROTOCOL.sshsig
+// of OpenSSH, without the magic preamble.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is what the key of an SSH signature signs.
+type sshSignedData struct {
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// NewIdentitySSH returns an Ed25519 identity for the public key given in the
+// format of the authorized_keys and .pub files of OpenSSH, like
+// 'ssh-ed25519 AAAA... user@host'. Only ed25519 keys are supported.
+func NewIdentitySSH(authorizedKey string) (*Identity, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, err
+	}
+	if key.Type() != ssh.KeyAlgoED25519 {
+		return nil, errors.New("only ssh-ed25519 keys are supported")
+	}
+	cpk, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.New("couldn't get the ed25519 key")
+	}
+	public, ok := cpk.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("couldn't get the ed25519 key")
+	}
+	point := cothority.Suite.Point()
+	if err := point.UnmarshalBinary(public); err != nil {
+		return nil, err
+	}
+	return NewIdentityEd25519(point), nil
+}
+
+// NewSignerSSH returns a signer creating SSH signatures with an ed25519
+// key, like the ones of the ssh-agent.
+func NewSignerSSH(signer ssh.Signer) (*Signer, error) {
+	id, err := NewIdentitySSH(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if err != nil {
+		return nil, err
+	}
+	return NewSignerExternal(id, func(msg []byte) ([]byte, error) {
+		hash := sha512.Sum512(msg)
+		signed := append([]byte(sshSigMagic), ssh.Marshal(&sshSignedData{
+			Namespace:     SSHNamespace,
+			HashAlgorithm: "sha512",
+			Hash:          hash[:],
+		})...)
+		sig, err := signer.Sign(rand.Reader, signed)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(sshSigMagic), ssh.Marshal(&sshSignature{
+			Version:       1,
+			PublicKey:     signer.PublicKey().Marshal(),
+			Namespace:     SSHNamespace,
+			HashAlgorithm: "sha512",
+			Signature:     ssh.Marshal(sig),
+		})...), nil
+	}), nil
+}
+
+// isSSHSignature returns true if sig is an SSH signature, raw or armored.
+func isSSHSignature(sig []byte) bool {
+	return bytes.HasPrefix(sig, []byte(sshSigMagic)) ||
+		bytes.HasPrefix(sig, []byte("-----BEGIN "+sshSigPEM))
+}
+
+// verifySSH returns nil if sig is an SSH signature on msg by the ed25519 key
+// of the identity, in the SSHNamespace.
+func (ide *IdentityEd25519) verifySSH(msg, sig []byte) error {
+	if block, _ := pem.Decode(sig); block != nil {
+		if block.Type != sshSigPEM {
+			return errors.New("not an ssh signature")
+		}
+		sig = block.Bytes
+	}
+	if !bytes.HasPrefix(sig, []byte(sshSigMagic)) {
+		return errors.New("not an ssh signature")
+	}
+	s := &sshSignature{}
+	if err := ssh.Unmarshal(sig[len(sshSigMagic):], s); err != nil {
+		return errors.New("invalid ssh signature: " + err.Error())
+	}
+	if s.Version != 1 {
+		return errors.New("unsupported ssh signature version")
+	}
+	if s.Namespace != SSHNamespace {
+		return errors.New("ssh signature for namespace '" + s.Namespace + "'")
+	}
+	point, err := ide.Point.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	key, err := ssh.NewPublicKey(ed25519.PublicKey(point))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(s.PublicKey, key.Marshal()) {
+		return errors.New("ssh signature from another key")
+	}
+	var hash []byte
+	switch s.HashAlgorithm {
+	case "sha256":
+		h := sha256.Sum256(msg)
+		hash = h[:]
+	case "sha512":
+		h := sha512.Sum512(msg)
+		hash = h[:]
+	default:
+		return errors.New("unsupported ssh signature hash")
+	}
+	inner := &ssh.Signature{}
+	if err := ssh.Unmarshal(s.Signature, inner); err != nil {
+		return errors.New("invalid ssh signature: " + err.Error())
+	}
+	if inner.Format != ssh.KeyAlgoED25519 {
+		return errors.New("ssh signature is not ed25519")
+	}
+	signed := append([]byte(sshSigMagic), ssh.Marshal(&sshSignedData{
+		Namespace:     s.Namespace,
+		Reserved:      s.Reserved,
+		HashAlgorithm: s.HashAlgorithm,
+		Hash:          hash,
+	})...)
+	return key.Verify(signed, inner)
+}
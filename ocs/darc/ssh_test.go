@@ -0,0 +1,65 @@
+package darc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestIdentitySSH(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	sshSigner, err := ssh.NewSignerFromKey(private)
+	require.Nil(t, err)
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshSigner.PublicKey())))
+
+	id, err := NewIdentitySSH(authorized + " dev@laptop")
+	require.Nil(t, err)
+	require.Equal(t, 1, id.Type())
+	parsed, err := ParseIdentity(authorized)
+	require.Nil(t, err)
+	require.True(t, parsed.Equal(id))
+	d, err := ParsePolicy("allow evolve: " + authorized + "[0,0]\nallow sign: " + authorized)
+	require.Nil(t, err)
+	require.True(t, (*d.Users)[0].Equal(id))
+
+	// SSH signatures are accepted by the Ed25519 identity, like the Schnorr
+	// signatures.
+	msg := []byte("document")
+	signer, err := NewSignerSSH(sshSigner)
+	require.Nil(t, err)
+	require.True(t, signer.Identity().Equal(id))
+	ds, err := NewDarcSignature(msg, NewSignaturePath([]*Darc{d}, *id, User), signer)
+	require.Nil(t, err)
+	require.Nil(t, ds.Verify(msg, d))
+	require.NotNil(t, ds.Verify([]byte("other"), d))
+
+	sig, err := signer.External.SignFunc(msg)
+	require.Nil(t, err)
+	require.Nil(t, id.Verify(msg, sig))
+	armored := pem.EncodeToMemory(&pem.Block{Type: sshSigPEM, Bytes: sig})
+	require.Nil(t, id.Verify(msg, armored))
+	other, _ := createSignerIdentity()
+	require.NotNil(t, other.Identity().Verify(msg, sig))
+
+	// Signatures for other namespaces are refused.
+	s := &sshSignature{}
+	require.Nil(t, ssh.Unmarshal(sig[len(sshSigMagic):], s))
+	s.Namespace = "file"
+	require.NotNil(t, id.Verify(msg, append([]byte(sshSigMagic), ssh.Marshal(s)...)))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.Nil(t, err)
+	rsaPublic, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	require.Nil(t, err)
+	_, err = NewIdentitySSH(string(ssh.MarshalAuthorizedKey(rsaPublic)))
+	require.NotNil(t, err)
+	_, err = ParseIdentity("ssh-ed25519 AAAA")
+	require.NotNil(t, err)
+}
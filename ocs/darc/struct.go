@@ -7,7 +7,8 @@ import (
 
 func init() {
 	network.RegisterMessages(
-		Darc{}, Identity{}, Signature{},
+		Darc{}, Identity{}, Signature{}, SignatureTable{}, Limit{},
+		Quorum{}, Weight{}, Metadata{}, MetadataEntry{},
 	)
 }
 
@@ -53,6 +54,81 @@ type Darc struct {
 	// Signature is calculated over the protobuf representation of [Owner, Users, Version, Description]
 	// and needs to be created by an Owner from the previous valid Darc.
 	Signature *Signature
+	// Checkpoint can replace the Signature, so that the previous Darcs are
+	// not needed anymore for verification.
+	Checkpoint *Checkpoint
+	// Resources are the IDs of the documents or skipchains governed by this
+	// Darc. If empty, the Darc is not bound to any resource.
+	Resources [][]byte
+	// Limits restrict how often the users can do an action of a service
+	// under this Darc.
+	Limits []*Limit
+	// Quorums require the signers of an action to carry enough weight
+	// together.
+	Quorums []*Quorum
+	// Metadata describes the darc to the tools listing darcs. It is part of
+	// the ID, like the description.
+	Metadata *Metadata
+}
+
+// Limit restricts how often a signer can do an action, which is a name
+// chosen by the service checking the requests.
+type Limit struct {
+	// Action is the name of the limited action
+	Action string
+	// MaxPerHour is the number of requests a signer can do in an hour
+	MaxPerHour int
+}
+
+// Quorum requires the weights of the signers of an action to add up to at
+// least the threshold.
+type Quorum struct {
+	// Action is the name of the action needing the quorum
+	Action string
+	// Threshold is the minimal sum of the weights of the signers
+	Threshold int
+	// Weights are the identities that can sign for the action and their
+	// weights
+	Weights []*Weight
+}
+
+// Weight is the voting power of an identity in a Quorum.
+type Weight struct {
+	Identity *Identity
+	Weight   int
+}
+
+// Metadata tells what a darc is for, so that tools can show meaningful
+// lists of darcs. All fields are optional.
+type Metadata struct {
+	// Name is a short human readable name of the darc
+	Name string
+	// Purpose explains what the darc protects
+	Purpose string
+	// Contact is whom to ask about the darc, like an e-mail address
+	Contact string
+	// Tags are labels to group darcs, sorted and without duplicates
+	Tags []string
+	// Application holds the values of the applications using the darc,
+	// sorted by key. It is a list instead of a map, so that the encoding,
+	// and so the ID, doesn't depend on the order of the map.
+	Application []*MetadataEntry
+}
+
+// MetadataEntry is a value of an application in Metadata.
+type MetadataEntry struct {
+	Key   string
+	Value string
+}
+
+// Checkpoint is a collective signature of a roster on the ID of a Darc. It
+// attests that the Darc is the latest version of its base Darc until the
+// expiration.
+type Checkpoint struct {
+	// Signature is the collective signature on CheckpointMessage
+	Signature []byte
+	// Expiration is the unix time after which the checkpoint is not valid
+	Expiration int64
 }
 
 // Identity is a generic structure can be either an Ed25519 public key or a Darc
@@ -63,6 +139,32 @@ type Identity struct {
 	Ed25519 *IdentityEd25519
 	// Public-key identity
 	X509EC *IdentityX509EC
+	// Validity optionally restricts the time window in which this identity
+	// is accepted when verifying a signature path.
+	Validity *Validity
+	// Ethereum address identity
+	Secp256k1 *IdentitySecp256k1
+	// Decentralized identifier, resolved when verifying
+	DID *IdentityDID
+	// User of an OpenID Connect provider
+	OIDC *IdentityOIDC
+	// WebAuthn authenticator, like a hardware security key
+	WebAuthn *IdentityWebAuthn
+	// Alias bound to an identity by the mapping darc of the alias registry
+	Alias *IdentityAlias
+	// Pattern matching the policy strings of identities
+	Pattern *IdentityPattern
+	// Leaf certificates issued by a CA
+	X509CA *IdentityX509CA
+}
+
+// Validity is a time window given as unix timestamps. A value of 0 means
+// that there is no bound on that side.
+type Validity struct {
+	// NotBefore is the first second the identity is valid
+	NotBefore int64
+	// NotAfter is the last second the identity is valid
+	NotAfter int64
 }
 
 // IdentityEd25519 holds a Ed25519 public key (Point)
@@ -75,6 +177,52 @@ type IdentityX509EC struct {
 	Public []byte
 }
 
+// IdentitySecp256k1 holds an Ethereum address, which is made of the last 20
+// bytes of the Keccak-256 hash of a secp256k1 public key.
+type IdentitySecp256k1 struct {
+	Address []byte
+}
+
+// IdentityDID holds a W3C decentralized identifier, whose keys are
+// resolved when a signature is verified.
+type IdentityDID struct {
+	DID string
+}
+
+// IdentityOIDC holds a user of an OpenID Connect provider, given by the
+// issuer and subject claims of its ID tokens.
+type IdentityOIDC struct {
+	Issuer  string
+	Subject string
+}
+
+// IdentityWebAuthn holds the COSE public key of a WebAuthn credential and
+// the relying party it is registered for.
+type IdentityWebAuthn struct {
+	RPID      string
+	PublicKey []byte
+}
+
+// IdentityAlias holds the name of an alias, resolved when a signature is
+// verified.
+type IdentityAlias struct {
+	Name string
+}
+
+// IdentityPattern holds a pattern, like "x509ec:*", matching the
+// identities whose policy string starts with the part before the '*'.
+type IdentityPattern struct {
+	Pattern string
+}
+
+// IdentityX509CA holds the DER encoding of a CA certificate, whose leaf
+// certificates are accepted. If Subject is not empty, only the leaves with
+// this common name are accepted.
+type IdentityX509CA struct {
+	Root    []byte
+	Subject string
+}
+
 // IdentityDarc is a structure that points to a Darc with a given DarcID on a skipchain
 type IdentityDarc struct {
 	ID ID
@@ -87,6 +235,17 @@ type Signature struct {
 	Signature []byte
 	// Represents the path to get up to information to be able to verify this signature
 	SignaturePath SignaturePath
+	// Nonce makes the signature unique, so that replays can be detected
+	// optional
+	Nonce []byte
+	// Expiration is the unix time after which the signature is not valid
+	// anymore, 0 for no expiration
+	// optional
+	Expiration int64
+	// Context binds the signature to the service it is meant for, so that
+	// it cannot be replayed to another service using the same darc
+	// optional
+	Context []byte
 }
 
 // SignaturePath is a struct that holds information necessary for signature verification
@@ -97,12 +256,26 @@ type SignaturePath struct {
 	Signer Identity
 	// Is the signer Owner of a Darc or an user
 	Role Role
+	// IDs of the darcs of the path, replacing Darcs in a SignatureTable
+	// optional
+	IDs []ID
+}
+
+// SignatureTable holds signatures whose paths only store the IDs of their
+// darcs. Every darc is stored once in the table, with the paths of its own
+// signature compacted the same way.
+type SignatureTable struct {
+	// Signatures with the IDs of their paths
+	Signatures []*Signature
+	// Darcs referenced by the paths
+	Darcs []*Darc
 }
 
 // Signer is a generic structure that can hold different types of signers
 type Signer struct {
-	Ed25519 *SignerEd25519
-	X509EC  *SignerX509EC
+	Ed25519  *SignerEd25519
+	X509EC   *SignerX509EC
+	External *SignerExternal
 }
 
 // SignerEd25519 holds a public and private keys necessary to sign Darcs
@@ -0,0 +1,149 @@
+package darc
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// Darcs embed the signature of their evolution, whose path holds the
+// previous darcs with their own signatures. Encoding deep chains therefore
+// repeats the same darcs many times. A SignatureTable stores every darc only
+// once and refers to it by its ID.
+
+// NewSignatureTable returns a table holding copies of the signatures, where
+// the darcs of all paths, including the paths of the signatures of the darcs,
+// are replaced by their IDs. The signatures given are not changed.
+func NewSignatureTable(sigs []*Signature) *SignatureTable {
+	t := &SignatureTable{}
+	seen := make(map[string]bool)
+	for _, sig := range sigs {
+		t.Signatures = append(t.Signatures, t.compactSignature(sig, seen))
+	}
+	return t
+}
+
+// Expand returns the signatures of the table with the darcs of their paths
+// restored. The darcs of the table are expanded in place and shared between
+// the signatures.
+func (t *SignatureTable) Expand() ([]*Signature, error) {
+	darcs := make(map[string]*Darc)
+	for _, d := range t.Darcs {
+		if d == nil {
+			return nil, errors.New("null pointer in darc table")
+		}
+		darcs[string(d.GetID())] = d
+	}
+	e := &expansion{darcs: darcs, done: make(map[string]bool), busy: make(map[string]bool)}
+	sigs := make([]*Signature, len(t.Signatures))
+	for i, sig := range t.Signatures {
+		if sig == nil {
+			return nil, errors.New("null pointer in signature table")
+		}
+		s := *sig
+		if err := e.path(&s.SignaturePath); err != nil {
+			return nil, err
+		}
+		sigs[i] = &s
+	}
+	return sigs, nil
+}
+
+// EncodeSignatures returns the protobuf representation of the signature
+// table of the signatures.
+func EncodeSignatures(sigs []*Signature) ([]byte, error) {
+	return protobuf.Encode(NewSignatureTable(sigs))
+}
+
+// DecodeSignatures reads signatures written by EncodeSignatures, with the
+// darcs of their paths expanded.
+func DecodeSignatures(buf []byte) ([]*Signature, error) {
+	t := &SignatureTable{}
+	err := protobuf.DecodeWithConstructors(buf, t, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	return t.Expand()
+}
+
+// compactSignature returns a copy of the signature with a compacted path.
+func (t *SignatureTable) compactSignature(sig *Signature, seen map[string]bool) *Signature {
+	if sig == nil {
+		return nil
+	}
+	s := *sig
+	if s.SignaturePath.Darcs != nil {
+		var ids []ID
+		for _, d := range *s.SignaturePath.Darcs {
+			ids = append(ids, t.add(d, seen))
+		}
+		s.SignaturePath.Darcs = nil
+		s.SignaturePath.IDs = ids
+	}
+	return &s
+}
+
+// add stores the darc in the table if it is not there yet and returns its
+// ID.
+func (t *SignatureTable) add(d *Darc, seen map[string]bool) ID {
+	id := d.GetID()
+	if seen[string(id)] {
+		return id
+	}
+	seen[string(id)] = true
+	c := *d
+	c.Signature = t.compactSignature(d.Signature, seen)
+	t.Darcs = append(t.Darcs, &c)
+	return id
+}
+
+// expansion restores the darcs of compacted paths. Every darc is expanded
+// once, and busy detects tables whose darcs refer to themselves.
+type expansion struct {
+	darcs map[string]*Darc
+	done  map[string]bool
+	busy  map[string]bool
+}
+
+func (e *expansion) path(sigpath *SignaturePath) error {
+	if sigpath.IDs == nil {
+		return nil
+	}
+	darcs := make([]*Darc, len(sigpath.IDs))
+	for i, id := range sigpath.IDs {
+		d, err := e.darc(id)
+		if err != nil {
+			return err
+		}
+		darcs[i] = d
+	}
+	sigpath.Darcs = &darcs
+	sigpath.IDs = nil
+	return nil
+}
+
+func (e *expansion) darc(id ID) (*Darc, error) {
+	key := string(id)
+	d, ok := e.darcs[key]
+	if !ok {
+		return nil, errors.New("darc of path not in table")
+	}
+	if e.done[key] {
+		return d, nil
+	}
+	if e.busy[key] {
+		return nil, errors.New("darc table refers to itself")
+	}
+	e.busy[key] = true
+	if d.Signature != nil {
+		sig := *d.Signature
+		if err := e.path(&sig.SignaturePath); err != nil {
+			return nil, err
+		}
+		d.Signature = &sig
+	}
+	e.done[key] = true
+	return d, nil
+}
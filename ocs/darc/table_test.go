@@ -0,0 +1,53 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureTable(t *testing.T) {
+	td := createDarc("testdarc")
+	latest := td.darc
+	for i := 0; i < 10; i++ {
+		next := latest.Copy()
+		require.Nil(t, next.SetEvolution(latest, nil, td.owners[0]))
+		latest = next
+	}
+
+	msg := []byte("document")
+	var sigs []*Signature
+	for i := 0; i < 5; i++ {
+		path := NewSignaturePath([]*Darc{latest}, *td.usersI[0], User)
+		sig, err := NewDarcSignature(append(msg, byte(i)), path, td.users[0])
+		require.Nil(t, err)
+		sigs = append(sigs, sig)
+	}
+
+	buf, err := EncodeSignatures(sigs)
+	require.Nil(t, err)
+	plain, err := protobuf.Encode(&SignatureTable{Signatures: sigs})
+	require.Nil(t, err)
+	require.True(t, len(buf)*3 < len(plain))
+	// The signatures given are not compacted.
+	require.NotNil(t, sigs[0].SignaturePath.Darcs)
+
+	decoded, err := DecodeSignatures(buf)
+	require.Nil(t, err)
+	require.Equal(t, len(sigs), len(decoded))
+	for i, sig := range decoded {
+		require.Nil(t, sig.Verify(append(msg, byte(i)), latest))
+		require.Nil(t, sig.SignaturePath.Verify(User))
+		require.Nil(t, (*sig.SignaturePath.Darcs)[0].Verify())
+	}
+
+	// The path message doesn't depend on the expansion.
+	table := NewSignatureTable(sigs)
+	require.Equal(t, sigs[0].SignaturePath.GetPathMsg(), table.Signatures[0].SignaturePath.GetPathMsg())
+
+	// All darcs of the paths have to be in the table.
+	table.Darcs = table.Darcs[1:]
+	_, err = table.Expand()
+	require.NotNil(t, err)
+}
@@ -0,0 +1,153 @@
+// Testvectors writes JSON fixtures of darcs, evolutions and signatures,
+// with their encodings, IDs and the expected verification results, for the
+// Java and JavaScript libraries in external/ to check that they agree with
+// the Go implementation. The keys are derived from fixed secrets, but the
+// signatures are randomized, so they change with every run.
+//
+//   go run ./ocs/darc/testvectors -o external/testvectors/darc.json
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// Vectors are all the fixtures.
+type Vectors struct {
+	Darcs      []*DarcVector
+	Evolutions []*EvolutionVector
+	Signatures []*SignatureVector
+}
+
+// DarcVector is a darc without signature, its policy, encoding and ID.
+type DarcVector struct {
+	Name   string
+	Policy string
+	Proto  string
+	ID     string
+}
+
+// EvolutionVector is a darc evolved from Previous, encoded with its
+// signature, and whether the evolution is valid.
+type EvolutionVector struct {
+	Name     string
+	Previous string
+	Darc     string
+	ID       string
+	Valid    bool
+}
+
+// SignatureVector is a signature on Message for the darc Base, and
+// whether it verifies.
+type SignatureVector struct {
+	Name      string
+	Base      string
+	Message   string
+	Signature string
+	Valid     bool
+}
+
+// signer returns the signer of the fixed secret i.
+func signer(i int64) *darc.Signer {
+	secret := cothority.Suite.Scalar().SetInt64(i)
+	return darc.NewSignerEd25519(cothority.Suite.Point().Mul(secret, nil), secret)
+}
+
+func encode(msg interface{}) string {
+	buf, err := protobuf.Encode(msg)
+	log.ErrFatal(err)
+	return hex.EncodeToString(buf)
+}
+
+func main() {
+	out := flag.String("o", "darc.json", "file to write the vectors to")
+	flag.Parse()
+
+	owner, user, other := signer(1), signer(2), signer(3)
+	v := &Vectors{}
+	addDarc := func(name string, d *darc.Darc) *darc.Darc {
+		proto, err := d.ToProto()
+		log.ErrFatal(err)
+		v.Darcs = append(v.Darcs, &DarcVector{
+			Name:   name,
+			Policy: d.Policy(),
+			Proto:  hex.EncodeToString(proto),
+			ID:     hex.EncodeToString(d.GetID()),
+		})
+		return d
+	}
+	owners := []*darc.Identity{owner.Identity()}
+	users := []*darc.Identity{user.Identity()}
+	base := addDarc("owner and user", darc.NewDarc(&owners, &users, []byte("base")))
+	addDarc("empty", darc.NewDarc(nil, nil, nil))
+	withDarc := []*darc.Identity{darc.NewIdentityDarc(base.GetID()), other.Identity()}
+	delegating := addDarc("darc user", darc.NewDarc(&owners, &withDarc, []byte("delegating")))
+	limited := darc.NewIdentityEd25519(user.Identity().Ed25519.Point)
+	limited.SetValidity(time.Unix(1500000000, 0), time.Time{})
+	limitedUsers := []*darc.Identity{limited}
+	addDarc("validity", darc.NewDarc(&owners, &limitedUsers, nil))
+
+	addEvolution := func(name string, prevOwner *darc.Signer, valid bool) {
+		next := base.Copy()
+		next.AddUser(other.Identity())
+		path := darc.NewSignaturePath([]*darc.Darc{base}, *prevOwner.Identity(), darc.Owner)
+		log.ErrFatal(next.SetEvolution(base, path, prevOwner))
+		if (next.Verify() == nil) != valid {
+			log.Fatal("unexpected result of evolution", name)
+		}
+		v.Evolutions = append(v.Evolutions, &EvolutionVector{
+			Name:     name,
+			Previous: encode(base),
+			Darc:     encode(next),
+			ID:       hex.EncodeToString(next.GetID()),
+			Valid:    valid,
+		})
+	}
+	addEvolution("signed by owner", owner, true)
+	addEvolution("signed by user", user, false)
+
+	msg := []byte("document")
+	addSignature := func(name string, d *darc.Darc, ds *darc.Signature, err error, valid bool) {
+		log.ErrFatal(err)
+		if (ds.VerifyAt(msg, d, time.Now()) == nil) != valid {
+			log.Fatal("unexpected result of signature", name)
+		}
+		v.Signatures = append(v.Signatures, &SignatureVector{
+			Name:      name,
+			Base:      encode(d),
+			Message:   hex.EncodeToString(msg),
+			Signature: encode(ds),
+			Valid:     valid,
+		})
+	}
+	path := darc.NewSignaturePath([]*darc.Darc{base}, *user.Identity(), darc.User)
+	ds, err := darc.NewDarcSignature(msg, path, user)
+	addSignature("user", base, ds, err, true)
+	ds, err = darc.NewDarcSignature(msg, path, other)
+	addSignature("wrong key", base, ds, err, false)
+	ds, err = darc.NewDarcSignatureNonce(msg, path, user, time.Unix(4000000000, 0))
+	addSignature("nonce and expiration", base, ds, err, true)
+	ds, err = darc.NewDarcSignatureContext(msg, path, user, []byte("ocs"))
+	addSignature("context", base, ds, err, true)
+	path = darc.NewSignaturePath([]*darc.Darc{delegating, base}, *user.Identity(), darc.User)
+	ds, err = darc.NewDarcSignature(msg, path, user)
+	addSignature("delegated", delegating, ds, err, true)
+	path = darc.NewSignaturePath([]*darc.Darc{base}, *other.Identity(), darc.User)
+	ds, err = darc.NewDarcSignature(msg, path, other)
+	addSignature("not a user", base, ds, err, false)
+
+	buf, err := json.MarshalIndent(v, "", "  ")
+	log.ErrFatal(err)
+	log.ErrFatal(os.MkdirAll(filepath.Dir(*out), 0755))
+	log.ErrFatal(ioutil.WriteFile(*out, append(buf, '\n'), 0644))
+}
@@ -0,0 +1,272 @@
+package darc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber/sign/eddsa"
+)
+
+// This file implements identities of WebAuthn authenticators, like the
+// hardware security keys supported by the browsers. The signature of such
+// an identity is the JSON encoding of a WebAuthnAssertion, returned by
+// navigator.credentials.get with the hash to sign as challenge. The
+// signature counter of the authenticator is not checked, as the
+// verification doesn't keep any state.
+
+// WebAuthnAssertion holds the parts of the response of an authenticator
+// that are needed to verify it.
+type WebAuthnAssertion struct {
+	AuthenticatorData []byte `json:"authenticatorData"`
+	ClientDataJSON    []byte `json:"clientDataJSON"`
+	Signature         []byte `json:"signature"`
+}
+
+// COSE key types and algorithms supported for the public key.
+const (
+	coseKeyOKP   = 1
+	coseKeyEC2   = 2
+	coseKeyRSA   = 3
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// webAuthnUserPresent is the flag of the authenticator data that is set if
+// the user touched the authenticator.
+const webAuthnUserPresent = 0x01
+
+// NewIdentityWebAuthn returns an identity for the credential with the given
+// COSE public key, registered for the relying party rpID.
+func NewIdentityWebAuthn(rpID string, publicKey []byte) *Identity {
+	return &Identity{
+		WebAuthn: &IdentityWebAuthn{
+			RPID:      rpID,
+			PublicKey: publicKey,
+		},
+	}
+}
+
+// Equal returns true if both IdentityWebAuthn hold the same relying party
+// and public key.
+func (idw *IdentityWebAuthn) Equal(idw2 *IdentityWebAuthn) bool {
+	return idw.RPID == idw2.RPID && bytes.Equal(idw.PublicKey, idw2.PublicKey)
+}
+
+// Verify returns nil if sig is a WebAuthnAssertion of the credential for
+// the relying party, with msg as challenge and the user present.
+func (idw *IdentityWebAuthn) Verify(msg, sig []byte) error {
+	assertion := &WebAuthnAssertion{}
+	if err := json.Unmarshal(sig, assertion); err != nil {
+		return errors.New("invalid webauthn assertion: " + err.Error())
+	}
+	clientData := struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}{}
+	if err := json.Unmarshal(assertion.ClientDataJSON, &clientData); err != nil {
+		return errors.New("invalid client data: " + err.Error())
+	}
+	if clientData.Type != "webauthn.get" {
+		return errors.New("client data is not of an assertion")
+	}
+	if clientData.Challenge != base64.RawURLEncoding.EncodeToString(msg) {
+		return errors.New("assertion for another message")
+	}
+	auth := assertion.AuthenticatorData
+	if len(auth) < 37 {
+		return errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(idw.RPID))
+	if !bytes.Equal(auth[:32], rpIDHash[:]) {
+		return errors.New("assertion for another relying party")
+	}
+	if auth[32]&webAuthnUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+	clientDataHash := sha256.Sum256(assertion.ClientDataJSON)
+	signed := append(append([]byte{}, auth...), clientDataHash[:]...)
+	return verifyCOSE(idw.PublicKey, signed, assertion.Signature)
+}
+
+// policyString returns the identity as "webauthn:<rpID>:<hex public key>",
+// with the relying party escaped so it can be used in a policy.
+func (idw *IdentityWebAuthn) policyString() string {
+	return "webauthn:" + url.QueryEscape(idw.RPID) + ":" + hex.EncodeToString(idw.PublicKey)
+}
+
+// parseWebAuthn reads an identity as returned by
+// IdentityWebAuthn.policyString.
+func parseWebAuthn(s string) (*Identity, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "webauthn:"), ":")
+	if len(parts) != 2 {
+		return nil, errors.New("webauthn identity needs relying party and key")
+	}
+	rpID, err := url.QueryUnescape(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return NewIdentityWebAuthn(rpID, key), nil
+}
+
+// verifyCOSE verifies the signature on msg with the COSE public key. ES256,
+// EdDSA with Ed25519 and RS256 keys are supported.
+func verifyCOSE(key, msg, sig []byte) error {
+	params, err := parseCOSEKey(key)
+	if err != nil {
+		return err
+	}
+	bytesParam := func(label int64) []byte {
+		b, _ := params[label].([]byte)
+		return b
+	}
+	kty, _ := params[1].(int64)
+	alg, _ := params[3].(int64)
+	switch {
+	case kty == coseKeyEC2 && alg == coseAlgES256:
+		x, y := bytesParam(-2), bytesParam(-3)
+		if len(x) != 32 || len(y) != 32 {
+			return errors.New("invalid P-256 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(),
+			X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return errors.New("invalid P-256 key")
+		}
+		rs := &sigRS{}
+		if _, err := asn1.Unmarshal(sig, rs); err != nil {
+			return err
+		}
+		hash := sha256.Sum256(msg)
+		if !ecdsa.Verify(pub, hash[:], rs.R, rs.S) {
+			return errors.New("Wrong signature")
+		}
+	case kty == coseKeyOKP && alg == coseAlgEdDSA:
+		point := cothority.Suite.Point()
+		if err := point.UnmarshalBinary(bytesParam(-2)); err != nil {
+			return err
+		}
+		if err := eddsa.Verify(point, msg, sig); err != nil {
+			return errors.New("Wrong signature")
+		}
+	case kty == coseKeyRSA && alg == coseAlgRS256:
+		n, e := bytesParam(-1), bytesParam(-2)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return errors.New("invalid rsa key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64())}
+		hash := sha256.Sum256(msg)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig); err != nil {
+			return errors.New("Wrong signature")
+		}
+	default:
+		return errors.New("unsupported cose key")
+	}
+	return nil
+}
+
+// parseCOSEKey decodes the CBOR map of a COSE key. Only integer labels and
+// integer or byte string values are supported, which is enough for the keys
+// above.
+func parseCOSEKey(key []byte) (map[int64]interface{}, error) {
+	r := &cborReader{buf: key}
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != 5 {
+		return nil, errors.New("cose key is not a map")
+	}
+	params := make(map[int64]interface{})
+	for i := uint64(0); i < n; i++ {
+		label, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		l, ok := label.(int64)
+		if !ok {
+			return nil, errors.New("unsupported cose label")
+		}
+		if params[l], err = r.value(); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("trailing bytes after cose key")
+	}
+	return params, nil
+}
+
+// cborReader reads the CBOR items needed for COSE keys.
+type cborReader struct {
+	buf []byte
+}
+
+// head reads the major type and the argument of the next item.
+func (r *cborReader) head() (byte, uint64, error) {
+	if len(r.buf) == 0 {
+		return 0, 0, errors.New("cbor data too short")
+	}
+	major, info := r.buf[0]>>5, r.buf[0]&0x1f
+	r.buf = r.buf[1:]
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, errors.New("unsupported cbor length")
+	}
+	size := 1 << (info - 24)
+	if len(r.buf) < size {
+		return 0, 0, errors.New("cbor data too short")
+	}
+	var n uint64
+	for _, b := range r.buf[:size] {
+		n = n<<8 | uint64(b)
+	}
+	r.buf = r.buf[size:]
+	return major, n, nil
+}
+
+// value reads an integer or a byte string.
+func (r *cborReader) value() (interface{}, error) {
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0, 1:
+		if n > 1<<62 {
+			return nil, errors.New("cbor integer too big")
+		}
+		if major == 1 {
+			return -1 - int64(n), nil
+		}
+		return int64(n), nil
+	case 2:
+		if uint64(len(r.buf)) < n {
+			return nil, errors.New("cbor data too short")
+		}
+		b := r.buf[:n]
+		r.buf = r.buf[n:]
+		return b, nil
+	}
+	return nil, errors.New("unsupported cbor type")
+}
@@ -0,0 +1,139 @@
+package darc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/dedis/kyber/sign/eddsa"
+	"github.com/dedis/kyber/util/random"
+	"github.com/stretchr/testify/require"
+)
+
+// cborHead encodes the major type and argument of a CBOR item.
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+// coseKey encodes the labels and values, which are int64 or []byte, as a
+// CBOR map.
+func coseKey(params ...interface{}) []byte {
+	buf := cborHead(5, uint64(len(params)/2))
+	for _, p := range params {
+		switch v := p.(type) {
+		case int64:
+			if v >= 0 {
+				buf = append(buf, cborHead(0, uint64(v))...)
+			} else {
+				buf = append(buf, cborHead(1, uint64(-1-v))...)
+			}
+		case []byte:
+			buf = append(append(buf, cborHead(2, uint64(len(v)))...), v...)
+		}
+	}
+	return buf
+}
+
+// testAssertion returns the assertion an authenticator would return for
+// the challenge, signed with sign.
+func testAssertion(t *testing.T, rpID string, challenge []byte, sign func([]byte) []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	auth := append(rpIDHash[:], webAuthnUserPresent, 0, 0, 0, 1)
+	clientData, err := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    "https://" + rpID,
+	})
+	require.Nil(t, err)
+	clientDataHash := sha256.Sum256(clientData)
+	a := &WebAuthnAssertion{
+		AuthenticatorData: auth,
+		ClientDataJSON:    clientData,
+		Signature:         sign(append(append([]byte{}, auth...), clientDataHash[:]...)),
+	}
+	buf, err := json.Marshal(a)
+	require.Nil(t, err)
+	return buf
+}
+
+func TestIdentityWebAuthn(t *testing.T) {
+	msg := []byte("document")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ecPublic := coseKey(int64(1), int64(coseKeyEC2), int64(3), int64(coseAlgES256),
+		int64(-1), int64(1), int64(-2), padBytes(ecKey.X), int64(-3), padBytes(ecKey.Y))
+	ecSign := func(data []byte) []byte {
+		hash := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, hash[:])
+		require.Nil(t, err)
+		sig, err := asn1.Marshal(sigRS{R: r, S: s})
+		require.Nil(t, err)
+		return sig
+	}
+	ed := eddsa.NewEdDSA(random.New())
+	edPoint, err := ed.Public.MarshalBinary()
+	require.Nil(t, err)
+	edPublic := coseKey(int64(1), int64(coseKeyOKP), int64(3), int64(coseAlgEdDSA),
+		int64(-1), int64(6), int64(-2), edPoint)
+	edSign := func(data []byte) []byte {
+		sig, err := ed.Sign(data)
+		require.Nil(t, err)
+		return sig
+	}
+
+	for _, key := range []struct {
+		public []byte
+		sign   func([]byte) []byte
+	}{{ecPublic, ecSign}, {edPublic, edSign}} {
+		id := NewIdentityWebAuthn("example.org", key.public)
+		require.Nil(t, id.validate())
+		require.Equal(t, 6, id.Type())
+
+		d := NewDarc(nil, &[]*Identity{id}, nil)
+		path := NewSignaturePath([]*Darc{d}, *id, User)
+		signer := NewSignerExternal(id, func(challenge []byte) ([]byte, error) {
+			return testAssertion(t, "example.org", challenge, key.sign), nil
+		})
+		ds, err := NewDarcSignature(msg, path, signer)
+		require.Nil(t, err)
+		require.Nil(t, ds.Verify(msg, d))
+		require.NotNil(t, ds.Verify([]byte("other"), d))
+
+		// The assertion has to be for the relying party of the identity.
+		hash, err := path.SigHash(msg)
+		require.Nil(t, err)
+		require.NotNil(t, id.Verify(hash, testAssertion(t, "evil.org", hash, key.sign)))
+	}
+
+	// Without the user present, the assertion is refused.
+	id := NewIdentityWebAuthn("example.org", ecPublic)
+	sig := testAssertion(t, "example.org", msg, ecSign)
+	require.Nil(t, id.Verify(msg, sig))
+	a := &WebAuthnAssertion{}
+	require.Nil(t, json.Unmarshal(sig, a))
+	a.AuthenticatorData[32] = 0
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	a.Signature = ecSign(append(append([]byte{}, a.AuthenticatorData...), clientDataHash[:]...))
+	sig, err = json.Marshal(a)
+	require.Nil(t, err)
+	require.NotNil(t, id.Verify(msg, sig))
+
+	require.NotNil(t, NewIdentityWebAuthn("example.org", []byte{0xa0}).Verify(msg, sig))
+	require.NotNil(t, NewIdentityWebAuthn("example.org", []byte{1, 2}).Verify(msg, sig))
+
+	parsed, err := ParseIdentity(id.PolicyString())
+	require.Nil(t, err)
+	require.True(t, parsed.Equal(id))
+}
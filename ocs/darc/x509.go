@@ -0,0 +1,191 @@
+package darc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+// This file lets organizations reuse their PKI in darcs. A single
+// certificate is imported as an X509EC identity. A CA certificate becomes
+// an IdentityX509CA, which accepts every leaf certificate it issued: the
+// signature holds the chain of the signer, which is verified against the
+// CA when the request is verified, including the expiry of the
+// certificates and their key usage.
+
+// X509ChainSignature is the signature of an IdentityX509CA: the chain of
+// the signer and its signature on the message.
+type X509ChainSignature struct {
+	// Chain holds the DER encoded leaf certificate, followed by the
+	// intermediate certificates up to, but without, the CA
+	Chain [][]byte
+	// Signature of the leaf key on the message: ASN.1 encoded ECDSA on the
+	// SHA-384 hash, like X509EC, or PKCS #1 v1.5 RSA on the SHA-256 hash
+	Signature []byte
+}
+
+// NewIdentityFromCertificate returns an X509EC identity for the public key
+// of the certificate, valid only while the certificate is. Only ECDSA keys
+// are supported.
+func NewIdentityFromCertificate(cert *x509.Certificate) (*Identity, error) {
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+		return nil, errors.New("certificate doesn't hold an ecdsa key")
+	}
+	id := NewIdentityX509EC(cert.RawSubjectPublicKeyInfo)
+	id.SetValidity(cert.NotBefore, cert.NotAfter)
+	return id, nil
+}
+
+// NewIdentityX509CA returns an identity for the leaf certificates issued
+// by the CA certificate. If subject is not empty, only the leaves with
+// this common name are accepted.
+func NewIdentityX509CA(ca *x509.Certificate, subject string) *Identity {
+	return &Identity{
+		X509CA: &IdentityX509CA{
+			Root:    ca.Raw,
+			Subject: subject,
+		},
+	}
+}
+
+// NewSignerX509Chain returns a signer for the identity of the CA, which
+// signs with the key of the first certificate of the chain. The other
+// certificates of the chain are the intermediates up to the CA.
+func NewSignerX509Chain(ca *x509.Certificate, subject string, chain []*x509.Certificate,
+	key crypto.Signer) *Signer {
+	return NewSignerExternal(NewIdentityX509CA(ca, subject), func(msg []byte) ([]byte, error) {
+		var sig []byte
+		var err error
+		switch key.Public().(type) {
+		case *ecdsa.PublicKey:
+			hash := sha512.Sum384(msg)
+			sig, err = key.Sign(rand.Reader, hash[:], crypto.SHA384)
+		case *rsa.PublicKey:
+			hash := sha256.Sum256(msg)
+			sig, err = key.Sign(rand.Reader, hash[:], crypto.SHA256)
+		default:
+			return nil, errors.New("only ecdsa and rsa keys are supported")
+		}
+		if err != nil {
+			return nil, err
+		}
+		cs := &X509ChainSignature{Signature: sig}
+		for _, cert := range chain {
+			cs.Chain = append(cs.Chain, cert.Raw)
+		}
+		return protobuf.Encode(cs)
+	})
+}
+
+// Equal returns true if both IdentityX509CA hold the same CA and subject.
+func (idc *IdentityX509CA) Equal(idc2 *IdentityX509CA) bool {
+	return bytes.Equal(idc.Root, idc2.Root) && idc.Subject == idc2.Subject
+}
+
+// Verify returns nil if sig is an X509ChainSignature whose chain is issued
+// by the CA and valid now, and whose leaf signed msg. The leaf has to allow
+// client authentication and digital signatures, if it restricts its usage.
+func (idc *IdentityX509CA) Verify(msg, sig []byte) error {
+	cs := &X509ChainSignature{}
+	if err := protobuf.Decode(sig, cs); err != nil {
+		return errors.New("invalid chain signature: " + err.Error())
+	}
+	if len(cs.Chain) == 0 {
+		return errors.New("missing certificate chain")
+	}
+	root, err := x509.ParseCertificate(idc.Root)
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	opts.Roots.AddCert(root)
+	leaf, err := x509.ParseCertificate(cs.Chain[0])
+	if err != nil {
+		return err
+	}
+	for _, der := range cs.Chain[1:] {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return err
+	}
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return errors.New("certificate is not for digital signatures")
+	}
+	if idc.Subject != "" && leaf.Subject.CommonName != idc.Subject {
+		return errors.New("certificate is for another subject")
+	}
+	switch public := leaf.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha512.Sum384(msg)
+		rs := &sigRS{}
+		if _, err := asn1.Unmarshal(cs.Signature, rs); err != nil {
+			return err
+		}
+		if !ecdsa.Verify(public, hash[:], rs.R, rs.S) {
+			return errors.New("Wrong signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(msg)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, hash[:], cs.Signature)
+	default:
+		return errors.New("unsupported key in certificate")
+	}
+}
+
+// policyString returns the identity as "x509ca:<hex DER of the CA>", followed
+// by ":<subject>" if a subject is required, escaped so it can be used in a
+// policy.
+func (idc *IdentityX509CA) policyString() string {
+	s := "x509ca:" + hex.EncodeToString(idc.Root)
+	if idc.Subject != "" {
+		s += ":" + url.QueryEscape(idc.Subject)
+	}
+	return s
+}
+
+// parseX509CA reads an identity as returned by IdentityX509CA.policyString.
+func parseX509CA(s string) (*Identity, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "x509ca:"), ":")
+	if len(parts) > 2 {
+		return nil, errors.New("x509ca identity needs a CA and an optional subject")
+	}
+	root, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(root)
+	if err != nil {
+		return nil, err
+	}
+	subject := ""
+	if len(parts) == 2 {
+		if subject, err = url.QueryUnescape(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return NewIdentityX509CA(ca, subject), nil
+}
@@ -0,0 +1,139 @@
+package darc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate returns a certificate for the key, issued by parent and
+// signed by parentKey. Without a parent, the certificate is a self-signed
+// CA.
+func testCertificate(t *testing.T, tmpl *x509.Certificate, key crypto.Signer,
+	parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
+
+func TestNewIdentityFromCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	cert := testCertificate(t, &x509.Certificate{}, key, nil, nil)
+	id, err := NewIdentityFromCertificate(cert)
+	require.Nil(t, err)
+	require.Equal(t, 2, id.Type())
+	require.Equal(t, cert.NotAfter.Unix(), id.Validity.NotAfter)
+
+	msg := []byte("document")
+	hash := crypto.SHA384.New()
+	hash.Write(msg)
+	sig, err := key.Sign(rand.Reader, hash.Sum(nil), crypto.SHA384)
+	require.Nil(t, err)
+	require.Nil(t, id.Verify(msg, sig))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.Nil(t, err)
+	_, err = NewIdentityFromCertificate(testCertificate(t, &x509.Certificate{}, rsaKey, nil, nil))
+	require.NotNil(t, err)
+}
+
+func TestIdentityX509CA(t *testing.T) {
+	msg := []byte("document")
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ca := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}},
+		caKey, nil, nil)
+	interKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	inter := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"},
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign},
+		interKey, ca, caKey)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	leafRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.Nil(t, err)
+	leaf := func(name string, key crypto.Signer, tmpl *x509.Certificate) *x509.Certificate {
+		tmpl.Subject = pkix.Name{CommonName: name}
+		if tmpl.ExtKeyUsage == nil {
+			tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}
+		if tmpl.KeyUsage == 0 {
+			tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		}
+		return testCertificate(t, tmpl, key, inter, interKey)
+	}
+	alice := leaf("alice", leafKey, &x509.Certificate{})
+
+	id := NewIdentityX509CA(ca, "")
+	require.Nil(t, id.validate())
+	require.Equal(t, 9, id.Type())
+	d := NewDarc(nil, &[]*Identity{id}, nil)
+	for _, s := range []struct {
+		cert *x509.Certificate
+		key  crypto.Signer
+	}{{alice, leafKey}, {leaf("bob", leafRSAKey, &x509.Certificate{}), leafRSAKey}} {
+		signer := NewSignerX509Chain(ca, "", []*x509.Certificate{s.cert, inter}, s.key)
+		ds, err := NewDarcSignature(msg, NewSignaturePath([]*Darc{d}, *id, User), signer)
+		require.Nil(t, err)
+		require.Nil(t, ds.Verify(msg, d))
+		require.NotNil(t, ds.Verify([]byte("other"), d))
+	}
+
+	verify := func(id *Identity, cert *x509.Certificate, chain ...*x509.Certificate) error {
+		signer := NewSignerX509Chain(ca, "", append([]*x509.Certificate{cert}, chain...), leafKey)
+		sig, err := signer.External.SignFunc(msg)
+		require.Nil(t, err)
+		return id.Verify(msg, sig)
+	}
+	require.Nil(t, verify(id, alice, inter))
+	// The subject is checked if the identity requires one.
+	require.Nil(t, verify(NewIdentityX509CA(ca, "alice"), alice, inter))
+	require.NotNil(t, verify(NewIdentityX509CA(ca, "bob"), alice, inter))
+	// The chain has to lead to the CA.
+	require.NotNil(t, verify(id, alice))
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	other := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}},
+		otherKey, nil, nil)
+	require.NotNil(t, verify(NewIdentityX509CA(other, ""), alice, inter))
+	// Expired certificates and certificates for other usages are refused.
+	require.NotNil(t, verify(id, leaf("alice", leafKey, &x509.Certificate{
+		NotBefore: time.Now().Add(-2 * time.Hour), NotAfter: time.Now().Add(-time.Hour)}), inter))
+	require.NotNil(t, verify(id, leaf("alice", leafKey, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}), inter))
+	require.NotNil(t, verify(id, leaf("alice", leafKey, &x509.Certificate{
+		KeyUsage: x509.KeyUsageKeyEncipherment}), inter))
+	require.NotNil(t, id.Verify(msg, []byte{1, 2, 3}))
+
+	for _, id := range []*Identity{id, NewIdentityX509CA(ca, "alice: the admin")} {
+		parsed, err := ParseIdentity(id.PolicyString())
+		require.Nil(t, err)
+		require.True(t, parsed.Equal(id))
+	}
+	_, err = ParseIdentity("x509ca:0102")
+	require.NotNil(t, err)
+	require.NotNil(t, (&Identity{X509CA: &IdentityX509CA{Root: []byte{1}}}).validate())
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/anon"
+	"github.com/dedis/kyber/util/key"
+)
+
+// AnonymousReadMessage returns the message signed by an anonymous read of
+// the document with the given index in the block dataID.
+func AnonymousReadMessage(dataID skipchain.SkipBlockID, index int, ephemeral kyber.Point) ([]byte, error) {
+	hash := sha256.New()
+	hash.Write(dataID)
+	if err := binary.Write(hash, binary.LittleEndian, int64(index)); err != nil {
+		return nil, err
+	}
+	if _, err := ephemeral.MarshalTo(hash); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// NewAnonymousRead returns an anonymous read of the document with the given
+// index in the block dataID, signed by the reader with the private key priv,
+// whose public key is set[mine]. The private part of the ephemeral key is
+// returned to decrypt the symmetric key.
+func NewAnonymousRead(dataID skipchain.SkipBlockID, index int, set []kyber.Point,
+	mine int, priv kyber.Scalar) (*AnonymousRead, kyber.Scalar, error) {
+	if mine < 0 || mine >= len(set) ||
+		!cothority.Suite.Point().Mul(priv, nil).Equal(set[mine]) {
+		return nil, nil, errors.New("reader is not in the set")
+	}
+	ephemeral := key.NewKeyPair(cothority.Suite)
+	msg, err := AnonymousReadMessage(dataID, index, ephemeral.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &AnonymousRead{
+		Set:       set,
+		Ephemeral: ephemeral.Public,
+		Signature: anon.Sign(cothority.Suite.(anon.Suite), msg, anon.Set(set), nil, mine, priv),
+	}, ephemeral.Private, nil
+}
+
+// Verify returns nil if the ring signature of the anonymous read of the
+// document with the given index in the block dataID is valid.
+func (ar *AnonymousRead) Verify(dataID skipchain.SkipBlockID, index int) error {
+	if len(ar.Set) == 0 || ar.Ephemeral == nil {
+		return errors.New("missing set or ephemeral key")
+	}
+	msg, err := AnonymousReadMessage(dataID, index, ar.Ephemeral)
+	if err != nil {
+		return err
+	}
+	_, err = anon.Verify(cothority.Suite.(anon.Suite), msg, anon.Set(ar.Set), nil, ar.Signature)
+	return err
+}
@@ -10,6 +10,8 @@ This part of the service runs on the client or the app.
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/ocs/darc"
@@ -87,6 +89,9 @@ func (c *Client) EditAccount(ocs *SkipChainURL, d *darc.Darc) (sb *skipchain.Ski
 // symKey. This method will encrypt the symKey using the public shared key of the
 // ocs-service and only send this encrypted key over the network. The block will also
 // contain the list of readers that are allowed to request the key.
+// If encData is bigger than the maximum payload of the conode, it is first
+// stored in chunks, each in its own block, and the write-block lists the
+// chunks. GetData puts the chunks back together.
 //
 // Input:
 //  - ocs [*SkipChainURL] - the url of the skipchain to use
@@ -103,19 +108,29 @@ func (c *Client) EditAccount(ocs *SkipChainURL, d *darc.Darc) (sb *skipchain.Ski
 func (c *Client) WriteRequest(ocs *SkipChainURL, encData []byte, symKey []byte,
 	sig *darc.Signature, acl *darc.Darc) (sb *skipchain.SkipBlock,
 	err error) {
-	if len(encData) > 1e7 {
-		return nil, errors.New("Cannot store data bigger than 10MB")
-	}
-
 	requestShared := &SharedPublicRequest{Genesis: ocs.Genesis}
 	shared := &SharedPublicReply{}
 	err = c.SendProtobuf(ocs.Roster.List[0], requestShared, shared)
 	if err != nil {
 		return
 	}
+	max := shared.MaxPayload
+	if max == 0 {
+		max = defaultMaxPayload
+	}
+	if len(encData) > max*maxChunks {
+		return nil, fmt.Errorf("cannot store data bigger than %d bytes", max*maxChunks)
+	}
 
 	write := NewWrite(cothority.Suite, ocs.Genesis, shared.X, acl, symKey)
 	write.Data = encData
+	if len(encData) > max {
+		write.Data = nil
+		write.Chunks, err = c.writeChunks(ocs, encData, max, sig, acl)
+		if err != nil {
+			return
+		}
+	}
 	wr := &WriteRequest{
 		Write:     *write,
 		Readers:   acl,
@@ -128,6 +143,86 @@ func (c *Client) WriteRequest(ocs *SkipChainURL, encData []byte, symKey []byte,
 	return
 }
 
+// writeChunks stores encData in chunks of at most max bytes, and returns the
+// ids of their blocks.
+func (c *Client) writeChunks(ocs *SkipChainURL, encData []byte, max int,
+	sig *darc.Signature, acl *darc.Darc) ([]skipchain.SkipBlockID, error) {
+	var ids []skipchain.SkipBlockID
+	for start := 0; start < len(encData); start += max {
+		end := start + max
+		if end > len(encData) {
+			end = len(encData)
+		}
+		req := &WriteChunkRequest{
+			OCS: ocs.Genesis,
+			Chunk: Chunk{
+				Data:      encData[start:end],
+				Reader:    acl.GetID(),
+				Signature: *sig,
+			},
+		}
+		reply := &WriteChunkReply{}
+		if err := c.SendProtobuf(ocs.Roster.List[0], req, reply); err != nil {
+			return nil, err
+		}
+		ids = append(ids, reply.SB.Hash)
+	}
+	return ids, nil
+}
+
+// WriteBatchRequest works like WriteRequest, but stores all the documents in
+// one block with one signature. The documents are identified by the id of the
+// block and their index in encData.
+//
+// Input:
+//  - ocs [*SkipChainURL] - the url of the skipchain to use
+//  - encData [[][]byte] - the documents - already encrypted using symKeys
+//  - symKeys [[][]byte] - the symmetric key of each document
+//  - sig [*darc.Signature] - the signature of a writer on the id of acl
+//  - acl [Darc] - the access control list of all documents
+//
+// Output:
+//  - sb [*skipchain.SkipBlock] - the block holding all the documents
+//  - err - an error if something went wrong, or nil
+func (c *Client) WriteBatchRequest(ocs *SkipChainURL, encData [][]byte, symKeys [][]byte,
+	sig *darc.Signature, acl *darc.Darc) (sb *skipchain.SkipBlock,
+	err error) {
+	if len(encData) != len(symKeys) {
+		return nil, errors.New("need one symmetric key per document")
+	}
+	size := 0
+	for _, d := range encData {
+		size += len(d)
+	}
+	if size > 1e7 {
+		return nil, errors.New("Cannot store data bigger than 10MB")
+	}
+
+	requestShared := &SharedPublicRequest{Genesis: ocs.Genesis}
+	shared := &SharedPublicReply{}
+	err = c.SendProtobuf(ocs.Roster.List[0], requestShared, shared)
+	if err != nil {
+		return
+	}
+
+	wr := &WriteBatchRequest{
+		Readers:   acl,
+		OCS:       ocs.Genesis,
+		Signature: *sig,
+	}
+	for i := range encData {
+		write := NewWrite(cothority.Suite, ocs.Genesis, shared.X, acl, symKeys[i])
+		write.Data = encData[i]
+		wr.Writes = append(wr.Writes, *write)
+	}
+	reply := &WriteBatchReply{}
+	err = c.SendProtobuf(ocs.Roster.List[0], wr, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.SB, nil
+}
+
 // ReadRequest is used to request a re-encryption of the symmetric key of the
 // given data. The ocs-skipchain will verify if the signature corresponds to
 // one of the public keys given in the write-request, and only if this is valid,
@@ -146,6 +241,13 @@ func (c *Client) WriteRequest(ocs *SkipChainURL, encData []byte, symKey []byte,
 //  - err - an error if something went wrong, or nil
 func (c *Client) ReadRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
 	reader kyber.Scalar) (sb *skipchain.SkipBlock, err error) {
+	return c.ReadBatchRequest(ocs, dataID, 0, reader)
+}
+
+// ReadBatchRequest works like ReadRequest for the document with the given
+// index in a block written by WriteBatchRequest.
+func (c *Client) ReadBatchRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
+	index int, reader kyber.Scalar) (sb *skipchain.SkipBlock, err error) {
 	sig, err := schnorr.Sign(cothority.Suite, reader, dataID)
 	if err != nil {
 		return nil, err
@@ -154,6 +256,7 @@ func (c *Client) ReadRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
 	request := &ReadRequest{
 		Read: Read{
 			DataID:    dataID,
+			Index:     index,
 			Signature: darc.Signature{Signature: sig},
 		},
 		OCS: ocs.Genesis,
@@ -166,6 +269,41 @@ func (c *Client) ReadRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
 	return reply.SB, nil
 }
 
+// AnonymousReadRequest works like ReadBatchRequest, but the skipchain only
+// records that one of the readers in set asks for the key. All keys of set
+// must be readers of the document, and the public key of reader must be one
+// of them. The returned ephemeral key replaces the private key of the reader
+// in DecryptKeyRequest.
+func (c *Client) AnonymousReadRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
+	index int, set []kyber.Point, reader kyber.Scalar) (sb *skipchain.SkipBlock,
+	ephemeral kyber.Scalar, err error) {
+	pub := cothority.Suite.Point().Mul(reader, nil)
+	mine := -1
+	for i, p := range set {
+		if p.Equal(pub) {
+			mine = i
+		}
+	}
+	anonymous, ephemeral, err := NewAnonymousRead(dataID, index, set, mine, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	request := &ReadRequest{
+		Read: Read{
+			DataID:    dataID,
+			Index:     index,
+			Anonymous: anonymous,
+		},
+		OCS: ocs.Genesis,
+	}
+	reply := &ReadReply{}
+	err = c.SendProtobuf(ocs.Roster.List[0], request, reply)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply.SB, ephemeral, nil
+}
+
 // DecryptKeyRequest takes the id of a successful read-request and asks the cothority
 // to re-encrypt the symmetric key under the reader's public key. The cothority
 // does a distributed re-encryption, so that the actual symmetric key is never revealed
@@ -179,7 +317,8 @@ func (c *Client) ReadRequest(ocs *SkipChainURL, dataID skipchain.SkipBlockID,
 //
 // Output:
 //  - sym [[]byte] - the decrypted symmetric key
-//  - err - an error if something went wrong, or nil
+//  - err - an error if something went wrong, or nil. If the darcs don't
+//    allow the reader to read anymore, it is ErrReadExpired
 func (c *Client) DecryptKeyRequest(ocs *SkipChainURL, readID skipchain.SkipBlockID, reader kyber.Scalar) (sym []byte,
 	err error) {
 	request := &DecryptKeyRequest{
@@ -188,7 +327,7 @@ func (c *Client) DecryptKeyRequest(ocs *SkipChainURL, readID skipchain.SkipBlock
 	reply := &DecryptKeyReply{}
 	err = c.SendProtobuf(ocs.Roster.List[0], request, reply)
 	if err != nil {
-		return
+		return nil, decryptError(err)
 	}
 
 	log.LLvl2("Got decryption key")
@@ -201,6 +340,16 @@ func (c *Client) DecryptKeyRequest(ocs *SkipChainURL, readID skipchain.SkipBlock
 	return
 }
 
+// decryptError returns ErrReadExpired if the service refused to re-encrypt
+// the key because the read grant expired, so that the caller can check for
+// it.
+func decryptError(err error) error {
+	if strings.Contains(err.Error(), ErrReadExpired.Error()) {
+		return ErrReadExpired
+	}
+	return err
+}
+
 // DecryptKeyRequestEphemeral works similar to DecryptKeyRequest but generates
 // an ephemeral keypair that is used in the decryption. It still needs the
 // reader to be able to sign the ephemeral keypair, to make sure that the read-
@@ -223,7 +372,7 @@ func (c *Client) DecryptKeyRequestEphemeral(ocs *SkipChainURL, readID skipchain.
 	if err != nil {
 		return
 	}
-	sig, err := darc.NewDarcSignature(msg, path, reader)
+	sig, err := darc.NewDarcSignatureContext(msg, path, reader, []byte(ServiceName))
 	if err != nil {
 		return
 	}
@@ -235,7 +384,7 @@ func (c *Client) DecryptKeyRequestEphemeral(ocs *SkipChainURL, readID skipchain.
 	reply := &DecryptKeyReply{}
 	err = c.SendProtobuf(ocs.Roster.List[0], request, reply)
 	if err != nil {
-		return
+		return nil, decryptError(err)
 	}
 
 	log.LLvl2("Got decryption key")
@@ -247,6 +396,36 @@ func (c *Client) DecryptKeyRequestEphemeral(ocs *SkipChainURL, readID skipchain.
 	return
 }
 
+// RotateKey asks the ocs-service to replace its roster and its shared key.
+// A new DKG is run on the new roster, and the symmetric keys of all
+// write-requests are re-encrypted to the new shared key, so that they can
+// still be read.
+//
+// Input:
+//  - ocs [*SkipChainURL] - the url of the skipchain to use
+//  - roster [*onet.Roster] - the new roster, which must share the first
+//    node with the current roster
+//  - sig [*darc.Signature] - a signature of an owner of the admin darc on
+//    RotateKeyMessage(ocs.Genesis, roster)
+//
+// Output:
+//  - newOCS [*SkipChainURL] - the url of the skipchain with the new roster
+//  - err - an error if something went wrong, or nil
+func (c *Client) RotateKey(ocs *SkipChainURL, roster *onet.Roster, sig *darc.Signature) (newOCS *SkipChainURL,
+	err error) {
+	req := &RotateKeyRequest{
+		OCS:       ocs.Genesis,
+		Roster:    *roster,
+		Signature: *sig,
+	}
+	reply := &RotateKeyReply{}
+	err = c.SendProtobuf(ocs.Roster.List[0], req, reply)
+	if err != nil {
+		return nil, err
+	}
+	return NewSkipChainURL(reply.SB), nil
+}
+
 // GetData returns the encrypted data from a write-request given its id. It requests
 // the data from the skipchain. To decode the data, the caller has to have a
 // decrypted symmetric key, then he can decrypt the data with:
@@ -272,7 +451,44 @@ func (c *Client) GetData(ocs *SkipChainURL, dataID skipchain.SkipBlockID) (encDa
 	if ocsData == nil || ocsData.Write == nil {
 		return nil, errors.New("not correct type of data")
 	}
-	return ocsData.Write.Data, nil
+	return c.writeData(ocs, ocsData.Write)
+}
+
+// GetBatchData returns the encrypted data of the document with the given
+// index in a block written by WriteBatchRequest.
+func (c *Client) GetBatchData(ocs *SkipChainURL, dataID skipchain.SkipBlockID, index int) (encData []byte,
+	err error) {
+	cl := skipchain.NewClient()
+	sb, err := cl.GetSingleBlock(ocs.Roster, dataID)
+	if err != nil {
+		return nil, err
+	}
+	ocsData := NewOCS(sb.Data)
+	if ocsData == nil || ocsData.WriteAt(index) == nil {
+		return nil, errors.New("not correct type of data")
+	}
+	return c.writeData(ocs, ocsData.WriteAt(index))
+}
+
+// writeData returns the data of the write, put together from its chunks if
+// it has any.
+func (c *Client) writeData(ocs *SkipChainURL, write *Write) ([]byte, error) {
+	if len(write.Chunks) == 0 {
+		return write.Data, nil
+	}
+	var data []byte
+	for _, id := range write.Chunks {
+		sb, err := c.sbc.GetSingleBlock(ocs.Roster, id)
+		if err != nil {
+			return nil, err
+		}
+		ocsData := NewOCS(sb.Data)
+		if ocsData == nil || ocsData.Chunk == nil {
+			return nil, errors.New("not correct type of chunk")
+		}
+		data = append(data, ocsData.Chunk.Data...)
+	}
+	return data, nil
 }
 
 // GetReadRequests searches the skipchain starting at 'start' for requests and returns all found
@@ -282,8 +498,11 @@ func (c *Client) GetData(ocs *SkipChainURL, dataID skipchain.SkipBlockID) (encDa
 //
 // Input:
 //  - ocs [*SkipChainURL] - the url of the skipchain to use
+//  - start [skipchain.SkipBlockID] - the block to start from
+//  - count [int] - the maximum number of requests, or 0
 //
 // Output:
+//  - docs [[]*ReadDoc] - the reader, read-block and timestamp of each request
 //  - err - an error if something went wrong, or nil
 func (c *Client) GetReadRequests(ocs *SkipChainURL, start skipchain.SkipBlockID, count int) ([]*ReadDoc, error) {
 	request := &GetReadRequests{start, count}
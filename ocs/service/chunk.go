@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// defaultMaxPayload is the maximum size of the data of a write or a chunk,
+// unless the conode sets another one with SetMaxPayload.
+const defaultMaxPayload = 10000000
+
+// maxChunks is the maximum number of chunks of a write.
+const maxChunks = 1000
+
+// SetMaxPayload sets the maximum size of the data of a write or a chunk that
+// this conode accepts in a new block. As the blocks with a bigger payload are
+// refused, all conodes of a skipchain should use the same limit. A size of 0
+// resets the limit to defaultMaxPayload.
+func (s *Service) SetMaxPayload(size int) {
+	s.saveMutex.Lock()
+	s.Storage.MaxPayload = size
+	s.saveMutex.Unlock()
+	s.save()
+}
+
+func (s *Service) maxPayload() int {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	if s.Storage.MaxPayload > 0 {
+		return s.Storage.MaxPayload
+	}
+	return defaultMaxPayload
+}
+
+// WriteChunkRequest adds a block to the OCS-skipchain with a chunk of the
+// data of a document too big for a write-request. Once all chunks are stored,
+// the write-request lists them in Write.Chunks.
+func (s *Service) WriteChunkRequest(req *WriteChunkRequest) (reply *WriteChunkReply,
+	err error) {
+	s.process.Lock()
+	defer s.process.Unlock()
+	log.Lvlf2("Write chunk on skipchain %x", req.OCS)
+	reply = &WriteChunkReply{}
+	latestSB, err := s.db().GetLatest(s.db().GetByID(req.OCS))
+	if err != nil {
+		return nil, errors.New("didn't find latest block: " + err.Error())
+	}
+	if err := s.verifyChunk(req.OCS, &req.Chunk); err != nil {
+		return nil, errors.New("chunk-verification failed: " + err.Error())
+	}
+	data, err := protobuf.Encode(&Transaction{
+		Chunk:     &req.Chunk,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply.SB, err = s.storeSkipBlock(latestSB, data)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := s.propagateOCS(reply.SB.Roster, reply.SB, propagationTimeout)
+	if err != nil {
+		return
+	}
+	if replies != len(reply.SB.Roster.List) {
+		log.Warn("Got only", replies, "replies for chunk-propagation")
+	}
+	return
+}
+
+// verifyChunk makes sure that the chunk is not too big and is signed by a
+// writer that has a valid path from the admin darc in the ocs skipchain.
+func (s *Service) verifyChunk(ocs skipchain.SkipBlockID, chunk *Chunk) error {
+	if max := s.maxPayload(); len(chunk.Data) > max {
+		return fmt.Errorf("chunk is bigger than %d bytes", max)
+	}
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	admin := s.Storage.Admins[string(ocs)]
+	if admin == nil {
+		return errors.New("couldn't find admin for this chain")
+	}
+	return s.verifySignature(chunk.Reader, chunk.Signature, *admin, darc.User)
+}
+
+// verifyPayload makes sure that the data of the write is not too big, or
+// that all of its chunks are stored on the ocs skipchain for the same reader.
+func (s *Service) verifyPayload(ocs skipchain.SkipBlockID, write *Write) error {
+	if max := s.maxPayload(); len(write.Data) > max {
+		return fmt.Errorf("data is bigger than %d bytes", max)
+	}
+	if len(write.Chunks) == 0 {
+		return nil
+	}
+	if len(write.Data) > 0 {
+		return errors.New("write holds data and chunks")
+	}
+	if len(write.Chunks) > maxChunks {
+		return errors.New("too many chunks in write")
+	}
+	for _, id := range write.Chunks {
+		sb := s.db().GetByID(id)
+		if sb == nil || !sb.SkipChainID().Equal(ocs) {
+			return fmt.Errorf("didn't find chunk %x", id)
+		}
+		dataOCS := NewOCS(sb.Data)
+		if dataOCS == nil || dataOCS.Chunk == nil ||
+			!dataOCS.Chunk.Reader.Equal(write.Reader.GetID()) {
+			return fmt.Errorf("block %x is not a chunk of this write", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/ocs/darc"
+	"github.com/dedis/onet/log"
+)
+
+// expiryInterval is the time between two scans for expiring read grants.
+var expiryInterval = time.Minute
+
+// expiryNotice is how long before a read grant expires it is announced.
+var expiryNotice = 24 * time.Hour
+
+// webhookTimeout is the maximum time to deliver an event to the webhook.
+var webhookTimeout = 10 * time.Second
+
+// ExpiryEvent announces that a read grant of a darc will expire soon: a
+// user of the latest version of the darc has a Validity ending at Expires,
+// so the owners can renew it before the reader loses access.
+type ExpiryEvent struct {
+	// BaseID is the base-id of the darc holding the grant
+	BaseID darc.ID `json:"baseId"`
+	// Version is the latest version of the darc
+	Version int `json:"version"`
+	// Identity is the reader, as used in the policy format of darcs
+	Identity string `json:"identity"`
+	// Expires is the unix time at which the grant expires
+	Expires int64 `json:"expires"`
+}
+
+// expiries holds the subscribers to the expiry events and the grants that
+// have already been announced.
+type expiries struct {
+	sync.Mutex
+	subscribers []chan *ExpiryEvent
+	// announced maps the grants to their expiry, so that every grant is
+	// only announced once by a running conode.
+	announced map[string]int64
+}
+
+// SetExpiryWebhook sets the URL to which this conode posts every
+// ExpiryEvent as JSON. An empty URL stops the posts. Only the conodes with
+// a webhook post the events, so it is usually set on one conode.
+func (s *Service) SetExpiryWebhook(url string) {
+	s.saveMutex.Lock()
+	s.Storage.ExpiryWebhook = url
+	s.saveMutex.Unlock()
+	s.save()
+}
+
+// SubscribeExpiries returns a channel that receives the ExpiryEvents found
+// by this conode, for example to store them in a skipchain. The returned
+// function removes the subscription and closes the channel. If the receiver
+// doesn't keep up, events are dropped for this subscriber.
+func (s *Service) SubscribeExpiries() (<-chan *ExpiryEvent, func()) {
+	ch := make(chan *ExpiryEvent, subscriberBuffer)
+	s.expiries.Lock()
+	defer s.expiries.Unlock()
+	s.expiries.subscribers = append(s.expiries.subscribers, ch)
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.expiries.Lock()
+			defer s.expiries.Unlock()
+			subs := s.expiries.subscribers
+			for i, sub := range subs {
+				if sub == ch {
+					s.expiries.subscribers = append(subs[:i], subs[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}
+}
+
+// watchExpiries periodically announces the read grants expiring within
+// expiryNotice.
+func (s *Service) watchExpiries() {
+	for range time.Tick(expiryInterval) {
+		for _, ev := range s.findExpiries(time.Now()) {
+			s.announceExpiry(ev)
+		}
+	}
+}
+
+// findExpiries returns the read grants of the latest versions of the darcs
+// that expire between now and now + expiryNotice, and that have not been
+// announced yet. Grants that expired are forgotten.
+func (s *Service) findExpiries(now time.Time) []*ExpiryEvent {
+	var latest []*darc.Darc
+	s.saveMutex.Lock()
+	for _, darcs := range s.Storage.Accounts {
+		if len(darcs.Darcs) > 0 {
+			latest = append(latest, darcs.Darcs[len(darcs.Darcs)-1])
+		}
+	}
+	s.saveMutex.Unlock()
+
+	s.expiries.Lock()
+	defer s.expiries.Unlock()
+	if s.expiries.announced == nil {
+		s.expiries.announced = make(map[string]int64)
+	}
+	for key, expires := range s.expiries.announced {
+		if expires < now.Unix() {
+			delete(s.expiries.announced, key)
+		}
+	}
+	var events []*ExpiryEvent
+	for _, d := range latest {
+		if d.Users == nil {
+			continue
+		}
+		for _, id := range *d.Users {
+			v := id.Validity
+			if v == nil || v.NotAfter == 0 || v.NotAfter < now.Unix() ||
+				v.NotAfter > now.Add(expiryNotice).Unix() {
+				continue
+			}
+			ev := &ExpiryEvent{
+				BaseID:   d.GetBaseID(),
+				Version:  d.Version,
+				Identity: id.PolicyString(),
+				Expires:  v.NotAfter,
+			}
+			key := fmt.Sprintf("%x/%s", []byte(ev.BaseID), ev.Identity)
+			if _, ok := s.expiries.announced[key]; ok {
+				continue
+			}
+			s.expiries.announced[key] = ev.Expires
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// announceExpiry sends the event to the subscribers and to the webhook.
+func (s *Service) announceExpiry(ev *ExpiryEvent) {
+	log.Lvlf2("Read grant of %s in darc %x expires at %d", ev.Identity,
+		[]byte(ev.BaseID), ev.Expires)
+	s.expiries.Lock()
+	for _, ch := range s.expiries.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			log.Warn("Subscriber for expiries is too slow - dropping event")
+		}
+	}
+	s.expiries.Unlock()
+
+	s.saveMutex.Lock()
+	url := s.Storage.ExpiryWebhook
+	s.saveMutex.Unlock()
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Error("Couldn't post expiry event:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Error("Webhook refused expiry event:", resp.Status)
+	}
+}
@@ -12,7 +12,11 @@ runs on the node.
 */
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -58,6 +62,92 @@ type Service struct {
 	Storage   *Storage
 	// big bad global lock
 	process sync.Mutex
+	// subscribeMutex protects access to the subscribers field.
+	subscribeMutex sync.Mutex
+	subscribers    map[string][]chan *darc.Darc
+	// reencryptions holds the recent re-encryptions of DecryptKeyRequest.
+	reencryptions reencryptCache
+	// verifyStats counts the verifications of darc signatures.
+	verifyStats *darc.VerifyStats
+	// expiries announces the read grants that expire soon.
+	expiries expiries
+}
+
+// subscriberBuffer is the number of darcs a subscriber can lag behind
+// before new darcs are dropped for that subscriber.
+const subscriberBuffer = 16
+
+// reencryptCacheTTL is how long a re-encryption is kept in the cache.
+var reencryptCacheTTL = 10 * time.Minute
+
+// reencryptCacheSize is the maximum number of re-encryptions in the cache.
+const reencryptCacheSize = 1000
+
+// reencryption is the result of the OCS-protocol for a reader.
+type reencryption struct {
+	Cs      []kyber.Point
+	XhatEnc kyber.Point
+	X       kyber.Point
+	expires time.Time
+}
+
+// reencryptCache holds the re-encryptions of the symmetric keys of the
+// writes, so that a reader asking again for a key doesn't need to start
+// the OCS-protocol. The re-encryption is only useful to the holder of the
+// private key of the reader.
+type reencryptCache struct {
+	sync.Mutex
+	entries map[string]*reencryption
+	hits    int
+	misses  int
+}
+
+func (rc *reencryptCache) get(key string) *reencryption {
+	rc.Lock()
+	defer rc.Unlock()
+	r := rc.entries[key]
+	if r != nil && time.Now().After(r.expires) {
+		delete(rc.entries, key)
+		r = nil
+	}
+	if r == nil {
+		rc.misses++
+		return nil
+	}
+	rc.hits++
+	return r
+}
+
+// status returns the size and the hit rate of the cache.
+func (rc *reencryptCache) status() map[string]string {
+	rc.Lock()
+	defer rc.Unlock()
+	return map[string]string{
+		"CacheEntries": strconv.Itoa(len(rc.entries)),
+		"CacheHits":    strconv.Itoa(rc.hits),
+		"CacheMisses":  strconv.Itoa(rc.misses),
+	}
+}
+
+func (rc *reencryptCache) put(key string, r *reencryption) {
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.entries == nil {
+		rc.entries = make(map[string]*reencryption)
+	}
+	now := time.Now()
+	if len(rc.entries) >= reencryptCacheSize {
+		for k, e := range rc.entries {
+			if now.After(e.expires) {
+				delete(rc.entries, k)
+			}
+		}
+	}
+	if len(rc.entries) >= reencryptCacheSize {
+		return
+	}
+	r.expires = now.Add(reencryptCacheTTL)
+	rc.entries[key] = r
 }
 
 // pubPoly is a serializaable version of share.PubPoly
@@ -72,6 +162,11 @@ type Storage struct {
 	Shared   map[string]*protocol.SharedSecret
 	Polys    map[string]*pubPoly
 	Admins   map[string]*darc.Darc
+	// MaxPayload is the maximum size of the data of a write or a chunk,
+	// or 0 for defaultMaxPayload.
+	MaxPayload int
+	// ExpiryWebhook is the URL receiving the ExpiryEvents, if any.
+	ExpiryWebhook string
 }
 
 // Darcs holds a series of darcs in increasing, succeeding version numbers.
@@ -86,8 +181,26 @@ type vData struct {
 	SB        skipchain.SkipBlockID
 	Ephemeral kyber.Point
 	Signature *darc.Signature
+	Rotation  *rotationData
 }
 
+// rotationData is sent instead of a read-request when a write is
+// re-encrypted during a rotation, see RotateKey. The write is re-encrypted
+// under Y = s * X, where X is the new shared key. T and Z prove the knowledge
+// of s, so that Y cannot be a key whose private part is known.
+type rotationData struct {
+	Index     int
+	Roster    onet.Roster
+	Signature darc.Signature
+	X         kyber.Point
+	T         kyber.Point
+	Z         kyber.Scalar
+}
+
+// pendingSuffix is appended to the skipchain-id to store the shared secret of
+// a DKG for a rotation until the rotation is stored on the skipchain.
+const pendingSuffix = "/pending"
+
 // CreateSkipchains sets up a new OCS-skipchain.
 func (s *Service) CreateSkipchains(req *CreateSkipchainsRequest) (reply *CreateSkipchainsReply,
 	err error) {
@@ -127,38 +240,53 @@ func (s *Service) CreateSkipchains(req *CreateSkipchainsRequest) (reply *CreateS
 	}
 
 	// Do DKG on the nodes
-	tree := req.Roster.GenerateNaryTreeWithRoot(len(req.Roster.List), s.ServerIdentity())
+	shared, poly, err := s.setupDKG(&req.Roster, reply.OCS.Hash)
+	if err != nil {
+		return nil, err
+	}
+	s.saveMutex.Lock()
+	s.Storage.Shared[string(reply.OCS.Hash)] = shared
+	s.Storage.Polys[string(reply.OCS.Hash)] = poly
+	s.saveMutex.Unlock()
+	reply.X = shared.X
+
+	s.save()
+	return
+}
+
+// setupDKG runs the DKG-protocol on the roster and returns the shared secret
+// of this node together with the public polynomial. The other nodes store
+// their shared secret under the given id.
+func (s *Service) setupDKG(roster *onet.Roster, id []byte) (*protocol.SharedSecret, *pubPoly, error) {
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List), s.ServerIdentity())
+	if tree == nil {
+		return nil, nil, errors.New("this node is not in the roster")
+	}
 	pi, err := s.CreateProtocol(protocol.NameDKG, tree)
+	if err != nil {
+		return nil, nil, err
+	}
 	setupDKG := pi.(*protocol.SetupDKG)
 	setupDKG.Wait = true
-	setupDKG.SetConfig(&onet.GenericConfig{Data: reply.OCS.Hash})
-	//log.Lvl2(s.ServerIdentity(), reply.OCS.Hash)
+	setupDKG.SetConfig(&onet.GenericConfig{Data: id})
 	if err := pi.Start(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	log.Lvl3("Started DKG-protocol - waiting for done", len(req.Roster.List))
+	log.Lvl3("Started DKG-protocol - waiting for done", len(roster.List))
 	select {
 	case <-setupDKG.SetupDone:
 		shared, err := setupDKG.SharedSecret()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		s.saveMutex.Lock()
-		s.Storage.Shared[string(reply.OCS.Hash)] = shared
 		dks, err := setupDKG.DKG.DistKeyShare()
 		if err != nil {
-			s.saveMutex.Unlock()
-			return nil, err
+			return nil, nil, err
 		}
-		s.Storage.Polys[string(reply.OCS.Hash)] = &pubPoly{s.Suite().Point().Base(), dks.Commits}
-		s.saveMutex.Unlock()
-		reply.X = shared.X
+		return shared, &pubPoly{s.Suite().Point().Base(), dks.Commits}, nil
 	case <-time.After(propagationTimeout):
-		return nil, errors.New("dkg didn't finish in time")
+		return nil, nil, errors.New("dkg didn't finish in time")
 	}
-
-	s.save()
-	return
 }
 
 // UpdateDarc adds a new account or modifies an existing one.
@@ -250,6 +378,63 @@ func (s *Service) WriteRequest(req *WriteRequest) (reply *WriteReply,
 	return
 }
 
+// maxWriteBatch is the maximum number of write-requests in a batch.
+const maxWriteBatch = 1000
+
+// WriteBatchRequest adds one block to the OCS-skipchain with all the
+// write-requests of the batch.
+func (s *Service) WriteBatchRequest(req *WriteBatchRequest) (reply *WriteBatchReply,
+	err error) {
+	s.process.Lock()
+	defer s.process.Unlock()
+	log.Lvlf2("Write batch of %d on skipchain %x", len(req.Writes), req.OCS)
+	if len(req.Writes) == 0 || len(req.Writes) > maxWriteBatch {
+		return nil, errors.New("invalid number of writes in batch")
+	}
+	reply = &WriteBatchReply{}
+	latestSB, err := s.db().GetLatest(s.db().GetByID(req.OCS))
+	if err != nil {
+		return nil, errors.New("didn't find latest block: " + err.Error())
+	}
+	dataOCS := &Transaction{
+		Timestamp: time.Now().Unix(),
+	}
+	for i := range req.Writes {
+		w := &req.Writes[i]
+		if req.Readers != nil {
+			w.Reader = *req.Readers
+		}
+		w.Signature = nil
+		dataOCS.Writes = append(dataOCS.Writes, w)
+	}
+	dataOCS.Writes[0].Signature = &req.Signature
+	reader := dataOCS.Writes[0].Reader
+	if s.getDarc(reader.GetID()) == nil {
+		// Only set up the reader darc for storage if it is not already known.
+		dataOCS.Darc = &reader
+	}
+	if err := s.verifyWrites(req.OCS, dataOCS.Writes); err != nil {
+		return nil, errors.New("write-verification failed: " + err.Error())
+	}
+	data, err := protobuf.Encode(dataOCS)
+	if err != nil {
+		return nil, err
+	}
+	reply.SB, err = s.storeSkipBlock(latestSB, data)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := s.propagateOCS(reply.SB.Roster, reply.SB, propagationTimeout)
+	if err != nil {
+		return
+	}
+	if replies != len(reply.SB.Roster.List) {
+		log.Warn("Got only", replies, "replies for write-propagation")
+	}
+	return
+}
+
 // ReadRequest asks for a read-offer on the skipchain for a reader on a file.
 func (s *Service) ReadRequest(req *ReadRequest) (reply *ReadReply,
 	err error) {
@@ -333,7 +518,9 @@ func (s *Service) GetLatestDarc(req *GetLatestDarc) (reply *GetLatestDarcReply,
 	return
 }
 
-// GetReadRequests returns up to a maximum number of read-requests.
+// GetReadRequests returns up to a maximum number of read-requests. If
+// req.Count is 0, req.Start must be a write-request and all the read-requests
+// for it are returned, so that its owner can audit who accessed it.
 func (s *Service) GetReadRequests(req *GetReadRequests) (reply *GetReadRequestsReply, err error) {
 	reply = &GetReadRequestsReply{}
 	current := s.db().GetByID(req.Start)
@@ -345,7 +532,7 @@ func (s *Service) GetReadRequests(req *GetReadRequests) (reply *GetReadRequestsR
 	var doc skipchain.SkipBlockID
 	if req.Count == 0 {
 		dataOCS := NewOCS(current.Data)
-		if dataOCS == nil || dataOCS.Write == nil {
+		if dataOCS == nil || dataOCS.WriteAt(0) == nil {
 			log.Error("Didn't find this writeID")
 			return nil, errors.New(
 				"id is not a writer-block")
@@ -365,9 +552,11 @@ func (s *Service) GetReadRequests(req *GetReadRequests) (reply *GetReadRequestsR
 			if dataOCS.Read != nil {
 				if req.Count > 0 || dataOCS.Read.DataID.Equal(doc) {
 					doc := &ReadDoc{
-						Reader: dataOCS.Read.Signature.SignaturePath.Signer,
-						ReadID: current.Hash,
-						DataID: dataOCS.Read.DataID,
+						Reader:    dataOCS.Read.Signature.SignaturePath.Signer,
+						ReadID:    current.Hash,
+						DataID:    dataOCS.Read.DataID,
+						Index:     dataOCS.Read.Index,
+						Timestamp: dataOCS.Timestamp,
 					}
 					log.Lvl2("Found read-request from", doc.Reader)
 					reply.Documents = append(reply.Documents, doc)
@@ -397,7 +586,7 @@ func (s *Service) SharedPublic(req *SharedPublicRequest) (reply *SharedPublicRep
 	if !ok {
 		return nil, errors.New("didn't find this skipchain")
 	}
-	return &SharedPublicReply{X: shared.X}, nil
+	return &SharedPublicReply{X: shared.X, MaxPayload: s.maxPayload()}, nil
 }
 
 // DecryptKeyRequest re-encrypts the stored symmetric key under the public
@@ -418,42 +607,79 @@ func (s *Service) DecryptKeyRequest(req *DecryptKeyRequest) (reply *DecryptKeyRe
 		return nil, errors.New("didn't find that block")
 	}
 	file := NewOCS(fileSB.Data)
-	if file == nil || file.Write == nil {
+	if file == nil || file.WriteAt(read.Read.Index) == nil {
 		return nil, errors.New("Data-block is broken")
 	}
-
-	// Start OCS-protocol to re-encrypt the file's symmetric key under the
-	// reader's public key.
-	nodes := len(fileSB.Roster.List)
-	threshold := nodes - (nodes-1)/3
-	tree := fileSB.Roster.GenerateNaryTreeWithRoot(nodes, s.ServerIdentity())
-	pi, err := s.CreateProtocol(protocol.NameOCS, tree)
+	write := file.WriteAt(read.Read.Index)
+	if err = s.verifyReadGrant(read.Read, time.Now()); err != nil {
+		return nil, err
+	}
+	// The key might have been re-encrypted to a new roster.
+	current, err := s.currentWrite(fileSB, read.Read.Index)
 	if err != nil {
 		return nil, err
 	}
-	ocsProto := pi.(*protocol.OCS)
-	ocsProto.U = file.Write.U
+	latestSB, err := s.db().GetLatest(fileSB)
+	if err != nil {
+		return nil, errors.New("didn't find latest block: " + err.Error())
+	}
+
 	verificationData := &vData{
 		SB: readSB.Hash,
 	}
-	if req.Ephemeral != nil {
+	var xc kyber.Point
+	if read.Read.Anonymous != nil {
+		// The ephemeral key is covered by the signature of the read.
+		xc = read.Read.Anonymous.Ephemeral
+	} else if req.Ephemeral != nil {
 		var pub []byte
 		pub, err = req.Ephemeral.MarshalBinary()
 		if err != nil {
 			return nil, errors.New("couldn't marshal ephemeral key")
 		}
-		if err = req.Signature.Verify(pub, &file.Write.Reader); err != nil {
+		if err = req.Signature.CheckContext([]byte(ServiceName)); err != nil {
+			return nil, err
+		}
+		if err = req.Signature.Verify(pub, &write.Reader); err != nil {
 			return nil, errors.New("wrong signature")
 		}
-		ocsProto.Xc = req.Ephemeral
+		xc = req.Ephemeral
 		verificationData.Ephemeral = req.Ephemeral
 		verificationData.Signature = req.Signature
 	} else if read.Read.Signature.SignaturePath.Signer.Ed25519 == nil {
 		return nil, errors.New("please use ephemeral keys for non-ed25519 private keys")
 	} else {
-		ocsProto.Xc = read.Read.Signature.SignaturePath.Signer.Ed25519.Point
+		xc = read.Read.Signature.SignaturePath.Signer.Ed25519.Point
 	}
-	log.Lvlf2("Public key is: %s", ocsProto.Xc)
+	log.Lvlf2("Public key is: %s", xc)
+
+	// The same reader asking again for the same key gets the re-encryption
+	// from the cache. As U changes in a rotation, the key of the cache
+	// changes, too.
+	cacheKey, err := reencryptionKey(current, xc)
+	if err != nil {
+		return nil, err
+	}
+	if r := s.reencryptions.get(cacheKey); r != nil {
+		log.Lvl2("Re-encryption found in cache")
+		return &DecryptKeyReply{Cs: r.Cs, XhatEnc: r.XhatEnc, X: r.X}, nil
+	}
+
+	// Start OCS-protocol to re-encrypt the file's symmetric key under the
+	// reader's public key.
+	nodes := len(latestSB.Roster.List)
+	threshold := nodes - (nodes-1)/3
+	tree := latestSB.Roster.GenerateNaryTreeWithRoot(nodes, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("this node is not in the roster")
+	}
+	pi, err := s.CreateProtocol(protocol.NameOCS, tree)
+	if err != nil {
+		return nil, err
+	}
+	ocsProto := pi.(*protocol.OCS)
+	ocsProto.U = current.U
+	ocsProto.Xc = xc
 	ocsProto.VerificationData, err = network.Marshal(verificationData)
 	if err != nil {
 		return nil, errors.New("couldn't marshal verificationdata: " + err.Error())
@@ -486,13 +712,283 @@ func (s *Service) DecryptKeyRequest(req *DecryptKeyRequest) (reply *DecryptKeyRe
 	if err != nil {
 		return nil, err
 	}
-	reply.Cs = file.Write.Cs
+	reply.Cs = current.Cs
+	s.reencryptions.put(cacheKey, &reencryption{
+		Cs:      reply.Cs,
+		XhatEnc: reply.XhatEnc,
+		X:       reply.X,
+	})
 	return
 }
 
+// reencryptionKey returns the key in the cache of re-encryptions of the
+// write for the reader's public key xc.
+func reencryptionKey(w *Rewrite, xc kyber.Point) (string, error) {
+	u, err := w.U.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	x, err := xc.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return string(w.WriteID) + ":" + strconv.Itoa(w.Index) + ":" + string(u) + ":" + string(x), nil
+}
+
+// RotateKey runs a new DKG on the roster of the request, re-encrypts the keys
+// of all writes to the new shared key, and stores them in a new block that
+// changes the roster of the OCS-skipchain. The re-encryption is done by the
+// current roster with the OCS-protocol, so the symmetric keys are never
+// revealed. The nodes leaving the roster delete their shared secret once the
+// rotation is stored.
+//
+// The nodes check the re-encryption proofs of each other, but the other
+// nodes have to trust this node to combine them correctly.
+func (s *Service) RotateKey(req *RotateKeyRequest) (reply *RotateKeyReply, err error) {
+	s.process.Lock()
+	defer s.process.Unlock()
+	log.Lvlf2("Rotating key of skipchain %x", req.OCS)
+	if err := s.verifyRotationSignature(req.OCS, &req.Roster, req.Signature); err != nil {
+		return nil, errors.New("rotation-verification failed: " + err.Error())
+	}
+	latestSB, err := s.db().GetLatest(s.db().GetByID(req.OCS))
+	if err != nil {
+		return nil, errors.New("didn't find latest block: " + err.Error())
+	}
+	if i, _ := latestSB.Roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("this node is not in the current roster")
+	}
+	writes, err := s.currentWrites(req.OCS)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := string(req.OCS) + pendingSuffix
+	shared, poly, err := s.setupDKG(&req.Roster, []byte(pending))
+	if err != nil {
+		return nil, err
+	}
+	s.saveMutex.Lock()
+	s.Storage.Shared[pending] = shared
+	s.Storage.Polys[pending] = poly
+	s.saveMutex.Unlock()
+
+	rotation := &Rotation{
+		X:         shared.X,
+		Signature: req.Signature,
+	}
+	for _, w := range writes {
+		rw, err := s.reencryptWrite(latestSB, req, w, shared.X)
+		if err != nil {
+			return nil, errors.New("couldn't re-encrypt write: " + err.Error())
+		}
+		rotation.Writes = append(rotation.Writes, rw)
+	}
+	data, err := protobuf.Encode(&Transaction{
+		Rotation:  rotation,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply = &RotateKeyReply{X: shared.X}
+	reply.SB, err = s.storeRosterBlock(latestSB, &req.Roster, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nodes leaving the roster need the block, too, to delete their
+	// shared secret.
+	list := append([]*network.ServerIdentity{}, req.Roster.List...)
+	for _, si := range latestSB.Roster.List {
+		if i, _ := req.Roster.Search(si.ID); i < 0 {
+			list = append(list, si)
+		}
+	}
+	replies, err := s.propagateOCS(onet.NewRoster(list), reply.SB, propagationTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if replies != len(list) {
+		log.Warn("Got only", replies, "replies for rotation-propagation")
+	}
+	return reply, nil
+}
+
+// reencryptWrite uses the OCS-protocol on the roster of latest to encrypt the
+// key of the write to the shared key X of a rotation. The protocol returns
+// W = x(U + Y), where x is the current shared secret and Y = s * X for a
+// random s. Then U' = -s * X_old and C' = C - W decrypt to the same key with
+// the new shared secret x', as x' * U' = -s * x * X.
+func (s *Service) reencryptWrite(latest *skipchain.SkipBlock, req *RotateKeyRequest,
+	w *Rewrite, X kyber.Point) (*Rewrite, error) {
+	suite := cothority.Suite
+	secret := suite.Scalar().Pick(suite.RandomStream())
+	Y := suite.Point().Mul(secret, X)
+	t := suite.Scalar().Pick(suite.RandomStream())
+	rd := &rotationData{
+		Roster:    req.Roster,
+		Signature: req.Signature,
+		X:         X,
+		T:         suite.Point().Mul(t, X),
+	}
+	rd.Index = w.Index
+	e := rotationChallenge(X, Y, rd.T, w.WriteID, w.Index)
+	rd.Z = suite.Scalar().Add(t, suite.Scalar().Mul(e, secret))
+
+	nodes := len(latest.Roster.List)
+	threshold := nodes - (nodes-1)/3
+	tree := latest.Roster.GenerateNaryTreeWithRoot(nodes, s.ServerIdentity())
+	pi, err := s.CreateProtocol(protocol.NameOCS, tree)
+	if err != nil {
+		return nil, err
+	}
+	ocsProto := pi.(*protocol.OCS)
+	ocsProto.U = w.U
+	ocsProto.Xc = Y
+	ocsProto.VerificationData, err = network.Marshal(&vData{
+		SB:       w.WriteID,
+		Rotation: rd,
+	})
+	if err != nil {
+		return nil, errors.New("couldn't marshal verificationdata: " + err.Error())
+	}
+
+	s.saveMutex.Lock()
+	ocsProto.Shared = s.Storage.Shared[string(latest.SkipChainID())]
+	pp := s.Storage.Polys[string(latest.SkipChainID())]
+	if ocsProto.Shared == nil || pp == nil {
+		s.saveMutex.Unlock()
+		return nil, errors.New("didn't find shared secret of skipchain")
+	}
+	oldX := ocsProto.Shared.X.Clone()
+	var commits []kyber.Point
+	for _, c := range pp.Commits {
+		commits = append(commits, c.Clone())
+	}
+	ocsProto.Poly = share.NewPubPoly(s.Suite(), pp.B.Clone(), commits)
+	s.saveMutex.Unlock()
+
+	ocsProto.SetConfig(&onet.GenericConfig{Data: latest.SkipChainID()})
+	if err := ocsProto.Start(); err != nil {
+		return nil, err
+	}
+	if !<-ocsProto.Reencrypted {
+		return nil, errors.New("reencryption got refused")
+	}
+	W, err := share.RecoverCommit(suite, ocsProto.Uis, threshold, nodes)
+	if err != nil {
+		return nil, err
+	}
+	rw := &Rewrite{
+		WriteID: w.WriteID,
+		Index:   w.Index,
+		U:       suite.Point().Mul(suite.Scalar().Neg(secret), oldX),
+	}
+	for _, c := range w.Cs {
+		rw.Cs = append(rw.Cs, suite.Point().Sub(c, W))
+	}
+	return rw, nil
+}
+
+// rotationChallenge returns the challenge of the proof that the
+// re-encryption key Y of a write is a multiple of the new shared key X.
+func rotationChallenge(X, Y, T kyber.Point, writeID skipchain.SkipBlockID, index int) kyber.Scalar {
+	hash := sha256.New()
+	X.MarshalTo(hash)
+	Y.MarshalTo(hash)
+	T.MarshalTo(hash)
+	hash.Write(writeID)
+	binary.Write(hash, binary.LittleEndian, int64(index))
+	return cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
+}
+
+// currentWrite returns the encrypted key of the write with the given index in
+// the block, as re-encrypted by the latest rotation.
+func (s *Service) currentWrite(writeSB *skipchain.SkipBlock, index int) (*Rewrite, error) {
+	dataOCS := NewOCS(writeSB.Data)
+	if dataOCS == nil || dataOCS.WriteAt(index) == nil {
+		return nil, errors.New("block was not a write-block")
+	}
+	write := dataOCS.WriteAt(index)
+	current := &Rewrite{
+		WriteID: writeSB.Hash,
+		Index:   index,
+		U:       write.U,
+		Cs:      write.Cs,
+	}
+	sb := writeSB
+	for len(sb.ForwardLink) > 0 {
+		sb = s.db().GetByID(sb.ForwardLink[0].To)
+		if sb == nil {
+			return nil, errors.New("didn't find block for this forward-link")
+		}
+		dataOCS := NewOCS(sb.Data)
+		if dataOCS == nil || dataOCS.Rotation == nil {
+			continue
+		}
+		for _, rw := range dataOCS.Rotation.Writes {
+			if rw.WriteID.Equal(writeSB.Hash) && rw.Index == index {
+				current = rw
+				break
+			}
+		}
+	}
+	return current, nil
+}
+
+// currentWrites returns the encrypted keys of all writes of the skipchain, as
+// re-encrypted by the latest rotation.
+func (s *Service) currentWrites(ocs skipchain.SkipBlockID) ([]*Rewrite, error) {
+	var writes []*Rewrite
+	// positions maps the id and index of a write to its position in writes.
+	positions := map[string]int{}
+	key := func(id skipchain.SkipBlockID, index int) string {
+		return string(id) + ":" + strconv.Itoa(index)
+	}
+	sb := s.db().GetByID(ocs)
+	for sb != nil {
+		dataOCS := NewOCS(sb.Data)
+		if dataOCS == nil {
+			return nil, errors.New("unknown block in ocs-skipchain")
+		}
+		for i := 0; dataOCS.WriteAt(i) != nil; i++ {
+			w := dataOCS.WriteAt(i)
+			positions[key(sb.Hash, i)] = len(writes)
+			writes = append(writes, &Rewrite{
+				WriteID: sb.Hash,
+				Index:   i,
+				U:       w.U,
+				Cs:      w.Cs,
+			})
+		}
+		if dataOCS.Rotation != nil {
+			for _, rw := range dataOCS.Rotation.Writes {
+				if i, ok := positions[key(rw.WriteID, rw.Index)]; ok {
+					writes[i] = rw
+				}
+			}
+		}
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		sb = s.db().GetByID(sb.ForwardLink[0].To)
+	}
+	if sb == nil {
+		return nil, errors.New("didn't find block for this forward-link")
+	}
+	return writes, nil
+}
+
 // storeSkipBlock calls directly the method of the service.
 func (s *Service) storeSkipBlock(latest *skipchain.SkipBlock, d []byte) (sb *skipchain.SkipBlock, err error) {
+	return s.storeRosterBlock(latest, latest.Roster, d)
+}
+
+// storeRosterBlock stores a new block with the given roster.
+func (s *Service) storeRosterBlock(latest *skipchain.SkipBlock, roster *onet.Roster, d []byte) (sb *skipchain.SkipBlock, err error) {
 	block := latest.Copy()
+	block.Roster = roster
 	block.Data = d
 	block.GenesisID = block.SkipChainID()
 	block.Index++
@@ -565,6 +1061,9 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 		if sb == nil {
 			return errors.New("received reencryption request with empty block")
 		}
+		if verificationData.Rotation != nil {
+			return s.verifyRotationReencryption(rc, sb, verificationData.Rotation)
+		}
 		o := NewOCS(sb.Data)
 		if o == nil {
 			return errors.New("not an OCS-data block")
@@ -572,7 +1071,14 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 		if o.Read == nil {
 			return errors.New("not an OCS-read block")
 		}
-		if verificationData.Ephemeral != nil {
+		if err := s.verifyReadGrant(o.Read, time.Now()); err != nil {
+			return err
+		}
+		if o.Read.Anonymous != nil {
+			if !o.Read.Anonymous.Ephemeral.Equal(rc.Xc) {
+				return errors.New("wrong ephemeral key")
+			}
+		} else if verificationData.Ephemeral != nil {
 			buf, err := verificationData.Ephemeral.MarshalBinary()
 			if err != nil {
 				return errors.New("couldn't marshal ephemeral key: " + err.Error())
@@ -583,6 +1089,9 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 				&verificationData.Signature.SignaturePath.Signer) {
 				return errors.New("ephemeral key signed by wrong reader")
 			}
+			if err := verificationData.Signature.CheckContext([]byte(ServiceName)); err != nil {
+				return err
+			}
 			if err := verificationData.Signature.Verify(buf, darc); err != nil {
 				return errors.New("wrong signature on ephemeral key: " + err.Error())
 			}
@@ -603,6 +1112,83 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 	return true
 }
 
+// verifyRotationReencryption makes sure that the re-encryption of a write
+// during a rotation is signed by an admin, is done on the current key of the
+// write, and that Xc is a multiple of the new shared key.
+func (s *Service) verifyRotationReencryption(rc *protocol.Reencrypt, writeSB *skipchain.SkipBlock, rd *rotationData) error {
+	if err := s.verifyRotationSignature(writeSB.SkipChainID(), &rd.Roster, rd.Signature); err != nil {
+		return err
+	}
+	current, err := s.currentWrite(writeSB, rd.Index)
+	if err != nil {
+		return err
+	}
+	if !current.U.Equal(rc.U) {
+		return errors.New("not the current key of the write")
+	}
+	e := rotationChallenge(rd.X, rc.Xc, rd.T, writeSB.Hash, rd.Index)
+	zX := cothority.Suite.Point().Mul(rd.Z, rd.X)
+	eY := cothority.Suite.Point().Mul(e, rc.Xc)
+	if !zX.Equal(cothority.Suite.Point().Add(rd.T, eY)) {
+		return errors.New("wrong proof of re-encryption key")
+	}
+	return s.verifyPendingKey(writeSB.SkipChainID(), &rd.Roster, rd.X)
+}
+
+// verifyRotationSignature checks that an owner of the admin darc of the
+// OCS-skipchain signed the rotation to the roster.
+func (s *Service) verifyRotationSignature(ocs skipchain.SkipBlockID, roster *onet.Roster, sig darc.Signature) error {
+	s.saveMutex.Lock()
+	admin := s.Storage.Admins[string(ocs)]
+	s.saveMutex.Unlock()
+	if admin == nil {
+		return errors.New("couldn't find admin for this chain")
+	}
+	return s.verifySignature(RotateKeyMessage(ocs, roster), sig, *admin, darc.Owner)
+}
+
+// verifyPendingKey makes sure that X is the key of the DKG this node took
+// part in, if it is in the new roster. Nodes leaving the roster cannot check
+// the new key.
+func (s *Service) verifyPendingKey(ocs skipchain.SkipBlockID, roster *onet.Roster, X kyber.Point) error {
+	if i, _ := roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil
+	}
+	s.saveMutex.Lock()
+	pending := s.Storage.Shared[string(ocs)+pendingSuffix]
+	s.saveMutex.Unlock()
+	if pending == nil {
+		return errors.New("didn't take part in the DKG of the rotation")
+	}
+	if !pending.X.Equal(X) {
+		return errors.New("wrong shared key in rotation")
+	}
+	return nil
+}
+
+// rotateShared replaces the shared secret of the skipchain with the one of
+// the DKG of the rotation, or deletes it if this node left the roster.
+func (s *Service) rotateShared(sb *skipchain.SkipBlock) {
+	key := string(sb.SkipChainID())
+	pending := key + pendingSuffix
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	shared := s.Storage.Shared[pending]
+	if i, _ := sb.Roster.Search(s.ServerIdentity().ID); i >= 0 && shared != nil {
+		log.Lvlf2("%s: rotating to new shared key of %x", s.ServerIdentity(), sb.SkipChainID())
+		s.Storage.Shared[key] = shared
+		if poly := s.Storage.Polys[pending]; poly != nil {
+			s.Storage.Polys[key] = poly
+		}
+	} else {
+		log.Lvlf2("%s: left the roster of %x", s.ServerIdentity(), sb.SkipChainID())
+		delete(s.Storage.Shared, key)
+		delete(s.Storage.Polys, key)
+	}
+	delete(s.Storage.Shared, pending)
+	delete(s.Storage.Polys, pending)
+}
+
 func (s *Service) verifyOCS(newID []byte, sb *skipchain.SkipBlock) bool {
 	log.Lvlf3("%s: Verifying ocs for block %x", s.ServerIdentity(), sb.Hash)
 	dataOCS := NewOCS(sb.Data)
@@ -629,17 +1215,43 @@ func (s *Service) verifyOCS(newID []byte, sb *skipchain.SkipBlock) bool {
 		}
 	}
 	if dataOCS.Write != nil {
+		if len(dataOCS.Writes) > 0 {
+			log.Error("transaction holds a write and a batch of writes")
+			return false
+		}
 		if err := s.verifyWrite(sb.SkipChainID(), dataOCS.Write); err != nil {
 			log.Error("verification of write request failed: " + err.Error())
 			return false
 		}
 	}
+	if len(dataOCS.Writes) > 0 {
+		if err := s.verifyWrites(sb.SkipChainID(), dataOCS.Writes); err != nil {
+			log.Error("verification of write batch failed: " + err.Error())
+			return false
+		}
+	}
+	if dataOCS.Chunk != nil {
+		if err := s.verifyChunk(sb.SkipChainID(), dataOCS.Chunk); err != nil {
+			log.Error("verification of chunk failed: " + err.Error())
+			return false
+		}
+	}
 	if dataOCS.Read != nil {
 		if err := s.verifyRead(dataOCS.Read); err != nil {
 			log.Error("verification of read request failed: " + err.Error())
 			return false
 		}
 	}
+	if r := dataOCS.Rotation; r != nil {
+		err := s.verifyRotationSignature(sb.SkipChainID(), sb.Roster, r.Signature)
+		if err == nil {
+			err = s.verifyPendingKey(sb.SkipChainID(), sb.Roster, r.X)
+		}
+		if err != nil {
+			log.Error("verification of rotation failed: " + err.Error())
+			return false
+		}
+	}
 	log.Lvl3("OCS verification succeeded")
 	return true
 }
@@ -657,23 +1269,102 @@ func (s *Service) verifyRead(read *Read) error {
 		return errors.New("Didn't find write-block")
 	}
 	wd := NewOCS(sbWrite.Data)
-	if wd == nil || wd.Write == nil {
+	if wd == nil || wd.WriteAt(read.Index) == nil {
 		return errors.New("block was not a write-block")
 	}
-	readers := wd.Write.Reader
+	readers := wd.WriteAt(read.Index).Reader
 	if s.getDarc(readers.GetID()) == nil {
 		return errors.New("couldn't find reader-darc in database")
 	}
+	if read.Anonymous != nil {
+		if err := read.Anonymous.Verify(read.DataID, read.Index); err != nil {
+			return errors.New("wrong anonymous signature: " + err.Error())
+		}
+		return s.verifyReadGrant(read, time.Now())
+	}
 	return s.verifySignature(read.DataID, read.Signature, readers, darc.User)
 }
 
+// verifyReadGrant makes sure that the reader of an accepted read request is
+// still allowed to read at the given time. The identities in the darcs can
+// have a Validity, so a reader might have lost access since the read request
+// has been stored. In that case ErrReadExpired is returned. For an anonymous
+// read, all members of the set have to be allowed to read.
+func (s *Service) verifyReadGrant(read *Read, when time.Time) error {
+	sbWrite := s.db().GetByID(read.DataID)
+	if sbWrite == nil {
+		return errors.New("Didn't find write-block")
+	}
+	wd := NewOCS(sbWrite.Data)
+	if wd == nil || wd.WriteAt(read.Index) == nil {
+		return errors.New("block was not a write-block")
+	}
+	readers := wd.WriteAt(read.Index).Reader
+	if read.Anonymous != nil {
+		for _, p := range read.Anonymous.Set {
+			if err := s.verifyReader(readers, *darc.NewIdentityEd25519(p), when); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	path := read.Signature.SignaturePath
+	if path.Darcs == nil {
+		return s.verifyReader(readers, path.Signer, when)
+	}
+	err := path.VerifyAt(darc.User, when)
+	if err == darc.ErrNotValid {
+		return ErrReadExpired
+	}
+	return err
+}
+
+// verifyReader searches a path from the readers to the signer, and makes sure
+// that it is valid at the given time.
+func (s *Service) verifyReader(readers darc.Darc, signer darc.Identity, when time.Time) error {
+	darcs := s.searchPath([]darc.Darc{readers}, signer, darc.User)
+	if darcs == nil {
+		return errors.New("didn't find a valid path from the write.Readers to the signer")
+	}
+	list := make([]*darc.Darc, len(darcs))
+	for i := range darcs {
+		list[i] = &darcs[i]
+	}
+	err := darc.NewSignaturePath(list, signer, darc.User).VerifyAt(darc.User, when)
+	if err == darc.ErrNotValid {
+		return ErrReadExpired
+	}
+	return err
+}
+
 // verifySignature handles both offline and online signatures. For offline
 // signatures, all darcs in the path must be stored in the SignaturePath.
 // For online signatures, the system will check itself if it finds a valid
 // path from the base darc to the signer.
 // If the signature is valid, nil is returned. Else an error is returned,
-// indicating what went wrong.
+// indicating what went wrong. All verifications are counted in the
+// statistics of the service. The signature has to be bound to the context
+// of the service.
 func (s *Service) verifySignature(msg []byte, sig darc.Signature, base darc.Darc, role darc.Role) error {
+	return s.checkSignature(msg, sig, base, role, []byte(ServiceName))
+}
+
+// checkSignature works like verifySignature, but only checks the context
+// of the signature if it is given.
+func (s *Service) checkSignature(msg []byte, sig darc.Signature, base darc.Darc, role darc.Role,
+	context []byte) (err error) {
+	ev := &darc.VerifyEvent{Role: role, SignerType: sig.SignaturePath.Signer.Type()}
+	start := time.Now()
+	defer func() {
+		ev.Duration = time.Since(start)
+		ev.Err = err
+		s.verifyStats.Add(ev)
+	}()
+	if context != nil {
+		if err = sig.CheckContext(context); err != nil {
+			return
+		}
+	}
 	if sig.SignaturePath.Darcs == nil {
 		log.Lvl3("Verifying online darc")
 		signer := sig.SignaturePath.Signer
@@ -681,16 +1372,18 @@ func (s *Service) verifySignature(msg []byte, sig darc.Signature, base darc.Darc
 		if path == nil {
 			return errors.New("didn't find a valid path from the write.Readers to the signer")
 		}
-		hash, err := sig.SignaturePath.SigHash(msg)
-		if err != nil {
-			return err
+		ev.PathLength = len(path)
+		var hash []byte
+		if hash, err = sig.Hash(msg); err != nil {
+			return
 		}
-		if err := signer.Verify(hash, sig.Signature); err != nil {
+		if err = signer.Verify(hash, sig.Signature); err != nil {
 			return errors.New("wrong online signature: " + err.Error())
 		}
 	} else {
 		log.Lvl3("Verifying offline darc")
-		if err := sig.Verify(msg, &base); err != nil {
+		ev.PathLength = len(*sig.SignaturePath.Darcs)
+		if err = sig.Verify(msg, &base); err != nil {
 			return errors.New("wrong offline signature: " + err.Error())
 		}
 	}
@@ -703,6 +1396,9 @@ func (s *Service) verifyWrite(ocs skipchain.SkipBlockID, write *Write) error {
 	if err := write.CheckProof(cothority.Suite, ocs); err != nil {
 		return errors.New("proof verification failed: " + err.Error())
 	}
+	if err := s.verifyPayload(ocs, write); err != nil {
+		return err
+	}
 	s.saveMutex.Lock()
 	log.Lvl3("Verifying write request")
 	defer s.saveMutex.Unlock()
@@ -713,6 +1409,30 @@ func (s *Service) verifyWrite(ocs skipchain.SkipBlockID, write *Write) error {
 	return s.verifySignature(write.Reader.GetID(), *write.Signature, *admin, darc.User)
 }
 
+// verifyWrites makes sure that all the write-requests of a batch have the
+// same reader darc and a valid proof, and that the first one is signed by a
+// valid writer.
+func (s *Service) verifyWrites(ocs skipchain.SkipBlockID, writes []*Write) error {
+	if len(writes) > maxWriteBatch {
+		return errors.New("too many writes in batch")
+	}
+	if writes[0].Signature == nil {
+		return errors.New("missing signature of the batch")
+	}
+	for _, w := range writes[1:] {
+		if !w.Reader.GetID().Equal(writes[0].Reader.GetID()) {
+			return errors.New("all writes of a batch need the same reader")
+		}
+		if err := w.CheckProof(cothority.Suite, ocs); err != nil {
+			return errors.New("proof verification failed: " + err.Error())
+		}
+		if err := s.verifyPayload(ocs, w); err != nil {
+			return err
+		}
+	}
+	return s.verifyWrite(ocs, writes[0])
+}
+
 // verifyDarc makes sure that the new darc is correctly signed from a previous
 // darc if it has a Version > 0.
 func (s *Service) verifyDarc(newDarc *darc.Darc) error {
@@ -730,7 +1450,9 @@ func (s *Service) verifyDarc(newDarc *darc.Darc) error {
 		}
 		return nil
 	}
-	return s.verifySignature(newDarc.GetID(), *newDarc.Signature, *latest, darc.Owner)
+	// The signature of an evolution is part of the darc, which is the same
+	// for all services, so it has no context.
+	return s.checkSignature(newDarc.GetID(), *newDarc.Signature, *latest, darc.Owner, nil)
 }
 
 func (s *Service) addDarc(d *darc.Darc) {
@@ -743,6 +1465,52 @@ func (s *Service) addDarc(d *darc.Darc) {
 	}
 	darcs.Darcs = append(darcs.Darcs, d)
 	s.Storage.Accounts[key] = darcs
+	s.notifySubscribers(key, d)
+}
+
+// SubscribeDarc returns a channel that receives every new version of the
+// darc with the given base-id stored by this service. The returned function
+// removes the subscription and closes the channel. If the receiver doesn't
+// keep up, new darcs are dropped for this subscriber.
+func (s *Service) SubscribeDarc(baseID darc.ID) (<-chan *darc.Darc, func()) {
+	key := string(baseID)
+	ch := make(chan *darc.Darc, subscriberBuffer)
+	s.subscribeMutex.Lock()
+	defer s.subscribeMutex.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[string][]chan *darc.Darc)
+	}
+	s.subscribers[key] = append(s.subscribers[key], ch)
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.subscribeMutex.Lock()
+			defer s.subscribeMutex.Unlock()
+			subs := s.subscribers[key]
+			for i, sub := range subs {
+				if sub == ch {
+					s.subscribers[key] = append(subs[:i], subs[i+1:]...)
+					break
+				}
+			}
+			if len(s.subscribers[key]) == 0 {
+				delete(s.subscribers, key)
+			}
+			close(ch)
+		})
+	}
+}
+
+func (s *Service) notifySubscribers(key string, d *darc.Darc) {
+	s.subscribeMutex.Lock()
+	defer s.subscribeMutex.Unlock()
+	for _, ch := range s.subscribers[key] {
+		select {
+		case ch <- d:
+		default:
+			log.Warn("Subscriber for darc is too slow - dropping update", d.GetBaseID())
+		}
+	}
 }
 
 func (s *Service) getDarc(id darc.ID) *darc.Darc {
@@ -846,11 +1614,10 @@ func (s *Service) propagateOCSFunc(sbI network.Message) {
 		log.Error("Got a skipblock without dataOCS - not storing")
 		return
 	}
-	if r := dataOCS.Darc; r != nil {
-		log.Lvlf3("Storing new darc %x - %x", r.GetID(), r.GetBaseID())
-		s.addDarc(r)
-	}
 	defer s.save()
+	if dataOCS.Rotation != nil {
+		s.rotateShared(sb)
+	}
 	if sb.Index == 0 {
 		s.saveMutex.Lock()
 		defer s.saveMutex.Unlock()
@@ -863,6 +1630,24 @@ func (s *Service) propagateOCSFunc(sbI network.Message) {
 	}
 }
 
+// appended is called by the skipchain service with every new block, and
+// stores the darcs of the blocks of the OCS skipchains.
+func (s *Service) appended(sb *skipchain.SkipBlock) {
+	isOCS := false
+	for _, v := range sb.VerifierIDs {
+		isOCS = isOCS || v == VerifyOCS
+	}
+	if !isOCS {
+		return
+	}
+	if dataOCS := NewOCS(sb.Data); dataOCS != nil && dataOCS.Darc != nil {
+		r := dataOCS.Darc
+		log.Lvlf3("Storing new darc %x - %x", r.GetID(), r.GetBaseID())
+		s.addDarc(r)
+		s.save()
+	}
+}
+
 func (s *Service) db() *skipchain.SkipBlockDB {
 	return s.skipchain.GetDB()
 }
@@ -916,23 +1701,62 @@ func (s *Service) tryLoad() error {
 // newTemplate receives the context and a path where it can write its
 // configuration, if desired. As we don't know when the service will exit,
 // we need to save the configuration on our own from time to time.
+// GetStatus returns the statistics of the verifications of darc signatures
+// and of the cache of re-encryptions, so operators can see when the
+// access-control checks become a bottleneck.
+func (s *Service) GetStatus() *onet.Status {
+	out := s.verifyStats.Status()
+	for k, v := range s.reencryptions.status() {
+		out[k] = v
+	}
+	return &onet.Status{Field: out}
+}
+
+// SetStorageQuota limits the size of the blocks of all OCS skipchains on
+// this conode, see skipchain.Service.SetQuota. A size of 0 removes the
+// limit.
+func (s *Service) SetStorageQuota(maxBytes int64) {
+	s.skipchain.SetQuota(&skipchain.Quota{
+		Service:   ServiceName,
+		MaxBytes:  maxBytes,
+		Verifiers: []skipchain.VerifierID{VerifyOCS},
+	})
+}
+
+// Health returns an error if the shared key of an OCS skipchain, or the
+// share of this node, is missing.
+func (s *Service) Health() error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	for ocs := range s.Storage.Admins {
+		shared := s.Storage.Shared[ocs]
+		if shared == nil || shared.X == nil || shared.V == nil {
+			return fmt.Errorf("missing shared key of ocs %x", []byte(ocs))
+		}
+	}
+	return nil
+}
+
 func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		Storage: &Storage{
 			Admins: make(map[string]*darc.Darc),
 		},
-		skipchain: c.Service(skipchain.ServiceName).(*skipchain.Service),
+		skipchain:   c.Service(skipchain.ServiceName).(*skipchain.Service),
+		verifyStats: darc.NewVerifyStats(),
 	}
 	if err := s.RegisterHandlers(s.CreateSkipchains,
 		s.WriteRequest, s.ReadRequest, s.GetReadRequests,
-		s.DecryptKeyRequest, s.SharedPublic,
+		s.WriteBatchRequest, s.WriteChunkRequest, s.DecryptKeyRequest, s.SharedPublic, s.RotateKey,
 		s.UpdateDarc, s.GetDarcPath,
 		s.GetLatestDarc); err != nil {
 		log.Error("Couldn't register messages", err)
 		return nil, err
 	}
 	skipchain.RegisterVerification(c, VerifyOCS, s.verifyOCS)
+	skipchain.RegisterBlockHandler(c, s.appended)
+	s.RegisterStatusReporter("OCS", s)
 	var err error
 	s.propagateOCS, err = messaging.NewPropagationFunc(c, "PropagateOCS", s.propagateOCSFunc, -1)
 	log.ErrFatal(err)
@@ -940,5 +1764,6 @@ func newService(c *onet.Context) (onet.Service, error) {
 		log.Error(err)
 		return nil, err
 	}
+	go s.watchExpiries()
 	return s, nil
 }
@@ -1,13 +1,18 @@
 package service
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/ocs/darc"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/suites"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
@@ -31,7 +36,7 @@ func TestService_proof(t *testing.T) {
 	write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, encKey)
 	write.Data = []byte{}
 	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
-	sig, err := darc.NewDarcSignature(write.Reader.GetID(), sigPath, o.writer)
+	sig, err := darc.NewDarcSignatureContext(write.Reader.GetID(), sigPath, o.writer, []byte(ServiceName))
 	require.Nil(t, err)
 	wr, err := o.service.WriteRequest(&WriteRequest{
 		OCS:       o.sc.OCS.Hash,
@@ -42,7 +47,7 @@ func TestService_proof(t *testing.T) {
 	require.Nil(t, err)
 
 	// Making a read request
-	sigRead, err := darc.NewDarcSignature(wr.SB.Hash, sigPath, o.writer)
+	sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte(ServiceName))
 	require.Nil(t, err)
 	read := Read{
 		DataID:    wr.SB.Hash,
@@ -54,6 +59,24 @@ func TestService_proof(t *testing.T) {
 	})
 	require.Nil(t, err)
 
+	// A signature for another service is refused.
+	sigOther, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte("evoting"))
+	require.Nil(t, err)
+	_, err = o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Signature: *sigOther},
+	})
+	require.NotNil(t, err)
+	// So is a signature without context, which could be replayed from any
+	// service.
+	sigOther, err = darc.NewDarcSignature(wr.SB.Hash, sigPath, o.writer)
+	require.Nil(t, err)
+	_, err = o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Signature: *sigOther},
+	})
+	require.NotNil(t, err)
+
 	// Decoding the file
 	symEnc, err := o.service.DecryptKeyRequest(&DecryptKeyRequest{
 		Read: rr.SB.Hash,
@@ -92,6 +115,365 @@ func TestService_proof(t *testing.T) {
 	})
 	require.Nil(t, err)
 	require.Equal(t, 1, len(requests.Documents))
+	doc := requests.Documents[0]
+	require.True(t, doc.ReadID.Equal(rr.SB.Hash))
+	require.True(t, doc.DataID.Equal(wr.SB.Hash))
+	require.True(t, doc.Reader.Equal(o.writerI))
+	require.NotEqual(t, int64(0), doc.Timestamp)
+}
+
+func TestService_AnonymousRead(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	// The reader darc holds the writer and another reader.
+	other := darc.NewSignerEd25519(nil, nil)
+	readers := darc.NewDarc(nil, nil, []byte("readers"))
+	readers.AddOwner(o.writerI)
+	readers.AddUser(o.writerI)
+	readers.AddUser(other.Identity())
+	encKey := []byte{1, 2, 3}
+	write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, readers, encKey)
+	write.Data = []byte{}
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(readers.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	wr, err := o.service.WriteRequest(&WriteRequest{
+		OCS:       o.sc.OCS.Hash,
+		Write:     *write,
+		Signature: *sig,
+		Readers:   readers,
+	})
+	require.Nil(t, err)
+
+	priv, err := other.GetPrivate()
+	require.Nil(t, err)
+	set := []kyber.Point{o.writerI.Ed25519.Point, other.Identity().Ed25519.Point}
+	anonymous, ephemeral, err := NewAnonymousRead(wr.SB.Hash, 0, set, 1, priv)
+	require.Nil(t, err)
+	_, _, err = NewAnonymousRead(wr.SB.Hash, 0, set, 0, priv)
+	require.NotNil(t, err)
+
+	// The read is refused for another document and for a set with a
+	// member that is not a reader.
+	_, err = o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Index: 1, Anonymous: anonymous},
+	})
+	require.NotNil(t, err)
+	stranger := darc.NewSignerEd25519(nil, nil)
+	strangerSet := append(set, stranger.Identity().Ed25519.Point)
+	anonymousStranger, _, err := NewAnonymousRead(wr.SB.Hash, 0, strangerSet, 1, priv)
+	require.Nil(t, err)
+	_, err = o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Anonymous: anonymousStranger},
+	})
+	require.NotNil(t, err)
+
+	rr, err := o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Anonymous: anonymous},
+	})
+	require.Nil(t, err)
+	require.Nil(t, NewOCS(rr.SB.Data).Read.Signature.SignaturePath.Signer.Ed25519)
+
+	symEnc, err := o.service.DecryptKeyRequest(&DecryptKeyRequest{
+		Read: rr.SB.Hash,
+	})
+	require.Nil(t, err)
+	sym, err := DecodeKey(cothority.Suite, o.sc.X, symEnc.Cs, symEnc.XhatEnc, ephemeral)
+	require.Nil(t, err)
+	require.Equal(t, encKey, sym)
+}
+
+func TestService_ReencryptCache(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	encKey := []byte{1, 2, 3}
+	write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, encKey)
+	write.Data = []byte{}
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(write.Reader.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	wr, err := o.service.WriteRequest(&WriteRequest{
+		OCS:       o.sc.OCS.Hash,
+		Write:     *write,
+		Signature: *sig,
+		Readers:   o.readers,
+	})
+	require.Nil(t, err)
+	sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	rr, err := o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Signature: *sigRead},
+	})
+	require.Nil(t, err)
+	priv, err := o.writer.GetPrivate()
+	require.Nil(t, err)
+
+	// The second request has to come from the cache and still decode.
+	var xhats []kyber.Point
+	for i := 0; i < 2; i++ {
+		symEnc, err := o.service.DecryptKeyRequest(&DecryptKeyRequest{
+			Read: rr.SB.Hash,
+		})
+		require.Nil(t, err)
+		sym, err := DecodeKey(cothority.Suite, o.sc.X, write.Cs, symEnc.XhatEnc, priv)
+		require.Nil(t, err)
+		require.Equal(t, encKey, sym)
+		require.Equal(t, 1, len(o.service.reencryptions.entries))
+		xhats = append(xhats, symEnc.XhatEnc)
+	}
+	require.True(t, xhats[0].Equal(xhats[1]))
+	status := o.service.GetStatus().Field
+	require.Equal(t, "1", status["CacheHits"])
+	require.Equal(t, "1", status["CacheMisses"])
+	require.NotEqual(t, "0", status["VerifyUser"])
+
+	// Expired entries are not returned anymore.
+	defer func(ttl time.Duration) { reencryptCacheTTL = ttl }(reencryptCacheTTL)
+	reencryptCacheTTL = -time.Second
+	o.service.reencryptions.entries = nil
+	_, err = o.service.DecryptKeyRequest(&DecryptKeyRequest{
+		Read: rr.SB.Hash,
+	})
+	require.Nil(t, err)
+	for k := range o.service.reencryptions.entries {
+		require.Nil(t, o.service.reencryptions.get(k))
+	}
+	require.Equal(t, 0, len(o.service.reencryptions.entries))
+}
+
+func TestService_ReadExpired(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	// bob was allowed to read until an hour ago.
+	bob := darc.NewSignerEd25519(nil, nil)
+	bobI := bob.Identity()
+	bobI.SetValidity(time.Time{}, time.Now().Add(-time.Hour))
+	readers := darc.NewDarc(nil, nil, nil)
+	readers.AddOwner(o.writerI)
+	readers.AddUser(o.writerI)
+	readers.AddUser(bobI)
+
+	encKey := []byte{1, 2, 3}
+	write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, readers, encKey)
+	write.Data = []byte{}
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(write.Reader.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	wr, err := o.service.WriteRequest(&WriteRequest{
+		OCS:       o.sc.OCS.Hash,
+		Write:     *write,
+		Signature: *sig,
+		Readers:   readers,
+	})
+	require.Nil(t, err)
+
+	read := func(signer *darc.Signer, id *darc.Identity) (*DecryptKeyReply, error) {
+		path := darc.NewSignaturePath([]*darc.Darc{readers}, *id, darc.User)
+		sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, path, signer, []byte(ServiceName))
+		require.Nil(t, err)
+		rr, err := o.service.ReadRequest(&ReadRequest{
+			OCS:  o.sc.OCS.Hash,
+			Read: Read{DataID: wr.SB.Hash, Signature: *sigRead},
+		})
+		require.Nil(t, err)
+		return o.service.DecryptKeyRequest(&DecryptKeyRequest{
+			Read: rr.SB.Hash,
+		})
+	}
+	_, err = read(bob, bobI)
+	require.Equal(t, ErrReadExpired, err)
+
+	symEnc, err := read(o.writer, o.writerI)
+	require.Nil(t, err)
+	priv, err := o.writer.GetPrivate()
+	require.Nil(t, err)
+	sym, err := DecodeKey(cothority.Suite, o.sc.X, write.Cs, symEnc.XhatEnc, priv)
+	require.Nil(t, err)
+	require.Equal(t, encKey, sym)
+}
+
+func TestService_WriteBatch(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(o.readers.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	req := &WriteBatchRequest{
+		OCS:       o.sc.OCS.Hash,
+		Signature: *sig,
+		Readers:   o.readers,
+	}
+	for i := 0; i < 3; i++ {
+		write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, []byte{byte(i)})
+		write.Data = []byte{byte(i)}
+		req.Writes = append(req.Writes, *write)
+	}
+	wr, err := o.service.WriteBatchRequest(req)
+	require.Nil(t, err)
+	batch := NewOCS(wr.SB.Data)
+	require.Equal(t, 3, len(batch.Writes))
+
+	// A write with a wrong proof spoils the whole batch.
+	req.Writes[1].E = cothority.Suite.Scalar().One()
+	_, err = o.service.WriteBatchRequest(req)
+	require.NotNil(t, err)
+
+	sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	_, err = o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Index: 3, Signature: *sigRead},
+	})
+	require.NotNil(t, err)
+	rr, err := o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Index: 2, Signature: *sigRead},
+	})
+	require.Nil(t, err)
+
+	symEnc, err := o.service.DecryptKeyRequest(&DecryptKeyRequest{
+		Read: rr.SB.Hash,
+	})
+	require.Nil(t, err)
+	priv, err := o.writer.GetPrivate()
+	require.Nil(t, err)
+	sym, err := DecodeKey(cothority.Suite, o.sc.X, symEnc.Cs, symEnc.XhatEnc, priv)
+	require.Nil(t, err)
+	require.Equal(t, []byte{2}, sym)
+
+	requests, err := o.service.GetReadRequests(&GetReadRequests{
+		Start: wr.SB.Hash,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(requests.Documents))
+	require.Equal(t, 2, requests.Documents[0].Index)
+}
+
+func TestService_WriteChunks(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+	for _, s := range o.services {
+		s.(*Service).SetMaxPayload(4)
+	}
+
+	ocs := &SkipChainURL{Roster: o.sc.OCS.Roster, Genesis: o.sc.OCS.Hash}
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(o.readers.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	cl := NewClient()
+	defer cl.Close()
+	data := []byte("too big for one block")
+	sb, err := cl.WriteRequest(ocs, data, []byte{1, 2, 3}, sig, o.readers)
+	require.Nil(t, err)
+	write := NewOCS(sb.Data).Write
+	require.Equal(t, 0, len(write.Data))
+	require.Equal(t, 6, len(write.Chunks))
+	stored, err := cl.GetData(ocs, sb.Hash)
+	require.Nil(t, err)
+	require.Equal(t, data, stored)
+
+	// Too much data, and chunks that are not stored or that are not chunks,
+	// are refused.
+	write = NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, []byte{1})
+	write.Data = data
+	req := &WriteRequest{
+		OCS:       o.sc.OCS.Hash,
+		Write:     *write,
+		Signature: *sig,
+		Readers:   o.readers,
+	}
+	_, err = o.service.WriteRequest(req)
+	require.NotNil(t, err)
+	req.Write.Data = nil
+	req.Write.Chunks = []skipchain.SkipBlockID{sb.Hash}
+	_, err = o.service.WriteRequest(req)
+	require.NotNil(t, err)
+	req.Write.Chunks = []skipchain.SkipBlockID{[]byte("chunk")}
+	_, err = o.service.WriteRequest(req)
+	require.NotNil(t, err)
+	_, err = o.service.WriteChunkRequest(&WriteChunkRequest{
+		OCS:   o.sc.OCS.Hash,
+		Chunk: Chunk{Data: data, Reader: o.readers.GetID(), Signature: *sig},
+	})
+	require.NotNil(t, err)
+}
+
+func TestService_RotateKey(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	encKey := []byte{1, 2, 3}
+	write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, encKey)
+	write.Data = []byte{}
+	sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
+	sig, err := darc.NewDarcSignatureContext(write.Reader.GetID(), sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	wr, err := o.service.WriteRequest(&WriteRequest{
+		OCS:       o.sc.OCS.Hash,
+		Write:     *write,
+		Signature: *sig,
+		Readers:   o.readers,
+	})
+	require.Nil(t, err)
+	sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	rr, err := o.service.ReadRequest(&ReadRequest{
+		OCS:  o.sc.OCS.Hash,
+		Read: Read{DataID: wr.SB.Hash, Signature: *sigRead},
+	})
+	require.Nil(t, err)
+
+	// Drop the last node of the roster.
+	roster := onet.NewRoster(o.sc.OCS.Roster.List[:4])
+	msg := RotateKeyMessage(o.sc.OCS.Hash, roster)
+	other := darc.NewSignerEd25519(nil, nil)
+	otherPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *other.Identity(), darc.Owner)
+	sigRotate, err := darc.NewDarcSignatureContext(msg, otherPath, other, []byte(ServiceName))
+	require.Nil(t, err)
+	_, err = o.service.RotateKey(&RotateKeyRequest{
+		OCS:       o.sc.OCS.Hash,
+		Roster:    *roster,
+		Signature: *sigRotate,
+	})
+	require.NotNil(t, err)
+
+	ownerPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.Owner)
+	sigRotate, err = darc.NewDarcSignatureContext(msg, ownerPath, o.writer, []byte(ServiceName))
+	require.Nil(t, err)
+	rotated, err := o.service.RotateKey(&RotateKeyRequest{
+		OCS:       o.sc.OCS.Hash,
+		Roster:    *roster,
+		Signature: *sigRotate,
+	})
+	require.Nil(t, err)
+	require.False(t, rotated.X.Equal(o.sc.X))
+	shared, err := o.service.SharedPublic(&SharedPublicRequest{Genesis: o.sc.OCS.Hash})
+	require.Nil(t, err)
+	require.True(t, rotated.X.Equal(shared.X))
+	left := o.services[4].(*Service)
+	left.saveMutex.Lock()
+	require.Nil(t, left.Storage.Shared[string(o.sc.OCS.Hash)])
+	left.saveMutex.Unlock()
+
+	// The write from before the rotation can still be read.
+	symEnc, err := o.service.DecryptKeyRequest(&DecryptKeyRequest{
+		Read: rr.SB.Hash,
+	})
+	require.Nil(t, err)
+	require.True(t, rotated.X.Equal(symEnc.X))
+	priv, err := o.writer.GetPrivate()
+	require.Nil(t, err)
+	sym, err := DecodeKey(cothority.Suite, symEnc.X, symEnc.Cs, symEnc.XhatEnc, priv)
+	require.Nil(t, err)
+	require.Equal(t, encKey, sym)
 }
 
 func TestService_GetDarcPath(t *testing.T) {
@@ -173,6 +555,78 @@ func TestService_UpdateDarcOffline(t *testing.T) {
 	}
 }
 
+func TestService_SubscribeDarc(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	updates, unsubscribe := o.service.SubscribeDarc(o.readers.GetBaseID())
+	newReader := o.readers.Copy()
+	newReader.AddUser(darc.NewSignerEd25519(nil, nil).Identity())
+	require.Nil(t, newReader.SetEvolution(o.readers, nil, o.writer))
+	_, err := o.service.UpdateDarc(&UpdateDarc{
+		OCS:  o.sc.OCS.SkipChainID(),
+		Darc: *newReader,
+	})
+	require.Nil(t, err)
+
+	select {
+	case d := <-updates:
+		require.True(t, d.Equal(newReader))
+	case <-time.After(time.Second):
+		t.Fatal("didn't get the new darc")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-updates
+	require.False(t, ok)
+}
+
+func TestService_Expiries(t *testing.T) {
+	o := createOCS(t)
+	defer o.local.CloseAll()
+
+	// bob can read for another hour, carol for another week.
+	bobI := darc.NewSignerEd25519(nil, nil).Identity()
+	bobI.SetValidity(time.Time{}, time.Now().Add(time.Hour))
+	carolI := darc.NewSignerEd25519(nil, nil).Identity()
+	carolI.SetValidity(time.Time{}, time.Now().Add(7*24*time.Hour))
+	newReader := o.readers.Copy()
+	newReader.AddUser(bobI)
+	newReader.AddUser(carolI)
+	require.Nil(t, newReader.SetEvolution(o.readers, nil, o.writer))
+	_, err := o.service.UpdateDarc(&UpdateDarc{
+		OCS:  o.sc.OCS.SkipChainID(),
+		Darc: *newReader,
+	})
+	require.Nil(t, err)
+
+	events := o.service.findExpiries(time.Now())
+	require.Equal(t, 1, len(events))
+	require.Equal(t, bobI.PolicyString(), events[0].Identity)
+	require.True(t, events[0].BaseID.Equal(o.readers.GetBaseID()))
+	require.Equal(t, 1, events[0].Version)
+	require.Equal(t, 0, len(o.service.findExpiries(time.Now())))
+	// carol's grant is announced a day before it expires.
+	events = o.service.findExpiries(time.Now().Add(6*24*time.Hour + time.Minute))
+	require.Equal(t, 1, len(events))
+	require.Equal(t, carolI.PolicyString(), events[0].Identity)
+
+	received := make(chan *ExpiryEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := &ExpiryEvent{}
+		require.Nil(t, json.NewDecoder(r.Body).Decode(ev))
+		received <- ev
+	}))
+	defer server.Close()
+	o.service.SetExpiryWebhook(server.URL)
+	updates, unsubscribe := o.service.SubscribeExpiries()
+	defer unsubscribe()
+	o.service.announceExpiry(events[0])
+	require.Equal(t, events[0], <-updates)
+	require.Equal(t, events[0], <-received)
+}
+
 func TestService_UpdateDarcOnline(t *testing.T) {
 	if testing.Short() {
 		t.Skip("adding 100 darcs takes a lot of time")
@@ -230,7 +684,7 @@ func TestStress(t *testing.T) {
 				write := NewWrite(cothority.Suite, o.sc.OCS.Hash, o.sc.X, o.readers, encKey)
 				write.Data = []byte{}
 				sigPath := darc.NewSignaturePath([]*darc.Darc{o.readers}, *o.writerI, darc.User)
-				sig, err := darc.NewDarcSignature(write.Reader.GetID(), sigPath, o.writer)
+				sig, err := darc.NewDarcSignatureContext(write.Reader.GetID(), sigPath, o.writer, []byte(ServiceName))
 				require.Nil(t, err)
 				wr, err := o.service.WriteRequest(&WriteRequest{
 					OCS:       o.sc.OCS.Hash,
@@ -243,7 +697,7 @@ func TestStress(t *testing.T) {
 
 				// Making a read request
 				log.Lvlf1("Loop %d in thread %d: Read", loop, n)
-				sigRead, err := darc.NewDarcSignature(wr.SB.Hash, sigPath, o.writer)
+				sigRead, err := darc.NewDarcSignatureContext(wr.SB.Hash, sigPath, o.writer, []byte(ServiceName))
 				require.Nil(t, err)
 				read := Read{
 					DataID:    wr.SB.Hash,
@@ -35,7 +35,10 @@ func init() {
 		ReadRequest{}, ReadReply{},
 		SharedPublicRequest{}, SharedPublicReply{},
 		DecryptKeyRequest{}, DecryptKeyReply{},
-		GetReadRequests{}, GetReadRequestsReply{})
+		GetReadRequests{}, GetReadRequestsReply{},
+		RotateKeyRequest{}, RotateKeyReply{},
+		WriteBatchRequest{}, WriteBatchReply{},
+		WriteChunkRequest{}, WriteChunkReply{})
 }
 
 // ServiceName is used for registration on the onet.
@@ -50,6 +53,11 @@ var VerifyOCS = skipchain.VerifierID(uuid.NewV5(uuid.NamespaceURL, "OCS"))
 var VerificationOCS = []skipchain.VerifierID{skipchain.VerifyBase,
 	VerifyOCS}
 
+// ErrReadExpired is returned when the symmetric key of a read-request is
+// asked for, but the darcs don't allow the reader to read at this time
+// anymore.
+var ErrReadExpired = errors.New("read grant expired")
+
 // SkipChainURL represents a skipchain. It needs to know the roster of the
 // responsible nodes, and the hash of the genesis-block, which is the ID
 // of the Skipchain.
@@ -94,12 +102,39 @@ func (dw *Transaction) String() string {
 	if dw.Write != nil {
 		str += fmt.Sprintf("Write: data-length of %d\n", len(dw.Write.Data))
 	}
-	if dw.Read != nil {
+	for i, w := range dw.Writes {
+		str += fmt.Sprintf("Write %d: data-length of %d\n", i, len(w.Data))
+	}
+	if dw.Read != nil && dw.Read.Anonymous != nil {
+		str += fmt.Sprintf("Read: anonymous among %d read data %x\n", len(dw.Read.Anonymous.Set), dw.Read.DataID)
+	} else if dw.Read != nil {
 		str += fmt.Sprintf("Read: %+v read data %x\n", dw.Read.Signature.SignaturePath.Signer, dw.Read.DataID)
 	}
+	if dw.Rotation != nil {
+		str += fmt.Sprintf("Rotation: %d re-encrypted writes\n", len(dw.Rotation.Writes))
+	}
+	if dw.Chunk != nil {
+		str += fmt.Sprintf("Chunk: data-length of %d\n", len(dw.Chunk.Data))
+	}
 	return str
 }
 
+// WriteAt returns the write-request with the given index in the transaction,
+// or nil if there is none. A transaction holds either a single write-request,
+// which has index 0, or a batch of them.
+func (dw *Transaction) WriteAt(index int) *Write {
+	if dw.Write != nil {
+		if index != 0 {
+			return nil
+		}
+		return dw.Write
+	}
+	if index < 0 || index >= len(dw.Writes) {
+		return nil
+	}
+	return dw.Writes[index]
+}
+
 // NewWrite is used by the writer to an onchain-secret skipchain
 // to encode his symmetric key under the collective public key created
 // by the DKG.
@@ -185,6 +220,13 @@ func (wr *Write) CheckProof(suite suite, scid skipchain.SkipBlockID) error {
 	return errors.New("recreated proof is not equal to stored proof")
 }
 
+// RotateKeyMessage returns the message an admin has to sign to rotate the
+// shared key of the OCS-skipchain to a DKG on the given roster.
+func RotateKeyMessage(ocs skipchain.SkipBlockID, roster *onet.Roster) []byte {
+	msg := append([]byte("rotate:"), ocs...)
+	return append(msg, roster.ID[:]...)
+}
+
 // DecodeKey can be used by the reader of an onchain-secret to convert the
 // re-encrypted secret back to a symmetric key that can be used later to
 // decode the document.
@@ -247,12 +289,18 @@ func DecodeKey(suite suite, X kyber.Point, Cs []kyber.Point, XhatEnc kyber.Point
 // - a write
 // - a key-update
 // - a write and a key-update
+// - a batch of writes, and an eventual key-update
+// - a rotation of the shared key
+// - a chunk of the data of a write
 // Additionally, it can hold a slice of bytes with any data that the user wants to
 // add to bind to that transaction.
 // Every Transaction must have a Unix timestamp.
 type Transaction struct {
 	// Write holds an eventual write-request with a document
 	Write *Write
+	// Writes holds a batch of write-requests that share the same reader
+	// darc. Only the first write-request needs to be signed.
+	Writes []*Write
 	// Read holds an eventual read-request, which is approved, for a document
 	Read *Read
 	// Darc defines either the readers allowed for this write-request
@@ -262,6 +310,11 @@ type Transaction struct {
 	Meta *[]byte
 	// Unix timestamp to record the transaction creation time
 	Timestamp int64
+	// Rotation replaces the shared key with the one of a new DKG
+	Rotation *Rotation
+	// Chunk holds a part of the data of a write that is too big for one
+	// block
+	Chunk *Chunk
 }
 
 // Write stores the data and the encrypted secret
@@ -291,6 +344,20 @@ type Write struct {
 	// skipchain. For backwards-compatibility, this is an optional field.
 	// But for every new write-request, it must be set.
 	Signature *darc.Signature
+	// Chunks are the ids of the blocks holding the data, in order, if it is
+	// too big for one block. Data is empty in that case.
+	Chunks []skipchain.SkipBlockID
+}
+
+// Chunk holds a part of the encrypted data of a write. It is stored in its
+// own block before the write-request that lists it.
+type Chunk struct {
+	// Data is the part of the encrypted data
+	Data []byte
+	// Reader is the id of the reader darc of the write
+	Reader darc.ID
+	// Signature must come from a valid writer on Reader, as for a write.
+	Signature darc.Signature
 }
 
 // Read stores a read-request which is the secret encrypted under the
@@ -299,16 +366,64 @@ type Write struct {
 type Read struct {
 	// DataID is the document-id for the read request
 	DataID skipchain.SkipBlockID
+	// Index is the position of the document in a batch of write-requests
+	Index int
 	// Signature is a Schnorr-signature using the private key of the
 	// reader on the message 'DataID'
 	Signature darc.Signature
+	// Anonymous replaces Signature for a read that doesn't reveal the reader
+	Anonymous *AnonymousRead
+}
+
+// AnonymousRead proves that one of a set of readers of a write asks for its
+// key, without revealing which one. The skipchain only records the set, whose
+// members all have to be readers of the write.
+type AnonymousRead struct {
+	// Set holds the public keys of the readers
+	Set []kyber.Point
+	// Ephemeral is the key the symmetric key is re-encrypted to
+	Ephemeral kyber.Point
+	// Signature is a ring signature of one member of Set on the message
+	// returned by AnonymousReadMessage
+	Signature []byte
+}
+
+// Rotation replaces the shared key of the skipchain with the key of a new
+// DKG on the roster of its skipblock. The writes stored so far are
+// re-encrypted to the new key, so that they can still be read.
+type Rotation struct {
+	// X is the new shared public key
+	X kyber.Point
+	// Signature must come from an owner of the admin darc of the OCS
+	// skipchain on the message returned by RotateKeyMessage.
+	Signature darc.Signature
+	// Writes holds the re-encrypted keys of all writes
+	Writes []*Rewrite
+}
+
+// Rewrite holds the symmetric key of a write-request, encrypted to the
+// shared key of a rotation.
+type Rewrite struct {
+	// WriteID is the id of the skipblock holding the write-request
+	WriteID skipchain.SkipBlockID
+	// Index is the position of the write-request in its skipblock
+	Index int
+	// U is the encrypted random value for the ElGamal encryption
+	U kyber.Point
+	// Cs are the ElGamal parts for the symmetric key material
+	Cs []kyber.Point
 }
 
 // ReadDoc represents one read-request by a reader.
 type ReadDoc struct {
+	// Reader is empty for an anonymous read
 	Reader darc.Identity
 	ReadID skipchain.SkipBlockID
 	DataID skipchain.SkipBlockID
+	// Index is the position of the document in a batch of write-requests
+	Index int
+	// Timestamp is the unix time at which the read-request was stored
+	Timestamp int64
 }
 
 // ***
@@ -373,6 +488,34 @@ type WriteReply struct {
 	SB *skipchain.SkipBlock
 }
 
+// WriteBatchRequest asks the OCS-skipchain to store a batch of documents in
+// one skipblock. All writes must have the same reader darc, and the signature
+// is on its id, as for a WriteRequest. A document of the batch is identified
+// by the id of the skipblock and its index in Writes.
+type WriteBatchRequest struct {
+	OCS       skipchain.SkipBlockID
+	Writes    []Write
+	Signature darc.Signature
+	Readers   *darc.Darc
+}
+
+// WriteBatchReply returns the created skipblock.
+type WriteBatchReply struct {
+	SB *skipchain.SkipBlock
+}
+
+// WriteChunkRequest asks the OCS-skipchain to store a chunk of the data of
+// a document. The write-request of the document then lists the chunk.
+type WriteChunkRequest struct {
+	OCS   skipchain.SkipBlockID
+	Chunk Chunk
+}
+
+// WriteChunkReply returns the skipblock holding the chunk.
+type WriteChunkReply struct {
+	SB *skipchain.SkipBlock
+}
+
 // ReadRequest asks the OCS-skipchain to allow a reader to access a document.
 type ReadRequest struct {
 	OCS  skipchain.SkipBlockID
@@ -390,9 +533,11 @@ type SharedPublicRequest struct {
 	Genesis skipchain.SkipBlockID
 }
 
-// SharedPublicReply sends back the shared public key.
+// SharedPublicReply sends back the shared public key, and the maximum size
+// of the data of a write or a chunk accepted by the conode.
 type SharedPublicReply struct {
-	X kyber.Point
+	X          kyber.Point
+	MaxPayload int
 }
 
 // DecryptKeyRequest is sent to the service with the read-request. Optionally
@@ -424,6 +569,23 @@ type GetReadRequestsReply struct {
 	Documents []*ReadDoc
 }
 
+// RotateKeyRequest asks for a new DKG on the roster, which replaces the
+// roster of the OCS-skipchain. All writes are re-encrypted to the new shared
+// key. The Signature must come from an owner of the admin darc of the
+// skipchain on the message returned by RotateKeyMessage.
+type RotateKeyRequest struct {
+	OCS       skipchain.SkipBlockID
+	Roster    onet.Roster
+	Signature darc.Signature
+}
+
+// RotateKeyReply returns the skipblock holding the rotation and the new
+// shared public key.
+type RotateKeyReply struct {
+	SB *skipchain.SkipBlock
+	X  kyber.Point
+}
+
 // GetBunchRequest asks for a list of bunches
 type GetBunchRequest struct {
 }
@@ -405,6 +405,38 @@ func scPrint(c *cli.Context) error {
 	return nil
 }
 
+// Asks a conode to repair one or all of its skipchains from the other
+// conodes of their rosters.
+func scRepair(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return errors.New("please give: ip:port [skipchain-id]")
+	}
+	cfg := getConfigOrFail(c)
+	link, err := findLinkFromAddress(cfg, c.Args().First())
+	if err != nil {
+		return errors.New("couldn't parse node-address or not linked yet: " + err.Error())
+	}
+	var scid skipchain.SkipBlockID
+	if c.NArg() == 2 {
+		scid, err = hex.DecodeString(c.Args().Get(1))
+		if err != nil {
+			return errors.New("invalid skipchain-id: " + err.Error())
+		}
+	}
+	reply, err := skipchain.NewClient().RepairSkipchain(link.Conode, link.Private, scid)
+	if err != nil {
+		return err
+	}
+	log.Infof("Fetched %d blocks and %d forward links", reply.Blocks, reply.ForwardLinks)
+	for _, d := range reply.Divergences {
+		log.Info("Couldn't repair:", d)
+	}
+	if len(reply.Divergences) > 0 {
+		return errors.New("some skipchains couldn't be repaired")
+	}
+	return nil
+}
+
 // Joins a given skipchain
 func dnsFetch(c *cli.Context) error {
 	if c.NArg() != 2 {
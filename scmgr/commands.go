@@ -149,6 +149,13 @@ func getCommands() cli.Commands {
 						},
 					},
 				},
+				{
+					Name:      "repair",
+					Usage:     "fetch the blocks and forward links a conode misses from the other conodes",
+					Aliases:   []string{"r"},
+					ArgsUsage: "ip:port [skipchain-id]",
+					Action:    scRepair,
+				},
 			},
 		},
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sync"
 
 	"github.com/dedis/cothority"
 	status "github.com/dedis/cothority/status/service"
@@ -18,6 +19,8 @@ import (
 // service from the outside
 type Client struct {
 	*onet.Client
+	// compress is set if the blocks are asked for with compressed data.
+	compress bool
 }
 
 // NewClient instantiates a new client with name 'n'
@@ -197,7 +200,11 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 		for ; i < retries; i++ {
 			// To handle the case where len(perm) < retries.
 			which := i % len(perm)
-			err = c.SendProtobuf(roster.List[perm[which]], &GetUpdateChain{LatestID: latest}, r2)
+			err = c.SendProtobuf(roster.List[perm[which]],
+				&GetUpdateChain{LatestID: latest, Compress: c.compress}, r2)
+			if err == nil {
+				err = decompressBlocks(r2.Update)
+			}
 			if err == nil && len(r2.Update) != 0 {
 				break
 			}
@@ -207,7 +214,8 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 		}
 
 		// Does this chain start where we expect it to?
-		if !r2.Update[0].Hash.Equal(latest) {
+		if !r2.Update[0].Hash.Equal(latest) ||
+			!r2.Update[0].CalculateHash().Equal(latest) {
 			return nil, errors.New("first returned block does not match requested hash")
 		}
 
@@ -246,6 +254,11 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 				if !prevBlock.ForwardLink[link-1].To.Equal(b.Hash) {
 					return nil, errors.New("corresponding forwardlink doesn't point to next block")
 				}
+				// The roster of the previous block has to sign the link, and
+				// with it a change of the roster.
+				if err := prevBlock.ForwardLink[link-1].VerifyTransition(prevBlock, b); err != nil {
+					return nil, err
+				}
 			}
 
 			reply.Update = append(reply.Update, b)
@@ -265,6 +278,18 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 	}
 }
 
+// ChangeRoster appends a block without data to the skipchain, which hands
+// the skipchain over to roster, e.g. to add or remove conodes. The roster of
+// latest co-signs the transition, and all nodes of roster have to accept the
+// block. Clients following the skipchain with GetUpdateChain continue with
+// the new roster.
+func (c *Client) ChangeRoster(latest *SkipBlock, roster *onet.Roster) (*StoreSkipBlockReply, error) {
+	if roster == nil || len(roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	return c.StoreSkipBlock(latest, roster, []byte{})
+}
+
 // GetAllSkipchains returns all skipchains known to that conode. If none are
 // known, an empty slice is returned.
 func (c *Client) GetAllSkipchains(si *network.ServerIdentity) (reply *GetAllSkipchainsReply,
@@ -279,7 +304,10 @@ func (c *Client) GetAllSkipchains(si *network.ServerIdentity) (reply *GetAllSkip
 func (c *Client) GetSingleBlock(roster *onet.Roster, id SkipBlockID) (reply *SkipBlock, err error) {
 	reply = &SkipBlock{}
 	err = c.SendProtobuf(roster.RandomServerIdentity(),
-		&GetSingleBlock{id}, reply)
+		&GetSingleBlock{ID: id, Compress: c.compress}, reply)
+	if err == nil {
+		err = reply.Decompress()
+	}
 	return
 }
 
@@ -288,10 +316,235 @@ func (c *Client) GetSingleBlock(roster *onet.Roster, id SkipBlockID) (reply *Ski
 func (c *Client) GetSingleBlockByIndex(roster *onet.Roster, genesis SkipBlockID, index int) (reply *SkipBlock, err error) {
 	reply = &SkipBlock{}
 	err = c.SendProtobuf(roster.RandomServerIdentity(),
-		&GetSingleBlockByIndex{genesis, index}, reply)
+		&GetSingleBlockByIndex{Genesis: genesis, Index: index, Compress: c.compress}, reply)
+	if err == nil {
+		err = reply.Decompress()
+	}
 	return
 }
 
+// GetBlocksByIndexRange returns the blocks of the skipchain with an index
+// from `from` to `to`, both included, in a single request. If to is -1, the
+// blocks up to the last one are returned. The conode returns at most
+// MaxBlocksByIndexRange blocks, so fewer blocks than asked for are returned
+// for long ranges.
+func (c *Client) GetBlocksByIndexRange(roster *onet.Roster, genesis SkipBlockID, from, to int) ([]*SkipBlock, error) {
+	reply := &GetBlocksByIndexRangeReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(),
+		&GetBlocksByIndexRange{Genesis: genesis, From: from, To: to, Compress: c.compress}, reply)
+	if err == nil {
+		err = decompressBlocks(reply.Blocks)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply.Blocks, nil
+}
+
+// GetBlocksWithPredicate returns all the blocks of the skipchain matching
+// the predicate registered under the given name on the conodes, see
+// RegisterPredicate. The blocks are filtered by the conode, and fetched in
+// as many requests as needed.
+func (c *Client) GetBlocksWithPredicate(roster *onet.Roster, genesis SkipBlockID, predicate string) ([]*SkipBlock, error) {
+	si := roster.RandomServerIdentity()
+	var blocks []*SkipBlock
+	for from := 0; from >= 0; {
+		reply := &GetBlocksWithPredicateReply{}
+		err := c.SendProtobuf(si, &GetBlocksWithPredicate{genesis, predicate, from}, reply)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, reply.Blocks...)
+		from = reply.Next
+	}
+	return blocks, nil
+}
+
+// GetInclusionProof returns a proof that the block is part of its skipchain.
+// It can be checked with VerifyInclusionProof without trusting the conode.
+func (c *Client) GetInclusionProof(roster *onet.Roster, id SkipBlockID) (*InclusionProof, error) {
+	reply := &GetInclusionProofReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(), &GetInclusionProof{id}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Proof, nil
+}
+
+// ArchiveSkipchain returns all the blocks of the skipchain, after checking
+// them with VerifyArchive. The archive can be stored with Archive.Save
+// before the chain is pruned. If the conode has linked clients, clientPriv
+// must be the private key of one of them.
+func (c *Client) ArchiveSkipchain(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) (*Archive, error) {
+	msg := append([]byte("archive:"), scid...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return nil, err
+	}
+	reply := &ArchiveSkipchainReply{}
+	err = c.SendProtobuf(si, &ArchiveSkipchain{SkipchainID: scid, Signature: sig}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyArchive(scid, reply.Archive); err != nil {
+		return nil, err
+	}
+	return reply.Archive, nil
+}
+
+// PruneSkipchain removes the archived skipchain from the database of the
+// conode and returns how many blocks were removed. It fails if blocks were
+// added since the archive was made. Every conode holding the chain has to be
+// asked separately.
+func (c *Client) PruneSkipchain(si *network.ServerIdentity, clientPriv kyber.Scalar, archive *Archive) (int, error) {
+	if len(archive.Blocks) == 0 {
+		return 0, errors.New("empty archive")
+	}
+	scid := archive.Blocks[0].Hash
+	latest := archive.Latest().Hash
+	msg := append([]byte("prune:"), scid...)
+	msg = append(msg, latest...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return 0, err
+	}
+	reply := &PruneSkipchainReply{}
+	err = c.SendProtobuf(si, &PruneSkipchain{
+		SkipchainID: scid,
+		Latest:      latest,
+		Signature:   sig,
+	}, reply)
+	if err != nil {
+		return 0, err
+	}
+	return reply.Removed, nil
+}
+
+// RepairSkipchain asks the conode to fetch the blocks and forward links of
+// the skipchain it misses from the other nodes of the roster, or of all its
+// skipchains if scid is nil. Divergences that couldn't be repaired are
+// returned in the reply. If the conode has linked clients, clientPriv must
+// be the private key of one of them.
+func (c *Client) RepairSkipchain(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) (*RepairSkipchainReply, error) {
+	msg := append([]byte("repair:"), scid...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return nil, err
+	}
+	reply := &RepairSkipchainReply{}
+	err = c.SendProtobuf(si, &RepairSkipchain{SkipchainID: scid, Signature: sig}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// BlockStream delivers the blocks of a skipchain in order, see
+// Client.StreamBlocks and Client.SubscribeBlocks.
+type BlockStream struct {
+	// Blocks returns the blocks of the chain. It is closed after the last
+	// block, on error, or when the stream is closed.
+	Blocks <-chan *SkipBlock
+
+	err  error
+	stop chan struct{}
+	once sync.Once
+}
+
+// streamPrefetch is the number of blocks a BlockStream fetches before they
+// are read.
+const streamPrefetch = 8
+
+// StreamBlocks returns a stream of the blocks of the skipchain starting
+// at fromIndex. All the blocks are requested from the same conode of the
+// roster, so the connection to it is reused. They are fetched in ranges of
+// streamPrefetch blocks, and a range is only requested once the previous one
+// has been read.
+func (c *Client) StreamBlocks(roster *onet.Roster, genesis SkipBlockID, fromIndex int) *BlockStream {
+	blocks := make(chan *SkipBlock, streamPrefetch)
+	bs := &BlockStream{Blocks: blocks, stop: make(chan struct{})}
+	si := roster.RandomServerIdentity()
+	go func() {
+		defer close(blocks)
+		from := fromIndex
+		for {
+			reply := &GetBlocksByIndexRangeReply{}
+			err := c.SendProtobuf(si, &GetBlocksByIndexRange{Genesis: genesis, From: from,
+				To: from + streamPrefetch - 1, Compress: c.compress}, reply)
+			if err == nil {
+				err = decompressBlocks(reply.Blocks)
+			}
+			if err != nil {
+				bs.err = err
+				return
+			}
+			if len(reply.Blocks) == 0 {
+				return
+			}
+			for _, block := range reply.Blocks {
+				select {
+				case blocks <- block:
+				case <-bs.stop:
+					return
+				}
+			}
+			last := reply.Blocks[len(reply.Blocks)-1]
+			if len(last.ForwardLink) == 0 {
+				return
+			}
+			from = last.Index + 1
+		}
+	}()
+	return bs
+}
+
+// Err returns the error that ended the stream, or nil if all the blocks
+// were delivered. It must only be called once Blocks is closed.
+func (bs *BlockStream) Err() error {
+	return bs.err
+}
+
+// Close stops the stream. Blocks already fetched can still be read.
+func (bs *BlockStream) Close() {
+	bs.once.Do(func() { close(bs.stop) })
+}
+
+// SubscribeBlocks returns a stream of the blocks added to the skipchain
+// after latest. The stream asks a conode of the roster for new blocks and
+// only ends when it is closed or on error. As a request waiting for new
+// blocks cannot be interrupted, the stream only stops once that request
+// returns.
+func (c *Client) SubscribeBlocks(roster *onet.Roster, latest SkipBlockID) *BlockStream {
+	blocks := make(chan *SkipBlock, streamPrefetch)
+	bs := &BlockStream{Blocks: blocks, stop: make(chan struct{})}
+	si := roster.RandomServerIdentity()
+	go func() {
+		defer close(blocks)
+		for {
+			select {
+			case <-bs.stop:
+				return
+			default:
+			}
+			reply := &WaitNewBlocksReply{}
+			err := c.SendProtobuf(si, &WaitNewBlocks{latest}, reply)
+			if err != nil {
+				bs.err = err
+				return
+			}
+			for _, block := range reply.Blocks {
+				select {
+				case blocks <- block:
+				case <-bs.stop:
+					return
+				}
+				latest = block.Hash
+			}
+		}
+	}()
+	return bs
+}
+
 // CreateLinkPrivate asks the conode to create a link by sending a public
 // key of the client, signed by the private key of the conode. The reasoning is
 // that an administrator should well be able to copy the private.toml-file from
@@ -2,9 +2,13 @@ package skipchain
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	bolt "github.com/coreos/bbolt"
 	"github.com/stretchr/testify/require"
 
 	"bytes"
@@ -281,6 +285,261 @@ func TestClient_GetSingleBlockByIndex(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestClient_GetBlocksByIndexRange(t *testing.T) {
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 2, 3, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	for i := 0; i < 9; i++ {
+		_, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		log.ErrFatal(err)
+	}
+
+	blocks, err := c.GetBlocksByIndexRange(roster, sb.Hash, 3, 6)
+	log.ErrFatal(err)
+	require.Equal(t, 4, len(blocks))
+	for i, block := range blocks {
+		require.Equal(t, 3+i, block.Index)
+		require.Equal(t, sb.Hash, block.GenesisID)
+	}
+
+	// Up to the end of the chain.
+	blocks, err = c.GetBlocksByIndexRange(roster, sb.Hash, 7, -1)
+	log.ErrFatal(err)
+	require.Equal(t, 3, len(blocks))
+	blocks, err = c.GetBlocksByIndexRange(roster, sb.Hash, 8, 20)
+	log.ErrFatal(err)
+	require.Equal(t, 2, len(blocks))
+
+	_, err = c.GetBlocksByIndexRange(roster, sb.Hash, 10, 12)
+	require.NotNil(t, err)
+	_, err = c.GetBlocksByIndexRange(roster, sb.Hash, 4, 2)
+	require.NotNil(t, err)
+}
+
+func TestClient_Compression(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	services := l.GetServices(servers, skipchainSID)
+	for _, s := range services {
+		s.(*Service).SetCompression(true)
+	}
+
+	c := newTestClient(l)
+	c.UseCompression(true)
+	sb, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	data := bytes.Repeat([]byte("ballot"), 1000)
+	reply, err := c.StoreSkipBlock(sb, roster, data)
+	log.ErrFatal(err)
+	latest := reply.Latest
+
+	// The conodes store and send the block compressed, but only if the
+	// client asks for it.
+	s := services[0].(*Service)
+	s.db.View(func(tx *bolt.Tx) error {
+		require.True(t, bytes.HasPrefix(tx.Bucket(s.db.bucketName).Get(latest.Hash), gzipMagic))
+		return nil
+	})
+	require.True(t, s.db.GetByID(latest.Hash).Equal(latest))
+	sent, err := s.GetSingleBlock(&GetSingleBlock{ID: latest.Hash, Compress: true})
+	log.ErrFatal(err)
+	require.True(t, sent.Compressed)
+	require.True(t, len(sent.Data) < len(data))
+	sent, err = s.GetSingleBlock(&GetSingleBlock{ID: latest.Hash})
+	log.ErrFatal(err)
+	require.False(t, sent.Compressed)
+
+	// The client decompresses the blocks, whatever the request.
+	block, err := c.GetSingleBlock(roster, latest.Hash)
+	log.ErrFatal(err)
+	require.Equal(t, data, block.Data)
+	block, err = c.GetSingleBlockByIndex(roster, sb.Hash, 1)
+	log.ErrFatal(err)
+	require.Equal(t, data, block.Data)
+	blocks, err := c.GetBlocksByIndexRange(roster, sb.Hash, 0, -1)
+	log.ErrFatal(err)
+	require.Equal(t, data, blocks[1].Data)
+	update, err := c.GetUpdateChain(roster, sb.Hash)
+	log.ErrFatal(err)
+	require.Equal(t, data, update.Update[len(update.Update)-1].Data)
+
+	// Compressed blocks stay readable once compression is disabled.
+	for _, s := range services {
+		s.(*Service).SetCompression(false)
+	}
+	block, err = c.GetSingleBlock(roster, latest.Hash)
+	log.ErrFatal(err)
+	require.False(t, block.Compressed)
+	require.Equal(t, data, block.Data)
+
+	// Data bigger than the limit is refused.
+	defer func(max int64) { maxDecompressed = max }(maxDecompressed)
+	maxDecompressed = 100
+	require.NotNil(t, sent.compressed().Decompress())
+}
+
+func TestClient_GetInclusionProof(t *testing.T) {
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 2, 4, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	var latest *SkipBlock
+	for i := 0; i < 12; i++ {
+		reply, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		log.ErrFatal(err)
+		latest = reply.Latest
+	}
+
+	proof, err := c.GetInclusionProof(roster, latest.Hash)
+	log.ErrFatal(err)
+	require.Nil(t, VerifyInclusionProof(sb.Hash, latest.Hash, proof))
+	// The proof follows the higher forward links.
+	require.True(t, len(proof.Blocks) < latest.Index)
+
+	proof, err = c.GetInclusionProof(roster, sb.Hash)
+	log.ErrFatal(err)
+	require.Nil(t, VerifyInclusionProof(sb.Hash, sb.Hash, proof))
+
+	proof, err = c.GetInclusionProof(roster, latest.Hash)
+	log.ErrFatal(err)
+	require.NotNil(t, VerifyInclusionProof(latest.Hash, latest.Hash, proof))
+	require.NotNil(t, VerifyInclusionProof(sb.Hash, sb.Hash, proof))
+	proof.Blocks[1].Data = []byte{0xff}
+	require.NotNil(t, VerifyInclusionProof(sb.Hash, latest.Hash, proof))
+}
+
+func TestClient_ChangeRoster(t *testing.T) {
+	nbrHosts := 4
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	ro3 := onet.NewRoster(roster.List[:3])
+	sb, err := c.CreateGenesis(ro3, 1, 1, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	_, err = c.ChangeRoster(sb, nil)
+	require.NotNil(t, err)
+
+	// Add a conode, then remove the first one.
+	reply, err := c.ChangeRoster(sb, roster)
+	log.ErrFatal(err)
+	require.Equal(t, 1, reply.Latest.Index)
+	added := reply.Latest
+	ro3 = onet.NewRoster(roster.List[1:])
+	reply, err = c.ChangeRoster(added, ro3)
+	log.ErrFatal(err)
+	reply, err = c.StoreSkipBlock(reply.Latest, nil, []byte{1})
+	log.ErrFatal(err)
+
+	update, err := c.GetUpdateChain(sb.Roster, sb.Hash)
+	log.ErrFatal(err)
+	require.Equal(t, 4, len(update.Update))
+	latest := update.Update[3]
+	require.True(t, latest.Roster.ID.Equal(ro3.ID))
+	require.Equal(t, []byte{1}, latest.Data)
+
+	// The old roster signed the transition to the new one.
+	genesis, added := update.Update[0], update.Update[1]
+	fl := genesis.ForwardLink[0]
+	require.True(t, fl.NewRoster.ID.Equal(roster.ID))
+	require.Nil(t, fl.VerifyTransition(genesis, added))
+	require.NotNil(t, fl.VerifyTransition(added, genesis))
+	fl = fl.Copy()
+	fl.NewRoster = nil
+	require.NotNil(t, fl.VerifyTransition(genesis, added))
+}
+
+func TestClient_StreamBlocks(t *testing.T) {
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	blocks := []*SkipBlock{sb}
+	for i := 0; i < 2*streamPrefetch; i++ {
+		reply, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		log.ErrFatal(err)
+		blocks = append(blocks, reply.Latest)
+	}
+
+	stream := c.StreamBlocks(roster, sb.Hash, 0)
+	i := 0
+	for block := range stream.Blocks {
+		require.True(t, blocks[i].Hash.Equal(block.Hash))
+		i++
+	}
+	require.Nil(t, stream.Err())
+	require.Equal(t, len(blocks), i)
+
+	// Start in the middle of the chain and stop early.
+	stream = c.StreamBlocks(roster, sb.Hash, 3)
+	block := <-stream.Blocks
+	require.Equal(t, 3, block.Index)
+	stream.Close()
+	for range stream.Blocks {
+	}
+
+	stream = c.StreamBlocks(roster, sb.Hash, len(blocks))
+	for range stream.Blocks {
+	}
+	require.NotNil(t, stream.Err())
+}
+
+func TestClient_SubscribeBlocks(t *testing.T) {
+	defer func(d time.Duration) { waitNewBlocksTimeout = d }(waitNewBlocksTimeout)
+	waitNewBlocksTimeout = 100 * time.Millisecond
+
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+
+	stream := c.SubscribeBlocks(roster, sb.Hash)
+	// Let the stream time out once before adding blocks.
+	time.Sleep(2 * waitNewBlocksTimeout)
+	var blocks []*SkipBlock
+	for i := 0; i < 3; i++ {
+		reply, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		log.ErrFatal(err)
+		blocks = append(blocks, reply.Latest)
+	}
+	for _, sb := range blocks {
+		select {
+		case block := <-stream.Blocks:
+			require.True(t, sb.Hash.Equal(block.Hash))
+		case <-time.After(time.Second):
+			t.Fatal("didn't get new block")
+		}
+	}
+	stream.Close()
+	for range stream.Blocks {
+	}
+	require.Nil(t, stream.Err())
+
+	stream = c.SubscribeBlocks(roster, SkipBlockID{1, 2, 3})
+	for range stream.Blocks {
+	}
+	require.NotNil(t, stream.Err())
+}
+
 func TestClient_CreateLinkPrivate(t *testing.T) {
 	ls := linked(1)
 	defer ls.local.CloseAll()
@@ -440,6 +699,59 @@ type testData struct {
 	B string
 }
 
+func TestClient_ArchiveSkipchain(t *testing.T) {
+	ls := linked(3)
+	defer ls.local.CloseAll()
+	require.Nil(t, ls.client.CreateLinkPrivate(ls.si, ls.servPriv, ls.pub))
+
+	sb, err := ls.client.CreateGenesis(ls.roster, 2, 3, VerificationNone, nil, nil)
+	require.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = ls.client.StoreSkipBlock(sb, ls.roster, []byte{byte(i)})
+		require.Nil(t, err)
+	}
+	other, err := ls.client.CreateGenesis(ls.roster, 2, 3, VerificationNone, nil, nil)
+	require.Nil(t, err)
+
+	_, err = ls.client.ArchiveSkipchain(ls.si, ls.servPriv, sb.Hash)
+	require.NotNil(t, err)
+	archive, err := ls.client.ArchiveSkipchain(ls.si, ls.priv, sb.Hash)
+	require.Nil(t, err)
+	require.Equal(t, 6, len(archive.Blocks))
+	require.NotNil(t, VerifyArchive(other.Hash, archive))
+
+	fname := filepath.Join(os.TempDir(), "skipchain-archive")
+	defer os.Remove(fname)
+	require.Nil(t, archive.Save(fname))
+	loaded, err := LoadArchive(fname)
+	require.Nil(t, err)
+	require.Nil(t, VerifyArchive(sb.Hash, loaded))
+	loaded.Blocks[2].Data = []byte{0xff}
+	require.NotNil(t, VerifyArchive(sb.Hash, loaded))
+	loaded, err = LoadArchive(fname)
+	require.Nil(t, err)
+	loaded.Blocks = append(loaded.Blocks[:3], loaded.Blocks[4:]...)
+	require.NotNil(t, VerifyArchive(sb.Hash, loaded))
+
+	// A block added after the archive was made must not be lost.
+	_, err = ls.client.StoreSkipBlock(sb, ls.roster, []byte{0xff})
+	require.Nil(t, err)
+	_, err = ls.client.PruneSkipchain(ls.si, ls.priv, archive)
+	require.NotNil(t, err)
+
+	archive, err = ls.client.ArchiveSkipchain(ls.si, ls.priv, sb.Hash)
+	require.Nil(t, err)
+	_, err = ls.client.PruneSkipchain(ls.si, ls.servPriv, archive)
+	require.NotNil(t, err)
+	removed, err := ls.client.PruneSkipchain(ls.si, ls.priv, archive)
+	require.Nil(t, err)
+	require.Equal(t, 7, removed)
+	require.Nil(t, ls.service.db.GetByID(sb.Hash))
+	require.NotNil(t, ls.service.db.GetByID(other.Hash))
+	_, err = ls.client.PruneSkipchain(ls.si, ls.priv, archive)
+	require.NotNil(t, err)
+}
+
 func TestClient_ParallelWrite(t *testing.T) {
 	numClients := 15
 	numWrites := 15
@@ -514,3 +826,34 @@ func TestClient_ParallelWrite(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_GetBlocksWithPredicate(t *testing.T) {
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	for _, s := range servers {
+		log.ErrFatal(RegisterPredicate(s, "odd", func(sb *SkipBlock) bool {
+			return len(sb.Data) == 1 && sb.Data[0]%2 == 1
+		}))
+	}
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 2, 3, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	for i := 0; i < 9; i++ {
+		_, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		log.ErrFatal(err)
+	}
+
+	blocks, err := c.GetBlocksWithPredicate(roster, sb.Hash, "odd")
+	log.ErrFatal(err)
+	require.Equal(t, 4, len(blocks))
+	for i, block := range blocks {
+		require.Equal(t, []byte{byte(2*i + 1)}, block.Data)
+	}
+
+	_, err = c.GetBlocksWithPredicate(roster, sb.Hash, "even")
+	require.NotNil(t, err)
+}
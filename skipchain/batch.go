@@ -0,0 +1,123 @@
+package skipchain
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BatchMerge returns the data of a single block holding the data of all the
+// appends of a batch, in the given order.
+type BatchMerge func(data [][]byte) ([]byte, error)
+
+// Batcher appends the data of several requests to a skipchain in a single
+// block, so that many small appends, like the ballots of an election, don't
+// need one consensus round each. The appends to a chain that arrive within
+// the window of the first one are merged and stored together. As the whole
+// block is verified, a single invalid append makes the other appends of its
+// batch fail, so a service should check the data before appending it.
+type Batcher struct {
+	service *Service
+	window  time.Duration
+	max     int
+	merge   BatchMerge
+
+	sync.Mutex
+	batches map[string]*batch
+}
+
+// batch holds the appends to a chain that wait for the block to be stored.
+type batch struct {
+	genesis SkipBlockID
+	data    [][]byte
+	acks    []chan batchAck
+}
+
+// batchAck is returned to every append of a batch.
+type batchAck struct {
+	block *SkipBlock
+	err   error
+}
+
+// NewBatcher returns a batcher appending to the chains of the service. A
+// batch is stored window after its first append, or as soon as it holds max
+// appends if max is positive.
+func NewBatcher(s *Service, window time.Duration, max int, merge BatchMerge) *Batcher {
+	return &Batcher{
+		service: s,
+		window:  window,
+		max:     max,
+		merge:   merge,
+		batches: make(map[string]*batch),
+	}
+}
+
+// Append adds the data to the next block of the chain. It returns once the
+// block is stored, with the block and the index of the data in the batch.
+func (b *Batcher) Append(genesis SkipBlockID, data []byte) (*SkipBlock, int, error) {
+	ack := make(chan batchAck, 1)
+	b.Lock()
+	bt, ok := b.batches[string(genesis)]
+	if !ok {
+		bt = &batch{genesis: genesis}
+		b.batches[string(genesis)] = bt
+		time.AfterFunc(b.window, func() { b.flush(bt) })
+	}
+	index := len(bt.data)
+	bt.data = append(bt.data, data)
+	bt.acks = append(bt.acks, ack)
+	full := b.max > 0 && len(bt.data) >= b.max
+	b.Unlock()
+
+	if full {
+		b.flush(bt)
+	}
+	a := <-ack
+	return a.block, index, a.err
+}
+
+// flush stores the batch, if it hasn't been stored yet, and acknowledges
+// all its appends.
+func (b *Batcher) flush(bt *batch) {
+	b.Lock()
+	if b.batches[string(bt.genesis)] != bt {
+		b.Unlock()
+		return
+	}
+	delete(b.batches, string(bt.genesis))
+	b.Unlock()
+
+	block, err := b.store(bt)
+	for _, ack := range bt.acks {
+		ack <- batchAck{block, err}
+	}
+}
+
+// store merges the data of the batch and appends it to the chain.
+func (b *Batcher) store(bt *batch) (*SkipBlock, error) {
+	data, err := b.merge(bt.data)
+	if err != nil {
+		return nil, err
+	}
+	db := b.service.db
+	genesis := db.GetByID(bt.genesis)
+	if genesis == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	latest, err := db.GetLatest(genesis)
+	if err != nil {
+		return nil, errors.New("couldn't find latest block: " + err.Error())
+	}
+	block := latest.Copy()
+	block.Data = data
+	block.GenesisID = block.SkipChainID()
+	block.Index++
+	reply, err := b.service.StoreSkipBlock(&StoreSkipBlock{
+		NewBlock:          block,
+		TargetSkipChainID: latest.SkipChainID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Latest, nil
+}
@@ -0,0 +1,166 @@
+package skipchain
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/dedis/onet"
+)
+
+// Chain iterates over the blocks of a skipchain in order. Every block is
+// checked to follow the previous one with a forward link signed by the
+// roster of the previous block, so the blocks can come from an untrusted
+// conode. Once the last block is reached, Next returns the blocks appended
+// since, so a Chain can be kept to follow a skipchain.
+type Chain struct {
+	get     func(SkipBlockID) (*SkipBlock, error)
+	genesis SkipBlockID
+	current *SkipBlock
+	// seeked is returned by the next call to Next.
+	seeked *SkipBlock
+	err    error
+}
+
+// NewChain returns a Chain of the blocks of the skipchain genesis in the
+// database.
+func NewChain(db *SkipBlockDB, genesis SkipBlockID) *Chain {
+	return &Chain{
+		get: func(id SkipBlockID) (*SkipBlock, error) {
+			sb := db.GetByID(id)
+			if sb == nil {
+				return nil, errors.New("didn't find block " + id.Short())
+			}
+			return sb, nil
+		},
+		genesis: genesis,
+	}
+}
+
+// Chain returns a Chain of the blocks of the skipchain genesis, which are
+// fetched from the roster.
+func (c *Client) Chain(roster *onet.Roster, genesis SkipBlockID) *Chain {
+	return &Chain{
+		get: func(id SkipBlockID) (*SkipBlock, error) {
+			return c.GetSingleBlock(roster, id)
+		},
+		genesis: genesis,
+	}
+}
+
+// Next returns the next block of the chain, starting with the genesis
+// block. It returns nil at the end of the chain, or if a block cannot be
+// fetched or verified, in which case Err returns the reason and the Chain
+// stops.
+func (ch *Chain) Next() *SkipBlock {
+	if ch.err != nil {
+		return nil
+	}
+	if ch.seeked != nil {
+		sb := ch.seeked
+		ch.seeked = nil
+		return sb
+	}
+	if ch.current == nil {
+		ch.current, ch.err = ch.getGenesis()
+		return ch.current
+	}
+	if len(ch.current.ForwardLink) == 0 {
+		// Blocks might have been appended since the block was fetched.
+		latest, err := ch.get(ch.current.Hash)
+		if err != nil {
+			ch.err = err
+			return nil
+		}
+		if len(latest.ForwardLink) == 0 {
+			return nil
+		}
+		ch.current = latest
+	}
+	sb, err := ch.follow(ch.current.ForwardLink[0])
+	if err != nil {
+		ch.err = err
+		return nil
+	}
+	ch.current = sb
+	return sb
+}
+
+// Seek moves the chain to the block with the given index, which is returned
+// by the next call to Next. It follows the highest forward links, so that
+// only a logarithmic number of blocks are fetched and verified.
+func (ch *Chain) Seek(index int) error {
+	if ch.err != nil {
+		return ch.err
+	}
+	ch.seeked = nil
+	if ch.current == nil || index < ch.current.Index {
+		genesis, err := ch.getGenesis()
+		if err != nil {
+			return err
+		}
+		ch.current = genesis
+	}
+	for ch.current.Index < index {
+		latest, err := ch.get(ch.current.Hash)
+		if err != nil {
+			return err
+		}
+		var link *ForwardLink
+		jump := 1
+		for i, fl := range latest.ForwardLink {
+			if i > 0 {
+				jump *= latest.BaseHeight
+			}
+			if latest.Index+jump > index {
+				break
+			}
+			link = fl
+		}
+		if link == nil {
+			return errors.New("no block with index " + strconv.Itoa(index))
+		}
+		sb, err := ch.follow(link)
+		if err != nil {
+			return err
+		}
+		ch.current = sb
+	}
+	ch.seeked = ch.current
+	return nil
+}
+
+// Err returns the error that stopped the chain, or nil.
+func (ch *Chain) Err() error {
+	return ch.err
+}
+
+// getGenesis returns the verified genesis block.
+func (ch *Chain) getGenesis() (*SkipBlock, error) {
+	sb, err := ch.get(ch.genesis)
+	if err != nil {
+		return nil, err
+	}
+	if !sb.Hash.Equal(ch.genesis) || !sb.CalculateHash().Equal(ch.genesis) {
+		return nil, errors.New("wrong hash of genesis block")
+	}
+	if sb.Index != 0 {
+		return nil, errors.New("block " + ch.genesis.Short() + " is not a genesis block")
+	}
+	return sb, nil
+}
+
+// follow returns the block the forward link of the current block points to,
+// after checking the link.
+func (ch *Chain) follow(fl *ForwardLink) (*SkipBlock, error) {
+	sb, err := ch.get(fl.To)
+	if err != nil {
+		return nil, err
+	}
+	if err := fl.VerifyTransition(ch.current, sb); err != nil {
+		return nil, err
+	}
+	if !sb.SkipChainID().Equal(ch.genesis) {
+		return nil, errors.New("block " + sb.Hash.Short() + " is not part of the chain")
+	}
+	return sb, nil
+}
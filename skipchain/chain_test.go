@@ -0,0 +1,79 @@
+package skipchain
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	_, el, service := makeHELS(local, 3)
+
+	genesis, err := makeGenesisRosterArgs(service, el, nil, VerificationNone, 2, 3)
+	log.ErrFatal(err)
+	blocks := []*SkipBlock{genesis}
+	latest := genesis
+	for i := 0; i < 8; i++ {
+		sb := NewSkipBlock()
+		sb.Data = []byte{byte(i)}
+		psbr, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: latest.Hash, NewBlock: sb})
+		log.ErrFatal(err)
+		latest = psbr.Latest
+		blocks = append(blocks, latest)
+	}
+
+	log.Lvl1("Iterating over all blocks")
+	chain := NewChain(service.db, genesis.Hash)
+	i := 0
+	for sb := chain.Next(); sb != nil; sb = chain.Next() {
+		require.True(t, blocks[i].Hash.Equal(sb.Hash))
+		i++
+	}
+	require.Nil(t, chain.Err())
+	require.Equal(t, len(blocks), i)
+
+	log.Lvl1("Following a new block")
+	sb := NewSkipBlock()
+	psbr, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: latest.Hash, NewBlock: sb})
+	log.ErrFatal(err)
+	next := chain.Next()
+	require.NotNil(t, next)
+	require.True(t, psbr.Latest.Hash.Equal(next.Hash))
+	require.Nil(t, chain.Next())
+
+	log.Lvl1("Seeking blocks")
+	for _, index := range []int{7, 2, 0, 5} {
+		require.Nil(t, chain.Seek(index))
+		require.True(t, blocks[index].Hash.Equal(chain.Next().Hash))
+		require.True(t, blocks[index+1].Hash.Equal(chain.Next().Hash))
+	}
+	require.NotNil(t, chain.Seek(20))
+
+	log.Lvl1("Refusing a wrong forward link")
+	chain = NewChain(service.db, genesis.Hash)
+	get := chain.get
+	chain.get = func(id SkipBlockID) (*SkipBlock, error) {
+		sb, err := get(id)
+		if err != nil || sb.Index != 2 {
+			return sb, err
+		}
+		sb = sb.Copy()
+		sb.ForwardLink[0].Signature.Sig[0] ^= 1
+		return sb, nil
+	}
+	for i = 0; chain.Next() != nil; i++ {
+	}
+	require.NotNil(t, chain.Err())
+	require.Equal(t, 3, i)
+	require.Nil(t, chain.Next())
+
+	chain = NewChain(service.db, blocks[1].Hash)
+	require.Nil(t, chain.Next())
+	require.NotNil(t, chain.Err())
+}
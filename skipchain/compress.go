@@ -0,0 +1,162 @@
+package skipchain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+)
+
+// Large payloads, like the mixes and boxes of the evoting service, dominate
+// the bandwidth and the size of the database. Both can be reduced with gzip:
+// a client asks for compressed blocks with Client.UseCompression, and a
+// conode only sends them if compression is enabled with
+// Service.SetCompression, which also compresses the blocks it stores.
+
+// compressThreshold is the size in bytes from which data is compressed.
+var compressThreshold = 1024
+
+// maxDecompressed is the maximal size of decompressed data, so that a small
+// payload cannot exhaust the memory.
+var maxDecompressed int64 = 256 * 1024 * 1024
+
+// gzipMagic starts every gzip stream. Blocks marshalled by the network
+// library start with the type of the message, so the values of the database
+// that don't decompress are read as they are.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// UseCompression asks the conodes to send the blocks with compressed data,
+// which only happens if they enabled compression. The blocks are
+// decompressed before they are returned.
+func (c *Client) UseCompression(enabled bool) {
+	c.compress = enabled
+}
+
+// SetCompression enables the compression of the data of the blocks sent to
+// the clients asking for it, and of the blocks stored in the database.
+// Blocks that were stored without compression can still be read, and so can
+// the compressed blocks once it is disabled again.
+func (s *Service) SetCompression(enabled bool) {
+	var compress int32
+	if enabled {
+		compress = 1
+	}
+	atomic.StoreInt32(&s.db.compress, compress)
+}
+
+// compressing returns true if compression is enabled.
+func (db *SkipBlockDB) compressing() bool {
+	return atomic.LoadInt32(&db.compress) == 1
+}
+
+// compressBlocks returns the blocks with compressed data if the client asked
+// for it and compression is enabled.
+func (s *Service) compressBlocks(compress bool, blocks []*SkipBlock) []*SkipBlock {
+	if !compress || !s.db.compressing() {
+		return blocks
+	}
+	compressed := make([]*SkipBlock, len(blocks))
+	for i, sb := range blocks {
+		compressed[i] = sb.compressed()
+	}
+	return compressed
+}
+
+// compressed returns a copy of the block with its data compressed, or the
+// block itself if its data is small or doesn't compress.
+func (sb *SkipBlock) compressed() *SkipBlock {
+	if sb.Compressed || len(sb.Data) < compressThreshold {
+		return sb
+	}
+	data, err := gzipBytes(sb.Data)
+	if err != nil || len(data) >= len(sb.Data) {
+		return sb
+	}
+	c := sb.Copy()
+	c.Data = data
+	c.Compressed = true
+	return c
+}
+
+// Decompress restores the data of a block received compressed. Its hash
+// can only be verified afterwards.
+func (sb *SkipBlock) Decompress() error {
+	if !sb.Compressed {
+		return nil
+	}
+	data, err := gunzipBytes(sb.Data)
+	if err != nil {
+		return err
+	}
+	sb.Data = data
+	sb.Compressed = false
+	return nil
+}
+
+// decompressBlocks decompresses all the blocks.
+func decompressBlocks(blocks []*SkipBlock) error {
+	for _, sb := range blocks {
+		if err := sb.Decompress(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshal returns the block as stored in the database, compressed if it is
+// enabled and the block is large enough.
+func (db *SkipBlockDB) marshal(sb *SkipBlock) ([]byte, error) {
+	buf, err := network.Marshal(sb)
+	if err != nil || !db.compressing() || len(buf) < compressThreshold {
+		return buf, err
+	}
+	compressed, err := gzipBytes(buf)
+	if err != nil || len(compressed) >= len(buf) {
+		return buf, nil
+	}
+	return compressed, nil
+}
+
+// unmarshal reads a value of the database, which is compressed or not.
+func (db *SkipBlockDB) unmarshal(buf []byte) (network.Message, error) {
+	if bytes.HasPrefix(buf, gzipMagic) {
+		if plain, err := gunzipBytes(buf); err == nil {
+			buf = plain
+		}
+	}
+	_, msg, err := network.Unmarshal(buf, cothority.Suite)
+	return msg, err
+}
+
+func gzipBytes(buf []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w := gzip.NewWriter(&out)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func gunzipBytes(buf []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	plain, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressed+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(plain)) > maxDecompressed {
+		return nil, errors.New("decompressed data is too large")
+	}
+	return plain, nil
+}
@@ -17,6 +17,18 @@ func init() {
 		&GetUpdateChainReply{},
 		// Request updated block
 		&GetSingleBlock{},
+		// Request a range of blocks
+		&GetBlocksByIndexRange{},
+		&GetBlocksByIndexRangeReply{},
+		// Request the blocks matching a predicate
+		&GetBlocksWithPredicate{},
+		&GetBlocksWithPredicateReply{},
+		// Request an inclusion proof
+		&GetInclusionProof{},
+		&GetInclusionProofReply{},
+		// Wait for new blocks
+		&WaitNewBlocks{},
+		&WaitNewBlocksReply{},
 		// Fetch all skipchains
 		&GetAllSkipchains{},
 		&GetAllSkipchainsReply{},
@@ -40,6 +52,14 @@ func init() {
 		&ListFollow{},
 		// Returns the genesis-blocks of all skipchains we follow
 		&ListFollowReply{},
+		// Archiving and pruning a skipchain
+		&ArchiveSkipchain{},
+		&ArchiveSkipchainReply{},
+		&PruneSkipchain{},
+		&PruneSkipchainReply{},
+		// Repairing skipchains from the other conodes
+		&RepairSkipchain{},
+		&RepairSkipchainReply{},
 		// - Internal calls
 		// Propagation
 		&PropagateSkipBlocks{},
@@ -48,6 +68,7 @@ func init() {
 		// - Data structures
 		&SkipBlockFix{},
 		&SkipBlock{},
+		&Archive{},
 		// Own service
 		&Service{},
 		// - Protocol messages
@@ -85,6 +106,8 @@ type StoreSkipBlockReply struct {
 // to get to the latest.
 type GetUpdateChain struct {
 	LatestID SkipBlockID
+	// Compress asks for the data of the blocks to be compressed.
+	Compress bool
 }
 
 // GetUpdateChainReply - returns the shortest chain to the current SkipBlock,
@@ -127,6 +150,8 @@ type ForwardSignature struct {
 // GetSingleBlock asks for a single block.
 type GetSingleBlock struct {
 	ID SkipBlockID
+	// Compress asks for the data of the block to be compressed.
+	Compress bool
 }
 
 // GetSingleBlockByIndex asks for a single block at a certain index. If Index == -1,
@@ -134,6 +159,65 @@ type GetSingleBlock struct {
 type GetSingleBlockByIndex struct {
 	Genesis SkipBlockID
 	Index   int
+	// Compress asks for the data of the block to be compressed.
+	Compress bool
+}
+
+// GetBlocksByIndexRange asks for the blocks with an index from From to To,
+// both included. If To == -1, the blocks up to the last one are returned. At
+// most MaxBlocksByIndexRange blocks are returned.
+type GetBlocksByIndexRange struct {
+	Genesis SkipBlockID
+	From    int
+	To      int
+	// Compress asks for the data of the blocks to be compressed.
+	Compress bool
+}
+
+// GetBlocksByIndexRangeReply returns the requested blocks in order, with
+// their forward links.
+type GetBlocksByIndexRangeReply struct {
+	Blocks []*SkipBlock
+}
+
+// GetBlocksWithPredicate asks for the blocks of the skipchain from index
+// From on that match the predicate registered under the name Predicate, see
+// RegisterPredicate.
+type GetBlocksWithPredicate struct {
+	Genesis   SkipBlockID
+	Predicate string
+	From      int
+}
+
+// GetBlocksWithPredicateReply returns the matching blocks in order. At most
+// MaxBlocksByIndexRange blocks are returned, and Next is the index to
+// continue from, or -1 if the end of the chain was reached.
+type GetBlocksWithPredicateReply struct {
+	Blocks []*SkipBlock
+	Next   int
+}
+
+// GetInclusionProof asks for a proof that the block is part of its
+// skipchain.
+type GetInclusionProof struct {
+	ID SkipBlockID
+}
+
+// GetInclusionProofReply returns the proof, see VerifyInclusionProof.
+type GetInclusionProofReply struct {
+	Proof *InclusionProof
+}
+
+// WaitNewBlocks asks for the blocks following Latest, waiting for a new one
+// if Latest is the last block of its skipchain.
+type WaitNewBlocks struct {
+	Latest SkipBlockID
+}
+
+// WaitNewBlocksReply returns the new blocks in order. It is empty if no
+// block was added before the conode stopped waiting.
+type WaitNewBlocksReply struct {
+	Blocks []*SkipBlock
 }
 
 // Internal calls
@@ -296,3 +380,50 @@ type ListFollowReply struct {
 	Follow    *[]FollowChainType
 	FollowIDs *[]SkipBlockID
 }
+
+// ArchiveSkipchain asks for all the blocks of a skipchain. The signature has
+// to be on the following message:
+// "archive:" + SkipchainID
+type ArchiveSkipchain struct {
+	SkipchainID SkipBlockID
+	Signature   []byte
+}
+
+// ArchiveSkipchainReply returns the archive of the skipchain.
+type ArchiveSkipchainReply struct {
+	Archive *Archive
+}
+
+// PruneSkipchain removes all the blocks of a skipchain from the conode.
+// Latest must be the last block of the chain, so that blocks added after the
+// chain was archived are not lost. The signature has to be on the following
+// message:
+// "prune:" + SkipchainID + Latest
+type PruneSkipchain struct {
+	SkipchainID SkipBlockID
+	Latest      SkipBlockID
+	Signature   []byte
+}
+
+// PruneSkipchainReply returns how many blocks were removed.
+type PruneSkipchainReply struct {
+	Removed int
+}
+
+// RepairSkipchain fetches the blocks and forward links of a skipchain that
+// the conode misses from the other nodes of the roster. All skipchains of the
+// conode are repaired if SkipchainID is empty. The signature has to be on the
+// following message:
+// "repair:" + SkipchainID
+type RepairSkipchain struct {
+	SkipchainID SkipBlockID
+	Signature   []byte
+}
+
+// RepairSkipchainReply returns how many blocks and forward links were
+// stored, and the divergences that couldn't be repaired.
+type RepairSkipchainReply struct {
+	Blocks       int
+	ForwardLinks int
+	Divergences  []string
+}
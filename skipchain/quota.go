@@ -0,0 +1,304 @@
+package skipchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// Every service stores its data in skipchains, so one runaway election or
+// OCS user can fill the disk of the conode and take down all services. A
+// Quota limits the bytes of the blocks of the skipchains of one service,
+// which are found by their verifiers. A block that would exceed the quota
+// is refused, unless the EvictionPolicy frees enough space first, e.g. by
+// archiving and pruning finished skipchains with Evict.
+
+// Quota limits the size of the skipchains of a service.
+type Quota struct {
+	// Service is the name of the service, used in the status and errors
+	Service string
+	// MaxBytes is the maximal size of all blocks of the skipchains
+	MaxBytes int64
+	// Verifiers select the skipchains of the service: a skipchain belongs
+	// to the first quota with one of its verifiers. A quota without
+	// verifiers holds all skipchains of no other quota.
+	Verifiers []VerifierID
+}
+
+// QuotaUsage is the space used by the skipchains of a quota.
+type QuotaUsage struct {
+	Quota *Quota
+	// Bytes is the size of all blocks of the skipchains of the quota
+	Bytes int64
+	// Chains are the skipchains of the quota, sorted by ID
+	Chains []*ChainUsage
+}
+
+// ChainUsage is the space used by one skipchain.
+type ChainUsage struct {
+	ID    SkipBlockID
+	Bytes int64
+}
+
+// EvictionPolicy is called when a new block of size bytes would exceed the
+// quota. It can free space, e.g. with Service.Evict, and returns true if
+// the quota has to be checked again. The skipchain of the new block is not
+// in the usage, as it is locked while the block is added.
+type EvictionPolicy func(usage *QuotaUsage, size int64) bool
+
+// quotas holds the state of the quotas that is not saved.
+type quotas struct {
+	sync.Mutex
+	policy EvictionPolicy
+	// owners caches the quota of every skipchain, by service name.
+	owners map[string]string
+	// refused counts the blocks refused per service.
+	refused map[string]int
+}
+
+// SetQuota sets the quota of the service named in q, replacing its previous
+// quota. A quota with MaxBytes of 0 is removed. As the blocks over the quota
+// are refused, all conodes of a skipchain should use the same quotas.
+func (s *Service) SetQuota(q *Quota) {
+	s.storageMutex.Lock()
+	var list []*Quota
+	for _, other := range s.Storage.Quotas {
+		if other.Service != q.Service {
+			list = append(list, other)
+		}
+	}
+	if q.MaxBytes > 0 {
+		list = append(list, q)
+	}
+	s.Storage.Quotas = list
+	s.storageMutex.Unlock()
+	s.quotas.Lock()
+	s.quotas.owners = nil
+	s.quotas.Unlock()
+	s.save()
+}
+
+// SetEvictionPolicy sets the policy called when a quota is exceeded. A nil
+// policy refuses the blocks over the quota.
+func (s *Service) SetEvictionPolicy(policy EvictionPolicy) {
+	s.quotas.Lock()
+	defer s.quotas.Unlock()
+	s.quotas.policy = policy
+}
+
+// Evict archives the skipchain in a file of the directory, named after the
+// ID of the skipchain, and prunes it from the database. It can be used by
+// an EvictionPolicy, but not for the skipchain of the new block.
+func (s *Service) Evict(id SkipBlockID, dir string) error {
+	archive, err := s.db.Archive(id)
+	if err != nil {
+		return err
+	}
+	if err := archive.Save(filepath.Join(dir, fmt.Sprintf("%x.archive", []byte(id)))); err != nil {
+		return err
+	}
+	removed, err := s.prune(id, archive.Latest().Hash)
+	if err != nil {
+		return err
+	}
+	log.Lvlf2("%s: evicted %d blocks of skipchain %x", s.ServerIdentity(), removed, id)
+	return nil
+}
+
+// QuotaUsages returns the usage of all quotas.
+func (s *Service) QuotaUsages() ([]*QuotaUsage, error) {
+	s.storageMutex.Lock()
+	list := append([]*Quota{}, s.Storage.Quotas...)
+	s.storageMutex.Unlock()
+	var usages []*QuotaUsage
+	for _, q := range list {
+		u, err := s.quotaUsage(q, nil)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+	return usages, nil
+}
+
+// GetStatus returns the status of the database, and the usage and the
+// refused blocks of every quota.
+func (s *Service) GetStatus() *onet.Status {
+	status := s.db.GetStatus()
+	usages, err := s.QuotaUsages()
+	if err != nil {
+		log.Error("couldn't get the quotas:", err)
+		return status
+	}
+	s.quotas.Lock()
+	defer s.quotas.Unlock()
+	for _, u := range usages {
+		name := u.Quota.Service
+		status.Field["Quota "+name] = fmt.Sprintf("%d/%d", u.Bytes, u.Quota.MaxBytes)
+		status.Field["QuotaRefused "+name] = strconv.Itoa(s.quotas.refused[name])
+	}
+	return status
+}
+
+// checkQuota returns an error if the block would exceed the quota of its
+// skipchain, after asking the eviction policy to free space.
+func (s *Service) checkQuota(sb *SkipBlock) error {
+	q := s.quotaOf(sb)
+	if q == nil {
+		return nil
+	}
+	buf, err := s.db.marshal(sb)
+	if err != nil {
+		return err
+	}
+	size := int64(len(buf))
+	for evicted := false; ; evicted = true {
+		u, err := s.quotaUsage(q, sb.SkipChainID())
+		if err != nil {
+			return err
+		}
+		if u.Bytes+size <= q.MaxBytes {
+			return nil
+		}
+		s.quotas.Lock()
+		policy := s.quotas.policy
+		s.quotas.Unlock()
+		if evicted || policy == nil || !policy(u, size) {
+			break
+		}
+	}
+	s.quotas.Lock()
+	if s.quotas.refused == nil {
+		s.quotas.refused = make(map[string]int)
+	}
+	s.quotas.refused[q.Service]++
+	s.quotas.Unlock()
+	return errors.New("storage quota of " + q.Service + " exceeded")
+}
+
+// quotaOf returns the quota of the skipchain of the block, or nil.
+func (s *Service) quotaOf(sb *SkipBlock) *Quota {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	var others *Quota
+	for _, q := range s.Storage.Quotas {
+		if len(q.Verifiers) == 0 {
+			if others == nil {
+				others = q
+			}
+			continue
+		}
+		for _, v := range q.Verifiers {
+			for _, bv := range sb.VerifierIDs {
+				if v.Equal(bv) {
+					return q
+				}
+			}
+		}
+	}
+	return others
+}
+
+// quotaUsage returns the usage of the quota. The bytes of the skipchain
+// skip are counted, but the skipchain is not listed.
+func (s *Service) quotaUsage(q *Quota, skip SkipBlockID) (*QuotaUsage, error) {
+	chains, err := s.db.ChainUsage()
+	if err != nil {
+		return nil, err
+	}
+	u := &QuotaUsage{Quota: q}
+	for id, size := range chains {
+		if s.ownerOf(SkipBlockID(id)) != q.Service {
+			continue
+		}
+		u.Bytes += size
+		if !SkipBlockID(id).Equal(skip) {
+			u.Chains = append(u.Chains, &ChainUsage{ID: SkipBlockID(id), Bytes: size})
+		}
+	}
+	sort.Slice(u.Chains, func(i, j int) bool {
+		return bytes.Compare(u.Chains[i].ID, u.Chains[j].ID) < 0
+	})
+	return u, nil
+}
+
+// ownerOf returns the name of the quota of the skipchain, or "".
+func (s *Service) ownerOf(id SkipBlockID) string {
+	s.quotas.Lock()
+	owner, ok := s.quotas.owners[string(id)]
+	s.quotas.Unlock()
+	if ok {
+		return owner
+	}
+	genesis := s.db.GetByID(id)
+	if genesis == nil {
+		// The skipchain is not cached, as its genesis block might still
+		// be fetched.
+		return ""
+	}
+	if q := s.quotaOf(genesis); q != nil {
+		owner = q.Service
+	}
+	s.quotas.Lock()
+	if s.quotas.owners == nil {
+		s.quotas.owners = make(map[string]string)
+	}
+	s.quotas.owners[string(id)] = owner
+	s.quotas.Unlock()
+	return owner
+}
+
+// ChainUsage returns the bytes stored per skipchain, by skipchain ID. They
+// are counted the first time and kept up to date afterwards.
+func (db *SkipBlockDB) ChainUsage() (map[string]int64, error) {
+	db.usageMutex.Lock()
+	defer db.usageMutex.Unlock()
+	if db.usage == nil {
+		usage := make(map[string]int64)
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(db.bucketName)).ForEach(func(k, v []byte) error {
+				msg, err := db.unmarshal(v)
+				if err != nil {
+					return err
+				}
+				if sb, ok := msg.(*SkipBlock); ok {
+					usage[string(sb.SkipChainID())] += int64(len(v))
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		db.usage = usage
+	}
+	usage := make(map[string]int64, len(db.usage))
+	for id, size := range db.usage {
+		usage[id] = size
+	}
+	return usage, nil
+}
+
+// account adds delta bytes to the usage of the skipchain, if it is counted.
+func (db *SkipBlockDB) account(id SkipBlockID, delta int64) {
+	db.usageMutex.Lock()
+	defer db.usageMutex.Unlock()
+	if db.usage != nil {
+		db.usage[string(id)] += delta
+	}
+}
+
+// forget removes the usage of a pruned skipchain.
+func (db *SkipBlockDB) forget(id SkipBlockID) {
+	db.usageMutex.Lock()
+	defer db.usageMutex.Unlock()
+	delete(db.usage, string(id))
+}
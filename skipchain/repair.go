@@ -0,0 +1,185 @@
+package skipchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// repairBatch is the number of blocks asked at once from every node while
+// repairing a skipchain.
+const repairBatch = 10
+
+// RepairSkipchain compares the blocks of the skipchain, or of all the
+// skipchains of the conode if SkipchainID is empty, with the other nodes of
+// their rosters. Missing blocks and forward links are fetched, verified and
+// stored, and the divergences that cannot be repaired are returned. This is
+// needed after a conode was restored from an old backup.
+func (s *Service) RepairSkipchain(req *RepairSkipchain) (*RepairSkipchainReply, error) {
+	msg := append([]byte("repair:"), req.SkipchainID...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+	var genesis []SkipBlockID
+	if len(req.SkipchainID) > 0 {
+		genesis = append(genesis, req.SkipchainID)
+	} else {
+		blocks, err := s.db.getAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, sb := range blocks {
+			if sb.Index == 0 {
+				genesis = append(genesis, sb.Hash)
+			}
+		}
+	}
+	reply := &RepairSkipchainReply{}
+	for _, scid := range genesis {
+		if err := s.repairChain(scid, reply); err != nil {
+			reply.Divergences = append(reply.Divergences,
+				fmt.Sprintf("skipchain %x: %v", []byte(scid), err))
+		}
+	}
+	log.Lvlf2("%s: repaired %d skipchains, fetched %d blocks and %d forward links",
+		s.ServerIdentity(), len(genesis), reply.Blocks, reply.ForwardLinks)
+	return reply, nil
+}
+
+// repairChain walks the skipchain from its genesis block, which has to be
+// in the database, and asks the other nodes of the roster of every batch of
+// blocks for their copy of them. It returns an error if the chain cannot be
+// followed up to its end.
+func (s *Service) repairChain(scid SkipBlockID, reply *RepairSkipchainReply) error {
+	s.chains.lock(scid)
+	defer s.chains.unlock(scid)
+
+	current := s.db.GetByID(scid)
+	if current == nil || current.Index != 0 {
+		return errors.New("no such genesis-block")
+	}
+	if !current.CalculateHash().Equal(current.Hash) {
+		return errors.New("wrong hash of genesis-block")
+	}
+	for {
+		for _, si := range current.Roster.List {
+			if si.Equal(s.ServerIdentity()) {
+				continue
+			}
+			blocks, err := s.fetchBlocks(si, current.Hash, repairBatch)
+			if err != nil {
+				log.Lvlf2("%s: couldn't get blocks from %s: %v", s.ServerIdentity(), si, err)
+				continue
+			}
+			for _, sb := range blocks {
+				if err := s.repairBlock(sb, reply); err != nil {
+					reply.Divergences = append(reply.Divergences, fmt.Sprintf(
+						"skipchain %x, block %d from %s: %v", []byte(scid), sb.Index, si, err))
+					break
+				}
+			}
+		}
+
+		// Follow the blocks that could be repaired, up to the last block of
+		// the batch, which starts the next one.
+		current = s.db.GetByID(current.Hash)
+		for i := 1; i < repairBatch; i++ {
+			if len(current.ForwardLink) == 0 {
+				return nil
+			}
+			fl := current.ForwardLink[0]
+			next := s.db.GetByID(fl.To)
+			if next == nil {
+				return fmt.Errorf("block %d is missing on all reachable nodes", current.Index+1)
+			}
+			if err := fl.VerifyTransition(current, next); err != nil {
+				return fmt.Errorf("block %d: %v", next.Index, err)
+			}
+			current = next
+		}
+	}
+}
+
+// repairBlock stores the block from another node if it is missing and the
+// previous block links to it, or adds the forward links the stored copy
+// misses. It returns an error if the block diverges from the stored one.
+func (s *Service) repairBlock(sb *SkipBlock, reply *RepairSkipchainReply) error {
+	if !sb.CalculateHash().Equal(sb.Hash) {
+		return errors.New("wrong hash")
+	}
+	local := s.db.GetByID(sb.Hash)
+	if local == nil {
+		if sb.Index == 0 || len(sb.BackLinkIDs) == 0 {
+			return errors.New("unknown genesis-block")
+		}
+		prev := s.db.GetByID(sb.BackLinkIDs[0])
+		if prev == nil || len(prev.ForwardLink) == 0 {
+			return errors.New("previous block is not linked to it")
+		}
+		if err := prev.ForwardLink[0].VerifyTransition(prev, sb); err != nil {
+			return err
+		}
+		if err := sb.VerifyForwardSignatures(); err != nil {
+			return err
+		}
+		s.storeBlock(sb)
+		reply.Blocks++
+		return nil
+	}
+
+	missing := 0
+	for i, fl := range sb.ForwardLink {
+		if i < len(local.ForwardLink) {
+			if !fl.To.Equal(local.ForwardLink[i].To) {
+				return fmt.Errorf("forward link %d points to another block", i)
+			}
+			continue
+		}
+		if !fl.From.Equal(local.Hash) {
+			return fmt.Errorf("forward link %d doesn't start at the block", i)
+		}
+		if err := fl.Verify(cothority.Suite, local.Roster.Publics()); err != nil {
+			return fmt.Errorf("forward link %d: %v", i, err)
+		}
+		missing++
+	}
+	if missing > 0 {
+		if s.db.Store(sb) == nil {
+			return errors.New("couldn't store the forward links")
+		}
+		reply.ForwardLinks += missing
+	}
+	return nil
+}
+
+// fetchBlocks returns up to n blocks of si, following the level-0 forward
+// links from id.
+func (s *Service) fetchBlocks(si *network.ServerIdentity, id SkipBlockID, n int) ([]*SkipBlock, error) {
+	roster := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity(), si})
+	pi, err := s.CreateProtocol(ProtocolGetBlocks, roster.GenerateStar())
+	if err != nil {
+		return nil, err
+	}
+	pisc := pi.(*GetBlocks)
+	pisc.GetBlocks = &ProtoGetBlocks{
+		SBID:  id,
+		Count: n,
+	}
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+	select {
+	case result := <-pisc.GetBlocksReply:
+		if len(result) == 0 || !result[0].Hash.Equal(id) {
+			return nil, errors.New("didn't get the requested block")
+		}
+		return result, nil
+	case <-time.After(s.propTimeout):
+		return nil, errors.New("timeout waiting for GetBlocks reply")
+	}
+}
@@ -53,6 +53,7 @@ type Service struct {
 	db                      *SkipBlockDB
 	propagate               messaging.PropagationFunc
 	verifiers               map[VerifierID]SkipBlockVerifier
+	predicates              map[string]BlockPredicate
 	storageMutex            sync.Mutex
 	Storage                 *Storage
 	bftTimeout              time.Duration
@@ -60,6 +61,9 @@ type Service struct {
 	chains                  chainLocker
 	verifyNewBlockBuffer    sync.Map
 	verifyFollowBlockBuffer sync.Map
+	subscribers             subscribers
+	bus                     bus
+	quotas                  quotas
 }
 
 type chainLocker struct {
@@ -123,6 +127,84 @@ func (cl *chainLocker) numLocks() (ret int) {
 	return
 }
 
+// subscribers holds the channels that are notified of the new blocks of a
+// skipchain, see Service.Subscribe.
+type subscribers struct {
+	sync.Mutex
+	// the key is the skipchain ID as a string.
+	chains map[string][]chan *SkipBlock
+}
+
+// bus holds the handlers that are called with every new block, see
+// RegisterBlockHandler.
+type bus struct {
+	sync.Mutex
+	handlers []BlockHandler
+}
+
+func (b *bus) add(f BlockHandler) {
+	b.Lock()
+	defer b.Unlock()
+	b.handlers = append(b.handlers, f)
+}
+
+// publish calls all handlers with the block, in the order they have been
+// registered. The handlers are called synchronously, so that the blocks of a
+// skipchain reach them in the order they are stored, and they have to
+// return quickly.
+func (b *bus) publish(sb *SkipBlock) {
+	b.Lock()
+	handlers := append([]BlockHandler{}, b.handlers...)
+	b.Unlock()
+	for _, f := range handlers {
+		f(sb)
+	}
+}
+
+// subscribeBuffer is the number of blocks a subscription holds before new
+// blocks are dropped.
+const subscribeBuffer = 16
+
+func (ss *subscribers) add(genesis SkipBlockID) chan *SkipBlock {
+	ss.Lock()
+	defer ss.Unlock()
+	if ss.chains == nil {
+		ss.chains = make(map[string][]chan *SkipBlock)
+	}
+	c := make(chan *SkipBlock, subscribeBuffer)
+	ss.chains[string(genesis)] = append(ss.chains[string(genesis)], c)
+	return c
+}
+
+func (ss *subscribers) remove(genesis SkipBlockID, c chan *SkipBlock) {
+	ss.Lock()
+	defer ss.Unlock()
+	key := string(genesis)
+	for i, sub := range ss.chains[key] {
+		if sub == c {
+			ss.chains[key] = append(ss.chains[key][:i], ss.chains[key][i+1:]...)
+			break
+		}
+	}
+	if len(ss.chains[key]) == 0 {
+		delete(ss.chains, key)
+	}
+}
+
+// notify sends the block to all the subscribers of its skipchain without
+// blocking: a subscriber that is too slow misses the block.
+func (ss *subscribers) notify(sb *SkipBlock) {
+	ss.Lock()
+	defer ss.Unlock()
+	for _, c := range ss.chains[string(sb.SkipChainID())] {
+		select {
+		case c <- sb:
+		default:
+			log.Lvl2("dropping block for slow subscriber:", sb.Hash)
+		}
+	}
+}
+
 // Storage is saved to disk.
 type Storage struct {
 	// Follow is a slice of latest blocks that point to skipchains that are allowed
@@ -135,6 +217,8 @@ type Storage struct {
 	// to this service. Once a client is linked to a service, only blocks signed
 	// by this client will be allowed.
 	Clients []kyber.Point
+	// Quotas limit the size of the skipchains of the services, see SetQuota.
+	Quotas []*Quota
 }
 
 // StoreSkipBlock stores a new skipblock in the system. This can be either a
@@ -188,6 +272,9 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 		if err != nil {
 			return nil, err
 		}
+		if err := s.checkQuota(prop); err != nil {
+			return nil, err
+		}
 
 		if !prop.ParentBlockID.IsNull() {
 			parent := s.db.GetByID(prop.ParentBlockID)
@@ -309,6 +396,9 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 			prop.BackLinkIDs[h] = pointer.Hash
 		}
 		prop.updateHash()
+		if err := s.checkQuota(prop); err != nil {
+			return nil, err
+		}
 
 		// Only check changing roster, or if this is the block after the genesis-block,
 		// as we don't verify the roster for the genesis-block.
@@ -394,7 +484,7 @@ func (s *Service) GetUpdateChain(guc *GetUpdateChain) (*GetUpdateChainReply, err
 		blocks = append(blocks, next.Copy())
 	}
 	log.Lvl3("Found", len(blocks), "blocks")
-	reply := &GetUpdateChainReply{Update: blocks}
+	reply := &GetUpdateChainReply{Update: s.compressBlocks(guc.Compress, blocks)}
 
 	return reply, nil
 }
@@ -428,7 +518,7 @@ func (s *Service) syncChain(roster *onet.Roster, latest SkipBlockID) error {
 			if err := sb.VerifyForwardSignatures(); err != nil {
 				return err
 			}
-			s.db.Store(sb)
+			s.storeBlock(sb)
 			if len(sb.ForwardLink) == 0 {
 				return nil
 			}
@@ -504,12 +594,23 @@ func (s *Service) GetSingleBlock(id *GetSingleBlock) (*SkipBlock, error) {
 		return nil, errors.New("No such block")
 
 	}
+	if id.Compress && s.db.compressing() {
+		return sb.compressed(), nil
+	}
 	return sb, nil
 }
 
 // GetSingleBlockByIndex searches for the given block and returns it. If no such block is
 // found, a nil is returned. An index of -1 means "the latest block on the skipchain".
 func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock, error) {
+	sb, err := s.getSingleBlockByIndex(id)
+	if err != nil || !id.Compress || !s.db.compressing() {
+		return sb, err
+	}
+	return sb.compressed(), nil
+}
+
+func (s *Service) getSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock, error) {
 	sb := s.db.GetByID(id.Genesis)
 	if sb == nil {
 		return nil, errors.New("No such genesis-block")
@@ -533,6 +634,127 @@ func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock,
 	return nil, errors.New("No block with this index found")
 }
 
+// MaxBlocksByIndexRange is the maximum number of blocks returned by
+// GetBlocksByIndexRange.
+const MaxBlocksByIndexRange = 100
+
+// GetBlocksByIndexRange returns the blocks of the skipchain from index
+// From to To. The start block is found using the highest forward links, and
+// the range stops early at the end of the chain or after
+// MaxBlocksByIndexRange blocks.
+func (s *Service) GetBlocksByIndexRange(req *GetBlocksByIndexRange) (*GetBlocksByIndexRangeReply, error) {
+	sb := s.db.GetByID(req.Genesis)
+	if sb == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+	if req.From < 0 || req.To != -1 && req.To < req.From {
+		return nil, errors.New("invalid range")
+	}
+	sb, err := s.jumpToIndex(sb, req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &GetBlocksByIndexRangeReply{}
+	for sb != nil && (req.To == -1 || sb.Index <= req.To) &&
+		len(reply.Blocks) < MaxBlocksByIndexRange {
+		reply.Blocks = append(reply.Blocks, sb)
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		sb = s.db.GetByID(sb.ForwardLink[0].To)
+	}
+	reply.Blocks = s.compressBlocks(req.Compress, reply.Blocks)
+	return reply, nil
+}
+
+// GetInclusionProof returns the path from the genesis block to the given
+// block, following the highest forward links that don't go past it. Every
+// block of the path only keeps the forward link to the next one.
+func (s *Service) GetInclusionProof(req *GetInclusionProof) (*GetInclusionProofReply, error) {
+	target := s.db.GetByID(req.ID)
+	if target == nil {
+		return nil, errors.New("No such block")
+	}
+	sb := s.db.GetByID(target.SkipChainID())
+	if sb == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+
+	proof := &InclusionProof{}
+	for !sb.Hash.Equal(target.Hash) {
+		var link *ForwardLink
+		var next *SkipBlock
+		for i := len(sb.ForwardLink) - 1; i >= 0; i-- {
+			b := s.db.GetByID(sb.ForwardLink[i].To)
+			if b != nil && b.Index <= target.Index {
+				link, next = sb.ForwardLink[i], b
+				break
+			}
+		}
+		if next == nil {
+			return nil, errors.New("didn't find block in forward link")
+		}
+		proof.Blocks = append(proof.Blocks, &SkipBlock{
+			SkipBlockFix: sb.SkipBlockFix,
+			Hash:         sb.Hash,
+			ForwardLink:  []*ForwardLink{link},
+		})
+		sb = next
+	}
+	proof.Blocks = append(proof.Blocks, &SkipBlock{
+		SkipBlockFix: sb.SkipBlockFix,
+		Hash:         sb.Hash,
+	})
+	return &GetInclusionProofReply{Proof: proof}, nil
+}
+
+// waitNewBlocksTimeout is how long WaitNewBlocks waits for a new block
+// before returning an empty reply.
+var waitNewBlocksTimeout = 30 * time.Second
+
+// WaitNewBlocks returns the blocks following req.Latest. If there are none
+// yet, it waits until a new block is stored or until waitNewBlocksTimeout
+// passed, in which case no blocks are returned. Clients call it in a loop to
+// follow a skipchain without polling, see Client.SubscribeBlocks.
+func (s *Service) WaitNewBlocks(req *WaitNewBlocks) (*WaitNewBlocksReply, error) {
+	latest := s.db.GetByID(req.Latest)
+	if latest == nil {
+		return nil, errors.New("No such block")
+	}
+	// Subscribe before looking at the database, so that no block stored in
+	// between is missed.
+	blocks, cancel := s.Subscribe(latest.SkipChainID())
+	defer cancel()
+	if after := s.blocksAfter(req.Latest); len(after) > 0 {
+		return &WaitNewBlocksReply{Blocks: after}, nil
+	}
+	select {
+	case sb := <-blocks:
+		// The forward link to the new block might not be stored yet.
+		if after := s.blocksAfter(req.Latest); len(after) > 0 {
+			return &WaitNewBlocksReply{Blocks: after}, nil
+		}
+		return &WaitNewBlocksReply{Blocks: []*SkipBlock{sb}}, nil
+	case <-time.After(waitNewBlocksTimeout):
+		return &WaitNewBlocksReply{}, nil
+	}
+}
+
+// blocksAfter returns up to MaxBlocksByIndexRange blocks following the
+// given block.
+func (s *Service) blocksAfter(id SkipBlockID) []*SkipBlock {
+	var blocks []*SkipBlock
+	sb := s.db.GetByID(id)
+	for sb != nil && len(sb.ForwardLink) > 0 && len(blocks) < MaxBlocksByIndexRange {
+		sb = s.db.GetByID(sb.ForwardLink[0].To)
+		if sb != nil {
+			blocks = append(blocks, sb)
+		}
+	}
+	return blocks
+}
+
 // GetAllSkipchains returns a list of all known skipchains
 func (s *Service) GetAllSkipchains(id *GetAllSkipchains) (*GetAllSkipchainsReply, error) {
 	// Write all known skipblocks to a map, thus removing double blocks.
@@ -746,11 +968,86 @@ func (s *Service) ListFollow(list *ListFollow) (*ListFollowReply, error) {
 	return reply, nil
 }
 
+// ArchiveSkipchain returns all the blocks of the skipchain, so that it can
+// be kept outside of the conode before being pruned.
+func (s *Service) ArchiveSkipchain(req *ArchiveSkipchain) (*ArchiveSkipchainReply, error) {
+	msg := append([]byte("archive:"), req.SkipchainID...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+	archive, err := s.db.Archive(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveSkipchainReply{Archive: archive}, nil
+}
+
+// PruneSkipchain removes all the blocks of the skipchain from the database
+// of this conode. It is refused if blocks were added after req.Latest, or if
+// the chain is followed.
+func (s *Service) PruneSkipchain(req *PruneSkipchain) (*PruneSkipchainReply, error) {
+	msg := append([]byte("prune:"), req.SkipchainID...)
+	msg = append(msg, req.Latest...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+	removed, err := s.prune(req.SkipchainID, req.Latest)
+	if err != nil {
+		return nil, err
+	}
+	return &PruneSkipchainReply{Removed: removed}, nil
+}
+
+// prune removes the blocks of the skipchain if latest is its last block and
+// it is not followed.
+func (s *Service) prune(id, last SkipBlockID) (int, error) {
+	s.storageMutex.Lock()
+	for _, scid := range s.Storage.FollowIDs {
+		if scid.Equal(id) {
+			s.storageMutex.Unlock()
+			return 0, errors.New("cannot prune a followed skipchain")
+		}
+	}
+	for _, fct := range s.Storage.Follow {
+		if fct.Block.SkipChainID().Equal(id) {
+			s.storageMutex.Unlock()
+			return 0, errors.New("cannot prune a followed skipchain")
+		}
+	}
+	s.storageMutex.Unlock()
+
+	// No block must be added while the chain is pruned.
+	s.chains.lock(id)
+	defer s.chains.unlock(id)
+	genesis := s.db.GetByID(id)
+	if genesis == nil || genesis.Index != 0 {
+		return 0, errors.New("No such genesis-block")
+	}
+	latest, err := s.db.GetLatest(genesis)
+	if err != nil {
+		return 0, err
+	}
+	if !latest.Hash.Equal(last) {
+		return 0, errors.New("skipchain has blocks after the archived one")
+	}
+	removed, err := s.db.Prune(id)
+	if err != nil {
+		return 0, err
+	}
+	log.Lvlf2("%s: pruned %d blocks of skipchain %x", s.ServerIdentity(), removed, id)
+	return removed, nil
+}
+
 // GetDB returns a pointer to the internal database.
 func (s *Service) GetDB() *SkipBlockDB {
 	return s.db
 }
 
+// Health returns an error if the database of the skipblocks cannot be read.
+func (s *Service) Health() error {
+	return s.db.Health()
+}
+
 // NewProtocol intercepts the creation of the skipblock protocol and
 // initialises the necessary variables.
 func (s *Service) NewProtocol(ti *onet.TreeNodeInstance, conf *onet.GenericConfig) (pi onet.ProtocolInstance, err error) {
@@ -902,6 +1199,11 @@ func (s *Service) bftForwardLinkLevel0(msg, data []byte) bool {
 		return false
 	}
 
+	if err := s.checkQuota(fs.Newest); err != nil {
+		log.Lvl2(s.ServerIdentity(), "refusing block:", err)
+		return false
+	}
+
 	ok = func() bool {
 		for _, ver := range fs.Newest.VerifierIDs {
 			f, exists := s.verifiers[ver]
@@ -1102,8 +1404,86 @@ func (s *Service) propagateSkipBlock(msg network.Message) {
 			log.Lvlf2("%s: block is not friendly: %x", s.ServerIdentity(), sb.Hash)
 			return
 		}
-		s.db.Store(sb)
+		s.storeBlock(sb)
+	}
+}
+
+// storeBlock stores the block and notifies the subscribers of its skipchain
+// and the handlers of the bus if the block wasn't known before.
+func (s *Service) storeBlock(sb *SkipBlock) {
+	known := s.db.GetByID(sb.Hash) != nil
+	if s.db.Store(sb) != nil && !known {
+		s.subscribers.notify(sb)
+		s.bus.publish(sb)
+	}
+}
+
+// GetBlocksWithPredicate returns the blocks of the skipchain from index
+// From on for which the registered predicate is true. Only the matching
+// blocks are sent back, up to MaxBlocksByIndexRange of them, so a client
+// interested in a single type of transaction doesn't have to fetch the whole
+// chain.
+func (s *Service) GetBlocksWithPredicate(req *GetBlocksWithPredicate) (*GetBlocksWithPredicateReply, error) {
+	predicate, exists := s.predicates[req.Predicate]
+	if !exists {
+		return nil, errors.New("unknown predicate: " + req.Predicate)
+	}
+	sb := s.db.GetByID(req.Genesis)
+	if sb == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+	if req.From < 0 {
+		return nil, errors.New("invalid range")
+	}
+	sb, err := s.jumpToIndex(sb, req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &GetBlocksWithPredicateReply{Next: -1}
+	for sb != nil {
+		if len(reply.Blocks) == MaxBlocksByIndexRange {
+			reply.Next = sb.Index
+			break
+		}
+		if predicate(sb) {
+			reply.Blocks = append(reply.Blocks, sb)
+		}
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		sb = s.db.GetByID(sb.ForwardLink[0].To)
+	}
+	return reply, nil
+}
+
+// jumpToIndex returns the block with the given index, following the highest
+// forward links from sb.
+func (s *Service) jumpToIndex(sb *SkipBlock, index int) (*SkipBlock, error) {
+	for sb.Index < index {
+		var next *SkipBlock
+		for i := len(sb.ForwardLink) - 1; i >= 0; i-- {
+			b := s.db.GetByID(sb.ForwardLink[i].To)
+			if b != nil && b.Index <= index {
+				next = b
+				break
+			}
+		}
+		if next == nil {
+			return nil, errors.New("No block with this index found")
+		}
+		sb = next
 	}
+	return sb, nil
+}
+
+// Subscribe returns a channel that receives the new blocks of the skipchain
+// as they are stored by this conode, and a function that ends the
+// subscription. Blocks are dropped if the channel is full, so a subscriber
+// that falls behind should catch up with GetUpdateChain.
+func (s *Service) Subscribe(genesis SkipBlockID) (<-chan *SkipBlock, func()) {
+	c := s.subscribers.add(genesis)
+	return c, func() { s.subscribers.remove(genesis, c) }
 }
 
 // RegisterVerification stores the verification in a map and will
@@ -1113,6 +1493,12 @@ func (s *Service) registerVerification(v VerifierID, f SkipBlockVerifier) error
 	return nil
 }
 
+// registerPredicate stores the predicate for GetBlocksWithPredicate.
+func (s *Service) registerPredicate(name string, f BlockPredicate) error {
+	s.predicates[name] = f
+	return nil
+}
+
 // verifyBlock makes sure the basic parameters of a block are correct and returns
 // an error if something fails.
 func (s *Service) verifyBlock(sb *SkipBlock) error {
@@ -1289,6 +1675,7 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 		db:               NewSkipBlockDB(db, bucket),
 		Storage:          &Storage{},
 		verifiers:        map[VerifierID]SkipBlockVerifier{},
+		predicates:       map[string]BlockPredicate{},
 		propTimeout:      defaultPropagateTimeout,
 	}
 
@@ -1296,7 +1683,9 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 	log.ErrFatal(s.RegisterHandlers(s.StoreSkipBlock, s.GetUpdateChain,
-		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetAllSkipchains,
+		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetBlocksByIndexRange, s.GetBlocksWithPredicate, s.GetInclusionProof, s.WaitNewBlocks,
+		s.ArchiveSkipchain, s.PruneSkipchain, s.RepairSkipchain,
+		s.GetAllSkipchains,
 		s.CreateLinkPrivate, s.Unlink, s.AddFollow, s.ListFollow,
 		s.DelFollow, s.Listlink))
 	s.ServiceProcessor.RegisterStatusReporter("Skipblock", s.db)
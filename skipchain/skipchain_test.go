@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -228,7 +231,7 @@ func TestService_MultiLevel(t *testing.T) {
 					for ns, s := range services {
 						for {
 							log.Lvl3("Checking backlink", n, ns)
-							bl, err := s.GetSingleBlock(&GetSingleBlock{i})
+							bl, err := s.GetSingleBlock(&GetSingleBlock{ID: i})
 							log.ErrFatal(err)
 							if len(bl.ForwardLink) == n+1 &&
 								bl.ForwardLink[n].To.Equal(sb.Hash) {
@@ -360,6 +363,59 @@ func TestService_RegisterVerification(t *testing.T) {
 	require.Equal(t, 0, len(ServiceVerifierChan))
 }
 
+func TestBatcher(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	_, el, s := makeHELS(local, 3)
+	genesis, err := makeGenesisRoster(s, el)
+	require.Nil(t, err)
+
+	merge := func(data [][]byte) ([]byte, error) {
+		return bytes.Join(data, []byte(",")), nil
+	}
+	b := NewBatcher(s, 100*time.Millisecond, 0, merge)
+	var wg sync.WaitGroup
+	blocks := make([]*SkipBlock, 5)
+	indexes := make(map[int]bool)
+	var mutex sync.Mutex
+	for i := range blocks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			block, index, err := b.Append(genesis.Hash, []byte{'a' + byte(i)})
+			require.Nil(t, err)
+			mutex.Lock()
+			blocks[i] = block
+			indexes[index] = true
+			mutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 5, len(indexes))
+	for _, block := range blocks {
+		require.Equal(t, blocks[0].Hash, block.Hash)
+	}
+	require.Equal(t, 1, blocks[0].Index)
+	require.Equal(t, 9, len(blocks[0].Data))
+
+	// A full batch is stored without waiting for the window.
+	b = NewBatcher(s, time.Hour, 1, merge)
+	block, index, err := b.Append(genesis.Hash, []byte("x"))
+	require.Nil(t, err)
+	require.Equal(t, 0, index)
+	require.Equal(t, 2, block.Index)
+	require.Equal(t, []byte("x"), block.Data)
+
+	b = NewBatcher(s, time.Millisecond, 0, func([][]byte) ([]byte, error) {
+		return nil, errors.New("invalid batch")
+	})
+	_, _, err = b.Append(genesis.Hash, []byte("x"))
+	require.NotNil(t, err)
+	_, _, err = NewBatcher(s, time.Millisecond, 0, merge).Append(SkipBlockID{1}, []byte("x"))
+	require.NotNil(t, err)
+}
+
 func TestService_StoreSkipBlock2(t *testing.T) {
 	nbrHosts := 3
 	local := onet.NewLocalTest(cothority.Suite)
@@ -1045,6 +1101,111 @@ func TestService_LeaderCatchup(t *testing.T) {
 	}
 }
 
+func TestService_RepairSkipchain(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+
+	hosts := local.GenServers(3)
+	roster := local.GenRosterFromHost(hosts...)
+	leader := local.Services[hosts[0].ServerIdentity.ID][skipchainSID].(*Service)
+	restored := local.Services[hosts[1].ServerIdentity.ID][skipchainSID].(*Service)
+
+	sbRoot := &SkipBlock{
+		SkipBlockFix: &SkipBlockFix{
+			MaximumHeight: 2,
+			BaseHeight:    3,
+			Roster:        roster,
+			Data:          []byte{},
+		},
+	}
+	ssbrep, err := leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: []byte{}, NewBlock: sbRoot})
+	log.ErrFatal(err)
+	genesis := ssbrep.Latest.Hash
+	var third SkipBlockID
+	for i := 0; i < 10; i++ {
+		ssbrep, err = leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: ssbrep.Latest.Hash,
+			NewBlock: sbRoot})
+		log.ErrFatal(err)
+		if i == 3 {
+			third = ssbrep.Latest.Hash
+		}
+	}
+
+	log.Lvl1("Restoring an old backup without the last blocks and forward links")
+	nukeBlocksFrom(t, restored.db, third)
+	sb := restored.db.GetByID(genesis)
+	require.Equal(t, 2, len(sb.ForwardLink))
+	sb.ForwardLink = sb.ForwardLink[:1]
+	require.Nil(t, restored.db.Update(func(tx *bolt.Tx) error {
+		return restored.db.storeToTx(tx, sb)
+	}))
+
+	reply, err := restored.RepairSkipchain(&RepairSkipchain{SkipchainID: genesis})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(reply.Divergences))
+	require.Equal(t, 7, reply.Blocks)
+	require.True(t, reply.ForwardLinks > 0)
+	require.Equal(t, 2, len(restored.db.GetByID(genesis).ForwardLink))
+	latest, err := restored.db.GetLatest(restored.db.GetByID(genesis))
+	require.Nil(t, err)
+	require.True(t, latest.Hash.Equal(ssbrep.Latest.Hash))
+
+	log.Lvl1("Repairing all skipchains")
+	reply, err = restored.RepairSkipchain(&RepairSkipchain{})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(reply.Divergences))
+	require.Equal(t, 0, reply.Blocks+reply.ForwardLinks)
+
+	reply, err = restored.RepairSkipchain(&RepairSkipchain{SkipchainID: third})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(reply.Divergences))
+}
+
+func TestService_RegisterBlockHandler(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+
+	hosts := local.GenServers(3)
+	roster := local.GenRosterFromHost(hosts...)
+	leader := local.Services[hosts[0].ServerIdentity.ID][skipchainSID].(*Service)
+	var mutex sync.Mutex
+	indexes := make([][]int, len(hosts))
+	for i, h := range hosts {
+		i := i
+		require.Nil(t, RegisterBlockHandler(h, func(sb *SkipBlock) {
+			mutex.Lock()
+			indexes[i] = append(indexes[i], sb.Index)
+			mutex.Unlock()
+		}))
+	}
+
+	sbRoot := &SkipBlock{
+		SkipBlockFix: &SkipBlockFix{
+			MaximumHeight: 2,
+			BaseHeight:    2,
+			Roster:        roster,
+			Data:          []byte{},
+		},
+	}
+	ssbrep, err := leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: []byte{}, NewBlock: sbRoot})
+	require.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		ssbrep, err = leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: ssbrep.Latest.Hash,
+			NewBlock: sbRoot})
+		require.Nil(t, err)
+	}
+
+	// Every node gets every block once, in order, even though the forward
+	// links of the previous blocks are stored again.
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, idx := range indexes {
+		require.Equal(t, []int{0, 1, 2, 3}, idx)
+	}
+}
+
 func nukeBlocksFrom(t *testing.T, db *SkipBlockDB, where SkipBlockID) {
 	for {
 		// Get to find forward links.
@@ -1133,3 +1294,75 @@ func TestRosterAddCausesSync(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestService_Quota(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	services := l.GetServices(servers, skipchainSID)
+	s := services[0].(*Service)
+	c := newTestClient(l)
+
+	sb, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	require.Nil(t, err)
+	other, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	require.Nil(t, err)
+	_, err = c.StoreSkipBlock(other, roster, bytes.Repeat([]byte{1}, 3000))
+	require.Nil(t, err)
+	chains, err := s.db.ChainUsage()
+	require.Nil(t, err)
+	var used int64
+	for _, size := range chains {
+		used += size
+	}
+	for _, s := range services {
+		s.(*Service).SetQuota(&Quota{Service: ServiceName, MaxBytes: used + 2500})
+	}
+	usages, err := s.QuotaUsages()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(usages))
+	require.Equal(t, used, usages[0].Bytes)
+	require.Equal(t, 2, len(usages[0].Chains))
+
+	// Blocks are refused once the quota is full.
+	_, err = c.StoreSkipBlock(sb, roster, bytes.Repeat([]byte{2}, 2000))
+	require.Nil(t, err)
+	_, err = c.StoreSkipBlock(sb, roster, bytes.Repeat([]byte{3}, 2000))
+	require.NotNil(t, err)
+	status := s.GetStatus().Field
+	require.Equal(t, "1", status["QuotaRefused "+ServiceName])
+
+	// The eviction policy can archive other skipchains to make room.
+	dir, err := ioutil.TempDir("", "quota")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, s := range services {
+		s := s.(*Service)
+		s.SetEvictionPolicy(func(u *QuotaUsage, size int64) bool {
+			// The policy is called by all conodes, so it must not use
+			// require.
+			for _, chain := range u.Chains {
+				if chain.ID.Equal(sb.Hash) || s.Evict(chain.ID, dir) != nil {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	_, err = c.StoreSkipBlock(sb, roster, bytes.Repeat([]byte{3}, 2000))
+	require.Nil(t, err)
+	require.Nil(t, s.db.GetByID(other.Hash))
+	archive, err := LoadArchive(filepath.Join(dir, fmt.Sprintf("%x.archive", []byte(other.Hash))))
+	require.Nil(t, err)
+	require.Nil(t, VerifyArchive(other.Hash, archive))
+
+	// Skipchains of services with their own quota are not counted.
+	for _, s := range services {
+		s.(*Service).SetQuota(&Quota{Service: "other", MaxBytes: 1,
+			Verifiers: []VerifierID{VerifyBase}})
+	}
+	usages, err = s.QuotaUsages()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(usages))
+	require.Equal(t, int64(0), usages[1].Bytes)
+}
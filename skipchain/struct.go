@@ -7,7 +7,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"strconv"
+	"sync"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
@@ -72,6 +74,15 @@ func (vId VerifierID) IsNil() bool {
 //   newSB is the new block
 type SkipBlockVerifier func(newID []byte, newSB *SkipBlock) bool
 
+// BlockPredicate returns true if the block is of interest for a
+// GetBlocksWithPredicate query. It is usually decoding the data of the block
+// to check the type of the transaction stored in it.
+type BlockPredicate func(sb *SkipBlock) bool
+
+// BlockHandler is called with every new block stored by the conode, see
+// RegisterBlockHandler.
+type BlockHandler func(sb *SkipBlock)
+
 // PolicyNewChain defines how new chains from a followed chain are treated.
 type PolicyNewChain int
 
@@ -198,6 +209,30 @@ func RegisterVerification(s GetService, v VerifierID, f SkipBlockVerifier) error
 	return scs.(*Service).registerVerification(v, f)
 }
 
+// RegisterPredicate stores the predicate under the given name, so that
+// clients can ask for the matching blocks with GetBlocksWithPredicate.
+func RegisterPredicate(s GetService, name string, f BlockPredicate) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerPredicate(name, f)
+}
+
+// RegisterBlockHandler adds the handler to the bus of the skipchain
+// service, so that it is called with every block the conode stores for the
+// first time, whichever skipchain it belongs to. Services use it to keep
+// their indexes of the skipchains up to date instead of reading the
+// skipchains again.
+func RegisterBlockHandler(s GetService, f BlockHandler) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	scs.(*Service).bus.add(f)
+	return nil
+}
+
 var (
 	// VerifyBase checks that the base-parameters are correct, i.e.,
 	// the links are correctly set up, the height-parameters and the
@@ -341,6 +376,8 @@ type SkipBlock struct {
 	// SkipLists that depend on us, given as the first SkipBlock - can
 	// be a Data or a Roster SkipBlock
 	ChildSL []SkipBlockID
+	// Compressed is set if Data is compressed with gzip, see Decompress.
+	Compressed bool
 }
 
 // NewSkipBlock pre-initialises the block so it can be sent over
@@ -379,6 +416,7 @@ func (sb *SkipBlock) Copy() *SkipBlock {
 		Hash:         make([]byte, len(sb.Hash)),
 		ForwardLink:  make([]*ForwardLink, len(sb.ForwardLink)),
 		ChildSL:      make([]SkipBlockID, len(sb.ChildSL)),
+		Compressed:   sb.Compressed,
 	}
 	for i, fl := range sb.ForwardLink {
 		b.ForwardLink[i] = fl.Copy()
@@ -525,12 +563,199 @@ func (fl *ForwardLink) Verify(suite cosi.Suite, pubs []kyber.Point) error {
 		cosi.NewThresholdPolicy(len(pubs)-t))
 }
 
+// VerifyTransition checks that the forward link leads from the block from to
+// the block to and is signed by the roster of from. If the roster changes,
+// the link has to announce the roster of to, so that the old roster
+// co-signed the transition to the new one.
+func (fl *ForwardLink) VerifyTransition(from, to *SkipBlock) error {
+	if !fl.From.Equal(from.Hash) || !fl.To.Equal(to.Hash) {
+		return errors.New("forward link doesn't link the blocks")
+	}
+	if !to.CalculateHash().Equal(to.Hash) {
+		return errors.New("wrong hash of block " + strconv.Itoa(to.Index))
+	}
+	if from.Roster == nil || to.Roster == nil {
+		return errors.New("missing roster in linked blocks")
+	}
+	if !sameRoster(from.Roster, to.Roster) &&
+		(fl.NewRoster == nil || !fl.NewRoster.ID.Equal(to.Roster.ID)) {
+		return errors.New("roster change to block " + strconv.Itoa(to.Index) +
+			" not signed by the previous roster")
+	}
+	return fl.Verify(cothority.Suite, from.Roster.Publics())
+}
+
+// sameRoster returns true if both rosters hold the same keys in the same
+// order.
+func sameRoster(a, b *onet.Roster) bool {
+	if len(a.List) != len(b.List) {
+		return false
+	}
+	for i, si := range a.List {
+		if !si.Public.Equal(b.List[i].Public) {
+			return false
+		}
+	}
+	return true
+}
+
+// InclusionProof proves that a block is part of a skipchain. It holds the
+// blocks on the path from the genesis block to the block, each with the
+// forward link to the next block of the path. As the path follows the
+// highest forward links, it only has a logarithmic number of blocks.
+type InclusionProof struct {
+	Blocks []*SkipBlock
+}
+
+// VerifyInclusionProof checks that the proof leads from the genesis block to
+// the block with the given id. Every block is hashed, and every forward link
+// is verified with the roster of the block it comes from, so the proof can
+// be checked without contacting a conode.
+func VerifyInclusionProof(genesis, id SkipBlockID, proof *InclusionProof) error {
+	if proof == nil || len(proof.Blocks) == 0 {
+		return errors.New("empty inclusion proof")
+	}
+	for i, sb := range proof.Blocks {
+		if sb == nil || sb.SkipBlockFix == nil {
+			return errors.New("missing block in inclusion proof")
+		}
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return errors.New("wrong hash of block " + strconv.Itoa(sb.Index))
+		}
+		if i == 0 {
+			if !sb.Hash.Equal(genesis) {
+				return errors.New("inclusion proof doesn't start at the genesis block")
+			}
+			continue
+		}
+		prev := proof.Blocks[i-1]
+		var link *ForwardLink
+		for _, fl := range prev.ForwardLink {
+			if fl.To.Equal(sb.Hash) && fl.From.Equal(prev.Hash) {
+				link = fl
+				break
+			}
+		}
+		if link == nil {
+			return errors.New("missing forward link to block " + strconv.Itoa(sb.Index))
+		}
+		if prev.Roster == nil {
+			return errors.New("missing roster in block " + strconv.Itoa(prev.Index))
+		}
+		if err := link.VerifyTransition(prev, sb); err != nil {
+			return err
+		}
+	}
+	if !proof.Blocks[len(proof.Blocks)-1].Hash.Equal(id) {
+		return errors.New("inclusion proof doesn't end at the block")
+	}
+	return nil
+}
+
+// Archive holds all the blocks of a skipchain with their forward links, so
+// that the chain can be kept outside of the conodes once it is finished.
+type Archive struct {
+	Blocks []*SkipBlock
+}
+
+// VerifyArchive checks that the archive holds the whole skipchain starting
+// at genesis: every block is hashed, follows the previous one, and all
+// forward links are verified with the roster of the block they come from.
+func VerifyArchive(genesis SkipBlockID, archive *Archive) error {
+	if archive == nil || len(archive.Blocks) == 0 {
+		return errors.New("empty archive")
+	}
+	ids := map[string]*SkipBlock{}
+	for _, sb := range archive.Blocks {
+		if sb == nil || sb.SkipBlockFix == nil {
+			return errors.New("missing block in archive")
+		}
+		ids[string(sb.Hash)] = sb
+	}
+	for i, sb := range archive.Blocks {
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return errors.New("wrong hash of block " + strconv.Itoa(sb.Index))
+		}
+		if sb.Index != i {
+			return errors.New("missing block " + strconv.Itoa(i) + " in archive")
+		}
+		if i == 0 {
+			if !sb.Hash.Equal(genesis) {
+				return errors.New("archive doesn't start at the genesis block")
+			}
+		} else {
+			prev := archive.Blocks[i-1]
+			if len(sb.BackLinkIDs) == 0 || !sb.BackLinkIDs[0].Equal(prev.Hash) {
+				return errors.New("wrong back link in block " + strconv.Itoa(i))
+			}
+			if len(prev.ForwardLink) == 0 || !prev.ForwardLink[0].To.Equal(sb.Hash) {
+				return errors.New("missing forward link to block " + strconv.Itoa(i))
+			}
+		}
+		if len(sb.ForwardLink) > 0 && sb.Roster == nil {
+			return errors.New("missing roster in block " + strconv.Itoa(i))
+		}
+		for _, fl := range sb.ForwardLink {
+			to := ids[string(fl.To)]
+			if !fl.From.Equal(sb.Hash) || to == nil {
+				return errors.New("forward link of block " + strconv.Itoa(i) + " leaves the archive")
+			}
+			if err := fl.VerifyTransition(sb, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Latest returns the last block of the archive.
+func (a *Archive) Latest() *SkipBlock {
+	if len(a.Blocks) == 0 {
+		return nil
+	}
+	return a.Blocks[len(a.Blocks)-1]
+}
+
+// Save writes the archive to a file.
+func (a *Archive) Save(filename string) error {
+	buf, err := network.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf, 0660)
+}
+
+// LoadArchive reads an archive written by Archive.Save. It must still be
+// checked with VerifyArchive.
+func LoadArchive(filename string) (*Archive, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	_, msg, err := network.Unmarshal(buf, cothority.Suite)
+	if err != nil {
+		return nil, err
+	}
+	archive, ok := msg.(*Archive)
+	if !ok {
+		return nil, errors.New("file doesn't hold an archive")
+	}
+	return archive, nil
+}
+
 // SkipBlockDB holds the database to the skipblocks.
 // This is used for verification, so that all links can be followed.
 // It is a wrapper to embed bolt.DB.
 type SkipBlockDB struct {
 	*bolt.DB
 	bucketName []byte
+	// compress is 1 if blocks are sent and stored compressed. It is
+	// accessed atomically, as it can be changed while serving requests.
+	compress int32
+	// usage holds the bytes stored per skipchain, once counted by
+	// ChainUsage.
+	usage      map[string]int64
+	usageMutex sync.Mutex
 }
 
 // NewSkipBlockDB returns an initialized SkipBlockDB structure.
@@ -541,6 +766,20 @@ func NewSkipBlockDB(db *bolt.DB, bn []byte) *SkipBlockDB {
 	}
 }
 
+// Health returns an error if the database is closed or the bucket of the
+// skipblocks is missing.
+func (db *SkipBlockDB) Health() error {
+	if db == nil || db.DB == nil {
+		return errors.New("no database")
+	}
+	return db.DB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(db.bucketName) == nil {
+			return errors.New("missing bucket of the skipblocks")
+		}
+		return nil
+	})
+}
+
 // GetStatus is a function that returns the status report of the db.
 func (db *SkipBlockDB) GetStatus() *onet.Status {
 	out := make(map[string]string)
@@ -752,7 +991,7 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 		c := tx.Bucket([]byte(db.bucketName)).Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			if bytes.HasPrefix(k, match) {
-				_, msg, err := network.Unmarshal(v, cothority.Suite)
+				msg, err := db.unmarshal(v)
 				if err != nil {
 					return errors.New("Unmarshal failed with error: " + err.Error())
 				}
@@ -762,7 +1001,7 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 		}
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			if bytes.HasSuffix(k, match) {
-				_, msg, err := network.Unmarshal(v, cothority.Suite)
+				msg, err := db.unmarshal(v)
 				if err != nil {
 					return errors.New("Unmarshal failed with error: " + err.Error())
 				}
@@ -775,6 +1014,60 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 	return sb, nil
 }
 
+// Archive returns all the blocks of the skipchain, following the level-0
+// forward links from the genesis block.
+func (db *SkipBlockDB) Archive(genesis SkipBlockID) (*Archive, error) {
+	sb := db.GetByID(genesis)
+	if sb == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+	archive := &Archive{Blocks: []*SkipBlock{sb}}
+	for len(sb.ForwardLink) > 0 {
+		sb = db.GetByID(sb.ForwardLink[0].To)
+		if sb == nil {
+			return nil, errors.New("missing block")
+		}
+		archive.Blocks = append(archive.Blocks, sb)
+	}
+	return archive, nil
+}
+
+// Prune removes all the blocks of the skipchain from the database and returns
+// how many were removed.
+func (db *SkipBlockDB) Prune(genesis SkipBlockID) (int, error) {
+	var removed int
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.bucketName))
+		// Keys must not be deleted while iterating over the bucket.
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			sbMsg, err := db.unmarshal(v)
+			if err != nil {
+				return err
+			}
+			sb, ok := sbMsg.(*SkipBlock)
+			if ok && sb.SkipChainID().Equal(genesis) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	if err == nil {
+		db.forget(genesis)
+	}
+	return removed, err
+}
+
 // GetSkipchains returns all latest skipblocks from all skipchains.
 func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
 	return db.getAll()
@@ -785,11 +1078,17 @@ func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
 // The caller must ensure that this function is called from within a valid transaction.
 func (db *SkipBlockDB) storeToTx(tx *bolt.Tx, sb *SkipBlock) error {
 	key := sb.Hash
-	val, err := network.Marshal(sb)
+	val, err := db.marshal(sb)
 	if err != nil {
 		return err
 	}
-	return tx.Bucket([]byte(db.bucketName)).Put(key, val)
+	b := tx.Bucket([]byte(db.bucketName))
+	delta := len(val) - len(b.Get(key))
+	if err := b.Put(key, val); err != nil {
+		return err
+	}
+	db.account(sb.SkipChainID(), int64(delta))
+	return nil
 }
 
 // getFromTx returns the skipblock identified by sbID.
@@ -802,7 +1101,7 @@ func (db *SkipBlockDB) getFromTx(tx *bolt.Tx, sbID SkipBlockID) (*SkipBlock, err
 		return nil, nil
 	}
 
-	_, sbMsg, err := network.Unmarshal(val, cothority.Suite)
+	sbMsg, err := db.unmarshal(val)
 	if err != nil {
 		return nil, err
 	}
@@ -819,7 +1118,7 @@ func (db *SkipBlockDB) getAll() (map[string]*SkipBlock, error) {
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(db.bucketName))
 		return b.ForEach(func(k, v []byte) error {
-			_, sbMsg, err := network.Unmarshal(v, cothority.Suite)
+			sbMsg, err := db.unmarshal(v)
 			if err != nil {
 				return err
 			}
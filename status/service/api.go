@@ -25,3 +25,13 @@ func (c *Client) Request(dst *network.ServerIdentity) (*Response, error) {
 	}
 	return resp, nil
 }
+
+// Health asks dst whether all its services are healthy.
+func (c *Client) Health(dst *network.ServerIdentity) (*HealthResponse, error) {
+	resp := &HealthResponse{}
+	err := c.SendProtobuf(dst, &HealthRequest{}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,43 @@
+package status
+
+import (
+	"sort"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// HealthChecker is implemented by the services that can tell whether they
+// are able to handle requests, e.g. because their database is open and
+// their keys are available.
+type HealthChecker interface {
+	Health() error
+}
+
+// healthOK is the status of a healthy service in HealthResponse.
+const healthOK = "ok"
+
+// Health asks all services of the server that implement HealthChecker
+// whether they are healthy. The server is healthy if all of them are.
+func (st *Stat) Health(req *HealthRequest) (*HealthResponse, error) {
+	resp := &HealthResponse{
+		Healthy:  true,
+		Services: make(map[string]string),
+	}
+	names := onet.ServiceFactory.RegisteredServiceNames()
+	sort.Strings(names)
+	for _, name := range names {
+		checker, ok := st.Service(name).(HealthChecker)
+		if !ok {
+			continue
+		}
+		if err := checker.Health(); err != nil {
+			log.Lvl2(name, "is not healthy:", err)
+			resp.Healthy = false
+			resp.Services[name] = err.Error()
+			continue
+		}
+		resp.Services[name] = healthOK
+	}
+	return resp, nil
+}
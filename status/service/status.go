@@ -19,6 +19,8 @@ func init() {
 	onet.RegisterNewService(ServiceName, newStatService)
 	network.RegisterMessage(&Request{})
 	network.RegisterMessage(&Response{})
+	network.RegisterMessage(&HealthRequest{})
+	network.RegisterMessage(&HealthResponse{})
 
 }
 
@@ -43,7 +45,7 @@ func newStatService(c *onet.Context) (onet.Service, error) {
 	s := &Stat{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 	}
-	err := s.RegisterHandler(s.Request)
+	err := s.RegisterHandlers(s.Request, s.Health)
 	if err != nil {
 		return nil, err
 	}
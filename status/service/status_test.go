@@ -1,6 +1,7 @@
 package status
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/dedis/kyber/suites"
@@ -35,3 +36,38 @@ func TestServiceStatus(t *testing.T) {
 	log.Lvl1(stat)
 	assert.NotEmpty(t, stat.Status["Generic"].Field["Available_Services"])
 }
+
+// healthService is a service whose health is set by the test.
+type healthService struct {
+	*onet.ServiceProcessor
+}
+
+var healthError error
+
+func (hs *healthService) Health() error {
+	return healthError
+}
+
+func TestServiceHealth(t *testing.T) {
+	_, err := onet.RegisterNewService("HealthTest", func(c *onet.Context) (onet.Service, error) {
+		return &healthService{onet.NewServiceProcessor(c)}, nil
+	})
+	log.ErrFatal(err)
+	defer onet.UnregisterService("HealthTest")
+	local := onet.NewTCPTest(tSuite)
+	_, el, _ := local.GenTree(2, false)
+	defer local.CloseAll()
+
+	client := NewTestClient(local)
+	health, err := client.Health(el.List[0])
+	log.ErrFatal(err)
+	assert.True(t, health.Healthy)
+	assert.Equal(t, healthOK, health.Services["HealthTest"])
+
+	healthError = errors.New("database closed")
+	defer func() { healthError = nil }()
+	health, err = client.Health(el.List[0])
+	log.ErrFatal(err)
+	assert.False(t, health.Healthy)
+	assert.Equal(t, "database closed", health.Services["HealthTest"])
+}
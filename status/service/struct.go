@@ -14,3 +14,14 @@ type Response struct {
 	Status         map[string]*onet.Status
 	ServerIdentity *network.ServerIdentity
 }
+
+// HealthRequest asks the server whether all its services are healthy.
+type HealthRequest struct {
+}
+
+// HealthResponse holds "ok" or the error for every service that checks its
+// health.
+type HealthResponse struct {
+	Healthy  bool
+	Services map[string]string
+}